@@ -0,0 +1,81 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// ---------------------
+// Agenda del día (Google)
+// ---------------------
+// Los turnos que el bot reservó traen el nombre y el teléfono del contacto en las extended
+// properties del evento (EventPropertyContactName / EventPropertyContactWaID); los cargados
+// a mano, el título.
+
+// AgendaItem es un turno del día (ver DayAgenda).
+type AgendaItem struct {
+	Start    time.Time
+	Name     string
+	Phone    string
+	Resource string // nombre de la agenda
+}
+
+// DayAgenda devuelve los turnos del día (en todas las agendas) ordenados por horario.
+// Los eventos de día completo y los que no ocupan (transparentes) no cuentan.
+func (c *Service) DayAgenda(ctx context.Context, day time.Time) ([]AgendaItem, error) {
+	day = day.In(Location())
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	until := from.AddDate(0, 0, 1)
+
+	var items []AgendaItem
+	seen := make(map[string]bool) // la misma agenda puede estar en dos resources
+	for _, r := range c.resources {
+		if seen[r.CalendarID] {
+			continue
+		}
+		seen[r.CalendarID] = true
+		err := c.srv.Events.List(r.CalendarID).
+			TimeMin(from.Format(time.RFC3339)).
+			TimeMax(until.Format(time.RFC3339)).
+			SingleEvents(true).
+			OrderBy("startTime").
+			Pages(ctx, func(evs *gcal.Events) error {
+				for _, ev := range evs.Items {
+					if it, ok := agendaItem(ev, r.Name); ok {
+						items = append(items, it)
+					}
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, fmt.Errorf("agenda %s: %w", r.ID, err)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Start.Before(items[j].Start) })
+	return items, nil
+}
+
+func agendaItem(ev *gcal.Event, resource string) (AgendaItem, bool) {
+	if ev.Status == "cancelled" || ev.Transparency == "transparent" || ev.Start == nil || ev.Start.DateTime == "" {
+		return AgendaItem{}, false
+	}
+	start, err := time.Parse(time.RFC3339, ev.Start.DateTime)
+	if err != nil {
+		return AgendaItem{}, false
+	}
+	it := AgendaItem{Start: start, Name: ev.Summary, Resource: resource}
+	if ev.ExtendedProperties != nil {
+		if n := ev.ExtendedProperties.Private[EventPropertyContactName]; n != "" {
+			it.Name = n
+		}
+		it.Phone = ev.ExtendedProperties.Private[EventPropertyContactWaID]
+	}
+	if it.Name == "" {
+		it.Name = "(sin título)"
+	}
+	return it, true
+}
@@ -0,0 +1,312 @@
+package calendar
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// ---------------------
+// Cache de disponibilidad (Google Calendar)
+// ---------------------
+// Cada pedido de turnos consultaba el free/busy de las agendas. Ahora el free/busy de cada
+// calendario (tenant + calendar_id) queda cacheado CALENDAR_CACHE_SECONDS (default 60, 0 =
+// sin cache). Reservar o cancelar desde el bot invalida el calendario; la reserva vuelve a
+// chequear en vivo igual, así que un cache viejo a lo sumo termina en slot_taken.
+//
+// Con CALENDAR_WATCH=1, además, cada calendario consultado se suscribe a push notifications
+// de Google (watch channel a PUBLIC_BASE_URL/calendar/notifications): cuando alguien toca la
+// agenda (un turno cargado a mano, una cancelación) el cache se descarta al instante, y
+// mientras el canal está vigente el cache dura hasta 30 minutos. Los canales duran una
+// semana y se renuevan solos con el uso. La URL tiene que ser HTTPS pública.
+//
+// El cache y los canales son por proceso. Con varias réplicas, OnInvalidate avisa a las
+// demás cada vez que se invalida un calendario (ellas llaman a InvalidateLocal), y la app
+// reenvía las notificaciones de canales que abrió otra réplica (Notify devuelve known=false).
+//
+// ENV:
+//
+//	CALENDAR_CACHE_SECONDS=60
+//	CALENDAR_WATCH=1
+//	PUBLIC_BASE_URL=https://flowly.example.com
+
+const (
+	NotificationsPath        = "/calendar/notifications"
+	defaultBusyCacheTTL      = time.Minute
+	watchedBusyCacheTTL      = 30 * time.Minute
+	busyCacheMargin          = 24 * time.Hour // se pide un día más de free/busy para que el cache sirva todo el día
+	calendarWatchTTL         = 7 * 24 * time.Hour
+	calendarWatchRenewBefore = time.Hour
+	calendarWatchRetry       = 30 * time.Minute
+	calendarWatchTimeout     = 15 * time.Second
+)
+
+type BusyCache struct {
+	ttl      time.Duration
+	watchURL string // "" = sin watch channels
+
+	// OnInvalidate avisa a las otras réplicas (nil = una sola)
+	OnInvalidate func(tenant, calendarID string)
+	// OnLookup se llama en cada consulta de free/busy (para métricas de hit/miss)
+	OnLookup func(tenant string, hit bool)
+
+	mu       sync.Mutex
+	entries  map[string]*busyEntry    // tenant|calendar_id
+	watches  map[string]*watchChannel // tenant|calendar_id -> canal vigente
+	channels map[string]*watchChannel // channel id -> canal (para las notificaciones)
+}
+
+type busyEntry struct {
+	busy      []*gcal.TimePeriod
+	until     time.Time // hasta dónde llega el free/busy consultado
+	fetchedAt time.Time
+}
+
+type watchChannel struct {
+	id, resourceID, token string
+	tenant, calendarID    string
+	expires               time.Time
+	retryAt               time.Time // si falló el watch, no reintentar hasta entonces
+}
+
+// NewBusyCacheFromEnv devuelve nil con CALENDAR_CACHE_SECONDS=0 (sin cache).
+func NewBusyCacheFromEnv() *BusyCache {
+	ttl := defaultBusyCacheTTL
+	if strings.TrimSpace(os.Getenv("CALENDAR_CACHE_SECONDS")) == "0" {
+		return nil
+	}
+	ttl = time.Duration(envPositiveInt("CALENDAR_CACHE_SECONDS", int(ttl/time.Second))) * time.Second
+
+	c := &BusyCache{
+		ttl:      ttl,
+		entries:  make(map[string]*busyEntry),
+		watches:  make(map[string]*watchChannel),
+		channels: make(map[string]*watchChannel),
+	}
+	if os.Getenv("CALENDAR_WATCH") == "1" {
+		base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+		if strings.HasPrefix(base, "https://") {
+			c.watchURL = base + NotificationsPath
+		} else {
+			log.Printf("⚠️ CALENDAR_WATCH=1 necesita PUBLIC_BASE_URL con https://; sigo sin push notifications")
+		}
+	}
+	return c
+}
+
+func envPositiveInt(name string, def int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name))); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func busyKey(tenant, calendarID string) string {
+	return tenant + "|" + calendarID
+}
+
+// get devuelve el free/busy cacheado si cubre hasta until y sigue fresco.
+func (c *BusyCache) get(tenant, calendarID string, until time.Time) ([]*gcal.TimePeriod, bool) {
+	if c == nil {
+		return nil, false
+	}
+	key := busyKey(tenant, calendarID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.until.Before(until) {
+		return nil, false
+	}
+	ttl := c.ttl
+	if w := c.watches[key]; w != nil && w.id != "" && time.Now().Before(w.expires) {
+		ttl = max(ttl, watchedBusyCacheTTL)
+	}
+	if time.Since(e.fetchedAt) > ttl {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.busy, true
+}
+
+func (c *BusyCache) lookup(tenant string, hit bool) {
+	if c.OnLookup != nil {
+		c.OnLookup(tenant, hit)
+	}
+}
+
+func (c *BusyCache) put(tenant, calendarID string, until time.Time, busy []*gcal.TimePeriod) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[busyKey(tenant, calendarID)] = &busyEntry{busy: busy, until: until, fetchedAt: time.Now()}
+}
+
+// Invalidate descarta el free/busy cacheado del calendario, acá y en las otras réplicas.
+func (c *BusyCache) Invalidate(tenant, calendarID string) {
+	if c == nil {
+		return
+	}
+	c.InvalidateLocal(tenant, calendarID)
+	if c.OnInvalidate != nil {
+		c.OnInvalidate(tenant, calendarID)
+	}
+}
+
+// InvalidateLocal descarta el free/busy cacheado solo en este proceso (el aviso de otra réplica).
+func (c *BusyCache) InvalidateLocal(tenant, calendarID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, busyKey(tenant, calendarID))
+}
+
+// InvalidateAll descarta el free/busy de todos los calendarios.
+func (c *BusyCache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// watch suscribe el calendario a push notifications si no tiene un canal vigente (o si el
+// suyo está por vencer). Corre en background: la consulta de turnos no lo espera.
+func (c *BusyCache) watch(srv *gcal.Service, tenant, calendarID string) {
+	if c == nil || c.watchURL == "" {
+		return
+	}
+	key := busyKey(tenant, calendarID)
+	now := time.Now()
+
+	c.mu.Lock()
+	old := c.watches[key]
+	if old != nil && (old.expires.After(now.Add(calendarWatchRenewBefore)) || now.Before(old.retryAt)) {
+		c.mu.Unlock()
+		return
+	}
+	// Marca para que otra consulta no arranque el mismo watch mientras tanto
+	pending := &watchChannel{tenant: tenant, calendarID: calendarID, retryAt: now.Add(calendarWatchRetry)}
+	if old != nil {
+		pending.id, pending.resourceID, pending.token, pending.expires = old.id, old.resourceID, old.token, old.expires
+	}
+	c.watches[key] = pending
+	c.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), calendarWatchTimeout)
+		defer cancel()
+		ch := &watchChannel{id: randomHex(16), token: randomHex(16), tenant: tenant, calendarID: calendarID}
+		res, err := srv.Events.Watch(calendarID, &gcal.Channel{
+			Id:         ch.id,
+			Type:       "web_hook",
+			Address:    c.watchURL,
+			Token:      ch.token,
+			Expiration: now.Add(calendarWatchTTL).UnixMilli(),
+		}).Context(ctx).Do()
+		if err != nil {
+			log.Printf("⚠️ tenant=%s no pude suscribirme a los cambios de %s (reintento en %s): %v", tenant, calendarID, calendarWatchRetry, err)
+			return
+		}
+		ch.resourceID = res.ResourceId
+		ch.expires = time.UnixMilli(res.Expiration)
+
+		c.mu.Lock()
+		c.watches[key] = ch
+		c.channels[ch.id] = ch
+		if old != nil {
+			delete(c.channels, old.id)
+		}
+		c.mu.Unlock()
+		log.Printf("📅 tenant=%s suscripto a cambios de %s hasta %s", tenant, calendarID, ch.expires.Format(time.RFC3339))
+
+		if old != nil && old.id != "" {
+			if err := srv.Channels.Stop(&gcal.Channel{Id: old.id, ResourceId: old.resourceID}).Context(ctx).Do(); err != nil {
+				log.Printf("⚠️ tenant=%s no pude cerrar el canal viejo de %s: %v", tenant, calendarID, err)
+			}
+		}
+	}()
+}
+
+// Notify aplica el aviso de cambio de un canal (headers X-Goog-Channel-ID y
+// X-Goog-Channel-Token): si el canal es de este proceso y el token coincide, descarta el
+// free/busy del calendario y devuelve su tenant. known=false si el canal no es de acá.
+func (c *BusyCache) Notify(channelID, token string) (tenant string, known bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	ch := c.channels[channelID]
+	c.mu.Unlock()
+	if ch == nil {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ch.token)) != 1 {
+		return "", true
+	}
+	c.Invalidate(ch.tenant, ch.calendarID)
+	return ch.tenant, true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// busyPeriods devuelve el free/busy de las agendas entre from y until: lo cacheado y, en una
+// sola consulta, el de las que falten.
+func (c *Service) busyPeriods(ctx context.Context, targets []Resource, from, until time.Time) (map[string][]*gcal.TimePeriod, error) {
+	out := make(map[string][]*gcal.TimePeriod, len(targets))
+	queryUntil := until
+	if c.Busy != nil {
+		queryUntil = until.Add(busyCacheMargin)
+	}
+	query := &gcal.FreeBusyRequest{
+		TimeMin: from.Format(time.RFC3339),
+		TimeMax: queryUntil.Format(time.RFC3339),
+	}
+	for _, r := range targets {
+		if _, done := out[r.CalendarID]; done {
+			continue
+		}
+		if busy, ok := c.Busy.get(c.Tenant, r.CalendarID, until); ok {
+			out[r.CalendarID] = busy
+			c.Busy.lookup(c.Tenant, true)
+			continue
+		}
+		out[r.CalendarID] = nil
+		query.Items = append(query.Items, &gcal.FreeBusyRequestItem{Id: r.CalendarID})
+	}
+	if len(query.Items) == 0 {
+		return out, nil
+	}
+
+	res, err := c.srv.Freebusy.Query(query).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range query.Items {
+		cal := res.Calendars[it.Id]
+		out[it.Id] = cal.Busy
+		if c.Busy != nil && len(cal.Errors) == 0 {
+			c.Busy.lookup(c.Tenant, false)
+			c.Busy.put(c.Tenant, it.Id, queryUntil, cal.Busy)
+			c.Busy.watch(c.srv, c.Tenant, it.Id)
+		}
+	}
+	return out, nil
+}
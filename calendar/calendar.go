@@ -0,0 +1,249 @@
+// Package calendar es la agenda de turnos de flowly: disponibilidad y reservas sobre Google
+// Calendar (free/busy, feriados, bloqueos, Meet) o delegadas a Cal.com / Calendly. No sabe
+// nada de flows ni de WhatsApp; la app arma la Config (calendar.json) y usa el Provider.
+//
+//	p, err := calendar.New(cfg, option.WithCredentialsFile("sa.json"), nil)
+//	slots, more, err := p.GetNextAvailableSlots(ctx, "", 0, 0, 9)
+//	appt, err := p.CreateAppointment(ctx, calendar.AppointmentRequest{Start: slots[0].ISOValue, ...})
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+const (
+	ProviderGoogle   = "google"
+	ProviderCalCom   = "calcom"
+	ProviderCalendly = "calendly"
+
+	GoogleAuthServiceAccount = "service_account"
+	GoogleAuthOAuth          = "oauth"
+
+	// SearchDays es la ventana en la que se buscan turnos (días desde hoy)
+	SearchDays = 21
+
+	// Extended properties que CreateAppointment deja en el evento de Google (ver agenda.go)
+	EventPropertyContactName = "flowly_name"
+	EventPropertyContactWaID = "flowly_phone"
+
+	defaultResourceID = "default"
+	defaultSlotsLimit = 9 // 9 filas + "Ver más" entran en el límite de 10 rows de WhatsApp
+)
+
+// ErrSlotTaken: el horario elegido se ocupó entre que se mostró y se confirmó.
+var ErrSlotTaken = errors.New("el horario ya no está disponible")
+
+// Provider es lo que las acciones de turnos necesitan de una agenda.
+type Provider interface {
+	Resource(id string) (Resource, bool)
+	Resources() []Resource
+	// duration 0 = la de la Config (con Cal.com / Calendly la define el event type)
+	GetNextAvailableSlots(ctx context.Context, resourceID string, duration time.Duration, offset, limit int) ([]Slot, bool, error)
+	CreateAppointment(ctx context.Context, req AppointmentRequest) (Appointment, error)
+	CancelAppointment(ctx context.Context, eventID string) error
+}
+
+// Config es la parte de calendar.json que define la agenda.
+type Config struct {
+	// Quién calcula disponibilidad y reserva: "google" (default), "calcom" o "calendly"
+	// (ver providers.go). Con calcom/calendly, calendar_id es el event type.
+	Provider string          `json:"provider,omitempty"`
+	CalCom   *CalComConfig   `json:"calcom,omitempty"`
+	Calendly *CalendlyConfig `json:"calendly,omitempty"`
+
+	// Con Google: "service_account" (default) u "oauth" (la cuenta que conectó el tenant).
+	// Las credenciales las pasa quien llama a New.
+	GoogleAuth string `json:"google_auth,omitempty"`
+
+	CalendarID string `json:"calendar_id"`
+	// Varios profesionales: cada uno con su calendario (reemplaza a calendar_id)
+	Calendars []Resource `json:"calendars,omitempty"`
+
+	StartHour int   `json:"start_hour"`
+	EndHour   int   `json:"end_hour"`
+	WorkDays  []int `json:"work_days"` // 0=Domingo, 1=Lunes...
+
+	// Duración y márgenes (en minutos). Si faltan: turnos de 60 min, sin buffers,
+	// y la granularidad igual a la duración del turno.
+	SlotDurationMinutes    int `json:"slot_duration_minutes,omitempty"`
+	BufferBeforeMinutes    int `json:"buffer_before_minutes,omitempty"`
+	BufferAfterMinutes     int `json:"buffer_after_minutes,omitempty"`
+	SlotGranularityMinutes int `json:"slot_granularity_minutes,omitempty"`
+
+	// Invitar al paciente (ContactEmail del turno) al evento. Con un service account
+	// requiere delegación de dominio en Google Workspace.
+	InviteAttendee bool `json:"invite_attendee,omitempty"`
+	// Agregar link de Google Meet a todos los turnos (si no, solo a los que piden Meet)
+	MeetLink bool `json:"meet_link,omitempty"`
+
+	// Días sin turnos aunque sean work_days (ver holidays.go)
+	Holidays          []string   `json:"holidays,omitempty"`
+	HolidayCalendarID string     `json:"holiday_calendar_id,omitempty"`
+	Blackouts         []Blackout `json:"blackouts,omitempty"`
+}
+
+// Resource es una agenda reservable (ej: un profesional o un consultorio).
+// En calendar.json:
+//
+//	"calendars": [
+//	  { "id": "PRO_PEREZ", "name": "Dra. Pérez", "calendar_id": "perez@clinica.com" },
+//	  { "id": "PRO_GOMEZ", "name": "Dr. Gómez",  "calendar_id": "gomez@clinica.com" }
+//	]
+type Resource struct {
+	ID         string `json:"id"`   // se usa como id de la opción en el flow (ej: "PRO_PEREZ")
+	Name       string `json:"name"` // ej: "Dra. Pérez"
+	CalendarID string `json:"calendar_id"`
+}
+
+type Slot struct {
+	ID       string
+	ISOValue string
+
+	// Agenda donde se reserva (con "cualquiera", la primera que esté libre)
+	ResourceID   string
+	ResourceName string
+	ShowResource bool // se buscó en varias agendas: el texto dice en cuál
+}
+
+// AppointmentRequest son los datos de un turno a crear.
+type AppointmentRequest struct {
+	ResourceID   string // agenda ("" = la primera)
+	Start        string // RFC3339
+	ContactName  string
+	ContactPhone string
+	ContactEmail string // con invite_attendee, se lo agrega como invitado
+	Meet         bool   // pedir un link de Google Meet (consulta virtual)
+
+	// Título y descripción del evento ("" = los de siempre)
+	Title       string
+	Description string
+
+	Duration time.Duration // 0 = SlotDuration
+	ColorID  string
+}
+
+// Appointment es el turno creado en la agenda.
+type Appointment struct {
+	EventID  string
+	MeetURL  string // vacío si no se pidió (o Google no llegó a generarlo)
+	HTMLLink string
+	Start    time.Time
+	End      time.Time
+}
+
+// DefaultConfig son los valores que se usan cuando calendar.json no los trae.
+func DefaultConfig() Config {
+	return Config{
+		StartHour:           9,
+		EndHour:             17,
+		WorkDays:            []int{1, 2, 3, 4, 5}, // Lun-Vie
+		SlotDurationMinutes: 60,
+	}
+}
+
+// Validate chequea la config y corrige los valores fuera de rango para que no explote el
+// loop de disponibilidad.
+func (cfg *Config) Validate() error {
+	switch cfg.Provider {
+	case "", ProviderGoogle, ProviderCalCom, ProviderCalendly:
+	default:
+		return fmt.Errorf("provider de agenda desconocido: %q", cfg.Provider)
+	}
+	switch cfg.GoogleAuth {
+	case "", GoogleAuthServiceAccount, GoogleAuthOAuth:
+	default:
+		return fmt.Errorf("google_auth desconocido: %q", cfg.GoogleAuth)
+	}
+	if cfg.CalendarID == "" && len(cfg.Calendars) == 0 {
+		return fmt.Errorf("no se encontró calendar_id")
+	}
+	seen := map[string]bool{}
+	for _, r := range cfg.Calendars {
+		if r.ID == "" || r.CalendarID == "" {
+			return fmt.Errorf("calendars: cada uno necesita id y calendar_id")
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("calendars: id duplicado %q", r.ID)
+		}
+		seen[r.ID] = true
+	}
+
+	if cfg.StartHour < 0 {
+		cfg.StartHour = 9
+	}
+	if cfg.EndHour > 24 {
+		cfg.EndHour = 17
+	}
+	if len(cfg.WorkDays) == 0 {
+		cfg.WorkDays = []int{1, 2, 3, 4, 5}
+	}
+	if cfg.SlotDurationMinutes <= 0 {
+		cfg.SlotDurationMinutes = 60
+	}
+	if cfg.BufferBeforeMinutes < 0 {
+		cfg.BufferBeforeMinutes = 0
+	}
+	if cfg.BufferAfterMinutes < 0 {
+		cfg.BufferAfterMinutes = 0
+	}
+	if cfg.SlotGranularityMinutes <= 0 {
+		cfg.SlotGranularityMinutes = cfg.SlotDurationMinutes
+	}
+	_, err := cfg.closedPeriods()
+	return err
+}
+
+// Resources devuelve las agendas de la config; con solo calendar_id es una única "default".
+func (cfg Config) Resources() []Resource {
+	if len(cfg.Calendars) > 0 {
+		return cfg.Calendars
+	}
+	return []Resource{{ID: defaultResourceID, CalendarID: cfg.CalendarID}}
+}
+
+// New arma la agenda según cfg.Provider. auth son las credenciales de Google (solo se usan
+// con provider google) y httpClient el cliente para Cal.com / Calendly (nil = uno propio).
+func New(cfg Config, auth option.ClientOption, httpClient *http.Client) (Provider, error) {
+	if httpClient == nil {
+		httpClient = defaultHTTPClient
+	}
+	switch cfg.Provider {
+	case ProviderCalCom:
+		return newCalComProvider(cfg, httpClient)
+	case ProviderCalendly:
+		return newCalendlyProvider(cfg, httpClient)
+	default:
+		return NewService(cfg, auth)
+	}
+}
+
+// Location es la zona horaria de la agenda.
+func Location() *time.Location {
+	loc, err := time.LoadLocation("America/Argentina/Buenos_Aires")
+	if err != nil {
+		fmt.Printf("⚠️ No se pudo cargar zona horaria, usando Local: %v\n", err)
+		return time.Local
+	}
+	return loc
+}
+
+// sleepCtx espera d o hasta que se cancele ctx.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
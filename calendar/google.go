@@ -0,0 +1,402 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// ---------------------
+// Google Calendar
+// ---------------------
+// La disponibilidad sale del free/busy de las agendas, dentro de la jornada (start_hour,
+// end_hour, work_days) y con los buffers de la Config. Reservar vuelve a chequear en vivo y
+// resuelve la carrera entre réplicas (gana el evento creado primero).
+
+type Service struct {
+	srv       *gcal.Service
+	resources []Resource // uno por profesional/recurso (al menos uno)
+	StartHour int
+	EndHour   int
+	WorkDays  []int // 0=Domingo, 1=Lunes...
+
+	SlotDuration time.Duration // duración de cada turno
+	BufferBefore time.Duration // margen libre requerido antes del turno
+	BufferAfter  time.Duration // margen libre requerido después del turno
+	Granularity  time.Duration // cada cuánto puede arrancar un turno (ej: cada 15 min)
+
+	InviteAttendee bool
+	MeetLink       bool
+
+	// Tenant va en los logs y las métricas; Busy es el cache de free/busy compartido entre
+	// los Service de la app (ver busy_cache.go), nil = sin cache
+	Tenant string
+	Busy   *BusyCache
+
+	// Feriados y bloqueos (ver holidays.go)
+	closed            closedPeriods
+	holidayCalendarID string
+	holidays          holidayCache
+}
+
+// NewService arma el cliente de Google con las credenciales de auth. El cliente vive más
+// que un request, por eso no recibe su context (cada llamada pasa el suyo).
+func NewService(cfg Config, auth option.ClientOption) (*Service, error) {
+	ctx := context.Background()
+	srv, err := gcal.NewService(ctx, auth)
+	if err != nil {
+		return nil, fmt.Errorf("error creando cliente calendar: %v", err)
+	}
+
+	closed, err := cfg.closedPeriods()
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		srv:       srv,
+		resources: cfg.Resources(),
+		StartHour: cfg.StartHour,
+		EndHour:   cfg.EndHour,
+		WorkDays:  cfg.WorkDays,
+
+		SlotDuration: time.Duration(cfg.SlotDurationMinutes) * time.Minute,
+		BufferBefore: time.Duration(cfg.BufferBeforeMinutes) * time.Minute,
+		BufferAfter:  time.Duration(cfg.BufferAfterMinutes) * time.Minute,
+		Granularity:  time.Duration(cfg.SlotGranularityMinutes) * time.Minute,
+
+		InviteAttendee: cfg.InviteAttendee,
+		MeetLink:       cfg.MeetLink,
+
+		closed:            closed,
+		holidayCalendarID: cfg.HolidayCalendarID,
+	}, nil
+}
+
+// Resource busca una agenda por id.
+func (c *Service) Resource(id string) (Resource, bool) {
+	for _, r := range c.resources {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+// Resources devuelve las agendas del tenant.
+func (c *Service) Resources() []Resource {
+	return c.resources
+}
+
+// GetNextAvailableSlots busca turnos libres de duration (0 = SlotDuration) en la agenda
+// resourceID, o en todas si es "". Devuelve la página [offset, offset+limit) y si hay más
+// turnos después de ella. Los IDs son relativos a la página (SLOT_1..SLOT_limit) para que
+// el flow mapee filas fijas.
+func (c *Service) GetNextAvailableSlots(ctx context.Context, resourceID string, duration time.Duration, offset, limit int) ([]Slot, bool, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if duration <= 0 {
+		duration = c.SlotDuration
+	}
+	if limit <= 0 {
+		limit = defaultSlotsLimit
+	}
+
+	targets := c.resources
+	if resourceID != "" {
+		r, ok := c.Resource(resourceID)
+		if !ok {
+			return nil, false, fmt.Errorf("agenda desconocida: %q", resourceID)
+		}
+		targets = []Resource{r}
+	}
+
+	// 1. Cargamos la zona horaria
+	loc := Location()
+
+	now := time.Now().In(loc)
+
+	// Free/busy de toda la ventana de búsqueda (cacheado o en una sola consulta)
+	busy, err := c.busyPeriods(ctx, targets, now, now.AddDate(0, 0, SearchDays))
+	if err != nil {
+		return nil, false, err
+	}
+	holidays := c.holidayDays(ctx, now, now.AddDate(0, 0, SearchDays))
+
+	var slots []Slot
+	skipped := 0
+	hasMore := false
+
+	// Iteramos los próximos días hasta llenar la página (y ver si hay uno más)
+	for d := 0; d < SearchDays && !hasMore; d++ {
+		day := now.AddDate(0, 0, d)
+		weekday := int(day.Weekday()) // 0=Domingo, 1=Lunes...
+
+		// Chequeamos si hoy se trabaja
+		isWorkingDay := false
+		for _, wd := range c.WorkDays {
+			if wd == weekday {
+				isWorkingDay = true
+				break
+			}
+		}
+		if !isWorkingDay || c.closed.closedDay(day, holidays) {
+			continue
+		}
+
+		// Iteramos la jornada configurada, avanzando según la granularidad
+		dayStart := time.Date(day.Year(), day.Month(), day.Day(), c.StartHour, 0, 0, 0, loc)
+		dayEnd := time.Date(day.Year(), day.Month(), day.Day(), c.EndHour, 0, 0, 0, loc)
+
+		for slotStart := dayStart; !slotStart.Add(duration).After(dayEnd); slotStart = slotStart.Add(c.Granularity) {
+			if hasMore {
+				break
+			}
+
+			slotEnd := slotStart.Add(duration)
+
+			// No mostrar horas pasadas
+			if slotStart.Before(now) {
+				continue
+			}
+
+			// La ventana a chequear incluye los buffers (ej: traslado, limpieza del consultorio)
+			checkStart := slotStart.Add(-c.BufferBefore)
+			checkEnd := slotEnd.Add(c.BufferAfter)
+
+			// Chequeo de ocupación en Google: sirve la primera agenda libre
+			for _, r := range targets {
+				if isBusyIn(busy[r.CalendarID], checkStart, checkEnd) || c.closed.closed(slotStart, slotEnd, r.ID, holidays) {
+					continue
+				}
+				// Turnos de páginas anteriores
+				if skipped < offset {
+					skipped++
+					break
+				}
+				if len(slots) >= limit {
+					hasMore = true
+					break
+				}
+				slots = append(slots, Slot{
+					ID:           fmt.Sprintf("SLOT_%d", len(slots)+1),
+					ISOValue:     slotStart.Format(time.RFC3339),
+					ResourceID:   r.ID,
+					ResourceName: r.Name,
+					ShowResource: len(targets) > 1,
+				})
+				break
+			}
+		}
+	}
+
+	return slots, hasMore, nil
+}
+
+func isBusyIn(busy []*gcal.TimePeriod, start, end time.Time) bool {
+	for _, b := range busy {
+		bStart, _ := time.Parse(time.RFC3339, b.Start)
+		bEnd, _ := time.Parse(time.RFC3339, b.End)
+
+		// Intersección de horarios
+		if start.Before(bEnd) && end.After(bStart) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAppointment crea el evento en la agenda del request.
+func (c *Service) CreateAppointment(ctx context.Context, req AppointmentRequest) (Appointment, error) {
+	res := c.resources[0]
+	if req.ResourceID != "" {
+		r, ok := c.Resource(req.ResourceID)
+		if !ok {
+			return Appointment{}, fmt.Errorf("agenda desconocida: %q", req.ResourceID)
+		}
+		res = r
+	}
+
+	startTime, err := time.Parse(time.RFC3339, req.Start)
+	if err != nil {
+		return Appointment{}, fmt.Errorf("fecha inválida: %v", err)
+	}
+	duration := c.SlotDuration
+	if req.Duration > 0 {
+		duration = req.Duration
+	}
+	endTime := startTime.Add(duration)
+
+	// Entre que se listaron los turnos y el usuario eligió, alguien pudo haberlo tomado
+	checkStart := startTime.Add(-c.BufferBefore)
+	checkEnd := endTime.Add(c.BufferAfter)
+	busy, err := c.srv.Freebusy.Query(&gcal.FreeBusyRequest{
+		TimeMin: checkStart.Format(time.RFC3339),
+		TimeMax: checkEnd.Format(time.RFC3339),
+		Items:   []*gcal.FreeBusyRequestItem{{Id: res.CalendarID}},
+	}).Context(ctx).Do()
+	if err != nil {
+		return Appointment{}, err
+	}
+	if isBusyIn(busy.Calendars[res.CalendarID].Busy, checkStart, checkEnd) ||
+		c.closed.closed(startTime, endTime, res.ID, c.holidayDays(ctx, startTime, endTime)) {
+		return Appointment{}, ErrSlotTaken
+	}
+
+	summary := req.Title
+	if summary == "" {
+		summary = fmt.Sprintf("Turno Flowly: %s", req.ContactName)
+	}
+	desc := req.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Paciente agendado vía WhatsApp.\nTeléfono: %s", req.ContactPhone)
+		if res.Name != "" {
+			desc += "\nProfesional: " + res.Name
+		}
+	}
+
+	event := &gcal.Event{
+		Summary:     summary,
+		Description: desc,
+		ColorId:     req.ColorID,
+		Start: &gcal.EventDateTime{
+			DateTime: startTime.Format(time.RFC3339),
+		},
+		End: &gcal.EventDateTime{
+			DateTime: endTime.Format(time.RFC3339),
+		},
+		// Para la agenda del día (ver agenda.go), sin depender del título
+		ExtendedProperties: &gcal.EventExtendedProperties{
+			Private: map[string]string{
+				EventPropertyContactName: req.ContactName,
+				EventPropertyContactWaID: req.ContactPhone,
+			},
+		},
+	}
+
+	// Invitado: Google le manda la invitación por mail (con el link de Meet si hay)
+	sendUpdates := "none"
+	if c.InviteAttendee && strings.Contains(req.ContactEmail, "@") {
+		event.Attendees = []*gcal.EventAttendee{{Email: req.ContactEmail, DisplayName: req.ContactName}}
+		sendUpdates = "all"
+	}
+
+	insert := c.srv.Events.Insert(res.CalendarID, event).SendUpdates(sendUpdates)
+	if req.Meet || c.MeetLink {
+		event.ConferenceData = &gcal.ConferenceData{
+			CreateRequest: &gcal.CreateConferenceRequest{
+				// Mismo turno = mismo request: si se reintenta, Google no crea otra sala
+				RequestId:             fmt.Sprintf("flowly-%s-%d", req.ContactPhone, startTime.Unix()),
+				ConferenceSolutionKey: &gcal.ConferenceSolutionKey{Type: "hangoutsMeet"},
+			},
+		}
+		insert = insert.ConferenceDataVersion(1)
+	}
+
+	created, err := insert.Context(ctx).Do()
+	if err != nil {
+		return Appointment{}, err
+	}
+	c.Busy.Invalidate(c.Tenant, res.CalendarID)
+
+	// Google no tiene transacciones: si otra réplica reservó el mismo horario a la vez,
+	// gana el evento creado primero y el nuestro se borra.
+	lost, err := c.lostBookingRace(ctx, res.CalendarID, created, checkStart, checkEnd)
+	if err == nil && lost {
+		if err := c.srv.Events.Delete(res.CalendarID, created.Id).SendUpdates(sendUpdates).Context(ctx).Do(); err != nil {
+			return Appointment{}, fmt.Errorf("turno duplicado sin poder borrarlo (event_id=%s): %w", created.Id, err)
+		}
+		return Appointment{}, ErrSlotTaken
+	}
+	// Si no pudimos verificar la carrera, el turno quedó creado igual
+
+	if event.ConferenceData != nil {
+		created = c.waitForMeet(ctx, res.CalendarID, created)
+	}
+	return Appointment{
+		EventID:  created.Id,
+		MeetURL:  meetURL(created),
+		HTMLLink: created.HtmlLink,
+		Start:    startTime,
+		End:      endTime,
+	}, nil
+}
+
+// waitForMeet: la sala de Meet puede quedar "pending" unos segundos después de crear el
+// evento; se reconsulta un par de veces antes de confirmar sin link.
+func (c *Service) waitForMeet(ctx context.Context, calendarID string, ev *gcal.Event) *gcal.Event {
+	for i := 0; i < 3 && meetURL(ev) == ""; i++ {
+		if sleepCtx(ctx, time.Second) != nil {
+			break
+		}
+		got, err := c.srv.Events.Get(calendarID, ev.Id).Context(ctx).Do()
+		if err != nil {
+			break
+		}
+		ev = got
+	}
+	return ev
+}
+
+func meetURL(ev *gcal.Event) string {
+	if ev.HangoutLink != "" {
+		return ev.HangoutLink
+	}
+	if ev.ConferenceData != nil {
+		for _, ep := range ev.ConferenceData.EntryPoints {
+			if ep.EntryPointType == "video" {
+				return ep.Uri
+			}
+		}
+	}
+	return ""
+}
+
+// lostBookingRace indica si en la ventana hay otro evento (que ocupa) creado antes que el nuestro.
+// Con el mismo timestamp desempata el event ID, así las dos réplicas llegan a la misma conclusión.
+func (c *Service) lostBookingRace(ctx context.Context, calendarID string, ours *gcal.Event, start, end time.Time) (bool, error) {
+	events, err := c.srv.Events.List(calendarID).
+		TimeMin(start.Format(time.RFC3339)).
+		TimeMax(end.Format(time.RFC3339)).
+		SingleEvents(true).
+		Context(ctx).Do()
+	if err != nil {
+		return false, err
+	}
+	oursCreated, _ := time.Parse(time.RFC3339, ours.Created)
+	for _, e := range events.Items {
+		if e.Id == ours.Id || e.Status == "cancelled" || e.Transparency == "transparent" {
+			continue
+		}
+		created, _ := time.Parse(time.RFC3339, e.Created)
+		if created.Before(oursCreated) || (created.Equal(oursCreated) && e.Id < ours.Id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CancelAppointment borra el evento. El recordatorio solo trae el event_id, así que se
+// prueba en cada agenda hasta encontrarlo.
+func (c *Service) CancelAppointment(ctx context.Context, eventID string) error {
+	var err error
+	for _, r := range c.resources {
+		err = c.srv.Events.Delete(r.CalendarID, eventID).Context(ctx).Do()
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && (gerr.Code == http.StatusNotFound || gerr.Code == http.StatusGone) {
+			continue
+		}
+		if err == nil {
+			c.Busy.Invalidate(c.Tenant, r.CalendarID)
+		}
+		return err
+	}
+	return err
+}
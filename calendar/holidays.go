@@ -0,0 +1,194 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// ---------------------
+// Feriados y bloqueos de agenda
+// ---------------------
+// Días en los que el negocio no atiende aunque caigan en work_days, en calendar.json:
+//
+//	"holidays": ["2026-12-25", "2027-01-01"],
+//	"holiday_calendar_id": "es.ar#holiday@group.v.calendar.google.com",
+//	"blackouts": [
+//	  { "from": "2026-01-10", "to": "2026-01-24", "reason": "vacaciones" },
+//	  { "from": "2026-03-05T14:00", "to": "2026-03-05T18:00", "calendar": "PRO_PEREZ" }
+//	]
+//
+// - holidays: días completos (YYYY-MM-DD).
+// - holiday_calendar_id: calendario público de feriados de Google (uno por país, ej:
+// es.ar#holiday, en.usa#holiday, es.spain#holiday). Solo con provider google.
+// - blackouts: rangos; con fechas solas el "to" es inclusive (todo ese día), con hora es
+// hasta esa hora. "calendar" lo limita a una agenda (id de calendars); sin él, a todas.
+//
+// Las fechas son en la zona de la agenda. GetNextAvailableSlots no ofrece turnos que caigan
+// (aunque sea en parte) en un día cerrado o un bloqueo; con Cal.com / Calendly se filtran
+// los horarios que devuelven.
+
+const holidayCalendarCacheTTL = 12 * time.Hour
+
+type Blackout struct {
+	From     string `json:"from"` // "2006-01-02" o "2006-01-02T15:04"
+	To       string `json:"to"`
+	Calendar string `json:"calendar,omitempty"` // id de calendars ("" = todas)
+	Reason   string `json:"reason,omitempty"`
+}
+
+type closedRange struct {
+	start, end time.Time
+	resourceID string
+}
+
+// closedPeriods son los feriados y bloqueos fijos de calendar.json, ya parseados.
+type closedPeriods struct {
+	days   map[string]bool // "2006-01-02"
+	ranges []closedRange
+}
+
+// closedPeriods parsea holidays y blackouts (error si alguna fecha no se entiende).
+func (cfg Config) closedPeriods() (closedPeriods, error) {
+	loc := Location()
+	p := closedPeriods{days: make(map[string]bool)}
+	for _, d := range cfg.Holidays {
+		t, err := time.ParseInLocation("2006-01-02", d, loc)
+		if err != nil {
+			return closedPeriods{}, fmt.Errorf("holidays: fecha inválida %q (YYYY-MM-DD)", d)
+		}
+		p.days[t.Format("2006-01-02")] = true
+	}
+	for i, b := range cfg.Blackouts {
+		start, _, err := parseBlackoutTime(b.From, loc)
+		if err != nil {
+			return closedPeriods{}, fmt.Errorf("blackouts[%d].from: %w", i, err)
+		}
+		end, endDay, err := parseBlackoutTime(b.To, loc)
+		if err != nil {
+			return closedPeriods{}, fmt.Errorf("blackouts[%d].to: %w", i, err)
+		}
+		if endDay {
+			end = end.AddDate(0, 0, 1) // "to" con fecha sola incluye todo ese día
+		}
+		if !end.After(start) {
+			return closedPeriods{}, fmt.Errorf("blackouts[%d]: to tiene que ser posterior a from", i)
+		}
+		if b.Calendar != "" {
+			if _, ok := bookingResources(cfg.Resources()).Resource(b.Calendar); !ok {
+				return closedPeriods{}, fmt.Errorf("blackouts[%d]: agenda desconocida %q", i, b.Calendar)
+			}
+		}
+		p.ranges = append(p.ranges, closedRange{start: start, end: end, resourceID: b.Calendar})
+	}
+	return p, nil
+}
+
+// parseBlackoutTime acepta "2006-01-02" (day=true) o "2006-01-02T15:04".
+func parseBlackoutTime(s string, loc *time.Location) (t time.Time, day bool, err error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", s, loc); err == nil {
+		return t, false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("fecha inválida %q (YYYY-MM-DD o YYYY-MM-DDTHH:MM)", s)
+}
+
+// closedDay dice si el día de t es feriado (de holidays o de extra, el calendario de feriados).
+func (p closedPeriods) closedDay(t time.Time, extra map[string]bool) bool {
+	d := t.In(Location()).Format("2006-01-02")
+	return p.days[d] || extra[d]
+}
+
+// closed dice si [start, end) toca un día cerrado o un bloqueo de la agenda resourceID.
+func (p closedPeriods) closed(start, end time.Time, resourceID string, extra map[string]bool) bool {
+	// Los turnos duran menos de un día: alcanza con el día en que empieza y en el que termina
+	if p.closedDay(start, extra) || p.closedDay(end.Add(-time.Nanosecond), extra) {
+		return true
+	}
+	for _, r := range p.ranges {
+		if (r.resourceID == "" || r.resourceID == resourceID) && start.Before(r.end) && end.After(r.start) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter saca los horarios de Cal.com / Calendly que caen en un día cerrado o un bloqueo
+// (sin la duración del turno, se mira el horario de inicio).
+func (p closedPeriods) filter(all []providerSlot) []providerSlot {
+	if len(p.days) == 0 && len(p.ranges) == 0 {
+		return all
+	}
+	out := all[:0]
+	for _, s := range all {
+		if !p.closed(s.start, s.start.Add(time.Nanosecond), s.resource.ID, nil) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ---------------------
+// Calendario público de feriados (Google)
+// ---------------------
+
+type holidayCache struct {
+	mu        sync.Mutex
+	days      map[string]bool
+	until     time.Time
+	fetchedAt time.Time
+}
+
+// holidayDays devuelve los feriados del holiday_calendar_id hasta until (cacheados 12 h).
+// Si Google falla se sigue sin ellos: mejor ofrecer un feriado que no ofrecer nada.
+func (c *Service) holidayDays(ctx context.Context, from, until time.Time) map[string]bool {
+	if c.holidayCalendarID == "" {
+		return nil
+	}
+	h := &c.holidays
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.days != nil && !h.until.Before(until) && time.Since(h.fetchedAt) < holidayCalendarCacheTTL {
+		return h.days
+	}
+
+	queryUntil := until.Add(busyCacheMargin)
+	days := make(map[string]bool)
+	err := c.srv.Events.List(c.holidayCalendarID).
+		TimeMin(from.Format(time.RFC3339)).
+		TimeMax(queryUntil.Format(time.RFC3339)).
+		SingleEvents(true).
+		Pages(ctx, func(evs *gcal.Events) error {
+			for _, ev := range evs.Items {
+				if ev.Start == nil || ev.Start.Date == "" {
+					continue
+				}
+				start, err := time.Parse("2006-01-02", ev.Start.Date)
+				if err != nil {
+					continue
+				}
+				end := start.AddDate(0, 0, 1)
+				if ev.End != nil {
+					if e, err := time.Parse("2006-01-02", ev.End.Date); err == nil && e.After(start) {
+						end = e // exclusivo
+					}
+				}
+				for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+					days[d.Format("2006-01-02")] = true
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		log.Printf("⚠️ tenant=%s no pude leer los feriados de %s, sigo sin ellos: %v", c.Tenant, c.holidayCalendarID, err)
+		return h.days
+	}
+	h.days, h.until, h.fetchedAt = days, queryUntil, time.Now()
+	return days
+}
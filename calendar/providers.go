@@ -0,0 +1,453 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Booking providers
+// ---------------------
+// Por default la disponibilidad se calcula con el free/busy de Google Calendar. Si el
+// negocio ya usa Cal.com o Calendly, la agenda se delega a ese servicio (horarios, buffers
+// y reservas los define el negocio ahí) para no tener dos fuentes de verdad:
+//
+//	{
+//	  "provider": "calcom",
+//	  "calcom": { "api_key": "${CALCOM_API_KEY}" },
+//	  "calendars": [
+//	    { "id": "PRO_PEREZ", "name": "Dra. Pérez", "calendar_id": "123456" }
+//	  ]
+//	}
+//
+//	{
+//	  "provider": "calendly",
+//	  "calendly": { "token": "${CALENDLY_TOKEN}" },
+//	  "calendar_id": "https://api.calendly.com/event_types/AAAAAAAAAAAAAAAA"
+//	}
+//
+// calendar_id es el event type (id numérico en Cal.com, URI en Calendly). Ambos servicios
+// piden el email del invitado: si el turno no trae ContactEmail se usa uno derivado del teléfono.
+
+const (
+	defaultCalComBaseURL   = "https://api.cal.com/v2"
+	defaultCalendlyBaseURL = "https://api.calendly.com"
+	calendlyMaxRangeDays   = 7 // event_type_available_times acepta hasta 7 días por consulta
+)
+
+// defaultHTTPClient es el que se usa si New no recibe uno.
+var defaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+type CalComConfig struct {
+	APIKey  string `json:"api_key"`            // ${ENV_VAR} se expande
+	BaseURL string `json:"base_url,omitempty"` // default: https://api.cal.com/v2
+}
+
+type CalendlyConfig struct {
+	Token   string `json:"token"`              // personal access token; ${ENV_VAR} se expande
+	BaseURL string `json:"base_url,omitempty"` // default: https://api.calendly.com
+}
+
+// bookingResources comparte la resolución de agendas entre providers.
+type bookingResources []Resource
+
+func (rs bookingResources) Resource(id string) (Resource, bool) {
+	for _, r := range rs {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+func (rs bookingResources) Resources() []Resource {
+	return rs
+}
+
+// targets devuelve la agenda pedida o todas si resourceID es "".
+func (rs bookingResources) targets(resourceID string) ([]Resource, error) {
+	if resourceID == "" {
+		return rs, nil
+	}
+	r, ok := rs.Resource(resourceID)
+	if !ok {
+		return nil, fmt.Errorf("agenda desconocida: %q", resourceID)
+	}
+	return []Resource{r}, nil
+}
+
+// resolve devuelve la agenda pedida o la primera si resourceID es "".
+func (rs bookingResources) resolve(resourceID string) (Resource, error) {
+	targets, err := rs.targets(resourceID)
+	if err != nil {
+		return Resource{}, err
+	}
+	return targets[0], nil
+}
+
+type providerSlot struct {
+	start    time.Time
+	resource Resource
+}
+
+// pageSlots ordena los horarios de todas las agendas, deja uno por horario (la primera
+// agenda libre, como en Google) y corta la página pedida.
+func pageSlots(all []providerSlot, multi bool, offset, limit int) ([]Slot, bool) {
+	sort.SliceStable(all, func(i, j int) bool { return all[i].start.Before(all[j].start) })
+	var slots []Slot
+	skipped := 0
+	for i, ps := range all {
+		if i > 0 && ps.start.Equal(all[i-1].start) {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if len(slots) >= limit {
+			return slots, true
+		}
+		local := ps.start.In(Location())
+		slots = append(slots, Slot{
+			ID:           fmt.Sprintf("SLOT_%d", len(slots)+1),
+			ISOValue:     local.Format(time.RFC3339),
+			ResourceID:   ps.resource.ID,
+			ResourceName: ps.resource.Name,
+			ShowResource: multi,
+		})
+	}
+	return slots, false
+}
+
+func inviteeEmail(req AppointmentRequest) string {
+	if strings.Contains(req.ContactEmail, "@") {
+		return req.ContactEmail
+	}
+	return strings.TrimPrefix(req.ContactPhone, "+") + "@whatsapp.invalid"
+}
+
+// providerDo hace el request JSON y decodifica la respuesta en out (si no es nil).
+// 409 = el horario se ocupó.
+func providerDo(ctx context.Context, client *http.Client, method, u string, headers map[string]string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode == http.StatusConflict {
+		return ErrSlotTaken
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s: %s", method, u, resp.Status, strings.TrimSpace(string(raw)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("respuesta inválida de %s: %w", u, err)
+		}
+	}
+	return nil
+}
+
+// ---------------------
+// Cal.com (API v2)
+// ---------------------
+
+type calComProvider struct {
+	bookingResources
+	client  *http.Client
+	apiKey  string
+	baseURL string
+	closed  closedPeriods
+}
+
+func newCalComProvider(cfg Config, client *http.Client) (*calComProvider, error) {
+	if cfg.CalCom == nil || os.ExpandEnv(cfg.CalCom.APIKey) == "" {
+		return nil, fmt.Errorf("provider calcom sin calcom.api_key")
+	}
+	base := strings.TrimSuffix(cfg.CalCom.BaseURL, "/")
+	if base == "" {
+		base = defaultCalComBaseURL
+	}
+	closed, err := cfg.closedPeriods()
+	if err != nil {
+		return nil, err
+	}
+	return &calComProvider{
+		bookingResources: cfg.Resources(),
+		client:           client,
+		apiKey:           os.ExpandEnv(cfg.CalCom.APIKey),
+		baseURL:          base,
+		closed:           closed,
+	}, nil
+}
+
+// Cal.com versiona cada endpoint por header.
+func (p *calComProvider) headers(apiVersion string) map[string]string {
+	return map[string]string{
+		"Authorization":   "Bearer " + p.apiKey,
+		"cal-api-version": apiVersion,
+	}
+}
+
+func (p *calComProvider) GetNextAvailableSlots(ctx context.Context, resourceID string, _ time.Duration, offset, limit int) ([]Slot, bool, error) {
+	targets, err := p.targets(resourceID)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	var all []providerSlot
+	for _, r := range targets {
+		q := url.Values{}
+		q.Set("eventTypeId", r.CalendarID)
+		q.Set("start", now.UTC().Format(time.RFC3339))
+		q.Set("end", now.AddDate(0, 0, SearchDays).UTC().Format(time.RFC3339))
+		q.Set("timeZone", Location().String())
+
+		var res struct {
+			Data map[string][]struct {
+				Start string `json:"start"`
+			} `json:"data"`
+		}
+		if err := providerDo(ctx, p.client, http.MethodGet, p.baseURL+"/slots?"+q.Encode(), p.headers("2024-09-04"), nil, &res); err != nil {
+			return nil, false, err
+		}
+		for _, day := range res.Data {
+			for _, s := range day {
+				if t, err := time.Parse(time.RFC3339, s.Start); err == nil && t.After(now) {
+					all = append(all, providerSlot{start: t, resource: r})
+				}
+			}
+		}
+	}
+	slots, more := pageSlots(p.closed.filter(all), len(targets) > 1, offset, limit)
+	return slots, more, nil
+}
+
+func (p *calComProvider) CreateAppointment(ctx context.Context, req AppointmentRequest) (Appointment, error) {
+	r, err := p.resolve(req.ResourceID)
+	if err != nil {
+		return Appointment{}, err
+	}
+	eventTypeID, err := jsonNumber(r.CalendarID)
+	if err != nil {
+		return Appointment{}, fmt.Errorf("calendar_id de Cal.com inválido %q: %w", r.CalendarID, err)
+	}
+	start, err := time.Parse(time.RFC3339, req.Start)
+	if err != nil {
+		return Appointment{}, fmt.Errorf("fecha inválida: %v", err)
+	}
+
+	body := map[string]any{
+		"start":       start.UTC().Format(time.RFC3339),
+		"eventTypeId": eventTypeID,
+		"attendee": map[string]any{
+			"name":        req.ContactName,
+			"email":       inviteeEmail(req),
+			"timeZone":    Location().String(),
+			"phoneNumber": "+" + strings.TrimPrefix(req.ContactPhone, "+"),
+		},
+		"metadata": map[string]string{"source": "flowly"},
+	}
+	var res struct {
+		Data struct {
+			UID        string `json:"uid"`
+			Start      string `json:"start"`
+			End        string `json:"end"`
+			MeetingURL string `json:"meetingUrl"`
+			Location   string `json:"location"`
+		} `json:"data"`
+	}
+	if err := providerDo(ctx, p.client, http.MethodPost, p.baseURL+"/bookings", p.headers("2024-08-13"), body, &res); err != nil {
+		return Appointment{}, err
+	}
+
+	appt := Appointment{EventID: res.Data.UID, MeetURL: res.Data.MeetingURL, Start: start}
+	if appt.MeetURL == "" && strings.HasPrefix(res.Data.Location, "http") {
+		appt.MeetURL = res.Data.Location
+	}
+	if end, err := time.Parse(time.RFC3339, res.Data.End); err == nil {
+		appt.End = end
+	} else {
+		appt.End = start.Add(time.Hour)
+	}
+	return appt, nil
+}
+
+func (p *calComProvider) CancelAppointment(ctx context.Context, eventID string) error {
+	body := map[string]string{"cancellationReason": "Cancelado por el paciente vía WhatsApp"}
+	return providerDo(ctx, p.client, http.MethodPost, p.baseURL+"/bookings/"+url.PathEscape(eventID)+"/cancel", p.headers("2024-08-13"), body, nil)
+}
+
+func jsonNumber(s string) (json.Number, error) {
+	n := json.Number(strings.TrimSpace(s))
+	if _, err := n.Int64(); err != nil {
+		return "", err
+	}
+	return n, nil
+}
+
+// ---------------------
+// Calendly (Scheduling API)
+// ---------------------
+
+type calendlyProvider struct {
+	bookingResources
+	client  *http.Client
+	token   string
+	baseURL string
+	closed  closedPeriods
+}
+
+func newCalendlyProvider(cfg Config, client *http.Client) (*calendlyProvider, error) {
+	if cfg.Calendly == nil || os.ExpandEnv(cfg.Calendly.Token) == "" {
+		return nil, fmt.Errorf("provider calendly sin calendly.token")
+	}
+	base := strings.TrimSuffix(cfg.Calendly.BaseURL, "/")
+	if base == "" {
+		base = defaultCalendlyBaseURL
+	}
+	closed, err := cfg.closedPeriods()
+	if err != nil {
+		return nil, err
+	}
+	return &calendlyProvider{
+		bookingResources: cfg.Resources(),
+		client:           client,
+		token:            os.ExpandEnv(cfg.Calendly.Token),
+		baseURL:          base,
+		closed:           closed,
+	}, nil
+}
+
+func (p *calendlyProvider) headers() map[string]string {
+	return map[string]string{"Authorization": "Bearer " + p.token}
+}
+
+func (p *calendlyProvider) GetNextAvailableSlots(ctx context.Context, resourceID string, _ time.Duration, offset, limit int) ([]Slot, bool, error) {
+	targets, err := p.targets(resourceID)
+	if err != nil {
+		return nil, false, err
+	}
+	// Calendly no acepta start_time en el pasado: un minuto de margen
+	now := time.Now().Add(time.Minute)
+	var all []providerSlot
+	for _, r := range targets {
+		for from := now; from.Before(now.AddDate(0, 0, SearchDays)); from = from.AddDate(0, 0, calendlyMaxRangeDays) {
+			q := url.Values{}
+			q.Set("event_type", r.CalendarID)
+			q.Set("start_time", from.UTC().Format(time.RFC3339))
+			q.Set("end_time", from.AddDate(0, 0, calendlyMaxRangeDays).UTC().Format(time.RFC3339))
+
+			var res struct {
+				Collection []struct {
+					Status    string `json:"status"`
+					StartTime string `json:"start_time"`
+				} `json:"collection"`
+			}
+			if err := providerDo(ctx, p.client, http.MethodGet, p.baseURL+"/event_type_available_times?"+q.Encode(), p.headers(), nil, &res); err != nil {
+				return nil, false, err
+			}
+			for _, s := range res.Collection {
+				if s.Status != "available" {
+					continue
+				}
+				if t, err := time.Parse(time.RFC3339, s.StartTime); err == nil {
+					all = append(all, providerSlot{start: t, resource: r})
+				}
+			}
+		}
+	}
+	slots, more := pageSlots(p.closed.filter(all), len(targets) > 1, offset, limit)
+	return slots, more, nil
+}
+
+func (p *calendlyProvider) CreateAppointment(ctx context.Context, req AppointmentRequest) (Appointment, error) {
+	r, err := p.resolve(req.ResourceID)
+	if err != nil {
+		return Appointment{}, err
+	}
+	start, err := time.Parse(time.RFC3339, req.Start)
+	if err != nil {
+		return Appointment{}, fmt.Errorf("fecha inválida: %v", err)
+	}
+
+	body := map[string]any{
+		"event_type": r.CalendarID,
+		"start_time": start.UTC().Format(time.RFC3339),
+		"invitee": map[string]any{
+			"name":                 req.ContactName,
+			"email":                inviteeEmail(req),
+			"timezone":             Location().String(),
+			"text_reminder_number": "+" + strings.TrimPrefix(req.ContactPhone, "+"),
+		},
+	}
+	var res struct {
+		Resource struct {
+			Event string `json:"event"` // URI del scheduled_event
+		} `json:"resource"`
+	}
+	if err := providerDo(ctx, p.client, http.MethodPost, p.baseURL+"/invitees", p.headers(), body, &res); err != nil {
+		return Appointment{}, err
+	}
+
+	appt := Appointment{EventID: res.Resource.Event, Start: start, End: start.Add(time.Hour)}
+	// El evento trae la duración real y el link de la videollamada (si el event type tiene una)
+	var ev struct {
+		Resource struct {
+			EndTime  string `json:"end_time"`
+			Location struct {
+				JoinURL string `json:"join_url"`
+			} `json:"location"`
+		} `json:"resource"`
+	}
+	if strings.HasPrefix(appt.EventID, p.baseURL) {
+		if err := providerDo(ctx, p.client, http.MethodGet, appt.EventID, p.headers(), nil, &ev); err == nil {
+			if end, err := time.Parse(time.RFC3339, ev.Resource.EndTime); err == nil {
+				appt.End = end
+			}
+			appt.MeetURL = ev.Resource.Location.JoinURL
+		}
+	}
+	return appt, nil
+}
+
+// CancelAppointment recibe la URI del scheduled_event (lo que devuelve CreateAppointment).
+func (p *calendlyProvider) CancelAppointment(ctx context.Context, eventID string) error {
+	u := eventID
+	if !strings.HasPrefix(u, "http") {
+		u = p.baseURL + "/scheduled_events/" + url.PathEscape(eventID)
+	}
+	body := map[string]string{"reason": "Cancelado por el paciente vía WhatsApp"}
+	return providerDo(ctx, p.client, http.MethodPost, u+"/cancellation", p.headers(), body, nil)
+}
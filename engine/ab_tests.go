@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Experimentos A/B de flow
+// ---------------------
+// Un tenant puede probar dos variantes del flow (ej: otro texto del menú). La A es la
+// versión publicada y la B otra versión de versions/ (ver flow_versions.go):
+//
+//	PUT /admin/tenants/{tenant}/flow/experiment
+//	{ "name": "menu-corto", "version": "v7-menu-corto", "percent_b": 30 }
+//
+// Cada usuario cae siempre en la misma variante (hash de name + wa_id), así que el que
+// vuelve ve el mismo menú. La variante se asigna al arrancar la sesión (igual que
+// _flow_version) y queda en _ab_experiment / _ab_variant; cada transición se guarda con
+// su variante. Los resultados (embudo por variante desde started_at) salen de
+//
+//	GET    /admin/tenants/{tenant}/flow/experiment?idle_hours=24
+//	DELETE /admin/tenants/{tenant}/flow/experiment   (las sesiones nuevas vuelven a la publicada)
+//
+// El experimento vive en versions/published.json junto a la versión publicada.
+
+const (
+	abExperimentVar = "_ab_experiment"
+	abVariantVar    = "_ab_variant"
+	abVariantA      = "A"
+	abVariantB      = "B"
+	defaultPercentB = 50
+)
+
+var errNoExperiment = errors.New("el tenant no tiene un experimento activo")
+
+type FlowExperiment struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`   // versión de la variante B
+	PercentB  int       `json:"percent_b"` // % de usuarios en B (1-99)
+	StartedAt time.Time `json:"started_at"`
+}
+
+// variantFor asigna la variante de waID (estable mientras no cambie el nombre del experimento).
+func (e *FlowExperiment) variantFor(waID string) string {
+	h := fnv.New32a()
+	h.Write([]byte(e.Name + ":" + waID))
+	if int(h.Sum32()%100) < e.PercentB {
+		return abVariantB
+	}
+	return abVariantA
+}
+
+// startFlowVersion devuelve la versión con la que arranca una sesión de waID: la publicada
+// o, si hay un experimento, la de su variante. Deja la variante en sess.Data.
+func (a *App) startFlowVersion(tenant, waID string, sess *UserSession) string {
+	published := a.cache.Published(tenant)
+	exp := a.cache.Experiment(tenant)
+	if exp != nil {
+		if _, err := a.cache.LoadVersion(tenant, exp.Version); err != nil {
+			log.Printf("⚠️ tenant=%s la versión %s del experimento %s no carga, uso la publicada: %v", tenant, exp.Version, exp.Name, err)
+			exp = nil
+		}
+	}
+	if exp == nil {
+		delete(sess.Data, abExperimentVar)
+		delete(sess.Data, abVariantVar)
+		return published
+	}
+
+	variant := exp.variantFor(waID)
+	if sess.Data[abExperimentVar] != exp.Name || sess.Data[abVariantVar] != variant {
+		metrics.Inc("flowly_ab_assignments_total", tenant, exp.Name, variant)
+	}
+	sess.Data[abExperimentVar] = exp.Name
+	sess.Data[abVariantVar] = variant
+	if variant == abVariantB {
+		return exp.Version
+	}
+	return published
+}
+
+// startExperiment valida la variante B (carga + lint) y guarda el experimento. Si ya hay uno
+// con el mismo nombre se actualiza sin reiniciar started_at.
+func (a *App) startExperiment(tenant string, exp FlowExperiment) (FlowExperiment, error) {
+	if !flowVersionNameRe.MatchString(exp.Name) {
+		return FlowExperiment{}, fmt.Errorf("nombre de experimento inválido: %q", exp.Name)
+	}
+	if exp.PercentB == 0 {
+		exp.PercentB = defaultPercentB
+	}
+	if exp.PercentB < 1 || exp.PercentB > 99 {
+		return FlowExperiment{}, fmt.Errorf("percent_b tiene que estar entre 1 y 99")
+	}
+	if !validFlowVersionName(exp.Version) {
+		return FlowExperiment{}, fmt.Errorf("nombre de versión inválido: %q", exp.Version)
+	}
+
+	p, err := readPublishedPointer(tenant)
+	if err != nil {
+		return FlowExperiment{}, err
+	}
+	if exp.Version == p.Version {
+		return FlowExperiment{}, fmt.Errorf("la versión %s ya es la publicada (variante A)", exp.Version)
+	}
+	cfg, err := loadFlowVersion(tenant, exp.Version)
+	if err != nil {
+		return FlowExperiment{}, err
+	}
+	if res := lintFlowConfig(tenant, cfg); len(res.Errors) > 0 {
+		return FlowExperiment{}, fmt.Errorf("la versión %s no pasa el lint:\n- %s", exp.Version, strings.Join(res.Errors, "\n- "))
+	}
+
+	exp.StartedAt = time.Now()
+	if p.Experiment != nil && p.Experiment.Name == exp.Name {
+		exp.StartedAt = p.Experiment.StartedAt
+	}
+	p.Experiment = &exp
+	if err := writePublishedPointer(tenant, p); err != nil {
+		return FlowExperiment{}, err
+	}
+	a.cache.SetExperiment(tenant, &exp)
+	a.notifyReplicas(clusterConfig, tenant)
+	log.Printf("🧪 tenant=%s experimento %s: %d%% a %s", tenant, exp.Name, exp.PercentB, exp.Version)
+	return exp, nil
+}
+
+func (a *App) stopExperiment(tenant string) (FlowExperiment, error) {
+	p, err := readPublishedPointer(tenant)
+	if err != nil {
+		return FlowExperiment{}, err
+	}
+	if p.Experiment == nil {
+		return FlowExperiment{}, errNoExperiment
+	}
+	exp := *p.Experiment
+	p.Experiment = nil
+	if err := writePublishedPointer(tenant, p); err != nil {
+		return FlowExperiment{}, err
+	}
+	a.cache.SetExperiment(tenant, nil)
+	a.notifyReplicas(clusterConfig, tenant)
+	log.Printf("🧪 tenant=%s experimento %s terminado", tenant, exp.Name)
+	return exp, nil
+}
+
+// ---------------------
+// Resultados
+// ---------------------
+
+type ExperimentVariant struct {
+	Version string     `json:"version"`
+	Funnel  FlowFunnel `json:"funnel"`
+}
+
+type ExperimentResults struct {
+	Experiment FlowExperiment               `json:"experiment"`
+	Variants   map[string]ExperimentVariant `json:"variants"`
+	// CompletionLift: completion_rate de B menos el de A
+	CompletionLift float64 `json:"completion_lift"`
+	Truncated      bool    `json:"truncated,omitempty"`
+}
+
+func (a *App) experimentResults(tenant string, exp FlowExperiment, idle time.Duration) (ExperimentResults, error) {
+	events, err := a.analytics.Transitions(tenant, exp.StartedAt, maxAnalyticsEvents)
+	if err != nil {
+		return ExperimentResults{}, err
+	}
+	byVariant := make(map[string][]TransitionEvent)
+	for _, ev := range events {
+		if ev.Experiment == exp.Name && ev.Variant != "" {
+			byVariant[ev.Variant] = append(byVariant[ev.Variant], ev)
+		}
+	}
+
+	res := ExperimentResults{
+		Experiment: exp,
+		Variants:   make(map[string]ExperimentVariant),
+		Truncated:  len(events) == maxAnalyticsEvents,
+	}
+	now := time.Now()
+	for variant, version := range map[string]string{abVariantA: a.cache.Published(tenant), abVariantB: exp.Version} {
+		cfg, err := a.cache.LoadVersion(tenant, version)
+		if err != nil {
+			return ExperimentResults{}, fmt.Errorf("variante %s: %w", variant, err)
+		}
+		f := computeFunnel(cfg, byVariant[variant], now, idle)
+		f.Tenant = tenant
+		f.Since = exp.StartedAt
+		res.Variants[variant] = ExperimentVariant{Version: version, Funnel: f}
+	}
+	res.CompletionLift = res.Variants[abVariantB].Funnel.CompletionRate - res.Variants[abVariantA].Funnel.CompletionRate
+	return res, nil
+}
+
+// ---------------------
+// Admin endpoints
+// ---------------------
+
+func (a *App) handleAdminGetExperiment(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	p, err := readPublishedPointer(tenant)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if p.Experiment == nil {
+		writeJSONError(w, http.StatusNotFound, errNoExperiment.Error())
+		return
+	}
+	idle := defaultDropOffIdle
+	if n, err := strconv.Atoi(r.URL.Query().Get("idle_hours")); err == nil && n > 0 {
+		idle = time.Duration(n) * time.Hour
+	}
+	res, err := a.experimentResults(tenant, *p.Experiment, idle)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (a *App) handleAdminStartExperiment(w http.ResponseWriter, r *http.Request) {
+	b, err := readLimited(r, 64<<10)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var exp FlowExperiment
+	if err := decodeStrict(b, &exp); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	exp, err = a.startExperiment(r.PathValue("tenant"), exp)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	auditNote(r, "experiment", exp.Name)
+	auditNote(r, "version_b", exp.Version)
+	auditNote(r, "percent_b", strconv.Itoa(exp.PercentB))
+	writeJSON(w, http.StatusOK, exp)
+}
+
+func (a *App) handleAdminStopExperiment(w http.ResponseWriter, r *http.Request) {
+	exp, err := a.stopExperiment(r.PathValue("tenant"))
+	if errors.Is(err, errNoExperiment) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, exp)
+}
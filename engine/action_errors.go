@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Action errors
+// ---------------------
+// Una acción que falla deja la sesión en el estado al que se iba (con las variables de
+// antes). Con on_action_error el flow puede llevar a otro estado según el tipo de error,
+// ej: si el turno se ocupó mientras el usuario elegía, mostrar horarios nuevos.
+//
+//	"CONFIRM_APPOINTMENT": {
+//	  "action": "schedule_appointment",
+//	  ...
+//	  "on_action_error": { "slot_taken": "SLOT_TAKEN", "error": "APPOINTMENT_ERROR" }
+//	}
+//
+// "error" atrapa cualquier falla sin un código propio. El código queda en {{action_error}}.
+
+const (
+	actionErrorVar     = "action_error"
+	actionErrorDefault = "error"
+	maxActionErrorHops = 3
+)
+
+// actionErrorCodes: código de on_action_error -> error tipado que lo dispara.
+var actionErrorCodes = map[string]error{
+	"slot_taken": calendar.ErrSlotTaken,
+	"no_agent":   ErrNoAgentAvailable,
+}
+
+func actionErrorCode(err error) string {
+	for code, target := range actionErrorCodes {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+	return actionErrorDefault
+}
+
+// actionErrorNext devuelve el estado para el código (o el genérico "error"); "" = quedarse.
+func (st FlowState) actionErrorNext(code string) string {
+	if to, ok := st.OnActionError[code]; ok {
+		return to
+	}
+	return st.OnActionError[actionErrorDefault]
+}
+
+func validateActionErrors(cfg FlowConfig, stateName string, st FlowState) []string {
+	if len(st.OnActionError) == 0 {
+		return nil
+	}
+	var errs []string
+	if st.Action == "" {
+		errs = append(errs, fmt.Sprintf("state=%s tiene on_action_error pero no tiene action", stateName))
+	}
+	for _, code := range sortedKeys(st.OnActionError) {
+		if _, ok := actionErrorCodes[code]; !ok && code != actionErrorDefault {
+			errs = append(errs, fmt.Sprintf("state=%s on_action_error: código desconocido %q", stateName, code))
+		}
+		if _, ok := cfg.States[st.OnActionError[code]]; !ok && st.OnActionError[code] != previousState {
+			errs = append(errs, fmt.Sprintf("state=%s on_action_error[%q] apunta a un estado inexistente: %q", stateName, code, st.OnActionError[code]))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,543 @@
+package engine
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Admin API
+// ---------------------
+// Endpoints internos protegidos con ADMIN_TOKEN o un token por operador de ADMIN_TOKENS
+// (header "Authorization: Bearer <token>"). Si no hay ninguno, la API admin queda
+// deshabilitada. Lo que no es GET queda en el audit log (ver audit.go).
+
+func (a *App) registerAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/deliveries", a.requireAdmin(a.handleAdminListDeliveries))
+	mux.HandleFunc("GET /admin/deliveries/{id}", a.requireAdmin(a.handleAdminGetDelivery))
+	mux.HandleFunc("POST /admin/deliveries/{id}/retry", a.requireAdmin(a.handleAdminRetryDelivery))
+	mux.HandleFunc("GET /admin/outbound/dead", a.requireAdmin(a.handleAdminListDeadOutbound))
+	mux.HandleFunc("POST /admin/outbound/{id}/retry", a.requireAdmin(a.handleAdminRetryOutbound))
+	mux.HandleFunc("GET /admin/audit", a.requireAdmin(a.handleAdminListAudit))
+
+	mux.HandleFunc("GET /admin/tenants/{tenant}/sessions", a.requireAdmin(a.handleAdminListSessions))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/sessions/{wa_id}", a.requireAdmin(a.handleAdminGetSession))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/sessions/{wa_id}/reset", a.requireAdmin(a.handleAdminResetSession))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/sessions/{wa_id}/state", a.requireAdmin(a.handleAdminMoveSession))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/sessions/{wa_id}/snapshot", a.requireAdmin(a.handleAdminExportSession))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/sessions/{wa_id}/snapshot", a.requireAdmin(a.handleAdminImportSession))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/sessions/{wa_id}/messages", a.requireAdmin(a.handleAdminSessionMessages))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/conversations/{wa_id}/transcript", a.requireAdmin(a.handleAdminTranscript))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/conversations/export.csv", a.requireAdmin(a.handleAdminExportConversations))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/send", a.requireAdmin(a.handleAdminSend))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/analytics/funnel", a.requireAdmin(a.handleAdminFunnel))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/analytics/surveys", a.requireAdmin(a.handleAdminSurveys))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/opt-outs", a.requireAdmin(a.handleAdminListOptOuts))
+	mux.HandleFunc("DELETE /admin/tenants/{tenant}/opt-outs/{wa_id}", a.requireAdmin(a.handleAdminRemoveOptOut))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/contacts", a.requireAdmin(a.handleAdminListContacts))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/contacts/{wa_id}", a.requireAdmin(a.handleAdminGetContact))
+	mux.HandleFunc("PUT /admin/tenants/{tenant}/contacts/{wa_id}", a.requireAdmin(a.handleAdminSaveContact))
+	mux.HandleFunc("DELETE /admin/tenants/{tenant}/contacts/{wa_id}", a.requireAdmin(a.handleAdminDeleteContact))
+
+	mux.HandleFunc("GET /admin/tenants/{tenant}/flow/versions", a.requireAdmin(a.handleAdminListFlowVersions))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/flow/versions/{version}", a.requireAdmin(a.handleAdminGetFlowVersion))
+	mux.HandleFunc("PUT /admin/tenants/{tenant}/flow/versions/{version}", a.requireAdmin(a.handleAdminSaveFlowVersion))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/flow/versions/{version}/publish", a.requireAdmin(a.handleAdminPublishFlowVersion))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/preview", a.requireAdmin(a.handleAdminPreview))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/flow/rollback", a.requireAdmin(a.handleAdminRollbackFlow))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/flow/graph", a.requireAdmin(a.handleAdminFlowGraph))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/flow/experiment", a.requireAdmin(a.handleAdminGetExperiment))
+	mux.HandleFunc("PUT /admin/tenants/{tenant}/flow/experiment", a.requireAdmin(a.handleAdminStartExperiment))
+	mux.HandleFunc("DELETE /admin/tenants/{tenant}/flow/experiment", a.requireAdmin(a.handleAdminStopExperiment))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/templates", a.requireAdmin(a.handleAdminListTemplates))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/templates/sync", a.requireAdmin(a.handleAdminSyncTemplates))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/media", a.requireAdmin(a.handleAdminListMedia))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/media/{name}/upload", a.requireAdmin(a.handleAdminUploadMedia))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/calendar/reload", a.requireAdmin(a.handleAdminReloadCalendar))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/appointments", a.requireAdmin(a.handleAdminListAppointments))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/appointments/stats", a.requireAdmin(a.handleAdminAppointmentStats))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/appointments/{event_id}/outcome", a.requireAdmin(a.handleAdminSetAppointmentOutcome))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/agents/assignments", a.requireAdmin(a.handleAdminListAssignments))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/agents/stats", a.requireAdmin(a.handleAdminAgentStats))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/webhooks", a.requireAdmin(a.handleAdminListWebhooks))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/webhooks/{id}", a.requireAdmin(a.handleAdminGetWebhook))
+	mux.HandleFunc("POST /admin/tenants/{tenant}/webhooks/{id}/replay", a.requireAdmin(a.handleAdminReplayWebhook))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/google/connect", a.requireAdmin(a.handleAdminGoogleConnect))
+	mux.HandleFunc("DELETE /admin/tenants/{tenant}/google", a.requireAdmin(a.handleAdminGoogleDisconnect))
+
+	mux.HandleFunc("POST /admin/campaigns", a.requireAdmin(a.handleAdminCreateCampaign))
+	mux.HandleFunc("GET /admin/campaigns", a.requireAdmin(a.handleAdminListCampaigns))
+	mux.HandleFunc("GET /admin/campaigns/{id}", a.requireAdmin(a.handleAdminGetCampaign))
+	mux.HandleFunc("GET /admin/campaigns/{id}/recipients", a.requireAdmin(a.handleAdminCampaignRecipients))
+	mux.HandleFunc("POST /admin/campaigns/{id}/cancel", a.requireAdmin(a.handleAdminCancelCampaign))
+}
+
+func (a *App) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+		if token == "" && strings.TrimSpace(os.Getenv("ADMIN_TOKENS")) == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		actor, ok := adminActor(r, token)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		a.withAudit(actor, next)(w, r)
+	}
+}
+
+func validAdminToken(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// readLimited lee el body con un tope de tamaño.
+func readLimited(r *http.Request, max int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, fmt.Errorf("body demasiado grande (máx %d bytes)", max)
+	}
+	return b, nil
+}
+
+// queryLimit lee ?limit= con un default y un máximo.
+func queryLimit(r *http.Request, def, max int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || n <= 0 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// ---------------------
+// Deliveries
+// ---------------------
+
+func (a *App) handleAdminListDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	list := a.deliveries.List(q.Get("to"), q.Get("status"), queryLimit(r, 100, 1000))
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": list})
+}
+
+func (a *App) handleAdminGetDelivery(w http.ResponseWriter, r *http.Request) {
+	rec, ok := a.deliveries.Get(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "mensaje no encontrado")
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+func (a *App) handleAdminRetryDelivery(w http.ResponseWriter, r *http.Request) {
+	rec, ok := a.deliveries.Get(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "mensaje no encontrado")
+		return
+	}
+	newID, err := a.retryDelivery(r.Context(), rec.PhoneNumberID, rec)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message_id": newID, "retry_of": rec.MessageID})
+}
+
+// ---------------------
+// Sessions
+// ---------------------
+
+// handleAdminReloadCalendar descarta el cliente de Calendar cacheado del tenant.
+func (a *App) handleAdminReloadCalendar(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	a.calendars.Invalidate(tenant)
+	a.notifyReplicas(clusterCalendar, tenant)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "tenant": tenant})
+}
+
+func (a *App) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+
+	// ?active_hours= ventana de "sesión activa" (default 24h)
+	hours := 24
+	if n, err := strconv.Atoi(r.URL.Query().Get("active_hours")); err == nil && n > 0 {
+		hours = n
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	list, err := a.sessions.List(tenant, r.URL.Query().Get("state"), since, queryLimit(r, 100, 1000))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": list})
+}
+
+func (a *App) handleAdminGetSession(w http.ResponseWriter, r *http.Request) {
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+	sess, ok := a.sessions.Get(tenant + ":" + waID)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "sesión no encontrada")
+		return
+	}
+	writeJSON(w, http.StatusOK, SessionSummary{Tenant: tenant, WaID: waID, State: sess.State, Data: sess.Data, UpdatedAt: sess.UpdatedAt})
+}
+
+// handleAdminResetSession vuelve la sesión a MENU y borra sus variables.
+func (a *App) handleAdminResetSession(w http.ResponseWriter, r *http.Request) {
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+	defer a.userLocks.Lock(r.Context(), tenant, waID)()
+	sess := UserSession{State: a.entryState(tenant), UpdatedAt: time.Now(), Data: make(map[string]string)}
+	a.sessions.Set(tenant+":"+waID, sess)
+	log.Printf("🛠️ admin: sesión reseteada tenant=%s wa_id=%s", tenant, waID)
+	writeJSON(w, http.StatusOK, SessionSummary{Tenant: tenant, WaID: waID, State: sess.State, Data: sess.Data, UpdatedAt: sess.UpdatedAt})
+}
+
+// handleAdminMoveSession mueve la sesión a otro estado.
+//
+//	{ "state": "CLIENT_DASHBOARD", "data": { "crm_status": "ok" }, "send": true }
+//
+// data se mergea con las variables actuales; send=true además le manda el estado al usuario.
+func (a *App) handleAdminMoveSession(w http.ResponseWriter, r *http.Request) {
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+
+	var req struct {
+		State string            `json:"state"`
+		Data  map[string]string `json:"data"`
+		Send  bool              `json:"send"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	defer a.userLocks.Lock(r.Context(), tenant, waID)()
+	key := tenant + ":" + waID
+	sess, _ := a.sessions.Get(key)
+	a.pinFlowVersion(tenant, waID, &sess)
+
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if _, ok := cfg.States[req.State]; !ok {
+		writeJSONError(w, http.StatusBadRequest, "estado inexistente: "+req.State)
+		return
+	}
+	for k, v := range req.Data {
+		sess.Data[k] = v
+	}
+	sess.State = req.State
+	sess.UpdatedAt = time.Now()
+	a.sessions.Set(key, sess)
+	log.Printf("🛠️ admin: sesión movida tenant=%s wa_id=%s state=%s", tenant, waID, req.State)
+
+	if req.Send {
+		phoneID, ok := a.resolver.PhoneNumberID(tenant)
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "no hay phone_number_id configurado para el tenant")
+			return
+		}
+		waClient, err := a.whatsAppClient(phoneID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		vars := map[string]string{"wa_id": waID, "name": "ahí"}
+		for k, v := range sess.Data {
+			vars[k] = v
+		}
+		if err := a.renderer.RenderAndSend(r.Context(), tenant, req.State, waClient, waID, vars); err != nil {
+			writeJSONError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, SessionSummary{Tenant: tenant, WaID: waID, State: sess.State, Data: sess.Data, UpdatedAt: sess.UpdatedAt})
+}
+
+// handleAdminPreview manda un estado renderizado a cualquier número, sin tocar sesiones,
+// para ver en un teléfono real cómo queda una lista o un template. Si el número tiene una
+// conversación abierta no se le pisan los payloads de filas ni el menú de texto que tiene
+// guardados (el preview no pasa por userLocks).
+//
+//	{ "state": "PICK_SLOT", "to": "+54 9 11 5849-2828", "vars": { "name": "Ana" }, "version": "v3" }
+//
+// version es opcional (default: la publicada).
+func (a *App) handleAdminPreview(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+
+	var req struct {
+		State   string            `json:"state"`
+		To      string            `json:"to"`
+		Vars    map[string]string `json:"vars"`
+		Version string            `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	if req.State == "" || req.To == "" {
+		writeJSONError(w, http.StatusBadRequest, "state y to son obligatorios")
+		return
+	}
+
+	version := req.Version
+	if version == "" {
+		version = a.cache.Published(tenant)
+	}
+	cfg, err := a.cache.LoadVersion(tenant, version)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if _, ok := cfg.States[req.State]; !ok {
+		writeJSONError(w, http.StatusBadRequest, "estado inexistente: "+req.State)
+		return
+	}
+	to, err := cfg.Phone.Normalize(req.To)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	phoneID, ok := a.resolver.PhoneNumberID(tenant)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "no hay phone_number_id configurado para el tenant")
+		return
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	vars := map[string]string{"wa_id": to, "name": "ahí"}
+	for k, v := range req.Vars {
+		vars[k] = v
+	}
+	vars[flowVersionVar] = version
+	if err := a.renderer.withoutSessions().RenderAndSend(r.Context(), tenant, req.State, waClient, to, vars); err != nil {
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	log.Printf("🛠️ admin: preview tenant=%s state=%s version=%s to=%s", tenant, req.State, version, to)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent", "tenant": tenant, "state": req.State, "version": version, "to": to})
+}
+
+func (a *App) handleAdminSessionMessages(w http.ResponseWriter, r *http.Request) {
+	if a.store == nil {
+		writeJSONError(w, http.StatusNotImplemented, "el historial de mensajes requiere DATABASE_URL")
+		return
+	}
+	msgs, err := a.store.RecentMessages(r.PathValue("tenant"), r.PathValue("wa_id"), queryLimit(r, 50, 500))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"messages": msgs})
+}
+
+// ---------------------
+// Campaigns
+// ---------------------
+
+// handleAdminCreateCampaign crea una campaña:
+//
+//	{
+//	  "tenant": "broker",
+//	  "name": "promo marzo",
+//	  "template_name": "promo_departamentos",
+//	  "template_language": "es_AR",
+//	  "body_params": ["{{name}}", "{{barrio}}"],
+//	  "recipients": [{ "wa_id": "5491155555555", "vars": { "name": "Ana", "barrio": "Palermo" } }],
+//	  "recipients_csv": "wa_id,name,barrio\n5491166666666,Juan,Belgrano",
+//	  "send_window": { "start": "2026-03-01T09:00:00-03:00", "end": "2026-03-03T20:00:00-03:00", "daily_from": "09:00", "daily_to": "20:00" }
+//	}
+func (a *App) handleAdminCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tenant           string              `json:"tenant"`
+		Name             string              `json:"name"`
+		TemplateName     string              `json:"template_name"`
+		TemplateLanguage string              `json:"template_language"`
+		BodyParams       []string            `json:"body_params"`
+		Recipients       []CampaignRecipient `json:"recipients"`
+		RecipientsCSV    string              `json:"recipients_csv"`
+		SendWindow       struct {
+			Start     *time.Time `json:"start"`
+			End       *time.Time `json:"end"`
+			DailyFrom string     `json:"daily_from"`
+			DailyTo   string     `json:"daily_to"`
+		} `json:"send_window"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	if req.Tenant == "" || req.TemplateName == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant y template_name son obligatorios")
+		return
+	}
+	if _, ok := a.resolver.PhoneNumberID(req.Tenant); !ok {
+		writeJSONError(w, http.StatusBadRequest, "no hay phone_number_id configurado para el tenant")
+		return
+	}
+
+	recipients := req.Recipients
+	if strings.TrimSpace(req.RecipientsCSV) != "" {
+		fromCSV, err := parseRecipientsCSV(req.RecipientsCSV)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		recipients = append(recipients, fromCSV...)
+	}
+	recipients = normalizeCampaignRecipients(recipients)
+	if len(recipients) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "la campaña no tiene destinatarios")
+		return
+	}
+
+	c := Campaign{
+		Tenant:           req.Tenant,
+		Name:             req.Name,
+		TemplateName:     req.TemplateName,
+		TemplateLanguage: req.TemplateLanguage,
+		BodyParams:       req.BodyParams,
+		WindowStart:      time.Now(),
+		WindowEnd:        req.SendWindow.End,
+		DailyFrom:        req.SendWindow.DailyFrom,
+		DailyTo:          req.SendWindow.DailyTo,
+	}
+	if c.TemplateLanguage == "" {
+		c.TemplateLanguage = "es_AR"
+	}
+	if req.SendWindow.Start != nil {
+		c.WindowStart = *req.SendWindow.Start
+	}
+	if c.WindowEnd != nil && !c.WindowEnd.After(c.WindowStart) {
+		writeJSONError(w, http.StatusBadRequest, "send_window.end debe ser posterior a start")
+		return
+	}
+	if (c.DailyFrom == "") != (c.DailyTo == "") {
+		writeJSONError(w, http.StatusBadRequest, "daily_from y daily_to van juntos")
+		return
+	}
+	for _, h := range []string{c.DailyFrom, c.DailyTo} {
+		if h == "" {
+			continue
+		}
+		if _, err := parseClock(h); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	id, err := a.campaigns.CreateCampaign(c, recipients)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.ID = id
+	if err := a.enqueueCampaignBatch(c, c.WindowStart); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("📣 Campaña %d creada tenant=%s template=%s destinatarios=%d", id, c.Tenant, c.TemplateName, len(recipients))
+
+	created, _, _ := a.campaigns.GetCampaign(id)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (a *App) handleAdminListCampaigns(w http.ResponseWriter, r *http.Request) {
+	list, err := a.campaigns.ListCampaigns(r.URL.Query().Get("tenant"), queryLimit(r, 50, 500))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"campaigns": list})
+}
+
+// campaignFromPath carga la campaña de {id}; si no existe responde el error y devuelve ok=false.
+func (a *App) campaignFromPath(w http.ResponseWriter, r *http.Request) (Campaign, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id inválido")
+		return Campaign{}, false
+	}
+	c, ok, err := a.campaigns.GetCampaign(id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return Campaign{}, false
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "campaña no encontrada")
+		return Campaign{}, false
+	}
+	return c, true
+}
+
+func (a *App) handleAdminGetCampaign(w http.ResponseWriter, r *http.Request) {
+	if c, ok := a.campaignFromPath(w, r); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+func (a *App) handleAdminCampaignRecipients(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.campaignFromPath(w, r)
+	if !ok {
+		return
+	}
+	list, err := a.campaigns.ListRecipients(c.ID, r.URL.Query().Get("status"), queryLimit(r, 100, 5000))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"recipients": list})
+}
+
+func (a *App) handleAdminCancelCampaign(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.campaignFromPath(w, r)
+	if !ok {
+		return
+	}
+	if c.Status == "done" || c.Status == "canceled" {
+		writeJSONError(w, http.StatusConflict, "la campaña ya está "+c.Status)
+		return
+	}
+	if err := a.campaigns.SetCampaignStatus(c.ID, "canceled"); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, err := a.jobs.Cancel(campaignJobKind, c.Tenant, strconv.FormatInt(c.ID, 10)); err != nil {
+		log.Printf("ERROR cancelando jobs de la campaña %d: %v", c.ID, err)
+	}
+	skipped, _ := a.campaigns.SkipPending(c.ID, "campaña cancelada")
+	log.Printf("📣 Campaña %d cancelada (%d sin enviar)", c.ID, skipped)
+
+	c, _, _ = a.campaigns.GetCampaign(c.ID)
+	writeJSON(w, http.StatusOK, c)
+}
@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminPreviewLeavesSessionAlone(t *testing.T) {
+	app, fake := newWebhookTestApp(t)
+	const user = "5491155550010"
+
+	// Sesión a mitad de conversación, con el menú de texto de una lista que no llegó
+	postWebhook(t, app, user, "wamid.in.1", textMsg("buenas"))
+	fake.FailNext(http.StatusBadRequest, 131009, "Parameter value is not valid")
+	postWebhook(t, app, user, "wamid.in.2", buttonReplyMsg("NO_SOY_CLIENTE"))
+	before := sessionState(t, app, user)
+	if before.Data[textMenuVar] == "" {
+		t.Fatal("la sesión tenía que quedar con el menú de texto")
+	}
+
+	sent := len(botMessages(fake, user))
+	body := `{"state": "CLIENT_MENU", "to": "` + user + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/tenants/broker/preview", strings.NewReader(body))
+	req.SetPathValue("tenant", "broker")
+	rec := httptest.NewRecorder()
+	app.handleAdminPreview(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preview: status %d %s", rec.Code, rec.Body)
+	}
+	if out := botMessages(fake, user)[sent:]; len(out) != 1 || out[0].Type != "interactive" {
+		t.Fatalf("se esperaba la lista del preview, el bot mandó %v", out)
+	}
+
+	after := sessionState(t, app, user)
+	if after.State != before.State || !after.UpdatedAt.Equal(before.UpdatedAt) || !maps.Equal(after.Data, before.Data) {
+		t.Fatalf("el preview cambió la sesión:\nantes %s %v\ndespués %s %v", before.State, before.Data, after.State, after.Data)
+	}
+}
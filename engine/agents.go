@@ -0,0 +1,643 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Asignación de leads a asesores
+// ---------------------
+// Para tenants tipo broker: la acción "assign_agent" le pasa el lead a uno de los asesores
+// del tenant, le avisa por WhatsApp con los datos que dejó el usuario y guarda la asignación
+// para los reportes.
+//
+//	"agents": {
+//	  "strategy": "round_robin",
+//	  "list": [
+//	    { "id": "ana", "name": "Ana", "phone": "5491122334455" },
+//	    { "id": "luis", "name": "Luis", "phone": "5491166778899",
+//	      "hours": { "work_days": [1, 2, 3, 4, 5], "from": "09:00", "to": "13:00" } }
+//	  ],
+//	  "fields": ["form_nombre", "form_email", "last_selected_id"],
+//	  "text": "🔔 Nuevo lead para vos, {{agent.name}}\n\n{{lead}}\n\nEscribile: https://wa.me/{{wa_id}}",
+//	  "handoff": true
+//	}
+//
+//	"LEAD_DONE": { "type": "text", "action": "assign_agent",
+//	  "body": "Listo 🙌 {{agent_name}} te va a escribir en breve.",
+//	  "on_action_error": { "no_agent": "LEAD_NO_AGENT" } }
+//
+// Solo se eligen asesores disponibles (sin "disabled" y dentro de sus "hours", si tienen;
+// mismo formato que business_hours). Entre ellos:
+//   - round_robin (default): el que sigue al último asignado, en el orden de list.
+//   - least_assigned: el que tiene menos leads asignados hoy (empate: el primero de list).
+//
+// Un usuario que ya tuvo asesor vuelve al mismo mientras esté disponible. Sin ninguno
+// disponible la acción falla con el código "no_agent" (ver action_errors.go).
+//
+// El lead queda en {{lead}} (una línea "campo: valor" por cada variable de fields que tenga
+// valor; sin fields, los campos de los forms del flow), el asesor en {{agent.id}},
+// {{agent.name}} y {{agent.phone}}, y también están las variables de la sesión. Al asesor
+// normalmente no le escribió nadie en las últimas 24h: con template_name se manda ese
+// template con {{1}}=nombre del lead, {{2}}=teléfono y {{3}}=datos separados por " / ".
+// Si el aviso falla el lead queda asignado igual (notified=false en el reporte).
+//
+// Después de la acción quedan {{agent_id}}, {{agent_name}} y {{agent_phone}}; con
+// "handoff": true la conversación además pasa al asesor (el bot deja de responder, como el
+// comando handoff).
+//
+// Admin:
+//
+//	GET /admin/tenants/{tenant}/agents/assignments?days=30&agent=ana&limit=100
+//	GET /admin/tenants/{tenant}/agents/stats?days=30
+
+const (
+	agentStrategyRoundRobin    = "round_robin"
+	agentStrategyLeastAssigned = "least_assigned"
+	agentStrategySticky        = "sticky" // en el registro: volvió al asesor que ya tenía
+
+	agentVarPrefix       = "agent."
+	defaultAgentText     = "🔔 Nuevo lead para vos, {{agent.name}}\n\n{{lead}}\n\nEscribile: https://wa.me/{{wa_id}}"
+	defaultAgentDays     = 30
+	defaultAgentListSize = 100
+	maxAgentStats        = 10000
+)
+
+var ErrNoAgentAvailable = errors.New("no hay asesores disponibles")
+
+type FlowAgents struct {
+	Strategy         string      `json:"strategy,omitempty"` // round_robin (default) | least_assigned
+	List             []FlowAgent `json:"list"`
+	Fields           []string    `json:"fields,omitempty"` // variables del lead (default: campos de los forms)
+	Text             string      `json:"text,omitempty"`
+	TemplateName     string      `json:"template_name,omitempty"`
+	TemplateLanguage string      `json:"template_language,omitempty"` // default es_AR
+	Handoff          bool        `json:"handoff,omitempty"`
+}
+
+type FlowAgent struct {
+	ID       string             `json:"id"`
+	Name     string             `json:"name,omitempty"`
+	Phone    string             `json:"phone"`
+	Hours    *FlowBusinessHours `json:"hours,omitempty"` // sin hours: siempre disponible
+	Disabled bool               `json:"disabled,omitempty"`
+}
+
+func (ag FlowAgent) displayName() string {
+	if ag.Name != "" {
+		return ag.Name
+	}
+	return ag.ID
+}
+
+func (ag FlowAgent) available(tenant string, now time.Time) bool {
+	return !ag.Disabled && (ag.Hours == nil || ag.Hours.Open(tenant, now))
+}
+
+type LeadAssignment struct {
+	ID        int64             `json:"id"`
+	Tenant    string            `json:"tenant"`
+	WaID      string            `json:"wa_id"`
+	Name      string            `json:"name,omitempty"`
+	AgentID   string            `json:"agent_id"`
+	Strategy  string            `json:"strategy"`
+	Data      map[string]string `json:"data,omitempty"`
+	Notified  bool              `json:"notified"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type LeadStore interface {
+	RecordAssignment(la LeadAssignment) error
+	// LastAssignment devuelve la última asignación del tenant (waID "") o de un usuario.
+	LastAssignment(tenant, waID string) (LeadAssignment, bool, error)
+	// ListAssignments devuelve las asignaciones desde since, más recientes primero (agentID "" = todas).
+	ListAssignments(tenant, agentID string, since time.Time, limit int) ([]LeadAssignment, error)
+	// AssignmentCounts cuenta las asignaciones por asesor desde since.
+	AssignmentCounts(tenant string, since time.Time) (map[string]int, error)
+	// DeleteAssignments borra las asignaciones de un usuario (ver retention.go).
+	DeleteAssignments(tenant, waID string) (int, error)
+}
+
+func NewLeadStore(store *PostgresStore) LeadStore {
+	if store != nil {
+		return store
+	}
+	return &memoryLeadStore{}
+}
+
+func validateAgents(cfg FlowConfig) []string {
+	var errs []string
+	ag := cfg.Agents
+	if ag == nil {
+		for _, name := range sortedKeys(cfg.States) {
+			if cfg.States[name].Action == "assign_agent" {
+				errs = append(errs, fmt.Sprintf("state=%s usa assign_agent pero el flow no tiene agents", name))
+			}
+		}
+		return errs
+	}
+	if ag.Strategy != "" && ag.Strategy != agentStrategyRoundRobin && ag.Strategy != agentStrategyLeastAssigned {
+		errs = append(errs, fmt.Sprintf("agents.strategy desconocida: %q (round_robin o least_assigned)", ag.Strategy))
+	}
+	if len(ag.List) == 0 {
+		errs = append(errs, "agents.list está vacía")
+	}
+	seen := make(map[string]bool)
+	for i, a := range ag.List {
+		field := fmt.Sprintf("agents.list[%d]", i)
+		if a.ID == "" {
+			errs = append(errs, field+": falta id")
+		} else if seen[a.ID] {
+			errs = append(errs, fmt.Sprintf("%s: id repetido %q", field, a.ID))
+		}
+		seen[a.ID] = true
+		if _, err := cfg.Phone.Normalize(a.Phone); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.phone: %v", field, err))
+		}
+		if a.Hours != nil {
+			if a.Hours.OutOfHoursState != "" {
+				errs = append(errs, field+".hours no lleva out_of_hours_state")
+			}
+			errs = append(errs, a.Hours.validate(field+".hours")...)
+		}
+	}
+	for _, f := range ag.Fields {
+		if strings.TrimSpace(f) == "" || strings.ContainsAny(f, "{} ") {
+			errs = append(errs, fmt.Sprintf("agents.fields: nombre de variable inválido %q", f))
+		}
+	}
+	return errs
+}
+
+// leadFields son las variables que se le pasan al asesor: fields o, sin fields, los campos
+// de los forms del flow.
+func (ag *FlowAgents) leadFields(cfg FlowConfig) []string {
+	if len(ag.Fields) > 0 {
+		return ag.Fields
+	}
+	var out []string
+	seen := make(map[string]bool)
+	for _, name := range sortedKeys(cfg.States) {
+		if f := cfg.States[name].Form; f != nil {
+			for _, fld := range f.Fields {
+				if !seen[fld.Name] {
+					seen[fld.Name] = true
+					out = append(out, fld.Name)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// leadLabel: "form_nombre_completo" -> "nombre completo".
+func leadLabel(field string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(field, "form_"), "_", " ")
+}
+
+// pickAgent elige el asesor para el lead. prev es la última asignación del usuario (si tuvo)
+// y last la última del tenant.
+func (ag *FlowAgents) pickAgent(tenant string, now time.Time, prev, last *LeadAssignment, counts map[string]int) (FlowAgent, string, bool) {
+	var avail []FlowAgent
+	for _, a := range ag.List {
+		if a.available(tenant, now) {
+			avail = append(avail, a)
+		}
+	}
+	if len(avail) == 0 {
+		return FlowAgent{}, "", false
+	}
+	if prev != nil {
+		for _, a := range avail {
+			if a.ID == prev.AgentID {
+				return a, agentStrategySticky, true
+			}
+		}
+	}
+	if ag.Strategy == agentStrategyLeastAssigned {
+		best := avail[0]
+		for _, a := range avail[1:] {
+			if counts[a.ID] < counts[best.ID] {
+				best = a
+			}
+		}
+		return best, agentStrategyLeastAssigned, true
+	}
+	// round_robin: el primero disponible después del último asignado, en el orden de list
+	start := 0
+	if last != nil {
+		for i, a := range ag.List {
+			if a.ID == last.AgentID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	for i := 0; i < len(ag.List); i++ {
+		a := ag.List[(start+i)%len(ag.List)]
+		if a.available(tenant, now) {
+			return a, agentStrategyRoundRobin, true
+		}
+	}
+	return avail[0], agentStrategyRoundRobin, true
+}
+
+// agentPickMu: dos leads a la vez no eligen mirando la misma "última asignación" (en una
+// réplica; con varias, dos leads simultáneos pueden caerle al mismo asesor).
+var agentPickMu sync.Mutex
+
+func actionAssignAgent(ctx context.Context, a *App, tenant, userID string, sess *UserSession) (map[string]string, error) {
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return nil, err
+	}
+	ag := cfg.Agents
+	if ag == nil || len(ag.List) == 0 {
+		return nil, fmt.Errorf("el flow de %s no tiene agents", tenant)
+	}
+	now := time.Now()
+
+	// Datos del lead
+	data := make(map[string]string)
+	var lines []string
+	for _, f := range ag.leadFields(cfg) {
+		if v := strings.TrimSpace(sess.Data[f]); v != "" {
+			data[f] = v
+			lines = append(lines, leadLabel(f)+": "+v)
+		}
+	}
+	name := userID
+	if p, ok, err := a.contacts.GetContact(tenant, userID); err != nil {
+		log.Printf("ERROR leyendo perfil de contacto wa_id=%s: %v", userID, err)
+	} else if ok && p.Name != "" {
+		name = p.Name
+	}
+
+	agentPickMu.Lock()
+	var prev, last *LeadAssignment
+	if la, ok, err := a.leads.LastAssignment(tenant, userID); err != nil {
+		agentPickMu.Unlock()
+		return nil, err
+	} else if ok {
+		prev = &la
+	}
+	if la, ok, err := a.leads.LastAssignment(tenant, ""); err != nil {
+		agentPickMu.Unlock()
+		return nil, err
+	} else if ok {
+		last = &la
+	}
+	var counts map[string]int
+	if ag.Strategy == agentStrategyLeastAssigned {
+		local := now.In(calendar.Location())
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		if counts, err = a.leads.AssignmentCounts(tenant, today); err != nil {
+			agentPickMu.Unlock()
+			return nil, err
+		}
+	}
+	agent, strategy, ok := ag.pickAgent(tenant, now, prev, last, counts)
+	if !ok {
+		agentPickMu.Unlock()
+		return nil, ErrNoAgentAvailable
+	}
+	la := LeadAssignment{
+		Tenant: tenant, WaID: userID, Name: name, AgentID: agent.ID,
+		Strategy: strategy, Data: data, CreatedAt: now,
+	}
+	phone, _ := cfg.Phone.Normalize(agent.Phone) // validado al cargar el flow
+	la.Notified = a.notifyAgent(ctx, tenant, sess, ag, agent, phone, la, lines) == nil
+	err = a.leads.RecordAssignment(la)
+	agentPickMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	metrics.Inc("flowly_lead_assignments_total", tenant, agent.ID)
+	log.Printf("🧑‍💼 tenant=%s lead wa_id=%s asignado a %s (%s)", tenant, userID, agent.ID, strategy)
+
+	vars := map[string]string{
+		"agent_id":    agent.ID,
+		"agent_name":  agent.displayName(),
+		"agent_phone": phone,
+	}
+	if ag.Handoff {
+		vars[handoffVar] = now.Format(time.RFC3339)
+		a.notifyHandoffRequest(tenant, userID, sess.State, "Lead asignado a "+agent.displayName())
+	}
+	return vars, nil
+}
+
+// notifyAgent le manda el lead al asesor, desde el número de la sesión.
+func (a *App) notifyAgent(ctx context.Context, tenant string, sess *UserSession, ag *FlowAgents, agent FlowAgent, to string, la LeadAssignment, lines []string) error {
+	phoneID, ok := a.sessionPhoneNumberID(tenant, sess)
+	if !ok {
+		err := fmt.Errorf("no hay phone_number_id configurado para el tenant %s", tenant)
+		log.Printf("ERROR avisando al asesor %s: %v", agent.ID, err)
+		return err
+	}
+	client, err := a.tenantWhatsAppClient(phoneID, tenant)
+	if err != nil {
+		log.Printf("ERROR avisando al asesor %s: %v", agent.ID, err)
+		return err
+	}
+
+	if ag.TemplateName != "" {
+		lang := ag.TemplateLanguage
+		if lang == "" {
+			lang = "es_AR"
+		}
+		data := strings.Join(lines, digestTemplateSeparator)
+		if data == "" {
+			data = "-"
+		}
+		_, err = client.SendTemplate(ctx, to, ag.TemplateName, lang, []string{la.Name, "+" + la.WaID, data}, nil)
+	} else {
+		vars := make(map[string]string, len(sess.Data)+6)
+		for k, v := range sess.Data {
+			vars[k] = v
+		}
+		vars["name"], vars["wa_id"], vars["lead"] = la.Name, la.WaID, strings.Join(lines, "\n")
+		vars[agentVarPrefix+"id"], vars[agentVarPrefix+"name"], vars[agentVarPrefix+"phone"] = agent.ID, agent.displayName(), to
+		text := ag.Text
+		if text == "" {
+			text = defaultAgentText
+		}
+		err = client.SendText(ctx, to, truncateRunes(renderVars(text, vars), 4096))
+	}
+	if err != nil {
+		log.Printf("ERROR avisando al asesor %s del lead %s: %v", agent.ID, la.WaID, err)
+	}
+	return err
+}
+
+// ---------------------
+// Admin
+// ---------------------
+
+// agentSince lee ?days= (default 30).
+func agentSince(r *http.Request, now time.Time) time.Time {
+	days := defaultAgentDays
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 && n <= 365 {
+		days = n
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+func (a *App) handleAdminListAssignments(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	since := agentSince(r, time.Now())
+	out, err := a.leads.ListAssignments(tenant, r.URL.Query().Get("agent"), since, queryLimit(r, defaultAgentListSize, 1000))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if out == nil {
+		out = []LeadAssignment{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tenant": tenant, "since": since, "assignments": out})
+}
+
+type AgentStats struct {
+	AgentID  string `json:"agent_id"`
+	Name     string `json:"name,omitempty"`
+	Leads    int    `json:"leads"`
+	Notified int    `json:"notified"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+func (a *App) handleAdminAgentStats(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	since := agentSince(r, time.Now())
+	recs, err := a.leads.ListAssignments(tenant, "", since, maxAgentStats)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	byAgent := make(map[string]*AgentStats)
+	var order []string
+	if cfg, err := a.cache.Load(tenant); err == nil && cfg.Agents != nil {
+		for _, ag := range cfg.Agents.List {
+			byAgent[ag.ID] = &AgentStats{AgentID: ag.ID, Name: ag.Name, Disabled: ag.Disabled}
+			order = append(order, ag.ID)
+		}
+	}
+	for _, la := range recs {
+		s, ok := byAgent[la.AgentID]
+		if !ok {
+			// Un asesor que ya no está en la lista
+			s = &AgentStats{AgentID: la.AgentID}
+			byAgent[la.AgentID] = s
+			order = append(order, la.AgentID)
+		}
+		s.Leads++
+		if la.Notified {
+			s.Notified++
+		}
+	}
+	agents := make([]AgentStats, 0, len(order))
+	for _, id := range order {
+		agents = append(agents, *byAgent[id])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tenant":    tenant,
+		"since":     since,
+		"total":     len(recs),
+		"agents":    agents,
+		"truncated": len(recs) == maxAgentStats,
+	})
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryLeadStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	records []LeadAssignment // en orden de creación
+}
+
+func (s *memoryLeadStore) RecordAssignment(la LeadAssignment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	la.ID = s.nextID
+	if la.CreatedAt.IsZero() {
+		la.CreatedAt = time.Now()
+	}
+	s.records = append(s.records, la)
+	return nil
+}
+
+func (s *memoryLeadStore) LastAssignment(tenant, waID string) (LeadAssignment, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.records) - 1; i >= 0; i-- {
+		la := s.records[i]
+		if la.Tenant == tenant && (waID == "" || la.WaID == waID) {
+			return la, true, nil
+		}
+	}
+	return LeadAssignment{}, false, nil
+}
+
+func (s *memoryLeadStore) ListAssignments(tenant, agentID string, since time.Time, limit int) ([]LeadAssignment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []LeadAssignment
+	for i := len(s.records) - 1; i >= 0 && len(out) < limit; i-- {
+		la := s.records[i]
+		if la.Tenant == tenant && (agentID == "" || la.AgentID == agentID) && !la.CreatedAt.Before(since) {
+			out = append(out, la)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryLeadStore) AssignmentCounts(tenant string, since time.Time) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int)
+	for _, la := range s.records {
+		if la.Tenant == tenant && !la.CreatedAt.Before(since) {
+			counts[la.AgentID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *memoryLeadStore) DeleteAssignments(tenant, waID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.records[:0]
+	for _, la := range s.records {
+		if la.Tenant != tenant || la.WaID != waID {
+			kept = append(kept, la)
+		}
+	}
+	n := len(s.records) - len(kept)
+	s.records = kept
+	return n, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) RecordAssignment(la LeadAssignment) error {
+	data := la.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+	dataJSON, _ := json.Marshal(data)
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO lead_assignments (tenant, wa_id, name, agent_id, strategy, data, notified, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		la.Tenant, la.WaID, la.Name, la.AgentID, la.Strategy, dataJSON, la.Notified, la.CreatedAt,
+	)
+	return err
+}
+
+const leadAssignmentColumns = `id, tenant, wa_id, name, agent_id, strategy, data, notified, created_at`
+
+func scanLeadAssignment(scan func(dest ...any) error) (LeadAssignment, error) {
+	var la LeadAssignment
+	var data []byte
+	if err := scan(&la.ID, &la.Tenant, &la.WaID, &la.Name, &la.AgentID, &la.Strategy, &data, &la.Notified, &la.CreatedAt); err != nil {
+		return LeadAssignment{}, err
+	}
+	_ = json.Unmarshal(data, &la.Data)
+	return la, nil
+}
+
+func (s *PostgresStore) LastAssignment(tenant, waID string) (LeadAssignment, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	la, err := scanLeadAssignment(s.db.QueryRowContext(ctx, `
+		SELECT `+leadAssignmentColumns+`
+		FROM lead_assignments
+		WHERE tenant = $1 AND ($2 = '' OR wa_id = $2)
+		ORDER BY id DESC
+		LIMIT 1`,
+		tenant, waID,
+	).Scan)
+	if err == sql.ErrNoRows {
+		return LeadAssignment{}, false, nil
+	}
+	if err != nil {
+		return LeadAssignment{}, false, err
+	}
+	return la, true, nil
+}
+
+func (s *PostgresStore) ListAssignments(tenant, agentID string, since time.Time, limit int) ([]LeadAssignment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+leadAssignmentColumns+`
+		FROM lead_assignments
+		WHERE tenant = $1 AND ($2 = '' OR agent_id = $2) AND created_at >= $3
+		ORDER BY id DESC
+		LIMIT $4`,
+		tenant, agentID, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LeadAssignment
+	for rows.Next() {
+		la, err := scanLeadAssignment(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, la)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) AssignmentCounts(tenant string, since time.Time) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT agent_id, COUNT(*)
+		FROM lead_assignments
+		WHERE tenant = $1 AND created_at >= $2
+		GROUP BY agent_id`,
+		tenant, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *PostgresStore) DeleteAssignments(tenant, waID string) (int, error) {
+	return s.execCount(`DELETE FROM lead_assignments WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// AI fallback state
+// ---------------------
+// Cuando un texto no matchea ninguna transición (antes caía siempre a MENU), si el tenant
+// tiene un estado "ai_fallback" se le manda el mensaje + el prompt del tenant a un endpoint
+// compatible con OpenAI (/chat/completions) y se responde con la completion.
+// Mientras el usuario siga escribiendo texto libre la charla sigue en ese estado; "menu"
+// (u on_text_next) lo saca.
+//
+// Ejemplo:
+//
+//	"AI_FALLBACK": {
+//	  "type": "ai_fallback",
+//	  "body": "{{ai_reply}}\n\n_Escribí *menu* para ver las opciones._",
+//	  "ai": {
+//	    "prompt": "Sos el asistente de la inmobiliaria. Respondé corto y en español. El cliente se llama {{name}}.",
+//	    "max_tokens": 300,
+//	    "max_input_chars": 800,
+//	    "daily_token_budget": 200000,
+//	    "on_error_next": "MENU"
+//	  }
+//	}
+//
+// ENV:
+//
+//	AI_API_KEY=sk-...                          (sin key, el fallback queda deshabilitado)
+//	AI_API_BASE_URL=https://api.openai.com/v1
+//	AI_MODEL=gpt-4o-mini
+//	AI_FALLBACK_DISABLED_TENANTS=broker        (kill switch sin tocar el flow; "*" = todos)
+
+const (
+	defaultAIBaseURL       = "https://api.openai.com/v1"
+	defaultAIModel         = "gpt-4o-mini"
+	defaultAIMaxTokens     = 300
+	defaultAIMaxInputChars = 1000
+	defaultAITimeout       = 20 * time.Second
+)
+
+var errAIBudgetExceeded = errors.New("presupuesto diario de tokens agotado")
+
+type FlowAIConfig struct {
+	// Enabled: kill switch en el flow (default true)
+	Enabled *bool  `json:"enabled,omitempty"`
+	Prompt  string `json:"prompt"` // system prompt, soporta {{vars}}
+	Model   string `json:"model,omitempty"`
+
+	MaxTokens        int      `json:"max_tokens,omitempty"`         // tokens de la respuesta
+	MaxInputChars    int      `json:"max_input_chars,omitempty"`    // se trunca el mensaje del usuario
+	DailyTokenBudget int      `json:"daily_token_budget,omitempty"` // tokens totales por día y tenant (0 = sin límite)
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TimeoutSeconds   int      `json:"timeout_seconds,omitempty"`
+
+	// OnErrorNext: si el endpoint falla o se acabó el presupuesto (default: fallback_state)
+	OnErrorNext string `json:"on_error_next,omitempty"`
+}
+
+func validateAIFallback(stateName string, ai *FlowAIConfig) []string {
+	var errs []string
+	if ai == nil {
+		return []string{fmt.Sprintf("state=%s es ai_fallback pero ai es nil", stateName)}
+	}
+	if strings.TrimSpace(ai.Prompt) == "" {
+		errs = append(errs, fmt.Sprintf("state=%s ai.prompt vacío", stateName))
+	}
+	if ai.MaxTokens < 0 || ai.MaxInputChars < 0 || ai.DailyTokenBudget < 0 {
+		errs = append(errs, fmt.Sprintf("state=%s ai: los límites no pueden ser negativos", stateName))
+	}
+	errs = append(errs, validateRequestTimeout(fmt.Sprintf("state=%s ai.timeout_seconds", stateName), ai.TimeoutSeconds)...)
+	return errs
+}
+
+// aiFallbackState devuelve el (único) estado ai_fallback del flow.
+func aiFallbackState(cfg FlowConfig) (string, FlowState, bool) {
+	names := make([]string, 0, len(cfg.States))
+	for name, st := range cfg.States {
+		if st.Type == "ai_fallback" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", FlowState{}, false
+	}
+	sort.Strings(names)
+	return names[0], cfg.States[names[0]], true
+}
+
+func aiDisabledForTenant(tenant string) bool {
+	for _, t := range strings.Split(os.Getenv("AI_FALLBACK_DISABLED_TENANTS"), ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || (t != "" && t == tenant) {
+			return true
+		}
+	}
+	return false
+}
+
+// runAIFallback intenta responder un texto que no matcheó con el estado ai_fallback del tenant.
+// Devuelve ok=false si no aplica (sin estado, deshabilitado, sin cliente) y el caller sigue
+// como antes (fallback_state). La respuesta queda en vars["ai_reply"].
+func (a *App) runAIFallback(ctx context.Context, tenant string, cfg FlowConfig, msg IncomingMessage, vars map[string]string) (string, bool) {
+	if msg.Type != "text" || msg.Text == nil || strings.TrimSpace(msg.Text.Body) == "" {
+		return "", false
+	}
+	name, st, found := aiFallbackState(cfg)
+	if !found || st.AI == nil {
+		return "", false
+	}
+	if (st.AI.Enabled != nil && !*st.AI.Enabled) || aiDisabledForTenant(tenant) || a.llm == nil {
+		return "", false
+	}
+
+	reply, err := a.llm.Complete(ctx, tenant, st.AI, renderVars(st.AI.Prompt, vars), msg.Text.Body)
+	if err != nil {
+		log.Printf("❌ ai_fallback tenant=%s: %v", tenant, err)
+		next := st.AI.OnErrorNext
+		if next == "" {
+			next = cfg.Fallback()
+		}
+		return next, true
+	}
+	vars["ai_reply"] = reply
+	return name, true
+}
+
+// ---------------------
+// LLM client (OpenAI-compatible)
+// ---------------------
+
+type LLMClient struct {
+	baseURL string
+	apiKey  string
+	model   string
+
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	usage map[string]*aiDailyUsage // tenant -> tokens usados hoy
+}
+
+type aiDailyUsage struct {
+	day    string
+	tokens int
+}
+
+// NewLLMClientFromEnv devuelve nil si AI_API_KEY no está seteada.
+func NewLLMClientFromEnv(httpClient *http.Client) *LLMClient {
+	key := strings.TrimSpace(os.Getenv("AI_API_KEY"))
+	if key == "" {
+		return nil
+	}
+	base := strings.TrimRight(strings.TrimSpace(os.Getenv("AI_API_BASE_URL")), "/")
+	if base == "" {
+		base = defaultAIBaseURL
+	}
+	model := strings.TrimSpace(os.Getenv("AI_MODEL"))
+	if model == "" {
+		model = defaultAIModel
+	}
+	return &LLMClient{baseURL: base, apiKey: key, model: model, httpClient: httpClient, usage: make(map[string]*aiDailyUsage)}
+}
+
+func (c *LLMClient) usedToday(tenant string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.usage[tenant]
+	if !ok || u.day != time.Now().Format("2006-01-02") {
+		return 0
+	}
+	return u.tokens
+}
+
+func (c *LLMClient) addUsage(tenant string, tokens int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	today := time.Now().Format("2006-01-02")
+	u, ok := c.usage[tenant]
+	if !ok || u.day != today {
+		u = &aiDailyUsage{day: today}
+		c.usage[tenant] = u
+	}
+	u.tokens += tokens
+}
+
+// Complete pide una respuesta al endpoint /chat/completions.
+func (c *LLMClient) Complete(ctx context.Context, tenant string, cfg *FlowAIConfig, systemPrompt, userText string) (string, error) {
+	if cfg.DailyTokenBudget > 0 && c.usedToday(tenant) >= cfg.DailyTokenBudget {
+		return "", errAIBudgetExceeded
+	}
+
+	maxInput := cfg.MaxInputChars
+	if maxInput == 0 {
+		maxInput = defaultAIMaxInputChars
+	}
+	maxTokens := cfg.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultAIMaxTokens
+	}
+	model := cfg.Model
+	if model == "" {
+		model = c.model
+	}
+	timeout := defaultAITimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	reqBody := map[string]any{
+		"model":      model,
+		"max_tokens": maxTokens,
+		"messages": []map[string]string{
+			{"role": "system", "content": systemPrompt},
+			{"role": "user", "content": truncateRunes(strings.TrimSpace(userText), maxInput)},
+		},
+	}
+	if cfg.Temperature != nil {
+		reqBody["temperature"] = *cfg.Temperature
+	}
+	b, _ := json.Marshal(reqBody)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClientOrShared(c.httpClient).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("respuesta no OK del LLM: %s - %s", resp.Status, string(body))
+	}
+
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("respuesta del LLM inválida: %w", err)
+	}
+	c.addUsage(tenant, out.Usage.TotalTokens)
+
+	if len(out.Choices) == 0 || strings.TrimSpace(out.Choices[0].Message.Content) == "" {
+		return "", errors.New("el LLM no devolvió contenido")
+	}
+	log.Printf("🧠 ai_fallback tenant=%s tokens=%d (hoy: %d)", tenant, out.Usage.TotalTokens, c.usedToday(tenant))
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
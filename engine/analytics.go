@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Flow analytics
+// ---------------------
+// Cada cambio de estado de una sesión se registra como TransitionEvent (Postgres o memoria)
+// y suma a las métricas de /metrics. Con eso se arma el embudo del tenant:
+//
+//	GET /admin/tenants/{tenant}/analytics/funnel?days=7&idle_hours=24
+//
+// - entries: entradas a cada estado
+// - completion_rate: sesiones que llegaron a un estado terminal / sesiones que arrancaron
+// - median_seconds: mediana del tiempo en cada estado hasta pasar al siguiente
+// - drop_offs: último estado de las sesiones sin terminar e inactivas hace idle_hours
+//
+// Los terminales son los de on_complete_webhook.states o, si no hay, los estados sin salida.
+
+const (
+	stateEnteredAtVar      = "_state_entered_at"
+	defaultAnalyticsDays   = 7
+	defaultDropOffIdle     = 24 * time.Hour
+	maxAnalyticsEvents     = 200000
+	maxMemoryAnalyticsRows = 50000 // por tenant
+)
+
+type TransitionEvent struct {
+	Tenant    string    `json:"tenant"`
+	WaID      string    `json:"wa_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	SecondsIn float64   `json:"seconds_in"` // tiempo que estuvo en From
+	At        time.Time `json:"at"`
+
+	// Experimento A/B y variante de la sesión (ver ab_tests.go)
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+}
+
+type AnalyticsStore interface {
+	RecordTransition(ev TransitionEvent) error
+	// Transitions devuelve los eventos desde since en orden cronológico.
+	Transitions(tenant string, since time.Time, limit int) ([]TransitionEvent, error)
+	// DeleteTransitions borra los eventos de un usuario (ver retention.go).
+	DeleteTransitions(tenant, waID string) (int, error)
+}
+
+func NewAnalyticsStore(store *PostgresStore) AnalyticsStore {
+	if store != nil {
+		return store
+	}
+	return &memoryAnalyticsStore{events: make(map[string][]TransitionEvent)}
+}
+
+// recordTransition registra el paso prevState -> sess.State (ya guardado en la sesión).
+func (a *App) recordTransition(tenant string, cfg FlowConfig, prevState string, sess *UserSession, waID string) {
+	if sess.State == prevState {
+		return
+	}
+	if sess.Data == nil {
+		sess.Data = make(map[string]string)
+	}
+	now := time.Now()
+	ev := TransitionEvent{Tenant: tenant, WaID: waID, From: prevState, To: sess.State, At: now}
+	ev.Experiment, ev.Variant = sess.Data[abExperimentVar], sess.Data[abVariantVar]
+	if entered, err := time.Parse(time.RFC3339Nano, sess.Data[stateEnteredAtVar]); err == nil && prevState != "" {
+		ev.SecondsIn = now.Sub(entered).Seconds()
+		metrics.Observe("flowly_state_duration_seconds", ev.SecondsIn, tenant, prevState)
+	}
+	sess.Data[stateEnteredAtVar] = now.Format(time.RFC3339Nano)
+
+	metrics.Inc("flowly_state_entries_total", tenant, sess.State)
+	metrics.Inc("flowly_state_transitions_total", tenant, prevState, sess.State)
+	if isTerminalState(cfg, sess.State) {
+		metrics.Inc("flowly_flow_completions_total", tenant, sess.State)
+		if ev.Variant != "" {
+			metrics.Inc("flowly_ab_completions_total", tenant, ev.Experiment, ev.Variant)
+		}
+	}
+
+	if err := a.analytics.RecordTransition(ev); err != nil {
+		log.Printf("ERROR guardando transición %s -> %s: %v", prevState, sess.State, err)
+	}
+}
+
+func isTerminalState(cfg FlowConfig, state string) bool {
+	wh := cfg.OnCompleteWebhook
+	if wh == nil {
+		wh = &FlowCompleteWebhook{}
+	}
+	return wh.isTerminal(cfg, state)
+}
+
+// ---------------------
+// Funnel
+// ---------------------
+
+type FlowFunnel struct {
+	Tenant         string             `json:"tenant"`
+	Since          time.Time          `json:"since"`
+	Sessions       int                `json:"sessions"`
+	Completed      int                `json:"completed"`
+	CompletionRate float64            `json:"completion_rate"`
+	Entries        map[string]int     `json:"entries"`
+	MedianSeconds  map[string]float64 `json:"median_seconds"`
+	DropOffs       map[string]int     `json:"drop_offs"`
+	TopDropOff     string             `json:"top_drop_off,omitempty"`
+	Truncated      bool               `json:"truncated,omitempty"`
+}
+
+func computeFunnel(cfg FlowConfig, events []TransitionEvent, now time.Time, idle time.Duration) FlowFunnel {
+	f := FlowFunnel{
+		Entries:       make(map[string]int),
+		MedianSeconds: make(map[string]float64),
+		DropOffs:      make(map[string]int),
+	}
+
+	durations := make(map[string][]float64)
+	last := make(map[string]TransitionEvent) // wa_id -> último evento
+	completed := make(map[string]bool)
+	for _, ev := range events {
+		f.Entries[ev.To]++
+		if ev.From != "" && ev.SecondsIn > 0 {
+			durations[ev.From] = append(durations[ev.From], ev.SecondsIn)
+		}
+		last[ev.WaID] = ev
+		if isTerminalState(cfg, ev.To) {
+			completed[ev.WaID] = true
+		}
+	}
+
+	for state, ds := range durations {
+		f.MedianSeconds[state] = median(ds)
+	}
+
+	f.Sessions = len(last)
+	f.Completed = len(completed)
+	if f.Sessions > 0 {
+		f.CompletionRate = float64(f.Completed) / float64(f.Sessions)
+	}
+
+	for waID, ev := range last {
+		if completed[waID] {
+			continue
+		}
+		if now.Sub(ev.At) >= idle {
+			f.DropOffs[ev.To]++
+		}
+	}
+	for _, state := range sortedKeys(f.DropOffs) {
+		if f.TopDropOff == "" || f.DropOffs[state] > f.DropOffs[f.TopDropOff] {
+			f.TopDropOff = state
+		}
+	}
+	return f
+}
+
+func median(xs []float64) float64 {
+	sort.Float64s(xs)
+	n := len(xs)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return xs[n/2]
+	}
+	return (xs[n/2-1] + xs[n/2]) / 2
+}
+
+func (a *App) handleAdminFunnel(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	cfg, err := a.cache.Load(tenant)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	days := defaultAnalyticsDays
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 && n <= 365 {
+		days = n
+	}
+	idle := defaultDropOffIdle
+	if n, err := strconv.Atoi(r.URL.Query().Get("idle_hours")); err == nil && n > 0 {
+		idle = time.Duration(n) * time.Hour
+	}
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+	events, err := a.analytics.Transitions(tenant, since, maxAnalyticsEvents)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	f := computeFunnel(cfg, events, now, idle)
+	f.Tenant = tenant
+	f.Since = since
+	f.Truncated = len(events) == maxAnalyticsEvents
+	writeJSON(w, http.StatusOK, f)
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryAnalyticsStore struct {
+	mu     sync.Mutex
+	events map[string][]TransitionEvent // tenant -> eventos (cronológico)
+}
+
+func (s *memoryAnalyticsStore) RecordTransition(ev TransitionEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evs := append(s.events[ev.Tenant], ev)
+	if len(evs) > maxMemoryAnalyticsRows {
+		evs = evs[len(evs)-maxMemoryAnalyticsRows:]
+	}
+	s.events[ev.Tenant] = evs
+	return nil
+}
+
+func (s *memoryAnalyticsStore) Transitions(tenant string, since time.Time, limit int) ([]TransitionEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []TransitionEvent
+	for _, ev := range s.events[tenant] {
+		if ev.At.Before(since) {
+			continue
+		}
+		out = append(out, ev)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryAnalyticsStore) DeleteTransitions(tenant, waID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.events[tenant][:0]
+	for _, ev := range s.events[tenant] {
+		if ev.WaID != waID {
+			kept = append(kept, ev)
+		}
+	}
+	n := len(s.events[tenant]) - len(kept)
+	s.events[tenant] = kept
+	return n, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) RecordTransition(ev TransitionEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO state_transitions (tenant, wa_id, from_state, to_state, seconds_in, created_at, experiment, variant)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ev.Tenant, ev.WaID, ev.From, ev.To, ev.SecondsIn, ev.At, ev.Experiment, ev.Variant,
+	)
+	return err
+}
+
+func (s *PostgresStore) Transitions(tenant string, since time.Time, limit int) ([]TransitionEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tenant, wa_id, from_state, to_state, seconds_in, created_at, experiment, variant
+		FROM state_transitions
+		WHERE tenant = $1 AND created_at >= $2
+		ORDER BY created_at, id
+		LIMIT $3`,
+		tenant, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TransitionEvent
+	for rows.Next() {
+		var ev TransitionEvent
+		if err := rows.Scan(&ev.Tenant, &ev.WaID, &ev.From, &ev.To, &ev.SecondsIn, &ev.At, &ev.Experiment, &ev.Variant); err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) DeleteTransitions(tenant, waID string) (int, error) {
+	return s.execCount(`DELETE FROM state_transitions WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
@@ -0,0 +1,422 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Seguimiento de turnos (confirmaciones y ausencias)
+// ---------------------
+// Cada turno que reserva el bot queda registrado con la respuesta al recordatorio
+// ("✅ Confirmo" / "❌ Cancelo", ver reminders.go) y, una vez pasado, si el paciente vino o
+// no. La asistencia la marca el negocio por la API admin. El estado de cada turno:
+//
+//	pending      futuro, sin respuesta al recordatorio
+//	confirmed    confirmó (y todavía no se marcó asistencia)
+//	cancelled    canceló desde el recordatorio
+//	unconfirmed  ya pasó, nunca respondió y no se marcó asistencia
+//	attended     vino
+//	no_show      no vino
+//
+// Admin:
+//
+//	GET  /admin/tenants/{tenant}/appointments?days=30&status=unconfirmed&limit=100
+//	GET  /admin/tenants/{tenant}/appointments/stats?days=30
+//	POST /admin/tenants/{tenant}/appointments/{event_id}/outcome   { "outcome": "no_show" }
+//
+// Las estadísticas cuentan los turnos que empezaron en los últimos days días:
+// no_show_rate = no_show / (turnos no cancelados) y confirmation_rate = los que
+// respondieron Confirmo / (turnos a los que se les mandó recordatorio o respondieron).
+
+const (
+	defaultAppointmentDays      = 30
+	defaultAppointmentListLimit = 100
+	maxAppointmentStats         = 10000
+
+	confirmationConfirmed = "confirmed"
+	confirmationCancelled = "cancelled"
+	outcomeAttended       = "attended"
+	outcomeNoShow         = "no_show"
+)
+
+type AppointmentRecord struct {
+	Tenant       string     `json:"tenant"`
+	EventID      string     `json:"event_id"`
+	WaID         string     `json:"wa_id"`
+	Name         string     `json:"name,omitempty"`
+	ResourceID   string     `json:"resource_id,omitempty"`
+	Start        time.Time  `json:"start"`
+	Confirmation string     `json:"confirmation,omitempty"` // "", confirmed, cancelled
+	Outcome      string     `json:"outcome,omitempty"`      // "", attended, no_show
+	RemindedAt   *time.Time `json:"reminded_at,omitempty"`
+	RespondedAt  *time.Time `json:"responded_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Status       string     `json:"status"` // calculado (ver status)
+}
+
+type AppointmentStore interface {
+	SaveAppointment(rec AppointmentRecord) error
+	GetAppointment(tenant, eventID string) (AppointmentRecord, bool, error)
+	// MarkReminded registra que se mandó un recordatorio (false si el turno no está).
+	MarkReminded(tenant, eventID string, at time.Time) (bool, error)
+	SetConfirmation(tenant, eventID, confirmation string, at time.Time) (bool, error)
+	SetOutcome(tenant, eventID, outcome string) (bool, error)
+	// ListAppointments devuelve los turnos con start en [from, to), más recientes primero.
+	ListAppointments(tenant string, from, to time.Time, limit int) ([]AppointmentRecord, error)
+	// DeleteAppointments borra los turnos de un usuario (ver retention.go).
+	DeleteAppointments(tenant, waID string) (int, error)
+}
+
+func NewAppointmentStore(store *PostgresStore) AppointmentStore {
+	if store != nil {
+		return store
+	}
+	return &memoryAppointmentStore{records: make(map[string]*AppointmentRecord)}
+}
+
+// status resume confirmación y asistencia en un solo estado.
+func (r AppointmentRecord) status(now time.Time) string {
+	switch {
+	case r.Outcome != "":
+		return r.Outcome
+	case r.Confirmation != "":
+		return r.Confirmation
+	case r.Start.After(now):
+		return "pending"
+	default:
+		return "unconfirmed"
+	}
+}
+
+type AppointmentStats struct {
+	Tenant      string    `json:"tenant"`
+	Since       time.Time `json:"since"`
+	Total       int       `json:"total"`
+	Confirmed   int       `json:"confirmed"`
+	Cancelled   int       `json:"cancelled"`
+	Unconfirmed int       `json:"unconfirmed"`
+	Attended    int       `json:"attended"`
+	NoShow      int       `json:"no_show"`
+	// Confirmados entre los que recibieron recordatorio (o respondieron); null sin datos
+	ConfirmationRate *float64 `json:"confirmation_rate"`
+	NoShowRate       *float64 `json:"no_show_rate"`
+	Truncated        bool     `json:"truncated,omitempty"`
+}
+
+func computeAppointmentStats(recs []AppointmentRecord, now time.Time) AppointmentStats {
+	var s AppointmentStats
+	asked, confirmedAnswers := 0, 0
+	for _, r := range recs {
+		s.Total++
+		switch r.status(now) {
+		case confirmationConfirmed:
+			s.Confirmed++
+		case confirmationCancelled:
+			s.Cancelled++
+		case "unconfirmed":
+			s.Unconfirmed++
+		case outcomeAttended:
+			s.Attended++
+		case outcomeNoShow:
+			s.NoShow++
+		}
+		if r.RemindedAt != nil || r.Confirmation != "" {
+			asked++
+			if r.Confirmation == confirmationConfirmed {
+				confirmedAnswers++
+			}
+		}
+	}
+	if asked > 0 {
+		rate := float64(confirmedAnswers) / float64(asked)
+		s.ConfirmationRate = &rate
+	}
+	if kept := s.Total - s.Cancelled; kept > 0 {
+		rate := float64(s.NoShow) / float64(kept)
+		s.NoShowRate = &rate
+	}
+	return s
+}
+
+// recordAppointmentConfirmation guarda la respuesta al recordatorio (best effort: si falla
+// solo se loguea, la respuesta al usuario sigue igual).
+func (a *App) recordAppointmentConfirmation(tenant, eventID, confirmation string) {
+	ok, err := a.appointments.SetConfirmation(tenant, eventID, confirmation, time.Now())
+	if err != nil {
+		log.Printf("ERROR guardando la respuesta al recordatorio de %s: %v", eventID, err)
+		return
+	}
+	if ok {
+		metrics.Inc("flowly_appointment_confirmations_total", tenant, confirmation)
+	}
+}
+
+// ---------------------
+// Admin
+// ---------------------
+
+// appointmentWindow lee ?days= (default 30) y devuelve [now-days, now+days): los turnos
+// pendientes de los próximos días también se listan.
+func appointmentWindow(r *http.Request, now time.Time) (from, to time.Time) {
+	days := defaultAppointmentDays
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 && n <= 365 {
+		days = n
+	}
+	return now.AddDate(0, 0, -days), now.AddDate(0, 0, days)
+}
+
+func (a *App) handleAdminListAppointments(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	now := time.Now()
+	from, to := appointmentWindow(r, now)
+	status := r.URL.Query().Get("status")
+	limit := queryLimit(r, defaultAppointmentListLimit, 1000)
+
+	recs, err := a.appointments.ListAppointments(tenant, from, to, maxAppointmentStats)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]AppointmentRecord, 0, limit)
+	for _, rec := range recs {
+		rec.Status = rec.status(now)
+		if status != "" && rec.Status != status {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		out = append(out, rec)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tenant": tenant, "appointments": out})
+}
+
+func (a *App) handleAdminAppointmentStats(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	now := time.Now()
+	from, _ := appointmentWindow(r, now)
+	recs, err := a.appointments.ListAppointments(tenant, from, now, maxAppointmentStats)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s := computeAppointmentStats(recs, now)
+	s.Tenant, s.Since = tenant, from
+	s.Truncated = len(recs) == maxAppointmentStats
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (a *App) handleAdminSetAppointmentOutcome(w http.ResponseWriter, r *http.Request) {
+	tenant, eventID := r.PathValue("tenant"), r.PathValue("event_id")
+	var req struct {
+		Outcome string `json:"outcome"` // attended, no_show o "" para borrarla
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	if req.Outcome != "" && req.Outcome != outcomeAttended && req.Outcome != outcomeNoShow {
+		writeJSONError(w, http.StatusBadRequest, `outcome tiene que ser "attended", "no_show" o ""`)
+		return
+	}
+	ok, err := a.appointments.SetOutcome(tenant, eventID, req.Outcome)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "turno no encontrado")
+		return
+	}
+	log.Printf("🛠️ admin: tenant=%s turno %s marcado como %q", tenant, eventID, req.Outcome)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "tenant": tenant, "event_id": eventID, "outcome": req.Outcome})
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryAppointmentStore struct {
+	mu      sync.Mutex
+	records map[string]*AppointmentRecord // tenant:event_id -> turno
+}
+
+func (s *memoryAppointmentStore) SaveAppointment(rec AppointmentRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	s.records[rec.Tenant+":"+rec.EventID] = &rec
+	return nil
+}
+
+func (s *memoryAppointmentStore) GetAppointment(tenant, eventID string) (AppointmentRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[tenant+":"+eventID]
+	if !ok {
+		return AppointmentRecord{}, false, nil
+	}
+	return *r, true, nil
+}
+
+func (s *memoryAppointmentStore) update(tenant, eventID string, fn func(r *AppointmentRecord)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[tenant+":"+eventID]
+	if ok {
+		fn(r)
+	}
+	return ok
+}
+
+func (s *memoryAppointmentStore) MarkReminded(tenant, eventID string, at time.Time) (bool, error) {
+	return s.update(tenant, eventID, func(r *AppointmentRecord) { r.RemindedAt = &at }), nil
+}
+
+func (s *memoryAppointmentStore) SetConfirmation(tenant, eventID, confirmation string, at time.Time) (bool, error) {
+	return s.update(tenant, eventID, func(r *AppointmentRecord) { r.Confirmation, r.RespondedAt = confirmation, &at }), nil
+}
+
+func (s *memoryAppointmentStore) SetOutcome(tenant, eventID, outcome string) (bool, error) {
+	return s.update(tenant, eventID, func(r *AppointmentRecord) { r.Outcome = outcome }), nil
+}
+
+func (s *memoryAppointmentStore) ListAppointments(tenant string, from, to time.Time, limit int) ([]AppointmentRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []AppointmentRecord
+	for _, r := range s.records {
+		if r.Tenant == tenant && !r.Start.Before(from) && r.Start.Before(to) {
+			out = append(out, *r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.After(out[j].Start) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *memoryAppointmentStore) DeleteAppointments(tenant, waID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, r := range s.records {
+		if r.Tenant == tenant && r.WaID == waID {
+			delete(s.records, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) SaveAppointment(rec AppointmentRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO appointments (tenant, event_id, wa_id, name, resource_id, start_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, event_id) DO UPDATE
+		SET wa_id = EXCLUDED.wa_id, name = EXCLUDED.name, resource_id = EXCLUDED.resource_id, start_at = EXCLUDED.start_at`,
+		rec.Tenant, rec.EventID, rec.WaID, rec.Name, rec.ResourceID, rec.Start,
+	)
+	return err
+}
+
+func (s *PostgresStore) GetAppointment(tenant, eventID string) (AppointmentRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	r, err := scanAppointment(s.db.QueryRowContext(ctx, `
+		SELECT tenant, event_id, wa_id, name, resource_id, start_at, confirmation, outcome, reminded_at, responded_at, created_at
+		FROM appointments WHERE tenant = $1 AND event_id = $2`, tenant, eventID))
+	if err == sql.ErrNoRows {
+		return AppointmentRecord{}, false, nil
+	}
+	if err != nil {
+		return AppointmentRecord{}, false, err
+	}
+	return r, true, nil
+}
+
+func (s *PostgresStore) execAppointment(query string, args ...any) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *PostgresStore) MarkReminded(tenant, eventID string, at time.Time) (bool, error) {
+	return s.execAppointment(`UPDATE appointments SET reminded_at = $3 WHERE tenant = $1 AND event_id = $2`, tenant, eventID, at)
+}
+
+func (s *PostgresStore) SetConfirmation(tenant, eventID, confirmation string, at time.Time) (bool, error) {
+	return s.execAppointment(`UPDATE appointments SET confirmation = $3, responded_at = $4 WHERE tenant = $1 AND event_id = $2`, tenant, eventID, confirmation, at)
+}
+
+func (s *PostgresStore) SetOutcome(tenant, eventID, outcome string) (bool, error) {
+	return s.execAppointment(`UPDATE appointments SET outcome = $3 WHERE tenant = $1 AND event_id = $2`, tenant, eventID, outcome)
+}
+
+func (s *PostgresStore) ListAppointments(tenant string, from, to time.Time, limit int) ([]AppointmentRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tenant, event_id, wa_id, name, resource_id, start_at, confirmation, outcome, reminded_at, responded_at, created_at
+		FROM appointments
+		WHERE tenant = $1 AND start_at >= $2 AND start_at < $3
+		ORDER BY start_at DESC
+		LIMIT $4`,
+		tenant, from, to, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AppointmentRecord
+	for rows.Next() {
+		r, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func scanAppointment(row rowScanner) (AppointmentRecord, error) {
+	var r AppointmentRecord
+	var reminded, responded sql.NullTime
+	if err := row.Scan(&r.Tenant, &r.EventID, &r.WaID, &r.Name, &r.ResourceID, &r.Start, &r.Confirmation, &r.Outcome, &reminded, &responded, &r.CreatedAt); err != nil {
+		return AppointmentRecord{}, err
+	}
+	if reminded.Valid {
+		r.RemindedAt = &reminded.Time
+	}
+	if responded.Valid {
+		r.RespondedAt = &responded.Time
+	}
+	return r, nil
+}
+
+func (s *PostgresStore) DeleteAppointments(tenant, waID string) (int, error) {
+	return s.execCount(`DELETE FROM appointments WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
@@ -0,0 +1,365 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Audit log
+// ---------------------
+// Registro append-only de lo que se hace por la API admin y de los cambios de config que
+// llegan solos. Cada request admin que no es GET queda con quién, cuándo, qué ruta, sobre
+// qué tenant / recurso y con qué status; publicar, guardar o hacer rollback de un flow
+// guarda además el diff de flow.json. El sync de configs remotas y la rotación de secrets
+// quedan como actor "system".
+//
+//	GET /admin/audit?tenant=broker&action=publish&actor=ana&since=2025-01-01T00:00:00Z&limit=100
+//
+// Para saber quién es quién, cada operador tiene su token en ADMIN_TOKENS; con el
+// ADMIN_TOKEN compartido el actor es "admin" (o "admin/<X-Admin-User>", declarado por el
+// cliente). En Postgres la tabla no acepta UPDATE ni DELETE.
+//
+// ENV:
+//
+//	ADMIN_TOKENS=ana:tok_ana,bruno:tok_bruno
+
+const (
+	maxMemoryAuditRows = 10000
+	maxAuditDiffLines  = 4000 // flows más largos: solo se registra que cambiaron
+	defaultAuditLimit  = 100
+	systemAuditActor   = "system"
+)
+
+type AuditEntry struct {
+	ID         int64             `json:"id"`
+	At         time.Time         `json:"at"`
+	Actor      string            `json:"actor"`
+	Action     string            `json:"action"` // ej: "POST /admin/tenants/{tenant}/flow/versions/{version}/publish"
+	Tenant     string            `json:"tenant,omitempty"`
+	Target     string            `json:"target,omitempty"` // wa_id, versión, id de campaña...
+	Status     int               `json:"status,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	Diff       string            `json:"diff,omitempty"`
+}
+
+type AuditFilter struct {
+	Tenant string
+	Action string // substring
+	Actor  string
+	Since  time.Time
+}
+
+type AuditStore interface {
+	AppendAudit(e AuditEntry) error
+	// ListAudit devuelve las entradas más recientes primero.
+	ListAudit(f AuditFilter, limit int) ([]AuditEntry, error)
+}
+
+func NewAuditStore(store *PostgresStore) AuditStore {
+	if store != nil {
+		return store
+	}
+	return &memoryAuditStore{}
+}
+
+func (a *App) recordAudit(e AuditEntry) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	if err := a.audit.AppendAudit(e); err != nil {
+		log.Printf("ERROR guardando audit log (%s %s): %v", e.Actor, e.Action, err)
+	}
+}
+
+// ---------------------
+// Actores y enriquecimiento desde los handlers
+// ---------------------
+
+type auditKey struct{}
+
+// adminActor resuelve el operador por su token (ADMIN_TOKENS o ADMIN_TOKEN). ok=false si
+// el token no es válido.
+func adminActor(r *http.Request, token string) (string, bool) {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	operators := parseTenantMap(os.Getenv("ADMIN_TOKENS"))
+	for _, name := range sortedKeys(operators) {
+		if tok := operators[name]; tok != "" && validAdminToken(got, tok) {
+			return name, true
+		}
+	}
+	if token == "" || !validAdminToken(got, token) {
+		return "", false
+	}
+	if u := strings.TrimSpace(r.Header.Get("X-Admin-User")); u != "" {
+		return "admin/" + truncateRunes(u, 64), true
+	}
+	return "admin", true
+}
+
+// auditNote agrega un dato a la entrada del request admin en curso (no-op fuera de uno).
+func auditNote(r *http.Request, key, value string) {
+	if e, ok := r.Context().Value(auditKey{}).(*AuditEntry); ok {
+		if e.Details == nil {
+			e.Details = make(map[string]string)
+		}
+		e.Details[key] = value
+	}
+}
+
+// auditDiff guarda el diff del flow en la entrada del request admin en curso.
+func auditDiff(r *http.Request, diff string) {
+	if e, ok := r.Context().Value(auditKey{}).(*AuditEntry); ok {
+		e.Diff = diff
+	}
+}
+
+// withAudit registra el request (si no es GET) después de que corre el handler.
+func (a *App) withAudit(actor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+		e := &AuditEntry{
+			Actor:      actor,
+			Action:     r.Pattern,
+			Tenant:     r.PathValue("tenant"),
+			Target:     auditTarget(r),
+			RemoteAddr: clientIP(r),
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, e)))
+		e.Status = rec.status
+		a.recordAudit(*e)
+	}
+}
+
+func auditTarget(r *http.Request) string {
+	for _, k := range []string{"wa_id", "version", "id"} {
+		if v := r.PathValue(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// ---------------------
+// Diff de flows
+// ---------------------
+
+// flowVersionDiff compara dos versiones del flow del tenant ("" si no se pueden leer).
+func flowVersionDiff(tenant, from, to string) string {
+	old, err := os.ReadFile(flowVersionPath(tenant, from))
+	if err != nil {
+		return ""
+	}
+	cur, err := os.ReadFile(flowVersionPath(tenant, to))
+	if err != nil {
+		return ""
+	}
+	return lineDiff(string(old), string(cur))
+}
+
+// lineDiff arma un diff por líneas (estilo unified, 2 líneas de contexto).
+func lineDiff(old, cur string) string {
+	if old == cur {
+		return ""
+	}
+	a, b := strings.Split(old, "\n"), strings.Split(cur, "\n")
+	if len(a) > maxAuditDiffLines || len(b) > maxAuditDiffLines {
+		return fmt.Sprintf("(diff omitido: %d -> %d líneas)", len(a), len(b))
+	}
+
+	// LCS clásico: lcs[i][j] = largo de la subsecuencia común de a[i:] y b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type diffLine struct {
+		op   byte // ' ', '-', '+'
+		text string
+		ai   int // línea en old (1-based) para ' ' y '-'
+		bi   int // línea en cur para ' ' y '+'
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i + 1, j + 1})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i + 1, j + 1})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j], i + 1, j + 1})
+			j++
+		}
+	}
+
+	// Hunks: cambios a menos de 2*diffContext líneas de distancia van juntos
+	const diffContext = 2
+	var out strings.Builder
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		end := k
+		for n := k + 1; n < len(lines) && n <= end+2*diffContext; n++ {
+			if lines[n].op != ' ' {
+				end = n
+			}
+		}
+		from, to := max(k-diffContext, 0), min(end+diffContext, len(lines)-1)
+		fmt.Fprintf(&out, "@@ -%d +%d @@\n", lines[from].ai, lines[from].bi)
+		for n := from; n <= to; n++ {
+			fmt.Fprintf(&out, "%c%s\n", lines[n].op, lines[n].text)
+		}
+		k = to + 1
+	}
+	return out.String()
+}
+
+// ---------------------
+// Admin endpoint
+// ---------------------
+
+func (a *App) handleAdminListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := AuditFilter{Tenant: q.Get("tenant"), Action: q.Get("action"), Actor: q.Get("actor")}
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "since inválido (RFC3339)")
+			return
+		}
+		f.Since = t
+	}
+	limit := defaultAuditLimit
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 && n <= 1000 {
+		limit = n
+	}
+	entries, err := a.audit.ListAudit(f, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"count": len(entries), "entries": entries})
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryAuditStore struct {
+	mu      sync.Mutex
+	entries []AuditEntry // cronológico
+	seq     int64
+}
+
+func (s *memoryAuditStore) AppendAudit(e AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	e.ID = s.seq
+	s.entries = append(s.entries, e)
+	if len(s.entries) > maxMemoryAuditRows {
+		s.entries = s.entries[len(s.entries)-maxMemoryAuditRows:]
+	}
+	return nil
+}
+
+func (s *memoryAuditStore) ListAudit(f AuditFilter, limit int) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []AuditEntry
+	for i := len(s.entries) - 1; i >= 0 && len(out) < limit; i-- {
+		e := s.entries[i]
+		if (f.Tenant != "" && e.Tenant != f.Tenant) || (f.Actor != "" && e.Actor != f.Actor) ||
+			(f.Action != "" && !strings.Contains(e.Action, f.Action)) || e.At.Before(f.Since) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) AppendAudit(e AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	details, _ := json.Marshal(e.Details)
+	if e.Details == nil {
+		details = []byte("{}")
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit_log (created_at, actor, action, tenant, target, status, remote_addr, details, diff)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		e.At, e.Actor, e.Action, e.Tenant, e.Target, e.Status, e.RemoteAddr, details, e.Diff,
+	)
+	return err
+}
+
+func (s *PostgresStore) ListAudit(f AuditFilter, limit int) ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, created_at, actor, action, tenant, target, status, remote_addr, details, diff
+		FROM audit_log
+		WHERE ($1 = '' OR tenant = $1) AND ($2 = '' OR action LIKE '%' || $2 || '%')
+		  AND ($3 = '' OR actor = $3) AND created_at >= $4
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5`,
+		f.Tenant, f.Action, f.Actor, f.Since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.Tenant, &e.Target, &e.Status, &e.RemoteAddr, &details, &e.Diff); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(details, &e.Details)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
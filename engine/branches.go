@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Sucursales: varios números para un mismo flow
+// ---------------------
+// Un tenant puede atender con varios phone_number_id (una sucursal por número) con el mismo
+// flow. En TENANT_BY_PHONE_NUMBER_ID cada número lleva la sucursal después del tenant:
+//
+//	TENANT_BY_PHONE_NUMBER_ID=1111:demo_medical/palermo,2222:demo_medical/belgrano,3333:broker
+//
+// y en flow.json van los datos de cada una:
+//
+//	"branches": {
+//	  "palermo":  { "calendar": "dr_perez", "vars": { "name": "Sede Palermo", "address": "Av. Santa Fe 3200" } },
+//	  "belgrano": { "calendar": "dra_gomez", "vars": { "name": "Sede Belgrano", "address": "Cabildo 1800" } }
+//	}
+//
+// La sucursal es la del número al que escribió el usuario (si escribe a otro, pasa a esa) y
+// sus vars quedan como {{branch.address}}, {{branch.name}}...; {{branch.id}} es el nombre de la
+// sucursal. calendar es la agenda de calendar.json que usan get_calendar_days /
+// get_calendar_slots mientras el usuario no elija otra. Los recordatorios, los envíos de la
+// API (ver outbound_api.go) y lo que el bot manda solo (timeouts, nudges) salen del número de
+// la sucursal.
+
+const (
+	branchVar         = "_branch"          // sucursal de la sesión (la del último número al que escribió)
+	branchCalendarVar = "_branch_calendar" // agenda de la sucursal
+	branchVarPrefix   = "branch."
+)
+
+var branchNameRe = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+type FlowBranch struct {
+	Calendar string            `json:"calendar,omitempty"` // id de la agenda en calendar.json
+	Vars     map[string]string `json:"vars,omitempty"`
+}
+
+func validateBranches(cfg FlowConfig) []string {
+	var errs []string
+	for _, name := range sortedKeys(cfg.Branches) {
+		if !branchNameRe.MatchString(name) {
+			errs = append(errs, fmt.Sprintf("branches.%s: el nombre solo puede tener minúsculas, números, _ y -", name))
+		}
+		for k := range cfg.Branches[name].Vars {
+			if k == "id" || strings.TrimSpace(k) == "" || strings.ContainsAny(k, "{} ") {
+				errs = append(errs, fmt.Sprintf("branches.%s.vars: nombre de variable inválido %q", name, k))
+			}
+		}
+	}
+	return errs
+}
+
+// splitTenantBranch separa "tenant/sucursal" (sin sucursal, "").
+func splitTenantBranch(s string) (tenant, branch string) {
+	tenant, branch, _ = strings.Cut(s, "/")
+	return strings.TrimSpace(tenant), strings.TrimSpace(branch)
+}
+
+// branchVars son las variables {{branch.*}} de la sucursal.
+func (cfg FlowConfig) branchVars(branch string) map[string]string {
+	vars := map[string]string{branchVarPrefix + "id": branch}
+	for k, v := range cfg.Branches[branch].Vars {
+		vars[branchVarPrefix+k] = v
+	}
+	return vars
+}
+
+// applyBranch deja en la sesión la sucursal del número al que escribió el usuario, con sus
+// variables.
+func (a *App) applyBranch(tenant string, client MessageSender, sess *UserSession, vars map[string]string) {
+	branch := sess.Data[branchVar]
+	if wc, ok := client.(*wa.Client); ok {
+		if b := a.resolver.Branch(wc.PhoneID); b != "" {
+			branch = b
+		}
+	}
+	if branch == "" {
+		return
+	}
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return
+	}
+	b, ok := cfg.Branches[branch]
+	if !ok {
+		log.Printf("⚠️ tenant=%s la sucursal %q no está en branches", tenant, branch)
+	}
+	if prev := sess.Data[branchVar]; prev != branch {
+		if prev != "" {
+			// Cambió de sucursal: la agenda elegida era de la otra
+			log.Printf("🏢 tenant=%s wa_id=%s pasa de la sucursal %s a %s", tenant, vars["wa_id"], prev, branch)
+			delete(sess.Data, calendarResourceVar)
+			delete(vars, calendarResourceVar)
+		}
+		setSessionVar(sess, vars, branchVar, branch)
+	}
+	setSessionVar(sess, vars, branchCalendarVar, b.Calendar)
+	// Quedan en la sesión para lo que el bot manda solo (timeouts, nudges, la API de envíos)
+	for k := range sess.Data {
+		if strings.HasPrefix(k, branchVarPrefix) {
+			delete(sess.Data, k)
+			delete(vars, k)
+		}
+	}
+	for k, v := range cfg.branchVars(branch) {
+		setSessionVar(sess, vars, k, v)
+	}
+}
+
+// sessionPhoneNumberID es el número desde el que se le escribe al usuario: el de su sucursal
+// o, si no tiene, el del tenant.
+func (a *App) sessionPhoneNumberID(tenant string, sess *UserSession) (string, bool) {
+	if branch := sess.Data[branchVar]; branch != "" {
+		if id, ok := a.resolver.BranchPhoneNumberID(tenant, branch); ok {
+			return id, true
+		}
+	}
+	return a.resolver.PhoneNumberID(tenant)
+}
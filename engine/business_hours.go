@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Business hours (away message)
+// ---------------------
+// Fuera del horario de atención, un mensaje entrante no sigue el flow: la sesión pasa al
+// out_of_hours_state (ej: "Respondemos de lunes a viernes de 9 a 17"). Si el usuario vuelve
+// a escribir estando en ese estado, se procesan sus transiciones normalmente. Sin
+// out_of_hours_state se le contesta error_messages.out_of_hours al primer mensaje y la
+// sesión se queda donde estaba (ver error_messages.go).
+//
+//	"business_hours": {
+//	  "timezone": "America/Argentina/Buenos_Aires",
+//	  "work_days": [1, 2, 3, 4, 5],
+//	  "from": "09:00",
+//	  "to": "17:00",
+//	  "out_of_hours_state": "AWAY"
+//	}
+//
+// Con "from_calendar": true se usan work_days/start_hour/end_hour de calendar.json.
+// Una franja con from > to cruza la medianoche (cuenta para el día en que arranca).
+
+type FlowBusinessHours struct {
+	Timezone     string `json:"timezone,omitempty"`  // default: zona de la agenda
+	WorkDays     []int  `json:"work_days,omitempty"` // 0=Domingo ... 6=Sábado (default Lun-Vie)
+	From         string `json:"from,omitempty"`      // HH:MM
+	To           string `json:"to,omitempty"`        // HH:MM
+	FromCalendar bool   `json:"from_calendar,omitempty"`
+
+	OutOfHoursState string `json:"out_of_hours_state,omitempty"`
+}
+
+func validateBusinessHours(cfg FlowConfig) []string {
+	bh := cfg.BusinessHours
+	if bh == nil {
+		return nil
+	}
+	var errs []string
+	if _, ok := cfg.States[bh.OutOfHoursState]; !ok && bh.OutOfHoursState != "" {
+		errs = append(errs, fmt.Sprintf("business_hours.out_of_hours_state apunta a un estado inexistente: %q", bh.OutOfHoursState))
+	}
+	return append(errs, bh.validate("business_hours")...)
+}
+
+// validate revisa zona, días y franja (field es dónde está en flow.json, para los errores).
+func (bh *FlowBusinessHours) validate(field string) []string {
+	var errs []string
+	if bh.Timezone != "" {
+		if _, err := time.LoadLocation(bh.Timezone); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.timezone inválida: %q", field, bh.Timezone))
+		}
+	}
+	for _, d := range bh.WorkDays {
+		if d < 0 || d > 6 {
+			errs = append(errs, fmt.Sprintf("%s.work_days fuera de rango (0..6): %d", field, d))
+		}
+	}
+	if !bh.FromCalendar {
+		if _, err := parseClock(bh.From); err != nil {
+			errs = append(errs, field+".from: "+err.Error())
+		}
+		if _, err := parseClock(bh.To); err != nil {
+			errs = append(errs, field+".to: "+err.Error())
+		}
+	}
+	return errs
+}
+
+func (bh *FlowBusinessHours) location() *time.Location {
+	if bh.Timezone != "" {
+		if loc, err := time.LoadLocation(bh.Timezone); err == nil {
+			return loc
+		}
+	}
+	return calendar.Location()
+}
+
+// schedule devuelve días y franja (en minutos del día) a aplicar.
+func (bh *FlowBusinessHours) schedule(tenant string) (days []int, from, to int, err error) {
+	days = bh.WorkDays
+	if bh.FromCalendar {
+		cal, err := loadCalendarConfig(tenant)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if len(days) == 0 {
+			days = cal.WorkDays
+		}
+		return days, cal.StartHour * 60, cal.EndHour * 60, nil
+	}
+	if len(days) == 0 {
+		days = []int{1, 2, 3, 4, 5}
+	}
+	if from, err = parseClock(bh.From); err != nil {
+		return nil, 0, 0, err
+	}
+	if to, err = parseClock(bh.To); err != nil {
+		return nil, 0, 0, err
+	}
+	return days, from, to, nil
+}
+
+// Open indica si now cae dentro del horario de atención.
+func (bh *FlowBusinessHours) Open(tenant string, now time.Time) bool {
+	days, from, to, err := bh.schedule(tenant)
+	if err != nil {
+		log.Printf("⚠️ tenant=%s business_hours sin horario válido, se atiende igual: %v", tenant, err)
+		return true
+	}
+	local := now.In(bh.location())
+	minute := local.Hour()*60 + local.Minute()
+	isWorkDay := func(wd time.Weekday) bool {
+		for _, d := range days {
+			if time.Weekday(d) == wd {
+				return true
+			}
+		}
+		return false
+	}
+	if from <= to {
+		return isWorkDay(local.Weekday()) && minute >= from && minute < to
+	}
+	// Franja que cruza medianoche
+	if minute >= from {
+		return isWorkDay(local.Weekday())
+	}
+	return minute < to && isWorkDay((local.Weekday()+6)%7)
+}
+
+// outOfHoursState devuelve el estado de ausencia si el tenant está fuera de horario y la
+// sesión todavía no está en ese estado.
+func (a *App) outOfHoursState(tenant string, sess *UserSession) (string, bool) {
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil || cfg.BusinessHours == nil || cfg.BusinessHours.OutOfHoursState == "" {
+		return "", false
+	}
+	bh := cfg.BusinessHours
+	if sess.State == bh.OutOfHoursState || bh.Open(tenant, time.Now()) {
+		return "", false
+	}
+	log.Printf("🌙 tenant=%s fuera de horario, paso a %s", tenant, bh.OutOfHoursState)
+	return bh.OutOfHoursState, true
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// calendar.json
+// ---------------------
+// La agenda (disponibilidad, reservas, feriados, Cal.com / Calendly) vive en flowly/calendar;
+// acá está lo que el engine le agrega a calendar.json: recordatorios, .ics, plantillas del
+// evento y el resumen diario.
+//
+// El flow pregunta "¿Con quién querés turno?" con una lista cuyos ids son los de las
+// agendas (más CAL_ANY para "cualquiera") y va a un estado con get_calendar_slots.
+
+const (
+	calendarAnyResourceID = "CAL_ANY"
+	calendarResourceVar   = "calendar_resource"
+
+	// Paginado de turnos: 9 filas + "Ver más" entran en el límite de 10 rows de WhatsApp
+	calendarSlotsPageSize  = 9
+	calendarSlotsMoreID    = "SLOT_MORE"
+	calendarSlotsOffsetVar = "calendar_slots_offset"
+)
+
+// Estructura para mapear el JSON
+type TenantCalendarConfig struct {
+	calendar.Config
+
+	// Recordatorios por WhatsApp antes del turno (ver reminders.go)
+	Reminders *ReminderConfig `json:"reminders,omitempty"`
+
+	// Mandar un .ics del turno por WhatsApp después de confirmarlo (ver ics.go)
+	ICS *ICSConfig `json:"ics,omitempty"`
+
+	// Título y descripción del evento en Google Calendar, con {{vars}} y filtros (ver
+	// templates.go). Si faltan: "Turno Flowly: {{name}}" y teléfono + profesional.
+	//
+	//	"event_title": "{{service_type|default:Consulta}} - {{name|title}}",
+	//	"event_description": "Motivo: {{notes|default:-}}\nTel: {{phone}}\nRef: {{reference_code}}"
+	//
+	// Vars: las de la sesión más name, phone, email, resource_name, appointment_start y
+	// reference_code (código corto del turno, también queda en appointment_reference_code).
+	// Con Cal.com / Calendly el título lo define el event type.
+	EventTitle       string `json:"event_title,omitempty"`
+	EventDescription string `json:"event_description,omitempty"`
+
+	// Resumen de los turnos del día al dueño del negocio (ver digest.go)
+	DailyDigest *DigestConfig `json:"daily_digest,omitempty"`
+}
+
+// loadCalendarConfig lee configs/{tenant}/calendar.json y aplica defaults.
+func loadCalendarConfig(tenant string) (TenantCalendarConfig, error) {
+	configPath := filepath.Join(ConfigRoot, tenant, "calendar.json")
+
+	// Valores por defecto (si faltan en el JSON)
+	cfg := TenantCalendarConfig{Config: calendar.DefaultConfig()}
+
+	// Cargamos config si existe
+	if _, err := os.Stat(configPath); err == nil {
+		b, err := os.ReadFile(configPath)
+		if err != nil {
+			return TenantCalendarConfig{}, fmt.Errorf("error leyendo config calendario: %w", err)
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return TenantCalendarConfig{}, fmt.Errorf("json calendario inválido: %w", err)
+		}
+	} else {
+		// Fallback por env vars si no hay JSON (retrocompatibilidad)
+		cfg.CalendarID = os.Getenv("GOOGLE_CALENDAR_ID")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return TenantCalendarConfig{}, fmt.Errorf("calendar.json de %s: %w", tenant, err)
+	}
+	errs := append(templateFilterErrors("event_title", cfg.EventTitle), templateFilterErrors("event_description", cfg.EventDescription)...)
+	if len(errs) > 0 {
+		return TenantCalendarConfig{}, fmt.Errorf("calendar.json de %s: %s", tenant, strings.Join(errs, "; "))
+	}
+	if cfg.DailyDigest != nil {
+		if err := cfg.DailyDigest.validate(cfg.Provider); err != nil {
+			return TenantCalendarConfig{}, fmt.Errorf("calendar.json de %s: %w", tenant, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// eventText arma el título y la descripción del evento con las plantillas de calendar.json
+// ("" si no hay plantilla: CreateAppointment usa las de siempre).
+func (cfg TenantCalendarConfig) eventText(vars map[string]string) (title, desc string) {
+	if cfg.EventTitle != "" {
+		title = truncateRunes(strings.TrimSpace(renderVars(cfg.EventTitle, vars)), 250)
+	}
+	if cfg.EventDescription != "" {
+		desc = strings.TrimSpace(renderVars(cfg.EventDescription, vars))
+	}
+	return title, desc
+}
+
+// appointmentReferenceCode es un código corto para que el usuario y el negocio hablen del
+// mismo turno (ej: "7K2QXD"). El mismo turno da siempre el mismo código.
+func appointmentReferenceCode(phone, start string) string {
+	h := fnv.New64a()
+	h.Write([]byte(phone + "|" + start))
+	code := strings.ToUpper(strconv.FormatUint(h.Sum64()|1<<63, 36))
+	return code[len(code)-6:]
+}
+
+// slotLabel es lo que ve el usuario en la lista, en su idioma (ej: "mié 18 — 10:00 hs · Dra.
+// Pérez"). Con hourOnly (el día ya lo eligió) alcanza con la hora.
+func slotLabel(s calendar.Slot, lang string, hourOnly bool) string {
+	start, err := time.Parse(time.RFC3339, s.ISOValue)
+	if err != nil {
+		return s.ISOValue
+	}
+	l := dateLocaleFor(lang)
+	layout := l.slotLayout
+	if hourOnly {
+		layout = l.hourLayout
+	}
+	text := l.format(start.In(calendar.Location()), layout)
+	if s.ShowResource && s.ResourceName != "" {
+		text += " · " + s.ResourceName
+	}
+	return text
+}
@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Turnos en dos pasos: día y después horario
+// ---------------------
+// Con agendas llenas, la lista plana de get_calendar_slots muestra solo los próximos
+// horarios y el usuario tiene que paginar para llegar a otro día. get_calendar_days lista
+// primero los días con lugar (day_1..day_9, con day_N_desc = cuántos horarios hay y
+// DAY_N_DATE = la fecha; "Ver más días" con DAY_MORE y show_if "days_more"). Elegir un
+// DAY_N y pasar a un estado con get_calendar_slots muestra solo los horarios de ese día,
+// paginados con SLOT_MORE como siempre:
+//
+//	"PICK_DAY": {
+//	  "type": "interactive_list", "action": "get_calendar_days", "body": "¿Qué día te queda bien?",
+//	  "list": { "button_text": "Ver días", "sections": [{ "title": "Días", "rows": [
+//	    { "id": "DAY_1", "title": "{{day_1}}", "description": "{{day_1_desc}}", "show_if": "day_1" },
+//	    ...
+//	    { "id": "DAY_MORE", "title": "Ver más días", "show_if": "days_more" }
+//	  ]}]},
+//	  "on_select_next": { "DAY_1": "PICK_TIME", ..., "DAY_MORE": "PICK_DAY" }
+//	}
+//
+// La agenda y el servicio se eligen igual que en get_calendar_slots (opción recién elegida
+// o lo que ya estaba en la sesión). El día queda en calendar_day; sin un DAY_N elegido (o
+// con SLOT_MORE de ese día), get_calendar_slots vuelve a la lista plana.
+
+const (
+	calendarDaysPageSize  = 9
+	calendarDaysMoreID    = "DAY_MORE"
+	calendarDaysOffsetVar = "calendar_days_offset"
+	calendarDayVar        = "calendar_day"
+	calendarDayOptionID   = "DAY_%d"
+
+	// Tope de horarios que se miran para armar los días (todos los de calendar.SearchDays)
+	maxCalendarDaySlots = 1000
+)
+
+// slotQuery es la agenda y el servicio de una búsqueda de turnos según la sesión.
+type slotQuery struct {
+	resourceID    string
+	service       Service
+	pickedService bool
+	hasService    bool
+}
+
+func newSlotQuery(svc calendar.Provider, tenant string, sess *UserSession) slotQuery {
+	// Profesional: si la opción recién elegida es una agenda ("¿Con quién querés turno?")
+	// se usa esa; si no, la que ya estaba en la sesión. CAL_ANY (o nada) = cualquiera.
+	q := slotQuery{resourceID: sess.Data[calendarResourceVar]}
+	if _, chosen := sess.Data[calendarResourceVar]; !chosen && sess.Data[branchCalendarVar] != "" {
+		// La agenda de la sucursal (ver branches.go)
+		if r, ok := svc.Resource(sess.Data[branchCalendarVar]); ok {
+			q.resourceID = r.ID
+		} else {
+			log.Printf("⚠️ tenant=%s la sucursal %s apunta a una agenda inexistente: %q", tenant, sess.Data[branchVar], sess.Data[branchCalendarVar])
+		}
+	}
+	if picked := sess.Data["last_selected_id"]; picked == calendarAnyResourceID {
+		q.resourceID = ""
+	} else if r, ok := svc.Resource(picked); ok {
+		q.resourceID = r.ID
+	}
+
+	// Servicio (services.json): define la duración y, si tiene, la agenda
+	q.service, q.pickedService, q.hasService = sessionService(tenant, sess)
+	if q.pickedService && q.service.Calendar != "" {
+		if _, ok := svc.Resource(q.service.Calendar); ok {
+			q.resourceID = q.service.Calendar
+		} else {
+			log.Printf("⚠️ tenant=%s el servicio %s apunta a una agenda inexistente: %q", tenant, q.service.ID, q.service.Calendar)
+		}
+	}
+	return q
+}
+
+// vars son las variables de sesión de la agenda y el servicio elegidos.
+func (q slotQuery) vars(svc calendar.Provider) map[string]string {
+	vars := make(map[string]string)
+	if q.pickedService {
+		for k, v := range q.service.vars() {
+			vars[k] = v
+		}
+	} else if !q.hasService {
+		vars[serviceIDVar] = ""
+	}
+	vars[calendarResourceVar] = q.resourceID
+	vars["calendar_resource_name"] = ""
+	if r, ok := svc.Resource(q.resourceID); ok {
+		vars["calendar_resource_name"] = r.Name
+	}
+	return vars
+}
+
+// allSlots devuelve todos los horarios libres de la ventana de búsqueda.
+func (q slotQuery) allSlots(ctx context.Context, svc calendar.Provider) ([]calendar.Slot, error) {
+	slots, _, err := svc.GetNextAvailableSlots(ctx, q.resourceID, q.service.duration(), 0, maxCalendarDaySlots)
+	return slots, err
+}
+
+// daySlots es la página [offset, offset+limit) de los horarios del día (YYYY-MM-DD) desde la
+// hora from (15:04, "" = todo el día), con IDs relativos a la página como GetNextAvailableSlots.
+func (q slotQuery) daySlots(ctx context.Context, svc calendar.Provider, day, from string, offset, limit int) ([]calendar.Slot, bool, error) {
+	all, err := q.allSlots(ctx, svc)
+	if err != nil {
+		return nil, false, err
+	}
+	multi := q.resourceID == "" && len(svc.Resources()) > 1
+	var slots []calendar.Slot
+	skipped := 0
+	for _, s := range all {
+		start, err := time.Parse(time.RFC3339, s.ISOValue)
+		if err != nil || slotDay(start) != day || start.In(calendar.Location()).Format("15:04") < from {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if len(slots) >= limit {
+			return slots, true, nil
+		}
+		s.ID = fmt.Sprintf("SLOT_%d", len(slots)+1)
+		s.ShowResource = multi
+		slots = append(slots, s)
+	}
+	return slots, false, nil
+}
+
+func slotDay(t time.Time) string {
+	return t.In(calendar.Location()).Format("2006-01-02")
+}
+
+// selectedCalendarDay es el día que eligió el usuario (el que escribió en un campo "when",
+// DAY_N recién elegido, o el que ya estaba si está paginando sus horarios) y desde qué hora;
+// "" = lista plana.
+func selectedCalendarDay(sess *UserSession) (day, from string) {
+	if day, from, ok := requestedCalendarDay(sess); ok {
+		return day, from
+	}
+	picked := sess.Data["last_selected_id"]
+	switch {
+	case picked == calendarSlotsMoreID:
+		return sess.Data[calendarDayVar], sess.Data[calendarTimeVar]
+	case strings.HasPrefix(picked, "DAY_") && picked != calendarDaysMoreID:
+		return sess.Data[picked+"_DATE"], ""
+	}
+	return "", ""
+}
+
+func actionGetCalendarDays(ctx context.Context, a *App, tenant, userID string, sess *UserSession) (map[string]string, error) {
+	svc, err := a.calendars.Get(tenant)
+	if err != nil {
+		log.Printf("ERROR Calendar Init: %v", err)
+		return map[string]string{"day_1": "Error Config"}, nil
+	}
+	q := newSlotQuery(svc, tenant, sess)
+
+	// "Ver más días" avanza una página; cualquier otra entrada arranca de la primera
+	offset := 0
+	if sess.Data["last_selected_id"] == calendarDaysMoreID {
+		offset, _ = strconv.Atoi(sess.Data[calendarDaysOffsetVar])
+		offset += calendarDaysPageSize
+	}
+
+	all, err := q.allSlots(ctx, svc)
+	if err != nil {
+		log.Printf("ERROR Calendar Query: %v", err)
+		return map[string]string{"day_1": "Sin sistema"}, nil
+	}
+
+	// Días con lugar, en orden, y cuántos horarios tiene cada uno
+	var days []time.Time
+	counts := make(map[string]int)
+	for _, s := range all {
+		start, err := time.Parse(time.RFC3339, s.ISOValue)
+		if err != nil {
+			continue
+		}
+		d := slotDay(start)
+		if counts[d] == 0 {
+			days = append(days, start.In(calendar.Location()))
+		}
+		counts[d]++
+	}
+
+	vars := q.vars(svc)
+	vars[calendarDayVar] = ""
+	vars[calendarWhenVar] = ""
+	vars[calendarDaysOffsetVar] = strconv.Itoa(offset)
+	vars["days_more"] = ""
+	for i := 1; i <= calendarDaysPageSize; i++ {
+		vars[fmt.Sprintf("day_%d", i)] = ""
+		vars[fmt.Sprintf("day_%d_desc", i)] = ""
+		vars[fmt.Sprintf(calendarDayOptionID+"_DATE", i)] = ""
+	}
+	vars["day_1"] = "Sin cupo"
+
+	if offset > len(days) {
+		offset = len(days)
+	}
+	page := days[offset:]
+	if len(page) > calendarDaysPageSize {
+		page = page[:calendarDaysPageSize]
+		vars["days_more"] = "1"
+	}
+	loc := dateLocaleFor(a.sessionDateLang(tenant, sess))
+	for i, d := range page {
+		n := counts[slotDay(d)]
+		vars[fmt.Sprintf("day_%d", i+1)] = loc.format(d, loc.dayLayout)
+		vars[fmt.Sprintf("day_%d_desc", i+1)] = fmt.Sprintf(loc.freeSlots, n)
+		vars[fmt.Sprintf(calendarDayOptionID+"_DATE", i+1)] = slotDay(d)
+	}
+	vars["days_count"] = strconv.Itoa(len(days))
+	return vars, nil
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"flowly/calendar"
+
+	"google.golang.org/api/option"
+)
+
+// ---------------------
+// Calendar registry
+// ---------------------
+// Armar un cliente de Google (leer credenciales, transporte OAuth) en cada acción es caro.
+// El registry crea la agenda (calendar.Provider) de cada tenant la primera vez que se usa y lo reutiliza;
+// el token del service account se renueva solo. Si cambia calendar.json o el archivo de
+// credenciales, el servicio se vuelve a armar. Invalidate fuerza la recarga (ej: cuando el
+// tenant conecta o desconecta su cuenta de Google).
+
+type calendarEntry struct {
+	svc       calendar.Provider
+	cfgMod    time.Time
+	credsMod  time.Time
+	credsPath string
+}
+
+type CalendarRegistry struct {
+	mu       sync.Mutex
+	services map[string]*calendarEntry
+	tokens   OAuthTokenStore     // tokens de los tenants con google_auth=oauth
+	busy     *calendar.BusyCache // free/busy de Google, sobrevive a los rearmados
+}
+
+func NewCalendarRegistry(tokens OAuthTokenStore, busy *calendar.BusyCache) *CalendarRegistry {
+	return &CalendarRegistry{services: make(map[string]*calendarEntry), tokens: tokens, busy: busy}
+}
+
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// Get devuelve el servicio del tenant, armándolo si no existe o si cambió su config.
+func (r *CalendarRegistry) Get(tenant string) (calendar.Provider, error) {
+	credsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	cfgMod := fileModTime(filepath.Join(ConfigRoot, tenant, "calendar.json"))
+	credsMod := fileModTime(credsPath)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.services[tenant]; ok &&
+		e.cfgMod.Equal(cfgMod) && e.credsMod.Equal(credsMod) && e.credsPath == credsPath {
+		return e.svc, nil
+	}
+
+	svc, err := NewBookingProvider(tenant, r.tokens)
+	if err != nil {
+		return nil, err
+	}
+	if cs, ok := svc.(*calendar.Service); ok {
+		cs.Tenant, cs.Busy = tenant, r.busy
+	}
+	svc = traceBookingProvider(tenant, svc)
+	if _, existed := r.services[tenant]; existed {
+		log.Printf("📅 tenant=%s calendario recargado", tenant)
+	}
+	r.services[tenant] = &calendarEntry{svc: svc, cfgMod: cfgMod, credsMod: credsMod, credsPath: credsPath}
+	return svc, nil
+}
+
+// NewBookingProvider arma la agenda del tenant según calendar.json. tokens se usa con
+// google_auth=oauth.
+func NewBookingProvider(tenant string, tokens OAuthTokenStore) (calendar.Provider, error) {
+	cfg, err := loadCalendarConfig(tenant)
+	if err != nil {
+		return nil, err
+	}
+	var auth option.ClientOption
+	if cfg.Provider == "" || cfg.Provider == calendar.ProviderGoogle {
+		if auth, err = googleClientOption(tenant, cfg, tokens); err != nil {
+			return nil, err
+		}
+	}
+	return calendar.New(cfg.Config, auth, sharedHTTPClient)
+}
+
+// Invalidate descarta el servicio cacheado del tenant (se rearma en el próximo uso).
+func (r *CalendarRegistry) Invalidate(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.services, tenant)
+}
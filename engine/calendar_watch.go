@@ -0,0 +1,36 @@
+package engine
+
+import "net/http"
+
+// ---------------------
+// Push notifications (Google Calendar)
+// ---------------------
+// Los watch channels los abre el cache de free/busy (calendar.BusyCache, CALENDAR_WATCH=1);
+// acá se reciben los avisos en PUBLIC_BASE_URL/calendar/notifications. Si el canal lo abrió
+// otra réplica, el aviso se le reenvía (ver cluster.go).
+
+// handleCalendarNotification recibe los avisos de cambio de Google (un POST sin body, todo
+// va en headers) y descarta el free/busy cacheado de ese calendario.
+func (a *App) handleCalendarNotification(w http.ResponseWriter, r *http.Request) {
+	// "sync" es el aviso inicial del canal. Canal viejo o desconocido: 200 igual, para que
+	// Google no reintente
+	if r.Header.Get("X-Goog-Resource-State") != "sync" {
+		a.calendarNotification(r.Header.Get("X-Goog-Channel-ID"), r.Header.Get("X-Goog-Channel-Token"), true)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// calendarNotification aplica el aviso de un canal. Si el canal no es de esta réplica y
+// forward=true, se le reenvía a las otras (lo abrió alguna de ellas).
+func (a *App) calendarNotification(channelID, token string, forward bool) {
+	tenant, known := a.calendars.busy.Notify(channelID, token)
+	if !known {
+		if forward && channelID != "" {
+			a.notifyReplicas(clusterCalendarPush, channelID, token)
+		}
+		return
+	}
+	if tenant != "" {
+		metrics.Inc("flowly_calendar_notifications_total", tenant)
+	}
+}
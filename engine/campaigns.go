@@ -0,0 +1,696 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Campaigns (broadcast de templates)
+// ---------------------
+// Una campaña manda un template aprobado a una lista de destinatarios dentro de una
+// ventana de envío. El envío lo hacen jobs "campaign_batch" encadenados (cada uno manda
+// un lote y programa el siguiente), así respeta el rate limit del tenant y sobrevive
+// reinicios si hay Postgres. El estado por destinatario se actualiza con los status
+// callbacks de Meta (sent / delivered / read / failed).
+//
+// ENV:
+//
+//	CAMPAIGN_BATCH_SIZE=100
+
+const (
+	campaignJobKind          = "campaign_batch"
+	defaultCampaignBatchSize = 100
+)
+
+type Campaign struct {
+	ID               int64      `json:"id"`
+	Tenant           string     `json:"tenant"`
+	Name             string     `json:"name,omitempty"`
+	TemplateName     string     `json:"template_name"`
+	TemplateLanguage string     `json:"template_language"`
+	BodyParams       []string   `json:"body_params,omitempty"` // soportan {{vars}} del destinatario
+	WindowStart      time.Time  `json:"window_start"`
+	WindowEnd        *time.Time `json:"window_end,omitempty"`
+	DailyFrom        string     `json:"daily_from,omitempty"` // "09:00" (hora de Buenos Aires)
+	DailyTo          string     `json:"daily_to,omitempty"`   // "20:00"
+	Status           string     `json:"status"`               // scheduled | running | done | canceled
+	CreatedAt        time.Time  `json:"created_at"`
+
+	// Cantidad de destinatarios por status (solo en lecturas)
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+type CampaignRecipient struct {
+	CampaignID int64             `json:"campaign_id"`
+	WaID       string            `json:"wa_id"`
+	Vars       map[string]string `json:"vars,omitempty"`
+	Status     string            `json:"status"` // pending | accepted | sent | delivered | read | failed | skipped
+	MessageID  string            `json:"message_id,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+type CampaignStore interface {
+	CreateCampaign(c Campaign, recipients []CampaignRecipient) (int64, error)
+	GetCampaign(id int64) (Campaign, bool, error)
+	ListCampaigns(tenant string, limit int) ([]Campaign, error)
+	SetCampaignStatus(id int64, status string) error
+	PendingRecipients(id int64, limit int) ([]CampaignRecipient, error)
+	ListRecipients(id int64, status string, limit int) ([]CampaignRecipient, error)
+	UpdateRecipient(id int64, waID, status, messageID, errMsg string) error
+	// SkipPending marca como "skipped" los destinatarios que todavía no se enviaron.
+	SkipPending(id int64, reason string) (int, error)
+	// RecordCampaignStatus aplica un status de Meta al destinatario con ese message_id.
+	RecordCampaignStatus(messageID, status, errMsg string) error
+	// DeleteRecipients saca a un usuario de las campañas del tenant (ver retention.go).
+	DeleteRecipients(tenant, waID string) (int, error)
+}
+
+func NewCampaignStore(store *PostgresStore) CampaignStore {
+	if store != nil {
+		return store
+	}
+	return &memoryCampaignStore{campaigns: make(map[int64]*memoryCampaign), byMessageID: make(map[string]campaignRecipientRef)}
+}
+
+func campaignBatchSize() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("CAMPAIGN_BATCH_SIZE"))); err == nil && n > 0 {
+		return n
+	}
+	return defaultCampaignBatchSize
+}
+
+// ---------------------
+// Recipients input
+// ---------------------
+
+// parseRecipientsCSV lee un CSV con header; la columna wa_id (o phone) es obligatoria y
+// el resto de las columnas quedan como variables del destinatario.
+func parseRecipientsCSV(raw string) ([]CampaignRecipient, error) {
+	r := csv.NewReader(strings.NewReader(raw))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv sin header: %w", err)
+	}
+	idCol := -1
+	for i, h := range header {
+		header[i] = strings.TrimSpace(h)
+		if header[i] == "wa_id" || header[i] == "phone" {
+			idCol = i
+		}
+	}
+	if idCol < 0 {
+		return nil, errors.New("el csv necesita una columna wa_id (o phone)")
+	}
+
+	var out []CampaignRecipient
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv línea %d: %w", line, err)
+		}
+		vars := map[string]string{}
+		for i, v := range rec {
+			if i != idCol && i < len(header) {
+				vars[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		out = append(out, CampaignRecipient{WaID: strings.TrimSpace(rec[idCol]), Vars: vars})
+	}
+	return out, nil
+}
+
+// normalizeCampaignRecipients saca vacíos y duplicados (gana el primero).
+func normalizeCampaignRecipients(in []CampaignRecipient) []CampaignRecipient {
+	seen := map[string]bool{}
+	out := make([]CampaignRecipient, 0, len(in))
+	for _, r := range in {
+		r.WaID = strings.TrimPrefix(strings.TrimSpace(r.WaID), "+")
+		if r.WaID == "" || seen[r.WaID] {
+			continue
+		}
+		seen[r.WaID] = true
+		r.Status = "pending"
+		out = append(out, r)
+	}
+	return out
+}
+
+// parseClock parsea "HH:MM" a minutos desde medianoche.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("hora inválida %q (formato HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// nextDailyWindow devuelve now si está dentro de la franja diaria (o no hay franja);
+// si no, el próximo inicio de la franja.
+func (c Campaign) nextDailyWindow(now time.Time) time.Time {
+	if c.DailyFrom == "" || c.DailyTo == "" {
+		return now
+	}
+	from, err1 := parseClock(c.DailyFrom)
+	to, err2 := parseClock(c.DailyTo)
+	if err1 != nil || err2 != nil {
+		return now
+	}
+	local := now.In(calendar.Location())
+	minute := local.Hour()*60 + local.Minute()
+	if from <= to && minute >= from && minute < to {
+		return now
+	}
+	if from > to && (minute >= from || minute < to) { // franja que cruza medianoche
+		return now
+	}
+	start := time.Date(local.Year(), local.Month(), local.Day(), from/60, from%60, 0, 0, local.Location())
+	if !start.After(local) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+// ---------------------
+// Worker
+// ---------------------
+
+// enqueueCampaignBatch programa el próximo lote de una campaña.
+func (a *App) enqueueCampaignBatch(c Campaign, at time.Time) error {
+	_, err := a.jobs.Enqueue(Job{
+		Kind:   campaignJobKind,
+		Tenant: c.Tenant,
+		Ref:    strconv.FormatInt(c.ID, 10),
+		RunAt:  at,
+	})
+	return err
+}
+
+func jobSendCampaignBatch(ctx context.Context, a *App, job Job) error {
+	id, err := strconv.ParseInt(job.Ref, 10, 64)
+	if err != nil {
+		return fmt.Errorf("ref de campaña inválida: %q", job.Ref)
+	}
+	c, ok, err := a.campaigns.GetCampaign(id)
+	if err != nil {
+		return err
+	}
+	if !ok || c.Status == "done" || c.Status == "canceled" {
+		return nil
+	}
+
+	now := time.Now()
+	if c.WindowEnd != nil && now.After(*c.WindowEnd) {
+		n, err := a.campaigns.SkipPending(id, "fuera de la ventana de envío")
+		if err != nil {
+			return err
+		}
+		log.Printf("📣 Campaña %d: ventana terminada, %d destinatario(s) sin enviar", id, n)
+		return a.campaigns.SetCampaignStatus(id, "done")
+	}
+	if next := c.nextDailyWindow(now); next.After(now) {
+		log.Printf("📣 Campaña %d fuera de franja horaria, sigue %s", id, next.Format(time.RFC3339))
+		return a.enqueueCampaignBatch(c, next)
+	}
+
+	phoneID, ok := a.resolver.PhoneNumberID(c.Tenant)
+	if !ok {
+		return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", c.Tenant)
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := a.campaigns.PendingRecipients(id, campaignBatchSize())
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		log.Printf("📣 Campaña %d terminada", id)
+		return a.campaigns.SetCampaignStatus(id, "done")
+	}
+	if c.Status == "scheduled" {
+		if err := a.campaigns.SetCampaignStatus(id, "running"); err != nil {
+			return err
+		}
+	}
+
+	sent := 0
+	for _, r := range recipients {
+		if out, err := a.skipOptedOut(c.Tenant, r.WaID); err != nil {
+			return err
+		} else if out {
+			if uerr := a.campaigns.UpdateRecipient(id, r.WaID, "skipped", "", "opt-out"); uerr != nil {
+				log.Printf("ERROR actualizando destinatario %s de campaña %d: %v", r.WaID, id, uerr)
+			}
+			continue
+		}
+		vars := map[string]string{"wa_id": r.WaID}
+		for k, v := range r.Vars {
+			vars[k] = v
+		}
+		params := make([]string, 0, len(c.BodyParams))
+		for _, p := range c.BodyParams {
+			params = append(params, renderVars(p, vars))
+		}
+
+		msgID, err := waClient.SendTemplate(ctx, r.WaID, c.TemplateName, c.TemplateLanguage, params, nil)
+		if errors.Is(err, ErrRateLimited) {
+			// Modo shed: dejamos el resto pendiente y seguimos en un rato
+			log.Printf("🚦 Campaña %d: rate limit, pausa de 1 minuto (%d enviados en este lote)", id, sent)
+			return a.enqueueCampaignBatch(c, time.Now().Add(time.Minute))
+		}
+		status, errMsg := "accepted", ""
+		if err != nil {
+			status, errMsg = "failed", err.Error()
+		} else {
+			sent++
+		}
+		if uerr := a.campaigns.UpdateRecipient(id, r.WaID, status, msgID, errMsg); uerr != nil {
+			log.Printf("ERROR actualizando destinatario %s de campaña %d: %v", r.WaID, id, uerr)
+		}
+	}
+	log.Printf("📣 Campaña %d: lote de %d (%d aceptados)", id, len(recipients), sent)
+	return a.enqueueCampaignBatch(c, time.Now())
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryCampaign struct {
+	c          Campaign
+	recipients []*CampaignRecipient
+	byWaID     map[string]*CampaignRecipient
+}
+
+type campaignRecipientRef struct {
+	id   int64
+	waID string
+}
+
+type memoryCampaignStore struct {
+	mu          sync.Mutex
+	nextID      int64
+	campaigns   map[int64]*memoryCampaign
+	byMessageID map[string]campaignRecipientRef
+}
+
+func (s *memoryCampaignStore) CreateCampaign(c Campaign, recipients []CampaignRecipient) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	c.ID = s.nextID
+	c.Status = "scheduled"
+	c.CreatedAt = time.Now()
+	mc := &memoryCampaign{c: c, byWaID: make(map[string]*CampaignRecipient, len(recipients))}
+	for _, r := range recipients {
+		r := r
+		r.CampaignID = c.ID
+		r.UpdatedAt = c.CreatedAt
+		mc.recipients = append(mc.recipients, &r)
+		mc.byWaID[r.WaID] = &r
+	}
+	s.campaigns[c.ID] = mc
+	return c.ID, nil
+}
+
+func (s *memoryCampaignStore) GetCampaign(id int64) (Campaign, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mc, ok := s.campaigns[id]
+	if !ok {
+		return Campaign{}, false, nil
+	}
+	return mc.withCounts(), true, nil
+}
+
+func (mc *memoryCampaign) withCounts() Campaign {
+	c := mc.c
+	c.Counts = map[string]int{}
+	for _, r := range mc.recipients {
+		c.Counts[r.Status]++
+	}
+	return c
+}
+
+func (s *memoryCampaignStore) ListCampaigns(tenant string, limit int) ([]Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Campaign{}
+	for _, mc := range s.campaigns {
+		if tenant == "" || mc.c.Tenant == tenant {
+			out = append(out, mc.withCounts())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *memoryCampaignStore) SetCampaignStatus(id int64, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mc, ok := s.campaigns[id]; ok {
+		mc.c.Status = status
+	}
+	return nil
+}
+
+func (s *memoryCampaignStore) PendingRecipients(id int64, limit int) ([]CampaignRecipient, error) {
+	return s.ListRecipients(id, "pending", limit)
+}
+
+func (s *memoryCampaignStore) ListRecipients(id int64, status string, limit int) ([]CampaignRecipient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mc, ok := s.campaigns[id]
+	if !ok {
+		return nil, nil
+	}
+	var out []CampaignRecipient
+	for _, r := range mc.recipients {
+		if status != "" && r.Status != status {
+			continue
+		}
+		out = append(out, *r)
+		if len(out) >= limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryCampaignStore) UpdateRecipient(id int64, waID, status, messageID, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mc, ok := s.campaigns[id]
+	if !ok {
+		return nil
+	}
+	r, ok := mc.byWaID[waID]
+	if !ok {
+		return nil
+	}
+	r.Status, r.MessageID, r.Error, r.UpdatedAt = status, messageID, errMsg, time.Now()
+	if messageID != "" {
+		s.byMessageID[messageID] = campaignRecipientRef{id: id, waID: waID}
+	}
+	return nil
+}
+
+func (s *memoryCampaignStore) SkipPending(id int64, reason string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mc, ok := s.campaigns[id]
+	if !ok {
+		return 0, nil
+	}
+	n := 0
+	for _, r := range mc.recipients {
+		if r.Status == "pending" {
+			r.Status, r.Error, r.UpdatedAt = "skipped", reason, time.Now()
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryCampaignStore) RecordCampaignStatus(messageID, status, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.byMessageID[messageID]
+	if !ok {
+		return nil
+	}
+	r := s.campaigns[ref.id].byWaID[ref.waID]
+	if deliveryStatusRank(status) >= deliveryStatusRank(r.Status) {
+		r.Status = status
+		if status == "failed" {
+			r.Error = errMsg
+		}
+		r.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *memoryCampaignStore) DeleteRecipients(tenant, waID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, mc := range s.campaigns {
+		r, ok := mc.byWaID[waID]
+		if mc.c.Tenant != tenant || !ok {
+			continue
+		}
+		delete(mc.byWaID, waID)
+		delete(s.byMessageID, r.MessageID)
+		for i, rr := range mc.recipients {
+			if rr == r {
+				mc.recipients = append(mc.recipients[:i], mc.recipients[i+1:]...)
+				break
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+// campaignStatusRankSQL replica deliveryStatusRank para no pisar "read" con "delivered".
+const campaignStatusRankSQL = `CASE status WHEN 'accepted' THEN 0 WHEN 'sent' THEN 1 WHEN 'delivered' THEN 2 WHEN 'read' THEN 3 WHEN 'failed' THEN 4 ELSE -1 END`
+
+func (s *PostgresStore) CreateCampaign(c Campaign, recipients []CampaignRecipient) (int64, error) {
+	params, _ := json.Marshal(c.BodyParams)
+	if c.BodyParams == nil {
+		params = []byte("[]")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO campaigns (tenant, name, template_name, template_language, body_params, window_start, window_end, daily_from, daily_to)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		c.Tenant, c.Name, c.TemplateName, c.TemplateLanguage, params, c.WindowStart, c.WindowEnd, c.DailyFrom, c.DailyTo,
+	).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO campaign_recipients (campaign_id, wa_id, vars) VALUES ($1, $2, $3)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, r := range recipients {
+		vars, _ := json.Marshal(r.Vars)
+		if r.Vars == nil {
+			vars = []byte("{}")
+		}
+		if _, err := stmt.ExecContext(ctx, id, r.WaID, vars); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+func (s *PostgresStore) GetCampaign(id int64) (Campaign, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	c, err := scanCampaign(s.db.QueryRowContext(ctx, `
+		SELECT id, tenant, name, template_name, template_language, body_params, window_start, window_end, daily_from, daily_to, status, created_at
+		FROM campaigns WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return Campaign{}, false, nil
+	}
+	if err != nil {
+		return Campaign{}, false, err
+	}
+	if c.Counts, err = s.campaignCounts(ctx, id); err != nil {
+		return Campaign{}, false, err
+	}
+	return c, true, nil
+}
+
+func (s *PostgresStore) ListCampaigns(tenant string, limit int) ([]Campaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, tenant, name, template_name, template_language, body_params, window_start, window_end, daily_from, daily_to, status, created_at
+		FROM campaigns
+		WHERE $1 = '' OR tenant = $1
+		ORDER BY id DESC
+		LIMIT $2`, tenant, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Campaign{}
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if out[i].Counts, err = s.campaignCounts(ctx, out[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCampaign(row rowScanner) (Campaign, error) {
+	var c Campaign
+	var params []byte
+	var windowEnd sql.NullTime
+	if err := row.Scan(&c.ID, &c.Tenant, &c.Name, &c.TemplateName, &c.TemplateLanguage, &params, &c.WindowStart, &windowEnd, &c.DailyFrom, &c.DailyTo, &c.Status, &c.CreatedAt); err != nil {
+		return Campaign{}, err
+	}
+	_ = json.Unmarshal(params, &c.BodyParams)
+	if windowEnd.Valid {
+		c.WindowEnd = &windowEnd.Time
+	}
+	return c, nil
+}
+
+func (s *PostgresStore) campaignCounts(ctx context.Context, id int64) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT status, count(*) FROM campaign_recipients WHERE campaign_id = $1 GROUP BY status`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var st string
+		var n int
+		if err := rows.Scan(&st, &n); err != nil {
+			return nil, err
+		}
+		counts[st] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *PostgresStore) SetCampaignStatus(id int64, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE campaigns SET status = $2, updated_at = now() WHERE id = $1`, id, status)
+	return err
+}
+
+func (s *PostgresStore) PendingRecipients(id int64, limit int) ([]CampaignRecipient, error) {
+	return s.ListRecipients(id, "pending", limit)
+}
+
+func (s *PostgresStore) ListRecipients(id int64, status string, limit int) ([]CampaignRecipient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT campaign_id, wa_id, vars, status, message_id, error, updated_at
+		FROM campaign_recipients
+		WHERE campaign_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY wa_id
+		LIMIT $3`, id, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CampaignRecipient
+	for rows.Next() {
+		var r CampaignRecipient
+		var vars []byte
+		if err := rows.Scan(&r.CampaignID, &r.WaID, &vars, &r.Status, &r.MessageID, &r.Error, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(vars, &r.Vars)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) UpdateRecipient(id int64, waID, status, messageID, errMsg string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE campaign_recipients SET status = $3, message_id = $4, error = $5, updated_at = now()
+		WHERE campaign_id = $1 AND wa_id = $2`,
+		id, waID, status, messageID, errMsg)
+	return err
+}
+
+func (s *PostgresStore) SkipPending(id int64, reason string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE campaign_recipients SET status = 'skipped', error = $2, updated_at = now()
+		WHERE campaign_id = $1 AND status = 'pending'`, id, reason)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (s *PostgresStore) RecordCampaignStatus(messageID, status, errMsg string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE campaign_recipients
+		SET status = $2, error = CASE WHEN $2 = 'failed' THEN $3 ELSE error END, updated_at = now()
+		WHERE message_id = $1 AND `+campaignStatusRankSQL+` <= $4`,
+		messageID, status, errMsg, deliveryStatusRank(status))
+	return err
+}
+
+func (s *PostgresStore) DeleteRecipients(tenant, waID string) (int, error) {
+	return s.execCount(`
+		DELETE FROM campaign_recipients
+		WHERE wa_id = $2 AND campaign_id IN (SELECT id FROM campaigns WHERE tenant = $1)`,
+		tenant, waID)
+}
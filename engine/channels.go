@@ -0,0 +1,339 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"flowly/wa"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ---------------------
+// Messenger / Instagram (Meta Messaging)
+// ---------------------
+// La misma app de Meta puede suscribir el webhook a páginas de Facebook (object "page")
+// y cuentas de Instagram (object "instagram"). Los eventos se convierten a IncomingMessage
+// y pasan por el mismo state machine que WhatsApp.
+//
+// El usuario se identifica con el canal como prefijo ("messenger:<PSID>", "instagram:<IGSID>")
+// para que las sesiones no choquen con wa_ids.
+//
+// Messenger/Instagram no tienen listas ni botones de respuesta como WhatsApp: ambos se mandan
+// como texto + quick replies (máx 13, títulos de hasta 20 caracteres).
+//
+// ENV:
+//
+//	TENANT_BY_PAGE_ID=1234567890:broker,1784...:demo_medical   (page_id / instagram account id)
+//	META_PAGE_TOKEN=EAAG...                                   (page access token)
+//	META_PAGE_TOKEN_1234567890=EAAG...                        (override por página)
+
+const (
+	channelMessenger = "messenger"
+	channelInstagram = "instagram"
+
+	maxQuickReplies     = 13
+	maxQuickReplyTitle  = 20
+	maxMessengerTextLen = 2000
+)
+
+type MessagingWebhookPayload struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID        string           `json:"id"`
+		Messaging []MessagingEvent `json:"messaging"`
+	} `json:"entry"`
+}
+
+type MessagingEvent struct {
+	Sender struct {
+		ID string `json:"id"`
+	} `json:"sender"`
+	Recipient struct {
+		ID string `json:"id"`
+	} `json:"recipient"`
+	Timestamp int64 `json:"timestamp"`
+	Message   *struct {
+		Mid        string `json:"mid"`
+		Text       string `json:"text"`
+		IsEcho     bool   `json:"is_echo"`
+		QuickReply *struct {
+			Payload string `json:"payload"`
+		} `json:"quick_reply,omitempty"`
+		ReplyTo *struct {
+			Mid string `json:"mid"`
+		} `json:"reply_to,omitempty"`
+	} `json:"message,omitempty"`
+	Postback *struct {
+		Mid     string `json:"mid"`
+		Title   string `json:"title"`
+		Payload string `json:"payload"`
+	} `json:"postback,omitempty"`
+}
+
+// channelForObject traduce el "object" del webhook al nombre del canal.
+func channelForObject(object string) string {
+	if object == "instagram" {
+		return channelInstagram
+	}
+	return channelMessenger
+}
+
+// toIncomingMessage convierte un evento de Messenger/Instagram al formato común.
+// Devuelve ok=false para eventos que no hay que procesar (echos, reads, reacciones, etc.).
+func (ev MessagingEvent) toIncomingMessage(channel string) (IncomingMessage, bool) {
+	msg := IncomingMessage{
+		From:      channel + ":" + ev.Sender.ID,
+		Timestamp: fmt.Sprintf("%d", ev.Timestamp/1000),
+	}
+
+	switch {
+	case ev.Postback != nil:
+		msg.ID = ev.Postback.Mid
+		msg.Type = "interactive"
+		msg.Interactive = &IncomingInteractive{
+			Type:        "button_reply",
+			ButtonReply: &IncomingButtonReply{ID: ev.Postback.Payload, Title: ev.Postback.Title},
+		}
+	case ev.Message != nil && !ev.Message.IsEcho:
+		msg.ID = ev.Message.Mid
+		if ev.Message.ReplyTo != nil && ev.Message.ReplyTo.Mid != "" {
+			msg.Context = &IncomingContext{ID: ev.Message.ReplyTo.Mid}
+		}
+		if ev.Message.QuickReply != nil {
+			msg.Type = "interactive"
+			msg.Interactive = &IncomingInteractive{
+				Type:        "button_reply",
+				ButtonReply: &IncomingButtonReply{ID: ev.Message.QuickReply.Payload, Title: ev.Message.Text},
+			}
+			break
+		}
+		if ev.Message.Text == "" {
+			// adjuntos sin texto: por ahora no los soportamos
+			return IncomingMessage{}, false
+		}
+		msg.Type = "text"
+		msg.Text = &IncomingText{Body: ev.Message.Text}
+	default:
+		return IncomingMessage{}, false
+	}
+	return msg, true
+}
+
+// handleMessagingWebhook procesa un webhook de object "page" o "instagram".
+func (a *App) handleMessagingWebhook(ctx context.Context, object string, rawBody []byte, forcedTenant string) {
+	var payload MessagingWebhookPayload
+	if err := json.Unmarshal(rawBody, &payload); err != nil {
+		log.Printf("ERROR unmarshal (%s): %v", object, err)
+		return
+	}
+	channel := channelForObject(object)
+
+	for _, e := range payload.Entry {
+		tenant := a.resolver.ResolvePage(e.ID)
+		if forcedTenant != "" {
+			tenant = forcedTenant
+		}
+
+		client, err := a.metaMessagingClient(channel, e.ID, tenant)
+		if err != nil {
+			log.Printf("ERROR %s client: %v", channel, err)
+			continue
+		}
+
+		for _, ev := range e.Messaging {
+			msg, ok := ev.toIncomingMessage(channel)
+			if !ok {
+				continue
+			}
+			a.handleIncoming(ctx, tenant, client, msg, "")
+		}
+	}
+}
+
+// ---------------------
+// Send API client
+// ---------------------
+
+type MetaMessagingClient struct {
+	channel string
+	token   string
+	api     wa.GraphAPI // versión de la Graph API (ver graph_version.go)
+	retry   wa.RetryPolicy
+
+	tenant     string
+	store      *PostgresStore
+	limiter    *OutboundLimiter
+	httpClient *http.Client
+	privacy    *FlowPrivacy // qué no guardar en el log de mensajes (ver logging.go)
+}
+
+func pageAccessToken(pageID string) string {
+	if t := strings.TrimSpace(os.Getenv("META_PAGE_TOKEN_" + pageID)); t != "" {
+		return t
+	}
+	return strings.TrimSpace(os.Getenv("META_PAGE_TOKEN"))
+}
+
+func NewMetaMessagingClient(channel, pageID string) (*MetaMessagingClient, error) {
+	token := pageAccessToken(pageID)
+	if token == "" {
+		return nil, errors.New("META_PAGE_TOKEN no seteado")
+	}
+	return &MetaMessagingClient{
+		channel: channel,
+		token:   token,
+		api:     wa.NewGraphAPI(""),
+		retry:   wa.RetryPolicyFromEnv(),
+	}, nil
+}
+
+// metaMessagingClient arma el cliente de Messenger/Instagram con las dependencias de la App.
+func (a *App) metaMessagingClient(channel, pageID, tenant string) (*MetaMessagingClient, error) {
+	c, err := NewMetaMessagingClient(channel, pageID)
+	if err != nil {
+		return nil, err
+	}
+	if v := a.apps.graphVersion(tenant); v != "" {
+		c.api = wa.NewGraphAPI(v)
+	}
+	c.tenant = tenant
+	c.store = a.store
+	c.limiter = a.limiter
+	c.httpClient = a.httpClient
+	if cfg, err := a.cache.Load(tenant); err == nil {
+		c.privacy = cfg.Privacy
+	}
+	return c, nil
+}
+
+// recipientID saca el prefijo del canal ("messenger:123" -> "123").
+func (c *MetaMessagingClient) recipientID(to string) string {
+	return strings.TrimPrefix(to, c.channel+":")
+}
+
+func (c *MetaMessagingClient) SendText(ctx context.Context, to string, body string) error {
+	return c.post(ctx, to, "text", body, map[string]any{"text": truncateRunes(body, maxMessengerTextLen)})
+}
+
+func (c *MetaMessagingClient) SendList(ctx context.Context, to string, headerText, headerImageURL, body, footer, buttonText string, sections []wa.Section) error {
+	var options []wa.Button
+	for _, sec := range sections {
+		for _, row := range sec.Rows {
+			options = append(options, wa.Button{ID: row.ID, Title: row.Title})
+		}
+	}
+	return c.sendQuickReplies(ctx, to, headerText, headerImageURL, body, footer, options)
+}
+
+func (c *MetaMessagingClient) SendButtons(ctx context.Context, to string, headerText, headerImageURL, body, footer string, buttons []wa.Button) error {
+	return c.sendQuickReplies(ctx, to, headerText, headerImageURL, body, footer, buttons)
+}
+
+func (c *MetaMessagingClient) SendImage(ctx context.Context, to string, imageURL, caption string) error {
+	if err := c.post(ctx, to, "image", imageURL, imageAttachment(imageURL)); err != nil {
+		return err
+	}
+	if caption == "" {
+		return nil
+	}
+	return c.SendText(ctx, to, caption)
+}
+
+func imageAttachment(imageURL string) map[string]any {
+	return map[string]any{
+		"attachment": map[string]any{
+			"type":    "image",
+			"payload": map[string]any{"url": imageURL, "is_reusable": true},
+		},
+	}
+}
+
+func (c *MetaMessagingClient) sendQuickReplies(ctx context.Context, to string, headerText, headerImageURL, body, footer string, options []wa.Button) error {
+	if headerImageURL != "" {
+		if err := c.post(ctx, to, "image", headerImageURL, imageAttachment(headerImageURL)); err != nil {
+			return err
+		}
+	}
+
+	parts := []string{}
+	if headerText != "" {
+		parts = append(parts, headerText)
+	}
+	parts = append(parts, body)
+	if footer != "" {
+		parts = append(parts, footer)
+	}
+	text := truncateRunes(strings.Join(parts, "\n\n"), maxMessengerTextLen)
+
+	if len(options) > maxQuickReplies {
+		log.Printf("⚠️ %s: %d opciones, se mandan solo las primeras %d", c.channel, len(options), maxQuickReplies)
+		options = options[:maxQuickReplies]
+	}
+	qr := make([]map[string]any, 0, len(options))
+	for _, o := range options {
+		qr = append(qr, map[string]any{
+			"content_type": "text",
+			"title":        truncateRunes(o.Title, maxQuickReplyTitle),
+			"payload":      o.ID,
+		})
+	}
+
+	message := map[string]any{"text": text}
+	if len(qr) > 0 {
+		message["quick_replies"] = qr
+	}
+	return c.post(ctx, to, "quick_replies", text, message)
+}
+
+// post envía un mensaje por la Send API y lo registra en el log de mensajes.
+func (c *MetaMessagingClient) post(ctx context.Context, to, msgType, summary string, message map[string]any) error {
+	payload := map[string]any{
+		"recipient":      map[string]any{"id": c.recipientID(to)},
+		"messaging_type": "RESPONSE",
+		"message":        message,
+	}
+	b, _ := json.Marshal(payload)
+
+	ctx, span := startSpan(ctx, "meta.send", attribute.String("flowly.tenant", c.tenant), attribute.String("meta.channel", c.channel), attribute.String("meta.message_type", msgType))
+	body, err := wa.PostWithRetry(ctx, httpClientOrShared(c.httpClient), c.api.URL("me", "messages"), c.token, b, c.retry, c.limiter, c.tenant)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ Enviado OK (%s): %s", c.channel, string(body))
+
+	var out struct {
+		MessageID string `json:"message_id"`
+	}
+	_ = json.Unmarshal(body, &out)
+
+	entry := MessageLogEntry{
+		Tenant:    c.tenant,
+		WaID:      to,
+		Direction: "out",
+		MessageID: out.MessageID,
+		Type:      msgType,
+		Body:      summary,
+		Payload:   b,
+	}
+	c.privacy.minimize(&entry)
+	if err := c.store.LogMessage(entry); err != nil {
+		log.Printf("ERROR guardando mensaje saliente: %v", err)
+	}
+	return nil
+}
+
+func truncateRunes(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max])
+}
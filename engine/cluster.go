@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Varias réplicas
+// ---------------------
+// Con REDIS_URL se puede correr el bot en varias réplicas detrás de un balanceador sin
+// sticky sessions, y si una se cae las demás siguen atendiendo. Las réplicas comparten:
+//
+//   - el dedup de webhooks (ver dedup.go)
+//   - el lock por usuario (ver session_locks.go): un usuario no se procesa en dos a la vez
+//   - las sesiones: con Redis la memoria deja de ser cache y cada mensaje lee la sesión de
+//     Postgres (otra réplica pudo haberla cambiado), así que hace falta DATABASE_URL
+//   - la invalidación de caches: publicar / rollback de un flow, arrancar o cortar un
+//     experimento, recargar el calendario o conectar Google se avisa por el canal
+//     flowly:invalidate de Redis y cada réplica descarta lo suyo. Lo mismo con el free/busy
+//     de un calendario cuando se reserva o llega una push notification de Google (si el
+//     canal de Google lo abrió otra réplica, el aviso se le reenvía), y con el catálogo de
+//     templates cuando Meta avisa un cambio (cada réplica lo vuelve a bajar).
+//
+// Los jobs ya se reparten entre réplicas con FOR UPDATE SKIP LOCKED (ver jobs.go). Los
+// flows versionados viven en disco, así que configs/ tiene que ser compartido (un volumen o
+// CONFIG_SOURCE, ver config_source.go). Si la suscripción se corta, al volver se descartan
+// todos los caches (los avisos del medio se perdieron).
+
+const (
+	clusterChannel     = "flowly:invalidate"
+	clusterPingEvery   = 30 * time.Second
+	clusterResubscribe = 5 * time.Second
+
+	clusterConfig       = "config"        // tenant
+	clusterCalendar     = "calendar"      // tenant
+	clusterBusy         = "busy"          // tenant, calendar_id
+	clusterCalendarPush = "calendar_push" // channel id, token (push de Google para otra réplica)
+	clusterTemplates    = "templates"     // tenant (resincronizar el catálogo de templates)
+)
+
+// notifyReplicas avisa a todas las réplicas (incluida esta) que descarten un cache.
+// Sin Redis no hace nada: el que llama ya actualizó lo suyo.
+func (a *App) notifyReplicas(kind string, args ...string) {
+	if a.redis == nil {
+		return
+	}
+	msg := strings.Join(append([]string{kind}, args...), "|")
+	if _, err := a.redis.do("PUBLISH", clusterChannel, msg); err != nil {
+		log.Printf("⚠️ no pude avisar a las otras réplicas (%s): %v", msg, err)
+	}
+}
+
+func (a *App) handleClusterMessage(msg string) {
+	parts := strings.Split(msg, "|")
+	switch {
+	case parts[0] == clusterConfig && len(parts) == 2:
+		a.cache.Invalidate(parts[1])
+	case parts[0] == clusterCalendar && len(parts) == 2:
+		a.calendars.Invalidate(parts[1])
+	case parts[0] == clusterBusy && len(parts) == 3:
+		a.calendars.busy.InvalidateLocal(parts[1], parts[2])
+	case parts[0] == clusterCalendarPush && len(parts) == 3:
+		a.calendarNotification(parts[1], parts[2], false)
+	case parts[0] == clusterTemplates && len(parts) == 2:
+		a.refreshTemplates(parts[1])
+	default:
+		log.Printf("⚠️ aviso entre réplicas desconocido: %q", msg)
+	}
+}
+
+// invalidateAll descarta los caches de todos los tenants.
+func (a *App) invalidateAll() {
+	for _, tenant := range a.resolver.Tenants() {
+		a.cache.Invalidate(tenant)
+		a.calendars.Invalidate(tenant)
+	}
+	a.calendars.busy.InvalidateAll()
+}
+
+// runClusterSubscriber escucha los avisos de las otras réplicas hasta que se cancele ctx.
+func (a *App) runClusterSubscriber(ctx context.Context) {
+	if a.redis == nil {
+		return
+	}
+	sub := a.redis.clone()
+	subscribed := false
+	for {
+		err := sub.subscribe(ctx, clusterChannel, func() {
+			if subscribed {
+				log.Printf("🔁 suscripción a %s recuperada, descarto los caches", clusterChannel)
+				a.invalidateAll()
+			}
+			subscribed = true
+		}, a.handleClusterMessage)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("⚠️ suscripción a Redis (%s) cortada, reintento: %v", clusterChannel, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(clusterResubscribe):
+		}
+	}
+}
+
+// subscribe se suscribe a channel y llama a fn con cada mensaje hasta que la conexión se
+// corte (devuelve el error) o se cancele ctx (devuelve nil). ready corre una vez suscripto.
+// Usa su propia conexión: una conexión suscripta no acepta otros comandos.
+func (c *redisClient) subscribe(ctx context.Context, channel string, ready func(), fn func(msg string)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.closeLocked()
+
+	if _, err := c.doLocked("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	conn := c.conn
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	ready()
+
+	// Sin tráfico, un PING cada clusterPingEvery detecta una conexión muerta
+	pinged := false
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(clusterPingEvery))
+		reply, err := c.readReplyLocked()
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() && !pinged && ctx.Err() == nil {
+			_ = conn.SetWriteDeadline(time.Now().Add(redisTimeout))
+			if err := c.writeCommandLocked("PING"); err != nil {
+				return err
+			}
+			pinged = true
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pinged = false
+		if items, ok := reply.([]any); ok && len(items) == 3 && items[0] == "message" {
+			if msg, ok := items[2].(string); ok {
+				fn(msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// CTA URL y catálogo
+// ---------------------
+// Tipos de estado para e-commerce, sobre el catálogo de Meta del tenant:
+//
+//	"VER_WEB": {
+//	  "type": "cta_url",
+//	  "body": "Mirá todos los modelos en nuestra web",
+//	  "cta": { "display_text": "Abrir tienda", "url": "https://tienda.com/?ref={{wa_id}}" }
+//	},
+//	"PRODUCTO": {
+//	  "type": "product",
+//	  "body": "Este es el más vendido 👇",
+//	  "catalog": { "product_id": "SKU-123" }
+//	},
+//	"OFERTAS": {
+//	  "type": "product_list",
+//	  "body": "Ofertas de la semana",
+//	  "catalog": {
+//	    "header": "Ofertas",
+//	    "sections": [{ "title": "Zapatillas", "product_ids": ["SKU-1", "SKU-2"] }]
+//	  },
+//	  "on_order_next": "CHECKOUT"
+//	},
+//	"CATALOGO": { "type": "catalog", "body": "Nuestro catálogo completo", "catalog": { "thumbnail_product_id": "SKU-1" } }
+//
+// El catalog_id sale de "catalog_id" en el flow.json (o del estado). Cuando el usuario manda
+// un carrito (mensaje "order") se va a on_order_next con order_items, order_total y
+// order_summary en las variables.
+
+const (
+	maxCTADisplayText   = 20
+	maxCatalogProducts  = 30
+	maxCatalogSections  = 10
+	ctaURLStateType     = "cta_url"
+	productStateType    = "product"
+	productListType     = "product_list"
+	catalogStateType    = "catalog"
+	orderItemsVar       = "order_items"
+	orderTotalVar       = "order_total"
+	orderSummaryVar     = "order_summary"
+	orderCurrencyVar    = "order_currency"
+	orderCatalogIDVar   = "order_catalog_id"
+	maxOrderSummaryRows = 20
+)
+
+type FlowCTA struct {
+	Header      string `json:"header,omitempty"`
+	Footer      string `json:"footer,omitempty"`
+	DisplayText string `json:"display_text"`
+	URL         string `json:"url"`
+}
+
+type FlowCatalog struct {
+	CatalogID          string               `json:"catalog_id,omitempty"` // default: catalog_id del flow
+	Header             string               `json:"header,omitempty"`
+	Footer             string               `json:"footer,omitempty"`
+	ProductID          string               `json:"product_id,omitempty"`           // type product
+	Sections           []FlowProductSection `json:"sections,omitempty"`             // type product_list
+	ThumbnailProductID string               `json:"thumbnail_product_id,omitempty"` // type catalog
+}
+
+type FlowProductSection struct {
+	Title      string   `json:"title"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+type IncomingOrder struct {
+	CatalogID    string              `json:"catalog_id"`
+	Text         string              `json:"text,omitempty"`
+	ProductItems []IncomingOrderItem `json:"product_items"`
+}
+
+type IncomingOrderItem struct {
+	ProductRetailerID string  `json:"product_retailer_id"`
+	Quantity          int     `json:"quantity"`
+	ItemPrice         float64 `json:"item_price"`
+	Currency          string  `json:"currency"`
+}
+
+func validateCommerceState(cfg FlowConfig, stateName string, st FlowState) []string {
+	var errs []string
+	switch st.Type {
+	case ctaURLStateType:
+		c := st.CTA
+		if c == nil {
+			return []string{fmt.Sprintf("state=%s es cta_url pero cta es nil", stateName)}
+		}
+		if strings.TrimSpace(st.Body) == "" {
+			errs = append(errs, fmt.Sprintf("state=%s cta_url necesita body", stateName))
+		}
+		if strings.TrimSpace(c.DisplayText) == "" || runeLen(c.DisplayText) > maxCTADisplayText {
+			errs = append(errs, fmt.Sprintf("state=%s cta.display_text vacío o > %d: %q", stateName, maxCTADisplayText, c.DisplayText))
+		}
+		// La URL puede ser una variable entera, ej: "{{payment_url}}" (ver payments.go)
+		if strings.HasPrefix(strings.TrimSpace(c.URL), "{{") {
+			break
+		}
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("state=%s cta.url inválida: %q", stateName, c.URL))
+		}
+
+	case productStateType, productListType, catalogStateType:
+		c := st.Catalog
+		if c == nil {
+			return []string{fmt.Sprintf("state=%s es %s pero catalog es nil", stateName, st.Type)}
+		}
+		if st.Type != catalogStateType && c.CatalogID == "" && cfg.CatalogID == "" {
+			errs = append(errs, fmt.Sprintf("state=%s sin catalog_id (ni en el estado ni en el flow)", stateName))
+		}
+		switch st.Type {
+		case productStateType:
+			if c.ProductID == "" {
+				errs = append(errs, fmt.Sprintf("state=%s product necesita catalog.product_id", stateName))
+			}
+		case productListType:
+			if strings.TrimSpace(c.Header) == "" {
+				errs = append(errs, fmt.Sprintf("state=%s product_list necesita catalog.header", stateName))
+			}
+			if strings.TrimSpace(st.Body) == "" {
+				errs = append(errs, fmt.Sprintf("state=%s product_list necesita body", stateName))
+			}
+			total := 0
+			for _, sec := range c.Sections {
+				total += len(sec.ProductIDs)
+				if strings.TrimSpace(sec.Title) == "" || runeLen(sec.Title) > 24 {
+					errs = append(errs, fmt.Sprintf("state=%s catalog section title vacío o > 24: %q", stateName, sec.Title))
+				}
+			}
+			if len(c.Sections) == 0 || len(c.Sections) > maxCatalogSections {
+				errs = append(errs, fmt.Sprintf("state=%s product_list necesita entre 1 y %d secciones", stateName, maxCatalogSections))
+			}
+			if total == 0 || total > maxCatalogProducts {
+				errs = append(errs, fmt.Sprintf("state=%s product_list necesita entre 1 y %d productos (%d)", stateName, maxCatalogProducts, total))
+			}
+		case catalogStateType:
+			if strings.TrimSpace(st.Body) == "" {
+				errs = append(errs, fmt.Sprintf("state=%s catalog necesita body", stateName))
+			}
+		}
+	}
+	return errs
+}
+
+// catalogMessage arma el mensaje de productos del estado con las variables aplicadas.
+func catalogMessage(cfg FlowConfig, st FlowState, vars map[string]string) wa.CatalogMessage {
+	c := st.Catalog
+	m := wa.CatalogMessage{
+		Kind:               st.Type,
+		CatalogID:          c.CatalogID,
+		Header:             renderVars(c.Header, vars),
+		Body:               renderVars(st.Body, vars),
+		Footer:             renderVars(c.Footer, vars),
+		ProductID:          renderVars(c.ProductID, vars),
+		ThumbnailProductID: renderVars(c.ThumbnailProductID, vars),
+	}
+	if m.CatalogID == "" {
+		m.CatalogID = cfg.CatalogID
+	}
+	for _, sec := range c.Sections {
+		ns := wa.ProductSection{Title: renderVars(sec.Title, vars)}
+		for _, id := range sec.ProductIDs {
+			ns.ProductIDs = append(ns.ProductIDs, renderVars(id, vars))
+		}
+		m.Sections = append(m.Sections, ns)
+	}
+	return m
+}
+
+// orderVars resume un carrito para usarlo en el flow.
+func orderVars(o *IncomingOrder) map[string]string {
+	var total float64
+	currency := ""
+	lines := make([]string, 0, len(o.ProductItems))
+	for i, it := range o.ProductItems {
+		total += it.ItemPrice * float64(it.Quantity)
+		if currency == "" {
+			currency = it.Currency
+		}
+		if i < maxOrderSummaryRows {
+			lines = append(lines, fmt.Sprintf("%d x %s", it.Quantity, it.ProductRetailerID))
+		}
+	}
+	return map[string]string{
+		orderItemsVar:     strconv.Itoa(len(o.ProductItems)),
+		orderTotalVar:     strconv.FormatFloat(total, 'f', 2, 64),
+		orderCurrencyVar:  currency,
+		orderSummaryVar:   strings.Join(lines, "\n"),
+		orderCatalogIDVar: o.CatalogID,
+	}
+}
+
+// ---------------------
+// Messenger / Instagram (no tienen estos tipos: se degrada a texto)
+// ---------------------
+
+func (c *MetaMessagingClient) SendCTAURL(ctx context.Context, to string, headerText, headerImageURL, body, footer, displayText, link string) error {
+	parts := []string{}
+	if headerText != "" {
+		parts = append(parts, headerText)
+	}
+	parts = append(parts, body, displayText+": "+link)
+	if footer != "" {
+		parts = append(parts, footer)
+	}
+	if headerImageURL != "" {
+		if err := c.post(ctx, to, "image", headerImageURL, imageAttachment(headerImageURL)); err != nil {
+			return err
+		}
+	}
+	return c.SendText(ctx, to, strings.Join(parts, "\n\n"))
+}
+
+func (c *MetaMessagingClient) SendCatalog(ctx context.Context, to string, m wa.CatalogMessage) error {
+	log.Printf("⚠️ %s no soporta mensajes de catálogo (%s), mando solo el texto", c.channel, m.Kind)
+	text := strings.TrimSpace(strings.Join([]string{m.Header, m.Body, m.Footer}, "\n\n"))
+	if text == "" {
+		return nil
+	}
+	return c.SendText(ctx, to, text)
+}
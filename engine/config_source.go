@@ -0,0 +1,450 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// ---------------------
+// Configs desde object storage
+// ---------------------
+// Con CONFIG_SOURCE los configs de los tenants (flow.json, versions/, calendar.json,
+// assets/...) salen de un bucket en vez de venir horneados en la imagen. El bucket se
+// espeja en configs/ (que funciona como cache local) al arrancar y cada
+// CONFIG_REFRESH_SECONDS; solo se bajan los objetos cuyo ETag cambió, y los tenants tocados
+// se invalidan del ConfigCache para que el próximo mensaje use la config nueva.
+//
+// Los objetos borrados del bucket no se borran del disco, y lo que se escribe por la API
+// admin (versiones del flow) queda solo en local.
+//
+// ENV:
+//
+//	CONFIG_SOURCE=s3://mi-bucket/flowly/configs     (o gs://mi-bucket/flowly/configs)
+//	CONFIG_REFRESH_SECONDS=60
+//	AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN / AWS_REGION
+//	S3_ENDPOINT=https://<account>.r2.cloudflarestorage.com   (S3 compatible, path-style)
+//	GOOGLE_APPLICATION_CREDENTIALS=...                        (gs://, o credenciales del entorno)
+
+const defaultConfigRefresh = 60 * time.Second
+
+type remoteObject struct {
+	Key  string
+	ETag string
+}
+
+// ObjectStore lista y baja objetos de un bucket.
+type ObjectStore interface {
+	List(ctx context.Context, prefix string) ([]remoteObject, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+type ConfigSyncer struct {
+	source string
+	store  ObjectStore
+	prefix string
+	dir    string
+
+	mu    sync.Mutex
+	etags map[string]string // key -> ETag ya espejado
+}
+
+// NewConfigSyncerFromEnv devuelve nil si CONFIG_SOURCE no está seteado.
+func NewConfigSyncerFromEnv(ctx context.Context, httpClient *http.Client) (*ConfigSyncer, error) {
+	source := strings.TrimSpace(os.Getenv("CONFIG_SOURCE"))
+	if source == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("CONFIG_SOURCE inválido: %q", source)
+	}
+	prefix := strings.Trim(u.Path, "/")
+
+	var store ObjectStore
+	switch u.Scheme {
+	case "s3":
+		store, err = newS3ObjectStore(u.Host, httpClient)
+	case "gs":
+		store, err = newGCSObjectStore(ctx, u.Host)
+	default:
+		return nil, fmt.Errorf("CONFIG_SOURCE: esquema no soportado %q (s3 | gs)", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigSyncer{source: source, store: store, prefix: prefix, dir: ConfigRoot, etags: make(map[string]string)}, nil
+}
+
+// Sync espeja los objetos que cambiaron y devuelve los tenants afectados.
+func (s *ConfigSyncer) Sync(ctx context.Context) ([]string, error) {
+	listPrefix := s.prefix
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+	objects, err := s.store.List(ctx, listPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make(map[string]bool)
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.Key, listPrefix)
+		if rel == "" || strings.HasSuffix(rel, "/") || s.etags[obj.Key] == obj.ETag {
+			continue
+		}
+		local := filepath.Join(s.dir, filepath.FromSlash(rel))
+		if relPath, err := filepath.Rel(s.dir, local); err != nil || strings.HasPrefix(relPath, "..") {
+			log.Printf("⚠️ config remota ignorada (path fuera de %s): %s", s.dir, obj.Key)
+			continue
+		}
+		b, err := s.store.Get(ctx, obj.Key)
+		if err != nil {
+			return sortedKeys(changed), fmt.Errorf("bajando %s: %w", obj.Key, err)
+		}
+		if err := writeFileAtomic(local, b); err != nil {
+			return sortedKeys(changed), err
+		}
+		s.etags[obj.Key] = obj.ETag
+		tenant, _, _ := strings.Cut(rel, "/")
+		changed[tenant] = true
+	}
+	return sortedKeys(changed), nil
+}
+
+// syncConfigs corre un Sync e invalida los tenants que cambiaron.
+func (a *App) syncConfigs(ctx context.Context) error {
+	tenants, err := a.configSync.Sync(ctx)
+	for _, t := range tenants {
+		a.cache.Invalidate(t)
+		log.Printf("☁️ tenant=%s config actualizada desde %s", t, a.configSync.source)
+		a.recordAudit(AuditEntry{Actor: systemAuditActor, Action: "config.sync", Tenant: t, Details: map[string]string{"source": a.configSync.source}})
+	}
+	return err
+}
+
+// runConfigSync refresca los configs remotos hasta que se cancele el context.
+func (a *App) runConfigSync(ctx context.Context) {
+	if a.configSync == nil {
+		return
+	}
+	every := time.Duration(envPositiveInt("CONFIG_REFRESH_SECONDS", int(defaultConfigRefresh/time.Second))) * time.Second
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sctx, cancel := context.WithTimeout(ctx, every)
+			if err := a.syncConfigs(sctx); err != nil {
+				log.Printf("ERROR refrescando configs de %s: %v", a.configSync.source, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// ---------------------
+// S3 (y compatibles), firmado con SigV4
+// ---------------------
+
+type s3ObjectStore struct {
+	bucket     string
+	endpoint   string // con S3_ENDPOINT: path-style
+	creds      awsCredentials
+	httpClient *http.Client
+}
+
+func newS3ObjectStore(bucket string, httpClient *http.Client) (*s3ObjectStore, error) {
+	s := &s3ObjectStore{
+		bucket:     bucket,
+		endpoint:   strings.TrimRight(strings.TrimSpace(os.Getenv("S3_ENDPOINT")), "/"),
+		creds:      awsCredentialsFromEnv(),
+		httpClient: httpClient,
+	}
+	if !s.creds.ok() {
+		return nil, fmt.Errorf("CONFIG_SOURCE s3:// necesita AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+// objectURL arma la URL del objeto (key "" = el bucket).
+func (s *s3ObjectStore) objectURL(key string) *url.URL {
+	u := &url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.creds.region + ".amazonaws.com", Path: "/" + key}
+	if s.endpoint != "" {
+		if eu, err := url.Parse(s.endpoint); err == nil {
+			u = &url.URL{Scheme: eu.Scheme, Host: eu.Host, Path: "/" + s.bucket + "/" + key}
+		}
+	}
+	u.RawPath = awsURIEncode(u.Path, false)
+	return u
+}
+
+func (s *s3ObjectStore) do(ctx context.Context, u *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.creds.sign(req, "s3", nil, time.Now())
+	resp, err := httpClientOrShared(s.httpClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("S3 %s: %s - %s", u.Path, resp.Status, truncateRunes(string(body), 300))
+	}
+	return body, nil
+}
+
+func (s *s3ObjectStore) List(ctx context.Context, prefix string) ([]remoteObject, error) {
+	var out []remoteObject
+	token := ""
+	for {
+		u := s.objectURL("")
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = awsCanonicalQuery(q)
+
+		body, err := s.do(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				ETag string `xml:"ETag"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &res); err != nil {
+			return nil, fmt.Errorf("respuesta inválida de S3: %w", err)
+		}
+		for _, c := range res.Contents {
+			out = append(out, remoteObject{Key: c.Key, ETag: strings.Trim(c.ETag, `"`)})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, s.objectURL(key))
+}
+
+// ---------------------
+// AWS Signature V4 (S3, Secrets Manager)
+// ---------------------
+
+type awsCredentials struct {
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func awsCredentialsFromEnv() awsCredentials {
+	c := awsCredentials{
+		region:       strings.TrimSpace(os.Getenv("AWS_REGION")),
+		accessKey:    strings.TrimSpace(os.Getenv("AWS_ACCESS_KEY_ID")),
+		secretKey:    strings.TrimSpace(os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		sessionToken: strings.TrimSpace(os.Getenv("AWS_SESSION_TOKEN")),
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	return c
+}
+
+func (c awsCredentials) ok() bool {
+	return c.accessKey != "" && c.secretKey != ""
+}
+
+// sign agrega los headers de AWS Signature V4 para service (body puede ser nil).
+func (c awsCredentials) sign(req *http.Request, service string, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	payloadHash := hex.EncodeToString(sha256Sum(body))
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for _, h := range []string{"content-type", "x-amz-date", "x-amz-content-sha256", "x-amz-security-token", "x-amz-target"} {
+		if v := req.Header.Get(h); v != "" {
+			headers[h] = v
+		}
+	}
+	names := sortedKeys(headers)
+	var canonHeaders strings.Builder
+	for _, n := range names {
+		canonHeaders.WriteString(n + ":" + strings.TrimSpace(headers[n]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sha256Sum([]byte(canonical)))
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEncode codifica como pide SigV4 (RFC 3986; "/" queda si no es un valor de query).
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsCanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(q.Get(k), true))
+	}
+	return strings.Join(parts, "&")
+}
+
+// ---------------------
+// Google Cloud Storage (JSON API)
+// ---------------------
+
+type gcsObjectStore struct {
+	bucket     string
+	httpClient *http.Client
+}
+
+func newGCSObjectStore(ctx context.Context, bucket string) (*gcsObjectStore, error) {
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_only")
+	if err != nil {
+		return nil, fmt.Errorf("CONFIG_SOURCE gs:// sin credenciales de Google: %w", err)
+	}
+	return &gcsObjectStore{bucket: bucket, httpClient: client}, nil
+}
+
+func (g *gcsObjectStore) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GCS: %s - %s", resp.Status, truncateRunes(string(body), 300))
+	}
+	return body, nil
+}
+
+func (g *gcsObjectStore) List(ctx context.Context, prefix string) ([]remoteObject, error) {
+	var out []remoteObject
+	pageToken := ""
+	for {
+		q := url.Values{"prefix": {prefix}, "fields": {"items(name,etag),nextPageToken"}}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		body, err := g.get(ctx, "https://storage.googleapis.com/storage/v1/b/"+url.PathEscape(g.bucket)+"/o?"+q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Items []struct {
+				Name string `json:"name"`
+				ETag string `json:"etag"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, fmt.Errorf("respuesta inválida de GCS: %w", err)
+		}
+		for _, it := range res.Items {
+			out = append(out, remoteObject{Key: it.Name, ETag: it.ETag})
+		}
+		if res.NextPageToken == "" {
+			return out, nil
+		}
+		pageToken = res.NextPageToken
+	}
+}
+
+func (g *gcsObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return g.get(ctx, "https://storage.googleapis.com/storage/v1/b/"+url.PathEscape(g.bucket)+"/o/"+url.PathEscape(key)+"?alt=media")
+}
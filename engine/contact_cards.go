@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Stickers y tarjetas de contacto
+// ---------------------
+// Dos tipos de estado más, pensados para cerrar una conversación:
+//
+//	"GRACIAS": {
+//	  "type": "sticker",
+//	  "body": "¡Gracias por escribirnos!",
+//	  "sticker": { "media_id": "1234567890" }
+//	},
+//	"CONTACTO": {
+//	  "type": "contacts",
+//	  "body": "Agendá nuestro número 👇",
+//	  "contacts": [{
+//	    "name": "Clínica Demo",
+//	    "org": { "company": "Clínica Demo", "title": "Recepción" },
+//	    "phones": [{ "phone": "+5491122334455", "type": "WORK", "wa_id": "5491122334455" }],
+//	    "emails": ["turnos@clinicademo.com"],
+//	    "url": "https://clinicademo.com"
+//	  }]
+//	}
+//
+// El body (opcional) se manda como texto antes. El sticker va por media_id (subido a Meta),
+// por media (un nombre de la biblioteca del tenant, ver media_library.go) o por url a un
+// .webp público. En Messenger/Instagram el sticker sale como imagen y la tarjeta
+// como texto.
+
+const (
+	stickerStateType  = "sticker"
+	contactsStateType = "contacts"
+)
+
+type FlowSticker struct {
+	MediaID string `json:"media_id,omitempty"`
+	Media   string `json:"media,omitempty"` // nombre en media.json
+	URL     string `json:"url,omitempty"`
+}
+
+type FlowContact struct {
+	Name      string             `json:"name"` // formatted_name
+	FirstName string             `json:"first_name,omitempty"`
+	LastName  string             `json:"last_name,omitempty"`
+	Org       *FlowContactOrg    `json:"org,omitempty"`
+	Phones    []FlowContactPhone `json:"phones"`
+	Emails    []string           `json:"emails,omitempty"`
+	URL       string             `json:"url,omitempty"`
+}
+
+type FlowContactOrg struct {
+	Company string `json:"company,omitempty"`
+	Title   string `json:"title,omitempty"`
+}
+
+type FlowContactPhone struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type,omitempty"`  // CELL | MAIN | WORK | HOME ...
+	WaID  string `json:"wa_id,omitempty"` // con wa_id WhatsApp muestra "Enviar mensaje"
+}
+
+func validateContactCardState(stateName string, st FlowState) []string {
+	var errs []string
+	switch st.Type {
+	case stickerStateType:
+		if st.Sticker == nil || (strings.TrimSpace(st.Sticker.MediaID) == "" && strings.TrimSpace(st.Sticker.Media) == "" && strings.TrimSpace(st.Sticker.URL) == "") {
+			errs = append(errs, fmt.Sprintf("state=%s sticker necesita media_id, media o url", stateName))
+		}
+	case contactsStateType:
+		if len(st.Contacts) == 0 {
+			errs = append(errs, fmt.Sprintf("state=%s contacts vacío", stateName))
+		}
+		for i, ct := range st.Contacts {
+			if strings.TrimSpace(ct.Name) == "" {
+				errs = append(errs, fmt.Sprintf("state=%s contacts[%d].name vacío", stateName, i))
+			}
+			if len(ct.Phones) == 0 {
+				errs = append(errs, fmt.Sprintf("state=%s contacts[%d] necesita al menos un teléfono", stateName, i))
+			}
+			for j, p := range ct.Phones {
+				if strings.TrimSpace(p.Phone) == "" {
+					errs = append(errs, fmt.Sprintf("state=%s contacts[%d].phones[%d].phone vacío", stateName, i, j))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// renderContacts arma las tarjetas del estado con las variables aplicadas.
+func renderContacts(contacts []FlowContact, vars map[string]string) []wa.Contact {
+	out := make([]wa.Contact, 0, len(contacts))
+	for _, ct := range contacts {
+		nc := wa.Contact{
+			Name:      renderVars(ct.Name, vars),
+			FirstName: renderVars(ct.FirstName, vars),
+			LastName:  renderVars(ct.LastName, vars),
+			URL:       renderVars(ct.URL, vars),
+		}
+		if ct.Org != nil {
+			nc.Org = &wa.ContactOrg{Company: renderVars(ct.Org.Company, vars), Title: renderVars(ct.Org.Title, vars)}
+		}
+		nc.Phones = make([]wa.ContactPhone, len(ct.Phones))
+		for i, p := range ct.Phones {
+			nc.Phones[i] = wa.ContactPhone{Phone: renderVars(p.Phone, vars), Type: p.Type, WaID: renderVars(p.WaID, vars)}
+		}
+		nc.Emails = make([]string, len(ct.Emails))
+		for i, e := range ct.Emails {
+			nc.Emails[i] = renderVars(e, vars)
+		}
+		out = append(out, nc)
+	}
+	return out
+}
+
+// contactText: la tarjeta como texto, para canales sin soporte.
+func contactText(ct wa.Contact) string {
+	lines := []string{ct.Name}
+	if ct.Org != nil && ct.Org.Company != "" && ct.Org.Company != ct.Name {
+		lines = append(lines, ct.Org.Company)
+	}
+	for _, p := range ct.Phones {
+		lines = append(lines, "📞 "+p.Phone)
+	}
+	for _, e := range ct.Emails {
+		lines = append(lines, "✉️ "+e)
+	}
+	if ct.URL != "" {
+		lines = append(lines, "🌐 "+ct.URL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ---------------------
+// Messenger / Instagram
+// ---------------------
+
+func (c *MetaMessagingClient) SendSticker(ctx context.Context, to, mediaID, link string) error {
+	if link == "" {
+		log.Printf("ℹ️ %s no puede mandar stickers por media_id de WhatsApp, lo salteo", c.channel)
+		return nil
+	}
+	return c.post(ctx, to, "image", link, imageAttachment(link))
+}
+
+func (c *MetaMessagingClient) SendContacts(ctx context.Context, to string, contacts []wa.Contact) error {
+	parts := make([]string, 0, len(contacts))
+	for _, ct := range contacts {
+		parts = append(parts, contactText(ct))
+	}
+	return c.SendText(ctx, to, strings.Join(parts, "\n\n"))
+}
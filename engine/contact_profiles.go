@@ -0,0 +1,435 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Perfiles de contacto
+// ---------------------
+// Por tenant se guarda lo que se sabe de cada usuario: el nombre del perfil de WhatsApp,
+// los datos que dejó (email, DNI u otros), tags y la última interacción. En los textos del
+// flow quedan como {{contact.name}}, {{contact.email}}, {{contact.dni}}, {{contact.tags}},
+// {{contact.last_seen}} y {{contact.<campo>}}.
+//
+// Un campo de form con "contact" guarda la respuesta en el perfil, y si el perfil ya tiene
+// ese dato la pregunta se saltea (el valor pasa directo a la variable del form):
+//
+//	{ "name": "form_email", "prompt": "¿Email?", "validate": "email", "contact": "email" }
+//
+// Admin:
+//
+//	GET    /admin/tenants/{tenant}/contacts?limit=100&tag=vip
+//	GET    /admin/tenants/{tenant}/contacts/{wa_id}
+//	PUT    /admin/tenants/{tenant}/contacts/{wa_id}    { "email": "...", "tags": ["vip"], "fields": { "plan": "oro" } }
+//	DELETE /admin/tenants/{tenant}/contacts/{wa_id}    (borra todos sus datos, ver retention.go)
+
+const (
+	contactVarPrefix        = "contact."
+	defaultContactListLimit = 100
+)
+
+type ContactProfile struct {
+	Tenant    string            `json:"tenant"`
+	WaID      string            `json:"wa_id"`
+	Name      string            `json:"name,omitempty"`
+	Email     string            `json:"email,omitempty"`
+	DNI       string            `json:"dni,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+}
+
+// Get devuelve un dato del perfil por nombre (name, email, dni o un campo libre).
+func (p ContactProfile) Get(field string) string {
+	switch field {
+	case "name":
+		return p.Name
+	case "email":
+		return p.Email
+	case "dni":
+		return p.DNI
+	}
+	return p.Fields[field]
+}
+
+// set asigna un dato del perfil por nombre.
+func (p *ContactProfile) set(field, value string) {
+	switch field {
+	case "name":
+		p.Name = value
+	case "email":
+		p.Email = value
+	case "dni":
+		p.DNI = value
+	default:
+		if p.Fields == nil {
+			p.Fields = make(map[string]string)
+		}
+		p.Fields[field] = value
+	}
+}
+
+// contactVars arma las variables {{contact.*}} del perfil.
+func contactVars(p ContactProfile) map[string]string {
+	vars := map[string]string{
+		contactVarPrefix + "name":  p.Name,
+		contactVarPrefix + "email": p.Email,
+		contactVarPrefix + "dni":   p.DNI,
+		contactVarPrefix + "tags":  strings.Join(p.Tags, ","),
+	}
+	if !p.LastSeen.IsZero() {
+		vars[contactVarPrefix+"last_seen"] = p.LastSeen.Format(time.RFC3339)
+	}
+	for k, v := range p.Fields {
+		vars[contactVarPrefix+k] = v
+	}
+	return vars
+}
+
+type ContactStore interface {
+	// TouchContact registra que el usuario escribió (y el nombre de perfil, si vino).
+	TouchContact(tenant, waID, name string) error
+	GetContact(tenant, waID string) (ContactProfile, bool, error)
+	// UpdateContactFields mergea datos (name, email, dni o campos libres) en el perfil.
+	UpdateContactFields(tenant, waID string, fields map[string]string) error
+	// SaveContact reemplaza los datos editables del perfil (name, email, dni, tags, fields).
+	SaveContact(p ContactProfile) error
+	DeleteContact(tenant, waID string) (bool, error)
+	ListContacts(tenant, tag string, limit int) ([]ContactProfile, error)
+}
+
+func NewContactStore(store *PostgresStore) ContactStore {
+	if store != nil {
+		return store
+	}
+	return &memoryContactStore{contacts: make(map[string]ContactProfile)}
+}
+
+// loadContactVars suma las variables {{contact.*}} del usuario a vars.
+func (a *App) loadContactVars(tenant, waID string, vars map[string]string) {
+	p, ok, err := a.contacts.GetContact(tenant, waID)
+	if err != nil {
+		log.Printf("ERROR leyendo perfil de contacto wa_id=%s: %v", waID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	for k, v := range contactVars(p) {
+		vars[k] = v
+	}
+}
+
+// nextUnknownFormField devuelve el primer campo desde idx que el perfil no tiene,
+// completando en la sesión los que sí tiene. len(fields) = no falta ninguno.
+func nextUnknownFormField(fields []FlowFormField, idx int, p ContactProfile, sess *UserSession, vars map[string]string) int {
+	for ; idx < len(fields); idx++ {
+		fld := fields[idx]
+		if fld.Contact == "" {
+			return idx
+		}
+		v := p.Get(fld.Contact)
+		if v == "" {
+			return idx
+		}
+		setSessionVar(sess, vars, fld.Name, v)
+		vars[contactVarPrefix+fld.Contact] = v
+	}
+	return idx
+}
+
+// prefillFormFromContact arranca un form salteando lo que el perfil ya sabe. Devuelve
+// true si no hace falta preguntar nada.
+func (a *App) prefillFormFromContact(tenant, waID string, st FlowState, sess *UserSession, vars map[string]string) bool {
+	if st.Form == nil {
+		return false
+	}
+	p, _, err := a.contacts.GetContact(tenant, waID)
+	if err != nil {
+		log.Printf("ERROR leyendo perfil de contacto wa_id=%s: %v", waID, err)
+		return false
+	}
+	idx := nextUnknownFormField(st.Form.Fields, 0, p, sess, vars)
+	if idx >= len(st.Form.Fields) {
+		return true
+	}
+	if idx > 0 {
+		setSessionVar(sess, vars, formFieldVar, strconv.Itoa(idx))
+		setSessionVar(sess, vars, formStartVar, strconv.Itoa(idx))
+		log.Printf("📇 FORM: wa_id=%s ya tiene %d dato(s) en el perfil, arranco en %s", waID, idx, st.Form.Fields[idx].Name)
+	}
+	return false
+}
+
+// ---------------------
+// Admin endpoints
+// ---------------------
+
+func (a *App) handleAdminListContacts(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	contacts, err := a.contacts.ListContacts(tenant, r.URL.Query().Get("tag"), queryLimit(r, defaultContactListLimit, 1000))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tenant": tenant, "contacts": contacts})
+}
+
+func (a *App) handleAdminGetContact(w http.ResponseWriter, r *http.Request) {
+	p, ok, err := a.contacts.GetContact(r.PathValue("tenant"), r.PathValue("wa_id"))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "contacto no encontrado")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *App) handleAdminSaveContact(w http.ResponseWriter, r *http.Request) {
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+	var p ContactProfile
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	p.Tenant, p.WaID = tenant, waID
+	if err := a.contacts.SaveContact(p); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	saved, _, err := a.contacts.GetContact(tenant, waID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("🛠️ admin: perfil de contacto tenant=%s wa_id=%s actualizado", tenant, waID)
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryContactStore struct {
+	mu       sync.Mutex
+	contacts map[string]ContactProfile // tenant:wa_id -> perfil
+}
+
+// getLocked devuelve el perfil (o uno nuevo) con los mapas copiados.
+func (s *memoryContactStore) getLocked(tenant, waID string) ContactProfile {
+	p, ok := s.contacts[tenant+":"+waID]
+	if !ok {
+		now := time.Now()
+		return ContactProfile{Tenant: tenant, WaID: waID, FirstSeen: now, LastSeen: now}
+	}
+	fields := make(map[string]string, len(p.Fields))
+	for k, v := range p.Fields {
+		fields[k] = v
+	}
+	p.Fields = fields
+	p.Tags = append([]string(nil), p.Tags...)
+	return p
+}
+
+func (s *memoryContactStore) TouchContact(tenant, waID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.getLocked(tenant, waID)
+	if name != "" {
+		p.Name = name
+	}
+	p.LastSeen = time.Now()
+	s.contacts[tenant+":"+waID] = p
+	return nil
+}
+
+func (s *memoryContactStore) GetContact(tenant, waID string) (ContactProfile, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.contacts[tenant+":"+waID]; !ok {
+		return ContactProfile{}, false, nil
+	}
+	return s.getLocked(tenant, waID), true, nil
+}
+
+func (s *memoryContactStore) UpdateContactFields(tenant, waID string, fields map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.getLocked(tenant, waID)
+	for k, v := range fields {
+		p.set(k, v)
+	}
+	s.contacts[tenant+":"+waID] = p
+	return nil
+}
+
+func (s *memoryContactStore) SaveContact(in ContactProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.getLocked(in.Tenant, in.WaID)
+	p.Name, p.Email, p.DNI, p.Tags, p.Fields = in.Name, in.Email, in.DNI, in.Tags, in.Fields
+	s.contacts[in.Tenant+":"+in.WaID] = p
+	return nil
+}
+
+func (s *memoryContactStore) DeleteContact(tenant, waID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := tenant + ":" + waID
+	_, ok := s.contacts[key]
+	delete(s.contacts, key)
+	return ok, nil
+}
+
+func (s *memoryContactStore) ListContacts(tenant, tag string, limit int) ([]ContactProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []ContactProfile
+	for _, p := range s.contacts {
+		if p.Tenant == tenant && (tag == "" || containsString(p.Tags, tag)) {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+// TouchContact está en storage.go (es anterior a los perfiles).
+
+func splitContactFields(fields map[string]string) (name, email, dni string, extra map[string]string) {
+	extra = make(map[string]string)
+	for k, v := range fields {
+		switch k {
+		case "name":
+			name = v
+		case "email":
+			email = v
+		case "dni":
+			dni = v
+		default:
+			extra[k] = v
+		}
+	}
+	return name, email, dni, extra
+}
+
+func (s *PostgresStore) GetContact(tenant, waID string) (ContactProfile, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	p := ContactProfile{Tenant: tenant, WaID: waID}
+	var tags, fields []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT name, email, dni, tags, fields, first_seen, last_seen
+		FROM contacts
+		WHERE tenant = $1 AND wa_id = $2`,
+		tenant, waID,
+	).Scan(&p.Name, &p.Email, &p.DNI, &tags, &fields, &p.FirstSeen, &p.LastSeen)
+	if err == sql.ErrNoRows {
+		return ContactProfile{}, false, nil
+	}
+	if err != nil {
+		return ContactProfile{}, false, err
+	}
+	_ = json.Unmarshal(tags, &p.Tags)
+	_ = json.Unmarshal(fields, &p.Fields)
+	return p, true, nil
+}
+
+func (s *PostgresStore) UpdateContactFields(tenant, waID string, fields map[string]string) error {
+	name, email, dni, extra := splitContactFields(fields)
+	extraJSON, _ := json.Marshal(extra)
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO contacts (tenant, wa_id, name, email, dni, fields)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, wa_id) DO UPDATE
+		SET name   = CASE WHEN EXCLUDED.name  <> '' THEN EXCLUDED.name  ELSE contacts.name  END,
+		    email  = CASE WHEN EXCLUDED.email <> '' THEN EXCLUDED.email ELSE contacts.email END,
+		    dni    = CASE WHEN EXCLUDED.dni   <> '' THEN EXCLUDED.dni   ELSE contacts.dni   END,
+		    fields = contacts.fields || EXCLUDED.fields`,
+		tenant, waID, name, email, dni, extraJSON,
+	)
+	return err
+}
+
+func (s *PostgresStore) SaveContact(p ContactProfile) error {
+	tags, _ := json.Marshal(append([]string{}, p.Tags...))
+	fields := p.Fields
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fieldsJSON, _ := json.Marshal(fields)
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO contacts (tenant, wa_id, name, email, dni, tags, fields)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (tenant, wa_id) DO UPDATE
+		SET name = EXCLUDED.name, email = EXCLUDED.email, dni = EXCLUDED.dni,
+		    tags = EXCLUDED.tags, fields = EXCLUDED.fields`,
+		p.Tenant, p.WaID, p.Name, p.Email, p.DNI, tags, fieldsJSON,
+	)
+	return err
+}
+
+func (s *PostgresStore) DeleteContact(tenant, waID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM contacts WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *PostgresStore) ListContacts(tenant, tag string, limit int) ([]ContactProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT wa_id, name, email, dni, tags, fields, first_seen, last_seen
+		FROM contacts
+		WHERE tenant = $1 AND ($2 = '' OR tags ? $2)
+		ORDER BY last_seen DESC
+		LIMIT $3`,
+		tenant, tag, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ContactProfile
+	for rows.Next() {
+		p := ContactProfile{Tenant: tenant}
+		var tags, fields []byte
+		if err := rows.Scan(&p.WaID, &p.Name, &p.Email, &p.DNI, &tags, &fields, &p.FirstSeen, &p.LastSeen); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(tags, &p.Tags)
+		_ = json.Unmarshal(fields, &p.Fields)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
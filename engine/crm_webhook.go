@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// CRM webhook (flow completado)
+// ---------------------
+// Cuando una sesión llega a un estado terminal se le manda al tenant un POST con las
+// variables capturadas, el contacto y un resumen de la conversación, para que el lead
+// entre solo al CRM (HubSpot, Zapier, etc.). El envío va por la cola de jobs, así que
+// se reintenta si el endpoint falla.
+//
+//	"on_complete_webhook": {
+//	  "url": "https://hooks.zapier.com/hooks/catch/123/abc",
+//	  "secret": "${FLOW_SECRET_CRM_WEBHOOK}",
+//	  "states": ["END"]
+//	}
+//
+// Sin "states", son terminales los estados sin transiciones salientes.
+// Con secret, el body va firmado: X-Flowly-Signature: sha256=<hex HMAC-SHA256 del body>.
+// En secret y headers solo se expanden las ENV HTTP_ACTION_* / FLOW_SECRET_* (ver
+// http_action.go).
+
+const (
+	crmWebhookJobKind     = "crm_webhook"
+	crmWebhookTimeout     = 10 * time.Second
+	crmTranscriptMessages = 50
+)
+
+type FlowCompleteWebhook struct {
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret,omitempty"`  // ${HTTP_ACTION_*} / ${FLOW_SECRET_*} se expanden
+	Headers map[string]string `json:"headers,omitempty"` // ${HTTP_ACTION_*} / ${FLOW_SECRET_*} se expanden
+	States  []string          `json:"states,omitempty"`
+}
+
+type crmTranscriptLine struct {
+	Direction string    `json:"direction"`
+	Type      string    `json:"type"`
+	State     string    `json:"state,omitempty"`
+	Body      string    `json:"body"`
+	At        time.Time `json:"at"`
+}
+
+type crmWebhookPayload struct {
+	Event       string              `json:"event"`
+	ID          string              `json:"id"`
+	Tenant      string              `json:"tenant"`
+	State       string              `json:"state"`
+	CompletedAt time.Time           `json:"completed_at"`
+	Contact     map[string]string   `json:"contact"`
+	Variables   map[string]string   `json:"variables"`
+	Transcript  []crmTranscriptLine `json:"transcript"`
+}
+
+func validateCompleteWebhook(cfg FlowConfig) []string {
+	wh := cfg.OnCompleteWebhook
+	if wh == nil {
+		return nil
+	}
+	var errs []string
+	if !strings.HasPrefix(wh.URL, "https://") && !strings.HasPrefix(wh.URL, "http://") {
+		errs = append(errs, fmt.Sprintf("on_complete_webhook.url inválida: %q", wh.URL))
+	}
+	for _, s := range wh.States {
+		if _, ok := cfg.States[s]; !ok {
+			errs = append(errs, fmt.Sprintf("on_complete_webhook.states apunta a un estado inexistente: %q", s))
+		}
+	}
+	errs = append(errs, validateFlowSecretRefs("on_complete_webhook.secret", wh.Secret)...)
+	for _, k := range sortedKeys(wh.Headers) {
+		errs = append(errs, validateFlowSecretRefs(fmt.Sprintf("on_complete_webhook.headers[%s]", k), wh.Headers[k])...)
+	}
+	return errs
+}
+
+// isTerminal indica si llegar a state completa el flow.
+func (wh *FlowCompleteWebhook) isTerminal(cfg FlowConfig, state string) bool {
+	if len(wh.States) > 0 {
+		for _, s := range wh.States {
+			if s == state {
+				return true
+			}
+		}
+		return false
+	}
+	st, ok := cfg.States[state]
+	return ok && len(stateTransitions(st)) == 0
+}
+
+// notifyFlowComplete encola el webhook si la sesión acaba de entrar a un estado terminal.
+func (a *App) notifyFlowComplete(ctx context.Context, tenant string, cfg FlowConfig, prevState string, sess UserSession, waID, name string) {
+	wh := cfg.OnCompleteWebhook
+	if wh == nil || sess.State == prevState || !wh.isTerminal(cfg, sess.State) {
+		return
+	}
+
+	now := time.Now()
+	p := crmWebhookPayload{
+		Event:       "flow.completed",
+		ID:          fmt.Sprintf("%s:%s:%d", tenant, waID, now.UnixNano()),
+		Tenant:      tenant,
+		State:       sess.State,
+		CompletedAt: now,
+		Contact:     map[string]string{"wa_id": waID, "name": name},
+		Variables:   make(map[string]string, len(sess.Data)),
+		Transcript:  []crmTranscriptLine{},
+	}
+	for k, v := range sess.Data {
+		if !strings.HasPrefix(k, "_") { // internas (ej: _flow_version, progreso de forms)
+			p.Variables[k] = v
+		}
+	}
+	msgs, err := a.store.RecentMessages(tenant, waID, crmTranscriptMessages)
+	if err != nil {
+		log.Printf("ERROR leyendo conversación para el webhook: %v", err)
+	}
+	for _, m := range msgs {
+		p.Transcript = append(p.Transcript, crmTranscriptLine{Direction: m.Direction, Type: m.Type, State: m.State, Body: m.Body, At: m.CreatedAt})
+	}
+
+	body, _ := json.Marshal(p)
+	_, err = a.jobs.Enqueue(Job{
+		Kind:    crmWebhookJobKind,
+		Tenant:  tenant,
+		WaID:    waID,
+		Ref:     p.ID,
+		RunAt:   now,
+		Payload: map[string]string{"body": string(body), "version": sess.Data[flowVersionVar]},
+	})
+	if err != nil {
+		log.Printf("ERROR encolando webhook de flow completado: %v", err)
+	}
+}
+
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// jobSendCRMWebhook manda el POST; con error la cola lo reintenta.
+func jobSendCRMWebhook(ctx context.Context, a *App, job Job) error {
+	cfg, err := a.cache.LoadVersion(job.Tenant, job.Payload["version"])
+	if err != nil {
+		return err
+	}
+	wh := cfg.OnCompleteWebhook
+	if wh == nil {
+		return nil // se sacó del flow mientras esperaba
+	}
+
+	body := []byte(job.Payload["body"])
+	ctx, cancel := context.WithTimeout(ctx, crmWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", wh.URL, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Flowly-Event", "flow.completed")
+	req.Header.Set("X-Flowly-Delivery", job.Ref)
+	for k, v := range wh.Headers {
+		req.Header.Set(k, expandFlowSecrets(v))
+	}
+	if secret := expandFlowSecrets(wh.Secret); secret != "" {
+		req.Header.Set("X-Flowly-Signature", signWebhookBody(secret, body))
+	}
+
+	resp, err := httpClientOrShared(a.httpClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s respondió %s: %s", req.URL.Redacted(), resp.Status, strings.TrimSpace(string(raw)))
+	}
+	log.Printf("📤 tenant=%s flow completado enviado al CRM (%s)", job.Tenant, job.Ref)
+	return nil
+}
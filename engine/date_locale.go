@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Fechas en el idioma del usuario
+// ---------------------
+// Los horarios y días que arma la agenda (slot_N, day_N) salen con los nombres de días y
+// meses del idioma de la sesión (la variable "language", ver i18n.go) o, si no, del tenant:
+//
+//	"locale": "pt-BR"
+//
+// Sin "locale" se usa languages.default (o "es"). Solo cuenta el idioma ("es-AR" = "es") y
+// tiene que ser uno de dateLocales:
+//
+//	es: mié 12 — 14:00 hs
+//	pt: qua 12 — 14:00
+//	en: Wed 12 — 2:00 PM
+
+// dateLocale: nombres y formatos de un idioma. Los layouts son de Go; Mon / Monday / Jan /
+// January se reemplazan por los nombres del idioma.
+type dateLocale struct {
+	days      [7]string // domingo primero, como time.Weekday
+	shortDays [7]string
+	months    [12]string
+	short     [12]string
+
+	slotLayout string // horario en la lista de turnos
+	hourLayout string // horario de un día ya elegido
+	dayLayout  string // día en la lista de días
+	freeSlots  string // descripción del día (%d = horarios libres)
+}
+
+var dateLocales = map[string]dateLocale{
+	"es": {
+		days:       [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:  [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		months:     [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		short:      [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"},
+		slotLayout: "Mon 02 — 15:04 hs",
+		hourLayout: "15:04 hs",
+		dayLayout:  "Mon 02/01",
+		freeSlots:  "%d horario(s) libre(s)",
+	},
+	"pt": {
+		days:       [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortDays:  [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+		months:     [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		short:      [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		slotLayout: "Mon 02 — 15:04",
+		hourLayout: "15:04",
+		dayLayout:  "Mon 02/01",
+		freeSlots:  "%d horário(s) livre(s)",
+	},
+	"en": {
+		days:       [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		shortDays:  [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		months:     [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		short:      [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		slotLayout: "Mon 02 — 3:04 PM",
+		hourLayout: "3:04 PM",
+		dayLayout:  "Mon 01/02",
+		freeSlots:  "%d free slot(s)",
+	},
+}
+
+// Marcadores que time.Format copia tal cual (no son parte de ningún layout).
+const (
+	dateMarkDay      = "\x01"
+	dateMarkShortDay = "\x02"
+	dateMarkMonth    = "\x03"
+	dateMarkShortMon = "\x04"
+)
+
+var dateNameMarker = strings.NewReplacer("Monday", dateMarkDay, "Mon", dateMarkShortDay, "January", dateMarkMonth, "Jan", dateMarkShortMon)
+
+// localeLang deja solo el idioma: "pt-BR" / "pt_BR" -> "pt".
+func localeLang(locale string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(locale)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	return lang
+}
+
+// dateLocaleFor devuelve el formato de lang (es si no está soportado).
+func dateLocaleFor(lang string) dateLocale {
+	if l, ok := dateLocales[localeLang(lang)]; ok {
+		return l
+	}
+	return dateLocales[defaultLanguage]
+}
+
+// format es time.Format con los nombres de días y meses del idioma.
+func (l dateLocale) format(t time.Time, layout string) string {
+	s := t.Format(dateNameMarker.Replace(layout))
+	return strings.NewReplacer(
+		dateMarkDay, l.days[t.Weekday()],
+		dateMarkShortDay, l.shortDays[t.Weekday()],
+		dateMarkMonth, l.months[t.Month()-1],
+		dateMarkShortMon, l.short[t.Month()-1],
+	).Replace(s)
+}
+
+// dateLang es el idioma de las fechas para la sesión: el del usuario si tiene formato, si no
+// el locale del tenant, si no el idioma default del flow.
+func (cfg FlowConfig) dateLang(sess *UserSession) string {
+	if sess != nil {
+		if lang := localeLang(sess.Data[languageVar]); lang != "" {
+			if _, ok := dateLocales[lang]; ok {
+				return lang
+			}
+		}
+	}
+	if cfg.Locale != "" {
+		return localeLang(cfg.Locale)
+	}
+	return localeLang(cfg.Languages.defaultLang())
+}
+
+// sessionDateLang es dateLang con el flow de la sesión.
+func (a *App) sessionDateLang(tenant string, sess *UserSession) string {
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return defaultLanguage
+	}
+	return cfg.dateLang(sess)
+}
+
+func validateLocale(cfg FlowConfig) []string {
+	if cfg.Locale == "" {
+		return nil
+	}
+	if _, ok := dateLocales[localeLang(cfg.Locale)]; !ok {
+		return []string{fmt.Sprintf("locale %q no soportado (idiomas: %s)", cfg.Locale, strings.Join(sortedKeys(dateLocales), ", "))}
+	}
+	return nil
+}
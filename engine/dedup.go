@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Webhook dedup
+// ---------------------
+// Meta reintenta los webhooks que no recibieron 200 a tiempo, así que el mismo mensaje
+// puede llegar dos veces (y con varias réplicas, a réplicas distintas). Cada message ID
+// procesado se marca con TTL: primero en memoria (cubre los reintentos en la misma réplica)
+// y, si hay REDIS_URL, con SET NX en Redis, que es lo que comparten las réplicas.
+// Si Redis no responde se procesa igual (mejor un duplicado que perder un mensaje).
+//
+// ENV:
+//
+//	REDIS_URL=redis://:password@host:6379/0      (rediss:// para TLS)
+//	DEDUP_TTL_HOURS=24
+
+const (
+	defaultDedupTTL = 24 * time.Hour
+	redisTimeout    = 2 * time.Second
+)
+
+type MessageDeduper struct {
+	ttl   time.Duration
+	redis *redisClient // nil = solo en memoria
+
+	mu       sync.Mutex
+	seen     map[string]time.Time // key -> vencimiento
+	lastGC   time.Time
+	gcPeriod time.Duration
+}
+
+// NewMessageDeduperFromEnv arma el dedup; rc nil = solo en memoria.
+func NewMessageDeduperFromEnv(rc *redisClient) *MessageDeduper {
+	ttl := defaultDedupTTL
+	if h, err := strconv.Atoi(strings.TrimSpace(os.Getenv("DEDUP_TTL_HOURS"))); err == nil && h > 0 {
+		ttl = time.Duration(h) * time.Hour
+	}
+	d := &MessageDeduper{ttl: ttl, redis: rc, seen: make(map[string]time.Time), lastGC: time.Now(), gcPeriod: 10 * time.Minute}
+	if rc != nil {
+		log.Printf("🧷 Dedup de webhooks en Redis (%s, ttl=%s)", rc.addr, ttl)
+	}
+	return d
+}
+
+// FirstSeen marca el mensaje como procesado y devuelve false si ya lo estaba.
+func (d *MessageDeduper) FirstSeen(tenant, messageID string) bool {
+	if d == nil || messageID == "" {
+		return true
+	}
+	key := tenant + ":" + messageID
+	if !d.markLocal(key) {
+		return false
+	}
+	if d.redis == nil {
+		return true
+	}
+	ok, err := d.redis.SetNX("flowly:dedup:"+key, d.ttl)
+	if err != nil {
+		log.Printf("⚠️ dedup en Redis falló (proceso igual): %v", err)
+		return true
+	}
+	return ok
+}
+
+func (d *MessageDeduper) markLocal(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.lastGC) > d.gcPeriod {
+		for k, exp := range d.seen {
+			if now.After(exp) {
+				delete(d.seen, k)
+			}
+		}
+		d.lastGC = now
+	}
+	if exp, ok := d.seen[key]; ok && now.Before(exp) {
+		return false
+	}
+	d.seen[key] = now.Add(d.ttl)
+	return true
+}
+
+// ---------------------
+// Redis (RESP mínimo)
+// ---------------------
+// Alcanza con unos pocos comandos (AUTH, SELECT, SET NX, EVAL, PUBLISH, SUBSCRIBE), así
+// que se habla el protocolo directo sobre una conexión que se reabre si falla. La misma
+// conexión la comparten el dedup y los locks (ver cluster.go); SUBSCRIBE usa una propia.
+
+type redisClient struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// newRedisClientFromEnv devuelve nil si REDIS_URL no está (o es inválida).
+func newRedisClientFromEnv() *redisClient {
+	raw := strings.TrimSpace(os.Getenv("REDIS_URL"))
+	if raw == "" {
+		return nil
+	}
+	rc, err := newRedisClient(raw)
+	if err != nil {
+		log.Printf("⚠️ REDIS_URL inválida, sigo sin Redis (dedup y locks solo en memoria): %v", err)
+		return nil
+	}
+	return rc
+}
+
+func newRedisClient(raw string) (*redisClient, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("esquema no soportado: %q", u.Scheme)
+	}
+	c := &redisClient{addr: u.Host, useTLS: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("db inválida: %q", db)
+		}
+	}
+	return c, nil
+}
+
+// SetNX hace SET key 1 NX EX ttl y devuelve true si la key no existía.
+func (c *redisClient) SetNX(key string, ttl time.Duration) (bool, error) {
+	reply, err := c.do("SET", key, "1", "NX", "EX", strconv.Itoa(int(ttl.Seconds())))
+	return reply != nil, err
+}
+
+// Ping verifica la conexión (para /readyz).
+func (c *redisClient) Ping() error {
+	_, err := c.do("PING")
+	return err
+}
+
+// do manda un comando por la conexión compartida (reabriéndola si falló).
+func (c *redisClient) do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reply, err := c.doLocked(args...)
+	if err != nil && !isRedisError(err) {
+		c.closeLocked()
+	}
+	return reply, err
+}
+
+// clone es un cliente nuevo contra el mismo servidor, con su propia conexión.
+func (c *redisClient) clone() *redisClient {
+	return &redisClient{addr: c.addr, useTLS: c.useTLS, username: c.username, password: c.password, db: c.db}
+}
+
+func (c *redisClient) connectLocked() error {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn, c.rd = conn, bufio.NewReader(conn)
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := c.roundTripLocked(args...); err != nil {
+			c.closeLocked()
+			return fmt.Errorf("AUTH: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTripLocked("SELECT", strconv.Itoa(c.db)); err != nil {
+			c.closeLocked()
+			return fmt.Errorf("SELECT: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *redisClient) closeLocked() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.conn, c.rd = nil, nil
+}
+
+func (c *redisClient) doLocked(args ...string) (any, error) {
+	if c.conn == nil {
+		if err := c.connectLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return c.roundTripLocked(args...)
+}
+
+func (c *redisClient) roundTripLocked(args ...string) (any, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	if err := c.writeCommandLocked(args...); err != nil {
+		return nil, err
+	}
+	return c.readReplyLocked()
+}
+
+func (c *redisClient) writeCommandLocked(args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	_, err := c.conn.Write([]byte(b.String()))
+	return err
+}
+
+// redisError es un -ERR del servidor: la conexión sigue sirviendo.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func isRedisError(err error) bool {
+	var re redisError
+	return errors.As(err, &re)
+}
+
+// readReplyLocked lee una respuesta: +OK, -ERR, :n, bulk string ($-1 = nil) o array
+// (*n, para los mensajes de SUBSCRIBE).
+func (c *redisClient) readReplyLocked() (any, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("respuesta vacía de Redis")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, 0, n)
+		for range n {
+			item, err := c.readReplyLocked()
+			if err != nil && !isRedisError(err) {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("respuesta de Redis no soportada: %q", line)
+	}
+}
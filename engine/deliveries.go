@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Message statuses (webhook "statuses")
+// ---------------------
+
+// MessageStatus es cada item del array "statuses" que manda Meta
+// para los mensajes que enviamos (sent / delivered / read / failed).
+type MessageStatus struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Timestamp   string `json:"timestamp"`
+	RecipientID string `json:"recipient_id"`
+	Errors      []struct {
+		Code      int    `json:"code"`
+		Title     string `json:"title"`
+		Message   string `json:"message"`
+		ErrorData struct {
+			Details string `json:"details"`
+		} `json:"error_data"`
+	} `json:"errors,omitempty"`
+}
+
+// ---------------------
+// Delivery tracker (in-memory)
+// ---------------------
+
+const deliveryRetention = 7 * 24 * time.Hour
+
+type DeliveryEvent struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type DeliveryRecord struct {
+	MessageID     string          `json:"message_id"`
+	PhoneNumberID string          `json:"phone_number_id"`
+	To            string          `json:"to"`
+	Status        string          `json:"status"` // "accepted" (respuesta de la API) | sent | delivered | read | failed
+	ErrorCode     int             `json:"error_code,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Retries       int             `json:"retries"`
+	RetryOf       string          `json:"retry_of,omitempty"` // message_id original si es un reenvío
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	History       []DeliveryEvent `json:"history"`
+
+	// Payload original, para poder reenviar si falla.
+	Payload map[string]any `json:"payload,omitempty"`
+}
+
+// SentTracker es lo que sendPipeline necesita del seguimiento de entregas.
+type SentTracker interface {
+	TrackSent(messageID, phoneNumberID string, payload map[string]any)
+}
+
+type DeliveryTracker struct {
+	mu   sync.RWMutex
+	data map[string]*DeliveryRecord
+}
+
+func NewDeliveryTracker() *DeliveryTracker {
+	return &DeliveryTracker{data: make(map[string]*DeliveryRecord)}
+}
+
+// TrackSent registra un mensaje aceptado por la Graph API.
+func (t *DeliveryTracker) TrackSent(messageID, phoneNumberID string, payload map[string]any) {
+	if t == nil || messageID == "" {
+		return
+	}
+	now := time.Now()
+	to, _ := payload["to"].(string)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneLocked(now)
+
+	rec, ok := t.data[messageID]
+	if !ok {
+		// Puede que el status haya llegado antes que la respuesta del POST
+		rec = &DeliveryRecord{MessageID: messageID, Status: "accepted", CreatedAt: now}
+		t.data[messageID] = rec
+	}
+	rec.PhoneNumberID = phoneNumberID
+	rec.To = to
+	rec.Payload = payload
+	rec.UpdatedAt = now
+}
+
+// Update aplica un status recibido por webhook y devuelve una copia del registro.
+func (t *DeliveryTracker) Update(st MessageStatus) DeliveryRecord {
+	at := time.Now()
+	if sec, err := strconv.ParseInt(st.Timestamp, 10, 64); err == nil {
+		at = time.Unix(sec, 0)
+	}
+	ev := DeliveryEvent{Status: st.Status, At: at}
+	code := 0
+	if len(st.Errors) > 0 {
+		code = st.Errors[0].Code
+		ev.Error = strings.TrimSpace(st.Errors[0].Title + ": " + st.Errors[0].ErrorData.Details)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rec, ok := t.data[st.ID]
+	if !ok {
+		rec = &DeliveryRecord{MessageID: st.ID, To: st.RecipientID, CreatedAt: time.Now()}
+		t.data[st.ID] = rec
+	}
+	rec.History = append(rec.History, ev)
+	// Los status pueden llegar desordenados: no pisamos "read" con "delivered".
+	if deliveryStatusRank(st.Status) >= deliveryStatusRank(rec.Status) {
+		rec.Status = st.Status
+	}
+	if st.Status == "failed" {
+		rec.ErrorCode = code
+		rec.Error = ev.Error
+	}
+	rec.UpdatedAt = time.Now()
+	return rec.copy()
+}
+
+// MarkRetried enlaza el reenvío con el mensaje original.
+func (t *DeliveryTracker) MarkRetried(originalID, newID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	retries := 0
+	if rec, ok := t.data[originalID]; ok {
+		rec.Retries++
+		rec.UpdatedAt = time.Now()
+		retries = rec.Retries
+	}
+	// El reenvío hereda el contador, así una cadena de fallos no se reintenta para siempre
+	if rec, ok := t.data[newID]; ok {
+		rec.RetryOf = originalID
+		rec.Retries = retries
+	}
+}
+
+func (t *DeliveryTracker) Get(messageID string) (DeliveryRecord, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	rec, ok := t.data[messageID]
+	if !ok {
+		return DeliveryRecord{}, false
+	}
+	return rec.copy(), true
+}
+
+// List devuelve los registros filtrados por destinatario y/o status (vacío = todos),
+// del más reciente al más viejo.
+func (t *DeliveryTracker) List(to, status string, limit int) []DeliveryRecord {
+	t.mu.RLock()
+	out := make([]DeliveryRecord, 0)
+	for _, rec := range t.data {
+		if to != "" && rec.To != to {
+			continue
+		}
+		if status != "" && rec.Status != status {
+			continue
+		}
+		out = append(out, rec.copy())
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func (t *DeliveryTracker) pruneLocked(now time.Time) {
+	for id, rec := range t.data {
+		if now.Sub(rec.UpdatedAt) > deliveryRetention {
+			delete(t.data, id)
+		}
+	}
+}
+
+func (r *DeliveryRecord) copy() DeliveryRecord {
+	c := *r
+	c.History = append([]DeliveryEvent(nil), r.History...)
+	return c
+}
+
+func deliveryStatusRank(s string) int {
+	switch s {
+	case "accepted":
+		return 0
+	case "sent":
+		return 1
+	case "delivered":
+		return 2
+	case "read":
+		return 3
+	case "failed":
+		return 4
+	default:
+		return -1
+	}
+}
+
+// ---------------------
+// Retry de envíos fallidos
+// ---------------------
+
+var errNoPayload = errors.New("no hay payload guardado para reenviar")
+
+// Códigos de error de Meta que vale la pena reintentar (errores temporales / rate limits).
+var retryableStatusCodes = map[int]bool{
+	130429: true, // Rate limit hit
+	131000: true, // Something went wrong
+	131016: true, // Service unavailable
+	131053: true, // Media upload error
+	131056: true, // Pair rate limit
+}
+
+// maxFailedRetries lee WHATSAPP_RETRY_FAILED_MAX (0 = sin reintentos automáticos).
+func maxFailedRetries() int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WHATSAPP_RETRY_FAILED_MAX")))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func (a *App) handleStatuses(ctx context.Context, phoneID, tenant string, statuses []MessageStatus) {
+	for _, st := range statuses {
+		rec := a.deliveries.Update(st)
+		if err := a.campaigns.RecordCampaignStatus(st.ID, st.Status, rec.Error); err != nil {
+			log.Printf("ERROR actualizando status de campaña msg_id=%s: %v", st.ID, err)
+		}
+		if st.Status == "read" {
+			a.scheduleReadNudge(phoneID, tenant, st)
+		}
+		if st.Status != "failed" {
+			log.Printf("📬 STATUS tenant=%s msg_id=%s to=%s status=%s", tenant, st.ID, st.RecipientID, st.Status)
+			continue
+		}
+
+		log.Printf("❌ STATUS failed tenant=%s msg_id=%s to=%s code=%d error=%s", tenant, st.ID, st.RecipientID, rec.ErrorCode, rec.Error)
+		if werr := statusError(st); werr != nil {
+			if waClient, err := a.tenantWhatsAppClient(phoneID, tenant); err == nil {
+				a.handleWhatsAppError(ctx, waClient, st.RecipientID, rec.Payload, werr)
+				a.listFallbackOnStatus(ctx, waClient, st, rec.Payload, werr)
+			}
+		}
+
+		if !retryableStatusCodes[rec.ErrorCode] || rec.Retries >= maxFailedRetries() {
+			continue
+		}
+		if _, err := a.retryDelivery(ctx, phoneID, rec); err != nil {
+			log.Printf("ERROR reintentando msg_id=%s: %v", rec.MessageID, err)
+		}
+	}
+}
+
+// retryDelivery reenvía el payload original de un mensaje y devuelve el nuevo message_id.
+func (a *App) retryDelivery(ctx context.Context, phoneID string, rec DeliveryRecord) (string, error) {
+	if rec.Payload == nil {
+		return "", errNoPayload
+	}
+	if rec.PhoneNumberID != "" {
+		phoneID = rec.PhoneNumberID
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return "", err
+	}
+	// Directo a Meta, sin outbox ni log: es el mismo mensaje
+	waClient.Middleware = nil
+	newID, err := waClient.Send(ctx, rec.To, rec.Payload)
+	if err != nil {
+		return "", err
+	}
+	a.deliveries.TrackSent(newID, waClient.PhoneID, rec.Payload)
+	a.deliveries.MarkRetried(rec.MessageID, newID)
+	log.Printf("🔁 Reenviado msg_id=%s como %s", rec.MessageID, newID)
+	return newID, nil
+}
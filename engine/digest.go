@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Resumen diario de la agenda
+// ---------------------
+// Cada mañana se le manda al dueño del negocio (un número de WhatsApp) la lista de turnos
+// del día sacada del calendario, según calendar.json:
+//
+//	"daily_digest": {
+//	  "owner_phone": "5491122334455",
+//	  "time": "08:00",
+//	  "text": "Buen día ☀️ Hoy ({{date}}) tenés {{count}} turno(s):\n\n{{appointments}}",
+//	  "empty_text": "Buen día ☀️ Hoy no hay turnos agendados.",
+//	  "skip_empty": false
+//	}
+//
+// Cada turno va en una línea "09:30 · Juan Pérez · +5491155554444" (con varias agendas,
+// además el nombre de la agenda). Los turnos que reservó el bot guardan nombre y teléfono
+// en el evento; los cargados a mano muestran el título del evento.
+//
+// El dueño normalmente no le escribió al bot en las últimas 24h, así que el texto libre
+// puede no llegar: con template_name se manda ese template, con {{1}}=fecha, {{2}}=cantidad
+// y {{3}}=turnos separados por " / " (Meta no acepta saltos de línea en las variables).
+//
+// Un job "agenda_digest" por tenant y día (ref = fecha): runDigestScheduler encola el
+// próximo cada DIGEST_SCHEDULE_SECONDS, así un cambio de "time" vale desde el día siguiente.
+// Solo con provider google.
+//
+// ENV:
+//
+//	DIGEST_SCHEDULE_SECONDS=900
+
+const (
+	digestJobKind           = "agenda_digest"
+	defaultDigestSchedule   = 15 * time.Minute
+	defaultDigestTime       = "08:00"
+	defaultDigestText       = "Buen día ☀️ Tu agenda de hoy ({{date}}), {{count}} turno(s):\n\n{{appointments}}"
+	defaultDigestEmptyText  = "Buen día ☀️ Hoy ({{date}}) no hay turnos agendados."
+	digestTemplateSeparator = " / "
+)
+
+type DigestConfig struct {
+	OwnerPhone       string `json:"owner_phone"`
+	Time             string `json:"time,omitempty"` // HH:MM en la zona de la agenda (default 08:00)
+	TemplateName     string `json:"template_name,omitempty"`
+	TemplateLanguage string `json:"template_language,omitempty"` // default es_AR
+	Text             string `json:"text,omitempty"`
+	EmptyText        string `json:"empty_text,omitempty"`
+	SkipEmpty        bool   `json:"skip_empty,omitempty"` // sin turnos no se manda nada
+}
+
+func (d *DigestConfig) validate(provider string) error {
+	digits := strings.TrimLeft(d.OwnerPhone, "+")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return fmt.Errorf("daily_digest.owner_phone tiene que ser un número con código de país (ej: 5491122334455)")
+	}
+	if _, err := d.clock(); err != nil {
+		return err
+	}
+	if provider != "" && provider != calendar.ProviderGoogle {
+		return fmt.Errorf("daily_digest solo funciona con provider google")
+	}
+	errs := append(templateFilterErrors("daily_digest.text", d.Text), templateFilterErrors("daily_digest.empty_text", d.EmptyText)...)
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// clock devuelve la hora del resumen en minutos desde la medianoche.
+func (d *DigestConfig) clock() (int, error) {
+	s := d.Time
+	if s == "" {
+		s = defaultDigestTime
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("daily_digest.time inválido %q (HH:MM)", d.Time)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// nextRun es el próximo horario del resumen a partir de now (hoy si todavía no pasó).
+func (d *DigestConfig) nextRun(now time.Time) time.Time {
+	mins, _ := d.clock()
+	now = now.In(calendar.Location())
+	run := time.Date(now.Year(), now.Month(), now.Day(), mins/60, mins%60, 0, 0, now.Location())
+	if !run.After(now) {
+		run = run.AddDate(0, 0, 1)
+	}
+	return run
+}
+
+// ---------------------
+// Scheduler
+// ---------------------
+
+// runDigestScheduler encola el resumen del próximo día de cada tenant con daily_digest (y
+// el de estadísticas de notifications, ver notifications.go) hasta que se cancele el context.
+func (a *App) runDigestScheduler(ctx context.Context) {
+	every := time.Duration(envPositiveInt("DIGEST_SCHEDULE_SECONDS", int(defaultDigestSchedule/time.Second))) * time.Second
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		for _, tenant := range a.resolver.Tenants() {
+			a.scheduleDigest(tenant, time.Now())
+			a.scheduleDailyStats(tenant, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) scheduleDigest(tenant string, now time.Time) {
+	cfg, err := loadCalendarConfig(tenant)
+	if err != nil || cfg.DailyDigest == nil {
+		return // sin calendar.json (o inválido, ya lo loguea quien lo usa)
+	}
+	runAt := cfg.DailyDigest.nextRun(now)
+	ref := runAt.Format("2006-01-02")
+
+	pending, err := a.jobs.List(digestJobKind, tenant, "pending", 10)
+	if err != nil {
+		log.Printf("ERROR leyendo resúmenes programados de %s: %v", tenant, err)
+		return
+	}
+	for _, j := range pending {
+		if j.Ref == ref {
+			return
+		}
+	}
+	// Con Postgres, un índice único (tenant, ref) evita que dos réplicas lo encolen dos veces
+	id, err := a.jobs.Enqueue(Job{Kind: digestJobKind, Tenant: tenant, Ref: ref, RunAt: runAt})
+	if err != nil {
+		log.Printf("❌ No pude programar el resumen diario de %s: %v", tenant, err)
+		return
+	}
+	if id != 0 {
+		log.Printf("📋 Resumen diario #%d programado tenant=%s para %s", id, tenant, runAt.Format(time.RFC3339))
+	}
+}
+
+func jobSendAgendaDigest(ctx context.Context, a *App, job Job) error {
+	cfg, err := loadCalendarConfig(job.Tenant)
+	if err != nil {
+		return err
+	}
+	dc := cfg.DailyDigest
+	if dc == nil {
+		return nil // se sacó de calendar.json después de programarlo
+	}
+	day, err := time.ParseInLocation("2006-01-02", job.Ref, calendar.Location())
+	if err != nil {
+		return fmt.Errorf("ref inválido en job: %w", err)
+	}
+
+	svc, err := a.calendars.Get(job.Tenant)
+	if err != nil {
+		return err
+	}
+	cs, ok := svc.(*calendar.Service)
+	if !ok {
+		return fmt.Errorf("daily_digest solo funciona con provider google")
+	}
+	items, err := cs.DayAgenda(ctx, day)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 && dc.SkipEmpty {
+		return nil
+	}
+
+	phoneID, ok := a.resolver.PhoneNumberID(job.Tenant)
+	if !ok {
+		return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", job.Tenant)
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return err
+	}
+
+	multi := len(cs.Resources()) > 1
+	lines := make([]string, len(items))
+	for i, it := range items {
+		lines[i] = agendaLine(it, multi)
+	}
+	date := day.Format("02/01")
+	owner := strings.TrimLeft(dc.OwnerPhone, "+")
+
+	if dc.TemplateName != "" {
+		lang := dc.TemplateLanguage
+		if lang == "" {
+			lang = "es_AR"
+		}
+		list := strings.Join(lines, digestTemplateSeparator)
+		if list == "" {
+			list = "-"
+		}
+		_, err := waClient.SendTemplate(ctx, owner, dc.TemplateName, lang, []string{date, strconv.Itoa(len(items)), list}, nil)
+		return err
+	}
+
+	text := dc.Text
+	if text == "" {
+		text = defaultDigestText
+	}
+	if len(items) == 0 {
+		text = dc.EmptyText
+		if text == "" {
+			text = defaultDigestEmptyText
+		}
+	}
+	body := renderVars(text, map[string]string{
+		"date":         date,
+		"count":        strconv.Itoa(len(items)),
+		"appointments": strings.Join(lines, "\n"),
+	})
+	return waClient.SendText(ctx, owner, truncateRunes(body, 4096)) // límite de WhatsApp para el texto
+}
+
+// agendaLine es la línea del turno en el resumen.
+func agendaLine(it calendar.AgendaItem, withResource bool) string {
+	parts := []string{it.Start.In(calendar.Location()).Format("15:04"), it.Name}
+	if it.Phone != "" {
+		parts = append(parts, "+"+strings.TrimLeft(it.Phone, "+"))
+	}
+	if withResource && it.Resource != "" {
+		parts = append(parts, it.Resource)
+	}
+	return strings.Join(parts, " · ")
+}
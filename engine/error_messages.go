@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ---------------------
+// Mensajes de error por tenant
+// ---------------------
+// Lo que el bot contesta cuando algo sale mal, por clase de error, con variables ({{name}},
+// las de la sesión...) y traducciones por idioma de la sesión (ver i18n.go):
+//
+//	"error_messages": {
+//	  "processing": "Perdón {{name}}, algo falló de nuestro lado. Probá de nuevo en un rato.",
+//	  "timeout": "Está tardando más de lo normal ⏳ Escribime de nuevo en unos minutos.",
+//	  "out_of_hours": "Ahora estamos cerrados, te respondemos mañana desde las 9.",
+//	  "i18n": { "pt": { "processing": "Desculpe {{name}}, algo deu errado. Tente de novo." } }
+//	}
+//
+// Clases:
+//   - processing: falló el procesamiento del mensaje (el flow no se pudo cargar, etc.)
+//   - render: no se pudo armar o mandar el mensaje del estado
+//   - timeout: cualquiera de las dos anteriores porque un servicio externo (Calendar,
+//     http_action, LLM...) no respondió a tiempo
+//   - out_of_hours: con business_hours sin out_of_hours_state, responde esto al primer
+//     mensaje fuera de horario (ese mensaje no sigue el flow; los siguientes sí)
+//   - throttled: ráfaga de mensajes por encima del límite (ver inbound_limit.go)
+//
+// Lo que no está definido en el idioma del usuario usa el texto base del tenant y, si no, el
+// mensaje incorporado en ese idioma (es, pt o en).
+
+const (
+	errorClassProcessing = "processing"
+	errorClassRender     = "render"
+	errorClassTimeout    = "timeout"
+	errorClassOutOfHours = "out_of_hours"
+	errorClassThrottled  = "throttled"
+
+	outOfHoursNoticeVar = "_out_of_hours_at" // ya se avisó que está cerrado (RFC3339)
+)
+
+type FlowErrorMessages struct {
+	Processing string `json:"processing,omitempty"`
+	Render     string `json:"render,omitempty"`
+	Timeout    string `json:"timeout,omitempty"`
+	OutOfHours string `json:"out_of_hours,omitempty"`
+	Throttled  string `json:"throttled,omitempty"`
+
+	I18n map[string]FlowErrorMessages `json:"i18n,omitempty"`
+}
+
+// defaultErrorMessages: los mensajes incorporados por idioma.
+var defaultErrorMessages = map[string]FlowErrorMessages{
+	"es": {
+		Processing: "Perdón, hubo un error. Probá de nuevo.",
+		Render:     "Perdón, hubo un problema mostrando el menú.",
+		Timeout:    "Perdón, está tardando más de lo normal. Probá de nuevo en unos minutos.",
+		OutOfHours: "Ahora estamos fuera de horario. Te respondemos apenas volvamos 🙌",
+		Throttled:  "Esperá un momento 🙏 Estoy procesando tus mensajes anteriores.",
+	},
+	"pt": {
+		Processing: "Desculpe, houve um erro. Tente novamente.",
+		Render:     "Desculpe, houve um problema ao mostrar o menu.",
+		Timeout:    "Desculpe, está demorando mais do que o normal. Tente novamente em alguns minutos.",
+		OutOfHours: "Agora estamos fora do horário de atendimento. Respondemos assim que voltarmos 🙌",
+		Throttled:  "Aguarde um momento 🙏 Estou processando suas mensagens anteriores.",
+	},
+	"en": {
+		Processing: "Sorry, something went wrong. Please try again.",
+		Render:     "Sorry, there was a problem showing the menu.",
+		Timeout:    "Sorry, this is taking longer than usual. Please try again in a few minutes.",
+		OutOfHours: "We're closed right now. We'll get back to you as soon as we're back 🙌",
+		Throttled:  "One moment please 🙏 I'm still processing your previous messages.",
+	},
+}
+
+func (m *FlowErrorMessages) get(class string) string {
+	if m == nil {
+		return ""
+	}
+	switch class {
+	case errorClassProcessing:
+		return m.Processing
+	case errorClassRender:
+		return m.Render
+	case errorClassTimeout:
+		return m.Timeout
+	case errorClassOutOfHours:
+		return m.OutOfHours
+	case errorClassThrottled:
+		return m.Throttled
+	}
+	return ""
+}
+
+func validateErrorMessages(cfg FlowConfig) []string {
+	m := cfg.ErrorMessages
+	if m == nil {
+		return nil
+	}
+	var errs []string
+	for _, lang := range sortedKeys(m.I18n) {
+		if !cfg.Languages.supports(lang) && lang != cfg.Languages.defaultLang() {
+			errs = append(errs, fmt.Sprintf("error_messages.i18n: idioma %q no está en languages.supported", lang))
+		}
+		if len(m.I18n[lang].I18n) > 0 {
+			errs = append(errs, fmt.Sprintf("error_messages.i18n.%s no puede tener i18n", lang))
+		}
+	}
+	return errs
+}
+
+// errorClassOf: timeout si el error es por un servicio que no respondió a tiempo.
+func errorClassOf(class string, err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorClassTimeout
+	}
+	return class
+}
+
+// errorMessage devuelve el mensaje de la clase en el idioma de la sesión, con las variables.
+func (cfg FlowConfig) errorMessage(class string, vars map[string]string) string {
+	lang := localeLang(vars[languageVar])
+	if lang == "" {
+		lang = localeLang(cfg.Languages.defaultLang())
+	}
+	text := ""
+	if m := cfg.ErrorMessages; m != nil {
+		if tr, ok := m.I18n[lang]; ok {
+			text = tr.get(class)
+		}
+		if text == "" {
+			text = m.get(class)
+		}
+	}
+	if text == "" {
+		def, ok := defaultErrorMessages[lang]
+		if !ok {
+			def = defaultErrorMessages[defaultLanguage]
+		}
+		text = def.get(class)
+	}
+	return renderVars(text, vars)
+}
+
+// sendErrorMessage le avisa al usuario que algo falló (con el mensaje del tenant para la clase).
+func (a *App) sendErrorMessage(ctx context.Context, tenant string, client MessageSender, waID, class string, vars map[string]string) {
+	cfg, _ := a.cache.LoadVersion(tenant, vars[flowVersionVar])
+	// El ctx del webhook puede estar vencido (timeout): el aviso sale igual
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+	}
+	if err := client.SendText(ctx, waID, cfg.errorMessage(class, vars)); err != nil {
+		log.Printf("ERROR avisando el error (%s) a %s: %v", class, waID, err)
+	}
+}
+
+// outOfHoursNotice: sin out_of_hours_state, el primer mensaje fuera de horario recibe
+// error_messages.out_of_hours y no sigue el flow. true = ya se respondió.
+func (a *App) outOfHoursNotice(ctx context.Context, tenant string, client MessageSender, waID string, sess *UserSession, vars map[string]string) bool {
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil || cfg.BusinessHours == nil || cfg.BusinessHours.OutOfHoursState != "" {
+		return false
+	}
+	if cfg.BusinessHours.Open(tenant, time.Now()) {
+		delete(sess.Data, outOfHoursNoticeVar)
+		return false
+	}
+	if sess.Data[outOfHoursNoticeVar] != "" {
+		return false
+	}
+	sess.Data[outOfHoursNoticeVar] = time.Now().UTC().Format(time.RFC3339)
+	log.Printf("🌙 tenant=%s fuera de horario, aviso a %s", tenant, waID)
+	a.sendErrorMessage(ctx, tenant, client, waID, errorClassOutOfHours, vars)
+	return true
+}
@@ -0,0 +1,46 @@
+package engine
+
+import "fmt"
+
+// ---------------------
+// Primer contacto vs usuario que vuelve
+// ---------------------
+// Una sesión nueva arranca en el estado de entrada y el primer mensaje ("hola") se procesa
+// ahí. Con estos estados, la sesión nueva muestra directamente la bienvenida (ej: pedir
+// consentimiento) si es la primera vez que el número le escribe al tenant, o el estado
+// para los que vuelven (ej: el menú, sin presentación):
+//
+//	"first_contact_state": "WELCOME",
+//	"returning_state": "MENU"
+//
+// {{is_first_contact}} ("true" / "false") queda en la sesión para usarlo en los textos.
+// Los comandos globales, el idioma y el horario de atención siguen teniendo prioridad.
+
+const isFirstContactVar = "is_first_contact"
+
+// sessionStartState devuelve el estado a mostrar al arrancar una sesión (ok=false: el
+// primer mensaje se procesa en el estado de entrada, como siempre).
+func (cfg FlowConfig) sessionStartState(firstContact bool) (string, bool) {
+	if firstContact && cfg.FirstContactState != "" {
+		return cfg.FirstContactState, true
+	}
+	if !firstContact && cfg.ReturningState != "" {
+		return cfg.ReturningState, true
+	}
+	return "", false
+}
+
+func validateSessionStart(cfg FlowConfig) []string {
+	var errs []string
+	if s := cfg.FirstContactState; s != "" {
+		if _, ok := cfg.States[s]; !ok {
+			errs = append(errs, fmt.Sprintf("first_contact_state apunta a un estado inexistente: %q", s))
+		}
+	}
+	if s := cfg.ReturningState; s != "" {
+		if _, ok := cfg.States[s]; !ok {
+			errs = append(errs, fmt.Sprintf("returning_state apunta a un estado inexistente: %q", s))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,336 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Flow versions (draft / publish / rollback)
+// ---------------------
+// Además del configs/{tenant}/flow.json (versión "base"), un tenant puede tener versiones en
+//
+//	configs/{tenant}/versions/{version}.json
+//
+// Las que no están publicadas son borradores. La versión publicada (y el historial para
+// rollback) se guarda en configs/{tenant}/versions/published.json.
+//
+// Cada sesión queda fijada (_flow_version) a la versión con la que arrancó, así publicar
+// no rompe conversaciones a mitad de camino; al volver al estado de entrada pasa a la publicada.
+//
+// Ojo: el puntero vive en disco, con varias réplicas hay que publicar en todas (o compartir configs/).
+
+const (
+	baseFlowVersion      = "base"
+	flowVersionVar       = "_flow_version"
+	publishedPointerFile = "published.json"
+)
+
+var (
+	flowVersionNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+	errPublishedVersionImmutable = errors.New("las versiones publicadas no se pueden modificar")
+	errNothingToRollback         = errors.New("no hay una versión anterior para hacer rollback")
+)
+
+type publishedPointer struct {
+	Version     string    `json:"version"`
+	History     []string  `json:"history"` // versiones publicadas, la última es la actual
+	PublishedAt time.Time `json:"published_at"`
+
+	// Experimento A/B en curso (ver ab_tests.go)
+	Experiment *FlowExperiment `json:"experiment,omitempty"`
+}
+
+type FlowVersionInfo struct {
+	Version    string    `json:"version"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Published  bool      `json:"published"`
+}
+
+func validFlowVersionName(v string) bool {
+	return v == baseFlowVersion || (flowVersionNameRe.MatchString(v) && v != strings.TrimSuffix(publishedPointerFile, ".json"))
+}
+
+func flowVersionsDir(tenant string) string {
+	return filepath.Join(ConfigRoot, tenant, "versions")
+}
+
+func flowVersionPath(tenant, version string) string {
+	if version == "" || version == baseFlowVersion {
+		return filepath.Join(ConfigRoot, tenant, "flow.json")
+	}
+	return filepath.Join(flowVersionsDir(tenant), version+".json")
+}
+
+func readPublishedPointer(tenant string) (publishedPointer, error) {
+	b, err := os.ReadFile(filepath.Join(flowVersionsDir(tenant), publishedPointerFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return publishedPointer{Version: baseFlowVersion, History: []string{baseFlowVersion}}, nil
+	}
+	if err != nil {
+		return publishedPointer{}, err
+	}
+	var p publishedPointer
+	if err := json.Unmarshal(b, &p); err != nil {
+		return publishedPointer{}, fmt.Errorf("%s inválido: %w", publishedPointerFile, err)
+	}
+	if p.Version == "" {
+		p.Version = baseFlowVersion
+	}
+	return p, nil
+}
+
+// writeFileAtomic escribe a un temporal y renombra, para no dejar archivos a medias.
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writePublishedPointer(tenant string, p publishedPointer) error {
+	b, _ := json.MarshalIndent(p, "", "  ")
+	return writeFileAtomic(filepath.Join(flowVersionsDir(tenant), publishedPointerFile), b)
+}
+
+// listFlowVersions devuelve base + las versiones en versions/.
+func listFlowVersions(tenant string, published string) ([]FlowVersionInfo, error) {
+	var out []FlowVersionInfo
+	if fi, err := os.Stat(flowVersionPath(tenant, baseFlowVersion)); err == nil {
+		out = append(out, FlowVersionInfo{Version: baseFlowVersion, ModifiedAt: fi.ModTime(), Published: published == baseFlowVersion})
+	}
+	entries, err := os.ReadDir(flowVersionsDir(tenant))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		v, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || e.Name() == publishedPointerFile {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, FlowVersionInfo{Version: v, ModifiedAt: info.ModTime(), Published: published == v})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ModifiedAt.Before(out[j].ModifiedAt) })
+	return out, nil
+}
+
+// publishFlowVersion valida la versión (límites + lint) y la deja como publicada.
+func (a *App) publishFlowVersion(tenant, version string) (publishedPointer, error) {
+	if !validFlowVersionName(version) {
+		return publishedPointer{}, fmt.Errorf("nombre de versión inválido: %q", version)
+	}
+	cfg, err := loadFlowVersion(tenant, version)
+	if err != nil {
+		return publishedPointer{}, err
+	}
+	if res := lintFlowConfig(tenant, cfg); len(res.Errors) > 0 {
+		return publishedPointer{}, fmt.Errorf("la versión %s no pasa el lint:\n- %s", version, strings.Join(res.Errors, "\n- "))
+	}
+
+	p, err := readPublishedPointer(tenant)
+	if err != nil {
+		return publishedPointer{}, err
+	}
+	if p.Version == version {
+		return p, nil
+	}
+	p.Version = version
+	p.History = append(p.History, version)
+	p.PublishedAt = time.Now()
+	ended := p.Experiment != nil && p.Experiment.Version == version // publicar la B termina el experimento
+	if ended {
+		p.Experiment = nil
+	}
+	if err := writePublishedPointer(tenant, p); err != nil {
+		return publishedPointer{}, err
+	}
+	a.cache.SetPublished(tenant, version)
+	if ended {
+		a.cache.SetExperiment(tenant, nil)
+	}
+	a.notifyReplicas(clusterConfig, tenant)
+	log.Printf("🚀 tenant=%s flow publicado: %s", tenant, version)
+	return p, nil
+}
+
+// rollbackFlowVersion vuelve a la versión publicada anterior.
+func (a *App) rollbackFlowVersion(tenant string) (publishedPointer, error) {
+	p, err := readPublishedPointer(tenant)
+	if err != nil {
+		return publishedPointer{}, err
+	}
+	if len(p.History) < 2 {
+		return publishedPointer{}, errNothingToRollback
+	}
+	bad := p.History[len(p.History)-1]
+	p.History = p.History[:len(p.History)-1]
+	p.Version = p.History[len(p.History)-1]
+	p.PublishedAt = time.Now()
+
+	if _, err := loadFlowVersion(tenant, p.Version); err != nil {
+		return publishedPointer{}, fmt.Errorf("la versión anterior (%s) no carga: %w", p.Version, err)
+	}
+	if err := writePublishedPointer(tenant, p); err != nil {
+		return publishedPointer{}, err
+	}
+	a.cache.SetPublished(tenant, p.Version)
+	a.notifyReplicas(clusterConfig, tenant)
+	log.Printf("⏪ tenant=%s rollback de flow: %s -> %s", tenant, bad, p.Version)
+	return p, nil
+}
+
+// pinFlowVersion fija la sesión a la versión publicada (o a la de su variante A/B) si
+// todavía no tiene una (o si la suya ya no se puede cargar).
+func (a *App) pinFlowVersion(tenant, waID string, sess *UserSession) {
+	if sess.Data == nil {
+		sess.Data = make(map[string]string)
+	}
+	if v := sess.Data[flowVersionVar]; v != "" {
+		if _, err := a.cache.LoadVersion(tenant, v); err == nil {
+			return
+		}
+		log.Printf("⚠️ tenant=%s la versión %s de la sesión no carga, paso a la publicada", tenant, v)
+	}
+	sess.Data[flowVersionVar] = a.startFlowVersion(tenant, waID, sess)
+}
+
+// ---------------------
+// Admin endpoints
+// ---------------------
+
+func (a *App) handleAdminListFlowVersions(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	p, err := readPublishedPointer(tenant)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	versions, err := listFlowVersions(tenant, p.Version)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"published": p.Version, "history": p.History, "versions": versions})
+}
+
+func (a *App) handleAdminGetFlowVersion(w http.ResponseWriter, r *http.Request) {
+	tenant, version := r.PathValue("tenant"), r.PathValue("version")
+	if !validFlowVersionName(version) {
+		writeJSONError(w, http.StatusBadRequest, "nombre de versión inválido")
+		return
+	}
+	b, err := os.ReadFile(flowVersionPath(tenant, version))
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "versión no encontrada")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// handleAdminSaveFlowVersion guarda un borrador (el body es el flow.json completo) y
+// devuelve el resultado del lint. Las versiones que ya se publicaron no se pisan.
+func (a *App) handleAdminSaveFlowVersion(w http.ResponseWriter, r *http.Request) {
+	tenant, version := r.PathValue("tenant"), r.PathValue("version")
+	if !validFlowVersionName(version) || version == baseFlowVersion {
+		writeJSONError(w, http.StatusBadRequest, "nombre de versión inválido")
+		return
+	}
+	if _, err := os.Stat(filepath.Join(ConfigRoot, tenant)); err != nil {
+		writeJSONError(w, http.StatusNotFound, "tenant no encontrado")
+		return
+	}
+	p, err := readPublishedPointer(tenant)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, v := range p.History {
+		if v == version {
+			writeJSONError(w, http.StatusConflict, errPublishedVersionImmutable.Error())
+			return
+		}
+	}
+
+	b, err := readLimited(r, 2<<20)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg, err := decodeFlowConfig(b)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	// Para el audit log: contra el borrador anterior o, si es nuevo, contra la publicada
+	prev, err := os.ReadFile(flowVersionPath(tenant, version))
+	if err != nil {
+		prev, _ = os.ReadFile(flowVersionPath(tenant, p.Version))
+		auditNote(r, "from", p.Version)
+	}
+	if err := writeFileAtomic(flowVersionPath(tenant, version), b); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	auditDiff(r, lineDiff(string(prev), string(b)))
+	var res lintResult
+	if err := expandFragments(filepath.Join(ConfigRoot, tenant), &cfg); err != nil {
+		res.Errors = []string{err.Error()}
+	} else {
+		res = lintFlowConfig(tenant, cfg)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"version": version, "errors": res.Errors, "warnings": res.Warnings})
+}
+
+func (a *App) handleAdminPublishFlowVersion(w http.ResponseWriter, r *http.Request) {
+	tenant, version := r.PathValue("tenant"), r.PathValue("version")
+	prev := a.cache.Published(tenant)
+	p, err := a.publishFlowVersion(tenant, version)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	auditNote(r, "from", prev)
+	auditDiff(r, flowVersionDiff(tenant, prev, version))
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *App) handleAdminRollbackFlow(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	prev := a.cache.Published(tenant)
+	p, err := a.rollbackFlowVersion(tenant)
+	if errors.Is(err, errNothingToRollback) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	auditNote(r, "from", prev)
+	auditNote(r, "to", p.Version)
+	auditDiff(r, flowVersionDiff(tenant, prev, p.Version))
+	writeJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Form states
+// ---------------------
+// Un estado "form" hace varias preguntas en orden, valida cada respuesta
+// (re-pregunta si es inválida) y guarda todo en la sesión antes de avanzar
+// a on_text_next.
+//
+// Ejemplo:
+//
+//	"LEAD_FORM": {
+//	  "type": "form",
+//	  "body": "Necesito unos datos para cotizar 📝",
+//	  "form": {
+//	    "fields": [
+//	      { "name": "full_name", "prompt": "¿Nombre y apellido?" },
+//	      { "name": "dni", "prompt": "¿DNI? (sin puntos)", "validate": "numeric", "min_length": 7, "max_length": 8 },
+//	      { "name": "birth_date", "prompt": "¿Fecha de nacimiento? (dd/mm/aaaa)", "validate": "date" },
+//	      { "name": "email", "prompt": "¿Email?", "validate": "email", "error": "Ese email no parece válido 🤔" },
+//	      { "name": "plate", "prompt": "¿Patente?", "validate": "regex", "pattern": "^([A-Z]{3}\\d{3}|[A-Z]{2}\\d{3}[A-Z]{2})$" }
+//	    ]
+//	  },
+//	  "on_text_next": "LEAD_CONTACT_PREF"
+//	}
+
+// Variables internas de sesión para el progreso del form
+const (
+	formFieldVar = "_form_field"
+	formErrorVar = "_form_error"
+	formStartVar = "_form_start" // primera pregunta hecha (las anteriores salieron del perfil)
+)
+
+const defaultFormDateLayout = "02/01/2006"
+
+type FlowForm struct {
+	Fields []FlowFormField `json:"fields"`
+}
+
+type FlowFormField struct {
+	Name     string `json:"name"`               // variable de sesión donde se guarda la respuesta
+	Prompt   string `json:"prompt"`             // pregunta ({{vars}} soportadas)
+	Validate string `json:"validate,omitempty"` // "text" (default) | "numeric" | "date" | "email" | "regex" | "when"
+	Pattern  string `json:"pattern,omitempty"`  // para "regex"
+
+	// Para "date": layout de Go de la entrada (default 02/01/2006). Se guarda normalizado como 2006-01-02.
+	DateFormat string `json:"date_format,omitempty"`
+
+	MinLength int    `json:"min_length,omitempty"`
+	MaxLength int    `json:"max_length,omitempty"`
+	Error     string `json:"error,omitempty"` // mensaje al fallar la validación
+
+	// Dato del perfil de contacto (email, dni, name u otro): se guarda ahí y, si ya está, la
+	// pregunta se saltea (ver contact_profiles.go)
+	Contact string `json:"contact,omitempty"`
+}
+
+func validateForm(stateName string, f *FlowForm) []string {
+	if f == nil {
+		return []string{fmt.Sprintf("state=%s es form pero form es nil", stateName)}
+	}
+	if len(f.Fields) == 0 {
+		return []string{fmt.Sprintf("state=%s form sin fields", stateName)}
+	}
+
+	var errs []string
+	seen := map[string]bool{}
+	for i, fld := range f.Fields {
+		name := strings.TrimSpace(fld.Name)
+		if name == "" {
+			errs = append(errs, fmt.Sprintf("state=%s form.fields[%d] name vacío", stateName, i))
+		} else if seen[name] {
+			errs = append(errs, fmt.Sprintf("state=%s form field duplicado: %q", stateName, name))
+		}
+		seen[name] = true
+
+		if strings.TrimSpace(fld.Prompt) == "" {
+			errs = append(errs, fmt.Sprintf("state=%s form field %q sin prompt", stateName, name))
+		}
+
+		switch fld.Validate {
+		case "", "text", "numeric", "date", "email", formValidateWhen:
+		case "regex":
+			if _, err := regexp.Compile(fld.Pattern); err != nil || fld.Pattern == "" {
+				errs = append(errs, fmt.Sprintf("state=%s form field %q pattern inválido: %q", stateName, name, fld.Pattern))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("state=%s form field %q validate no soportado: %q", stateName, name, fld.Validate))
+		}
+	}
+	return errs
+}
+
+// validateFormInput valida la respuesta y devuelve el valor normalizado a guardar.
+func validateFormInput(fld FlowFormField, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("la respuesta no puede estar vacía")
+	}
+
+	value := input
+	switch fld.Validate {
+	case "numeric":
+		value = strings.NewReplacer(".", "", " ", "", "-", "").Replace(input)
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return "", fmt.Errorf("tiene que ser solo números")
+		}
+	case "date":
+		layout := fld.DateFormat
+		if layout == "" {
+			layout = defaultFormDateLayout
+		}
+		t, err := time.Parse(layout, input)
+		if err != nil {
+			return "", fmt.Errorf("la fecha no tiene el formato esperado")
+		}
+		value = t.Format("2006-01-02")
+	case "email":
+		addr, err := mail.ParseAddress(input)
+		if err != nil || !strings.Contains(addr.Address, ".") || addr.Address != input {
+			return "", fmt.Errorf("el email no es válido")
+		}
+		value = strings.ToLower(addr.Address)
+	case "regex":
+		re := regexp.MustCompile(fld.Pattern)
+		if !re.MatchString(input) {
+			return "", fmt.Errorf("el formato no es válido")
+		}
+	}
+
+	if fld.MinLength > 0 && runeLen(value) < fld.MinLength {
+		return "", fmt.Errorf("tiene que tener al menos %d caracteres", fld.MinLength)
+	}
+	if fld.MaxLength > 0 && runeLen(value) > fld.MaxLength {
+		return "", fmt.Errorf("tiene que tener como máximo %d caracteres", fld.MaxLength)
+	}
+	return value, nil
+}
+
+// handleFormInput procesa una respuesta mientras el usuario está en un estado "form".
+// handled=false significa que el mensaje no es para el form (sigue el flujo normal).
+func (a *App) handleFormInput(tenant, state string, sess *UserSession, msg IncomingMessage, vars map[string]string) (next string, handled bool, err error) {
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return "", false, err
+	}
+	st, ok := cfg.States[state]
+	if !ok || st.Type != "form" || st.Form == nil || len(st.Form.Fields) == 0 {
+		return "", false, nil
+	}
+	if msg.Type != "text" || msg.Text == nil {
+		return "", false, nil
+	}
+	txt := strings.TrimSpace(msg.Text.Body)
+	if strings.EqualFold(txt, "menu") {
+		return "", false, nil
+	}
+
+	idx, _ := strconv.Atoi(sess.Data[formFieldVar])
+	if idx < 0 || idx >= len(st.Form.Fields) {
+		idx = 0
+	}
+	fld := st.Form.Fields[idx]
+
+	var value string
+	var verr error
+	if fld.Validate == formValidateWhen {
+		value, verr = a.formWhenInput(tenant, sess, vars, fld, txt) // ver natural_dates.go
+	} else {
+		value, verr = validateFormInput(fld, txt)
+	}
+	if verr != nil {
+		errMsg := fld.Error
+		var clarify whenClarification
+		switch {
+		case errors.As(verr, &clarify):
+			errMsg = clarify.question
+		case errMsg == "":
+			errMsg = "Mmm, " + verr.Error() + ". Probemos de nuevo 🙏"
+		}
+		log.Printf("📝 FORM %s: %s inválido (%v)", state, fld.Name, verr)
+		setSessionVar(sess, vars, formErrorVar, errMsg)
+		return state, true, nil
+	}
+
+	log.Printf("📝 FORM %s: %s OK", state, fld.Name)
+	setSessionVar(sess, vars, fld.Name, value)
+	setSessionVar(sess, vars, formErrorVar, "")
+
+	waID := vars["wa_id"]
+	if fld.Contact != "" {
+		if err := a.contacts.UpdateContactFields(tenant, waID, map[string]string{fld.Contact: value}); err != nil {
+			log.Printf("ERROR guardando %s en el perfil wa_id=%s: %v", fld.Contact, waID, err)
+		}
+		vars[contactVarPrefix+fld.Contact] = value
+	}
+	profile, _, err := a.contacts.GetContact(tenant, waID)
+	if err != nil {
+		log.Printf("ERROR leyendo perfil de contacto wa_id=%s: %v", waID, err)
+	}
+	if next := nextUnknownFormField(st.Form.Fields, idx+1, profile, sess, vars); next < len(st.Form.Fields) {
+		setSessionVar(sess, vars, formFieldVar, strconv.Itoa(next))
+		return state, true, nil
+	}
+
+	// Form completo
+	resetFormProgress(sess, vars)
+	if st.OnTextNext == "" {
+		return cfg.Entry(), true, nil
+	}
+	return st.OnTextNext, true, nil
+}
+
+func resetFormProgress(sess *UserSession, vars map[string]string) {
+	delete(sess.Data, formFieldVar)
+	delete(sess.Data, formErrorVar)
+	delete(sess.Data, formStartVar)
+	delete(sess.Data, whenPendingVar)
+	delete(vars, formFieldVar)
+	delete(vars, formErrorVar)
+	delete(vars, formStartVar)
+	delete(vars, whenPendingVar)
+}
+
+// renderFormPrompt arma el texto a mostrar: error (si hubo) + intro (solo la 1ra vez) + pregunta actual.
+func renderFormPrompt(st FlowState, vars map[string]string) string {
+	idx, _ := strconv.Atoi(vars[formFieldVar])
+	if idx < 0 || idx >= len(st.Form.Fields) {
+		idx = 0
+	}
+
+	var parts []string
+	if e := vars[formErrorVar]; e != "" {
+		if vars[whenPendingVar] != "" {
+			return renderVars(e, vars) // repregunta de un campo "when": ya es la pregunta
+		}
+		parts = append(parts, e)
+	} else if start, _ := strconv.Atoi(vars[formStartVar]); idx == start && strings.TrimSpace(st.Body) != "" {
+		parts = append(parts, st.Body)
+	}
+	parts = append(parts, st.Form.Fields[idx].Prompt)
+
+	return renderVars(strings.Join(parts, "\n\n"), vars)
+}
+
+// setSessionVar guarda una variable en la sesión y en las vars del render actual.
+func setSessionVar(sess *UserSession, vars map[string]string, k, v string) {
+	if sess.Data == nil {
+		sess.Data = make(map[string]string)
+	}
+	sess.Data[k] = v
+	vars[k] = v
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ---------------------
+// Fragmentos (sub-flows reutilizables)
+// ---------------------
+// Bloques que se repiten entre flows (ej: pedir datos de contacto) viven en
+//
+//	configs/{tenant}/fragments/{nombre}.json
+//
+//	{
+//	  "entry": "ASK_NAME",
+//	  "states": {
+//	    "ASK_NAME":  { "type": "text", "body": "¿Tu nombre?", "on_text_next": "ASK_EMAIL" },
+//	    "ASK_EMAIL": { "type": "text", "body": "¿Y tu email?", "on_text_next": "$return" }
+//	  }
+//	}
+//
+// y se usan desde el flow con un estado "include":
+//
+//	"PEDIR_CONTACTO": { "type": "include", "fragment": "contact_data", "on_return_next": "CONFIRM" }
+//
+// Al cargar el flow, el include se reemplaza por los estados del fragmento: el de entrada
+// toma el nombre del include (PEDIR_CONTACTO) y el resto queda con prefijo
+// (PEDIR_CONTACTO.ASK_EMAIL), así el mismo fragmento se puede incluir varias veces.
+// "$return" vuelve al on_return_next del include; cualquier otro destino que no sea del
+// fragmento apunta a un estado del flow que lo incluye (ej: "MENU"). Los fragmentos pueden
+// incluir otros fragmentos.
+
+const (
+	fragmentReturn   = "$return"
+	maxFragmentDepth = 8
+)
+
+var fragmentNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+type FlowFragment struct {
+	Entry  string               `json:"entry"`
+	States map[string]FlowState `json:"states"`
+}
+
+// expandFragments reemplaza los estados "include" de cfg. tenantDir es configs/{tenant}.
+func expandFragments(tenantDir string, cfg *FlowConfig) error {
+	return expandIncludes(tenantDir, cfg.States, nil)
+}
+
+func expandIncludes(tenantDir string, states map[string]FlowState, stack []string) error {
+	for _, name := range sortedKeys(states) {
+		st := states[name]
+		if st.Type != "include" {
+			continue
+		}
+		if st.Fragment == "" {
+			return fmt.Errorf("state=%s: include sin fragment", name)
+		}
+		if containsString(stack, st.Fragment) || len(stack) >= maxFragmentDepth {
+			return fmt.Errorf("state=%s: include circular o demasiado anidado (%s -> %s)", name, strings.Join(stack, " -> "), st.Fragment)
+		}
+		frag, err := loadFragment(tenantDir, st.Fragment)
+		if err != nil {
+			return fmt.Errorf("state=%s: %w", name, err)
+		}
+		if err := expandIncludes(tenantDir, frag.States, append(stack, st.Fragment)); err != nil {
+			return fmt.Errorf("fragmento %s: %w", st.Fragment, err)
+		}
+
+		rename := func(s string) string {
+			if s == frag.Entry {
+				return name
+			}
+			return name + "." + s
+		}
+		var missingReturn bool
+		target := func(to string) string {
+			if to == fragmentReturn {
+				if st.OnReturnNext == "" {
+					missingReturn = true
+				}
+				return st.OnReturnNext
+			}
+			if _, ok := frag.States[to]; ok {
+				return rename(to)
+			}
+			return to
+		}
+
+		delete(states, name)
+		for fragName, fst := range frag.States {
+			newName := rename(fragName)
+			if _, exists := states[newName]; exists {
+				return fmt.Errorf("state=%s: el fragmento %s genera %s, que ya existe en el flow", name, st.Fragment, newName)
+			}
+			mapTransitions(&fst, target)
+			states[newName] = fst
+		}
+		if missingReturn {
+			return fmt.Errorf("state=%s: el fragmento %s usa %s y el include no tiene on_return_next", name, st.Fragment, fragmentReturn)
+		}
+	}
+	return nil
+}
+
+func loadFragment(tenantDir, name string) (FlowFragment, error) {
+	if !fragmentNameRe.MatchString(name) {
+		return FlowFragment{}, fmt.Errorf("nombre de fragmento inválido: %q", name)
+	}
+	path := filepath.Join(tenantDir, "fragments", name+".json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return FlowFragment{}, fmt.Errorf("no pude leer %s: %w", path, err)
+	}
+	var frag FlowFragment
+	if err := decodeStrict(b, &frag); err != nil {
+		return FlowFragment{}, fmt.Errorf("json inválido en %s: %w", path, err)
+	}
+	if frag.Entry == "" {
+		return FlowFragment{}, fmt.Errorf("%s no define entry", path)
+	}
+	if _, ok := frag.States[frag.Entry]; !ok {
+		return FlowFragment{}, fmt.Errorf("%s: entry=%s no es un estado del fragmento", path, frag.Entry)
+	}
+	return frag, nil
+}
+
+// mapTransitions aplica fn a todos los destinos del estado (los mismos que stateTransitions).
+func mapTransitions(st *FlowState, fn func(string) string) {
+	mapOne := func(s *string) {
+		if *s != "" {
+			*s = fn(*s)
+		}
+	}
+	mapAll := func(m map[string]string) {
+		for k, v := range m {
+			m[k] = fn(v)
+		}
+	}
+	mapOne(&st.OnTextNext)
+	mapAll(st.OnSelectNext)
+	mapAll(st.OnKeywordNext)
+	mapOne(&st.OnOrderNext)
+	mapAll(st.OnActionError)
+	mapOne(&st.OnTimeoutNext)
+	if st.HTTP != nil {
+		mapAll(st.HTTP.OnStatusNext)
+		mapOne(&st.HTTP.OnErrorNext)
+	}
+	if st.OnReadNoReply != nil {
+		mapOne(&st.OnReadNoReply.Next)
+	}
+	if st.AI != nil {
+		mapOne(&st.AI.OnErrorNext)
+	}
+}
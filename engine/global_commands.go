@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Global commands
+// ---------------------
+// Palabras clave que funcionan desde cualquier estado (incluso en medio de un form o fuera
+// de horario) y se evalúan antes que la lógica del estado. El destino es un estado del flow
+// o una acción incorporada:
+//
+//	"global_commands": {
+//	  "menu": "MENU",
+//	  "volver": "back",
+//	  "reiniciar": "restart",
+//	  "agente": "handoff",
+//	  "stop": "opt_out"
+//	}
+//
+//   - back: vuelve al estado anterior (ver history.go).
+//   - restart: borra los datos de la sesión y vuelve al estado de entrada (las variables
+//     contact vuelven del perfil, ver variable_scopes.go).
+//   - handoff: pausa el bot para esta conversación (la retoma una persona; se reanuda con
+//     cualquier comando global o con POST /admin/tenants/{tenant}/sessions/{wa_id}/reset).
+//   - opt_out: el usuario no quiere más mensajes; el bot deja de responderle hasta que mande
+//     otro comando global.
+//
+// La comparación ignora mayúsculas, acentos y signos ("Menú", "MENU!" y "menu" son lo mismo).
+// "menu" -> estado de entrada y las bajas (stop, baja...) -> opt_out están siempre, salvo que
+// el tenant las redefina (ver opt_out.go). Con "text_match" también matchean dentro de una
+// frase o con errores de tipeo (ver text_match.go), salvo las bajas.
+
+const (
+	globalBack    = "back"
+	globalRestart = "restart"
+	globalHandoff = "handoff"
+	globalOptOut  = "opt_out"
+
+	handoffVar  = "_handoff_at"
+	optedOutVar = "_opted_out_at"
+
+	handoffText = "Listo, te paso con una persona del equipo. Te van a responder por acá en breve 🙌"
+	optOutText  = "Listo, no te vamos a enviar más mensajes. Si querés volver, escribí \"menu\"."
+)
+
+var globalBuiltins = map[string]bool{globalBack: true, globalRestart: true, globalHandoff: true, globalOptOut: true}
+
+func validateGlobalCommands(cfg FlowConfig) []string {
+	var errs []string
+	seen := make(map[string]string)
+	for _, kw := range sortedKeys(cfg.GlobalCommands) {
+		target := cfg.GlobalCommands[kw]
+		norm := normalizeKeyword(kw)
+		if norm == "" {
+			errs = append(errs, fmt.Sprintf("global_commands: keyword vacía: %q", kw))
+			continue
+		}
+		if other, dup := seen[norm]; dup {
+			errs = append(errs, fmt.Sprintf("global_commands: %q y %q son la misma keyword", other, kw))
+		}
+		seen[norm] = kw
+
+		_, isState := cfg.States[target]
+		switch {
+		case globalBuiltins[target] && isState:
+			errs = append(errs, fmt.Sprintf("global_commands[%q]: %q es ambiguo (estado y acción incorporada)", kw, target))
+		case !globalBuiltins[target] && !isState:
+			errs = append(errs, fmt.Sprintf("global_commands[%q] apunta a un estado inexistente: %q", kw, target))
+		}
+	}
+	return errs
+}
+
+// globalCommand devuelve el destino del comando global que coincide con el texto.
+func (cfg FlowConfig) globalCommand(text string) (string, bool) {
+	norm := normalizeKeyword(text)
+	if norm == "" {
+		return "", false
+	}
+	for kw, target := range cfg.GlobalCommands {
+		if normalizeKeyword(kw) == norm {
+			return target, true
+		}
+	}
+	if norm == "menu" {
+		return cfg.Entry(), true
+	}
+	if containsString(optOutKeywords, norm) {
+		return globalOptOut, true
+	}
+
+	// Con text_match también "quiero volver al menu" o "mneu" (la baja solo con la palabra exacta)
+	if cfg.TextMatch != nil {
+		keywords := append(sortedKeys(cfg.GlobalCommands), "menu")
+		if kw, ok := cfg.TextMatch.matchKeyword(keywords, text); ok {
+			if target, ok := cfg.GlobalCommands[kw]; ok {
+				return target, true
+			}
+			return cfg.Entry(), true
+		}
+	}
+	return "", false
+}
+
+var accentFolder = strings.NewReplacer(
+	"á", "a", "à", "a", "ä", "a", "â", "a", "ã", "a",
+	"é", "e", "è", "e", "ë", "e", "ê", "e",
+	"í", "i", "ì", "i", "ï", "i", "î", "i",
+	"ó", "o", "ò", "o", "ö", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ù", "u", "ü", "u", "û", "u",
+	"ñ", "n", "ç", "c",
+)
+
+// normalizeKeyword: minúsculas, sin acentos, sin signos y con los espacios colapsados.
+func normalizeKeyword(s string) string {
+	s = accentFolder.Replace(strings.ToLower(s))
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == ' ' || r == '_' {
+			return r
+		}
+		if r == '\n' || r == '\t' {
+			return ' '
+		}
+		return -1
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// sessionPaused indica si el bot no debe responder (handoff u opt-out).
+func sessionPaused(sess UserSession) bool {
+	return sess.Data[handoffVar] != "" || sess.Data[optedOutVar] != ""
+}
+
+// runGlobalCommand aplica el comando global del mensaje, si hay. Devuelve el estado al que
+// hay que ir (handled) o done=true si ya respondió y no hay que seguir con el flow.
+func (a *App) runGlobalCommand(ctx context.Context, cfg FlowConfig, tenant, sessKey string, sess *UserSession, msg IncomingMessage, client MessageSender, vars map[string]string) (next string, handled, done bool) {
+	// Texto libre o quick reply de un template (ej: el botón "Stop promotions" de una campaña)
+	input := ""
+	switch {
+	case msg.Type == "text" && msg.Text != nil:
+		input = msg.Text.Body
+	case msg.Type == "button" && msg.Button != nil:
+		input = msg.Button.Text
+	default:
+		return "", false, false
+	}
+	target, ok := cfg.globalCommand(input)
+	if !ok {
+		return "", false, false
+	}
+	waID := msg.From
+	log.Printf("🌐 Comando global %q -> %s [wa_id=%s]", strings.TrimSpace(input), target, waID)
+
+	// Cualquier comando global reanuda una conversación pausada (y saca de la lista de bajas)
+	delete(sess.Data, handoffVar)
+	if sess.Data[optedOutVar] != "" && target != globalOptOut {
+		if _, err := a.optOuts.RemoveOptOut(tenant, waID); err != nil {
+			log.Printf("ERROR sacando de la lista de bajas a %s: %v", waID, err)
+		}
+	}
+	delete(sess.Data, optedOutVar)
+
+	switch target {
+	case globalBack:
+		return previousState, true, false
+
+	case globalRestart:
+		sess.Data = make(map[string]string)
+		for k := range vars {
+			if k != "name" && k != "wa_id" {
+				delete(vars, k)
+			}
+		}
+		return cfg.Entry(), true, false
+
+	case globalHandoff, globalOptOut:
+		text := handoffText
+		if target == globalOptOut {
+			text = optOutText
+			sess.Data[optedOutVar] = time.Now().Format(time.RFC3339)
+			if err := a.optOuts.AddOptOut(OptOutEntry{Tenant: tenant, WaID: waID, Reason: normalizeKeyword(input)}); err != nil {
+				log.Printf("ERROR guardando la baja de %s: %v", waID, err)
+			}
+		} else {
+			sess.Data[handoffVar] = time.Now().Format(time.RFC3339)
+			a.notifyHandoffRequest(tenant, waID, sess.State, "")
+		}
+		sess.UpdatedAt = time.Now()
+		a.sessions.Set(sessKey, *sess)
+		if err := client.SendText(ctx, waID, text); err != nil {
+			log.Printf("ERROR respondiendo comando %s: %v", target, err)
+		}
+		return "", false, true
+	}
+	return target, true, false
+}
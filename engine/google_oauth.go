@@ -0,0 +1,370 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flowly/calendar"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// ---------------------
+// Google OAuth per tenant
+// ---------------------
+// En vez del service account global, cada tenant puede conectar su propia cuenta de Google:
+//
+//  1. GET /admin/tenants/{tenant}/google/connect devuelve la URL de consentimiento.
+//  2. El dueño de la agenda la abre, acepta, y Google vuelve a /oauth/google/callback.
+//  3. El token (con refresh token) se guarda por tenant y se renueva solo.
+//
+// En calendar.json: "google_auth": "oauth". DELETE /admin/tenants/{tenant}/google lo desconecta.
+//
+// ENV:
+//
+//	GOOGLE_OAUTH_CLIENT_ID=...
+//	GOOGLE_OAUTH_CLIENT_SECRET=...
+//	GOOGLE_OAUTH_REDIRECT_URL=https://flowly.example.com/oauth/google/callback
+//	OAUTH_STATE_SECRET=...   (firma el state; default: derivado de los tokens admin)
+//
+// Sin DATABASE_URL los tokens quedan en memoria (se pierden al reiniciar).
+
+const oauthStateTTL = 15 * time.Minute
+
+var errGoogleNotConnected = errors.New("el tenant no conectó su cuenta de Google")
+
+// OAuthTokenStore guarda el token de Google de cada tenant.
+type OAuthTokenStore interface {
+	GetOAuthToken(tenant string) (*oauth2.Token, error) // nil, nil si no hay
+	SaveOAuthToken(tenant string, tok *oauth2.Token) error
+	DeleteOAuthToken(tenant string) error
+}
+
+func NewOAuthTokenStore(store *PostgresStore) OAuthTokenStore {
+	if store != nil {
+		return store
+	}
+	return &memoryOAuthTokenStore{tokens: make(map[string]*oauth2.Token)}
+}
+
+// googleOAuthConfig arma la config del cliente OAuth; nil si no está configurado.
+func googleOAuthConfig() *oauth2.Config {
+	id := strings.TrimSpace(os.Getenv("GOOGLE_OAUTH_CLIENT_ID"))
+	secret := strings.TrimSpace(os.Getenv("GOOGLE_OAUTH_CLIENT_SECRET"))
+	redirect := strings.TrimSpace(os.Getenv("GOOGLE_OAUTH_REDIRECT_URL"))
+	if id == "" || secret == "" || redirect == "" {
+		return nil
+	}
+	return &oauth2.Config{
+		ClientID:     id,
+		ClientSecret: secret,
+		RedirectURL:  redirect,
+		Endpoint:     google.Endpoint,
+		Scopes:       []string{gcal.CalendarScope},
+	}
+}
+
+// googleClientOption devuelve cómo autenticar contra Google para el tenant.
+func googleClientOption(tenant string, cfg TenantCalendarConfig, tokens OAuthTokenStore) (option.ClientOption, error) {
+	if cfg.GoogleAuth != calendar.GoogleAuthOAuth {
+		credsFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		if credsFile == "" {
+			return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS no está en .env")
+		}
+		return option.WithCredentialsFile(credsFile), nil
+	}
+
+	oc := googleOAuthConfig()
+	if oc == nil {
+		return nil, fmt.Errorf("google_auth=oauth pero faltan GOOGLE_OAUTH_CLIENT_ID/SECRET/REDIRECT_URL")
+	}
+	if tokens == nil {
+		return nil, errGoogleNotConnected
+	}
+	tok, err := tokens.GetOAuthToken(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, errGoogleNotConnected
+	}
+	ts := &persistingTokenSource{
+		tenant: tenant,
+		store:  tokens,
+		last:   tok,
+		base:   oc.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, sharedHTTPClient), tok),
+	}
+	return option.WithTokenSource(oauth2.ReuseTokenSource(tok, ts)), nil
+}
+
+// persistingTokenSource guarda el token cada vez que Google lo renueva, así las otras
+// réplicas (y el próximo arranque) no tienen que volver a refrescarlo.
+type persistingTokenSource struct {
+	tenant string
+	store  OAuthTokenStore
+	base   oauth2.TokenSource
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		return nil, fmt.Errorf("renovando token de Google de %s: %w", s.tenant, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil || tok.AccessToken != s.last.AccessToken {
+		if tok.RefreshToken == "" && s.last != nil {
+			tok.RefreshToken = s.last.RefreshToken
+		}
+		if err := s.store.SaveOAuthToken(s.tenant, tok); err != nil {
+			log.Printf("⚠️ tenant=%s no pude guardar el token renovado de Google: %v", s.tenant, err)
+		}
+		s.last = tok
+	}
+	return tok, nil
+}
+
+// ---------------------
+// State (anti-CSRF)
+// ---------------------
+// El state viaja firmado: "tenant|vence" + HMAC. No hace falta guardarlo y sirve aunque el
+// callback caiga en otra réplica. La clave es OAUTH_STATE_SECRET o, si no está, una derivada
+// de todos los tokens admin (ADMIN_TOKEN y ADMIN_TOKENS; rotarlos invalida los links
+// pendientes). Sin ninguno de los dos, connect y el callback quedan deshabilitados: con una
+// clave vacía cualquiera podría firmar un state y conectar su cuenta a otro tenant.
+
+// oauthStateKey devuelve la clave del HMAC (nil = no hay secreto configurado).
+func oauthStateKey() []byte {
+	if s := strings.TrimSpace(os.Getenv("OAUTH_STATE_SECRET")); s != "" {
+		return []byte(s)
+	}
+	var tokens []string
+	if t := strings.TrimSpace(os.Getenv("ADMIN_TOKEN")); t != "" {
+		tokens = append(tokens, t)
+	}
+	operators := parseTenantMap(os.Getenv("ADMIN_TOKENS"))
+	for _, name := range sortedKeys(operators) {
+		if t := operators[name]; t != "" {
+			tokens = append(tokens, name+"="+t)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	sum := sha256.Sum256([]byte("flowly-oauth-state\n" + strings.Join(tokens, "\n")))
+	return sum[:]
+}
+
+var errOAuthStateSecret = errors.New("falta OAUTH_STATE_SECRET (o un token admin) para firmar el state de OAuth")
+
+func signOAuthState(tenant string, expires time.Time) (string, error) {
+	key := oauthStateKey()
+	if key == nil {
+		return "", errOAuthStateSecret
+	}
+	payload := tenant + "|" + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func verifyOAuthState(state string) (string, error) {
+	key := oauthStateKey()
+	if key == nil {
+		return "", errOAuthStateSecret
+	}
+	enc, sig, ok := strings.Cut(state, ".")
+	if !ok {
+		return "", errors.New("state inválido")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return "", errors.New("state inválido")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(raw)
+	want := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return "", errors.New("state con firma inválida")
+	}
+	tenant, exp, ok := strings.Cut(string(raw), "|")
+	sec, err := strconv.ParseInt(exp, 10, 64)
+	if !ok || err != nil || tenant == "" {
+		return "", errors.New("state inválido")
+	}
+	if time.Now().After(time.Unix(sec, 0)) {
+		return "", errors.New("el link de autorización venció, generá uno nuevo")
+	}
+	return tenant, nil
+}
+
+// ---------------------
+// HTTP
+// ---------------------
+
+func (a *App) handleAdminGoogleConnect(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	oc := googleOAuthConfig()
+	if oc == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "OAuth de Google no configurado")
+		return
+	}
+	state, err := signOAuthState(tenant, time.Now().Add(oauthStateTTL))
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	// offline + consent: Google solo devuelve refresh token así
+	u := oc.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+	writeJSON(w, http.StatusOK, map[string]string{"tenant": tenant, "url": u})
+}
+
+func (a *App) handleAdminGoogleDisconnect(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	if err := a.oauthTokens.DeleteOAuthToken(tenant); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.calendars.Invalidate(tenant)
+	a.notifyReplicas(clusterCalendar, tenant)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "tenant": tenant})
+}
+
+// handleGoogleOAuthCallback es público: lo llama el navegador al volver de Google.
+func (a *App) handleGoogleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	oc := googleOAuthConfig()
+	if oc == nil {
+		http.Error(w, "OAuth de Google no configurado", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	tenant, err := verifyOAuthState(q.Get("state"))
+	if errors.Is(err, errOAuthStateSecret) {
+		http.Error(w, "OAuth de Google no configurado", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "Google rechazó la autorización: "+e, http.StatusBadRequest)
+		return
+	}
+
+	tok, err := oc.Exchange(r.Context(), q.Get("code"))
+	if err != nil {
+		log.Printf("ERROR oauth google tenant=%s: %v", tenant, err)
+		http.Error(w, "No se pudo completar la autorización con Google", http.StatusBadGateway)
+		return
+	}
+	if tok.RefreshToken == "" {
+		http.Error(w, "Google no devolvió refresh token; revocá el acceso y volvé a intentar", http.StatusBadGateway)
+		return
+	}
+	if err := a.oauthTokens.SaveOAuthToken(tenant, tok); err != nil {
+		log.Printf("ERROR guardando token google tenant=%s: %v", tenant, err)
+		http.Error(w, "No se pudo guardar la autorización", http.StatusInternalServerError)
+		return
+	}
+	a.calendars.Invalidate(tenant)
+	a.notifyReplicas(clusterCalendar, tenant)
+
+	log.Printf("🔑 tenant=%s conectó su cuenta de Google", tenant)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "✅ Listo, la agenda de %s quedó conectada. Ya podés cerrar esta ventana.\n", tenant)
+}
+
+// ---------------------
+// Storage
+// ---------------------
+
+type memoryOAuthTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+}
+
+func (m *memoryOAuthTokenStore) GetOAuthToken(tenant string) (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, ok := m.tokens[tenant]; ok {
+		cp := *t
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryOAuthTokenStore) SaveOAuthToken(tenant string, tok *oauth2.Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *tok
+	m.tokens[tenant] = &cp
+	return nil
+}
+
+func (m *memoryOAuthTokenStore) DeleteOAuthToken(tenant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, tenant)
+	return nil
+}
+
+func (s *PostgresStore) GetOAuthToken(tenant string) (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	var raw []byte
+	err := s.db.QueryRowContext(ctx, `SELECT token FROM oauth_tokens WHERE tenant = $1 AND provider = 'google'`, tenant).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tok oauth2.Token
+	if err := json.Unmarshal(raw, &tok); err != nil {
+		return nil, fmt.Errorf("token guardado inválido: %w", err)
+	}
+	return &tok, nil
+}
+
+func (s *PostgresStore) SaveOAuthToken(tenant string, tok *oauth2.Token) error {
+	raw, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO oauth_tokens (tenant, provider, token, updated_at)
+		VALUES ($1, 'google', $2, now())
+		ON CONFLICT (tenant, provider) DO UPDATE SET token = EXCLUDED.token, updated_at = now()`,
+		tenant, raw)
+	return err
+}
+
+func (s *PostgresStore) DeleteOAuthToken(tenant string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM oauth_tokens WHERE tenant = $1 AND provider = 'google'`, tenant)
+	return err
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestOAuthStateNeedsSecret(t *testing.T) {
+	t.Setenv("OAUTH_STATE_SECRET", "")
+	t.Setenv("ADMIN_TOKEN", "")
+	t.Setenv("ADMIN_TOKENS", "")
+
+	if _, err := signOAuthState("broker", time.Now().Add(time.Minute)); err == nil {
+		t.Fatal("sin secreto no se tiene que poder firmar el state")
+	}
+	// Un state firmado con clave vacía (lo que podía armar cualquiera)
+	payload := "broker|" + strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte(payload))
+	forged := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + hex.EncodeToString(mac.Sum(nil))
+	if _, err := verifyOAuthState(forged); err == nil {
+		t.Fatal("sin secreto no se tiene que aceptar ningún state")
+	}
+}
+
+func TestOAuthStateWithOperatorTokens(t *testing.T) {
+	t.Setenv("OAUTH_STATE_SECRET", "")
+	t.Setenv("ADMIN_TOKEN", "")
+	t.Setenv("ADMIN_TOKENS", "ana:tok_ana,bruno:tok_bruno")
+
+	state, err := signOAuthState("broker", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant, err := verifyOAuthState(state); err != nil || tenant != "broker" {
+		t.Fatalf("verifyOAuthState = %q, %v", tenant, err)
+	}
+
+	// Otro juego de tokens es otra clave
+	t.Setenv("ADMIN_TOKENS", "ana:otro")
+	if _, err := verifyOAuthState(state); err == nil {
+		t.Fatal("el state tenía que dejar de valer con otra clave")
+	}
+}
+
+func TestOAuthStateExpires(t *testing.T) {
+	t.Setenv("OAUTH_STATE_SECRET", "s3cret")
+	state, err := signOAuthState("broker", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyOAuthState(state); err == nil {
+		t.Fatal("un state vencido no tiene que valer")
+	}
+}
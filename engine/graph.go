@@ -0,0 +1,515 @@
+package engine
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ---------------------
+// flowly graph (visualización del flow)
+// ---------------------
+// Dibuja la máquina de estados con las transiciones etiquetadas (el título de la opción,
+// la keyword, "timeout", "HTTP 200"...), para revisar la estructura de un flow sin leer el
+// JSON:
+//
+//	flowly graph -tenant broker -o flow.dot          (Graphviz: dot -Tpng flow.dot > flow.png)
+//	flowly graph -tenant broker -o flow.mmd          (Mermaid: se pega en GitHub / Notion)
+//	flowly graph -format svg configs/broker/versions/v7.json > v7.svg
+//
+// El formato sale de la extensión de -o (.dot, .mmd, .svg) o de -format (default dot).
+// Desde la API admin sale directo en SVG (no hace falta tener Graphviz instalado):
+//
+//	GET /admin/tenants/{tenant}/flow/graph?version=v7&format=svg|dot|mermaid
+//
+// Además de los estados aparecen dos nodos de referencia: "(inicio)", con las entradas de
+// una sesión nueva (entry, first_contact_state, returning_state), y "(cualquier estado)",
+// con lo que se alcanza desde cualquier lado (global_commands, intents, fuera de horario).
+// Esas transiciones van punteadas.
+
+const (
+	graphStartNode    = "(inicio)"
+	graphAnyNode      = "(cualquier estado)"
+	graphPreviousNode = "(estado anterior)"
+	maxGraphLabel     = 40
+)
+
+type flowGraph struct {
+	Name  string
+	Nodes []graphNode
+	Edges []graphEdge
+}
+
+type graphNode struct {
+	ID      string
+	Type    string
+	Virtual bool // nodos de referencia, no son estados del flow
+}
+
+type graphEdge struct {
+	From, To string
+	Labels   []string
+	Global   bool
+}
+
+// buildFlowGraph arma el grafo del flow. Las transiciones repetidas entre los mismos dos
+// estados se juntan en una sola flecha con todas las etiquetas.
+func buildFlowGraph(name string, cfg FlowConfig) flowGraph {
+	g := flowGraph{Name: name}
+	edges := make(map[[2]string]int)
+	addEdge := func(from, to, label string, global bool) {
+		if to == previousState {
+			to = graphPreviousNode
+		}
+		label = truncateRunes(label, maxGraphLabel)
+		if i, ok := edges[[2]string{from, to}]; ok {
+			g.Edges[i].Labels = append(g.Edges[i].Labels, label)
+			return
+		}
+		edges[[2]string{from, to}] = len(g.Edges)
+		g.Edges = append(g.Edges, graphEdge{From: from, To: to, Labels: []string{label}, Global: global})
+	}
+
+	g.Nodes = append(g.Nodes, graphNode{ID: graphStartNode, Virtual: true})
+	addEdge(graphStartNode, cfg.Entry(), "sesión nueva", true)
+	if cfg.FirstContactState != "" {
+		addEdge(graphStartNode, cfg.FirstContactState, "primer contacto", true)
+	}
+	if cfg.ReturningState != "" {
+		addEdge(graphStartNode, cfg.ReturningState, "vuelve", true)
+	}
+
+	for _, state := range sortedStateNames(cfg) {
+		st := cfg.States[state]
+		g.Nodes = append(g.Nodes, graphNode{ID: state, Type: st.Type})
+		titles := stateOptionTitles(st)
+		for _, t := range stateTransitions(st) {
+			addEdge(state, t.To, graphEdgeLabel(t.Via, titles), false)
+		}
+	}
+
+	for _, kw := range sortedKeys(cfg.GlobalCommands) {
+		if target := cfg.GlobalCommands[kw]; !globalBuiltins[target] {
+			addEdge(graphAnyNode, target, fmt.Sprintf("%q", kw), true)
+		}
+	}
+	for _, in := range cfg.Intents {
+		label := in.Name
+		if label == "" {
+			label = "/" + in.Pattern + "/"
+		}
+		addEdge(graphAnyNode, in.Next, label, true)
+	}
+	if bh := cfg.BusinessHours; bh != nil && bh.OutOfHoursState != "" {
+		addEdge(graphAnyNode, bh.OutOfHoursState, "fuera de horario", true)
+	}
+
+	for _, e := range g.Edges {
+		if e.From == graphAnyNode {
+			g.Nodes = append(g.Nodes, graphNode{ID: graphAnyNode, Virtual: true})
+			break
+		}
+	}
+	for _, e := range g.Edges {
+		if e.To == graphPreviousNode {
+			g.Nodes = append(g.Nodes, graphNode{ID: graphPreviousNode, Virtual: true})
+			break
+		}
+	}
+	return g
+}
+
+// stateOptionTitles: id de row/botón -> título que ve el usuario.
+func stateOptionTitles(st FlowState) map[string]string {
+	titles := make(map[string]string)
+	if st.List != nil {
+		for _, sec := range st.List.Sections {
+			for _, row := range sec.Rows {
+				titles[row.ID] = row.Title
+			}
+		}
+	}
+	if st.Buttons != nil {
+		for _, b := range st.Buttons.Buttons {
+			titles[b.ID] = b.Title
+		}
+	}
+	return titles
+}
+
+// graphEdgeLabel traduce el Via de stateTransitions a algo legible.
+func graphEdgeLabel(via string, titles map[string]string) string {
+	key := ""
+	if i := strings.IndexByte(via, '['); i >= 0 && strings.HasSuffix(via, "]") {
+		via, key = via[:i], via[i+1:len(via)-1]
+	}
+	switch via {
+	case "on_text_next":
+		return "texto"
+	case "on_select_next":
+		if t := titles[key]; t != "" {
+			return t
+		}
+		return key
+	case "on_keyword_next":
+		return fmt.Sprintf("%q", key)
+	case "on_order_next":
+		return "pedido"
+	case "http.on_status_next":
+		return "HTTP " + key
+	case "http.on_error_next":
+		return "HTTP error"
+	case "on_read_no_reply.next":
+		return "leído sin respuesta"
+	case "on_timeout_next":
+		return "timeout"
+	case "ai.on_error_next":
+		return "IA error"
+	case "on_action_error":
+		return "error " + key
+	}
+	if key != "" {
+		return via + "[" + key + "]"
+	}
+	return via
+}
+
+// graphFillColor: color del nodo según el tipo de estado.
+func graphFillColor(n graphNode) string {
+	switch {
+	case n.Virtual:
+		return "#f3f4f6"
+	case n.Type == "interactive_list" || n.Type == "interactive_buttons":
+		return "#dbeafe"
+	case n.Type == "form" || n.Type == surveyStateType:
+		return "#fef3c7"
+	case n.Type == "http_action":
+		return "#ede9fe"
+	case n.Type == "ai_fallback":
+		return "#dcfce7"
+	case n.Type == "product" || n.Type == "product_list" || n.Type == "catalog":
+		return "#fce7f3"
+	}
+	return "#ffffff"
+}
+
+// ---------------------
+// Formatos
+// ---------------------
+
+func (g flowGraph) DOT() string {
+	q := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", q(g.Name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\", fontsize=11];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=9];\n")
+	for _, n := range g.Nodes {
+		label, extra := n.ID, ""
+		if n.Type != "" {
+			label += "\n" + n.Type
+		}
+		if n.Virtual {
+			extra = ", style=\"dashed,filled\", fontcolor=\"#6b7280\""
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, fillcolor=%s%s];\n", q(n.ID), q(label), q(graphFillColor(n)), extra)
+	}
+	for _, e := range g.Edges {
+		extra := ""
+		if e.Global {
+			extra = ", style=dashed, color=\"#9ca3af\""
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s%s];\n", q(e.From), q(e.To), q(strings.Join(e.Labels, "\n")), extra)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (g flowGraph) Mermaid() string {
+	q := func(s string) string {
+		return `"` + strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s) + `"`
+	}
+	ids := make(map[string]string, len(g.Nodes))
+	missing := 0
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+		label := n.ID
+		if n.Type != "" {
+			label += "\n" + n.Type
+		}
+		fmt.Fprintf(&b, "  %s[%s]\n", ids[n.ID], q(label))
+		fmt.Fprintf(&b, "  style %s fill:%s\n", ids[n.ID], graphFillColor(n))
+	}
+	for _, e := range g.Edges {
+		from, to := ids[e.From], ids[e.To]
+		if to == "" { // transición a un estado inexistente (la marca el lint)
+			missing++
+			to = fmt.Sprintf("missing%d", missing)
+			fmt.Fprintf(&b, "  %s[%s]\n", to, q(e.To+"\n(no existe)"))
+			ids[e.To] = to
+		}
+		arrow := "-->"
+		if e.Global {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|%s| %s\n", from, arrow, q(strings.Join(e.Labels, "\n")), to)
+	}
+	return b.String()
+}
+
+// SVG dibuja el grafo sin Graphviz: una columna por distancia desde "(inicio)" (BFS), los
+// nodos de cada columna en el orden en que se descubren. Las flechas hacia adelante van por
+// el medio; las que vuelven a una columna anterior (o a la misma) van por abajo.
+func (g flowGraph) SVG() string {
+	const (
+		charW   = 7
+		nodeH   = 38
+		rowGap  = 26
+		colGap  = 150
+		padding = 30
+	)
+
+	nodes := make(map[string]graphNode, len(g.Nodes))
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+	}
+	out := make(map[string][]graphEdge)
+	for _, e := range g.Edges {
+		out[e.From] = append(out[e.From], e)
+	}
+	layer := map[string]int{graphStartNode: 0}
+	order := []string{graphStartNode}
+	if _, ok := nodes[graphAnyNode]; ok {
+		layer[graphAnyNode] = 0
+		order = append(order, graphAnyNode)
+	}
+	for i := 0; i < len(order); i++ {
+		for _, e := range out[order[i]] {
+			if _, seen := layer[e.To]; !seen && nodes[e.To].ID != "" {
+				layer[e.To] = layer[order[i]] + 1
+				order = append(order, e.To)
+			}
+		}
+	}
+	maxLayer := 0
+	for _, l := range layer {
+		maxLayer = max(maxLayer, l)
+	}
+	for _, n := range g.Nodes { // inalcanzables: última columna
+		if _, ok := layer[n.ID]; !ok {
+			layer[n.ID] = maxLayer + 1
+			order = append(order, n.ID)
+		}
+	}
+
+	type box struct{ x, y, w int }
+	columns := make(map[int][]string)
+	colW := make(map[int]int)
+	numCols := 0
+	for _, id := range order {
+		l := layer[id]
+		columns[l] = append(columns[l], id)
+		colW[l] = max(colW[l], graphNodeWidth(nodes[id], charW))
+		numCols = max(numCols, l+1)
+	}
+	boxes := make(map[string]box, len(order))
+	x, height := padding, 0
+	for l := 0; l < numCols; l++ {
+		for i, id := range columns[l] {
+			boxes[id] = box{x: x, y: padding + i*(nodeH+rowGap), w: colW[l]}
+		}
+		height = max(height, padding+len(columns[l])*(nodeH+rowGap))
+		x += colW[l] + colGap
+	}
+	width := x - colGap + padding
+	height += padding + 40 // lugar para las flechas de vuelta
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(g.Name))
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="7" markerHeight="7" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#6b7280"/></marker></defs>` + "\n")
+	b.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/>` + "\n")
+
+	for _, e := range g.Edges {
+		from, okFrom := boxes[e.From]
+		to, okTo := boxes[e.To]
+		if !okFrom || !okTo {
+			continue
+		}
+		var path string
+		var lx, ly float64
+		if layer[e.To] > layer[e.From] {
+			x1, y1 := float64(from.x+from.w), float64(from.y+nodeH/2)
+			x2, y2 := float64(to.x), float64(to.y+nodeH/2)
+			c := (x2 - x1) / 2
+			path = fmt.Sprintf("M%.0f,%.0f C%.0f,%.0f %.0f,%.0f %.0f,%.0f", x1, y1, x1+c, y1, x2-c, y2, x2, y2)
+			lx, ly = (x1+x2)/2, (y1+y2)/2
+		} else {
+			x1, y1 := float64(from.x+from.w/2), float64(from.y+nodeH)
+			x2, y2 := float64(to.x+to.w/2), float64(to.y+nodeH)
+			drop := 30 + 0.15*math.Abs(x1-x2)
+			bottom := max(y1, y2) + drop
+			path = fmt.Sprintf("M%.0f,%.0f C%.0f,%.0f %.0f,%.0f %.0f,%.0f", x1, y1, x1, bottom, x2, bottom, x2, y2)
+			lx, ly = (x1+x2)/2, (y1+y2)/2+0.75*drop
+		}
+		dash := ""
+		if e.Global {
+			dash = ` stroke-dasharray="5,4"`
+		}
+		fmt.Fprintf(&b, `<path d="%s" fill="none" stroke="#9ca3af" stroke-width="1.2"%s marker-end="url(#arrow)"/>`+"\n", path, dash)
+		for i, label := range e.Labels {
+			fmt.Fprintf(&b, `<text x="%.0f" y="%.0f" font-size="10" fill="#374151" text-anchor="middle" stroke="#ffffff" stroke-width="3" paint-order="stroke">%s</text>`+"\n",
+				lx, ly+float64(i*12)-float64((len(e.Labels)-1)*6), html.EscapeString(label))
+		}
+	}
+
+	for _, id := range order {
+		n, bx := nodes[id], boxes[id]
+		dash := ""
+		if n.Virtual {
+			dash = ` stroke-dasharray="4,3"`
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="8" fill="%s" stroke="#6b7280"%s/>`+"\n", bx.x, bx.y, bx.w, nodeH, graphFillColor(n), dash)
+		cx := bx.x + bx.w/2
+		if n.Type == "" {
+			fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="12" text-anchor="middle" dominant-baseline="middle">%s</text>`+"\n", cx, bx.y+nodeH/2, html.EscapeString(n.ID))
+			continue
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="12" font-weight="bold" text-anchor="middle">%s</text>`+"\n", cx, bx.y+16, html.EscapeString(n.ID))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="10" fill="#6b7280" text-anchor="middle">%s</text>`+"\n", cx, bx.y+30, html.EscapeString(n.Type))
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+func graphNodeWidth(n graphNode, charW int) int {
+	return 24 + charW*max(runeLen(n.ID), runeLen(n.Type))
+}
+
+// render devuelve el grafo en el formato pedido y su Content-Type.
+func (g flowGraph) render(format string) (string, string, error) {
+	switch format {
+	case "dot":
+		return g.DOT(), "text/vnd.graphviz; charset=utf-8", nil
+	case "mermaid":
+		return g.Mermaid(), "text/plain; charset=utf-8", nil
+	case "svg":
+		return g.SVG(), "image/svg+xml", nil
+	}
+	return "", "", fmt.Errorf("formato no soportado: %q (dot, mermaid o svg)", format)
+}
+
+// ---------------------
+// CLI
+// ---------------------
+
+func runGraph(args []string) int {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	tenant := fs.String("tenant", "", "tenant de "+ConfigRoot+"/ (en vez de un archivo)")
+	version := fs.String("version", "", "con -tenant: versión del flow (default: la publicada)")
+	format := fs.String("format", "", "dot, mermaid o svg (default: según la extensión de -o, si no dot)")
+	out := fs.String("o", "", "archivo de salida (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*tenant == "") == (fs.NArg() != 1) {
+		fmt.Fprintln(os.Stderr, "uso: flowly graph [-format dot|mermaid|svg] [-o archivo] (-tenant T [-version V] | <flow.json>)")
+		return 2
+	}
+
+	var name string
+	var cfg FlowConfig
+	var err error
+	if *tenant != "" {
+		v := *version
+		if v == "" {
+			p, perr := readPublishedPointer(*tenant)
+			if perr != nil {
+				fmt.Fprintln(os.Stderr, perr)
+				return 1
+			}
+			v = p.Version
+		}
+		name = *tenant + "@" + v
+		cfg, err = loadFlowVersion(*tenant, v)
+	} else {
+		name = fs.Arg(0)
+		_, cfg, err = readFlowFile(fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	f := *format
+	if f == "" {
+		switch filepath.Ext(*out) {
+		case ".mmd", ".mermaid":
+			f = "mermaid"
+		case ".svg":
+			f = "svg"
+		default:
+			f = "dot"
+		}
+	}
+	s, _, err := buildFlowGraph(name, cfg).render(f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *out == "" {
+		os.Stdout.WriteString(s)
+		return 0
+	}
+	if err := writeFileAtomic(*out, []byte(s)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// ---------------------
+// Admin endpoint
+// ---------------------
+
+func (a *App) handleAdminFlowGraph(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		version = a.cache.Published(tenant)
+	}
+	if !validFlowVersionName(version) {
+		writeJSONError(w, http.StatusBadRequest, "nombre de versión inválido")
+		return
+	}
+	cfg, err := a.cache.LoadVersion(tenant, version)
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "versión no encontrada")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	s, contentType, err := buildFlowGraph(tenant+"@"+version, cfg).render(format)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write([]byte(s))
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Versión de la Graph API
+// ---------------------
+// La versión sale de GRAPH_API_VERSION (default v24.0) y cada tenant puede tener la suya
+// (la de su app de Meta, ver webhook_apps.go):
+//
+//	GRAPH_API_VERSION=v24.0
+//	TENANT_GRAPH_API_VERSIONS=broker:v23.0
+//
+// Al arrancar se valida contra la tabla de wa (wa.CheckVersion): una versión mal escrita o
+// más vieja que la primera de la tabla no arranca; una más nueva que la última arranca con un
+// warning y los payloads salen como para la última. Las diferencias entre versiones viven en
+// flowly/wa (graph_version.go), no acá.
+
+// checkGraphVersions valida la versión del deployment y las de los tenants.
+func (w *WebhookApps) checkGraphVersions() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	check := map[string]string{"GRAPH_API_VERSION": wa.APIVersion()}
+	for _, tenant := range sortedKeys(w.graphVersions) {
+		check["TENANT_GRAPH_API_VERSIONS "+tenant] = w.graphVersions[tenant]
+	}
+	var errs []error
+	for _, name := range sortedKeys(check) {
+		warning, err := wa.CheckVersion(check[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		if warning != "" {
+			log.Printf("⚠️ %s: %s", name, warning)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// graphVersion devuelve la versión propia del tenant ("" = GRAPH_API_VERSION).
+func (w *WebhookApps) graphVersion(tenant string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.graphVersions[tenant]
+}
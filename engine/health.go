@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ---------------------
+// Health checks
+// ---------------------
+// /healthz: el proceso está vivo (liveness).
+// /readyz: puede atender tráfico (readiness), con el estado de cada dependencia:
+//   - config: el flow publicado de cada tenant carga y valida
+//   - database / redis: responden (si están configurados)
+//   - google_credentials: el archivo de GOOGLE_APPLICATION_CREDENTIALS es un service account válido
+//
+// Si alguna dependencia falla, /readyz responde 503.
+
+var (
+	processStartedAt = time.Now()
+	errHealthSkipped = errors.New("no configurado")
+)
+
+type healthCheck struct {
+	Status    string `json:"status"` // ok | fail | skipped
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+func runHealthCheck(fn func() error) healthCheck {
+	start := time.Now()
+	err := fn()
+	hc := healthCheck{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+	if errors.Is(err, errHealthSkipped) {
+		hc.Status = "skipped"
+	} else if err != nil {
+		hc.Status = "fail"
+		hc.Error = err.Error()
+	}
+	return hc
+}
+
+func (a *App) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(processStartedAt).Seconds()),
+	})
+}
+
+func (a *App) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"config": runHealthCheck(a.checkConfigs),
+		"database": runHealthCheck(func() error {
+			if a.store == nil {
+				return errHealthSkipped
+			}
+			return a.store.Ping()
+		}),
+		"redis": runHealthCheck(func() error {
+			if a.redis == nil {
+				return errHealthSkipped
+			}
+			return a.redis.Ping()
+		}),
+		"google_credentials": runHealthCheck(checkGoogleCredentials),
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, hc := range checks {
+		if hc.Status == "fail" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// checkConfigs carga el flow publicado de cada tenant en configs/.
+func (a *App) checkConfigs() error {
+	entries, err := os.ReadDir(ConfigRoot)
+	if err != nil {
+		return err
+	}
+	var failed []string
+	loaded := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := a.cache.Load(e.Name()); err != nil {
+			failed = append(failed, e.Name())
+			continue
+		}
+		loaded++
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("no cargan los flows de: %v", failed)
+	}
+	if loaded == 0 {
+		return errors.New("no hay tenants configurados")
+	}
+	return nil
+}
+
+// checkGoogleCredentials valida el JSON del service account (sin pedir un token a Google).
+func checkGoogleCredentials() error {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		return errHealthSkipped
+	}
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	var creds struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return fmt.Errorf("credenciales inválidas: %w", err)
+	}
+	if creds.Type != "service_account" || creds.ClientEmail == "" || creds.PrivateKey == "" {
+		return errors.New("las credenciales no son de un service account completo")
+	}
+	return nil
+}
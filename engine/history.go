@@ -0,0 +1,75 @@
+package engine
+
+import "strings"
+
+// ---------------------
+// State history (back navigation)
+// ---------------------
+// La sesión guarda los últimos estados visitados (pila acotada en _history). Para volver:
+//
+//   - "{previous}" como destino de on_select_next / on_text_next / on_action_error:
+//     "on_select_next": { "OPT_BACK": "{previous}" }
+//   - el comando global "back" (ver global_commands.go): "global_commands": { "volver": "back" }
+//
+// Volver saca el último estado de la pila (no apila el actual). Si la pila está vacía vuelve
+// al estado de entrada, y llegar al estado de entrada la vacía.
+
+const (
+	previousState   = "{previous}"
+	historyVar      = "_history"
+	historySep      = "|"
+	maxHistoryDepth = 10
+)
+
+func sessionHistory(sess *UserSession) []string {
+	if h := sess.Data[historyVar]; h != "" {
+		return strings.Split(h, historySep)
+	}
+	return nil
+}
+
+func setSessionHistory(sess *UserSession, h []string) {
+	if len(h) == 0 {
+		delete(sess.Data, historyVar)
+		return
+	}
+	sess.Data[historyVar] = strings.Join(h, historySep)
+}
+
+// pushHistory apila state, descartando lo más viejo si se pasa de maxHistoryDepth.
+func pushHistory(sess *UserSession, state string) {
+	h := sessionHistory(sess)
+	if n := len(h); n > 0 && h[n-1] == state {
+		return
+	}
+	h = append(h, state)
+	if len(h) > maxHistoryDepth {
+		h = h[len(h)-maxHistoryDepth:]
+	}
+	setSessionHistory(sess, h)
+}
+
+// popHistory devuelve el estado anterior que todavía existe en el flow (o el de entrada).
+func popHistory(sess *UserSession, cfg FlowConfig) string {
+	h := sessionHistory(sess)
+	for len(h) > 0 {
+		prev := h[len(h)-1]
+		h = h[:len(h)-1]
+		if _, ok := cfg.States[prev]; ok && prev != sess.State {
+			setSessionHistory(sess, h)
+			return prev
+		}
+	}
+	setSessionHistory(sess, nil)
+	return cfg.Entry()
+}
+
+// recordHistory actualiza la pila al pasar de prevState a nextState.
+func recordHistory(sess *UserSession, cfg FlowConfig, prevState, nextState string, wentBack bool) {
+	switch {
+	case nextState == cfg.Entry():
+		setSessionHistory(sess, nil)
+	case !wentBack && prevState != nextState && prevState != "":
+		pushHistory(sess, prevState)
+	}
+}
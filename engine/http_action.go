@@ -0,0 +1,332 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// HTTP action states
+// ---------------------
+// Un estado "http_action" no se renderiza: hace un request HTTP, guarda campos
+// de la respuesta en la sesión y salta al próximo estado según el status code.
+//
+// Ejemplo:
+//
+//	"QUOTE_LOOKUP": {
+//	  "type": "http_action",
+//	  "http": {
+//	    "method": "POST",
+//	    "url": "https://crm.example.com/api/quotes?phone={{wa_id}}",
+//	    "headers": { "Authorization": "Bearer ${HTTP_ACTION_CRM_TOKEN}" },
+//	    "body": { "name": "{{name}}", "product": "{{last_selected_id}}" },
+//	    "store": { "quote_price": "$.data.price", "quote_id": "$.data.id" },
+//	    "on_status_next": { "2xx": "QUOTE_READY", "404": "QUOTE_NOT_FOUND", "default": "QUOTE_ERROR" },
+//	    "on_error_next": "QUOTE_ERROR"
+//	  }
+//	}
+//
+// En headers solo se expanden las ENV HTTP_ACTION_* y FLOW_SECRET_* (el flow elige la URL,
+// así que no puede mandar cualquier ENV del proceso, ej: WHATSAPP_TOKEN o los secrets de
+// Vault): cualquier otra ${ENV} no pasa la validación.
+
+const (
+	defaultHTTPActionTimeout = 10 * time.Second
+	maxHTTPActionBody        = 1 << 20 // 1 MiB
+	maxTransientHops         = 10
+)
+
+type FlowHTTPAction struct {
+	Method         string            `json:"method,omitempty"` // default GET
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"` // ${HTTP_ACTION_*} / ${FLOW_SECRET_*} se expanden (para tokens)
+	Body           json.RawMessage   `json:"body,omitempty"`    // JSON con {{vars}} dentro de los strings
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+
+	// Store: variable de sesión -> JSONPath en la respuesta (ej: "$.data.items[0].price")
+	Store map[string]string `json:"store,omitempty"`
+
+	// OnStatusNext: "200" | "2xx" | "4xx" | "5xx" | "default" -> próximo estado
+	OnStatusNext map[string]string `json:"on_status_next,omitempty"`
+	// OnErrorNext: error de red / timeout / respuesta inválida
+	OnErrorNext string `json:"on_error_next,omitempty"`
+}
+
+func validateHTTPAction(stateName string, h *FlowHTTPAction) []string {
+	var errs []string
+	if h == nil {
+		return []string{fmt.Sprintf("state=%s es http_action pero http es nil", stateName)}
+	}
+	if strings.TrimSpace(h.URL) == "" {
+		errs = append(errs, fmt.Sprintf("state=%s http.url vacío", stateName))
+	}
+	switch strings.ToUpper(strings.TrimSpace(h.Method)) {
+	case "", "GET", "POST", "PUT", "PATCH", "DELETE":
+	default:
+		errs = append(errs, fmt.Sprintf("state=%s http.method no soportado: %q", stateName, h.Method))
+	}
+	if len(h.Body) > 0 && !json.Valid(h.Body) {
+		errs = append(errs, fmt.Sprintf("state=%s http.body no es JSON válido", stateName))
+	}
+	if len(h.OnStatusNext) == 0 && h.OnErrorNext == "" {
+		errs = append(errs, fmt.Sprintf("state=%s http_action sin on_status_next ni on_error_next", stateName))
+	}
+	for v, p := range h.Store {
+		if !strings.HasPrefix(p, "$") {
+			errs = append(errs, fmt.Sprintf("state=%s http.store[%s] JSONPath inválido: %q", stateName, v, p))
+		}
+	}
+	for _, k := range sortedKeys(h.Headers) {
+		errs = append(errs, validateFlowSecretRefs(fmt.Sprintf("state=%s http.headers[%s]", stateName, k), h.Headers[k])...)
+	}
+	errs = append(errs, validateRequestTimeout(fmt.Sprintf("state=%s http.timeout_seconds", stateName), h.TimeoutSeconds)...)
+	return errs
+}
+
+// flowSecretPrefixes: las únicas ENV que un flow puede expandir en lo que manda a URLs que
+// elige él (headers de http_action, on_complete_webhook).
+var flowSecretPrefixes = []string{"HTTP_ACTION_", "FLOW_SECRET_"}
+
+func flowSecretAllowed(name string) bool {
+	for _, p := range flowSecretPrefixes {
+		if strings.HasPrefix(name, p) && len(name) > len(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandFlowSecrets expande ${ENV} / $ENV solo si la ENV tiene un prefijo permitido (el
+// resto queda vacío; la validación ya lo rechazó).
+func expandFlowSecrets(s string) string {
+	return os.Expand(s, func(name string) string {
+		if !flowSecretAllowed(name) {
+			return ""
+		}
+		return os.Getenv(name)
+	})
+}
+
+func validateFlowSecretRefs(field, s string) []string {
+	var errs []string
+	os.Expand(s, func(name string) string {
+		if !flowSecretAllowed(name) {
+			errs = append(errs, fmt.Sprintf("%s: ${%s} no permitida (solo %s*)", field, name, strings.Join(flowSecretPrefixes, "* / ")))
+		}
+		return ""
+	})
+	return errs
+}
+
+// runHTTPAction ejecuta el request y devuelve el próximo estado y las variables capturadas.
+func runHTTPAction(ctx context.Context, client *http.Client, stateName string, h *FlowHTTPAction, vars map[string]string) (string, map[string]string) {
+	out := map[string]string{}
+
+	method := strings.ToUpper(strings.TrimSpace(h.Method))
+	if method == "" {
+		method = "GET"
+	}
+	target := renderVarsEscaped(h.URL, vars, url.QueryEscape)
+
+	var body io.Reader
+	if len(h.Body) > 0 {
+		body = strings.NewReader(renderVarsEscaped(string(h.Body), vars, jsonEscape))
+	}
+
+	timeout := defaultHTTPActionTimeout
+	if h.TimeoutSeconds > 0 {
+		timeout = time.Duration(h.TimeoutSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		log.Printf("❌ http_action %s: request inválido: %v", stateName, err)
+		return h.OnErrorNext, out
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, renderVars(expandFlowSecrets(v), vars))
+	}
+
+	resp, err := httpClientOrShared(client).Do(req)
+	if err != nil {
+		log.Printf("❌ http_action %s: %s %s: %v", stateName, method, req.URL.Redacted(), err)
+		return h.OnErrorNext, out
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPActionBody))
+
+	log.Printf("🌐 http_action %s: %s %s -> %d", stateName, method, req.URL.Redacted(), resp.StatusCode)
+	out["http_status"] = strconv.Itoa(resp.StatusCode)
+
+	if len(h.Store) > 0 && len(bytes.TrimSpace(raw)) > 0 {
+		var doc any
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			log.Printf("⚠️ http_action %s: respuesta no es JSON: %v", stateName, err)
+		} else {
+			for varName, p := range h.Store {
+				if v, ok := jsonPathLookup(doc, p); ok {
+					out[varName] = jsonValueString(v)
+				} else {
+					out[varName] = ""
+				}
+			}
+		}
+	}
+
+	return nextForStatus(h, resp.StatusCode), out
+}
+
+func nextForStatus(h *FlowHTTPAction, code int) string {
+	if ns, ok := h.OnStatusNext[strconv.Itoa(code)]; ok {
+		return ns
+	}
+	if ns, ok := h.OnStatusNext[fmt.Sprintf("%dxx", code/100)]; ok {
+		return ns
+	}
+	if ns, ok := h.OnStatusNext["default"]; ok {
+		return ns
+	}
+	return h.OnErrorNext
+}
+
+// renderVarsEscaped es como renderVars pero escapa cada valor (para URLs o JSON).
+func renderVarsEscaped(s string, vars map[string]string, escape func(string) string) string {
+	escaped := make(map[string]string, len(vars))
+	for k, v := range vars {
+		escaped[k] = escape(v)
+	}
+	return renderVars(s, escaped)
+}
+
+// jsonEscape escapa un valor para insertarlo dentro de un string JSON.
+func jsonEscape(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+func jsonValueString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+// jsonPathLookup soporta un subconjunto de JSONPath: $.a.b, $.items[0].name, $["a b"].
+func jsonPathLookup(doc any, p string) (any, bool) {
+	p = strings.TrimSpace(p)
+	if !strings.HasPrefix(p, "$") {
+		return nil, false
+	}
+	p = p[1:]
+	cur := doc
+
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			key := p[:end]
+			p = p[end:]
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[key]; !ok {
+				return nil, false
+			}
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, false
+			}
+			tok := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+			if strings.HasPrefix(tok, `"`) || strings.HasPrefix(tok, "'") {
+				m, ok := cur.(map[string]any)
+				if !ok {
+					return nil, false
+				}
+				if cur, ok = m[strings.Trim(tok, `"'`)]; !ok {
+					return nil, false
+				}
+				continue
+			}
+			idx, err := strconv.Atoi(tok)
+			arr, ok := cur.([]any)
+			if err != nil || !ok {
+				return nil, false
+			}
+			if idx < 0 {
+				idx += len(arr)
+			}
+			if idx < 0 || idx >= len(arr) {
+				return nil, false
+			}
+			cur = arr[idx]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// ---------------------
+// Transient states
+// ---------------------
+
+// resolveTransientStates ejecuta en cadena los estados que no se renderizan
+// (http_action) hasta llegar a uno que sí se muestra al usuario.
+func (a *App) resolveTransientStates(ctx context.Context, tenant string, cfg FlowConfig, state string, sess *UserSession, vars map[string]string) string {
+	for hop := 0; hop < maxTransientHops; hop++ {
+		st, ok := cfg.States[state]
+		if !ok || st.Type != "http_action" {
+			return state
+		}
+
+		next, captured := runHTTPAction(ctx, a.httpClient, state, st.HTTP, vars)
+		if sess.Data == nil {
+			sess.Data = make(map[string]string)
+		}
+		for k, v := range captured {
+			vars[k] = v
+			sess.Data[k] = v
+		}
+
+		if next == "" {
+			log.Printf("⚠️ http_action %s sin transición para el resultado, vuelvo a %s", state, cfg.Fallback())
+			return cfg.Fallback()
+		}
+		state = next
+	}
+	log.Printf("⚠️ tenant=%s demasiados http_action encadenados, vuelvo a %s", tenant, cfg.Fallback())
+	return cfg.Fallback()
+}
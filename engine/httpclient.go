@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// ---------------------
+// Shared HTTP client
+// ---------------------
+// Un único http.Client para todo lo saliente (Graph API, http_action, LLM, webhooks):
+// reutiliza conexiones entre requests y nunca espera para siempre. Los que necesitan un
+// timeout más corto lo ponen en el context del request. Uno más largo no sirve (corta el del
+// cliente), así que un timeout_seconds del flow mayor a HTTP_CLIENT_TIMEOUT_SECONDS no pasa
+// la validación.
+//
+// ENV:
+//
+//	HTTP_CLIENT_TIMEOUT_SECONDS=30
+//	HTTP_CLIENT_MAX_IDLE_PER_HOST=20
+
+const (
+	defaultHTTPClientTimeout = 30 * time.Second
+	defaultMaxIdlePerHost    = 20
+)
+
+func envPositiveInt(name string, def int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name))); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// httpClientTimeout es el timeout total del cliente compartido (HTTP_CLIENT_TIMEOUT_SECONDS).
+func httpClientTimeout() time.Duration {
+	return time.Duration(envPositiveInt("HTTP_CLIENT_TIMEOUT_SECONDS", int(defaultHTTPClientTimeout/time.Second))) * time.Second
+}
+
+// validateRequestTimeout: un timeout_seconds del flow tiene que entrar en el del cliente
+// compartido (si no, se cortaría antes sin aviso).
+func validateRequestTimeout(field string, seconds int) []string {
+	if seconds < 0 {
+		return []string{fmt.Sprintf("%s no puede ser negativo", field)}
+	}
+	if limit := httpClientTimeout(); time.Duration(seconds)*time.Second > limit {
+		return []string{fmt.Sprintf("%s=%d supera el timeout del cliente HTTP (HTTP_CLIENT_TIMEOUT_SECONDS=%d)", field, seconds, int(limit/time.Second))}
+	}
+	return nil
+}
+
+// NewHTTPClientFromEnv arma el cliente compartido con timeouts y pool de conexiones.
+func NewHTTPClientFromEnv() *http.Client {
+	timeout := httpClientTimeout()
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   envPositiveInt("HTTP_CLIENT_MAX_IDLE_PER_HOST", defaultMaxIdlePerHost),
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	// otelhttp: un span por request saliente y propagación del trace (no-op sin tracing)
+	return &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(transport)}
+}
+
+// sharedHTTPClient es el default para los clientes que se arman sin App (ej: CLI).
+var sharedHTTPClient = NewHTTPClientFromEnv()
+
+func httpClientOrShared(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return sharedHTTPClient
+}
@@ -0,0 +1,292 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// i18n (flows multi-idioma)
+// ---------------------
+// Un mismo flow.json puede atender en varios idiomas. Se declaran en "languages" y cada
+// estado trae sus variantes en "i18n" (lo que no se traduce queda con el texto base):
+//
+//	"languages": {
+//	  "default": "es",
+//	  "supported": ["es", "pt", "en"],
+//	  "detect": true,
+//	  "ask_state": "SELECT_LANGUAGE"
+//	},
+//	"states": {
+//	  "MENU": {
+//	    "type": "interactive_buttons",
+//	    "body": "Hola {{name}} 👋",
+//	    "buttons": { "buttons": [{ "id": "BTN_START", "title": "Empezar" }] },
+//	    "i18n": {
+//	      "pt": { "body": "Olá {{name}} 👋", "options": { "BTN_START": { "title": "Começar" } } },
+//	      "en": { "body": "Hi {{name}} 👋", "options": { "BTN_START": { "title": "Start" } } }
+//	    }
+//	  }
+//	}
+//
+// El idioma del usuario queda en la variable de sesión "language":
+//   - detect: en el primer mensaje se deduce del saludo ("olá", "hello"...) o del código de
+//     país del número (+55 -> pt, +1 -> en).
+//   - ask_state: si no se pudo deducir, la sesión arranca en ese estado para preguntarlo.
+//   - Una fila o botón con id "lang:<código>" (ej: "lang:pt") fija el idioma al elegirlo.
+
+const (
+	languageVar        = "language"
+	languageOptionPfx  = "lang:"
+	defaultLanguage    = "es"
+	languageDetectDone = "_language_detected"
+)
+
+type FlowLanguages struct {
+	Default   string   `json:"default,omitempty"` // default: "es"
+	Supported []string `json:"supported"`
+	Detect    bool     `json:"detect,omitempty"`
+	AskState  string   `json:"ask_state,omitempty"`
+}
+
+// FlowStateLocale: textos de un estado en otro idioma.
+type FlowStateLocale struct {
+	Body          string                    `json:"body,omitempty"`
+	Header        string                    `json:"header,omitempty"`
+	Footer        string                    `json:"footer,omitempty"`
+	ButtonText    string                    `json:"button_text,omitempty"`
+	SectionTitles []string                  `json:"section_titles,omitempty"` // por posición
+	Options       map[string]FlowOptionText `json:"options,omitempty"`        // id de fila/botón -> textos
+}
+
+type FlowOptionText struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (l *FlowLanguages) defaultLang() string {
+	if l == nil || l.Default == "" {
+		return defaultLanguage
+	}
+	return l.Default
+}
+
+func (l *FlowLanguages) supports(lang string) bool {
+	if l == nil {
+		return false
+	}
+	for _, s := range l.Supported {
+		if s == lang {
+			return true
+		}
+	}
+	return lang == l.defaultLang()
+}
+
+func validateLanguages(cfg FlowConfig) []string {
+	var errs []string
+	l := cfg.Languages
+	if l != nil {
+		if len(l.Supported) == 0 {
+			errs = append(errs, "languages.supported vacío")
+		}
+		if len(l.Supported) > 0 && !containsString(l.Supported, l.defaultLang()) {
+			errs = append(errs, fmt.Sprintf("languages.default %q no está en languages.supported", l.defaultLang()))
+		}
+		if l.AskState != "" {
+			if _, ok := cfg.States[l.AskState]; !ok {
+				errs = append(errs, fmt.Sprintf("languages.ask_state apunta a un estado inexistente: %q", l.AskState))
+			}
+		}
+	}
+
+	for _, name := range sortedStateNames(cfg) {
+		st := cfg.States[name]
+		if len(st.I18n) > 0 && l == nil {
+			errs = append(errs, fmt.Sprintf("state=%s tiene i18n pero el flow no declara languages", name))
+			continue
+		}
+		ids := make(map[string]bool)
+		for _, id := range stateOptionIDs(st) {
+			ids[id] = true
+		}
+		for _, lang := range sortedKeys(st.I18n) {
+			if !l.supports(lang) {
+				errs = append(errs, fmt.Sprintf("state=%s i18n[%s]: idioma no declarado en languages.supported", name, lang))
+			}
+			for _, id := range sortedKeys(st.I18n[lang].Options) {
+				if !ids[id] {
+					errs = append(errs, fmt.Sprintf("state=%s i18n[%s].options[%q] no corresponde a ninguna opción", name, lang, id))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func containsString(xs []string, s string) bool {
+	for _, x := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// localized devuelve una copia del estado con los textos del idioma (si tiene variante).
+func (st FlowState) localized(lang string) FlowState {
+	loc, ok := st.I18n[lang]
+	if !ok {
+		return st
+	}
+	if loc.Body != "" {
+		st.Body = loc.Body
+	}
+
+	optTitle := func(id, title, desc string) (string, string) {
+		if o, ok := loc.Options[id]; ok {
+			if o.Title != "" {
+				title = o.Title
+			}
+			if o.Description != "" {
+				desc = o.Description
+			}
+		}
+		return title, desc
+	}
+
+	if st.List != nil {
+		list := *st.List
+		if loc.Header != "" {
+			list.Header = loc.Header
+		}
+		if loc.Footer != "" {
+			list.Footer = loc.Footer
+		}
+		if loc.ButtonText != "" {
+			list.ButtonText = loc.ButtonText
+		}
+		list.Sections = make([]FlowSection, len(st.List.Sections))
+		for i, sec := range st.List.Sections {
+			if i < len(loc.SectionTitles) && loc.SectionTitles[i] != "" {
+				sec.Title = loc.SectionTitles[i]
+			}
+			rows := make([]FlowRow, len(sec.Rows))
+			for j, row := range sec.Rows {
+				row.Title, row.Description = optTitle(row.ID, row.Title, row.Description)
+				rows[j] = row
+			}
+			sec.Rows = rows
+			list.Sections[i] = sec
+		}
+		st.List = &list
+	}
+
+	if st.Buttons != nil {
+		btns := *st.Buttons
+		if loc.Header != "" {
+			btns.Header = loc.Header
+		}
+		if loc.Footer != "" {
+			btns.Footer = loc.Footer
+		}
+		btns.Buttons = make([]FlowButton, len(st.Buttons.Buttons))
+		for i, b := range st.Buttons.Buttons {
+			b.Title, _ = optTitle(b.ID, b.Title, "")
+			btns.Buttons[i] = b
+		}
+		st.Buttons = &btns
+	}
+	return st
+}
+
+// ---------------------
+// Idioma de la sesión
+// ---------------------
+
+// languageByCountryCode: código de país -> idioma (el resto no da pista).
+var languageByCountryCode = map[string]string{
+	"54": "es", "52": "es", "56": "es", "57": "es", "34": "es", "598": "es", "51": "es", "58": "es", "593": "es",
+	"55": "pt", "351": "pt", "244": "pt",
+	"1": "en", "44": "en", "61": "en", "353": "en",
+}
+
+var languageGreetings = map[string][]string{
+	"pt": {"ola", "oi", "obrigado", "obrigada", "bom dia", "boa tarde", "boa noite", "tudo bem"},
+	"en": {"hello", "hi", "hey", "thanks", "thank you", "good morning", "good afternoon"},
+	"es": {"hola", "buenas", "gracias", "buen dia", "buenos dias", "buenas tardes", "buenas noches"},
+}
+
+// detectLanguage deduce el idioma del texto o del número; "" si no hay pistas.
+func detectLanguage(l *FlowLanguages, waID, text string) string {
+	words := " " + normalizeKeyword(text) + " "
+	for _, lang := range sortedKeys(languageGreetings) {
+		if !l.supports(lang) {
+			continue
+		}
+		for _, g := range languageGreetings[lang] {
+			if strings.Contains(words, " "+g+" ") {
+				return lang
+			}
+		}
+	}
+
+	e164, err := (*wa.PhoneRules)(nil).Normalize(waID)
+	if err != nil {
+		return ""
+	}
+	best := ""
+	for code := range languageByCountryCode {
+		if strings.HasPrefix(e164, code) && len(code) > len(best) {
+			best = code
+		}
+	}
+	if lang := languageByCountryCode[best]; best != "" && l.supports(lang) {
+		return lang
+	}
+	return ""
+}
+
+// applyLanguage resuelve el idioma de la sesión al recibir un mensaje. Devuelve el estado
+// ask_state si hay que preguntarlo.
+func (a *App) applyLanguage(cfg FlowConfig, sess *UserSession, msg IncomingMessage, selectedID string, vars map[string]string) (string, bool) {
+	l := cfg.Languages
+	if l == nil {
+		return "", false
+	}
+	set := func(lang string) {
+		sess.Data[languageVar] = lang
+		vars[languageVar] = lang
+	}
+
+	// Eligió idioma en una fila/botón "lang:xx"
+	if lang, ok := strings.CutPrefix(selectedID, languageOptionPfx); ok && l.supports(lang) {
+		log.Printf("🌍 wa_id=%s eligió idioma %s", msg.From, lang)
+		set(lang)
+		return "", false
+	}
+	if sess.Data[languageVar] != "" || sess.Data[languageDetectDone] != "" {
+		return "", false
+	}
+
+	sess.Data[languageDetectDone] = "1"
+	if l.Detect {
+		text := ""
+		if msg.Text != nil {
+			text = msg.Text.Body
+		}
+		if lang := detectLanguage(l, msg.From, text); lang != "" {
+			log.Printf("🌍 wa_id=%s idioma detectado: %s", msg.From, lang)
+			set(lang)
+			return "", false
+		}
+	}
+	if l.AskState != "" {
+		return l.AskState, true
+	}
+	set(l.defaultLang())
+	return "", false
+}
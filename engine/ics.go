@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// ICS attachments
+// ---------------------
+// Después de confirmar un turno se manda un .ics como documento de WhatsApp, para que el
+// usuario lo agregue a su calendario (Google, Apple, Outlook...). Se activa en calendar.json:
+//
+//	"ics": {
+//	  "filename": "turno.ics",
+//	  "caption": "📅 Agregá el turno a tu calendario"
+//	}
+//
+// El envío va por un job ("appointment_ics") para que llegue después de la confirmación
+// y se reintente si falla la subida a la Media API.
+
+const (
+	icsJobKind         = "appointment_ics"
+	defaultICSFilename = "turno.ics"
+	icsMimeType        = "text/calendar"
+	icsTimeLayout      = "20060102T150405Z"
+)
+
+type ICSConfig struct {
+	Filename string `json:"filename,omitempty"` // default: turno.ics
+	Caption  string `json:"caption,omitempty"`
+}
+
+// scheduleAppointmentICS encola el envío del .ics si el tenant lo tiene configurado.
+func (a *App) scheduleAppointmentICS(tenant, waID string, appt calendar.Appointment, summary, description string, start, end time.Time, cfg *ICSConfig) {
+	if cfg == nil || appt.EventID == "" {
+		return
+	}
+	_, err := a.jobs.Enqueue(Job{
+		Kind:   icsJobKind,
+		Tenant: tenant,
+		WaID:   waID,
+		Ref:    appt.EventID,
+		RunAt:  time.Now(),
+		Payload: map[string]string{
+			"event_id":    appt.EventID,
+			"start":       start.Format(time.RFC3339),
+			"end":         end.Format(time.RFC3339),
+			"summary":     summary,
+			"description": description,
+			"location":    appt.MeetURL,
+		},
+	})
+	if err != nil {
+		log.Printf("❌ No pude programar el .ics de %s: %v", appt.EventID, err)
+	}
+}
+
+func jobSendAppointmentICS(ctx context.Context, a *App, job Job) error {
+	calCfg, err := loadCalendarConfig(job.Tenant)
+	if err != nil {
+		return err
+	}
+	cfg := calCfg.ICS
+	if cfg == nil {
+		return nil // lo desactivaron después de agendar
+	}
+
+	start, err := time.Parse(time.RFC3339, job.Payload["start"])
+	if err != nil {
+		return fmt.Errorf("start inválido en job: %w", err)
+	}
+	end, err := time.Parse(time.RFC3339, job.Payload["end"])
+	if err != nil {
+		return fmt.Errorf("end inválido en job: %w", err)
+	}
+
+	phoneID, ok := a.resolver.PhoneNumberID(job.Tenant)
+	if !ok {
+		return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", job.Tenant)
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return err
+	}
+
+	ics := buildAppointmentICS(icsEvent{
+		UID:         job.Payload["event_id"] + "@flowly",
+		Start:       start,
+		End:         end,
+		Summary:     job.Payload["summary"],
+		Description: job.Payload["description"],
+		Location:    job.Payload["location"],
+	})
+
+	filename := cfg.Filename
+	if filename == "" {
+		filename = defaultICSFilename
+	}
+	mediaID, err := waClient.UploadMedia(ctx, filename, icsMimeType, ics)
+	if err != nil {
+		return fmt.Errorf("subiendo .ics: %w", err)
+	}
+	return waClient.SendDocument(ctx, job.WaID, mediaID, filename, cfg.Caption)
+}
+
+type icsEvent struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+}
+
+// buildAppointmentICS arma un VCALENDAR (RFC 5545) con un único evento en UTC.
+func buildAppointmentICS(ev icsEvent) []byte {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Flowly//Turnos//ES",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:" + icsEscape(ev.UID),
+		"DTSTAMP:" + time.Now().UTC().Format(icsTimeLayout),
+		"DTSTART:" + ev.Start.UTC().Format(icsTimeLayout),
+		"DTEND:" + ev.End.UTC().Format(icsTimeLayout),
+		"SUMMARY:" + icsEscape(ev.Summary),
+	}
+	if ev.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+icsEscape(ev.Description))
+	}
+	if ev.Location != "" {
+		lines = append(lines, "LOCATION:"+icsEscape(ev.Location), "URL:"+ev.Location)
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(icsFold(l))
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// icsFold parte las líneas de más de 75 bytes (sin cortar runas UTF-8 al medio).
+func icsFold(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > limit {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Idempotency keys de los envíos
+// ---------------------
+// Los reintentos (de jobs, del outbox, de Meta reenviando un webhook, del sistema del tenant
+// llamando otra vez a la API de envíos) vuelven a generar los mismos mensajes. Para que el
+// usuario no reciba dos veces la misma confirmación, cada mensaje lógico lleva una key que se
+// registra ANTES de mandarlo:
+//
+//	in:{wamid}:{wa_id}:{n}       respuesta al mensaje entrante wamid (n = orden del envío)
+//	job:{id}:{wa_id}:{n}         mensaje que manda el job id (recordatorios, campañas...)
+//	api:{tenant}:{key}:{wa_id}:{n}  POST /admin/tenants/{tenant}/send con "idempotency_key"
+//
+// Si la key ya salió (sent), el envío se omite y devuelve el message_id original; si está
+// pending, el mensaje quedó en el outbox y lo termina de mandar ese job (ver outbox.go). Un
+// envío fallido libera la key, salvo que el outbox lo vaya a reintentar. Los envíos fuera de
+// esos contextos (ej: respuestas de un agente) no llevan key.
+//
+// Las keys se guardan IDEMPOTENCY_KEYS_DAYS días (con DATABASE_URL sobreviven reinicios) y
+// se borran con el contacto (ver retention.go).
+//
+// ENV:
+//
+//	IDEMPOTENCY_KEYS_DAYS=7
+
+const (
+	outboundKeyPending = "pending"
+	outboundKeySent    = "sent"
+
+	defaultIdempotencyKeysDays = 7
+	maxMemoryOutboundKeys      = 100000
+)
+
+// ErrSendInProgress: otro pedido con la misma idempotency_key se está procesando.
+var ErrSendInProgress = errors.New("hay un envío en curso con esa idempotency_key")
+
+type OutboundKeyStore interface {
+	// ReserveOutboundKey registra key como pending. Si ya existía no la toca y devuelve su
+	// estado y el message_id con el que salió; "" = recién reservada.
+	ReserveOutboundKey(key, tenant, waID string) (status, msgID string, err error)
+	MarkOutboundKeySent(key, msgID string) error
+	ReleaseOutboundKey(key string) error
+	// PurgeOutboundKeys borra las keys registradas antes de before.
+	PurgeOutboundKeys(before time.Time) (int, error)
+	// DeleteContactOutboundKeys borra las keys de un usuario (ver retention.go).
+	DeleteContactOutboundKeys(tenant, waID string) (int, error)
+}
+
+func NewOutboundKeyStore(store *PostgresStore) OutboundKeyStore {
+	if store != nil {
+		return store
+	}
+	return &memoryOutboundKeyStore{keys: make(map[string]memoryOutboundKey)}
+}
+
+// ---------------------
+// Keys por contexto
+// ---------------------
+
+type outboundKeysKey struct{}
+
+// outboundKeys numera los envíos de un mensaje entrante / job / pedido a la API.
+type outboundKeys struct {
+	base  string
+	exact string // reenvío del outbox: la key del mensaje original
+
+	mu   sync.Mutex
+	next map[string]int // wa_id -> próximo n
+}
+
+// withOutboundKeys hace que los envíos con ese ctx lleven keys base:{wa_id}:{n}.
+func withOutboundKeys(ctx context.Context, base string) context.Context {
+	return context.WithValue(ctx, outboundKeysKey{}, &outboundKeys{base: base, next: make(map[string]int)})
+}
+
+// withOutboundReplayKey es para el reenvío de un mensaje que ya tiene key (y puede estar pending).
+func withOutboundReplayKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, outboundKeysKey{}, &outboundKeys{exact: key})
+}
+
+func outboundKeysFrom(ctx context.Context) *outboundKeys {
+	k, _ := ctx.Value(outboundKeysKey{}).(*outboundKeys)
+	return k
+}
+
+// nextKey devuelve la key del próximo envío a waID ("" = sin key) y si es un reenvío.
+func (k *outboundKeys) nextKey(waID string) (string, bool) {
+	if k == nil {
+		return "", false
+	}
+	if k.exact != "" {
+		return k.exact, true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	n := k.next[waID]
+	k.next[waID] = n + 1
+	return k.base + ":" + waID + ":" + strconv.Itoa(n), false
+}
+
+// reserveOutboundKey registra la key antes del envío; skip = ya salió (o está en el outbox)
+// y no hay que mandarlo otra vez.
+func (p *sendPipeline) reserveOutboundKey(tenant, key, waID string, replay bool) (msgID string, skip bool) {
+	if key == "" || p.keys == nil {
+		return "", false
+	}
+	status, msgID, err := p.keys.ReserveOutboundKey(key, tenant, waID)
+	if err != nil {
+		// Sin registro igual se manda (mejor un duplicado que no responder)
+		log.Printf("⚠️ idempotency: no pude registrar la key %s: %v", key, err)
+		return "", false
+	}
+	if status == "" || (status == outboundKeyPending && replay) {
+		return "", false
+	}
+	metrics.Inc("flowly_outbound_duplicates_skipped_total", tenant)
+	log.Printf("🔁 tenant=%s envío a %s omitido: la key %s ya está %s", tenant, waID, key, status)
+	return msgID, true
+}
+
+// finishOutboundKey marca la key como enviada, o la libera si el envío falló y nadie lo va
+// a reintentar con esa key.
+func (p *sendPipeline) finishOutboundKey(key, msgID string, sendErr error, retried bool) {
+	if key == "" || p.keys == nil {
+		return
+	}
+	var err error
+	switch {
+	case sendErr == nil:
+		err = p.keys.MarkOutboundKeySent(key, msgID)
+	case retried && wa.IsRetryable(sendErr):
+		return
+	default:
+		err = p.keys.ReleaseOutboundKey(key)
+	}
+	if err != nil {
+		log.Printf("ERROR actualizando la key %s: %v", key, err)
+	}
+}
+
+// purgeOutboundKeys borra las keys más viejas que IDEMPOTENCY_KEYS_DAYS.
+func (a *App) purgeOutboundKeys(now time.Time) {
+	days := envPositiveInt("IDEMPOTENCY_KEYS_DAYS", defaultIdempotencyKeysDays)
+	n, err := a.outboundKeys.PurgeOutboundKeys(now.AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("ERROR purgando idempotency keys: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("🧹 idempotency: %d key(s) vencidas borradas", n)
+	}
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryOutboundKey struct {
+	tenant, waID string
+	status       string
+	msgID        string
+	at           time.Time
+}
+
+type memoryOutboundKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]memoryOutboundKey
+}
+
+func (s *memoryOutboundKeyStore) ReserveOutboundKey(key, tenant, waID string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[key]; ok {
+		return k.status, k.msgID, nil
+	}
+	if len(s.keys) >= maxMemoryOutboundKeys {
+		s.purgeOldestLocked()
+	}
+	s.keys[key] = memoryOutboundKey{tenant: tenant, waID: waID, status: outboundKeyPending, at: time.Now()}
+	return "", "", nil
+}
+
+// purgeOldestLocked saca las keys de la primera mitad del período que cubre el store.
+func (s *memoryOutboundKeyStore) purgeOldestLocked() {
+	var cutoff time.Time
+	n := 0
+	for _, k := range s.keys {
+		if n == 0 || k.at.Before(cutoff) {
+			cutoff = k.at
+		}
+		n++
+	}
+	mid := cutoff.Add(time.Since(cutoff) / 2)
+	for key, k := range s.keys {
+		if k.at.Before(mid) {
+			delete(s.keys, key)
+		}
+	}
+}
+
+func (s *memoryOutboundKeyStore) MarkOutboundKeySent(key, msgID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[key]; ok {
+		k.status, k.msgID = outboundKeySent, msgID
+		s.keys[key] = k
+	}
+	return nil
+}
+
+func (s *memoryOutboundKeyStore) ReleaseOutboundKey(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *memoryOutboundKeyStore) PurgeOutboundKeys(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, k := range s.keys {
+		if k.at.Before(before) {
+			delete(s.keys, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryOutboundKeyStore) DeleteContactOutboundKeys(tenant, waID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, k := range s.keys {
+		if k.tenant == tenant && k.waID == waID {
+			delete(s.keys, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) ReserveOutboundKey(key, tenant, waID string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO outbound_keys (key, tenant, wa_id, status)
+		VALUES ($1, $2, $3, 'pending')
+		ON CONFLICT (key) DO NOTHING`,
+		key, tenant, waID,
+	)
+	if err != nil {
+		return "", "", err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return "", "", nil
+	}
+	var status, msgID string
+	err = s.db.QueryRowContext(ctx, `SELECT status, message_id FROM outbound_keys WHERE key = $1`, key).Scan(&status, &msgID)
+	return status, msgID, err
+}
+
+func (s *PostgresStore) MarkOutboundKeySent(key, msgID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE outbound_keys SET status = 'sent', message_id = $2 WHERE key = $1`, key, msgID)
+	return err
+}
+
+func (s *PostgresStore) ReleaseOutboundKey(key string) error {
+	_, err := s.execCount(`DELETE FROM outbound_keys WHERE key = $1`, key)
+	return err
+}
+
+func (s *PostgresStore) PurgeOutboundKeys(before time.Time) (int, error) {
+	return s.execCount(`DELETE FROM outbound_keys WHERE created_at < $1`, before)
+}
+
+func (s *PostgresStore) DeleteContactOutboundKeys(tenant, waID string) (int, error) {
+	return s.execCount(`DELETE FROM outbound_keys WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Inbound rate limiting (flood protection)
+// ---------------------
+// Un usuario que manda mensajes en ráfaga dispara una llamada a la Graph API por mensaje.
+// Con un token bucket por usuario (tenant + wa_id), lo que excede el límite se registra en
+// el log pero no corre el flow; al usuario se le avisa una sola vez por ventana.
+//
+// Además, el POST /webhook tiene un límite por IP (responde 429). Ojo: los webhooks reales
+// llegan desde pocas IPs de Meta, así que ese límite tiene que ser holgado.
+//
+// La IP es la de la conexión (RemoteAddr). Detrás de un proxy, TRUSTED_PROXY_HEADER dice qué
+// header puso el proxy con la IP del cliente (en fly.io: Fly-Client-IP). Sin esa ENV no se
+// mira ningún header: X-Forwarded-For lo arma el cliente y alcanzaría con cambiarlo para
+// saltear el límite. Con X-Forwarded-For se toma la última IP (la que agregó el proxy).
+//
+// ENV:
+//
+//	INBOUND_RATE_LIMIT_PER_MIN=20        mensajes por usuario por minuto (0 = sin límite)
+//	INBOUND_RATE_LIMIT_BURST=10
+//	WEBHOOK_IP_RATE_LIMIT_PER_MIN=1200   requests por IP por minuto (0 = sin límite)
+//	WEBHOOK_IP_RATE_LIMIT_BURST=300
+//	TRUSTED_PROXY_HEADER=Fly-Client-IP   (o X-Forwarded-For; vacío = RemoteAddr)
+
+const (
+	inboundNoticeEvery = time.Minute
+	inboundBucketIdle  = 10 * time.Minute
+	maxInboundBuckets  = 50000
+)
+
+type InboundLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*inboundBucket
+	perMinute float64
+	burst     int
+}
+
+type inboundBucket struct {
+	bucket     *TokenBucket
+	lastSeen   time.Time
+	notifiedAt time.Time
+}
+
+// NewInboundLimiterFromEnv lee <prefix>_PER_MIN y <prefix>_BURST.
+func NewInboundLimiterFromEnv(prefix string, defPerMinute float64, defBurst int) *InboundLimiter {
+	l := &InboundLimiter{buckets: make(map[string]*inboundBucket), perMinute: defPerMinute, burst: defBurst}
+	if v := strings.TrimSpace(os.Getenv(prefix + "_PER_MIN")); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			l.perMinute = f
+		}
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(prefix + "_BURST"))); err == nil && n > 0 {
+		l.burst = n
+	}
+	return l
+}
+
+// Allow consume un mensaje del bucket de key. Si está excedido, notify indica si hay que
+// avisarle al usuario (una vez por inboundNoticeEvery).
+func (l *InboundLimiter) Allow(key string) (ok, notify bool) {
+	if l == nil || l.perMinute == 0 {
+		return true, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, found := l.buckets[key]
+	if !found {
+		if len(l.buckets) >= maxInboundBuckets {
+			l.pruneLocked(now)
+		}
+		b = &inboundBucket{bucket: NewTokenBucket(l.perMinute/60, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	if _, ok := b.bucket.Reserve(0); ok {
+		return true, false
+	}
+	if now.Sub(b.notifiedAt) >= inboundNoticeEvery {
+		b.notifiedAt = now
+		return false, true
+	}
+	return false, false
+}
+
+// pruneLocked descarta los buckets que no se usan hace rato (ya estarían llenos).
+func (l *InboundLimiter) pruneLocked(now time.Time) {
+	for k, b := range l.buckets {
+		if now.Sub(b.lastSeen) > inboundBucketIdle {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// limitWebhookByIP corta con 429 las IPs que exceden el límite del webhook.
+func (a *App) limitWebhookByIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			ip := clientIP(r)
+			if ok, notify := a.ipLimiter.Allow(ip); !ok {
+				metrics.Inc("flowly_webhook_rate_limited_total")
+				if notify {
+					log.Printf("🚦 webhook: IP %s excedió el límite de requests", ip)
+				}
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// clientIP: el header de TRUSTED_PROXY_HEADER (si hay proxy configurado) o RemoteAddr.
+func clientIP(r *http.Request) string {
+	if name := strings.TrimSpace(os.Getenv("TRUSTED_PROXY_HEADER")); name != "" {
+		// X-Forwarded-For puede venir varias veces: el proxy agrega la suya al final
+		values := r.Header.Values(name)
+		if len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// ---------------------
+// Intents (keyword routing global)
+// ---------------------
+// Sección "intents" de flow.json: patrones (regex, sin distinguir mayúsculas) que se evalúan
+// contra cualquier texto antes de las transiciones del estado actual. Permite saltar a
+// otra parte del flow con frases naturales y no solo con "menu".
+//
+//	"intents": [
+//	  { "name": "precios", "pattern": "precio|costo|cu[aá]nto sale", "next": "PRICES" },
+//	  { "name": "turnos",  "pattern": "\\b(turno|cita)s?\\b",         "next": "BOOK_SLOTS" }
+//	]
+//
+// Se evalúan en orden; gana el primero que matchea. Cada patrón se prueba contra el texto tal
+// cual y normalizado (sin acentos ni signos, ver text_match.go).
+
+type FlowIntent struct {
+	Name    string `json:"name,omitempty"`
+	Pattern string `json:"pattern"`
+	Next    string `json:"next"`
+}
+
+type compiledIntent struct {
+	FlowIntent
+	re *regexp.Regexp
+}
+
+func compileIntentPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+func validateIntents(cfg FlowConfig) []string {
+	var errs []string
+	for i, in := range cfg.Intents {
+		label := in.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i)
+		}
+		if strings.TrimSpace(in.Pattern) == "" {
+			errs = append(errs, fmt.Sprintf("intent=%s pattern vacío", label))
+		} else if _, err := compileIntentPattern(in.Pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("intent=%s pattern inválido: %v", label, err))
+		}
+		if _, ok := cfg.States[in.Next]; !ok {
+			errs = append(errs, fmt.Sprintf("intent=%s next apunta a un estado inexistente: %q", label, in.Next))
+		}
+	}
+	return errs
+}
+
+// compileIntents precompila los patrones (se llama al cargar el flow, ya validado).
+func compileIntents(cfg *FlowConfig) {
+	cfg.intents = make([]compiledIntent, 0, len(cfg.Intents))
+	for _, in := range cfg.Intents {
+		re, err := compileIntentPattern(in.Pattern)
+		if err != nil {
+			continue
+		}
+		cfg.intents = append(cfg.intents, compiledIntent{FlowIntent: in, re: re})
+	}
+}
+
+// matchIntent devuelve el estado destino del primer intent que matchea el texto.
+func (cfg FlowConfig) matchIntent(text string) (string, bool) {
+	norm := normalizeKeyword(text)
+	for _, in := range cfg.intents {
+		if in.re.MatchString(text) || in.re.MatchString(norm) {
+			log.Printf("🎯 Intent %q -> %s", in.Name, in.Next)
+			return in.Next, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,434 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ---------------------
+// Job queue (scheduled work)
+// ---------------------
+// Jobs programados para correr en un momento dado (ej: recordatorio 24h antes de un turno).
+// Con DATABASE_URL la cola es persistente (sobrevive reinicios y es segura con varias
+// réplicas gracias a FOR UPDATE SKIP LOCKED). Sin DB queda en memoria.
+
+const (
+	defaultJobPollInterval = 15 * time.Second
+	maxJobAttempts         = 5
+	jobTimeout             = 5 * time.Minute // tope por job (Graph API, Calendar, webhooks)
+	staleJobAfter          = 2 * jobTimeout  // un "running" más viejo que esto se vuelve a tomar
+)
+
+type Job struct {
+	ID        int64             `json:"id"`
+	Kind      string            `json:"kind"`
+	Tenant    string            `json:"tenant"`
+	WaID      string            `json:"wa_id,omitempty"`
+	Ref       string            `json:"ref,omitempty"` // referencia de negocio (ej: event_id) para cancelar en bloque
+	RunAt     time.Time         `json:"run_at"`
+	Payload   map[string]string `json:"payload,omitempty"`
+	Status    string            `json:"status"`
+	Attempts  int               `json:"attempts"`
+	LastError string            `json:"last_error,omitempty"`
+}
+
+type JobQueue interface {
+	// Enqueue devuelve id 0 si el job ya estaba (índice único, ej: el resumen diario).
+	Enqueue(job Job) (int64, error)
+	// ClaimDue marca como "running" y devuelve los jobs pendientes cuyo run_at ya pasó.
+	ClaimDue(now time.Time, limit int) ([]Job, error)
+	Complete(id int64) error
+	// Fail registra el error; si retryAt no es nil el job vuelve a quedar pendiente.
+	Fail(id int64, errMsg string, retryAt *time.Time) error
+	// Cancel cancela los jobs pendientes de un kind/tenant/ref y devuelve cuántos.
+	Cancel(kind, tenant, ref string) (int, error)
+	// List devuelve los jobs de un kind/status (tenant vacío = todos), más recientes primero.
+	List(kind, tenant, status string, limit int) ([]Job, error)
+	// Requeue vuelve a poner como pendiente un job fallido; false si no existe o no falló.
+	Requeue(id int64, kind string) (bool, error)
+	// DeleteContactJobs borra los jobs de un usuario, en cualquier estado (ver retention.go).
+	DeleteContactJobs(tenant, waID string) (int, error)
+}
+
+// JobHandler ejecuta un job. Devolver error hace que se reintente (hasta maxJobAttempts).
+type JobHandler func(ctx context.Context, a *App, job Job) error
+
+// jobHandlers: kind -> handler (mismo patrón que actionRegistry)
+var jobHandlers = map[string]JobHandler{
+	"appointment_reminder": jobSendAppointmentReminder,
+	"campaign_batch":       jobSendCampaignBatch,
+	readNudgeJobKind:       jobSendReadNudge,
+	stateTimeoutJobKind:    jobRunStateTimeout,
+	crmWebhookJobKind:      jobSendCRMWebhook,
+	icsJobKind:             jobSendAppointmentICS,
+	outboundJobKind:        jobSendOutbound,
+	digestJobKind:          jobSendAgendaDigest,
+	dailyStatsJobKind:      jobSendDailyStats,
+}
+
+// NewJobQueue usa Postgres si está disponible; si no, una cola en memoria.
+func NewJobQueue(store *PostgresStore) JobQueue {
+	if store != nil {
+		return store
+	}
+	return &memoryJobQueue{jobs: make(map[int64]*Job)}
+}
+
+// ---------------------
+// In-memory queue
+// ---------------------
+
+type memoryJobQueue struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*Job
+}
+
+func (q *memoryJobQueue) Enqueue(job Job) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nextID++
+	job.ID = q.nextID
+	job.Status = "pending"
+	q.jobs[job.ID] = &job
+	return job.ID, nil
+}
+
+func (q *memoryJobQueue) ClaimDue(now time.Time, limit int) ([]Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []*Job
+	for _, j := range q.jobs {
+		if j.Status == "pending" && !j.RunAt.After(now) {
+			due = append(due, j)
+		}
+	}
+	sort.Slice(due, func(i, k int) bool { return due[i].RunAt.Before(due[k].RunAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	out := make([]Job, 0, len(due))
+	for _, j := range due {
+		j.Status = "running"
+		j.Attempts++
+		out = append(out, *j)
+	}
+	return out, nil
+}
+
+func (q *memoryJobQueue) Complete(id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Los terminados no hace falta guardarlos en memoria
+	delete(q.jobs, id)
+	return nil
+}
+
+func (q *memoryJobQueue) Fail(id int64, errMsg string, retryAt *time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil
+	}
+	j.LastError = errMsg
+	if retryAt != nil {
+		j.Status = "pending"
+		j.RunAt = *retryAt
+	} else {
+		j.Status = "failed"
+	}
+	return nil
+}
+
+func (q *memoryJobQueue) Cancel(kind, tenant, ref string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for id, j := range q.jobs {
+		if j.Status == "pending" && j.Kind == kind && j.Tenant == tenant && j.Ref == ref {
+			delete(q.jobs, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *memoryJobQueue) List(kind, tenant, status string, limit int) ([]Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []Job
+	for _, j := range q.jobs {
+		if j.Kind == kind && j.Status == status && (tenant == "" || j.Tenant == tenant) {
+			out = append(out, *j)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].ID > out[k].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (q *memoryJobQueue) Requeue(id int64, kind string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok || j.Kind != kind || j.Status != "failed" {
+		return false, nil
+	}
+	j.Status = "pending"
+	j.RunAt = time.Now()
+	j.Attempts = 0
+	return true, nil
+}
+
+func (q *memoryJobQueue) DeleteContactJobs(tenant, waID string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for id, j := range q.jobs {
+		if j.Tenant == tenant && j.WaID == waID {
+			delete(q.jobs, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ---------------------
+// Postgres queue
+// ---------------------
+
+func (s *PostgresStore) Enqueue(job Job) (int64, error) {
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return 0, err
+	}
+	if job.Payload == nil {
+		payload = []byte("{}")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var id int64
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO jobs (kind, tenant, wa_id, ref, run_at, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		job.Kind, job.Tenant, job.WaID, job.Ref, job.RunAt, payload,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (s *PostgresStore) ClaimDue(now time.Time, limit int) ([]Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE jobs SET status = 'running', attempts = attempts + 1, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE (status = 'pending' AND run_at <= $1)
+			   -- "running" huérfanos: el proceso murió a mitad del job
+			   OR (status = 'running' AND updated_at <= $3)
+			ORDER BY run_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, tenant, wa_id, ref, run_at, payload, status, attempts, last_error`,
+		now, limit, now.Add(-staleJobAfter),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Job
+	for rows.Next() {
+		var j Job
+		var payload []byte
+		if err := rows.Scan(&j.ID, &j.Kind, &j.Tenant, &j.WaID, &j.Ref, &j.RunAt, &payload, &j.Status, &j.Attempts, &j.LastError); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(payload, &j.Payload)
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) Complete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = 'done', updated_at = now() WHERE id = $1`, id)
+	return err
+}
+
+func (s *PostgresStore) Fail(id int64, errMsg string, retryAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	var err error
+	if retryAt != nil {
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE jobs SET status = 'pending', run_at = $2, last_error = $3, updated_at = now() WHERE id = $1`,
+			id, *retryAt, errMsg)
+	} else {
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE jobs SET status = 'failed', last_error = $2, updated_at = now() WHERE id = $1`,
+			id, errMsg)
+	}
+	return err
+}
+
+func (s *PostgresStore) Cancel(kind, tenant, ref string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE jobs SET status = 'canceled', updated_at = now() WHERE status = 'pending' AND kind = $1 AND tenant = $2 AND ref = $3`,
+		kind, tenant, ref)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (s *PostgresStore) List(kind, tenant, status string, limit int) ([]Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, kind, tenant, wa_id, ref, run_at, payload, status, attempts, last_error
+		FROM jobs
+		WHERE kind = $1 AND status = $2 AND ($3 = '' OR tenant = $3)
+		ORDER BY id DESC
+		LIMIT $4`,
+		kind, status, tenant, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Job
+	for rows.Next() {
+		var j Job
+		var payload []byte
+		if err := rows.Scan(&j.ID, &j.Kind, &j.Tenant, &j.WaID, &j.Ref, &j.RunAt, &payload, &j.Status, &j.Attempts, &j.LastError); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(payload, &j.Payload)
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) Requeue(id int64, kind string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE jobs SET status = 'pending', run_at = now(), attempts = 0, updated_at = now() WHERE id = $1 AND kind = $2 AND status = 'failed'`,
+		id, kind)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *PostgresStore) DeleteContactJobs(tenant, waID string) (int, error) {
+	return s.execCount(`DELETE FROM jobs WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
+
+// ---------------------
+// Worker
+// ---------------------
+
+func jobPollInterval() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("JOBS_POLL_SECONDS"))); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return defaultJobPollInterval
+}
+
+// runJobWorker procesa jobs vencidos hasta que ctx se cancele.
+func (a *App) runJobWorker(ctx context.Context) {
+	interval := jobPollInterval()
+	log.Printf("⏰ Worker de jobs activo (cada %s)", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.processDueJobs(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) processDueJobs(ctx context.Context) {
+	jobs, err := a.jobs.ClaimDue(time.Now(), 50)
+	if err != nil {
+		log.Printf("ERROR leyendo jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		a.runJob(ctx, job)
+	}
+}
+
+func (a *App) runJob(ctx context.Context, job Job) {
+	h, ok := jobHandlers[job.Kind]
+	if !ok {
+		log.Printf("⚠️ Job %d de tipo desconocido: %s", job.ID, job.Kind)
+		_ = a.jobs.Fail(job.ID, "kind desconocido", nil)
+		return
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	// Un reintento del job no repite los mensajes que ya mandó (ver idempotency.go)
+	jobCtx = withOutboundKeys(jobCtx, "job:"+strconv.FormatInt(job.ID, 10))
+	jobCtx, span := startSpan(jobCtx, "job.run", append(userAttrs(job.Tenant, job.WaID), attribute.String("flowly.job_kind", job.Kind))...)
+
+	err := h(jobCtx, a, job)
+	endSpan(span, err)
+	if err != nil {
+		var retryAt *time.Time
+		if job.Attempts < maxJobAttempts {
+			t := time.Now().Add(time.Duration(job.Attempts) * time.Minute)
+			retryAt = &t
+		}
+		log.Printf("❌ Job %d (%s) falló (intento %d): %v", job.ID, job.Kind, job.Attempts, err)
+		if ferr := a.jobs.Fail(job.ID, err.Error(), retryAt); ferr != nil {
+			log.Printf("ERROR marcando job %d como fallido: %v", job.ID, ferr)
+		} else if retryAt == nil {
+			a.alerts.DeadLetter(job, err.Error())
+		}
+		return
+	}
+
+	if err := a.jobs.Complete(job.ID); err != nil {
+		log.Printf("ERROR completando job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ---------------------
+// Flow linter (CLI)
+// ---------------------
+// Uso:
+//
+//	flowly lint [-strict] configs/broker/flow.json [configs/otro/flow.json ...]
+//
+// Errores (exit 1): límites de WhatsApp, transiciones a estados inexistentes,
+// acciones no registradas, falta el estado de entrada.
+// Warnings: estados inalcanzables, callejones sin salida, opciones sin transición.
+// Con -strict los warnings también hacen fallar el comando.
+
+type lintResult struct {
+	Errors   []string
+	Warnings []string
+}
+
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	strict := fs.Bool("strict", false, "tratar warnings como errores")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "uso: flowly lint [-strict] <flow.json> [...]")
+		return 2
+	}
+
+	failed := false
+	for _, p := range fs.Args() {
+		res := lintFlowFile(p)
+		for _, e := range res.Errors {
+			fmt.Printf("%s: ERROR %s\n", p, e)
+		}
+		for _, w := range res.Warnings {
+			fmt.Printf("%s: WARN  %s\n", p, w)
+		}
+		if len(res.Errors) > 0 || (*strict && len(res.Warnings) > 0) {
+			failed = true
+		}
+		if len(res.Errors) == 0 && len(res.Warnings) == 0 {
+			fmt.Printf("%s: OK\n", p)
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func lintFlowFile(p string) lintResult {
+	tenant, cfg, err := readFlowFile(p)
+	if err != nil {
+		return lintResult{Errors: []string{err.Error()}}
+	}
+	return lintFlowConfig(tenant, cfg)
+}
+
+// readFlowFile lee un flow.json suelto (con sus fragmentos); el tenant sale del directorio.
+func readFlowFile(p string) (string, FlowConfig, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", FlowConfig{}, fmt.Errorf("no pude leer el archivo: %v", err)
+	}
+	cfg, err := decodeFlowConfig(b)
+	if err != nil {
+		return "", FlowConfig{}, fmt.Errorf("json inválido: %v", err)
+	}
+	dir := filepath.Dir(p)
+	if filepath.Base(dir) == "versions" { // configs/{tenant}/versions/{version}.json
+		dir = filepath.Dir(dir)
+	}
+	if err := expandFragments(dir, &cfg); err != nil {
+		return "", FlowConfig{}, err
+	}
+	return filepath.Base(dir), cfg, nil
+}
+
+func lintFlowConfig(tenant string, cfg FlowConfig) lintResult {
+	var res lintResult
+
+	if len(cfg.States) == 0 {
+		res.Errors = append(res.Errors, "no tiene states")
+		return res
+	}
+
+	// Límites de WhatsApp (mismas reglas que al cargar el flow)
+	if err := validateFlowConfig(tenant, cfg); err != nil {
+		for _, line := range strings.Split(err.Error(), "\n- ")[1:] {
+			res.Errors = append(res.Errors, line)
+		}
+	}
+
+	for _, name := range sortedStateNames(cfg) {
+		st := cfg.States[name]
+
+		if st.Action != "" {
+			if _, ok := actionRegistry[st.Action]; !ok {
+				res.Errors = append(res.Errors, fmt.Sprintf("state=%s action no registrada: %q", name, st.Action))
+			}
+		}
+
+		for _, t := range stateTransitions(st) {
+			if _, ok := cfg.States[t.To]; !ok && t.To != previousState {
+				res.Errors = append(res.Errors, fmt.Sprintf("state=%s %s apunta a un estado inexistente: %q", name, t.Via, t.To))
+			}
+		}
+
+		if len(stateTransitions(st)) == 0 && st.Type != "ai_fallback" {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("state=%s no tiene transiciones salientes (callejón sin salida)", name))
+		}
+
+		if st.Type == "interactive_list" && len(stateOptionIDs(st)) > maxListRows {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("state=%s list con %d rows: se muestra en páginas de %d", name, len(stateOptionIDs(st)), maxListRows))
+		}
+
+		// Opciones de la UI vs on_select_next
+		optionIDs := stateOptionIDs(st)
+		for _, id := range optionIDs {
+			if _, ok := st.OnSelectNext[id]; !ok {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("state=%s opción %q no tiene on_select_next (cae a %s)", name, id, cfg.Fallback()))
+			}
+		}
+		known := make(map[string]bool, len(optionIDs))
+		for _, id := range optionIDs {
+			known[id] = true
+		}
+		for id := range st.OnSelectNext {
+			if !known[id] && len(optionIDs) > 0 {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("state=%s on_select_next[%q] no corresponde a ninguna opción", name, id))
+			}
+		}
+	}
+
+	// Alcanzabilidad desde el estado de entrada
+	if _, ok := cfg.States[cfg.Entry()]; ok {
+		reached := reachableStates(cfg, cfg.Entry())
+		// Los intents se alcanzan desde cualquier estado
+		for _, in := range cfg.Intents {
+			if _, ok := cfg.States[in.Next]; ok {
+				for s := range reachableStates(cfg, in.Next) {
+					reached[s] = true
+				}
+			}
+		}
+		// Los comandos globales también
+		for _, target := range cfg.GlobalCommands {
+			if _, ok := cfg.States[target]; ok {
+				for s := range reachableStates(cfg, target) {
+					reached[s] = true
+				}
+			}
+		}
+		// La bienvenida y el estado de los que vuelven, al arrancar una sesión
+		for _, start := range []string{cfg.FirstContactState, cfg.ReturningState} {
+			if _, ok := cfg.States[start]; ok {
+				for s := range reachableStates(cfg, start) {
+					reached[s] = true
+				}
+			}
+		}
+		// La pregunta de idioma, desde el primer mensaje
+		if l := cfg.Languages; l != nil && l.AskState != "" {
+			if _, ok := cfg.States[l.AskState]; ok {
+				for s := range reachableStates(cfg, l.AskState) {
+					reached[s] = true
+				}
+			}
+		}
+		// El estado de ausencia se alcanza desde cualquier estado fuera de horario
+		if bh := cfg.BusinessHours; bh != nil {
+			if _, ok := cfg.States[bh.OutOfHoursState]; ok {
+				for s := range reachableStates(cfg, bh.OutOfHoursState) {
+					reached[s] = true
+				}
+			}
+		}
+		// El ai_fallback se alcanza desde cualquier texto que no matchea
+		if name, _, ok := aiFallbackState(cfg); ok {
+			for s := range reachableStates(cfg, name) {
+				reached[s] = true
+			}
+		}
+		for _, name := range sortedStateNames(cfg) {
+			if !reached[name] {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("state=%s es inalcanzable desde %s", name, cfg.Entry()))
+			}
+		}
+	}
+
+	sort.Strings(res.Errors)
+	return res
+}
+
+type stateTransition struct {
+	Via string
+	To  string
+}
+
+// stateTransitions lista todas las aristas salientes de un estado.
+func stateTransitions(st FlowState) []stateTransition {
+	var out []stateTransition
+	if st.OnTextNext != "" {
+		out = append(out, stateTransition{Via: "on_text_next", To: st.OnTextNext})
+	}
+	for _, id := range sortedKeys(st.OnSelectNext) {
+		out = append(out, stateTransition{Via: fmt.Sprintf("on_select_next[%s]", id), To: st.OnSelectNext[id]})
+	}
+	for _, kw := range sortedKeys(st.OnKeywordNext) {
+		out = append(out, stateTransition{Via: fmt.Sprintf("on_keyword_next[%s]", kw), To: st.OnKeywordNext[kw]})
+	}
+	if st.OnOrderNext != "" {
+		out = append(out, stateTransition{Via: "on_order_next", To: st.OnOrderNext})
+	}
+	if st.HTTP != nil {
+		for _, k := range sortedKeys(st.HTTP.OnStatusNext) {
+			out = append(out, stateTransition{Via: fmt.Sprintf("http.on_status_next[%s]", k), To: st.HTTP.OnStatusNext[k]})
+		}
+		if st.HTTP.OnErrorNext != "" {
+			out = append(out, stateTransition{Via: "http.on_error_next", To: st.HTTP.OnErrorNext})
+		}
+	}
+	if st.OnReadNoReply != nil {
+		out = append(out, stateTransition{Via: "on_read_no_reply.next", To: st.OnReadNoReply.Next})
+	}
+	if st.OnTimeoutNext != "" {
+		out = append(out, stateTransition{Via: "on_timeout_next", To: st.OnTimeoutNext})
+	}
+	if st.AI != nil && st.AI.OnErrorNext != "" {
+		out = append(out, stateTransition{Via: "ai.on_error_next", To: st.AI.OnErrorNext})
+	}
+	for _, code := range sortedKeys(st.OnActionError) {
+		out = append(out, stateTransition{Via: fmt.Sprintf("on_action_error[%s]", code), To: st.OnActionError[code]})
+	}
+	return out
+}
+
+// stateOptionIDs devuelve los IDs de rows/botones que el usuario puede elegir.
+func stateOptionIDs(st FlowState) []string {
+	var ids []string
+	if st.Type == "interactive_list" && st.List != nil {
+		for _, sec := range st.List.Sections {
+			for _, row := range sec.Rows {
+				ids = append(ids, row.ID)
+			}
+		}
+	}
+	if st.Type == "interactive_buttons" && st.Buttons != nil {
+		for _, b := range st.Buttons.Buttons {
+			ids = append(ids, b.ID)
+		}
+	}
+	return ids
+}
+
+func reachableStates(cfg FlowConfig, from string) map[string]bool {
+	seen := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, t := range stateTransitions(cfg.States[cur]) {
+			if _, ok := cfg.States[t.To]; ok && !seen[t.To] {
+				seen[t.To] = true
+				queue = append(queue, t.To)
+			}
+		}
+	}
+	return seen
+}
+
+func sortedStateNames(cfg FlowConfig) []string {
+	return sortedKeys(cfg.States)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
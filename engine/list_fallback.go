@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"strconv"
+	"strings"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Menú de texto cuando falla una lista
+// ---------------------
+// Si Meta rechaza un interactive_list (parámetro inválido) o no lo puede entregar (el
+// WhatsApp del usuario no soporta listas, llega como status "failed" 131026), se manda el
+// mismo menú como texto numerado, armado de las mismas secciones y filas:
+//
+//	*Turnos disponibles*
+//	1. Lunes 10:00
+//	2. Lunes 11:30 — con el Dr. Pérez
+//	3. Siguiente ▶
+//
+//	Respondé con el número de la opción.
+//
+// Mientras la sesión siga en ese estado, "2" (o "2." / "2)") vale como si hubiera elegido la
+// fila 2 de la lista: mismo on_select_next, paginación y payload de la fila. Se desactiva por
+// estado con "list": { "text_fallback": false }.
+
+const (
+	textMenuVar    = "_text_menu"
+	textMenuPrompt = "Respondé con el número de la opción."
+)
+
+// listFallbackCodes: errores de Meta por los que la lista no llega pero un texto sí.
+var listFallbackCodes = map[int]bool{
+	100:    true, // Invalid parameter
+	131008: true, // Required parameter is missing
+	131009: true, // Parameter value is not valid
+	131026: true, // Message undeliverable (ej: versión de WhatsApp sin listas)
+	131051: true, // Unsupported message type
+}
+
+// textMenu: las opciones del último menú de texto que se mandó, en orden.
+type textMenu struct {
+	State string          `json:"state"`
+	Rows  []textMenuEntry `json:"rows"`
+}
+
+type textMenuEntry struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+func (l *FlowList) textFallbackEnabled() bool {
+	return l != nil && (l.TextFallback == nil || *l.TextFallback)
+}
+
+func listFallbackError(err error) bool {
+	var werr *wa.Error
+	return errors.As(err, &werr) && listFallbackCodes[werr.Code]
+}
+
+// renderTextMenu arma el texto numerado y las opciones en el mismo orden.
+func renderTextMenu(header, body, footer string, sections []FlowSection) (string, []textMenuEntry) {
+	var b strings.Builder
+	for _, s := range []string{header, body} {
+		if s = strings.TrimSpace(s); s != "" {
+			b.WriteString(s + "\n")
+		}
+	}
+	var rows []textMenuEntry
+	for _, sec := range sections {
+		b.WriteString("\n")
+		if t := strings.TrimSpace(sec.Title); t != "" {
+			b.WriteString("*" + t + "*\n")
+		}
+		for _, r := range sec.Rows {
+			rows = append(rows, textMenuEntry{ID: r.ID, Title: r.Title})
+			line := fmt.Sprintf("%d. %s", len(rows), r.Title)
+			if d := strings.TrimSpace(r.Description); d != "" {
+				line += " — " + d
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	if f := strings.TrimSpace(footer); f != "" {
+		b.WriteString("\n" + f + "\n")
+	}
+	b.WriteString("\n" + textMenuPrompt)
+	return truncateRunes(strings.TrimSpace(b.String()), 4096), rows
+}
+
+// sendTextMenu manda la lista como texto numerado y deja las opciones en la sesión.
+func (r *Renderer) sendTextMenu(ctx context.Context, tenant string, client MessageSender, to, state, header, body, footer string, sections []FlowSection) error {
+	text, rows := renderTextMenu(header, body, footer, sections)
+	if err := client.SendText(ctx, to, text); err != nil {
+		return err
+	}
+	metrics.Inc("flowly_list_text_fallbacks_total", tenant)
+	r.saveTextMenu(tenant, to, state, rows)
+	return nil
+}
+
+// saveTextMenu guarda las opciones del menú de texto (rows nil = la lista se mandó bien, se
+// descarta el menú anterior). Quien llama tiene el lock del usuario (userLocks).
+func (r *Renderer) saveTextMenu(tenant, to, state string, rows []textMenuEntry) {
+	if r.sessions == nil {
+		return
+	}
+	key := tenant + ":" + to
+	sess, ok := r.sessions.Get(key)
+	if !ok || rows == nil && sess.Data[textMenuVar] == "" {
+		return
+	}
+	// El map es el mismo que tiene el cache del SessionStore: se escribe en una copia
+	sess.Data = maps.Clone(sess.Data)
+	if rows == nil {
+		delete(sess.Data, textMenuVar)
+	} else {
+		b, err := json.Marshal(textMenu{State: state, Rows: rows})
+		if err != nil {
+			log.Printf("ERROR guardando el menú de texto de %s: %v", state, err)
+			return
+		}
+		if sess.Data == nil {
+			sess.Data = make(map[string]string)
+		}
+		sess.Data[textMenuVar] = string(b)
+	}
+	r.sessions.Set(key, sess)
+}
+
+// textMenuReply convierte "2" en la respuesta a la fila 2 del menú de texto del estado en el
+// que está la sesión.
+func textMenuReply(sess UserSession, msg *IncomingMessage) bool {
+	raw := sess.Data[textMenuVar]
+	if raw == "" || msg.Type != "text" || msg.Text == nil {
+		return false
+	}
+	var m textMenu
+	if err := json.Unmarshal([]byte(raw), &m); err != nil || m.State != sess.State {
+		return false
+	}
+	txt := strings.TrimRight(strings.TrimSpace(msg.Text.Body), ".)")
+	n, err := strconv.Atoi(txt)
+	if err != nil || n < 1 || n > len(m.Rows) {
+		return false
+	}
+	row := m.Rows[n-1]
+	log.Printf("🔢 Menú de texto de %s: %d -> %s", m.State, n, row.ID)
+	msg.Type = "interactive"
+	msg.Interactive = &IncomingInteractive{Type: "list_reply", ListReply: &IncomingListReply{ID: row.ID, Title: row.Title}}
+	return true
+}
+
+// listFallbackOnStatus manda el menú de texto cuando una lista que Meta había aceptado vuelve
+// como "failed" (si la sesión sigue en el estado que la mandó).
+func (a *App) listFallbackOnStatus(ctx context.Context, c *wa.Client, st MessageStatus, payload map[string]any, err error) {
+	if payloadType(payload) != "interactive" || !listFallbackError(err) {
+		return
+	}
+	interactive, _ := payload["interactive"].(map[string]any)
+	if t, _ := interactive["type"].(string); t != "list" {
+		return
+	}
+	waID := st.RecipientID
+	// Corre desde el webhook de statuses: sin el lock, un mensaje del mismo usuario en
+	// handleIncoming podría avanzar la sesión y este Set la volvería al estado anterior
+	defer a.userLocks.Lock(ctx, c.Tenant, waID)()
+	sess, ok := a.sessions.Get(c.Tenant + ":" + waID)
+	if !ok {
+		return
+	}
+	cfg, cerr := a.cache.LoadVersion(c.Tenant, sess.Data[flowVersionVar])
+	if cerr != nil {
+		return
+	}
+	state, ok := cfg.States[sess.State]
+	if !ok || state.Type != "interactive_list" || !state.List.textFallbackEnabled() {
+		return
+	}
+	// Meta puede mandar el mismo status más de una vez
+	if !a.dedup.FirstSeen(c.Tenant, "list_fallback:"+st.ID) {
+		return
+	}
+	header, body, footer, sections := listFromPayload(interactive)
+	log.Printf("📝 tenant=%s wa_id=%s la lista de %s no llegó, mando el menú como texto", c.Tenant, waID, sess.State)
+	if err := a.renderer.sendTextMenu(ctx, c.Tenant, c, waID, sess.State, header, body, footer, sections); err != nil {
+		log.Printf("ERROR mandando el menú de texto a wa_id=%s: %v", waID, err)
+	}
+}
+
+// listFromPayload recupera el contenido de un interactive list ya armado para Meta.
+func listFromPayload(interactive map[string]any) (header, body, footer string, sections []FlowSection) {
+	text := func(m any) string {
+		v, _ := m.(map[string]any)
+		s, _ := v["text"].(string)
+		return s
+	}
+	header, body, footer = text(interactive["header"]), text(interactive["body"]), text(interactive["footer"])
+	action, _ := interactive["action"].(map[string]any)
+	for _, s := range payloadMaps(action["sections"]) {
+		title, _ := s["title"].(string)
+		sec := FlowSection{Title: title}
+		for _, r := range payloadMaps(s["rows"]) {
+			id, _ := r["id"].(string)
+			t, _ := r["title"].(string)
+			d, _ := r["description"].(string)
+			sec.Rows = append(sec.Rows, FlowRow{ID: id, Title: t, Description: d})
+		}
+		sections = append(sections, sec)
+	}
+	return header, body, footer, sections
+}
+
+// payloadMaps lee una lista de objetos del payload, armado acá ([]map[string]any) o leído de
+// JSON ([]any, ej: del outbox).
+func payloadMaps(v any) []map[string]any {
+	switch v := v.(type) {
+	case []map[string]any:
+		return v
+	case []any:
+		out := make([]map[string]any, 0, len(v))
+		for _, e := range v {
+			if m, ok := e.(map[string]any); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+	return nil
+}
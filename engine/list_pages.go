@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// ---------------------
+// List pagination
+// ---------------------
+// WhatsApp acepta hasta 10 filas por lista. Si un interactive_list tiene más filas visibles,
+// el renderer lo parte en páginas y agrega "Siguiente ▶" / "◀ Anterior"; el engine resuelve
+// esas filas volviendo a mostrar el mismo estado (sin re-ejecutar su action) en la otra página.
+//
+// La página actual vive en la sesión (_list_page) y se descarta con cualquier otra respuesta.
+
+const (
+	maxListRows      = 10
+	listPageVar      = "_list_page"
+	listPageIDPrefix = "__PAGE_"
+	listNextID       = listPageIDPrefix + "NEXT"
+	listPrevID       = listPageIDPrefix + "PREV"
+	listNextTitle    = "Siguiente ▶"
+	listPrevTitle    = "◀ Anterior"
+)
+
+func validateListRowIDs(stateName string, l *FlowList) []string {
+	var errs []string
+	for _, sec := range l.Sections {
+		for _, row := range sec.Rows {
+			if strings.HasPrefix(row.ID, listPageIDPrefix) {
+				errs = append(errs, fmt.Sprintf("state=%s row id %q usa el prefijo reservado %s", stateName, row.ID, listPageIDPrefix))
+			}
+		}
+	}
+	return errs
+}
+
+type pagedRow struct {
+	section int
+	row     FlowRow
+}
+
+// paginateSections devuelve las secciones de la página pedida (acotada a la última), con
+// las filas de navegación necesarias al final.
+func paginateSections(sections []FlowSection, page int) []FlowSection {
+	var rows []pagedRow
+	for i, sec := range sections {
+		for _, r := range sec.Rows {
+			rows = append(rows, pagedRow{section: i, row: r})
+		}
+	}
+	if len(rows) <= maxListRows {
+		return sections
+	}
+
+	// Armado greedy: cada página deja lugar para sus filas de navegación
+	start, p := 0, 0
+	var pageRows []pagedRow
+	var hasPrev, hasNext bool
+	for {
+		hasPrev = p > 0
+		capacity := maxListRows
+		if hasPrev {
+			capacity--
+		}
+		end := len(rows)
+		hasNext = end-start > capacity
+		if hasNext {
+			end = start + capacity - 1
+		}
+		pageRows = rows[start:end]
+		if p >= page || !hasNext {
+			break
+		}
+		start, p = end, p+1
+	}
+
+	var out []FlowSection
+	last := -1
+	for _, pr := range pageRows {
+		if pr.section != last {
+			out = append(out, FlowSection{Title: sections[pr.section].Title})
+			last = pr.section
+		}
+		out[len(out)-1].Rows = append(out[len(out)-1].Rows, pr.row)
+	}
+	if len(out) == 0 {
+		out = append(out, FlowSection{})
+	}
+	nav := &out[len(out)-1]
+	if hasPrev {
+		nav.Rows = append(nav.Rows, FlowRow{ID: listPrevID, Title: listPrevTitle})
+	}
+	if hasNext {
+		nav.Rows = append(nav.Rows, FlowRow{ID: listNextID, Title: listNextTitle})
+	}
+	return out
+}
+
+// listPageNav resuelve "Siguiente" / "Anterior": se queda en el mismo estado con otra página.
+// Cualquier otra respuesta vuelve a la primera página.
+func listPageNav(sess *UserSession, selectedID string, vars map[string]string) (string, bool) {
+	if selectedID != listNextID && selectedID != listPrevID {
+		delete(sess.Data, listPageVar)
+		delete(vars, listPageVar)
+		return "", false
+	}
+	page, _ := strconv.Atoi(sess.Data[listPageVar])
+	if selectedID == listNextID {
+		page++
+	} else if page > 0 {
+		page--
+	}
+	sess.Data[listPageVar] = strconv.Itoa(page)
+	vars[listPageVar] = sess.Data[listPageVar]
+	log.Printf("📄 Lista de %s: página %d", sess.State, page+1)
+	return sess.State, true
+}
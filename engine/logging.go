@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ---------------------
+// Niveles de log y redacción de datos personales
+// ---------------------
+// LOG_LEVEL (debug, info, warn, error; default info) filtra lo que se escribe. El nivel de
+// cada línea sale de cómo arranca: "ERROR" / ❌ es error, ⚠️ es warn, lo de debugf es debug
+// y el resto info. Los headers y el body crudo del webhook y el texto de los mensajes solo
+// se loguean en debug.
+//
+// Fuera de debug, además, cada línea pasa por una capa de redacción: los números de 8 o más
+// dígitos (wa_id, teléfonos) quedan con los últimos 4 ("•••••••4455"), los emails sin la
+// parte local y los valores de name=, body=, text= (y "name" / "body" / "text" / "caption"
+// en JSON) como "***". LOG_REDACT=1 la fuerza también en debug y LOG_REDACT=0 la apaga.
+//
+// Lo que se guarda (log de mensajes, perfiles de contacto) se minimiza por tenant con
+// "privacy" en flow.json:
+//
+//	"privacy": { "omit_message_bodies": true, "omit_contact_names": true }
+//
+// ENV:
+//
+//	LOG_LEVEL=info
+//	LOG_REDACT=1
+
+const (
+	logLevelDebug = iota
+	logLevelInfo
+	logLevelWarn
+	logLevelError
+
+	debugLogPrefix = "[debug] "
+)
+
+var logLevels = map[string]int{"debug": logLevelDebug, "info": logLevelInfo, "warn": logLevelWarn, "error": logLevelError}
+
+// currentLogLevel lo fija setupLogging (info hasta entonces).
+var currentLogLevel = logLevelInfo
+
+var (
+	redactDigitsRe = regexp.MustCompile(`\b\d{8,}\b`)
+	redactEmailRe  = regexp.MustCompile(`\b[\w.+-]+@([\w-]+\.[\w.-]+)\b`)
+	redactKVRe     = regexp.MustCompile(`\b(name|body|text)=(?:"[^"]*"|\S+)`)
+	redactJSONRe   = regexp.MustCompile(`"(name|body|text|caption)"\s*:\s*"(?:[^"\\]|\\.)*"`)
+)
+
+// setupLogging aplica LOG_LEVEL y LOG_REDACT al logger estándar.
+func setupLogging() {
+	level := logLevelInfo
+	if raw := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_LEVEL"))); raw != "" {
+		l, ok := logLevels[raw]
+		if !ok {
+			log.Printf("⚠️ LOG_LEVEL inválido %q (debug|info|warn|error), uso info", raw)
+		} else {
+			level = l
+		}
+	}
+	redact := level != logLevelDebug
+	switch strings.TrimSpace(os.Getenv("LOG_REDACT")) {
+	case "1":
+		redact = true
+	case "0":
+		redact = false
+	}
+	currentLogLevel = level
+	log.SetOutput(&logWriter{out: os.Stderr, level: level, redact: redact})
+}
+
+// debugf loguea solo con LOG_LEVEL=debug (sin formatear si no hace falta).
+func debugf(format string, args ...any) {
+	if currentLogLevel > logLevelDebug {
+		return
+	}
+	log.Printf(debugLogPrefix+format, args...)
+}
+
+type logWriter struct {
+	out    io.Writer
+	level  int
+	redact bool
+}
+
+// Write recibe una línea completa por llamada (así escribe el paquete log).
+func (w *logWriter) Write(p []byte) (int, error) {
+	if lineLogLevel(p) < w.level {
+		return len(p), nil
+	}
+	if w.redact {
+		if _, err := w.out.Write(redactLogLine(p)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+func lineLogLevel(line []byte) int {
+	switch {
+	case bytes.Contains(line, []byte(debugLogPrefix)):
+		return logLevelDebug
+	case bytes.Contains(line, []byte("ERROR")) || bytes.Contains(line, []byte("❌")):
+		return logLevelError
+	case bytes.Contains(line, []byte("⚠️")):
+		return logLevelWarn
+	}
+	return logLevelInfo
+}
+
+func redactLogLine(line []byte) []byte {
+	line = redactJSONRe.ReplaceAll(line, []byte(`"$1":"***"`))
+	line = redactKVRe.ReplaceAll(line, []byte(`$1=***`))
+	line = redactEmailRe.ReplaceAll(line, []byte(`***@$1`))
+	return redactDigitsRe.ReplaceAllFunc(line, func(d []byte) []byte {
+		return append(bytes.Repeat([]byte("•"), len(d)-4), d[len(d)-4:]...)
+	})
+}
+
+// ---------------------
+// Minimización de datos por tenant
+// ---------------------
+
+type FlowPrivacy struct {
+	// El log de mensajes guarda tipo, dirección y estado, sin el texto ni el payload
+	OmitMessageBodies bool `json:"omit_message_bodies,omitempty"`
+	// El perfil de contacto no guarda el nombre del perfil de WhatsApp
+	OmitContactNames bool `json:"omit_contact_names,omitempty"`
+}
+
+// minimize saca del registro lo que el tenant no quiere guardar.
+func (p *FlowPrivacy) minimize(m *MessageLogEntry) {
+	if p == nil || !p.OmitMessageBodies {
+		return
+	}
+	m.Body, m.Payload = "", nil
+}
+
+// minimizeSessionData enmascara las variables de sesión que el tenant no quiere sacar del
+// bot (el snapshot de session_snapshot.go). OmitMessageBodies tapa lo que escribió el usuario:
+// todas las variables del flow y _when_pending; las internas ("_...") quedan tal cual porque
+// son del motor (versión, historia, menús). OmitContactNames tapa name.
+func (p *FlowPrivacy) minimizeSessionData(data map[string]string) {
+	if p == nil {
+		return
+	}
+	for k := range data {
+		internal := strings.HasPrefix(k, "_") && k != whenPendingVar
+		if p.OmitMessageBodies && !internal || p.OmitContactNames && k == "name" {
+			data[k] = "***"
+		}
+	}
+}
+
+// contactName es el nombre de perfil a guardar ("" si el tenant no guarda nombres).
+func (p *FlowPrivacy) contactName(name string) string {
+	if p != nil && p.OmitContactNames {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Protección contra loops de bots
+// ---------------------
+// Si el número del negocio (o el de otro tenant) termina en la lista de prueba de un flow, o
+// un bot de terceros le contesta al nuestro, los dos se responden sin parar. Dos cortes:
+//
+//   - Números propios: se ignoran los mensajes que vienen de un número de WhatsApp de
+//     flowly (los display_phone_number que llegan en los webhooks, de cualquier tenant) o
+//     de own_numbers. No se les crea sesión ni se les contesta.
+//   - Circuit breaker por sesión: cuenta las respuestas seguidas del bot a mensajes que
+//     llegan a menos de fast_reply_seconds de la anterior (un humano no contesta así de
+//     rápido muchas veces seguidas). Al llegar a max_bot_messages la conversación se corta
+//     pause_minutes: los mensajes quedan en el log pero el bot no responde, y se avisa a
+//     Slack / Teams / Telegram (ver ops_alerts.go).
+//
+// En flow.json (todo opcional, estos son los defaults):
+//
+//	"loop_protection": {
+//	  "own_numbers": ["5491100000000"],
+//	  "max_bot_messages": 30,
+//	  "fast_reply_seconds": 3,
+//	  "pause_minutes": 60
+//	}
+
+const (
+	defaultLoopMaxBotMessages = 30
+	defaultLoopFastReply      = 3 * time.Second
+	defaultLoopPause          = 60 * time.Minute
+	maxOwnNumbers             = 1000
+
+	botStreakVar   = "_bot_streak"        // respuestas rápidas seguidas
+	loopPausedVar  = "_loop_paused_until" // RFC3339: hasta cuándo el bot no responde
+	loopReasonOwn  = "own_number"
+	loopReasonLoop = "circuit_breaker"
+)
+
+type FlowLoopProtection struct {
+	OwnNumbers       []string `json:"own_numbers,omitempty"`
+	MaxBotMessages   int      `json:"max_bot_messages,omitempty"`
+	FastReplySeconds int      `json:"fast_reply_seconds,omitempty"`
+	PauseMinutes     int      `json:"pause_minutes,omitempty"`
+}
+
+func (l *FlowLoopProtection) maxBotMessages() int {
+	if l == nil || l.MaxBotMessages <= 0 {
+		return defaultLoopMaxBotMessages
+	}
+	return l.MaxBotMessages
+}
+
+func (l *FlowLoopProtection) fastReply() time.Duration {
+	if l == nil || l.FastReplySeconds <= 0 {
+		return defaultLoopFastReply
+	}
+	return time.Duration(l.FastReplySeconds) * time.Second
+}
+
+func (l *FlowLoopProtection) pause() time.Duration {
+	if l == nil || l.PauseMinutes <= 0 {
+		return defaultLoopPause
+	}
+	return time.Duration(l.PauseMinutes) * time.Minute
+}
+
+func validateLoopProtection(cfg FlowConfig) []string {
+	l := cfg.LoopProtection
+	if l == nil {
+		return nil
+	}
+	var errs []string
+	if len(l.OwnNumbers) > maxOwnNumbers {
+		errs = append(errs, fmt.Sprintf("loop_protection.own_numbers: máximo %d números", maxOwnNumbers))
+	}
+	for _, n := range l.OwnNumbers {
+		if _, err := cfg.Phone.Normalize(n); err != nil {
+			errs = append(errs, fmt.Sprintf("loop_protection.own_numbers: %v", err))
+		}
+	}
+	if l.MaxBotMessages < 0 || l.FastReplySeconds < 0 || l.PauseMinutes < 0 {
+		errs = append(errs, "loop_protection: max_bot_messages, fast_reply_seconds y pause_minutes no pueden ser negativos")
+	}
+	if l.FastReplySeconds > 60 {
+		errs = append(errs, "loop_protection.fast_reply_seconds: máximo 60")
+	}
+	return errs
+}
+
+// ownNumberKey compara números sin el formato ni las variantes de Meta (549.../54..., 521.../52...).
+func ownNumberKey(n string) string {
+	digits := strings.Map(func(c rune) rune {
+		if c >= '0' && c <= '9' {
+			return c
+		}
+		return -1
+	}, n)
+	return wa.MetaRewrite(digits)
+}
+
+// OwnNumbers son los números de WhatsApp del negocio, aprendidos de los webhooks.
+type OwnNumbers struct {
+	mu      sync.RWMutex
+	numbers map[string]string // ownNumberKey -> phone_number_id
+}
+
+func NewOwnNumbers() *OwnNumbers {
+	return &OwnNumbers{numbers: make(map[string]string)}
+}
+
+// Learn registra el display_phone_number de un phone_number_id.
+func (o *OwnNumbers) Learn(phoneID, display string) {
+	key := ownNumberKey(display)
+	if key == "" {
+		return
+	}
+	o.mu.RLock()
+	_, ok := o.numbers[key]
+	o.mu.RUnlock()
+	if ok {
+		return
+	}
+	o.mu.Lock()
+	if len(o.numbers) < maxOwnNumbers {
+		o.numbers[key] = phoneID
+	}
+	o.mu.Unlock()
+}
+
+func (o *OwnNumbers) Has(number string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	_, ok := o.numbers[ownNumberKey(number)]
+	return ok
+}
+
+// isOwnNumber: el remitente es un número del negocio (de flowly o de own_numbers).
+func (a *App) isOwnNumber(cfg FlowConfig, from string) bool {
+	if a.ownNumbers.Has(from) {
+		return true
+	}
+	if cfg.LoopProtection == nil {
+		return false
+	}
+	key := ownNumberKey(from)
+	for _, n := range cfg.LoopProtection.OwnNumbers {
+		if ownNumberKey(n) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// dropOwnNumber corta los mensajes de números del negocio. true = el mensaje no sigue.
+func (a *App) dropOwnNumber(tenant, from string) bool {
+	cfg, err := a.cache.Load(tenant)
+	if err != nil || !a.isOwnNumber(cfg, from) {
+		return false
+	}
+	metrics.Inc("flowly_inbound_loop_dropped_total", tenant, loopReasonOwn)
+	log.Printf("🔂 tenant=%s mensaje de un número propio (%s) ignorado", tenant, from)
+	return true
+}
+
+// loopBreaker actualiza la racha de respuestas rápidas de la sesión y dice si el bot tiene
+// que dejar de responder (la sesión queda modificada: hay que guardarla igual).
+func (a *App) loopBreaker(tenant, waID string, cfg FlowConfig, sess *UserSession, now time.Time) bool {
+	l := cfg.LoopProtection
+	if until, err := time.Parse(time.RFC3339, sess.Data[loopPausedVar]); err == nil {
+		if now.Before(until) {
+			metrics.Inc("flowly_inbound_loop_dropped_total", tenant, loopReasonLoop)
+			return true
+		}
+		delete(sess.Data, loopPausedVar)
+		delete(sess.Data, botStreakVar)
+	}
+
+	streak := 0
+	if !sess.UpdatedAt.IsZero() && now.Sub(sess.UpdatedAt) < l.fastReply() {
+		streak, _ = strconv.Atoi(sess.Data[botStreakVar])
+		streak++
+	}
+	if streak < l.maxBotMessages() {
+		if streak == 0 {
+			delete(sess.Data, botStreakVar)
+		} else {
+			sess.Data[botStreakVar] = strconv.Itoa(streak)
+		}
+		return false
+	}
+
+	until := now.Add(l.pause())
+	sess.Data[loopPausedVar] = until.UTC().Format(time.RFC3339)
+	delete(sess.Data, botStreakVar)
+	metrics.Inc("flowly_inbound_loop_dropped_total", tenant, loopReasonLoop)
+	log.Printf("🔂 tenant=%s wa_id=%s %d respuestas seguidas en menos de %s: posible loop con otro bot, pausado hasta %s",
+		tenant, waID, streak, l.fastReply(), until.Format(time.RFC3339))
+	a.alerts.Notify(tenant, "bot_loop", fmt.Sprintf("🔂 %s: la conversación con %s parece un loop con otro bot (%d respuestas seguidas en menos de %s). El bot no le responde hasta %s.",
+		tenant, waID, streak, l.fastReply(), until.Format("02/01 15:04")))
+	return true
+}
@@ -0,0 +1,374 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Biblioteca de media por tenant
+// ---------------------
+// configs/{tenant}/media.json le pone nombre a los archivos que manda el flow:
+//
+//	{
+//	  "logo":     { "path": "logo.jpg" },
+//	  "folleto":  { "url": "https://cdn.clinicademo.com/folleto.pdf", "filename": "Folleto.pdf" },
+//	  "gracias":  { "path": "gracias.webp" }
+//	}
+//
+// path es relativo a configs/{tenant}/assets/. Los estados los referencian por nombre:
+//
+//	"messages": [
+//	  { "type": "image", "media": "logo", "body": "Nuestra oficina" },
+//	  { "type": "document", "media": "folleto", "body": "Te dejo el folleto" }
+//	]
+//	"sticker": { "media": "gracias" }
+//
+// La primera vez que se manda, el archivo se sube a la Media API del número y el media ID
+// queda en configs/{tenant}/media_ids.json (aparte de media.json, que es config y puede venir
+// de CONFIG_SOURCE). Meta borra lo subido a los 30 días: pasado mediaIDTTL, o si cambió el
+// número del tenant, se vuelve a subir solo. En Messenger / Instagram no hay media IDs y va
+// por link (url, o el path como asset público con PUBLIC_BASE_URL).
+//
+//	GET  /admin/tenants/{tenant}/media
+//	POST /admin/tenants/{tenant}/media/{name}/upload   (volver a subir, ej: si cambió el archivo)
+
+const (
+	mediaManifestFile = "media.json"
+	mediaIDsFile      = "media_ids.json"
+	mediaIDTTL        = 25 * 24 * time.Hour // Meta los borra a los 30 días
+	maxMediaUpload    = 100 << 20           // límite de Meta para documentos
+)
+
+// MediaAsset es una entrada de media.json.
+type MediaAsset struct {
+	Path     string `json:"path,omitempty"`      // en configs/{tenant}/assets/
+	URL      string `json:"url,omitempty"`       // archivo remoto
+	Filename string `json:"filename,omitempty"`  // documentos: nombre con el que le llega al usuario
+	MimeType string `json:"mime_type,omitempty"` // default: por extensión
+}
+
+// source es el path del archivo (de la URL, sin query), para el nombre y la extensión.
+func (m MediaAsset) source() string {
+	if m.URL != "" {
+		if u, err := url.Parse(m.URL); err == nil {
+			return u.Path
+		}
+		return m.URL
+	}
+	return m.Path
+}
+
+func (m MediaAsset) filename() string {
+	if m.Filename != "" {
+		return m.Filename
+	}
+	return path.Base(m.source())
+}
+
+// uploadedMedia es una entrada de media_ids.json.
+type uploadedMedia struct {
+	MediaID    string    `json:"media_id"`
+	PhoneID    string    `json:"phone_number_id"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// MediaLibrary resuelve nombres de media.json a media IDs, subiendo lo que haga falta.
+type MediaLibrary struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // tenant/name: una sola subida a la vez por archivo
+}
+
+func NewMediaLibrary() *MediaLibrary {
+	return &MediaLibrary{locks: make(map[string]*sync.Mutex)}
+}
+
+func readMediaManifest(tenant string) (map[string]MediaAsset, error) {
+	b, err := os.ReadFile(filepath.Join(ConfigRoot, tenant, mediaManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]MediaAsset{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]MediaAsset
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s inválido: %w", mediaManifestFile, err)
+	}
+	return m, nil
+}
+
+func readUploadedMedia(tenant string) (map[string]uploadedMedia, error) {
+	b, err := os.ReadFile(filepath.Join(ConfigRoot, tenant, mediaIDsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]uploadedMedia{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]uploadedMedia
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s inválido: %w", mediaIDsFile, err)
+	}
+	return m, nil
+}
+
+// Asset devuelve la entrada name de media.json del tenant.
+func (l *MediaLibrary) Asset(tenant, name string) (MediaAsset, error) {
+	manifest, err := readMediaManifest(tenant)
+	if err != nil {
+		return MediaAsset{}, err
+	}
+	asset, ok := manifest[name]
+	if !ok {
+		return MediaAsset{}, fmt.Errorf("media %q no está en %s de %s", name, mediaManifestFile, tenant)
+	}
+	return asset, nil
+}
+
+// Link devuelve la URL pública del archivo (para canales sin media IDs).
+func (l *MediaLibrary) Link(tenant string, asset MediaAsset) (string, error) {
+	if asset.URL != "" {
+		return asset.URL, nil
+	}
+	return buildPublicAssetURL(tenant, asset.Path)
+}
+
+func (l *MediaLibrary) lock(key string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m, ok := l.locks[key]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[key] = m
+	}
+	return m
+}
+
+// MediaID devuelve el media ID de name para el número de c. Lo sube si nunca se subió, si
+// venció o si force.
+func (l *MediaLibrary) MediaID(ctx context.Context, tenant, name string, c *wa.Client, force bool) (string, error) {
+	asset, err := l.Asset(tenant, name)
+	if err != nil {
+		return "", err
+	}
+	mu := l.lock(tenant + "/" + name)
+	mu.Lock()
+	defer mu.Unlock()
+
+	uploaded, err := readUploadedMedia(tenant)
+	if err != nil {
+		return "", err
+	}
+	if u, ok := uploaded[name]; ok && !force && u.PhoneID == c.PhoneID && time.Since(u.UploadedAt) < mediaIDTTL {
+		return u.MediaID, nil
+	}
+	id, err := uploadMediaFrom(ctx, c, tenant, asset)
+	if err != nil {
+		return "", fmt.Errorf("subiendo media %q: %w", name, err)
+	}
+	log.Printf("📎 tenant=%s media %q subida: %s", tenant, name, id)
+
+	// Se relee por si otra réplica subió otro archivo en el medio
+	if uploaded, err = readUploadedMedia(tenant); err != nil {
+		return "", err
+	}
+	uploaded[name] = uploadedMedia{MediaID: id, PhoneID: c.PhoneID, UploadedAt: time.Now()}
+	b, _ := json.MarshalIndent(uploaded, "", "  ")
+	if err := writeFileAtomic(filepath.Join(ConfigRoot, tenant, mediaIDsFile), b); err != nil {
+		log.Printf("ERROR guardando %s de %s: %v", mediaIDsFile, tenant, err)
+	}
+	return id, nil
+}
+
+// uploadMediaFrom sube a la Media API un archivo de configs/{tenant}/assets/ o de una URL.
+func uploadMediaFrom(ctx context.Context, c *wa.Client, tenant string, asset MediaAsset) (string, error) {
+	var data []byte
+	mimeType := asset.MimeType
+	if asset.URL != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", asset.URL, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := httpClientOrShared(c.HTTPClient).Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("GET %s: %s", asset.URL, resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, maxMediaUpload+1)); err != nil {
+			return "", err
+		}
+		if mimeType == "" {
+			mimeType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		}
+	} else {
+		p, err := tenantAssetPath(tenant, asset.Path)
+		if err != nil {
+			return "", err
+		}
+		if data, err = os.ReadFile(p); err != nil {
+			return "", err
+		}
+	}
+	if len(data) > maxMediaUpload {
+		return "", fmt.Errorf("%s supera %d MB", asset.filename(), maxMediaUpload>>20)
+	}
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		if mimeType = mime.TypeByExtension(path.Ext(asset.source())); mimeType == "" {
+			mimeType = http.DetectContentType(data)
+		}
+	}
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i]) // "image/jpeg; charset=..." no lo acepta Meta
+	}
+	return c.UploadMedia(ctx, asset.filename(), mimeType, data)
+}
+
+// tenantAssetPath arma la ruta local de un asset sin salirse de configs/{tenant}/assets/.
+func tenantAssetPath(tenant, assetPath string) (string, error) {
+	clean := path.Clean("/" + strings.TrimSpace(assetPath))
+	if clean == "/" {
+		return "", fmt.Errorf("path de media inválido: %q", assetPath)
+	}
+	return filepath.Join(ConfigRoot, tenant, "assets", filepath.FromSlash(clean)), nil
+}
+
+// sendMedia manda la media name de la biblioteca (kind: image, document o sticker).
+func (r *Renderer) sendMedia(ctx context.Context, tenant string, client MessageSender, to, kind, name, caption string) error {
+	asset, err := r.media.Asset(tenant, name)
+	if err != nil {
+		return err
+	}
+	c, ok := client.(*wa.Client)
+	if !ok {
+		// Messenger / Instagram: por link
+		link, err := r.media.Link(tenant, asset)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case stickerStateType:
+			return client.SendSticker(ctx, to, "", link)
+		case "document":
+			return client.SendText(ctx, to, strings.TrimSpace(caption+"\n"+link))
+		}
+		return client.SendImage(ctx, to, link, caption)
+	}
+	id, err := r.media.MediaID(ctx, tenant, name, c, false)
+	if err != nil {
+		return err
+	}
+	return c.SendMediaID(ctx, to, kind, id, asset.filename(), caption)
+}
+
+// validateMedia chequea que los nombres de media que usa el flow estén en media.json.
+func validateMedia(tenant string, cfg FlowConfig) []string {
+	var refs []string
+	for _, name := range sortedStateNames(cfg) {
+		st := cfg.States[name]
+		for i, m := range st.Messages {
+			if m.Media != "" {
+				refs = append(refs, fmt.Sprintf("state=%s messages[%d]|%s", name, i, m.Media))
+			}
+		}
+		if st.Sticker != nil && st.Sticker.Media != "" {
+			refs = append(refs, fmt.Sprintf("state=%s sticker|%s", name, st.Sticker.Media))
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	manifest, err := readMediaManifest(tenant)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var errs []string
+	for _, name := range sortedKeys(manifest) {
+		a := manifest[name]
+		if (a.Path == "") == (a.URL == "") {
+			errs = append(errs, fmt.Sprintf("%s: %q necesita path o url (uno de los dos)", mediaManifestFile, name))
+		}
+	}
+	for _, ref := range refs {
+		where, name, _ := strings.Cut(ref, "|")
+		if _, ok := manifest[name]; !ok {
+			errs = append(errs, fmt.Sprintf("%s media %q no está en %s", where, name, mediaManifestFile))
+		}
+	}
+	return errs
+}
+
+// ---------------------
+// Admin
+// ---------------------
+
+func (a *App) handleAdminListMedia(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	manifest, err := readMediaManifest(tenant)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	uploaded, err := readUploadedMedia(tenant)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	type item struct {
+		Name string `json:"name"`
+		MediaAsset
+		Uploaded *uploadedMedia `json:"uploaded,omitempty"`
+	}
+	items := make([]item, 0, len(manifest))
+	for _, name := range sortedKeys(manifest) {
+		it := item{Name: name, MediaAsset: manifest[name]}
+		if u, ok := uploaded[name]; ok {
+			it.Uploaded = &u
+		}
+		items = append(items, it)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tenant": tenant, "media": items})
+}
+
+func (a *App) handleAdminUploadMedia(w http.ResponseWriter, r *http.Request) {
+	tenant, name := r.PathValue("tenant"), r.PathValue("name")
+	if _, err := a.media.Asset(tenant, name); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	phoneID, ok := a.resolver.PhoneNumberID(tenant)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "el tenant no tiene número de WhatsApp")
+		return
+	}
+	c, err := a.tenantWhatsAppClient(phoneID, tenant)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	id, err := a.media.MediaID(r.Context(), tenant, name, c, true)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	auditNote(r, "media_id", id)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "tenant": tenant, "name": name, "media_id": id})
+}
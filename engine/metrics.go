@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ---------------------
+// Prometheus metrics
+// ---------------------
+// GET /metrics en formato de texto de Prometheus (sin dependencias: solo counters e
+// histogramas, que es lo que usamos). Si METRICS_TOKEN está seteado, se pide como Bearer.
+
+// durationBuckets: segundos, pensados para "cuánto tarda el usuario en contestar".
+var durationBuckets = []float64{5, 15, 30, 60, 120, 300, 900, 3600, 21600, 86400}
+
+// waitBuckets: segundos, para esperas internas (ej: el lock de una sesión).
+var waitBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30, 60}
+
+type metricsRegistry struct {
+	mu         sync.Mutex
+	counters   map[string]*counterVec
+	histograms map[string]*histogramVec
+}
+
+type counterVec struct {
+	help   string
+	labels []string
+	values map[string]float64 // key: valores de labels unidos por \xff
+}
+
+type histogramVec struct {
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // por bucket (no acumulado)
+	sum    float64
+	count  uint64
+}
+
+var metrics = newMetricsRegistry()
+
+// newMetricsRegistry declara todas las métricas (mismo patrón que jobHandlers).
+func newMetricsRegistry() *metricsRegistry {
+	m := &metricsRegistry{
+		counters:   make(map[string]*counterVec),
+		histograms: make(map[string]*histogramVec),
+	}
+	m.counter("flowly_state_entries_total", "Entradas a cada estado del flow.", "tenant", "state")
+	m.counter("flowly_state_transitions_total", "Transiciones entre estados del flow.", "tenant", "from", "to")
+	m.counter("flowly_flow_completions_total", "Sesiones que llegaron a un estado terminal.", "tenant", "state")
+	m.counter("flowly_ab_assignments_total", "Sesiones asignadas a cada variante de un experimento A/B.", "tenant", "experiment", "variant")
+	m.counter("flowly_ab_completions_total", "Sesiones de un experimento A/B que llegaron a un estado terminal.", "tenant", "experiment", "variant")
+	m.counter("flowly_dead_letters_total", "Envíos y jobs que quedaron en dead-letter (sin más reintentos).", "tenant", "kind")
+	m.counter("flowly_inbound_rate_limited_total", "Mensajes entrantes descartados por el límite por usuario.", "tenant")
+	m.counter("flowly_webhook_rate_limited_total", "Requests al webhook rechazados por el límite por IP.")
+	m.counter("flowly_inbound_senders_blocked_total", "Mensajes entrantes de remitentes bloqueados por senders (allow / deny).", "tenant")
+	m.counter("flowly_calendar_busy_cache_total", "Consultas de free/busy de Google Calendar resueltas con el cache (hit) o con la API (miss).", "tenant", "result")
+	m.counter("flowly_webhook_events_total", "Eventos de la cuenta de WhatsApp recibidos por el webhook (templates, calidad, alertas).", "tenant", "field")
+	m.counter("flowly_calendar_notifications_total", "Avisos de cambio de Google Calendar (watch channels).", "tenant")
+	m.counter("flowly_proactive_sends_total", "Envíos proactivos por la API (POST /admin/tenants/{tenant}/send).", "tenant", "type", "result")
+	m.counter("flowly_inbound_loop_dropped_total", "Mensajes ignorados por la protección contra loops (own_number / circuit_breaker).", "tenant", "reason")
+	m.counter("flowly_outbound_duplicates_skipped_total", "Envíos omitidos porque su idempotency key ya había salido.", "tenant")
+	m.counter("flowly_survey_responses_total", "Respuestas a los estados survey (NPS / CSAT).", "tenant", "survey")
+	m.counter("flowly_lead_assignments_total", "Leads asignados a un asesor por assign_agent.", "tenant", "agent")
+	m.counter("flowly_list_text_fallbacks_total", "Listas que no llegaron y salieron como menú de texto numerado.", "tenant")
+	m.counter("flowly_appointment_confirmations_total", "Respuestas a los recordatorios de turno (confirmed / cancelled).", "tenant", "response")
+	m.histogram("flowly_state_duration_seconds", "Tiempo en un estado hasta pasar al siguiente.", durationBuckets, "tenant", "state")
+	m.histogram("flowly_session_lock_wait_seconds", "Espera por el lock de la sesión (mensajes seguidos del mismo usuario).", waitBuckets, "tenant")
+	return m
+}
+
+func (m *metricsRegistry) counter(name, help string, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] = &counterVec{help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (m *metricsRegistry) histogram(name, help string, buckets []float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.histograms[name] = &histogramVec{help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// Inc suma 1 al counter; los valores van en el orden de las labels declaradas.
+func (m *metricsRegistry) Inc(name string, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.counters[name]; ok {
+		c.values[strings.Join(labelValues, "\xff")]++
+	}
+}
+
+func (m *metricsRegistry) Observe(name string, v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.histograms[name]
+	if !ok {
+		return
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (a *App) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := strings.TrimSpace(os.Getenv("METRICS_TOKEN")); token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.write(w)
+}
+
+func (m *metricsRegistry) write(w http.ResponseWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range sortedKeys(m.counters) {
+		c := m.counters[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, c.help, name)
+		for _, key := range sortedKeys(c.values) {
+			fmt.Fprintf(w, "%s%s %s\n", name, labelSet(c.labels, key, ""), formatFloat(c.values[key]))
+		}
+	}
+
+	for _, name := range sortedKeys(m.histograms) {
+		h := m.histograms[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, h.help, name)
+		for _, key := range sortedKeys(h.series) {
+			s := h.series[key]
+			var cum uint64
+			for i, b := range h.buckets {
+				cum += s.counts[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, labelSet(h.labels, key, formatFloat(b)), cum)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, labelSet(h.labels, key, "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, labelSet(h.labels, key, ""), formatFloat(s.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, labelSet(h.labels, key, ""), s.count)
+		}
+	}
+}
+
+// labelSet arma {a="x",b="y"} (y le suma le="..." para los buckets).
+func labelSet(names []string, key, le string) string {
+	values := strings.Split(key, "\xff")
+	var parts []string
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		parts = append(parts, n+"="+strconv.Quote(v))
+	}
+	if le != "" {
+		parts = append(parts, `le="`+le+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
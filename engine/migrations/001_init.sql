@@ -0,0 +1,36 @@
+-- Sesiones del state machine (una por tenant + wa_id)
+CREATE TABLE IF NOT EXISTS sessions (
+    tenant      TEXT        NOT NULL,
+    wa_id       TEXT        NOT NULL,
+    state       TEXT        NOT NULL,
+    data        JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant, wa_id)
+);
+
+-- Contactos conocidos por tenant
+CREATE TABLE IF NOT EXISTS contacts (
+    tenant      TEXT        NOT NULL,
+    wa_id       TEXT        NOT NULL,
+    name        TEXT        NOT NULL DEFAULT '',
+    first_seen  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant, wa_id)
+);
+
+-- Log completo de mensajes entrantes y salientes
+CREATE TABLE IF NOT EXISTS messages (
+    id          BIGSERIAL   PRIMARY KEY,
+    tenant      TEXT        NOT NULL,
+    wa_id       TEXT        NOT NULL,
+    direction   TEXT        NOT NULL CHECK (direction IN ('in', 'out')),
+    message_id  TEXT        NOT NULL DEFAULT '',
+    type        TEXT        NOT NULL DEFAULT '',
+    state       TEXT        NOT NULL DEFAULT '',
+    body        TEXT        NOT NULL DEFAULT '',
+    payload     JSONB,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS messages_tenant_wa_id_created_at_idx ON messages (tenant, wa_id, created_at);
+CREATE INDEX IF NOT EXISTS messages_tenant_created_at_idx ON messages (tenant, created_at);
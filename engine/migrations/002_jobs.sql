@@ -0,0 +1,18 @@
+-- Cola de jobs programados (recordatorios, timers, campañas, etc.)
+CREATE TABLE IF NOT EXISTS jobs (
+    id          BIGSERIAL   PRIMARY KEY,
+    kind        TEXT        NOT NULL,
+    tenant      TEXT        NOT NULL,
+    wa_id       TEXT        NOT NULL DEFAULT '',
+    ref         TEXT        NOT NULL DEFAULT '',
+    run_at      TIMESTAMPTZ NOT NULL,
+    payload     JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    status      TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed', 'canceled')),
+    attempts    INT         NOT NULL DEFAULT 0,
+    last_error  TEXT        NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS jobs_pending_run_at_idx ON jobs (run_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS jobs_tenant_kind_ref_idx ON jobs (tenant, kind, ref);
@@ -0,0 +1,32 @@
+-- Campañas (broadcast de templates) y su estado por destinatario
+CREATE TABLE IF NOT EXISTS campaigns (
+    id                BIGSERIAL   PRIMARY KEY,
+    tenant            TEXT        NOT NULL,
+    name              TEXT        NOT NULL DEFAULT '',
+    template_name     TEXT        NOT NULL,
+    template_language TEXT        NOT NULL,
+    body_params       JSONB       NOT NULL DEFAULT '[]'::jsonb,
+    window_start      TIMESTAMPTZ NOT NULL,
+    window_end        TIMESTAMPTZ,
+    daily_from        TEXT        NOT NULL DEFAULT '',
+    daily_to          TEXT        NOT NULL DEFAULT '',
+    status            TEXT        NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'running', 'done', 'canceled')),
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS campaigns_tenant_idx ON campaigns (tenant, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS campaign_recipients (
+    campaign_id BIGINT      NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+    wa_id       TEXT        NOT NULL,
+    vars        JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    status      TEXT        NOT NULL DEFAULT 'pending',
+    message_id  TEXT        NOT NULL DEFAULT '',
+    error       TEXT        NOT NULL DEFAULT '',
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (campaign_id, wa_id)
+);
+
+CREATE INDEX IF NOT EXISTS campaign_recipients_pending_idx ON campaign_recipients (campaign_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS campaign_recipients_message_id_idx ON campaign_recipients (message_id) WHERE message_id <> '';
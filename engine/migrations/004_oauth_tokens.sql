@@ -0,0 +1,8 @@
+-- Tokens OAuth por tenant (ej: Google Calendar conectado por el dueño de la agenda)
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+    tenant     TEXT        NOT NULL,
+    provider   TEXT        NOT NULL,
+    token      JSONB       NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant, provider)
+);
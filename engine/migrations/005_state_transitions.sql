@@ -0,0 +1,12 @@
+-- Transiciones de estado del flow (analytics: embudo, tiempos por paso, abandono)
+CREATE TABLE IF NOT EXISTS state_transitions (
+    id          BIGSERIAL   PRIMARY KEY,
+    tenant      TEXT        NOT NULL,
+    wa_id       TEXT        NOT NULL,
+    from_state  TEXT        NOT NULL DEFAULT '',
+    to_state    TEXT        NOT NULL,
+    seconds_in  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS state_transitions_tenant_created_at_idx ON state_transitions (tenant, created_at);
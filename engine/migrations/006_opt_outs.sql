@@ -0,0 +1,10 @@
+-- Usuarios que pidieron no recibir más mensajes (STOP / BAJA); no se les manda nada proactivo
+CREATE TABLE IF NOT EXISTS opt_outs (
+    tenant     TEXT        NOT NULL,
+    wa_id      TEXT        NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant, wa_id)
+);
+
+CREATE INDEX IF NOT EXISTS opt_outs_tenant_created_at_idx ON opt_outs (tenant, created_at DESC);
@@ -0,0 +1,7 @@
+-- Perfil de contacto: datos que dejó el usuario, tags y campos libres (ver contact_profiles.go)
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS email  TEXT  NOT NULL DEFAULT '';
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS dni    TEXT  NOT NULL DEFAULT '';
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS tags   JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS fields JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS contacts_tenant_last_seen_idx ON contacts (tenant, last_seen DESC);
@@ -0,0 +1,3 @@
+-- Experimento A/B y variante de cada transición (ver ab_tests.go)
+ALTER TABLE state_transitions ADD COLUMN IF NOT EXISTS experiment TEXT NOT NULL DEFAULT '';
+ALTER TABLE state_transitions ADD COLUMN IF NOT EXISTS variant    TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,20 @@
+-- Audit log append-only de acciones admin y cambios de config (ver audit.go)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL   PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor       TEXT        NOT NULL,
+    action      TEXT        NOT NULL,
+    tenant      TEXT        NOT NULL DEFAULT '',
+    target      TEXT        NOT NULL DEFAULT '',
+    status      INT         NOT NULL DEFAULT 0,
+    remote_addr TEXT        NOT NULL DEFAULT '',
+    details     JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    diff        TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at DESC);
+CREATE INDEX IF NOT EXISTS audit_log_tenant_created_at_idx ON audit_log (tenant, created_at DESC);
+
+-- Append-only: las modificaciones se ignoran
+CREATE OR REPLACE RULE audit_log_no_update AS ON UPDATE TO audit_log DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE audit_log_no_delete AS ON DELETE TO audit_log DO INSTEAD NOTHING;
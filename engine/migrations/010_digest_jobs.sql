@@ -0,0 +1,2 @@
+-- Un solo resumen diario por tenant y día aunque varias réplicas lo programen a la vez
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_agenda_digest_uniq ON jobs (tenant, ref) WHERE kind = 'agenda_digest';
@@ -0,0 +1,17 @@
+-- Turnos reservados por el bot: respuesta al recordatorio y asistencia (ver appointments.go)
+CREATE TABLE IF NOT EXISTS appointments (
+    tenant       TEXT        NOT NULL,
+    event_id     TEXT        NOT NULL,
+    wa_id        TEXT        NOT NULL,
+    name         TEXT        NOT NULL DEFAULT '',
+    resource_id  TEXT        NOT NULL DEFAULT '',
+    start_at     TIMESTAMPTZ NOT NULL,
+    confirmation TEXT        NOT NULL DEFAULT '' CHECK (confirmation IN ('', 'confirmed', 'cancelled')),
+    outcome      TEXT        NOT NULL DEFAULT '' CHECK (outcome IN ('', 'attended', 'no_show')),
+    reminded_at  TIMESTAMPTZ,
+    responded_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS appointments_tenant_start_idx ON appointments (tenant, start_at DESC);
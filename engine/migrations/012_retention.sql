@@ -0,0 +1,5 @@
+-- Retención por tenant y borrado de los datos de un contacto (ver retention.go)
+CREATE INDEX IF NOT EXISTS sessions_tenant_updated_at_idx ON sessions (tenant, updated_at);
+CREATE INDEX IF NOT EXISTS state_transitions_tenant_wa_id_idx ON state_transitions (tenant, wa_id);
+CREATE INDEX IF NOT EXISTS appointments_tenant_wa_id_idx ON appointments (tenant, wa_id);
+CREATE INDEX IF NOT EXISTS jobs_tenant_wa_id_idx ON jobs (tenant, wa_id) WHERE wa_id <> '';
@@ -0,0 +1,15 @@
+-- Respuestas a los estados "survey" (NPS / CSAT, ver survey.go)
+CREATE TABLE IF NOT EXISTS survey_responses (
+    id           BIGSERIAL   PRIMARY KEY,
+    tenant       TEXT        NOT NULL,
+    survey       TEXT        NOT NULL,
+    wa_id        TEXT        NOT NULL,
+    state        TEXT        NOT NULL DEFAULT '',
+    flow_version TEXT        NOT NULL DEFAULT '',
+    scale        TEXT        NOT NULL,
+    score        INTEGER     NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS survey_responses_tenant_created_at_idx ON survey_responses (tenant, created_at);
+CREATE INDEX IF NOT EXISTS survey_responses_tenant_wa_id_idx ON survey_responses (tenant, wa_id);
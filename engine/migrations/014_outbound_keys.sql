@@ -0,0 +1,12 @@
+-- Idempotency keys de los mensajes salientes (ver idempotency.go)
+CREATE TABLE IF NOT EXISTS outbound_keys (
+    key        TEXT        PRIMARY KEY,
+    tenant     TEXT        NOT NULL,
+    wa_id      TEXT        NOT NULL,
+    status     TEXT        NOT NULL DEFAULT 'pending',
+    message_id TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS outbound_keys_created_at_idx ON outbound_keys (created_at);
+CREATE INDEX IF NOT EXISTS outbound_keys_tenant_wa_id_idx ON outbound_keys (tenant, wa_id);
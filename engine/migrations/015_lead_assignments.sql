@@ -0,0 +1,15 @@
+-- Leads asignados a los asesores del tenant (ver agents.go)
+CREATE TABLE IF NOT EXISTS lead_assignments (
+    id         BIGSERIAL   PRIMARY KEY,
+    tenant     TEXT        NOT NULL,
+    wa_id      TEXT        NOT NULL,
+    name       TEXT        NOT NULL DEFAULT '',
+    agent_id   TEXT        NOT NULL,
+    strategy   TEXT        NOT NULL DEFAULT '',
+    data       JSONB       NOT NULL DEFAULT '{}',
+    notified   BOOLEAN     NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS lead_assignments_tenant_created_idx ON lead_assignments (tenant, created_at DESC);
+CREATE INDEX IF NOT EXISTS lead_assignments_tenant_wa_id_idx ON lead_assignments (tenant, wa_id);
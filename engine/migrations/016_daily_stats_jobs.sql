@@ -0,0 +1,2 @@
+-- Un solo resumen de estadísticas por tenant y día aunque lo encolen varias réplicas (ver notifications.go)
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_daily_stats_uniq ON jobs (tenant, ref) WHERE kind = 'daily_stats';
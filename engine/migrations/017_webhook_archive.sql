@@ -0,0 +1,15 @@
+-- Bodies de los webhooks recibidos, comprimidos con gzip (ver webhook_archive.go)
+CREATE TABLE IF NOT EXISTS webhook_archive (
+    id           BIGSERIAL   PRIMARY KEY,
+    tenant       TEXT        NOT NULL,
+    route_tenant TEXT        NOT NULL DEFAULT '',
+    wa_id        TEXT        NOT NULL DEFAULT '',
+    object       TEXT        NOT NULL DEFAULT '',
+    size         INTEGER     NOT NULL DEFAULT 0,
+    body         BYTEA       NOT NULL,
+    received_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_archive_tenant_received_idx ON webhook_archive (tenant, received_at DESC);
+CREATE INDEX IF NOT EXISTS webhook_archive_received_idx ON webhook_archive (received_at);
+CREATE INDEX IF NOT EXISTS webhook_archive_tenant_wa_id_idx ON webhook_archive (tenant, wa_id);
@@ -0,0 +1,476 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Fechas en lenguaje natural
+// ---------------------
+// Un campo de form con "validate": "when" acepta la fecha como la escribiría cualquiera, en
+// castellano o en inglés: "mañana a las 15", "el jueves", "pasado mañana a la tarde", "el 16
+// a las 10:30", "la semana que viene el martes", "next Monday 3pm", "15/10"... y la resuelve
+// en la zona horaria de la agenda (un "mañana" a las 23:30 es el día siguiente de acá, no
+// el de UTC):
+//
+//	"ASK_WHEN": {
+//	  "type": "form",
+//	  "form": { "fields": [
+//	    { "name": "turno_dia", "prompt": "¿Para cuándo querés el turno? (ej: mañana a las 15, el jueves)", "validate": "when" }
+//	  ]},
+//	  "on_text_next": "PICK_TIME"
+//	},
+//	"PICK_TIME": {
+//	  "type": "interactive_list", "action": "get_calendar_slots", "body": "Estos son los horarios de ese día:",
+//	  ...
+//	}
+//
+// Se guarda el día en la variable del campo (2006-01-02) y la hora pedida en {campo}_time
+// (15:04, vacía si no dijo). El get_calendar_slots siguiente muestra solo los horarios de ese
+// día a partir de esa hora (calendar_day / calendar_time; "a la mañana", "a la tarde" y "a la
+// noche" arrancan a las 6, 13 y 19); slot_exact = "1" si el primero es justo a esa hora. Si
+// desde esa hora no queda nada, muestra el día entero. "A las 12 de la noche" son las 00:00
+// del día siguiente ("mañana a las 12 de la noche" = pasado mañana 00:00).
+//
+// Cuando la respuesta se entiende a medias, el form repregunta y completa con lo que conteste:
+//   - "a las 5" (de 1 a 7 sin am/pm ni franja): "¿A las 5 de la mañana o de la tarde?"
+//   - "la semana que viene" sin día: "¿Qué día de la semana que viene?"
+//   - día de la semana y número que no coinciden ("el jueves 17"): "¿El viernes 17/10 o el jueves 16/10?"
+//
+// Las fechas pasadas o más allá de la ventana de la agenda (calendar.SearchDays) se rechazan
+// como cualquier respuesta inválida (con el error del campo, si tiene).
+
+const (
+	formValidateWhen = "when"
+
+	whenPendingVar  = "_when_pending"  // lo que ya dijo antes de una repregunta
+	calendarWhenVar = "_calendar_when" // día (y hora) pedidos para el próximo get_calendar_slots
+	calendarTimeVar = "calendar_time"
+	slotExactVar    = "slot_exact"
+)
+
+var errWhenUnknown = errors.New(`no entendí qué día (ej: "mañana a las 15" o "el jueves")`)
+
+// whenClarification: la fecha se entendió a medias; question es la repregunta.
+type whenClarification struct{ question string }
+
+func (c whenClarification) Error() string { return c.question }
+
+// whenClarifyTexts son las repreguntas de un idioma (el parser entiende es y en).
+type whenClarifyTexts struct {
+	hour     string // %d = la hora
+	week     string
+	mismatch string // %s = los dos días
+	layout   string
+}
+
+var whenClarifications = map[string]whenClarifyTexts{
+	"es": {
+		hour:     "¿A las %d de la mañana o de la tarde?",
+		week:     "¿Qué día de la semana que viene? (ej: el martes)",
+		mismatch: "¿El %s o el %s?",
+		layout:   "Monday 02/01",
+	},
+	"en": {
+		hour:     "At %d in the morning or in the afternoon?",
+		week:     "Which day next week? (e.g. Tuesday)",
+		mismatch: "%s or %s?",
+		layout:   "Monday 01/02",
+	},
+}
+
+func whenClarifyFor(lang string) whenClarifyTexts {
+	if t, ok := whenClarifications[localeLang(lang)]; ok {
+		return t
+	}
+	return whenClarifications[defaultLanguage]
+}
+
+// naturalWhen es una fecha ya resuelta.
+type naturalWhen struct {
+	Day  time.Time // 00:00 en la zona de la agenda
+	Time string    // hora pedida (15:04); "" = cualquiera
+	From string    // desde qué hora mostrar horarios: la pedida o el comienzo de la franja
+}
+
+// dayPeriod es una franja del día: desde qué hora se muestran horarios y hasta cuándo sirve hoy.
+type dayPeriod struct{ from, until int }
+
+var (
+	whenAccents   = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n", "a.m.", "am", "p.m.", "pm")
+	whenDecimal   = regexp.MustCompile(`(\d)[.h](\d\d)\b`)
+	whenDash      = regexp.MustCompile(`(\d)-(\d)`)
+	whenSeparator = regexp.MustCompile(`[^a-z0-9:/]+`)
+
+	whenDayAfter  = regexp.MustCompile(`\b(?:pasado manana|day after tomorrow)\b`)
+	whenTomorrow  = regexp.MustCompile(`\b(?:manana|tomorrow)\b`)
+	whenToday     = regexp.MustCompile(`\b(?:hoy|today)\b`)
+	whenYesterday = regexp.MustCompile(`\b(?:ayer|yesterday)\b`)
+	whenTonight   = regexp.MustCompile(`\b(?:esta noche|tonight)\b`)
+	whenNextWeek  = regexp.MustCompile(`\b(?:semana que viene|proxima semana|semana proxima|next week)\b`)
+	whenNoon      = regexp.MustCompile(`\b(?:mediodia|noon|midday)\b`)
+
+	periodMorning   = dayPeriod{6, 12}
+	periodAfternoon = dayPeriod{13, 19}
+	periodNight     = dayPeriod{19, 24}
+	whenPeriods     = []struct {
+		re     *regexp.Regexp
+		period dayPeriod
+	}{
+		{regexp.MustCompile(`\b(?:(?:de|por|a|en) la manana|(?:in the )?morning)\b`), periodMorning},
+		{regexp.MustCompile(`\b(?:(?:de|por|a|en) la tarde|(?:in the )?afternoon|tarde)\b`), periodAfternoon},
+		{regexp.MustCompile(`\b(?:(?:de|por|a|en) la noche|(?:in the )?(?:evening|night)|noche)\b`), periodNight},
+	}
+	// "10 de la mañana": el número es la hora (no el día de "el lunes 10")
+	whenHourPeriod  = regexp.MustCompile(`\b(\d{1,2}) +de la (manana|tarde|noche)\b`)
+	whenHourPeriods = map[string]dayPeriod{"manana": periodMorning, "tarde": periodAfternoon, "noche": periodNight}
+
+	whenNumericDate = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})(?:/(\d{4}|\d{2}))?\b`)
+	whenDayOfMonth  = regexp.MustCompile(`\b(?:el|the) +(\d{1,2})(?:st|nd|rd|th)?\b`)
+
+	whenClock    = regexp.MustCompile(`\b(\d{1,2}):(\d{2}) *(am|pm)?\b`)
+	whenAmPm     = regexp.MustCompile(`\b(\d{1,2}) *(am|pm)\b`)
+	whenHours    = regexp.MustCompile(`\b(\d{1,2}) *(?:hs|h|hrs|horas)\b`)
+	whenAtHour   = regexp.MustCompile(`\b(?:a las?|at|tipo|a eso de|around) +(\d{1,2})(?: y (media|cuarto))?\b`)
+	whenWeekdays map[string]time.Weekday
+	whenMonths   map[string]time.Month
+	whenWeekday  *regexp.Regexp
+	whenDayMonth *regexp.Regexp
+	whenMonthDay *regexp.Regexp
+)
+
+func init() {
+	whenWeekdays = map[string]time.Weekday{
+		"mon": time.Monday, "tue": time.Tuesday, "tues": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "fri": time.Friday,
+		"sat": time.Saturday, "sun": time.Sunday,
+	}
+	whenMonths = map[string]time.Month{"setiembre": time.September}
+	for _, lang := range []string{"es", "en"} {
+		l := dateLocales[lang]
+		for i, d := range l.days {
+			whenWeekdays[normalizeWhen(d)] = time.Weekday(i)
+		}
+		for i := range l.months {
+			whenMonths[normalizeWhen(l.months[i])] = time.Month(i + 1)
+			whenMonths[normalizeWhen(l.short[i])] = time.Month(i + 1)
+		}
+	}
+	days, months := whenAlternation(whenWeekdays), whenAlternation(whenMonths)
+	whenWeekday = regexp.MustCompile(`\b(` + days + `)\b(?: +(\d{1,2})(?:st|nd|rd|th)?(?:[^\w:]|$))?`)
+	whenDayMonth = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)? +(?:de +|of +)?(` + months + `)\b(?: +(?:de +)?(\d{4}))?`)
+	whenMonthDay = regexp.MustCompile(`\b(` + months + `) +(\d{1,2})(?:st|nd|rd|th)?\b`)
+}
+
+// whenAlternation arma "a|b|c" con las más largas primero (para que "tues" gane a "tue").
+func whenAlternation[V any](m map[string]V) string {
+	names := sortedKeys(m)
+	sort.SliceStable(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	return strings.Join(names, "|")
+}
+
+// normalizeWhen pasa a minúsculas sin acentos, con 15.30 / 15h30 como 15:30 y 15-10 como 15/10.
+func normalizeWhen(s string) string {
+	s = whenAccents.Replace(strings.ToLower(s))
+	s = whenDecimal.ReplaceAllString(s, "$1:$2")
+	s = whenDash.ReplaceAllString(s, "$1/$2")
+	return strings.TrimSpace(whenSeparator.ReplaceAllString(s, " "))
+}
+
+// whenText es el texto que falta interpretar; take saca lo que ya se entendió.
+type whenText struct{ s string }
+
+func (t *whenText) take(re *regexp.Regexp) []string {
+	m := re.FindStringSubmatchIndex(t.s)
+	if m == nil {
+		return nil
+	}
+	out := make([]string, len(m)/2)
+	for i := range out {
+		if m[2*i] >= 0 {
+			out[i] = t.s[m[2*i]:m[2*i+1]]
+		}
+	}
+	t.s = t.s[:m[0]] + " " + t.s[m[1]:]
+	return out
+}
+
+// parseNaturalWhen interpreta text con now en la zona de la agenda. Devuelve whenClarification
+// si hay que repreguntar.
+func parseNaturalWhen(text string, now time.Time, lang string) (naturalWhen, error) {
+	t := &whenText{s: normalizeWhen(text)}
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	clarify := whenClarifyFor(lang)
+	found := false
+
+	// Hora que se entiende sola (10:30, 9 am, 11 hs, 4 de la tarde, a las 10): va primero
+	// para que el número no se lea como día ("el lunes 10 de la mañana" no es el 10)
+	var period *dayPeriod
+	hour, minute := -1, 0
+	ampm := ""
+	hourText := ""
+	if m := t.take(whenClock); m != nil {
+		hourText, ampm = m[1], m[3]
+		minute, _ = strconv.Atoi(m[2])
+	} else if m := t.take(whenAmPm); m != nil {
+		hourText, ampm = m[1], m[2]
+	} else if m := t.take(whenHours); m != nil {
+		hourText = m[1]
+	} else if m := t.take(whenHourPeriod); m != nil {
+		p := whenHourPeriods[m[2]]
+		hourText, period, found = m[1], &p, true
+	} else if m := t.take(whenAtHour); m != nil {
+		hourText = m[1]
+		switch m[2] {
+		case "media":
+			minute = 30
+		case "cuarto":
+			minute = 15
+		}
+	} else if t.take(whenNoon) != nil {
+		hourText = "12"
+	}
+
+	// Franja del día (antes que "mañana" = tomorrow, por "de la mañana")
+	relative, hasRelative := 0, false
+	if period == nil && t.take(whenTonight) != nil {
+		period, hasRelative = &dayPeriod{19, 24}, true
+	}
+	for _, p := range whenPeriods {
+		if period == nil && t.take(p.re) != nil {
+			period, found = &p.period, true
+		}
+	}
+
+	// Día: relativo, fecha, día de la semana
+	switch {
+	case t.take(whenDayAfter) != nil:
+		relative, hasRelative = 2, true
+	case t.take(whenTomorrow) != nil:
+		relative, hasRelative = 1, true
+	case t.take(whenToday) != nil:
+		relative, hasRelative = 0, true
+	case t.take(whenYesterday) != nil:
+		relative, hasRelative = -1, true
+	}
+	nextWeek := t.take(whenNextWeek) != nil
+
+	var date time.Time
+	hasDate := false
+	setDate := func(year, month, day int, withYear bool) error {
+		if !withYear {
+			year = today.Year()
+		}
+		d := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+		if d.Day() != day || int(d.Month()) != month {
+			return fmt.Errorf("esa fecha no existe")
+		}
+		if !withYear && d.Before(today) {
+			d = d.AddDate(1, 0, 0)
+		}
+		date, hasDate = d, true
+		return nil
+	}
+
+	if m := t.take(whenNumericDate); m != nil {
+		day, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if localeLang(lang) == "en" {
+			day, month = month, day
+		}
+		year, _ := strconv.Atoi(m[3])
+		if year > 0 && year < 100 {
+			year += 2000
+		}
+		if err := setDate(year, month, day, m[3] != ""); err != nil {
+			return naturalWhen{}, err
+		}
+	} else if m := t.take(whenDayMonth); m != nil {
+		day, _ := strconv.Atoi(m[1])
+		year, _ := strconv.Atoi(m[3])
+		if err := setDate(year, int(whenMonths[m[2]]), day, m[3] != ""); err != nil {
+			return naturalWhen{}, err
+		}
+	} else if m := t.take(whenMonthDay); m != nil {
+		day, _ := strconv.Atoi(m[2])
+		if err := setDate(0, int(whenMonths[m[1]]), day, false); err != nil {
+			return naturalWhen{}, err
+		}
+	}
+
+	weekday := time.Weekday(-1)
+	dayOfMonth := ""
+	if m := t.take(whenWeekday); m != nil {
+		weekday, dayOfMonth = whenWeekdays[m[1]], m[2] // "jueves 16"
+	}
+	if m := t.take(whenDayOfMonth); m != nil && dayOfMonth == "" {
+		dayOfMonth = m[1] // "el 16"
+	}
+	if !hasDate && dayOfMonth != "" {
+		day, _ := strconv.Atoi(dayOfMonth)
+		year, month := today.Year(), int(today.Month())
+		if day < today.Day() {
+			month++
+		}
+		if month > 12 {
+			year, month = year+1, 1
+		}
+		if err := setDate(year, month, day, true); err != nil {
+			return naturalWhen{}, err
+		}
+	}
+
+	// Hora
+	ambiguous := false
+	midnight := false // "las 12 de la noche": las 00:00 del día siguiente
+	if hourText != "" {
+		hour, _ = strconv.Atoi(hourText)
+		switch {
+		case ampm != "" && (hour < 1 || hour > 12):
+			return naturalWhen{}, fmt.Errorf("el horario no es válido")
+		case ampm == "pm" && hour < 12:
+			hour += 12
+		case ampm == "am" && hour == 12:
+			hour = 0
+		case ampm == "" && period != nil && *period == periodNight && hour == 12:
+			hour, midnight = 0, true
+		case ampm == "" && period != nil && period.from >= 12 && hour < 12:
+			hour += 12
+		case ampm == "" && period == nil && len(hourText) == 1 && hour >= 1 && hour <= 7:
+			ambiguous = true
+		}
+		if hour > 23 || minute > 59 {
+			return naturalWhen{}, fmt.Errorf("el horario no es válido")
+		}
+	}
+
+	found = found || hasRelative || nextWeek || hasDate || weekday >= 0 || hour >= 0
+	if !found {
+		return naturalWhen{}, errWhenUnknown
+	}
+	if ambiguous {
+		return naturalWhen{}, whenClarification{fmt.Sprintf(clarify.hour, hour)}
+	}
+
+	// Resolver el día
+	var day time.Time
+	switch {
+	case hasRelative:
+		day = today.AddDate(0, 0, relative)
+	case hasDate:
+		day = date
+		if weekday >= 0 && date.Weekday() != weekday {
+			other := nextWeekday(today, weekday, nextWeek)
+			l := dateLocaleFor(lang)
+			return naturalWhen{}, whenClarification{fmt.Sprintf(clarify.mismatch, l.format(date, clarify.layout), l.format(other, clarify.layout))}
+		}
+	case weekday >= 0:
+		day = nextWeekday(today, weekday, nextWeek)
+	case nextWeek:
+		return naturalWhen{}, whenClarification{clarify.week}
+	default:
+		// Solo la hora o la franja: hoy si todavía llega, si no mañana
+		day = today
+		if !midnight && ((hour >= 0 && hour*60+minute <= now.Hour()*60+now.Minute()) || (hour < 0 && period != nil && now.Hour() >= period.until)) {
+			day = today.AddDate(0, 0, 1)
+		}
+	}
+	if midnight {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	switch {
+	case day.Before(today):
+		return naturalWhen{}, fmt.Errorf("esa fecha ya pasó")
+	case day.After(today.AddDate(0, 0, calendar.SearchDays)):
+		return naturalWhen{}, fmt.Errorf("solo doy turnos para los próximos %d días", calendar.SearchDays)
+	case day.Equal(today) && hour >= 0 && hour*60+minute <= now.Hour()*60+now.Minute():
+		return naturalWhen{}, fmt.Errorf("ese horario ya pasó")
+	}
+
+	w := naturalWhen{Day: day}
+	if hour >= 0 {
+		w.Time = fmt.Sprintf("%02d:%02d", hour, minute)
+		w.From = w.Time
+	} else if period != nil {
+		w.From = fmt.Sprintf("%02d:00", period.from)
+	}
+	return w, nil
+}
+
+// nextWeekday es el próximo weekday después de hoy o, con nextWeek, el de la semana que viene
+// (de lunes a domingo).
+func nextWeekday(today time.Time, weekday time.Weekday, nextWeek bool) time.Time {
+	if nextWeek {
+		sinceMonday := (int(today.Weekday()) + 6) % 7
+		monday := today.AddDate(0, 0, 7-sinceMonday)
+		return monday.AddDate(0, 0, (int(weekday)+6)%7)
+	}
+	diff := (int(weekday) - int(today.Weekday()) + 7) % 7
+	if diff == 0 {
+		diff = 7
+	}
+	return today.AddDate(0, 0, diff)
+}
+
+// formWhenInput resuelve la respuesta de un campo "when": devuelve el día y deja la hora en
+// {campo}_time y el pedido para get_calendar_slots. Si repregunta, se acuerda de lo que ya dijo
+// para completarlo con la próxima respuesta ("a las 5" + "de la tarde").
+func (a *App) formWhenInput(tenant string, sess *UserSession, vars map[string]string, fld FlowFormField, txt string) (string, error) {
+	lang := a.sessionDateLang(tenant, sess)
+	now := time.Now().In(calendar.Location())
+	w, err := parseNaturalWhen(txt, now, lang)
+	if pending := sess.Data[whenPendingVar]; pending != "" {
+		txt = pending + " " + txt
+		if cw, cerr := parseNaturalWhen(txt, now, lang); cerr == nil || err != nil {
+			w, err = cw, cerr
+		}
+	}
+
+	var clarify whenClarification
+	if errors.As(err, &clarify) {
+		setSessionVar(sess, vars, whenPendingVar, txt)
+		return "", err
+	}
+	delete(sess.Data, whenPendingVar)
+	delete(vars, whenPendingVar)
+	if err != nil {
+		return "", err
+	}
+
+	day := w.Day.Format("2006-01-02")
+	setSessionVar(sess, vars, fld.Name+"_time", w.Time)
+	setSessionVar(sess, vars, calendarWhenVar, strings.TrimSpace(day+" "+w.From))
+	log.Printf("📆 FORM %s: %q = %s %s", fld.Name, txt, day, w.From)
+	return day, nil
+}
+
+// requestedCalendarDay es el día (y la hora desde la que mostrar) que pidió con un campo
+// "when", si todavía no se usó.
+func requestedCalendarDay(sess *UserSession) (day, from string, ok bool) {
+	w := sess.Data[calendarWhenVar]
+	if w == "" {
+		return "", "", false
+	}
+	day, from, _ = strings.Cut(w, " ")
+	return day, from, true
+}
+
+// slotClock es la hora del horario en la zona de la agenda (15:04).
+func slotClock(s calendar.Slot) string {
+	start, err := time.Parse(time.RFC3339, s.ISOValue)
+	if err != nil {
+		return ""
+	}
+	return start.In(calendar.Location()).Format("15:04")
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNaturalWhen(t *testing.T) {
+	// Miércoles 14/10/2026 a las 9 de la mañana
+	now := time.Date(2026, 10, 14, 9, 0, 0, 0, time.FixedZone("ART", -3*3600))
+
+	tests := []struct {
+		in      string
+		lang    string
+		day     string // 2006-01-02
+		time    string
+		from    string
+		clarify string // la repregunta (contiene)
+		err     bool
+	}{
+		{in: "mañana a las 15", day: "2026-10-15", time: "15:00", from: "15:00"},
+		{in: "el jueves", day: "2026-10-15"},
+		{in: "pasado mañana a la tarde", day: "2026-10-16", from: "13:00"},
+		{in: "el 16 a las 10:30", day: "2026-10-16", time: "10:30", from: "10:30"},
+		{in: "15/10", day: "2026-10-15"},
+		{in: "el jueves 15", day: "2026-10-15"},
+		{in: "mañana a las 9 y media", day: "2026-10-15", time: "09:30", from: "09:30"},
+		{in: "next Monday 3pm", lang: "en", day: "2026-10-19", time: "15:00", from: "15:00"},
+
+		// La hora después del día de la semana no es un día del mes
+		{in: "el lunes 10 de la mañana", day: "2026-10-19", time: "10:00", from: "10:00"},
+		{in: "el viernes 9 am", day: "2026-10-16", time: "09:00", from: "09:00"},
+		{in: "el jueves 11 hs", day: "2026-10-15", time: "11:00", from: "11:00"},
+		{in: "el martes 4 de la tarde", day: "2026-10-20", time: "16:00", from: "16:00"},
+		{in: "el lunes 19 a las 10", day: "2026-10-19", time: "10:00", from: "10:00"},
+
+		// Medianoche
+		{in: "mañana a las 12 de la noche", day: "2026-10-16", time: "00:00", from: "00:00"},
+		{in: "a las 12 de la noche", day: "2026-10-15", time: "00:00", from: "00:00"},
+		{in: "mañana a las 12", day: "2026-10-15", time: "12:00", from: "12:00"},
+
+		// Repreguntas
+		{in: "a las 5", clarify: "¿A las 5 de la mañana o de la tarde?"},
+		{in: "la semana que viene", clarify: "¿Qué día de la semana que viene?"},
+		{in: "el jueves 16", clarify: "¿El viernes 16/10 o el jueves 15/10?"},
+
+		// Inválidas
+		{in: "ayer", err: true},
+		{in: "31/02", err: true},
+		{in: "hoy a las 8", err: true},
+		{in: "cuando puedas", err: true},
+	}
+	for _, tt := range tests {
+		lang := tt.lang
+		if lang == "" {
+			lang = "es"
+		}
+		w, err := parseNaturalWhen(tt.in, now, lang)
+
+		var clarify whenClarification
+		switch {
+		case tt.clarify != "":
+			if !errors.As(err, &clarify) || !strings.Contains(clarify.question, tt.clarify) {
+				t.Errorf("%q: se esperaba la repregunta %q, llegó %v", tt.in, tt.clarify, err)
+			}
+		case tt.err:
+			if err == nil || errors.As(err, &clarify) {
+				t.Errorf("%q: se esperaba un error, llegó %s %q (%v)", tt.in, w.Day.Format("2006-01-02"), w.Time, err)
+			}
+		case err != nil:
+			t.Errorf("%q: %v", tt.in, err)
+		default:
+			if got := w.Day.Format("2006-01-02"); got != tt.day || w.Time != tt.time || w.From != tt.from {
+				t.Errorf("%q = %s time=%q from=%q, se esperaba %s time=%q from=%q", tt.in, got, w.Time, w.From, tt.day, tt.time, tt.from)
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Canales de avisos del tenant (Slack / Teams)
+// ---------------------
+// Para que el equipo del negocio vea lo importante donde ya trabaja, cada tenant puede
+// tener sus propios incoming webhooks de Slack y/o Microsoft Teams en flow.json:
+//
+//	"notifications": {
+//	  "slack_webhook_url": "${BROKER_SLACK_WEBHOOK_URL}",
+//	  "teams_webhook_url": "${BROKER_TEAMS_WEBHOOK_URL}",
+//	  "events": ["handoff", "dead_letter", "templates", "daily_stats"],
+//	  "daily_stats_time": "20:00"
+//	}
+//
+// Las URLs son secretas: conviene dejarlas en el .env (${ENV_VAR} se expande al mandar).
+// Eventos (sin "events", todos):
+//   - handoff: un usuario pidió hablar con una persona (comando handoff, o assign_agent con
+//     "handoff": true, ver agents.go); como mucho un aviso por usuario cada
+//     OPS_ALERT_COOLDOWN_SECONDS
+//   - dead_letter: un mensaje o job del tenant quedó en dead-letter (ver ops_alerts.go)
+//   - templates: Meta rechazó, pausó o recategorizó un template (ver webhook_events.go)
+//   - account: calidad del número y alertas de la cuenta de WhatsApp
+//   - bot_loop: una conversación cortada por parecer un loop con otro bot (ver loop_guard.go)
+//   - daily_stats: resumen del día a daily_stats_time (default 20:00, hora de la agenda)
+//
+// dead_letter, templates, account y bot_loop también llegan al canal de operación global
+// (OPS_*); handoff y daily_stats solo a los canales del tenant.
+//
+//	📊 Flowly (broker): resumen del 14/10
+//	Conversaciones: 23
+//	Llegaron al final del flow: 12
+//	Leads asignados: 5 (Ana 3, Luis 2)
+//	Turnos reservados: 4
+//
+// El resumen es un job "daily_stats" por tenant y día (ref = fecha), que encola el mismo
+// scheduler que el resumen de la agenda (ver digest.go).
+
+const (
+	notifyHandoff    = "handoff"
+	notifyDeadLetter = "dead_letter"
+	notifyTemplates  = "templates"
+	notifyAccount    = "account"
+	notifyBotLoop    = "bot_loop"
+	notifyDailyStats = "daily_stats"
+
+	dailyStatsJobKind     = "daily_stats"
+	defaultDailyStatsTime = "20:00"
+)
+
+var notificationEvents = []string{notifyHandoff, notifyDeadLetter, notifyTemplates, notifyAccount, notifyBotLoop, notifyDailyStats}
+
+type FlowNotifications struct {
+	SlackWebhookURL string   `json:"slack_webhook_url,omitempty"` // ${ENV_VAR} se expande
+	TeamsWebhookURL string   `json:"teams_webhook_url,omitempty"` // ${ENV_VAR} se expande
+	Events          []string `json:"events,omitempty"`            // default: todos
+	DailyStatsTime  string   `json:"daily_stats_time,omitempty"`  // HH:MM en la zona de la agenda (default 20:00)
+}
+
+// wants indica si el tenant quiere el evento por sus canales.
+func (n *FlowNotifications) wants(event string) bool {
+	if n == nil || n.SlackWebhookURL == "" && n.TeamsWebhookURL == "" {
+		return false
+	}
+	return len(n.Events) == 0 || containsString(n.Events, event)
+}
+
+// notificationEventFor traduce el kind de un aviso de operación al evento de notifications.
+func notificationEventFor(kind string) string {
+	switch kind {
+	case "bot_loop":
+		return notifyBotLoop
+	case "message_template_status_update", "message_template_quality_update", "template_category_update":
+		return notifyTemplates
+	}
+	return notifyAccount
+}
+
+func validateNotifications(cfg FlowConfig) []string {
+	n := cfg.Notifications
+	if n == nil {
+		return nil
+	}
+	var errs []string
+	if n.SlackWebhookURL == "" && n.TeamsWebhookURL == "" {
+		errs = append(errs, "notifications: falta slack_webhook_url o teams_webhook_url")
+	}
+	for _, u := range []struct{ field, url string }{{"slack_webhook_url", n.SlackWebhookURL}, {"teams_webhook_url", n.TeamsWebhookURL}} {
+		if u.url != "" && !strings.HasPrefix(u.url, "https://") && !strings.HasPrefix(u.url, "${") {
+			errs = append(errs, fmt.Sprintf("notifications.%s tiene que ser https:// o ${ENV_VAR}", u.field))
+		}
+	}
+	for _, ev := range n.Events {
+		if !containsString(notificationEvents, ev) {
+			errs = append(errs, fmt.Sprintf("notifications.events: evento desconocido %q (%s)", ev, strings.Join(notificationEvents, ", ")))
+		}
+	}
+	if n.DailyStatsTime != "" {
+		if _, err := parseClock(n.DailyStatsTime); err != nil {
+			errs = append(errs, "notifications.daily_stats_time: "+err.Error())
+		}
+	}
+	return errs
+}
+
+// notifyHandoffRequest avisa a los canales del tenant que el usuario quiere hablar con una
+// persona.
+func (a *App) notifyHandoffRequest(tenant, waID, state, detail string) {
+	text := fmt.Sprintf("🙋 Flowly (%s): +%s pidió hablar con una persona (estaba en %s)", tenant, waID, state)
+	if detail != "" {
+		text += "\n" + detail
+	}
+	a.alerts.NotifyTenant(tenant, notifyHandoff, waID, text)
+}
+
+// ---------------------
+// Resumen diario
+// ---------------------
+
+// dailyStatsRun es el próximo horario del resumen a partir de now (hoy si todavía no pasó).
+func (n *FlowNotifications) dailyStatsRun(now time.Time) time.Time {
+	s := n.DailyStatsTime
+	if s == "" {
+		s = defaultDailyStatsTime
+	}
+	mins, _ := parseClock(s)
+	now = now.In(calendar.Location())
+	run := time.Date(now.Year(), now.Month(), now.Day(), mins/60, mins%60, 0, 0, now.Location())
+	if !run.After(now) {
+		run = run.AddDate(0, 0, 1)
+	}
+	return run
+}
+
+func (a *App) scheduleDailyStats(tenant string, now time.Time) {
+	cfg, err := a.cache.Load(tenant)
+	if err != nil || !cfg.Notifications.wants(notifyDailyStats) {
+		return
+	}
+	runAt := cfg.Notifications.dailyStatsRun(now)
+	ref := runAt.Format("2006-01-02")
+
+	pending, err := a.jobs.List(dailyStatsJobKind, tenant, "pending", 10)
+	if err != nil {
+		log.Printf("ERROR leyendo resúmenes de estadísticas programados de %s: %v", tenant, err)
+		return
+	}
+	for _, j := range pending {
+		if j.Ref == ref {
+			return
+		}
+	}
+	// Con Postgres, un índice único (tenant, ref) evita que dos réplicas lo encolen dos veces
+	id, err := a.jobs.Enqueue(Job{Kind: dailyStatsJobKind, Tenant: tenant, Ref: ref, RunAt: runAt})
+	if err != nil {
+		log.Printf("❌ No pude programar el resumen de estadísticas de %s: %v", tenant, err)
+		return
+	}
+	if id != 0 {
+		log.Printf("📊 Resumen de estadísticas #%d programado tenant=%s para %s", id, tenant, runAt.Format(time.RFC3339))
+	}
+}
+
+type DailyStats struct {
+	Date          time.Time
+	Conversations int // usuarios que pasaron de estado en el día
+	Completed     int // de esos, los que llegaron a un estado terminal
+	Leads         map[string]int
+	Appointments  int // turnos que reservó el bot en el día
+}
+
+func (a *App) dailyStats(tenant string, cfg FlowConfig, from, to time.Time) (DailyStats, error) {
+	s := DailyStats{Date: from}
+	events, err := a.analytics.Transitions(tenant, from, maxAnalyticsEvents)
+	if err != nil {
+		return s, err
+	}
+	users, completed := make(map[string]bool), make(map[string]bool)
+	for _, ev := range events {
+		if !ev.At.Before(to) {
+			break
+		}
+		users[ev.WaID] = true
+		if isTerminalState(cfg, ev.To) {
+			completed[ev.WaID] = true
+		}
+	}
+	s.Conversations, s.Completed = len(users), len(completed)
+
+	if cfg.Agents != nil {
+		if s.Leads, err = a.leads.AssignmentCounts(tenant, from); err != nil {
+			return s, err
+		}
+	}
+	// Los turnos reservados hoy son para hoy en adelante
+	recs, err := a.appointments.ListAppointments(tenant, from, from.AddDate(1, 0, 0), maxAppointmentStats)
+	if err != nil {
+		return s, err
+	}
+	for _, r := range recs {
+		if !r.CreatedAt.Before(from) && r.CreatedAt.Before(to) {
+			s.Appointments++
+		}
+	}
+	return s, nil
+}
+
+func (s DailyStats) text(tenant string, cfg FlowConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 Flowly (%s): resumen del %s\n", tenant, s.Date.Format("02/01"))
+	fmt.Fprintf(&b, "Conversaciones: %d\n", s.Conversations)
+	fmt.Fprintf(&b, "Llegaron al final del flow: %d", s.Completed)
+	if cfg.Agents != nil {
+		total := 0
+		var parts []string
+		for _, ag := range cfg.Agents.List {
+			if n := s.Leads[ag.ID]; n > 0 {
+				total += n
+				parts = append(parts, ag.displayName()+" "+strconv.Itoa(n))
+			}
+		}
+		fmt.Fprintf(&b, "\nLeads asignados: %d", total)
+		if len(parts) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(parts, ", "))
+		}
+	}
+	if s.Appointments > 0 {
+		fmt.Fprintf(&b, "\nTurnos reservados: %d", s.Appointments)
+	}
+	return b.String()
+}
+
+func jobSendDailyStats(ctx context.Context, a *App, job Job) error {
+	cfg, err := a.cache.Load(job.Tenant)
+	if err != nil {
+		return err
+	}
+	n := cfg.Notifications
+	if !n.wants(notifyDailyStats) {
+		return nil // se sacó de flow.json después de programarlo
+	}
+	from, err := time.ParseInLocation("2006-01-02", job.Ref, calendar.Location())
+	if err != nil {
+		return fmt.Errorf("ref inválido en job: %w", err)
+	}
+	to := time.Now()
+	if end := from.AddDate(0, 0, 1); to.After(end) {
+		to = end // el job corrió tarde (ej: la réplica estuvo caída)
+	}
+	stats, err := a.dailyStats(job.Tenant, cfg, from, to)
+	if err != nil {
+		return err
+	}
+	if os.ExpandEnv(n.SlackWebhookURL) == "" && os.ExpandEnv(n.TeamsWebhookURL) == "" {
+		return fmt.Errorf("notifications de %s sin URLs (¿falta la ENV?)", job.Tenant)
+	}
+	return a.alerts.sendTenant(ctx, job.Tenant, n, stats.text(job.Tenant, cfg))
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// ---------------------
+// Read-receipt nudges
+// ---------------------
+// Si el usuario leyó el mensaje de un estado pero no respondió en N minutos, la sesión
+// pasa sola a otro estado (ej: "¿Seguís ahí?"). El status "read" del webhook programa un
+// job; al correr, si la sesión sigue en el mismo estado y no hubo mensajes nuevos, transiciona.
+//
+//	"SELECT_DATE": {
+//	  ...
+//	  "on_read_no_reply": { "after_minutes": 10, "next": "NUDGE_DATE" }
+//	}
+//
+// Cada "read" reprograma el timer (queda uno por usuario). Solo WhatsApp.
+
+const (
+	readNudgeJobKind    = "read_nudge"
+	maxReadNudgeMinutes = 24 * 60
+)
+
+type FlowReadNudge struct {
+	AfterMinutes int    `json:"after_minutes"`
+	Next         string `json:"next"`
+}
+
+func validateReadNudge(cfg FlowConfig, stateName string, st FlowState) []string {
+	n := st.OnReadNoReply
+	if n == nil {
+		return nil
+	}
+	var errs []string
+	if n.AfterMinutes < 1 || n.AfterMinutes > maxReadNudgeMinutes {
+		errs = append(errs, fmt.Sprintf("state=%s on_read_no_reply.after_minutes fuera de rango (1..%d)", stateName, maxReadNudgeMinutes))
+	}
+	if _, ok := cfg.States[n.Next]; !ok {
+		errs = append(errs, fmt.Sprintf("state=%s on_read_no_reply.next apunta a un estado inexistente: %q", stateName, n.Next))
+	}
+	return errs
+}
+
+// scheduleReadNudge programa el nudge si el estado actual del usuario lo tiene configurado.
+func (a *App) scheduleReadNudge(phoneID, tenant string, st MessageStatus) {
+	sess, ok := a.sessions.Get(tenant + ":" + st.RecipientID)
+	if !ok {
+		return
+	}
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return
+	}
+	nudge := cfg.States[sess.State].OnReadNoReply
+	if nudge == nil {
+		return
+	}
+
+	readAt := time.Now()
+	if sec, err := strconv.ParseInt(st.Timestamp, 10, 64); err == nil {
+		readAt = time.Unix(sec, 0)
+	}
+	if sess.UpdatedAt.After(readAt) {
+		return // es un mensaje viejo, el usuario ya respondió después
+	}
+
+	if _, err := a.jobs.Cancel(readNudgeJobKind, tenant, st.RecipientID); err != nil {
+		log.Printf("ERROR cancelando nudge previo wa_id=%s: %v", st.RecipientID, err)
+	}
+	_, err = a.jobs.Enqueue(Job{
+		Kind:   readNudgeJobKind,
+		Tenant: tenant,
+		WaID:   st.RecipientID,
+		Ref:    st.RecipientID,
+		RunAt:  readAt.Add(time.Duration(nudge.AfterMinutes) * time.Minute),
+		Payload: map[string]string{
+			"phone_id": phoneID,
+			"state":    sess.State,
+			"read_at":  readAt.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR programando nudge wa_id=%s: %v", st.RecipientID, err)
+	}
+}
+
+func jobSendReadNudge(ctx context.Context, a *App, job Job) error {
+	defer a.userLocks.Lock(ctx, job.Tenant, job.WaID)()
+	sessKey := job.Tenant + ":" + job.WaID
+	sess, ok := a.sessions.Get(sessKey)
+	if !ok {
+		return nil
+	}
+	readAt, err := time.Parse(time.RFC3339, job.Payload["read_at"])
+	if err != nil {
+		return fmt.Errorf("read_at inválido en job: %w", err)
+	}
+	// Respondió o se movió a otro estado: no hay nada que hacer
+	if sess.State != job.Payload["state"] || sess.UpdatedAt.After(readAt) {
+		return nil
+	}
+	if out, err := a.skipOptedOut(job.Tenant, job.WaID); err != nil || out {
+		return err
+	}
+
+	cfg, err := a.cache.LoadVersion(job.Tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return err
+	}
+	nudge := cfg.States[sess.State].OnReadNoReply
+	if nudge == nil {
+		return nil
+	}
+
+	phoneID := job.Payload["phone_id"]
+	if phoneID == "" {
+		if phoneID, ok = a.resolver.PhoneNumberID(job.Tenant); !ok {
+			return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", job.Tenant)
+		}
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return err
+	}
+
+	vars := map[string]string{"wa_id": job.WaID}
+	for k, v := range sess.Data {
+		vars[k] = v
+	}
+	next := a.resolveTransientStates(ctx, job.Tenant, cfg, nudge.Next, &sess, vars)
+
+	sess.State = next
+	sess.UpdatedAt = time.Now()
+	a.sessions.Set(sessKey, sess)
+
+	a.scheduleStateTimeout(job.Tenant, job.WaID, waClient, cfg, sess)
+
+	log.Printf("👀 tenant=%s wa_id=%s leyó sin responder, paso a %s", job.Tenant, job.WaID, next)
+	return a.renderer.RenderAndSend(ctx, job.Tenant, next, waClient, job.WaID, vars)
+}
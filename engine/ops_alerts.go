@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Avisos de operación (dead-letter)
+// ---------------------
+// Un envío que falla sin remedio (error permanente o maxJobAttempts agotados) queda en el
+// dead-letter de la outbox (GET /admin/outbound/dead, ver outbox.go) con el payload y el
+// error. Lo mismo para cualquier job que se queda sin reintentos (recordatorios, webhooks
+// al CRM...). Con un canal configurado, además se avisa a Slack, Microsoft Teams y/o Telegram:
+//
+//	🪦 flowly broker: mensaje a 5491122334455 en dead-letter (job #812, intentos: 5)
+//	error de WhatsApp code=131026: Message undeliverable
+//	Reintentar: POST /admin/outbound/812/retry
+//
+// Por el mismo canal llegan los avisos de la cuenta de WhatsApp (templates rechazados,
+// calidad del número, ver webhook_events.go). Cada tenant puede tener además sus propios
+// canales de Slack / Teams, donde le llegan sus avisos y los del negocio (handoff, resumen
+// diario; ver notifications.go).
+//
+// Para no inundar el canal, se manda como mucho un aviso por tenant y tipo de job (o de
+// evento) cada OPS_ALERT_COOLDOWN_SECONDS; el siguiente dice cuántos se callaron en el medio.
+//
+// ENV:
+//
+//	OPS_SLACK_WEBHOOK_URL=https://hooks.slack.com/services/T000/B000/XXXX
+//	OPS_TEAMS_WEBHOOK_URL=https://xxx.webhook.office.com/webhookb2/...
+//	OPS_TELEGRAM_BOT_TOKEN=123456:ABC...
+//	OPS_TELEGRAM_CHAT_ID=-1001234567890
+//	OPS_ALERT_COOLDOWN_SECONDS=300
+
+const (
+	defaultOpsAlertCooldown = 5 * time.Minute
+	opsAlertTimeout         = 10 * time.Second
+	telegramAPIBaseURL      = "https://api.telegram.org"
+	maxOpsAlertWindows      = 10000 // claves de cooldown en memoria (hay una por usuario para los handoff)
+)
+
+type OpsAlerter struct {
+	slackURL      string
+	teamsURL      string
+	telegramToken string
+	telegramChat  string
+	cooldown      time.Duration
+	httpClient    *http.Client
+
+	// Canales del tenant (notifications de flow.json); nil = solo los globales
+	tenantConfig func(tenant string) *FlowNotifications
+
+	mu   sync.Mutex
+	last map[string]*opsAlertWindow // tenant|kind -> último aviso
+}
+
+type opsAlertWindow struct {
+	sentAt     time.Time
+	suppressed int
+}
+
+// NewOpsAlerterFromEnv arma el alerter aunque no haya canales globales (los tenants pueden
+// tener los suyos).
+func NewOpsAlerterFromEnv(httpClient *http.Client) *OpsAlerter {
+	o := &OpsAlerter{
+		slackURL:      strings.TrimSpace(os.Getenv("OPS_SLACK_WEBHOOK_URL")),
+		teamsURL:      strings.TrimSpace(os.Getenv("OPS_TEAMS_WEBHOOK_URL")),
+		telegramToken: strings.TrimSpace(os.Getenv("OPS_TELEGRAM_BOT_TOKEN")),
+		telegramChat:  strings.TrimSpace(os.Getenv("OPS_TELEGRAM_CHAT_ID")),
+		cooldown:      time.Duration(envPositiveInt("OPS_ALERT_COOLDOWN_SECONDS", int(defaultOpsAlertCooldown/time.Second))) * time.Second,
+		httpClient:    httpClient,
+		last:          make(map[string]*opsAlertWindow),
+	}
+	if o.telegramToken == "" || o.telegramChat == "" {
+		o.telegramToken, o.telegramChat = "", ""
+	}
+	return o
+}
+
+// DeadLetter cuenta el job que quedó "failed" y avisa al canal de operación (si hay).
+func (o *OpsAlerter) DeadLetter(job Job, errMsg string) {
+	metrics.Inc("flowly_dead_letters_total", job.Tenant, job.Kind)
+	log.Printf("🪦 dead-letter tenant=%s kind=%s job=%d wa_id=%s: %s", job.Tenant, job.Kind, job.ID, job.WaID, errMsg)
+	if o == nil {
+		return
+	}
+
+	suppressed, ok := o.allow(job.Tenant+"|"+job.Kind, time.Now())
+	if !ok {
+		return
+	}
+	o.dispatch(job.Tenant, notifyDeadLetter, deadLetterText(job, errMsg, suppressed), true)
+}
+
+// Notify manda un aviso de la cuenta (ver webhook_events.go) con el mismo cooldown, al canal
+// de operación y a los del tenant.
+func (o *OpsAlerter) Notify(tenant, kind, text string) {
+	if o == nil {
+		return
+	}
+	suppressed, ok := o.allow(tenant+"|"+kind, time.Now())
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		text += fmt.Sprintf("\n(+%d más desde el último aviso)", suppressed)
+	}
+	o.dispatch(tenant, notificationEventFor(kind), text, true)
+}
+
+// NotifyTenant manda un aviso del negocio (ej: un handoff) solo a los canales del tenant.
+// key es la clave del cooldown (ej: el usuario, para no repetir el aviso si insiste).
+func (o *OpsAlerter) NotifyTenant(tenant, event, key, text string) {
+	if o == nil || !o.tenantNotifications(tenant).wants(event) {
+		return
+	}
+	if _, ok := o.allow(tenant+"|"+event+"|"+key, time.Now()); !ok {
+		return
+	}
+	o.dispatch(tenant, event, text, false)
+}
+
+// dispatch manda el aviso en background (ops = también a los canales globales).
+func (o *OpsAlerter) dispatch(tenant, event, text string, ops bool) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), opsAlertTimeout)
+		defer cancel()
+		if ops {
+			o.send(ctx, text)
+		}
+		if n := o.tenantNotifications(tenant); n.wants(event) {
+			_ = o.sendTenant(ctx, tenant, n, text)
+		}
+	}()
+}
+
+func (o *OpsAlerter) tenantNotifications(tenant string) *FlowNotifications {
+	if o.tenantConfig == nil || tenant == "" {
+		return nil
+	}
+	return o.tenantConfig(tenant)
+}
+
+// allow aplica el cooldown; devuelve cuántos avisos se callaron desde el último.
+func (o *OpsAlerter) allow(key string, now time.Time) (int, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	w, ok := o.last[key]
+	if !ok {
+		if len(o.last) >= maxOpsAlertWindows {
+			for k, old := range o.last {
+				if now.Sub(old.sentAt) >= o.cooldown {
+					delete(o.last, k)
+				}
+			}
+		}
+		o.last[key] = &opsAlertWindow{sentAt: now}
+		return 0, true
+	}
+	if now.Sub(w.sentAt) < o.cooldown {
+		w.suppressed++
+		return 0, false
+	}
+	suppressed := w.suppressed
+	w.sentAt, w.suppressed = now, 0
+	return suppressed, true
+}
+
+func deadLetterText(job Job, errMsg string, suppressed int) string {
+	what := "job " + job.Kind
+	if job.Kind == outboundJobKind {
+		what = "mensaje"
+	}
+	if job.WaID != "" {
+		what += " a " + job.WaID
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "🪦 flowly %s: %s en dead-letter (job #%d, intentos: %d)\n", job.Tenant, what, job.ID, job.Attempts)
+	b.WriteString(truncateRunes(errMsg, 500))
+	if job.Kind == outboundJobKind {
+		fmt.Fprintf(&b, "\nReintentar: POST /admin/outbound/%d/retry", job.ID)
+	}
+	if suppressed > 0 {
+		fmt.Fprintf(&b, "\n(+%d más desde el último aviso)", suppressed)
+	}
+	return b.String()
+}
+
+// send avisa a los canales globales.
+func (o *OpsAlerter) send(ctx context.Context, text string) {
+	if o.slackURL != "" {
+		if err := o.postJSON(ctx, o.slackURL, slackMessage(text)); err != nil {
+			log.Printf("ERROR avisando a Slack: %v", err)
+		}
+	}
+	if o.teamsURL != "" {
+		if err := o.postJSON(ctx, o.teamsURL, teamsMessage(text)); err != nil {
+			log.Printf("ERROR avisando a Teams: %v", err)
+		}
+	}
+	if o.telegramToken != "" {
+		url := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPIBaseURL, o.telegramToken)
+		body := map[string]any{"chat_id": o.telegramChat, "text": text, "disable_web_page_preview": true}
+		if err := o.postJSON(ctx, url, body); err != nil {
+			log.Printf("ERROR avisando a Telegram: %v", strings.ReplaceAll(err.Error(), o.telegramToken, "***"))
+		}
+	}
+}
+
+// sendTenant avisa a los canales del tenant (el primer error, para los jobs que reintentan).
+func (o *OpsAlerter) sendTenant(ctx context.Context, tenant string, n *FlowNotifications, text string) error {
+	var first error
+	if url := os.ExpandEnv(n.SlackWebhookURL); url != "" {
+		if err := o.postJSON(ctx, url, slackMessage(text)); err != nil {
+			log.Printf("ERROR avisando a Slack de %s: %v", tenant, err)
+			first = err
+		}
+	}
+	if url := os.ExpandEnv(n.TeamsWebhookURL); url != "" {
+		if err := o.postJSON(ctx, url, teamsMessage(text)); err != nil {
+			log.Printf("ERROR avisando a Teams de %s: %v", tenant, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func slackMessage(text string) map[string]string {
+	return map[string]string{"text": text}
+}
+
+// teamsMessage es una Adaptive Card con el texto (la aceptan los incoming webhooks de Teams
+// y los de Workflows). Teams junta las líneas sueltas: cada salto va como párrafo.
+func teamsMessage(text string) map[string]any {
+	text = strings.ReplaceAll(text, "\n", "\n\n")
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    []map[string]any{{"type": "TextBlock", "text": text, "wrap": true}},
+			},
+		}},
+	}
+}
+
+func (o *OpsAlerter) postJSON(ctx context.Context, url string, v any) error {
+	b, _ := json.Marshal(v)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClientOrShared(o.httpClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("%s - %s", resp.Status, truncateRunes(string(body), 200))
+	}
+	return nil
+}
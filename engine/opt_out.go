@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Opt-out (lista de bajas)
+// ---------------------
+// Cuando un usuario manda STOP / BAJA (o cualquier keyword de global_commands con destino
+// opt_out) queda en la lista de bajas del tenant. A los que están en la lista no se les manda
+// nada proactivo: campañas, recordatorios ni nudges. Si el usuario vuelve a escribir un
+// comando global (ej: "menu") se lo saca de la lista.
+//
+//	GET    /admin/tenants/{tenant}/opt-outs?limit=100
+//	DELETE /admin/tenants/{tenant}/opt-outs/{wa_id}
+
+const defaultOptOutListLimit = 100
+
+// optOutKeywords valen en todos los tenants (salvo que global_commands las redefina).
+var optOutKeywords = []string{"stop", "baja", "unsubscribe", "darme de baja"}
+
+type OptOutEntry struct {
+	Tenant    string    `json:"tenant"`
+	WaID      string    `json:"wa_id"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OptOutStore interface {
+	AddOptOut(e OptOutEntry) error
+	// RemoveOptOut devuelve false si el usuario no estaba en la lista.
+	RemoveOptOut(tenant, waID string) (bool, error)
+	IsOptedOut(tenant, waID string) (bool, error)
+	ListOptOuts(tenant string, limit int) ([]OptOutEntry, error)
+}
+
+func NewOptOutStore(store *PostgresStore) OptOutStore {
+	if store != nil {
+		return store
+	}
+	return &memoryOptOutStore{entries: make(map[string]OptOutEntry)}
+}
+
+// skipOptedOut indica si un envío proactivo a waID no se tiene que hacer. Si no se puede
+// consultar la lista devuelve el error, para que el job se reintente en vez de mandar igual.
+func (a *App) skipOptedOut(tenant, waID string) (bool, error) {
+	out, err := a.optOuts.IsOptedOut(tenant, waID)
+	if err != nil {
+		return false, err
+	}
+	if out {
+		log.Printf("🚫 tenant=%s wa_id=%s está dado de baja, no se le envía", tenant, waID)
+	}
+	return out, nil
+}
+
+func (a *App) handleAdminListOptOuts(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	entries, err := a.optOuts.ListOptOuts(tenant, queryLimit(r, defaultOptOutListLimit, 1000))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tenant": tenant, "opt_outs": entries})
+}
+
+func (a *App) handleAdminRemoveOptOut(w http.ResponseWriter, r *http.Request) {
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+	ok, err := a.optOuts.RemoveOptOut(tenant, waID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "el usuario no está en la lista de bajas")
+		return
+	}
+
+	// Que el bot le vuelva a responder
+	unlock := a.userLocks.Lock(r.Context(), tenant, waID)
+	key := tenant + ":" + waID
+	if sess, found := a.sessions.Get(key); found && sess.Data[optedOutVar] != "" {
+		delete(sess.Data, optedOutVar)
+		a.sessions.Set(key, sess)
+	}
+	unlock()
+	log.Printf("🛠️ admin: tenant=%s wa_id=%s sacado de la lista de bajas", tenant, waID)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "tenant": tenant, "wa_id": waID})
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryOptOutStore struct {
+	mu      sync.Mutex
+	entries map[string]OptOutEntry // tenant:wa_id -> entrada
+}
+
+func (s *memoryOptOutStore) AddOptOut(e OptOutEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := e.Tenant + ":" + e.WaID
+	if _, ok := s.entries[key]; ok {
+		return nil
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	s.entries[key] = e
+	return nil
+}
+
+func (s *memoryOptOutStore) RemoveOptOut(tenant, waID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := tenant + ":" + waID
+	_, ok := s.entries[key]
+	delete(s.entries, key)
+	return ok, nil
+}
+
+func (s *memoryOptOutStore) IsOptedOut(tenant, waID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.entries[tenant+":"+waID]
+	return ok, nil
+}
+
+func (s *memoryOptOutStore) ListOptOuts(tenant string, limit int) ([]OptOutEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []OptOutEntry
+	for _, e := range s.entries {
+		if e.Tenant == tenant {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) AddOptOut(e OptOutEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO opt_outs (tenant, wa_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant, wa_id) DO NOTHING`,
+		e.Tenant, e.WaID, e.Reason,
+	)
+	return err
+}
+
+func (s *PostgresStore) RemoveOptOut(tenant, waID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM opt_outs WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *PostgresStore) IsOptedOut(tenant, waID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	var exists bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM opt_outs WHERE tenant = $1 AND wa_id = $2)`,
+		tenant, waID,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (s *PostgresStore) ListOptOuts(tenant string, limit int) ([]OptOutEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tenant, wa_id, reason, created_at
+		FROM opt_outs
+		WHERE tenant = $1
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		tenant, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OptOutEntry
+	for rows.Next() {
+		var e OptOutEntry
+		if err := rows.Scan(&e.Tenant, &e.WaID, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
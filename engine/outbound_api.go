@@ -0,0 +1,300 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Envíos proactivos (API para el backoffice del tenant)
+// ---------------------
+// Los sistemas del tenant (pedido despachado, documento listo, turno reprogramado) pueden
+// mandarle un mensaje a un cliente a través de flowly:
+//
+//	POST /admin/tenants/{tenant}/send
+//
+//	{ "to": "+54 9 11 5849-2828", "type": "template",
+//	  "template": { "name": "pedido_enviado", "language": "es_AR", "body_params": ["{{name}}", "{{order_id}}"] },
+//	  "vars": { "name": "Ana", "order_id": "A-1042" } }
+//
+//	{ "to": "5491158492828", "type": "text", "text": "Tu documento {{doc}} ya está listo 📄", "vars": { "doc": "póliza 123" } }
+//
+//	{ "to": "5491158492828", "type": "state", "state": "PEDIDO_ENVIADO", "vars": { "order_id": "A-1042" } }
+//
+// - template: cuando sea (es lo único que Meta acepta fuera de la ventana de 24h). Si ya se
+//   bajó el catálogo de la WABA (ver template_catalog.go) se valida antes de mandar.
+// - text: solo dentro de la ventana de 24h (el usuario escribió hace menos de 24h).
+// - state: renderiza el estado del flow como si el usuario hubiera llegado ahí y mueve su
+//   sesión a ese estado, así la respuesta sigue el flow (on_select_next, on_text_next...).
+//   vars quedan en la sesión. Solo dentro de la ventana, y no con la conversación pausada
+//   (handoff a un agente).
+//
+// vars se suman a las de la sesión y el perfil del contacto ({{wa_id}}, {{contact.name}}...).
+// Respeta la lista de bajas (409 con "reason": "opt_out") y el rate limit de envíos del
+// tenant (429 si WHATSAPP_RATE_LIMIT_MODE=shed). Queda en el audit log como todo POST admin.
+//
+// Con "idempotency_key" (ej: el id del pedido + el evento) el sistema del tenant puede
+// reintentar sin riesgo: si ese envío ya salió responde 200 con "status": "duplicate" y el
+// message_id original, sin mandar ni mover la sesión de nuevo; si está en curso, 409.
+//
+// Desde Go (ej: un job propio) es a.SendProactive(ctx, tenant, ProactiveMessage{...}).
+
+const (
+	proactiveText     = "text"
+	proactiveTemplate = "template"
+	proactiveState    = "state"
+)
+
+var (
+	ErrOptedOut      = errors.New("el contacto está dado de baja")
+	ErrOutsideWindow = errors.New("pasaron más de 24h desde el último mensaje del contacto: solo se puede mandar un template")
+	ErrSessionPaused = errors.New("la conversación está pausada (handoff a un agente)")
+)
+
+type ProactiveMessage struct {
+	To       string               `json:"to"`
+	Type     string               `json:"type"` // text | template | state
+	Text     string               `json:"text,omitempty"`
+	Template *FlowTimeoutTemplate `json:"template,omitempty"`
+	State    string               `json:"state,omitempty"`
+	Vars     map[string]string    `json:"vars,omitempty"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // ver idempotency.go
+}
+
+type ProactiveResult struct {
+	Tenant    string `json:"tenant"`
+	To        string `json:"to"`
+	Type      string `json:"type"`
+	Status    string `json:"status"`               // sent | duplicate
+	MessageID string `json:"message_id,omitempty"` // solo templates (el resto no lo devuelve el Renderer)
+	State     string `json:"state,omitempty"`      // estado de la sesión después del envío
+}
+
+// proactiveRequestError es un pedido mal armado (400).
+type proactiveRequestError struct{ msg string }
+
+func (e proactiveRequestError) Error() string { return e.msg }
+
+func (m ProactiveMessage) validate() error {
+	if strings.TrimSpace(m.To) == "" {
+		return proactiveRequestError{"to es obligatorio"}
+	}
+	switch m.Type {
+	case proactiveText:
+		if strings.TrimSpace(m.Text) == "" {
+			return proactiveRequestError{"type text requiere text"}
+		}
+	case proactiveTemplate:
+		if m.Template == nil || m.Template.Name == "" {
+			return proactiveRequestError{"type template requiere template.name"}
+		}
+	case proactiveState:
+		if m.State == "" {
+			return proactiveRequestError{"type state requiere state"}
+		}
+	default:
+		return proactiveRequestError{fmt.Sprintf("type tiene que ser text, template o state: %q", m.Type)}
+	}
+	return nil
+}
+
+// SendProactive le manda un mensaje a un contacto del tenant fuera de una conversación.
+func (a *App) SendProactive(ctx context.Context, tenant string, m ProactiveMessage) (ProactiveResult, error) {
+	if err := m.validate(); err != nil {
+		return ProactiveResult{}, err
+	}
+	cfg, err := a.cache.Load(tenant)
+	if err != nil {
+		return ProactiveResult{}, err
+	}
+	to, err := cfg.Phone.Normalize(m.To)
+	if err != nil {
+		return ProactiveResult{}, proactiveRequestError{err.Error()}
+	}
+	res := ProactiveResult{Tenant: tenant, To: to, Type: m.Type}
+	if m.IdempotencyKey == "" {
+		return res, a.sendProactive(ctx, &res, m)
+	}
+
+	// El pedido entero se registra con su key (y cada mensaje con la key derivada), así un
+	// reintento no vuelve a correr la action del estado ni a mover la sesión
+	key := "api:" + tenant + ":" + m.IdempotencyKey
+	status, msgID, err := a.outboundKeys.ReserveOutboundKey(key, tenant, to)
+	if err != nil {
+		return res, err
+	}
+	switch status {
+	case outboundKeySent:
+		metrics.Inc("flowly_proactive_sends_total", tenant, m.Type, "duplicate")
+		res.Status, res.MessageID = "duplicate", msgID
+		return res, nil
+	case outboundKeyPending:
+		return res, ErrSendInProgress
+	}
+	ctx = withOutboundKeys(ctx, key)
+	if err := a.sendProactive(ctx, &res, m); err != nil {
+		if rerr := a.outboundKeys.ReleaseOutboundKey(key); rerr != nil {
+			log.Printf("ERROR liberando la key %s: %v", key, rerr)
+		}
+		return res, err
+	}
+	if err := a.outboundKeys.MarkOutboundKeySent(key, res.MessageID); err != nil {
+		log.Printf("ERROR actualizando la key %s: %v", key, err)
+	}
+	return res, nil
+}
+
+// sendProactive hace el envío de SendProactive (ya validado) y completa res.
+func (a *App) sendProactive(ctx context.Context, res *ProactiveResult, m ProactiveMessage) error {
+	tenant, to := res.Tenant, res.To
+	if out, err := a.skipOptedOut(tenant, to); err != nil {
+		return err
+	} else if out {
+		return ErrOptedOut
+	}
+
+	// La sesión se lee (y en type state se escribe) con el lock del usuario, como un mensaje
+	defer a.userLocks.Lock(ctx, tenant, to)()
+	sessKey := tenant + ":" + to
+	sess, _ := a.sessions.Get(sessKey)
+
+	// Sale del número de la sucursal del usuario, si tiene (ver branches.go)
+	phoneID, ok := a.sessionPhoneNumberID(tenant, &sess)
+	if !ok {
+		return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", tenant)
+	}
+	waClient, err := a.tenantWhatsAppClient(phoneID, tenant)
+	if err != nil {
+		return err
+	}
+	vars := map[string]string{"wa_id": to, "name": "ahí"}
+	for k, v := range sess.Data {
+		vars[k] = v
+	}
+	a.loadContactVars(tenant, to, vars)
+	for k, v := range m.Vars {
+		vars[k] = v
+	}
+
+	if m.Type != proactiveTemplate && !inServiceWindow(sess, time.Now()) {
+		return ErrOutsideWindow
+	}
+
+	switch m.Type {
+	case proactiveText:
+		err = waClient.SendText(ctx, to, renderVars(m.Text, vars))
+
+	case proactiveTemplate:
+		if errs := a.checkProactiveTemplate(tenant, *m.Template); len(errs) > 0 {
+			return proactiveRequestError{strings.Join(errs, "; ")}
+		}
+		res.MessageID, err = sendFlowTemplate(ctx, waClient, to, *m.Template, vars)
+
+	case proactiveState:
+		if sessionPaused(sess) {
+			return ErrSessionPaused
+		}
+		res.State, err = a.sendProactiveState(ctx, tenant, waClient, sessKey, sess, m, vars)
+	}
+	if err != nil {
+		metrics.Inc("flowly_proactive_sends_total", tenant, m.Type, "error")
+		return err
+	}
+	metrics.Inc("flowly_proactive_sends_total", tenant, m.Type, "sent")
+	log.Printf("📤 tenant=%s envío proactivo %s a %s", tenant, m.Type, to)
+	res.Status = "sent"
+	return nil
+}
+
+// checkProactiveTemplate valida el template contra el catálogo de la WABA (si ya se bajó).
+func (a *App) checkProactiveTemplate(tenant string, tpl FlowTimeoutTemplate) []string {
+	catalog, ok := templateCatalogs.Get(tenant)
+	if !ok {
+		return nil
+	}
+	return checkFlowTemplates(FlowConfig{WhatsAppErrors: &FlowWhatsAppErrors{WindowTemplate: &tpl}}, catalog)
+}
+
+// sendProactiveState mueve la sesión al estado (con su action, como si el usuario hubiera
+// llegado ahí) y lo manda. Devuelve el estado en el que quedó (después de los http_action).
+func (a *App) sendProactiveState(ctx context.Context, tenant string, waClient *wa.Client, sessKey string, sess UserSession, m ProactiveMessage, vars map[string]string) (string, error) {
+	waID := vars["wa_id"]
+	a.pinFlowVersion(tenant, waID, &sess)
+	vars[flowVersionVar] = sess.Data[flowVersionVar]
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return "", err
+	}
+	if _, ok := cfg.States[m.State]; !ok {
+		return "", proactiveRequestError{"estado inexistente: " + m.State}
+	}
+	for k, v := range m.Vars {
+		sess.Data[k] = v
+	}
+	next := a.resolveTransientStates(ctx, tenant, cfg, m.State, &sess, vars)
+	if st := cfg.States[next]; st.Action != "" {
+		if fn, ok := actionRegistry[st.Action]; ok {
+			newVars, err := fn(ctx, a, tenant, waID, &sess)
+			if err != nil {
+				return "", fmt.Errorf("acción %s: %w", st.Action, err)
+			}
+			for k, v := range newVars {
+				vars[k] = v
+				sess.Data[k] = v
+			}
+		}
+	}
+
+	prevState := sess.State
+	recordHistory(&sess, cfg, prevState, next, false)
+	sess.State = next
+	sess.UpdatedAt = time.Now()
+	a.recordTransition(tenant, cfg, prevState, &sess, waID)
+	a.sessions.Set(sessKey, sess)
+	a.scheduleStateTimeout(tenant, waID, waClient, cfg, sess)
+	return next, a.renderer.RenderAndSend(ctx, tenant, next, waClient, waID, vars)
+}
+
+func (a *App) handleAdminSend(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	var req ProactiveMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	auditNote(r, "type", req.Type)
+	auditNote(r, "to", req.To)
+	if req.IdempotencyKey != "" {
+		auditNote(r, "idempotency_key", req.IdempotencyKey)
+	}
+	if _, err := a.cache.Load(tenant); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	res, err := a.SendProactive(r.Context(), tenant, req)
+	var reqErr proactiveRequestError
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, res)
+	case errors.As(err, &reqErr):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrOptedOut):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error(), "reason": "opt_out", "to": res.To})
+	case errors.Is(err, ErrOutsideWindow), errors.Is(err, ErrSessionPaused), errors.Is(err, ErrSendInProgress):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrRateLimited):
+		writeJSONError(w, http.StatusTooManyRequests, err.Error())
+	default:
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+	}
+}
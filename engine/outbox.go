@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Outbound queue (outbox)
+// ---------------------
+// Cada mensaje saliente de WhatsApp se registra como job "outbound_message" ANTES de
+// mandarlo, con run_at = ahora + outboxLease. Si el envío sale bien el job se completa; si
+// el proceso muere en el medio, el worker lo encuentra vencido y lo reenvía (al menos una
+// vez: ante una caída justo después de que Meta lo aceptó, puede llegar duplicado). El job
+// guarda la idempotency key del mensaje: si ya figura enviada, no se reenvía (ver idempotency.go).
+//
+// Errores temporales (429/5xx/red) se reintentan con el backoff de la cola de jobs; los
+// permanentes, o al agotar maxJobAttempts, quedan "failed" (dead-letter, con aviso a
+// Slack / Telegram si está configurado, ver ops_alerts.go):
+//
+//	GET  /admin/outbound/dead?tenant=broker&limit=50
+//	POST /admin/outbound/{id}/retry
+//
+// Con DATABASE_URL sobrevive reinicios; en memoria solo cubre los reintentos.
+
+const (
+	outboundJobKind = "outbound_message"
+	outboxLease     = 2 * time.Minute // > webhookTimeout: no pisar un envío en curso
+)
+
+// Outbox es la parte de JobQueue que usa sendPipeline para registrar los envíos.
+type Outbox interface {
+	Enqueue(job Job) (int64, error)
+	Complete(id int64) error
+	Fail(id int64, errMsg string, retryAt *time.Time) error
+}
+
+// outboxAdd registra el mensaje antes de enviarlo; devuelve 0 si no hay outbox.
+func (p *sendPipeline) outboxAdd(c *wa.Client, waID string, payload map[string]any, key string) int64 {
+	if p.outbox == nil {
+		return 0
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0
+	}
+	id, err := p.outbox.Enqueue(Job{
+		Kind:   outboundJobKind,
+		Tenant: c.Tenant,
+		WaID:   waID,
+		RunAt:  time.Now().Add(outboxLease),
+		Payload: map[string]string{
+			"phone_id":        c.PhoneID,
+			"message":         string(b),
+			"idempotency_key": key,
+		},
+	})
+	if err != nil {
+		// Sin outbox igual se intenta el envío (mejor que no responder)
+		log.Printf("⚠️ outbox: no pude registrar el mensaje a %s: %v", waID, err)
+		return 0
+	}
+	return id
+}
+
+// outboxDone marca el resultado del envío en línea.
+func (p *sendPipeline) outboxDone(tenant string, id int64, waID string, sendErr error) {
+	if id == 0 {
+		return
+	}
+	var err error
+	switch {
+	case sendErr == nil:
+		err = p.outbox.Complete(id)
+	case wa.IsRetryable(sendErr):
+		retryAt := time.Now().Add(time.Minute)
+		err = p.outbox.Fail(id, sendErr.Error(), &retryAt)
+	default:
+		err = p.outbox.Fail(id, sendErr.Error(), nil)
+		if err == nil {
+			p.alerts.DeadLetter(Job{ID: id, Kind: outboundJobKind, Tenant: tenant, WaID: waID, Attempts: 1}, sendErr.Error())
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR actualizando outbox #%d: %v", id, err)
+	}
+}
+
+// jobSendOutbound reenvía un mensaje que no se confirmó en línea.
+func jobSendOutbound(ctx context.Context, a *App, job Job) error {
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(job.Payload["message"]), &payload); err != nil {
+		return fmt.Errorf("mensaje inválido en outbox: %w", err)
+	}
+	c, err := a.whatsAppClient(job.Payload["phone_id"])
+	if err != nil {
+		return err
+	}
+	ctx = withOutboxJob(ctx) // este job ya es el registro del mensaje
+	if key := job.Payload["idempotency_key"]; key != "" {
+		ctx = withOutboundReplayKey(ctx, key)
+	}
+
+	if _, err := c.Send(ctx, job.WaID, payload); err != nil {
+		return err
+	}
+	log.Printf("📤 outbox: reenviado mensaje #%d a %s (intento %d)", job.ID, job.WaID, job.Attempts)
+	return nil
+}
+
+type outboxJobKey struct{}
+
+// withOutboxJob marca que el envío sale de un job del outbox (no se vuelve a registrar).
+func withOutboxJob(ctx context.Context) context.Context {
+	return context.WithValue(ctx, outboxJobKey{}, true)
+}
+
+func isOutboxJob(ctx context.Context) bool {
+	job, _ := ctx.Value(outboxJobKey{}).(bool)
+	return job
+}
+
+// ---------------------
+// Admin (dead-letter)
+// ---------------------
+
+func (a *App) handleAdminListDeadOutbound(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	jobs, err := a.jobs.List(outboundJobKind, r.URL.Query().Get("tenant"), "failed", limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"count": len(jobs), "messages": jobs})
+}
+
+func (a *App) handleAdminRetryOutbound(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id inválido")
+		return
+	}
+	ok, err := a.jobs.Requeue(id, outboundJobKind)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "no hay un mensaje fallido con ese id")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "pending", "id": id})
+}
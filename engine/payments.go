@@ -0,0 +1,530 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Links de pago (Mercado Pago / Stripe)
+// ---------------------
+// Acción "create_payment_link": arma un link de pago con el monto y la descripción de las
+// variables de la sesión y lo deja en {{payment_url}}, para mandarlo en un estado cta_url:
+//
+//	"PAGAR": {
+//	  "type": "cta_url",
+//	  "action": "create_payment_link",
+//	  "body": "Tu seña es de {{payment_amount|currency:ARS}}. Pagala acá 👇",
+//	  "cta": { "display_text": "Pagar", "url": "{{payment_url}}" },
+//	  "on_action_error": { "error": "PAGO_ERROR" }
+//	}
+//
+// configs/{tenant}/payments.json:
+//
+//	{
+//	  "provider": "mercadopago",
+//	  "currency": "ARS",
+//	  "amount_var": "payment_amount",
+//	  "description_var": "payment_description",
+//	  "description": "Seña de turno",
+//	  "success_url": "https://wa.me/5491100000000",
+//	  "on_paid_next": "PAGO_OK"
+//	}
+//
+// provider: mercadopago | stripe (stripe necesita success_url). amount_var y description_var
+// son las variables de la sesión de donde sale el cobro (esos son los defaults); description
+// se usa si la variable no está.
+//
+// Cuando el proveedor avisa que el pago se acreditó (POST /payments/{provider}/{tenant}),
+// se confirma el estado del pago contra su API, la sesión queda con payment_status=paid y
+// pasa a on_paid_next (se le manda ese estado al usuario, desde el número de la sucursal en la
+// que se creó el link; ver branches.go).
+//
+// ENV:
+//
+//	MERCADOPAGO_ACCESS_TOKEN=APP_USR-...       (o access_token_env en payments.json)
+//	MERCADOPAGO_WEBHOOK_SECRET=...             opcional: valida x-signature
+//	STRIPE_SECRET_KEY=sk_live_...              (o access_token_env en payments.json)
+//	STRIPE_WEBHOOK_SECRET=whsec_...            opcional: valida Stripe-Signature
+//	PUBLIC_BASE_URL=https://flowly.example.com (notification_url de Mercado Pago)
+
+const (
+	paymentProviderMP     = "mercadopago"
+	paymentProviderStripe = "stripe"
+
+	paymentURLVar    = "payment_url"
+	paymentIDVar     = "payment_id"
+	paymentRefVar    = "payment_ref"
+	paymentStatusVar = "payment_status"
+	paymentBranchVar = "_payment_branch" // sucursal en la que se creó el link
+
+	defaultPaymentAmountVar = "payment_amount"
+	defaultPaymentDescVar   = "payment_description"
+	stripeSignatureMaxAge   = 5 * time.Minute
+
+	mercadoPagoAPI = "https://api.mercadopago.com"
+	stripeAPI      = "https://api.stripe.com/v1"
+)
+
+// stripeZeroDecimal: monedas que Stripe cobra sin centavos.
+var stripeZeroDecimal = []string{"bif", "clp", "djf", "gnf", "jpy", "kmf", "krw", "mga", "pyg", "rwf", "ugx", "vnd", "vuv", "xaf", "xof", "xpf"}
+
+type TenantPaymentsConfig struct {
+	Provider       string `json:"provider"`
+	Currency       string `json:"currency"`
+	AmountVar      string `json:"amount_var,omitempty"`
+	DescriptionVar string `json:"description_var,omitempty"`
+	Description    string `json:"description,omitempty"`
+	SuccessURL     string `json:"success_url,omitempty"`
+	OnPaidNext     string `json:"on_paid_next,omitempty"`
+	AccessTokenEnv string `json:"access_token_env,omitempty"`
+}
+
+func loadPaymentsConfig(tenant string) (TenantPaymentsConfig, error) {
+	path := filepath.Join(ConfigRoot, tenant, "payments.json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return TenantPaymentsConfig{}, fmt.Errorf("no pude leer %s: %w", path, err)
+	}
+	var cfg TenantPaymentsConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return TenantPaymentsConfig{}, fmt.Errorf("json inválido en %s: %w", path, err)
+	}
+	switch cfg.Provider {
+	case paymentProviderMP:
+		if cfg.AccessTokenEnv == "" {
+			cfg.AccessTokenEnv = "MERCADOPAGO_ACCESS_TOKEN"
+		}
+	case paymentProviderStripe:
+		if cfg.AccessTokenEnv == "" {
+			cfg.AccessTokenEnv = "STRIPE_SECRET_KEY"
+		}
+		if cfg.SuccessURL == "" {
+			return TenantPaymentsConfig{}, fmt.Errorf("payments.json de %s: stripe necesita success_url", tenant)
+		}
+	default:
+		return TenantPaymentsConfig{}, fmt.Errorf("payments.json de %s: provider inválido %q (mercadopago | stripe)", tenant, cfg.Provider)
+	}
+	if cfg.Currency == "" {
+		return TenantPaymentsConfig{}, fmt.Errorf("payments.json de %s sin currency", tenant)
+	}
+	if cfg.AmountVar == "" {
+		cfg.AmountVar = defaultPaymentAmountVar
+	}
+	if cfg.DescriptionVar == "" {
+		cfg.DescriptionVar = defaultPaymentDescVar
+	}
+	return cfg, nil
+}
+
+func (pc TenantPaymentsConfig) accessToken() (string, error) {
+	token := strings.TrimSpace(os.Getenv(pc.AccessTokenEnv))
+	if token == "" {
+		return "", fmt.Errorf("%s no seteado", pc.AccessTokenEnv)
+	}
+	return token, nil
+}
+
+// paymentLink es lo que devuelve el proveedor al crear el cobro.
+type paymentLink struct {
+	ID  string
+	URL string
+}
+
+func actionCreatePaymentLink(ctx context.Context, a *App, tenant, userID string, sess *UserSession) (map[string]string, error) {
+	pc, err := loadPaymentsConfig(tenant)
+	if err != nil {
+		return nil, err
+	}
+	raw := strings.ReplaceAll(strings.TrimSpace(sess.Data[pc.AmountVar]), ",", ".")
+	amount, err := strconv.ParseFloat(raw, 64)
+	if err != nil || amount <= 0 {
+		return nil, fmt.Errorf("monto inválido en %s: %q", pc.AmountVar, sess.Data[pc.AmountVar])
+	}
+	desc := sess.Data[pc.DescriptionVar]
+	if desc == "" {
+		desc = pc.Description
+	}
+	if desc == "" {
+		desc = "Pago"
+	}
+
+	nonce := make([]byte, 6)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ref := userID + "-" + hex.EncodeToString(nonce) // el wa_id viaja en la referencia
+
+	var link paymentLink
+	switch pc.Provider {
+	case paymentProviderMP:
+		link, err = a.createMercadoPagoPreference(ctx, tenant, pc, amount, desc, ref)
+	case paymentProviderStripe:
+		link, err = a.createStripeCheckout(ctx, tenant, userID, pc, amount, desc, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("💳 tenant=%s wa_id=%s link de pago %s (%s %.2f %s)", tenant, userID, link.ID, pc.Provider, amount, pc.Currency)
+
+	return map[string]string{
+		paymentURLVar:    link.URL,
+		paymentIDVar:     link.ID,
+		paymentRefVar:    ref,
+		paymentStatusVar: "pending",
+		paymentBranchVar: sess.Data[branchVar],
+	}, nil
+}
+
+func (a *App) createMercadoPagoPreference(ctx context.Context, tenant string, pc TenantPaymentsConfig, amount float64, desc, ref string) (paymentLink, error) {
+	token, err := pc.accessToken()
+	if err != nil {
+		return paymentLink{}, err
+	}
+	body := map[string]any{
+		"items": []map[string]any{{
+			"title":       desc,
+			"quantity":    1,
+			"unit_price":  amount,
+			"currency_id": strings.ToUpper(pc.Currency),
+		}},
+		"external_reference": ref,
+	}
+	if base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/"); base != "" {
+		body["notification_url"] = base + "/payments/" + paymentProviderMP + "/" + url.PathEscape(tenant)
+	}
+	if pc.SuccessURL != "" {
+		body["back_urls"] = map[string]string{"success": pc.SuccessURL}
+		body["auto_return"] = "approved"
+	}
+	b, _ := json.Marshal(body)
+
+	var out struct {
+		ID        string `json:"id"`
+		InitPoint string `json:"init_point"`
+	}
+	if err := a.paymentAPI(ctx, "POST", mercadoPagoAPI+"/checkout/preferences", token, "application/json", b, &out); err != nil {
+		return paymentLink{}, err
+	}
+	if out.InitPoint == "" {
+		return paymentLink{}, fmt.Errorf("mercado pago no devolvió init_point")
+	}
+	return paymentLink{ID: out.ID, URL: out.InitPoint}, nil
+}
+
+func (a *App) createStripeCheckout(ctx context.Context, tenant, userID string, pc TenantPaymentsConfig, amount float64, desc, ref string) (paymentLink, error) {
+	token, err := pc.accessToken()
+	if err != nil {
+		return paymentLink{}, err
+	}
+	currency := strings.ToLower(pc.Currency)
+	unit := math.Round(amount * 100)
+	if containsString(stripeZeroDecimal, currency) {
+		unit = math.Round(amount)
+	}
+	form := url.Values{
+		"mode":                                          {"payment"},
+		"success_url":                                   {pc.SuccessURL},
+		"client_reference_id":                           {ref},
+		"metadata[tenant]":                              {tenant},
+		"metadata[wa_id]":                               {userID},
+		"line_items[0][quantity]":                       {"1"},
+		"line_items[0][price_data][currency]":           {currency},
+		"line_items[0][price_data][unit_amount]":        {strconv.FormatInt(int64(unit), 10)},
+		"line_items[0][price_data][product_data][name]": {desc},
+	}
+
+	var out struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := a.paymentAPI(ctx, "POST", stripeAPI+"/checkout/sessions", token, "application/x-www-form-urlencoded", []byte(form.Encode()), &out); err != nil {
+		return paymentLink{}, err
+	}
+	if out.URL == "" {
+		return paymentLink{}, fmt.Errorf("stripe no devolvió url")
+	}
+	return paymentLink{ID: out.ID, URL: out.URL}, nil
+}
+
+// paymentAPI hace un request autenticado con Bearer y decodifica la respuesta en out.
+func (a *App) paymentAPI(ctx context.Context, method, u, token, contentType string, body []byte, out any) error {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := httpClientOrShared(a.httpClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s - %s", method, req.URL.Host+req.URL.Path, resp.Status, truncateRunes(string(respBody), 300))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("respuesta inválida de %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+// ---------------------
+// Webhooks de pago
+// ---------------------
+
+// handlePaymentWebhook: POST /payments/{provider}/{tenant}. El aviso solo dice "algo
+// cambió"; el estado real del pago se consulta siempre a la API del proveedor.
+func (a *App) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	tenant, provider := r.PathValue("tenant"), r.PathValue("provider")
+	body, err := readLimited(r, 1<<20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pc, err := loadPaymentsConfig(tenant)
+	if err != nil || pc.Provider != provider {
+		http.Error(w, "pagos no configurados para el tenant", http.StatusNotFound)
+		return
+	}
+
+	var ref string
+	var paid bool
+	switch provider {
+	case paymentProviderMP:
+		ref, paid, err = a.mercadoPagoNotification(r, body, pc)
+	case paymentProviderStripe:
+		ref, paid, err = a.stripeNotification(r, body, pc)
+	}
+	if err != nil {
+		log.Printf("ERROR webhook de pago tenant=%s provider=%s: %v", tenant, provider, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if paid && ref != "" {
+		if err := a.markPaymentPaid(r.Context(), tenant, pc, ref); err != nil {
+			log.Printf("ERROR acreditando pago tenant=%s ref=%s: %v", tenant, ref, err)
+			http.Error(w, "error procesando el pago", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// mercadoPagoNotification devuelve la external_reference del pago y si está aprobado.
+func (a *App) mercadoPagoNotification(r *http.Request, body []byte, pc TenantPaymentsConfig) (string, bool, error) {
+	var n struct {
+		Type string `json:"type"`
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(body, &n)
+	q := r.URL.Query()
+	if n.Type == "" {
+		n.Type = q.Get("type")
+	}
+	if n.Data.ID == "" {
+		n.Data.ID = q.Get("data.id")
+	}
+	if n.Type != "payment" || n.Data.ID == "" {
+		return "", false, nil // merchant_order, etc.
+	}
+	if secret := strings.TrimSpace(os.Getenv("MERCADOPAGO_WEBHOOK_SECRET")); secret != "" {
+		if !validMercadoPagoSignature(r, n.Data.ID, secret) {
+			return "", false, fmt.Errorf("x-signature inválida")
+		}
+	}
+
+	token, err := pc.accessToken()
+	if err != nil {
+		return "", false, err
+	}
+	var p struct {
+		Status            string `json:"status"`
+		ExternalReference string `json:"external_reference"`
+	}
+	if err := a.paymentAPI(r.Context(), "GET", mercadoPagoAPI+"/v1/payments/"+url.PathEscape(n.Data.ID), token, "", nil, &p); err != nil {
+		return "", false, err
+	}
+	return p.ExternalReference, p.Status == "approved", nil
+}
+
+// validMercadoPagoSignature: x-signature "ts=...,v1=..." = HMAC-SHA256 del manifest
+// "id:{data.id};request-id:{x-request-id};ts:{ts};".
+func validMercadoPagoSignature(r *http.Request, dataID, secret string) bool {
+	parts := signatureParts(r.Header.Get("x-signature"))
+	ts, sigs := parts["ts"], parts["v1"]
+	if len(ts) == 0 || len(sigs) == 0 {
+		return false
+	}
+	manifest := "id:" + strings.ToLower(dataID) + ";request-id:" + r.Header.Get("x-request-id") + ";ts:" + ts[0] + ";"
+	return validHMAC(secret, manifest, sigs)
+}
+
+// stripeNotification devuelve la client_reference_id de la sesión de checkout y si está paga.
+func (a *App) stripeNotification(r *http.Request, body []byte, pc TenantPaymentsConfig) (string, bool, error) {
+	if secret := strings.TrimSpace(os.Getenv("STRIPE_WEBHOOK_SECRET")); secret != "" {
+		if err := validStripeSignature(r.Header.Get("Stripe-Signature"), body, secret, time.Now()); err != nil {
+			return "", false, err
+		}
+	}
+	var ev struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID string `json:"id"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return "", false, fmt.Errorf("evento inválido: %w", err)
+	}
+	if ev.Type != "checkout.session.completed" && ev.Type != "checkout.session.async_payment_succeeded" {
+		return "", false, nil
+	}
+
+	token, err := pc.accessToken()
+	if err != nil {
+		return "", false, err
+	}
+	var s struct {
+		ClientReferenceID string `json:"client_reference_id"`
+		PaymentStatus     string `json:"payment_status"`
+	}
+	if err := a.paymentAPI(r.Context(), "GET", stripeAPI+"/checkout/sessions/"+url.PathEscape(ev.Data.Object.ID), token, "", nil, &s); err != nil {
+		return "", false, err
+	}
+	return s.ClientReferenceID, s.PaymentStatus == "paid", nil
+}
+
+// validStripeSignature: Stripe-Signature "t=...,v1=..." = HMAC-SHA256 de "{t}.{body}".
+func validStripeSignature(header string, body []byte, secret string, now time.Time) error {
+	parts := signatureParts(header)
+	ts, sigs := parts["t"], parts["v1"]
+	if len(ts) == 0 || len(sigs) == 0 {
+		return fmt.Errorf("Stripe-Signature incompleta")
+	}
+	sec, err := strconv.ParseInt(ts[0], 10, 64)
+	if err != nil || now.Sub(time.Unix(sec, 0)).Abs() > stripeSignatureMaxAge {
+		return fmt.Errorf("Stripe-Signature vencida")
+	}
+	if !validHMAC(secret, ts[0]+"."+string(body), sigs) {
+		return fmt.Errorf("Stripe-Signature inválida")
+	}
+	return nil
+}
+
+// signatureParts parsea "k=v,k=v" (una clave puede repetirse).
+func signatureParts(header string) map[string][]string {
+	out := make(map[string][]string)
+	for _, p := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok {
+			out[k] = append(out[k], v)
+		}
+	}
+	return out
+}
+
+func validHMAC(secret, message string, candidates []string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	want := mac.Sum(nil)
+	for _, c := range candidates {
+		got, err := hex.DecodeString(c)
+		if err == nil && hmac.Equal(got, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// markPaymentPaid acredita el pago en la sesión del usuario y la mueve a on_paid_next.
+// Un aviso repetido (o de un link viejo) no hace nada.
+func (a *App) markPaymentPaid(ctx context.Context, tenant string, pc TenantPaymentsConfig, ref string) error {
+	waID, _, ok := strings.Cut(ref, "-")
+	if !ok || waID == "" {
+		return fmt.Errorf("referencia de pago inválida: %q", ref)
+	}
+	defer a.userLocks.Lock(ctx, tenant, waID)()
+	sessKey := tenant + ":" + waID
+	sess, found := a.sessions.Get(sessKey)
+	if !found || sess.Data[paymentRefVar] != ref || sess.Data[paymentStatusVar] == "paid" {
+		return nil
+	}
+	sess.Data[paymentStatusVar] = "paid"
+	log.Printf("💰 tenant=%s wa_id=%s pago acreditado ref=%s", tenant, waID, ref)
+
+	if pc.OnPaidNext == "" {
+		sess.UpdatedAt = time.Now()
+		a.sessions.Set(sessKey, sess)
+		return nil
+	}
+
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.States[pc.OnPaidNext]; !ok {
+		return fmt.Errorf("on_paid_next apunta a un estado inexistente: %q", pc.OnPaidNext)
+	}
+	// El aviso sale del número de la sucursal donde pidió el link, aunque después haya
+	// escrito a otra
+	phoneID, ok := a.sessionPhoneNumberID(tenant, &sess)
+	if branch := sess.Data[paymentBranchVar]; branch != "" {
+		if id, found := a.resolver.BranchPhoneNumberID(tenant, branch); found {
+			phoneID, ok = id, true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", tenant)
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return err
+	}
+
+	vars := map[string]string{"wa_id": waID}
+	for k, v := range sess.Data {
+		vars[k] = v
+	}
+	a.applyBranch(tenant, waClient, &sess, vars) // {{branch.*}} del número que manda
+	next := a.resolveTransientStates(ctx, tenant, cfg, pc.OnPaidNext, &sess, vars)
+
+	prevState := sess.State
+	sess.State = next
+	sess.UpdatedAt = time.Now()
+	a.recordTransition(tenant, cfg, prevState, &sess, waID)
+	a.sessions.Set(sessKey, sess)
+	a.scheduleStateTimeout(tenant, waID, waClient, cfg, sess)
+
+	// El pago ya quedó acreditado: si falla el envío no tiene sentido que el proveedor reintente
+	if err := a.renderer.RenderAndSend(ctx, tenant, next, waClient, waID, vars); err != nil {
+		log.Printf("ERROR render %s tras el pago wa_id=%s: %v", next, waID, err)
+	}
+	return nil
+}
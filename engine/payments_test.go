@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPaymentPaidSendsFromLinkBranch(t *testing.T) {
+	app, fake := newWebhookTestApp(t)
+	t.Setenv("TENANT_BY_PHONE_NUMBER_ID", "111:broker/centro,222:broker/norte")
+	app.resolver = NewTenantResolver()
+	const user = "5491155550020"
+	const ref = user + "-a1b2c3d4e5f6"
+
+	// Pidió el link escribiendo a la sucursal norte (no es el número default del tenant)
+	app.sessions.Set("broker:"+user, UserSession{State: "PAGAR", UpdatedAt: time.Now(), Data: map[string]string{
+		branchVar:        "norte",
+		paymentBranchVar: "norte",
+		paymentRefVar:    ref,
+		paymentStatusVar: "pending",
+	}})
+	if err := app.markPaymentPaid(t.Context(), "broker", TenantPaymentsConfig{OnPaidNext: "CLIENT_MENU"}, ref); err != nil {
+		t.Fatalf("markPaymentPaid: %v", err)
+	}
+
+	out := botMessages(fake, user)
+	if len(out) == 0 {
+		t.Fatal("el bot no avisó el pago")
+	}
+	for _, m := range out {
+		if m.PhoneID != "222" {
+			t.Fatalf("el aviso salió del número %s, se esperaba el de la sucursal norte (222)", m.PhoneID)
+		}
+	}
+	sess := sessionState(t, app, user)
+	if sess.State != "CLIENT_MENU" || sess.Data[paymentStatusVar] != "paid" || sess.Data[branchVar] != "norte" {
+		t.Fatalf("estado %s pago %q sucursal %q", sess.State, sess.Data[paymentStatusVar], sess.Data[branchVar])
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Outbound rate limiting (per tenant)
+// ---------------------
+// Meta limita el throughput de mensajes por número. Un token bucket por tenant
+// evita tormentas de 429 (ej: en broadcasts). Con exceso de envíos:
+//   - mode=queue (default): el envío espera su turno (hasta max_wait)
+//   - mode=shed: el envío se descarta con ErrRateLimited
+//
+// ENV:
+//
+//	WHATSAPP_RATE_LIMIT_MPS=20                      (0 = sin límite)
+//	WHATSAPP_RATE_LIMIT_BURST=40
+//	WHATSAPP_RATE_LIMIT_MODE=queue                  (queue | shed)
+//	WHATSAPP_RATE_LIMIT_MAX_WAIT_MS=30000
+//	WHATSAPP_RATE_LIMIT_BY_TENANT=broker:10,demo_medical:5
+
+var ErrRateLimited = errors.New("rate limit de envíos excedido para el tenant")
+
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens por segundo
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *TokenBucket) refillLocked(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Reserve consume un token y devuelve cuánto hay que esperar para usarlo.
+// Si la espera supera maxWait no consume nada y devuelve ok=false.
+func (b *TokenBucket) Reserve(maxWait time.Duration) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refillLocked(time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+type OutboundLimiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*TokenBucket
+	rate     float64
+	burst    int
+	byTenant map[string]float64
+	shed     bool
+	maxWait  time.Duration
+	disabled bool
+}
+
+func NewOutboundLimiterFromEnv() *OutboundLimiter {
+	l := &OutboundLimiter{
+		buckets:  make(map[string]*TokenBucket),
+		rate:     20,
+		byTenant: map[string]float64{},
+		maxWait:  30 * time.Second,
+	}
+
+	if v := strings.TrimSpace(os.Getenv("WHATSAPP_RATE_LIMIT_MPS")); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			l.rate = f
+		}
+	}
+	l.burst = int(l.rate * 2)
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WHATSAPP_RATE_LIMIT_BURST"))); err == nil && n > 0 {
+		l.burst = n
+	}
+	l.shed = strings.EqualFold(strings.TrimSpace(os.Getenv("WHATSAPP_RATE_LIMIT_MODE")), "shed")
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WHATSAPP_RATE_LIMIT_MAX_WAIT_MS"))); err == nil && n >= 0 {
+		l.maxWait = time.Duration(n) * time.Millisecond
+	}
+
+	for _, p := range strings.Split(os.Getenv("WHATSAPP_RATE_LIMIT_BY_TENANT"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil && f >= 0 {
+			l.byTenant[strings.TrimSpace(kv[0])] = f
+		}
+	}
+
+	l.disabled = l.rate == 0 && len(l.byTenant) == 0
+	return l
+}
+
+func (l *OutboundLimiter) bucket(tenant string) *TokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[tenant]; ok {
+		return b
+	}
+	rate := l.rate
+	burst := l.burst
+	if r, ok := l.byTenant[tenant]; ok {
+		rate = r
+		burst = int(r * 2)
+	}
+	if rate == 0 {
+		l.buckets[tenant] = nil // sin límite para este tenant
+		return nil
+	}
+	b := NewTokenBucket(rate, burst)
+	l.buckets[tenant] = b
+	return b
+}
+
+// Wait (wa.SendLimiter) bloquea hasta que el tenant pueda enviar otro mensaje (o devuelve ErrRateLimited).
+func (l *OutboundLimiter) Wait(ctx context.Context, tenant string) error {
+	if l == nil || l.disabled {
+		return nil
+	}
+	b := l.bucket(tenant)
+	if b == nil {
+		return nil
+	}
+
+	maxWait := l.maxWait
+	if l.shed {
+		maxWait = 0
+	}
+	wait, ok := b.Reserve(maxWait)
+	if !ok {
+		log.Printf("🚦 Rate limit tenant=%s: envío descartado (espera necesaria %s)", tenant, wait)
+		return ErrRateLimited
+	}
+	if wait > 0 {
+		log.Printf("🚦 Rate limit tenant=%s: envío en cola %s", tenant, wait)
+		return sleepCtx(ctx, wait)
+	}
+	return nil
+}
+
+// sleepCtx espera d o hasta que se cancele ctx.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
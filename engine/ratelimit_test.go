@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	type step struct {
+		maxWait  time.Duration
+		ok       bool
+		wait     time.Duration // aproximada: el bucket usa time.Now
+		rewindBy time.Duration // antes del paso: hace como si hubiera pasado ese tiempo
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{"burst sin espera", 1, 3, []step{{ok: true}, {ok: true}, {ok: true}}},
+		{"shed al vaciarse", 1, 2, []step{{ok: true}, {ok: true}, {ok: false, wait: time.Second}}},
+		{"queue dentro de max_wait", 1, 1, []step{
+			{ok: true},
+			{maxWait: 2 * time.Second, ok: true, wait: time.Second},
+			// el token anterior quedó reservado: el próximo es a los 2s
+			{maxWait: 1500 * time.Millisecond, ok: false, wait: 2 * time.Second},
+			{maxWait: 3 * time.Second, ok: true, wait: 2 * time.Second},
+		}},
+		{"burst mínimo 1", 1, 0, []step{{ok: true}, {ok: false, wait: time.Second}}},
+		{"se recarga con el tiempo", 2, 2, []step{
+			{ok: true}, {ok: true}, {ok: false, wait: 500 * time.Millisecond},
+			{rewindBy: 500 * time.Millisecond, ok: true},
+			{ok: false, wait: 500 * time.Millisecond},
+		}},
+		{"no pasa del burst", 10, 2, []step{
+			{rewindBy: time.Hour, ok: true}, {ok: true}, {ok: false, wait: 100 * time.Millisecond},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewTokenBucket(tt.rate, tt.burst)
+			for i, s := range tt.steps {
+				if s.rewindBy > 0 {
+					b.last = b.last.Add(-s.rewindBy)
+				}
+				wait, ok := b.Reserve(s.maxWait)
+				if ok != s.ok || wait < s.wait-50*time.Millisecond || wait > s.wait+50*time.Millisecond {
+					t.Fatalf("paso %d: Reserve(%s) = %s, %v; se esperaba ~%s, %v", i, s.maxWait, wait, ok, s.wait, s.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestOutboundLimiterWait(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	t.Run("shed", func(t *testing.T) {
+		t.Setenv("WHATSAPP_RATE_LIMIT_MPS", "1")
+		t.Setenv("WHATSAPP_RATE_LIMIT_BURST", "2")
+		t.Setenv("WHATSAPP_RATE_LIMIT_MODE", "shed")
+		l := NewOutboundLimiterFromEnv()
+		for i := 0; i < 2; i++ {
+			if err := l.Wait(t.Context(), "broker"); err != nil {
+				t.Fatalf("envío %d: %v", i, err)
+			}
+		}
+		if err := l.Wait(t.Context(), "broker"); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("con el bucket vacío se esperaba ErrRateLimited, llegó %v", err)
+		}
+		// Cada tenant tiene su propio bucket
+		if err := l.Wait(t.Context(), "demo_medical"); err != nil {
+			t.Fatalf("otro tenant: %v", err)
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		t.Setenv("WHATSAPP_RATE_LIMIT_MPS", "20")
+		t.Setenv("WHATSAPP_RATE_LIMIT_BURST", "1")
+		l := NewOutboundLimiterFromEnv()
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if err := l.Wait(t.Context(), "broker"); err != nil {
+				t.Fatalf("envío %d: %v", i, err)
+			}
+		}
+		if d := time.Since(start); d < 90*time.Millisecond {
+			t.Fatalf("3 envíos a 20/s con burst 1 tardaron %s, se esperaba ~100ms", d)
+		}
+	})
+
+	t.Run("queue cancelado", func(t *testing.T) {
+		t.Setenv("WHATSAPP_RATE_LIMIT_MPS", "1")
+		t.Setenv("WHATSAPP_RATE_LIMIT_BURST", "1")
+		l := NewOutboundLimiterFromEnv()
+		if err := l.Wait(t.Context(), "broker"); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		if err := l.Wait(ctx, "broker"); err == nil {
+			t.Fatal("con el contexto vencido la espera tenía que cortar")
+		}
+	})
+
+	t.Run("por tenant", func(t *testing.T) {
+		t.Setenv("WHATSAPP_RATE_LIMIT_MPS", "0")
+		t.Setenv("WHATSAPP_RATE_LIMIT_MODE", "shed")
+		t.Setenv("WHATSAPP_RATE_LIMIT_BY_TENANT", "broker:1,demo_medical:0")
+		l := NewOutboundLimiterFromEnv()
+		for i := 0; i < 2; i++ {
+			if err := l.Wait(t.Context(), "broker"); err != nil {
+				t.Fatalf("envío %d: %v", i, err)
+			}
+		}
+		if err := l.Wait(t.Context(), "broker"); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("broker:1 tiene burst 2, se esperaba ErrRateLimited, llegó %v", err)
+		}
+		for i := 0; i < 50; i++ {
+			if err := l.Wait(t.Context(), "demo_medical"); err != nil {
+				t.Fatalf("demo_medical:0 es sin límite: %v", err)
+			}
+		}
+		if err := l.Wait(t.Context(), "otro"); err != nil {
+			t.Fatalf("sin límite global: %v", err)
+		}
+	})
+
+	t.Run("sin límite", func(t *testing.T) {
+		t.Setenv("WHATSAPP_RATE_LIMIT_MPS", "0")
+		l := NewOutboundLimiterFromEnv()
+		for i := 0; i < 100; i++ {
+			if err := l.Wait(t.Context(), "broker"); err != nil {
+				t.Fatalf("envío %d: %v", i, err)
+			}
+		}
+	})
+}
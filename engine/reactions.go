@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// ---------------------
+// Reacciones y respuestas citadas
+// ---------------------
+// Un estado puede reaccionar al mensaje del usuario que lo disparó y/o mandar su mensaje
+// principal como respuesta a ese mensaje (aparece citado en WhatsApp):
+//
+//	"CONFIRMAR_TURNO": {
+//	  "type": "interactive_buttons",
+//	  "react": "👍",
+//	  "reply_to_user": true,
+//	  "body": "Reservamos el {{appointment_start|format:02/01 15:04}}. ¿Confirmás?",
+//	  ...
+//	}
+//
+// Si el usuario responde citando uno de nuestros mensajes, el id citado queda en la variable
+// reply_to_message_id (solo para ese mensaje). Las reacciones que manda el usuario se
+// registran pero no mueven el flow.
+//
+// Messenger/Instagram no soportan reacciones ni respuestas citadas salientes: se ignoran.
+
+const (
+	inboundMessageVar = "_message_id"         // id del mensaje entrante que se está procesando
+	replyToVar        = "reply_to_message_id" // id del mensaje que el usuario citó
+)
+
+// IncomingContext: el mensaje al que responde el usuario (cuando cita uno).
+type IncomingContext struct {
+	From string `json:"from,omitempty"`
+	ID   string `json:"id"`
+}
+
+type IncomingReaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"` // vacío si sacó la reacción
+}
+
+type replyToKey struct{}
+
+// withReplyTo hace que los mensajes enviados con ese ctx salgan como respuesta a messageID.
+func withReplyTo(ctx context.Context, messageID string) context.Context {
+	if messageID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, replyToKey{}, messageID)
+}
+
+func replyToFrom(ctx context.Context) string {
+	id, _ := ctx.Value(replyToKey{}).(string)
+	return id
+}
+
+// applyReplyContext arma el "context" de WhatsApp si el ctx pide responder a un mensaje.
+func applyReplyContext(ctx context.Context, payload map[string]any) {
+	if id := replyToFrom(ctx); id != "" {
+		payload["context"] = map[string]any{"message_id": id}
+	}
+}
+
+// reactToInbound manda la reacción del estado al mensaje del usuario (si hay uno).
+func reactToInbound(ctx context.Context, client MessageSender, to string, st FlowState, vars map[string]string) {
+	emoji := strings.TrimSpace(renderVars(st.React, vars))
+	msgID := vars[inboundMessageVar]
+	if emoji == "" || msgID == "" {
+		return
+	}
+	if err := client.SendReaction(ctx, to, msgID, emoji); err != nil {
+		log.Printf("⚠️ No se pudo reaccionar %s al mensaje %s: %v", emoji, msgID, err)
+	}
+}
+
+func (c *MetaMessagingClient) SendReaction(ctx context.Context, to, messageID, emoji string) error {
+	log.Printf("ℹ️ %s no soporta reacciones salientes, ignoro %s", c.channel, emoji)
+	return nil
+}
@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+	"flowly/wa"
+)
+
+// ---------------------
+// Appointment reminders
+// ---------------------
+// Después de agendar un turno se programan recordatorios (jobs "appointment_reminder")
+// según calendar.json:
+//
+//	"reminders": {
+//	  "offsets_minutes": [1440, 60],
+//	  "template_name": "recordatorio_turno",
+//	  "template_language": "es_AR",
+//	  "text": "Hola {{name}} 👋 Te recordamos tu turno el {{appointment_time}}. ¿Nos confirmás?"
+//	}
+//
+// Si hay template_name se manda ese template (obligatorio fuera de la ventana de 24h).
+// El template debe tener 2 variables en el body ({{1}}=nombre, {{2}}=fecha/hora) y
+// 2 botones quick reply (Confirmo / Cancelo). Sin template se mandan botones interactivos
+// con "text" (solo llegan si el usuario escribió en las últimas 24h).
+
+const (
+	reminderJobKind       = "appointment_reminder"
+	reminderConfirmPrefix = "REMINDER_CONFIRM:"
+	reminderCancelPrefix  = "REMINDER_CANCEL:"
+
+	defaultReminderText         = "Hola {{name}} 👋\nTe recordamos tu turno el *{{appointment_time}}*.\n\n¿Nos confirmás la asistencia?"
+	defaultReminderConfirmReply = "¡Gracias! Tu turno quedó confirmado ✅"
+	defaultReminderCancelReply  = "Listo, cancelamos tu turno. Si querés sacar otro, escribí *menu* 🙌"
+	reminderUnknownReply        = "No encontramos ese turno 🤔 Si querés revisarlo, escribí *menu*."
+)
+
+type ReminderConfig struct {
+	OffsetsMinutes   []int  `json:"offsets_minutes"`
+	TemplateName     string `json:"template_name,omitempty"`
+	TemplateLanguage string `json:"template_language,omitempty"` // default es_AR
+	Text             string `json:"text,omitempty"`
+	ConfirmReply     string `json:"confirm_reply,omitempty"`
+	CancelReply      string `json:"cancel_reply,omitempty"`
+}
+
+// scheduleAppointmentReminders encola un job por cada offset que todavía esté en el futuro
+// (salen desde phoneID, el número de la sucursal; "" = el del tenant).
+func (a *App) scheduleAppointmentReminders(tenant, waID, phoneID, eventID, name string, start time.Time, cfg *ReminderConfig) {
+	if cfg == nil || len(cfg.OffsetsMinutes) == 0 || eventID == "" {
+		return
+	}
+	now := time.Now()
+	for _, off := range cfg.OffsetsMinutes {
+		if off <= 0 {
+			continue
+		}
+		runAt := start.Add(-time.Duration(off) * time.Minute)
+		if runAt.Before(now) {
+			continue
+		}
+		id, err := a.jobs.Enqueue(Job{
+			Kind:   reminderJobKind,
+			Tenant: tenant,
+			WaID:   waID,
+			Ref:    eventID,
+			RunAt:  runAt,
+			Payload: map[string]string{
+				"event_id":       eventID,
+				"start":          start.Format(time.RFC3339),
+				"name":           name,
+				"offset_minutes": strconv.Itoa(off),
+				"phone_id":       phoneID,
+			},
+		})
+		if err != nil {
+			log.Printf("❌ No pude programar recordatorio (%d min) para %s: %v", off, eventID, err)
+			continue
+		}
+		log.Printf("⏰ Recordatorio #%d programado tenant=%s wa_id=%s para %s", id, tenant, waID, runAt.Format(time.RFC3339))
+	}
+}
+
+func jobSendAppointmentReminder(ctx context.Context, a *App, job Job) error {
+	if out, err := a.skipOptedOut(job.Tenant, job.WaID); err != nil || out {
+		return err
+	}
+	calCfg, err := loadCalendarConfig(job.Tenant)
+	if err != nil {
+		return err
+	}
+	rc := calCfg.Reminders
+	if rc == nil {
+		rc = &ReminderConfig{}
+	}
+
+	phoneID := job.Payload["phone_id"]
+	if phoneID == "" {
+		var ok bool
+		if phoneID, ok = a.resolver.PhoneNumberID(job.Tenant); !ok {
+			return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", job.Tenant)
+		}
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return err
+	}
+
+	start, err := time.Parse(time.RFC3339, job.Payload["start"])
+	if err != nil {
+		return fmt.Errorf("start inválido en job: %w", err)
+	}
+	eventID := job.Payload["event_id"]
+	name := job.Payload["name"]
+	when := start.In(calendar.Location()).Format("02/01 15:04") + " hs"
+
+	if rc.TemplateName != "" {
+		lang := rc.TemplateLanguage
+		if lang == "" {
+			lang = "es_AR"
+		}
+		_, err = waClient.SendTemplate(ctx, job.WaID, rc.TemplateName, lang,
+			[]string{name, when},
+			[]string{reminderConfirmPrefix + eventID, reminderCancelPrefix + eventID},
+		)
+	} else {
+		text := rc.Text
+		if text == "" {
+			text = defaultReminderText
+		}
+		body := renderVars(text, map[string]string{"name": name, "appointment_time": when})
+		err = waClient.SendButtons(ctx, job.WaID, "", "", body, "", []wa.Button{
+			{ID: reminderConfirmPrefix + eventID, Title: "✅ Confirmo"},
+			{ID: reminderCancelPrefix + eventID, Title: "❌ Cancelo"},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	// Para la tasa de confirmación (ver appointments.go)
+	if _, err := a.appointments.MarkReminded(job.Tenant, eventID, time.Now()); err != nil {
+		log.Printf("ERROR registrando el recordatorio de %s: %v", eventID, err)
+	}
+	return nil
+}
+
+// appointmentOwnedBy: el turno está registrado (ver appointments.go) y es de waID.
+func (a *App) appointmentOwnedBy(tenant, eventID, waID string) bool {
+	rec, ok, err := a.appointments.GetAppointment(tenant, eventID)
+	switch {
+	case err != nil:
+		log.Printf("ERROR leyendo el turno %s: %v", eventID, err)
+		return false
+	case !ok:
+		log.Printf("⚠️ tenant=%s wa_id=%s respondió a un recordatorio de un turno que no está registrado: %s", tenant, waID, eventID)
+		return false
+	case rec.WaID != waID:
+		log.Printf("⚠️ tenant=%s wa_id=%s respondió a un recordatorio de un turno de otro usuario: %s", tenant, waID, eventID)
+		return false
+	}
+	return true
+}
+
+// handleReminderReply atiende las respuestas a los botones del recordatorio.
+// Devuelve true si el mensaje era una respuesta a un recordatorio.
+func (a *App) handleReminderReply(ctx context.Context, tenant, waID string, msg IncomingMessage, waClient MessageSender) bool {
+	replyID := ""
+	switch {
+	case msg.Button != nil:
+		replyID = msg.Button.Payload
+	case msg.Interactive != nil && msg.Interactive.ButtonReply != nil:
+		replyID = msg.Interactive.ButtonReply.ID
+	}
+	if !strings.HasPrefix(replyID, reminderConfirmPrefix) && !strings.HasPrefix(replyID, reminderCancelPrefix) {
+		return false
+	}
+
+	rc := &ReminderConfig{}
+	if calCfg, err := loadCalendarConfig(tenant); err == nil && calCfg.Reminders != nil {
+		rc = calCfg.Reminders
+	}
+
+	eventID, confirm := strings.CutPrefix(replyID, reminderConfirmPrefix)
+	if !confirm {
+		eventID = strings.TrimPrefix(replyID, reminderCancelPrefix)
+	}
+	// El event_id viene en el payload del botón: solo vale para un turno de este usuario
+	if !a.appointmentOwnedBy(tenant, eventID, waID) {
+		_ = waClient.SendText(ctx, waID, reminderUnknownReply)
+		return true
+	}
+
+	if confirm {
+		log.Printf("✅ Turno confirmado tenant=%s wa_id=%s event=%s", tenant, waID, eventID)
+		a.recordAppointmentConfirmation(tenant, eventID, confirmationConfirmed)
+		reply := rc.ConfirmReply
+		if reply == "" {
+			reply = defaultReminderConfirmReply
+		}
+		_ = waClient.SendText(ctx, waID, reply)
+		return true
+	}
+
+	log.Printf("🗑️ Cancelando turno tenant=%s wa_id=%s event=%s", tenant, waID, eventID)
+
+	svc, err := a.calendars.Get(tenant)
+	if err == nil {
+		err = svc.CancelAppointment(ctx, eventID)
+	}
+	if err != nil {
+		log.Printf("❌ Error cancelando turno %s: %v", eventID, err)
+		_ = waClient.SendText(ctx, waID, "Perdón, no pudimos cancelar el turno. Probá de nuevo en un rato.")
+		return true
+	}
+	a.recordAppointmentConfirmation(tenant, eventID, confirmationCancelled)
+	if n, err := a.jobs.Cancel(reminderJobKind, tenant, eventID); err != nil {
+		log.Printf("ERROR cancelando recordatorios de %s: %v", eventID, err)
+	} else if n > 0 {
+		log.Printf("⏰ %d recordatorio(s) cancelado(s) para %s", n, eventID)
+	}
+
+	reply := rc.CancelReply
+	if reply == "" {
+		reply = defaultReminderCancelReply
+	}
+	_ = waClient.SendText(ctx, waID, reply)
+	return true
+}
@@ -0,0 +1,381 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flowly/testkit"
+)
+
+// ---------------------
+// flowly replay (carga / replay de webhooks)
+// ---------------------
+// Manda webhooks grabados (un body JSON por línea, o un array JSON) a una instancia
+// corriendo, o directo al handler en el mismo proceso con una Graph API simulada:
+//
+//	flowly replay -url https://bot.example.com/webhook -rate 50 -c 8 payloads.jsonl
+//	flowly replay -tenant broker -repeat 100 -users 500 payloads.jsonl
+//
+// Sin -url corre en modo directo: levanta la App (mismas ENV que el server, sin cargar .env
+// salvo -env) con un FakeWhatsApp (ver flowly/testkit) que acepta todo, así no sale nada
+// a WhatsApp. Lo demás (Calendar, http_action, LLM) sí usa la red si el flow lo usa.
+// Cuenta los envíos por tipo y las líneas "ERROR" que loguea el engine (-v muestra el log).
+//
+// -users N reparte los mensajes entre N números sintéticos (549000000000..) y cada repetición
+// cambia los message IDs, así el dedup no los descarta. Con -app-secret (o META_APP_SECRET en
+// modo directo) los bodies van firmados con X-Hub-Signature-256.
+
+type replayResult struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("url", "", "URL del webhook (default: modo directo, en el mismo proceso)")
+	tenant := fs.String("tenant", "", "modo directo: tenant fijo (como /webhook/{tenant})")
+	rate := fs.Float64("rate", 0, "requests por segundo (0 = sin límite)")
+	workers := fs.Int("c", 1, "requests concurrentes")
+	repeat := fs.Int("repeat", 1, "veces que se manda el archivo completo")
+	users := fs.Int("users", 0, "repartir los mensajes entre N usuarios sintéticos (0 = los del archivo)")
+	secret := fs.String("app-secret", "", "firma los bodies con X-Hub-Signature-256")
+	loadEnv := fs.Bool("env", false, "modo directo: cargar .env (ojo: usa la base de datos configurada)")
+	verbose := fs.Bool("v", false, "modo directo: mostrar el log del engine")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *workers < 1 || *repeat < 1 {
+		fmt.Fprintln(os.Stderr, "uso: flowly replay [-url URL | -tenant T] [-rate N] [-c N] [-repeat N] [-users N] [-app-secret S] <payloads.jsonl>")
+		return 2
+	}
+	bodies, err := readReplayFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(bodies) == 0 {
+		fmt.Fprintln(os.Stderr, "el archivo no tiene payloads")
+		return 1
+	}
+
+	var send func(ctx context.Context, body []byte) replayResult
+	var fake *testkit.FakeWhatsApp
+	var logErrors *errorLineCounter
+	if *target != "" {
+		client := &http.Client{Timeout: webhookTimeout}
+		send = func(ctx context.Context, body []byte) replayResult {
+			return replayHTTP(ctx, client, *target, body, *secret)
+		}
+	} else {
+		if *loadEnv {
+			loadEnvFiles()
+		}
+		if os.Getenv("WHATSAPP_TOKEN") == "" {
+			os.Setenv("WHATSAPP_TOKEN", "replay")
+		}
+		logErrors = &errorLineCounter{}
+		if *verbose {
+			logErrors.out = os.Stderr
+		}
+		log.SetOutput(logErrors)
+		defer log.SetOutput(os.Stderr)
+
+		app, err := NewApp()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fake = testkit.NewFakeWhatsApp()
+		app.waTransport = fake
+		if *secret == "" {
+			*secret = app.apps.appSecret(*tenant)
+		}
+		send = func(ctx context.Context, body []byte) replayResult {
+			return replayDirect(ctx, app, *tenant, body, *secret)
+		}
+	}
+
+	jobs := make(chan []byte)
+	results := make(chan replayResult, *workers)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for body := range jobs {
+				results <- send(ctx, body)
+			}
+		}()
+	}
+
+	start := time.Now()
+	go func() {
+		var tick <-chan time.Time
+		if *rate > 0 {
+			t := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+			defer t.Stop()
+			tick = t.C
+		}
+		seq := 0
+		for r := 0; r < *repeat; r++ {
+			for _, b := range bodies {
+				if tick != nil {
+					<-tick
+				}
+				jobs <- rewriteReplayPayload(b, r, seq, *users)
+				seq++
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var all []replayResult
+	for res := range results {
+		all = append(all, res)
+	}
+	elapsed := time.Since(start)
+
+	failed := printReplayReport(os.Stdout, all, elapsed)
+	if fake != nil {
+		fmt.Fprintf(os.Stdout, "envíos a WhatsApp (fake): %s\n", replaySummary(fake.CountByType()))
+		fmt.Fprintf(os.Stdout, "líneas ERROR en el log:   %d\n", logErrors.count.Load())
+		if logErrors.count.Load() > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// readReplayFile lee un body JSON por línea (las vacías y las que empiezan con # se
+// ignoran) o un array JSON de bodies.
+func readReplayFile(path string) ([][]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		var arr []json.RawMessage
+		if err := json.Unmarshal(trimmed, &arr); err != nil {
+			return nil, fmt.Errorf("%s: array JSON inválido: %w", path, err)
+		}
+		out := make([][]byte, len(arr))
+		for i, m := range arr {
+			out[i] = m
+		}
+		return out, nil
+	}
+
+	var out [][]byte
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 64*1024), 10<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("%s:%d: JSON inválido", path, n)
+		}
+		out = append(out, append([]byte(nil), line...))
+	}
+	return out, sc.Err()
+}
+
+// rewriteReplayPayload cambia los message IDs en cada repetición y, con users > 0, el
+// número del usuario (from / wa_id), para que cada envío sea un mensaje nuevo.
+func rewriteReplayPayload(body []byte, round, seq, users int) []byte {
+	if round == 0 && users <= 0 {
+		return body
+	}
+	var p map[string]any
+	if err := json.Unmarshal(body, &p); err != nil {
+		return body
+	}
+	user := ""
+	if users > 0 {
+		user = strconv.Itoa(549000000000 + seq%users)
+	}
+	entries, _ := p["entry"].([]any)
+	for _, e := range entries {
+		entry, _ := e.(map[string]any)
+		changes, _ := entry["changes"].([]any)
+		for _, c := range changes {
+			change, _ := c.(map[string]any)
+			value, _ := change["value"].(map[string]any)
+			msgs, _ := value["messages"].([]any)
+			for _, m := range msgs {
+				msg, _ := m.(map[string]any)
+				if msg == nil {
+					continue
+				}
+				if id, ok := msg["id"].(string); ok && round > 0 {
+					msg["id"] = fmt.Sprintf("%s.r%d", id, round)
+				}
+				if user != "" {
+					msg["from"] = user
+				}
+			}
+			contacts, _ := value["contacts"].([]any)
+			for _, ct := range contacts {
+				if contact, _ := ct.(map[string]any); contact != nil && user != "" {
+					contact["wa_id"] = user
+				}
+			}
+		}
+	}
+	out, err := json.Marshal(p)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+func signReplayBody(req *http.Request, body []byte, secret string) {
+	if secret == "" {
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	req.Header.Set(hubSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func replayHTTP(ctx context.Context, client *http.Client, url string, body []byte, secret string) replayResult {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return replayResult{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signReplayBody(req, body, secret)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return replayResult{latency: time.Since(start), err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return replayResult{status: resp.StatusCode, latency: time.Since(start)}
+}
+
+func replayDirect(ctx context.Context, a *App, tenant string, body []byte, secret string) replayResult {
+	path := "/webhook"
+	if tenant != "" {
+		path += "/" + tenant
+	}
+	req := httptest.NewRequestWithContext(ctx, "POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	signReplayBody(req, body, secret)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	a.handleMessageFor(rec, req, tenant)
+	return replayResult{status: rec.Code, latency: time.Since(start)}
+}
+
+// printReplayReport imprime el resumen; devuelve true si hubo errores o respuestas no-2xx.
+func printReplayReport(w io.Writer, results []replayResult, elapsed time.Duration) bool {
+	statuses := make(map[int]int)
+	var errs int
+	latencies := make([]time.Duration, 0, len(results))
+	for _, r := range results {
+		if r.err != nil {
+			errs++
+			continue
+		}
+		statuses[r.status]++
+		latencies = append(latencies, r.latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	pct := func(p float64) time.Duration {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+
+	fmt.Fprintf(w, "requests:   %d en %s (%.1f req/s)\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds())
+	var codes []string
+	failed := errs > 0
+	for _, code := range sortedKeysInt(statuses) {
+		codes = append(codes, fmt.Sprintf("%d=%d", code, statuses[code]))
+		if code < 200 || code >= 300 {
+			failed = true
+		}
+	}
+	fmt.Fprintf(w, "status:     %s\n", strings.Join(codes, " "))
+	if errs > 0 {
+		fmt.Fprintf(w, "errores:    %d\n", errs)
+		for _, r := range results {
+			if r.err != nil {
+				fmt.Fprintf(w, "            ej: %v\n", r.err)
+				break
+			}
+		}
+	}
+	fmt.Fprintf(w, "latencia:   p50=%s p95=%s p99=%s max=%s\n", pct(0.50), pct(0.95), pct(0.99), pct(1))
+	return failed
+}
+
+func sortedKeysInt(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// errorLineCounter cuenta las líneas de log con "ERROR" (y las reenvía a out si hay).
+type errorLineCounter struct {
+	out   io.Writer
+	count atomic.Int64
+}
+
+func (c *errorLineCounter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("ERROR")) {
+		c.count.Add(1)
+	}
+	if c.out != nil {
+		return c.out.Write(p)
+	}
+	return len(p), nil
+}
+
+// replaySummary: "12 (interactive=4 text=8)".
+func replaySummary(byType map[string]int) string {
+	if len(byType) == 0 {
+		return "ninguno"
+	}
+	total := 0
+	var parts []string
+	for _, k := range sortedKeys(byType) {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, byType[k]))
+		total += byType[k]
+	}
+	return fmt.Sprintf("%d (%s)", total, strings.Join(parts, " "))
+}
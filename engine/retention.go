@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Retención y borrado de datos de un contacto
+// ---------------------
+// Por tenant, en flow.json, cuánto se guarda:
+//
+//	"retention": { "messages_days": 90, "sessions_days": 30 }
+//
+// runRetentionPurge borra cada RETENTION_PURGE_SECONDS el log de mensajes más viejo que
+// messages_days (también los webhooks archivados, ver webhook_archive.go) y las sesiones sin
+// actividad hace más de sessions_days (si esa persona vuelve a escribir, arranca de cero en
+// el estado de entrada). Sin "retention" no se borra nada.
+//
+// Derecho al olvido: borra todo lo que hay de una persona en el tenant (sesión con las
+// variables capturadas, log de mensajes, perfil de contacto, transiciones de analytics,
+// turnos registrados, respuestas a encuestas, jobs pendientes, idempotency keys de los
+// envíos, webhooks archivados y su lugar en las campañas):
+//
+//	DELETE /admin/tenants/{tenant}/contacts/{wa_id}
+//
+// Quedan la baja (opt_outs, para no volver a escribirle) y el audit log, que registra el
+// borrado.
+//
+// ENV:
+//
+//	RETENTION_PURGE_SECONDS=3600
+
+const (
+	defaultRetentionPurge = time.Hour
+	maxRetentionDays      = 3650
+	retentionPurgeBatch   = 5000 // filas por DELETE, para no bloquear la tabla de mensajes
+)
+
+type FlowRetention struct {
+	MessagesDays int `json:"messages_days,omitempty"`
+	SessionsDays int `json:"sessions_days,omitempty"`
+}
+
+func validateRetention(cfg FlowConfig) []string {
+	r := cfg.Retention
+	if r == nil {
+		return nil
+	}
+	var errs []string
+	check := func(field string, days int) {
+		if days < 0 || days > maxRetentionDays {
+			errs = append(errs, fmt.Sprintf("retention.%s tiene que estar entre 0 (sin límite) y %d: %d", field, maxRetentionDays, days))
+		}
+	}
+	check("messages_days", r.MessagesDays)
+	check("sessions_days", r.SessionsDays)
+	return errs
+}
+
+func (a *App) runRetentionPurge(ctx context.Context) {
+	every := time.Duration(envPositiveInt("RETENTION_PURGE_SECONDS", int(defaultRetentionPurge/time.Second))) * time.Second
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		for _, tenant := range a.resolver.Tenants() {
+			a.purgeExpired(tenant, time.Now())
+		}
+		a.purgeOutboundKeys(time.Now())
+		a.purgeWebhookArchive(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpired aplica la retención del tenant.
+func (a *App) purgeExpired(tenant string, now time.Time) {
+	cfg, err := a.cache.Load(tenant)
+	if err != nil || cfg.Retention == nil {
+		return
+	}
+	var messages, webhooks, sessions int
+	if d := cfg.Retention.MessagesDays; d > 0 {
+		if messages, err = a.store.PurgeMessages(tenant, now.AddDate(0, 0, -d)); err != nil {
+			log.Printf("ERROR purgando mensajes de %s: %v", tenant, err)
+		}
+		if webhooks, err = a.webhookArchive.PurgeArchivedWebhooks(tenant, now.AddDate(0, 0, -d)); err != nil {
+			log.Printf("ERROR purgando webhooks archivados de %s: %v", tenant, err)
+		}
+	}
+	if d := cfg.Retention.SessionsDays; d > 0 {
+		if sessions, err = a.sessions.Purge(tenant, now.AddDate(0, 0, -d)); err != nil {
+			log.Printf("ERROR purgando sesiones de %s: %v", tenant, err)
+		}
+	}
+	if messages+webhooks+sessions > 0 {
+		log.Printf("🧹 tenant=%s retención: %d mensaje(s), %d webhook(s) archivado(s) y %d sesión(es) borrados", tenant, messages, webhooks, sessions)
+	}
+}
+
+// eraseContact borra los datos de waID en todos los stores. Sigue aunque alguno falle (lo
+// que se pudo borrar, se borró) y devuelve cuánto borró de cada uno.
+func (a *App) eraseContact(tenant, waID string) (map[string]int, error) {
+	steps := []struct {
+		name  string
+		erase func() (int, error)
+	}{
+		{"sessions", func() (int, error) { return a.sessions.Delete(tenant + ":" + waID) }},
+		{"messages", func() (int, error) { return a.store.DeleteMessages(tenant, waID) }},
+		{"contacts", func() (int, error) {
+			ok, err := a.contacts.DeleteContact(tenant, waID)
+			if ok {
+				return 1, err
+			}
+			return 0, err
+		}},
+		{"transitions", func() (int, error) { return a.analytics.DeleteTransitions(tenant, waID) }},
+		{"appointments", func() (int, error) { return a.appointments.DeleteAppointments(tenant, waID) }},
+		{"survey_responses", func() (int, error) { return a.surveys.DeleteSurveyResponses(tenant, waID) }},
+		{"jobs", func() (int, error) { return a.jobs.DeleteContactJobs(tenant, waID) }},
+		{"outbound_keys", func() (int, error) { return a.outboundKeys.DeleteContactOutboundKeys(tenant, waID) }},
+		{"campaign_recipients", func() (int, error) { return a.campaigns.DeleteRecipients(tenant, waID) }},
+		{"lead_assignments", func() (int, error) { return a.leads.DeleteAssignments(tenant, waID) }},
+		{"webhook_archive", func() (int, error) { return a.webhookArchive.DeleteArchivedWebhooks(tenant, waID) }},
+	}
+	deleted := make(map[string]int, len(steps))
+	var errs []string
+	for _, s := range steps {
+		n, err := s.erase()
+		if err != nil {
+			errs = append(errs, s.name+": "+err.Error())
+		}
+		deleted[s.name] = n
+	}
+	if len(errs) > 0 {
+		return deleted, fmt.Errorf("borrado incompleto (%s)", strings.Join(errs, "; "))
+	}
+	return deleted, nil
+}
+
+func (a *App) handleAdminDeleteContact(w http.ResponseWriter, r *http.Request) {
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+	// Con el lock, un mensaje que llega en el medio no vuelve a crear la sesión a medias
+	defer a.userLocks.Lock(r.Context(), tenant, waID)()
+	deleted, err := a.eraseContact(tenant, waID)
+	total := 0
+	for _, name := range sortedKeys(deleted) {
+		total += deleted[name]
+		auditNote(r, name, strconv.Itoa(deleted[name]))
+	}
+	if err != nil {
+		log.Printf("❌ admin: borrando datos de tenant=%s wa_id=%s: %v", tenant, waID, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if total == 0 {
+		writeJSONError(w, http.StatusNotFound, "no hay datos de ese contacto")
+		return
+	}
+	log.Printf("🛠️ admin: datos de tenant=%s wa_id=%s borrados (%d registros)", tenant, waID, total)
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "tenant": tenant, "wa_id": waID, "deleted": deleted})
+}
+
+// ---------------------
+// Sesiones y log de mensajes
+// ---------------------
+
+// Delete borra la sesión de memoria y de Postgres; devuelve 1 si existía.
+func (s *SessionStore) Delete(key string) (int, error) {
+	s.mu.Lock()
+	_, ok := s.data[key]
+	delete(s.data, key)
+	s.mu.Unlock()
+	if s.db != nil {
+		return s.db.DeleteSession(key)
+	}
+	if ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Purge borra las sesiones del tenant sin actividad desde before.
+func (s *SessionStore) Purge(tenant string, before time.Time) (int, error) {
+	prefix := tenant + ":"
+	n := 0
+	s.mu.Lock()
+	for key, sess := range s.data {
+		if strings.HasPrefix(key, prefix) && sess.UpdatedAt.Before(before) {
+			delete(s.data, key)
+			n++
+		}
+	}
+	s.mu.Unlock()
+	if s.db != nil {
+		return s.db.PurgeSessions(tenant, before)
+	}
+	return n, nil
+}
+
+func (s *PostgresStore) execCount(query string, args ...any) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (s *PostgresStore) DeleteSession(key string) (int, error) {
+	tenant, waID := splitSessionKey(key)
+	return s.execCount(`DELETE FROM sessions WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
+
+func (s *PostgresStore) PurgeSessions(tenant string, before time.Time) (int, error) {
+	return s.execCount(`DELETE FROM sessions WHERE tenant = $1 AND updated_at < $2`, tenant, before)
+}
+
+func (s *PostgresStore) DeleteMessages(tenant, waID string) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	return s.execCount(`DELETE FROM messages WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
+
+// PurgeMessages borra el log anterior a before, de a retentionPurgeBatch filas.
+func (s *PostgresStore) PurgeMessages(tenant string, before time.Time) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	total := 0
+	for {
+		n, err := s.execCount(`
+			DELETE FROM messages WHERE id IN (
+				SELECT id FROM messages WHERE tenant = $1 AND created_at < $2 LIMIT $3
+			)`, tenant, before, retentionPurgeBatch)
+		total += n
+		if err != nil || n < retentionPurgeBatch {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// ---------------------
+// Payloads de las filas de una lista
+// ---------------------
+// El id de una fila viaja a WhatsApp y vuelve en la respuesta (máximo 200 caracteres), así
+// que no conviene meterle datos. Una fila puede llevar además un payload opaco que no sale
+// del servidor:
+//
+//	"rows": [
+//	  { "id": "SLOT_1", "title": "{{slot_1}}", "show_if": "slot_1", "payload": "{{SLOT_1_ISO}}" },
+//	  { "id": "SKU_1", "title": "Remera azul", "payload": "SKU-REM-AZ-M|talle=M|color=azul" }
+//	]
+//
+// Al mandar la lista se renderiza el payload de cada fila visible (con las variables de ese
+// momento) y se guarda en la sesión junto con el estado; cuando el usuario elige una fila de
+// esa lista, el payload queda en {{last_selected_payload}} (vacío si la fila no tenía).
+
+const (
+	rowPayloadsVar     = "_row_payloads"
+	selectedPayloadVar = "last_selected_payload"
+	maxRowPayloadLen   = 1000
+)
+
+// rowPayloads: los payloads de la última lista que se mandó, por id de fila.
+type rowPayloads struct {
+	State string            `json:"state"`
+	Rows  map[string]string `json:"rows"`
+}
+
+func validateRowPayloads(stateName string, st FlowState) []string {
+	if st.List == nil {
+		return nil
+	}
+	var errs []string
+	for _, s := range st.List.Sections {
+		for _, row := range s.Rows {
+			if len(row.Payload) > maxRowPayloadLen {
+				errs = append(errs, fmt.Sprintf("state=%s fila %s: payload de más de %d caracteres", stateName, row.ID, maxRowPayloadLen))
+			}
+		}
+	}
+	return errs
+}
+
+// saveRowPayloads guarda en la sesión los payloads de la lista que se acaba de mandar.
+func (r *Renderer) saveRowPayloads(tenant, to, state string, rows map[string]string) {
+	if r.sessions == nil || len(rows) == 0 {
+		return
+	}
+	key := tenant + ":" + to
+	sess, ok := r.sessions.Get(key)
+	if !ok {
+		return // sin sesión (ej: un envío de prueba) no hay respuesta que seguir
+	}
+	b, err := json.Marshal(rowPayloads{State: state, Rows: rows})
+	if err != nil {
+		log.Printf("ERROR guardando payloads de las filas de %s: %v", state, err)
+		return
+	}
+	if sess.Data == nil {
+		sess.Data = make(map[string]string)
+	}
+	sess.Data[rowPayloadsVar] = string(b)
+	r.sessions.Set(key, sess)
+}
+
+// selectedRowPayload devuelve el payload de la fila elegida, si es de la última lista que se
+// le mandó en el estado en el que está la sesión.
+func selectedRowPayload(sess UserSession, selectedID string) (string, bool) {
+	raw := sess.Data[rowPayloadsVar]
+	if raw == "" || selectedID == "" {
+		return "", false
+	}
+	var p rowPayloads
+	if err := json.Unmarshal([]byte(raw), &p); err != nil || p.State != sess.State {
+		return "", false
+	}
+	payload, ok := p.Rows[selectedID]
+	return payload, ok
+}
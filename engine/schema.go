@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ---------------------
+// JSON Schema del flow + decoding estricto
+// ---------------------
+// Los flow.json se decodifican con DisallowUnknownFields: un typo como "on_text_nexxt"
+// hace fallar la carga (y el lint) en vez de ignorarse en silencio.
+//
+// El schema se genera de los structs de FlowConfig, así que nunca queda desactualizado:
+//
+//	flowly schema > flow.schema.json
+//	flowly schema -o configs/flow.schema.json
+//
+// Para tener autocompletado en el editor, el flow puede referenciarlo:
+//
+//	{ "$schema": "../flow.schema.json", "version": "1", "states": { ... } }
+
+const flowSchemaID = "https://flowly.dev/schemas/flow.json"
+
+// flowStateTypes son los valores válidos de "type" en un estado.
+var flowStateTypes = []string{
+	"text", "interactive_list", "interactive_buttons", "http_action", "form", "ai_fallback",
+	"cta_url", "product", "product_list", "catalog", "sticker", "contacts", "include", "survey",
+}
+
+// decodeFlowConfig decodifica un flow.json rechazando campos desconocidos.
+func decodeFlowConfig(b []byte) (FlowConfig, error) {
+	var cfg FlowConfig
+	if err := decodeStrict(b, &cfg); err != nil {
+		return FlowConfig{}, err
+	}
+	return cfg, nil
+}
+
+func decodeStrict(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("hay contenido después del objeto principal")
+	}
+	return nil
+}
+
+func runSchema(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	out := fs.String("o", "", "archivo de salida (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	b, err := json.MarshalIndent(flowJSONSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	b = append(b, '\n')
+	if *out == "" {
+		os.Stdout.Write(b)
+		return 0
+	}
+	if err := writeFileAtomic(*out, b); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// flowJSONSchema arma el schema (draft 2020-12) de FlowConfig. Cada struct queda en $defs.
+func flowJSONSchema() map[string]any {
+	g := &schemaGen{defs: make(map[string]any)}
+	root := g.structSchema(reflect.TypeOf(FlowConfig{}))
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = flowSchemaID
+	root["title"] = "Flowly flow.json"
+	root["required"] = []string{"states"}
+	root["$defs"] = g.defs
+
+	// Enum de tipos de estado
+	if st, ok := g.defs["FlowState"].(map[string]any); ok {
+		props := st["properties"].(map[string]any)
+		props["type"] = map[string]any{"type": "string", "enum": flowStateTypes}
+	}
+	return root
+}
+
+type schemaGen struct {
+	defs map[string]any
+}
+
+func (g *schemaGen) schemaFor(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = nil // marca para cortar recursión
+			g.defs[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	g.addFields(t, props)
+	return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+}
+
+// addFields agrega los campos exportados con tag json (los embebidos se aplanan, como en
+// encoding/json).
+func (g *schemaGen) addFields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, props)
+				continue
+			}
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaFor(f.Type)
+	}
+}
@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Secrets (Vault / AWS Secrets Manager)
+// ---------------------
+// Con SECRETS_PROVIDER los tokens no viven en .env ni en la imagen: al arrancar se lee un
+// secret (un objeto JSON ENV -> valor) y cada clave queda como variable de entorno, por
+// encima de lo que haya en .env. Ej. del secret:
+//
+//	{
+//	  "WHATSAPP_TOKEN": "EAAG...",
+//	  "META_APP_SECRET": "abc123",
+//	  "TENANT_WHATSAPP_TOKENS": "broker:EAAG...",
+//	  "GOOGLE_APPLICATION_CREDENTIALS_JSON": { "type": "service_account", ... }
+//	}
+//
+// GOOGLE_APPLICATION_CREDENTIALS_JSON se escribe a un archivo (0600) y
+// GOOGLE_APPLICATION_CREDENTIALS apunta ahí. Cada SECRETS_REFRESH_SECONDS se vuelve a leer:
+// los tokens de WhatsApp, los app secrets y las credenciales de Google se toman en caliente
+// (el calendario se rearma solo al cambiar el archivo); el resto (ej: DATABASE_URL) se
+// actualiza en el entorno pero lo que ya se leyó al arrancar necesita un reinicio.
+// Si el secret no se puede leer al arrancar, el server no levanta.
+//
+// ENV:
+//
+//	SECRETS_PROVIDER=vault                          (o aws)
+//	SECRETS_PATH=secret/data/flowly                 (vault: path KV v1/v2; aws: nombre o ARN del secret)
+//	SECRETS_REFRESH_SECONDS=300                     (0 = solo al arrancar)
+//	VAULT_ADDR=https://vault.internal:8200
+//	VAULT_TOKEN=hvs....  o  VAULT_TOKEN_FILE=/vault/secrets/token (ej: Vault Agent)
+//	VAULT_NAMESPACE=...                             (Vault Enterprise)
+//	AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN / AWS_REGION
+
+const (
+	defaultSecretsRefresh   = 5 * time.Minute
+	secretsTimeout          = 15 * time.Second
+	googleCredentialsJSON   = "GOOGLE_APPLICATION_CREDENTIALS_JSON"
+	googleCredentialsSecret = "flowly-google-credentials.json"
+)
+
+// SecretsProvider lee el secret como ENV -> valor.
+type SecretsProvider interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+type SecretsSyncer struct {
+	source   string // para los logs: vault:secret/data/flowly
+	provider SecretsProvider
+
+	mu     sync.Mutex
+	values map[string]string // último valor aplicado por clave
+}
+
+// NewSecretsSyncerFromEnv devuelve nil si SECRETS_PROVIDER no está seteado.
+func NewSecretsSyncerFromEnv(httpClient *http.Client) (*SecretsSyncer, error) {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("SECRETS_PROVIDER")))
+	if kind == "" {
+		return nil, nil
+	}
+	path := strings.TrimSpace(os.Getenv("SECRETS_PATH"))
+	if path == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=%s necesita SECRETS_PATH", kind)
+	}
+
+	var p SecretsProvider
+	switch kind {
+	case "vault":
+		vp, err := newVaultSecrets(path, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		p = vp
+	case "aws":
+		creds := awsCredentialsFromEnv()
+		if !creds.ok() {
+			return nil, fmt.Errorf("SECRETS_PROVIDER=aws necesita AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY")
+		}
+		p = &awsSecrets{secretID: path, creds: creds, httpClient: httpClient}
+	default:
+		return nil, fmt.Errorf("SECRETS_PROVIDER no soportado: %q (vault o aws)", kind)
+	}
+	return &SecretsSyncer{source: kind + ":" + path, provider: p, values: make(map[string]string)}, nil
+}
+
+// Apply lee el secret y setea las ENV que cambiaron; devuelve sus nombres.
+func (s *SecretsSyncer) Apply(ctx context.Context) ([]string, error) {
+	values, err := s.provider.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changed []string
+	for _, k := range sortedKeys(values) {
+		v := values[k]
+		if prev, ok := s.values[k]; ok && prev == v {
+			continue
+		}
+		if k == googleCredentialsJSON {
+			path := filepath.Join(os.TempDir(), googleCredentialsSecret)
+			if err := writeSecretFile(path, []byte(v)); err != nil {
+				return changed, fmt.Errorf("no pude escribir %s: %w", path, err)
+			}
+			os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+		} else {
+			os.Setenv(k, v)
+		}
+		s.values[k] = v
+		changed = append(changed, k)
+	}
+	return changed, nil
+}
+
+// writeSecretFile escribe el archivo con permisos 0600 (tmp + rename).
+func writeSecretFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runSecretsRefresh vuelve a leer el secret hasta que se cancele el context.
+func (a *App) runSecretsRefresh(ctx context.Context) {
+	if a.secrets == nil {
+		return
+	}
+	if strings.TrimSpace(os.Getenv("SECRETS_REFRESH_SECONDS")) == "0" {
+		return
+	}
+	every := time.Duration(envPositiveInt("SECRETS_REFRESH_SECONDS", int(defaultSecretsRefresh/time.Second))) * time.Second
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sctx, cancel := context.WithTimeout(ctx, secretsTimeout)
+			changed, err := a.secrets.Apply(sctx)
+			cancel()
+			if err != nil {
+				log.Printf("ERROR refrescando secrets de %s: %v", a.secrets.source, err)
+			}
+			if len(changed) > 0 {
+				a.apps.reload()
+				if err := a.apps.checkGraphVersions(); err != nil {
+					log.Printf("ERROR en los secrets rotados: %v", err)
+				}
+				log.Printf("🔑 secrets rotados desde %s: %s", a.secrets.source, strings.Join(changed, ", "))
+				// Solo los nombres: los valores nunca van al audit log
+				a.recordAudit(AuditEntry{Actor: systemAuditActor, Action: "secrets.rotate", Details: map[string]string{"source": a.secrets.source, "keys": strings.Join(changed, ",")}})
+			}
+		}
+	}
+}
+
+// secretValues pasa un objeto JSON a ENV -> valor (los valores que no son string quedan
+// como JSON, ej: las credenciales de Google).
+func secretValues(raw []byte) (map[string]string, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("el secret no es un objeto JSON: %w", err)
+	}
+	out := make(map[string]string, len(obj))
+	for k, v := range obj {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			out[k] = s
+			continue
+		}
+		out[k] = string(v)
+	}
+	return out, nil
+}
+
+// ---------------------
+// HashiCorp Vault (KV v1 / v2)
+// ---------------------
+
+type vaultSecrets struct {
+	addr       string
+	path       string
+	token      string
+	tokenFile  string
+	namespace  string
+	httpClient *http.Client
+}
+
+func newVaultSecrets(path string, httpClient *http.Client) (*vaultSecrets, error) {
+	v := &vaultSecrets{
+		addr:       strings.TrimRight(strings.TrimSpace(os.Getenv("VAULT_ADDR")), "/"),
+		path:       strings.Trim(path, "/"),
+		token:      strings.TrimSpace(os.Getenv("VAULT_TOKEN")),
+		tokenFile:  strings.TrimSpace(os.Getenv("VAULT_TOKEN_FILE")),
+		namespace:  strings.TrimSpace(os.Getenv("VAULT_NAMESPACE")),
+		httpClient: httpClient,
+	}
+	if v.addr == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=vault necesita VAULT_ADDR")
+	}
+	if v.token == "" && v.tokenFile == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=vault necesita VAULT_TOKEN o VAULT_TOKEN_FILE")
+	}
+	return v, nil
+}
+
+func (v *vaultSecrets) Fetch(ctx context.Context) (map[string]string, error) {
+	token := v.token
+	if v.tokenFile != "" {
+		// El agente puede renovar el token en el archivo: se lee en cada fetch
+		b, err := os.ReadFile(v.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", v.addr+"/v1/"+v.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := httpClientOrShared(v.httpClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault %s: %s - %s", v.path, resp.Status, truncateRunes(string(body), 300))
+	}
+
+	var out struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("respuesta inválida de vault: %w", err)
+	}
+	// KV v2 anida los valores en data.data (con data.metadata al lado)
+	var v2 struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(out.Data, &v2); err == nil && len(v2.Data) > 0 && len(v2.Metadata) > 0 {
+		return secretValues(v2.Data)
+	}
+	return secretValues(out.Data)
+}
+
+// ---------------------
+// AWS Secrets Manager (GetSecretValue)
+// ---------------------
+
+type awsSecrets struct {
+	secretID   string
+	creds      awsCredentials
+	httpClient *http.Client
+}
+
+func (s *awsSecrets) Fetch(ctx context.Context) (map[string]string, error) {
+	body, _ := json.Marshal(map[string]string{"SecretId": s.secretID})
+	url := "https://secretsmanager." + s.creds.region + ".amazonaws.com/"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	s.creds.sign(req, "secretsmanager", body, time.Now())
+
+	resp, err := httpClientOrShared(s.httpClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secrets manager %s: %s - %s", s.secretID, resp.Status, truncateRunes(string(respBody), 300))
+	}
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return nil, fmt.Errorf("respuesta inválida de secrets manager: %w", err)
+	}
+	if out.SecretString == "" {
+		return nil, fmt.Errorf("secrets manager %s: el secret no tiene SecretString (¿es binario?)", s.secretID)
+	}
+	return secretValues([]byte(out.SecretString))
+}
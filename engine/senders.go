@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Remitentes permitidos / bloqueados
+// ---------------------
+// Por tenant, en flow.json, qué números pueden hablar con el bot:
+//
+//	"senders": {
+//	  "allow": ["549", "5491122334455"],
+//	  "deny": ["5491199998888"],
+//	  "reject_message": "Este número es de uso interno de la empresa."
+//	}
+//
+// Cada entrada es un prefijo del wa_id (en Messenger / Instagram, del id del usuario): un
+// número completo o un código de país / área. deny gana sobre allow; con allow, los que no
+// matchean ninguna entrada también quedan afuera (bots internos). Al bloqueado no se le
+// crea sesión ni corre el flow; sin reject_message no se le contesta nada, y con él se le
+// manda como mucho una vez por día (así un número abusivo no genera un envío por mensaje).
+
+const (
+	maxSenderRules        = 1000
+	senderRejectEvery     = 24 * time.Hour
+	maxSenderRejectNotice = 50000
+)
+
+type FlowSenders struct {
+	Allow         []string `json:"allow,omitempty"`
+	Deny          []string `json:"deny,omitempty"`
+	RejectMessage string   `json:"reject_message,omitempty"`
+}
+
+func validateSenders(cfg FlowConfig) []string {
+	s := cfg.Senders
+	if s == nil {
+		return nil
+	}
+	var errs []string
+	if len(s.Allow)+len(s.Deny) > maxSenderRules {
+		errs = append(errs, fmt.Sprintf("senders: máximo %d entradas entre allow y deny", maxSenderRules))
+	}
+	check := func(field string, list []string) {
+		for _, p := range list {
+			if d := strings.TrimPrefix(strings.TrimSpace(p), "+"); d == "" || strings.Trim(d, "0123456789") != "" {
+				errs = append(errs, fmt.Sprintf("senders.%s: %q no es un número ni un prefijo (solo dígitos)", field, p))
+			}
+		}
+	}
+	check("allow", s.Allow)
+	check("deny", s.Deny)
+	return errs
+}
+
+// Allowed dice si el remitente puede hablar con el bot.
+func (s *FlowSenders) Allowed(from string) bool {
+	if s == nil {
+		return true
+	}
+	if senderMatches(s.Deny, from) {
+		return false
+	}
+	return len(s.Allow) == 0 || senderMatches(s.Allow, from)
+}
+
+func senderMatches(prefixes []string, from string) bool {
+	from = strings.TrimPrefix(from, "+")
+	for _, p := range prefixes {
+		if p = strings.TrimPrefix(strings.TrimSpace(p), "+"); p != "" && strings.HasPrefix(from, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// SenderRejections recuerda a quién se le mandó reject_message, para avisar una vez por día.
+type SenderRejections struct {
+	mu   sync.Mutex
+	sent map[string]time.Time // tenant:wa_id -> último aviso
+}
+
+func NewSenderRejections() *SenderRejections {
+	return &SenderRejections{sent: make(map[string]time.Time)}
+}
+
+// first devuelve true si a key no se le avisó en el último senderRejectEvery.
+func (r *SenderRejections) first(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.sent[key]; ok && now.Sub(last) < senderRejectEvery {
+		return false
+	}
+	if len(r.sent) >= maxSenderRejectNotice {
+		for k, t := range r.sent {
+			if now.Sub(t) >= senderRejectEvery {
+				delete(r.sent, k)
+			}
+		}
+	}
+	r.sent[key] = now
+	return true
+}
+
+// rejectSender corta los mensajes de remitentes no permitidos. true = bloqueado (el mensaje
+// no sigue).
+func (a *App) rejectSender(ctx context.Context, tenant string, client MessageSender, from string) bool {
+	cfg, err := a.cache.Load(tenant)
+	if err != nil || cfg.Senders.Allowed(from) {
+		return false // sin flow, el error lo reporta el resto del handler
+	}
+	metrics.Inc("flowly_inbound_senders_blocked_total", tenant)
+	log.Printf("⛔ tenant=%s wa_id=%s no está habilitado para escribirle al bot", tenant, from)
+	if cfg.Senders.RejectMessage != "" && a.senderRejections.first(tenant+":"+from, time.Now()) {
+		if err := client.SendText(ctx, from, cfg.Senders.RejectMessage); err != nil {
+			log.Printf("ERROR avisando a %s que no está habilitado: %v", from, err)
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Message sequences
+// ---------------------
+// Un estado puede mandar varios mensajes antes del principal (texto, imagen, y después la
+// lista/botones del estado), con una pausa opcional antes de cada uno:
+//
+//	"WELCOME": {
+//	  "type": "interactive_buttons",
+//	  "delay_ms": 800,
+//	  "messages": [
+//	    { "type": "text",  "body": "¡Hola {{name}}! 👋" },
+//	    { "type": "image", "path": "welcome.jpg", "body": "Nuestra oficina", "delay_ms": 1200 },
+//	    { "type": "document", "media": "folleto" }
+//	  ],
+//	  "body": "¿En qué te ayudo?",
+//	  "buttons": { ... }
+//	}
+//
+// "media" es un nombre de la biblioteca del tenant (ver media_library.go); los documentos
+// solo van por ahí. Un estado "text" sin body manda solo la secuencia.
+// Las pausas bloquean el webhook, por eso tienen tope (maxSequenceDelay por mensaje y
+// maxSequenceTotalDelay por estado).
+
+const (
+	maxSequenceDelay      = 10 * time.Second
+	maxSequenceTotalDelay = 20 * time.Second
+)
+
+type FlowMessage struct {
+	Type    string `json:"type"`            // "text" | "image" | "document"
+	Body    string `json:"body,omitempty"`  // texto, o caption de la imagen / documento
+	URL     string `json:"url,omitempty"`   // imagen remota
+	Path    string `json:"path,omitempty"`  // imagen en configs/{tenant}/assets/
+	Media   string `json:"media,omitempty"` // nombre en media.json
+	DelayMs int    `json:"delay_ms,omitempty"`
+}
+
+func validateSequence(stateName string, st FlowState) []string {
+	var errs []string
+	total := st.DelayMs
+	if st.DelayMs < 0 || time.Duration(st.DelayMs)*time.Millisecond > maxSequenceDelay {
+		errs = append(errs, fmt.Sprintf("state=%s delay_ms fuera de rango (0..%d)", stateName, maxSequenceDelay.Milliseconds()))
+	}
+	for i, m := range st.Messages {
+		switch m.Type {
+		case "text":
+			if strings.TrimSpace(m.Body) == "" {
+				errs = append(errs, fmt.Sprintf("state=%s messages[%d] text sin body", stateName, i))
+			}
+		case "image":
+			if strings.TrimSpace(m.URL) == "" && strings.TrimSpace(m.Path) == "" && strings.TrimSpace(m.Media) == "" {
+				errs = append(errs, fmt.Sprintf("state=%s messages[%d] image requiere url, path o media", stateName, i))
+			}
+		case "document":
+			if strings.TrimSpace(m.Media) == "" {
+				errs = append(errs, fmt.Sprintf("state=%s messages[%d] document requiere media", stateName, i))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("state=%s messages[%d] type no soportado: %q", stateName, i, m.Type))
+		}
+		if m.DelayMs < 0 || time.Duration(m.DelayMs)*time.Millisecond > maxSequenceDelay {
+			errs = append(errs, fmt.Sprintf("state=%s messages[%d] delay_ms fuera de rango (0..%d)", stateName, i, maxSequenceDelay.Milliseconds()))
+		}
+		total += m.DelayMs
+	}
+	if time.Duration(total)*time.Millisecond > maxSequenceTotalDelay {
+		errs = append(errs, fmt.Sprintf("state=%s la suma de delays supera %s", stateName, maxSequenceTotalDelay))
+	}
+	return errs
+}
+
+// sendSequence manda los mensajes previos del estado, en orden y con sus pausas.
+func (r *Renderer) sendSequence(ctx context.Context, tenant string, st FlowState, client MessageSender, to string, vars map[string]string) error {
+	if err := sleepCtx(ctx, time.Duration(st.DelayMs)*time.Millisecond); err != nil {
+		return err
+	}
+	for _, m := range st.Messages {
+		if err := sleepCtx(ctx, time.Duration(m.DelayMs)*time.Millisecond); err != nil {
+			return err
+		}
+		switch m.Type {
+		case "text":
+			if err := client.SendText(ctx, to, renderVars(m.Body, vars)); err != nil {
+				return err
+			}
+		case "image", "document":
+			if m.Media != "" {
+				if err := r.sendMedia(ctx, tenant, client, to, m.Type, m.Media, renderVars(m.Body, vars)); err != nil {
+					return err
+				}
+				continue
+			}
+			u := strings.TrimSpace(m.URL)
+			if u == "" {
+				var err error
+				if u, err = buildPublicAssetURL(tenant, renderVars(m.Path, vars)); err != nil {
+					return err
+				}
+			}
+			if err := client.SendImage(ctx, to, u, renderVars(m.Body, vars)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Catálogo de servicios
+// ---------------------
+// configs/{tenant}/services.json lista lo que se puede reservar, cada uno con su duración,
+// precio y agenda (id de calendars en calendar.json):
+//
+//	{ "services": [
+//	  { "id": "LIMPIEZA", "name": "Limpieza dental", "duration_minutes": 30,
+//	    "price": 15000, "currency": "ARS", "calendar": "PRO_PEREZ", "color": "2" },
+//	  { "id": "CONSULTA", "name": "Consulta", "duration_minutes": 20 }
+//	] }
+//
+// La acción get_services llena service_1..N (nombre), service_N_desc (duración y precio) y
+// SERVICE_N_ID. El flow los muestra con filas SERVICE_N y show_if, como los turnos (con más
+// de 10 filas la lista se pagina sola, ver list_pages.go):
+//
+//	"SERVICE_PICK": {
+//	  "type": "interactive_list", "action": "get_services", "body": "¿Qué turno necesitás?",
+//	  "list": { "button_text": "Servicios", "sections": [{ "title": "Servicios", "rows": [
+//	    { "id": "SERVICE_1", "title": "{{service_1}}", "description": "{{service_1_desc}}", "show_if": "service_1" },
+//	    { "id": "SERVICE_2", "title": "{{service_2}}", "description": "{{service_2_desc}}", "show_if": "service_2" }
+//	  ]}]},
+//	  "on_select_next": { "SERVICE_1": "BOOK_SLOTS", "SERVICE_2": "BOOK_SLOTS" }
+//	}
+//
+// Si la opción recién elegida es un servicio, get_calendar_slots lo deja en la sesión
+// (service_id, service_name, service_price, service_duration_minutes) y busca turnos de su
+// duración en su agenda. schedule_appointment crea el evento con esa duración, el color del
+// servicio (colorId de Google, "1".."11") y, si calendar.json no tiene event_title, el
+// nombre del servicio como título. Con Cal.com / Calendly la duración la define el event
+// type: conviene una agenda (event type) por servicio.
+
+const (
+	maxCatalogServices = 30
+	serviceOptionID    = "SERVICE_%d"
+	serviceIDVar       = "service_id"
+)
+
+type ServiceCatalog struct {
+	Services []Service `json:"services"`
+}
+
+type Service struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Description     string  `json:"description,omitempty"`
+	DurationMinutes int     `json:"duration_minutes,omitempty"` // 0 = slot_duration_minutes de calendar.json
+	Price           float64 `json:"price,omitempty"`
+	Currency        string  `json:"currency,omitempty"` // ej: "ARS"; sin moneda el precio va tal cual
+	Calendar        string  `json:"calendar,omitempty"` // id de calendars en calendar.json ("" = la del flow)
+	Color           string  `json:"color,omitempty"`    // colorId de Google Calendar ("1".."11")
+}
+
+// loadServiceCatalog lee configs/{tenant}/services.json (catálogo vacío si no existe).
+func loadServiceCatalog(tenant string) (ServiceCatalog, error) {
+	b, err := os.ReadFile(filepath.Join(ConfigRoot, tenant, "services.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return ServiceCatalog{}, nil
+	}
+	if err != nil {
+		return ServiceCatalog{}, fmt.Errorf("error leyendo services.json: %w", err)
+	}
+	var c ServiceCatalog
+	if err := decodeStrict(b, &c); err != nil {
+		return ServiceCatalog{}, fmt.Errorf("services.json de %s inválido: %w", tenant, err)
+	}
+	if errs := c.validate(); len(errs) > 0 {
+		return ServiceCatalog{}, fmt.Errorf("services.json de %s:\n- %s", tenant, strings.Join(errs, "\n- "))
+	}
+	return c, nil
+}
+
+func (c ServiceCatalog) validate() []string {
+	var errs []string
+	if len(c.Services) > maxCatalogServices {
+		errs = append(errs, fmt.Sprintf("tiene %d servicios (máximo %d)", len(c.Services), maxCatalogServices))
+	}
+	seen := make(map[string]bool)
+	for i, s := range c.Services {
+		if s.ID == "" || strings.TrimSpace(s.Name) == "" {
+			errs = append(errs, fmt.Sprintf("services[%d]: id y name son obligatorios", i))
+		}
+		if seen[s.ID] {
+			errs = append(errs, fmt.Sprintf("services[%d]: id duplicado %q", i, s.ID))
+		}
+		seen[s.ID] = true
+		if s.DurationMinutes < 0 || s.DurationMinutes > 24*60 {
+			errs = append(errs, fmt.Sprintf("service=%s duration_minutes fuera de rango: %d", s.ID, s.DurationMinutes))
+		}
+		if s.Price < 0 {
+			errs = append(errs, fmt.Sprintf("service=%s price negativo", s.ID))
+		}
+		if _, ok := currencyFormats[strings.ToUpper(s.Currency)]; s.Currency != "" && !ok {
+			errs = append(errs, fmt.Sprintf("service=%s moneda no soportada %q", s.ID, s.Currency))
+		}
+		if n, err := strconv.Atoi(s.Color); s.Color != "" && (err != nil || n < 1 || n > 11) {
+			errs = append(errs, fmt.Sprintf("service=%s color tiene que ser un colorId de Google (1-11): %q", s.ID, s.Color))
+		}
+	}
+	return errs
+}
+
+// Service busca un servicio por id.
+func (c ServiceCatalog) Service(id string) (Service, bool) {
+	for _, s := range c.Services {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+func (s Service) duration() time.Duration {
+	return time.Duration(s.DurationMinutes) * time.Minute
+}
+
+// summary es la descripción de la fila (ej: "30 min · $ 15.000,00").
+func (s Service) summary() string {
+	var parts []string
+	if s.DurationMinutes > 0 {
+		parts = append(parts, fmt.Sprintf("%d min", s.DurationMinutes))
+	}
+	if s.Price > 0 {
+		price := strconv.FormatFloat(s.Price, 'f', -1, 64)
+		if s.Currency != "" {
+			price = filterCurrency(price, s.Currency)
+		}
+		parts = append(parts, price)
+	}
+	if s.Description != "" {
+		parts = append(parts, s.Description)
+	}
+	return truncateRunes(strings.Join(parts, " · "), 72) // límite de WhatsApp para la descripción
+}
+
+// vars son las variables de sesión del servicio elegido.
+func (s Service) vars() map[string]string {
+	return map[string]string{
+		serviceIDVar:               s.ID,
+		"service_name":             s.Name,
+		"service_price":            strconv.FormatFloat(s.Price, 'f', -1, 64),
+		"service_duration_minutes": strconv.Itoa(s.DurationMinutes),
+	}
+}
+
+// sessionService devuelve el servicio de la sesión: el de la opción recién elegida
+// (SERVICE_N, picked=true) o el que ya estaba en service_id.
+func sessionService(tenant string, sess *UserSession) (s Service, picked, ok bool) {
+	catalog, err := loadServiceCatalog(tenant)
+	if err != nil {
+		log.Printf("ERROR %v", err)
+		return Service{}, false, false
+	}
+	if picked := sess.Data["last_selected_id"]; strings.HasPrefix(picked, "SERVICE_") {
+		if s, ok := catalog.Service(sess.Data[picked+"_ID"]); ok {
+			return s, true, true
+		}
+	}
+	s, ok = catalog.Service(sess.Data[serviceIDVar])
+	return s, false, ok
+}
+
+func actionGetServices(ctx context.Context, a *App, tenant, userID string, sess *UserSession) (map[string]string, error) {
+	catalog, err := loadServiceCatalog(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limpiamos las filas de antes (las de show_if vacío no se muestran)
+	vars := make(map[string]string)
+	for i := 1; i <= maxCatalogServices; i++ {
+		vars[fmt.Sprintf("service_%d", i)] = ""
+		vars[fmt.Sprintf("service_%d_desc", i)] = ""
+		vars[fmt.Sprintf(serviceOptionID+"_ID", i)] = ""
+	}
+	for i, s := range catalog.Services {
+		vars[fmt.Sprintf("service_%d", i+1)] = truncateRunes(s.Name, 24)
+		vars[fmt.Sprintf("service_%d_desc", i+1)] = s.summary()
+		vars[fmt.Sprintf(serviceOptionID+"_ID", i+1)] = s.ID
+	}
+	vars["services_count"] = strconv.Itoa(len(catalog.Services))
+	return vars, nil
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Serialización por usuario
+// ---------------------
+// Meta manda cada mensaje en un webhook aparte, así que dos mensajes seguidos del mismo
+// usuario se procesan en paralelo: los dos leen la misma sesión y el último en guardar pisa
+// al otro. Todo lo que lee y escribe una sesión (handleIncoming, timeouts, nudges, pagos,
+// admin) toma antes el lock de tenant:wa_id. Los que esperan entran en orden de llegada;
+// usuarios distintos siguen en paralelo.
+//
+// Con REDIS_URL, además, el que tiene el turno en su réplica toma un lock en Redis (SET NX
+// PX con un token propio), así que dos réplicas tampoco procesan al mismo usuario a la vez.
+// Entre réplicas no hay orden de llegada: el que espera reintenta cada tanto. El lock vence
+// solo a los SESSION_LOCK_TTL_SECONDS, por si la réplica que lo tenía se cae. Si Redis no
+// responde se sigue con el lock local.
+//
+// ENV:
+//
+//	SESSION_LOCK_TTL_SECONDS=90
+
+const (
+	defaultSessionLockTTL = webhookTimeout + 30*time.Second
+	sessionLockMaxRetry   = 200 * time.Millisecond
+)
+
+// Solo borra el lock si sigue siendo nuestro (si venció, ya puede ser de otra réplica)
+const redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+type SessionLocks struct {
+	mu     sync.Mutex
+	queues map[string][]chan struct{} // key -> el primero tiene el lock, el resto espera en orden
+
+	redis *redisClient // nil = solo en esta réplica
+	ttl   time.Duration
+}
+
+func NewSessionLocks(rc *redisClient) *SessionLocks {
+	ttl := time.Duration(envPositiveInt("SESSION_LOCK_TTL_SECONDS", int(defaultSessionLockTTL/time.Second))) * time.Second
+	return &SessionLocks{queues: make(map[string][]chan struct{}), redis: rc, ttl: ttl}
+}
+
+// Lock espera el turno de tenant:wa_id y devuelve la función para liberarlo. Si ctx vence
+// antes, sigue sin lock (mejor responder que perder el mensaje) y devuelve un no-op.
+func (l *SessionLocks) Lock(ctx context.Context, tenant, waID string) (unlock func()) {
+	key := tenant + ":" + waID
+	ch := make(chan struct{})
+
+	l.mu.Lock()
+	q := l.queues[key]
+	l.queues[key] = append(q, ch)
+	if len(q) == 0 {
+		close(ch)
+	}
+	l.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		if !l.abandon(key, ch) {
+			// Justo nos tocó el turno: se libera para el siguiente
+			l.release(key)
+		}
+		log.Printf("⚠️ tenant=%s wa_id=%s no pude tomar el lock de la sesión (%v), sigo sin lock", tenant, waID, ctx.Err())
+		return func() {}
+	}
+	token, ok := l.lockShared(ctx, key)
+	if !ok {
+		l.release(key)
+		log.Printf("⚠️ tenant=%s wa_id=%s otra réplica tiene el lock de la sesión (%v), sigo sin lock", tenant, waID, ctx.Err())
+		return func() {}
+	}
+	metrics.Observe("flowly_session_lock_wait_seconds", time.Since(start).Seconds(), tenant)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.unlockShared(key, token)
+			l.release(key)
+		})
+	}
+}
+
+// lockShared toma el lock de Redis. token "" = sin lock compartido (no hay Redis o no
+// respondió); ok=false si ctx venció esperando a otra réplica.
+func (l *SessionLocks) lockShared(ctx context.Context, key string) (token string, ok bool) {
+	if l.redis == nil {
+		return "", true
+	}
+	token = randomHex(16)
+	wait := 10 * time.Millisecond
+	for {
+		reply, err := l.redis.do("SET", "flowly:lock:"+key, token, "NX", "PX", strconv.FormatInt(l.ttl.Milliseconds(), 10))
+		if err != nil {
+			log.Printf("⚠️ lock de sesión en Redis falló (sigo con el local): %v", err)
+			return "", true
+		}
+		if reply != nil {
+			return token, true
+		}
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, sessionLockMaxRetry)
+	}
+}
+
+func (l *SessionLocks) unlockShared(key, token string) {
+	if token == "" {
+		return
+	}
+	if _, err := l.redis.do("EVAL", redisUnlockScript, "1", "flowly:lock:"+key, token); err != nil {
+		log.Printf("⚠️ no pude liberar el lock de %s en Redis (vence solo): %v", key, err)
+	}
+}
+
+// release le pasa el turno al siguiente de la cola.
+func (l *SessionLocks) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q := l.queues[key]
+	if len(q) <= 1 {
+		delete(l.queues, key)
+		return
+	}
+	q = q[1:]
+	l.queues[key] = q
+	close(q[0])
+}
+
+// abandon saca ch de la cola si todavía está esperando; false si ya tenía el turno.
+func (l *SessionLocks) abandon(key string, ch chan struct{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q := l.queues[key]
+	for i, c := range q {
+		if c != ch {
+			continue
+		}
+		if i == 0 {
+			return false
+		}
+		l.queues[key] = append(q[:i:i], q[i+1:]...)
+		return true
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
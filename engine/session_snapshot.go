@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Snapshot de una sesión (para reproducir bugs)
+// ---------------------
+// Para reproducir en staging el "me pasó esto en la mitad de la reserva": se exporta la sesión
+// completa del usuario (estado, historia para volver y variables) y se importa en otra
+// instancia, en el número que se quiera (ej: el del que está probando):
+//
+//	GET  /admin/tenants/{tenant}/sessions/{wa_id}/snapshot
+//	POST /admin/tenants/{tenant}/sessions/{wa_id}/snapshot   (body: el snapshot exportado)
+//
+//	{
+//	  "format": 1,
+//	  "tenant": "demo_medical",
+//	  "wa_id": "5491122334455",
+//	  "exported_at": "2026-03-02T14:05:00Z",
+//	  "state": "SELECT_DATE",
+//	  "flow_version": "v3",
+//	  "history": ["MENU", "ASK_NAME"],
+//	  "data": { "name": "Ana", "slot_1": "Lunes 10:00", "_flow_version": "v3", "...": "..." },
+//	  "updated_at": "2026-03-02T13:58:12Z"
+//	}
+//
+// Al importar, el tenant y el wa_id son los de la ruta (no los del snapshot); el estado tiene
+// que existir en el flow de destino. Si la versión del flow no está, la sesión pasa a la
+// publicada; lo que no coincide vuelve en "warnings". No se importan los jobs pendientes
+// (timeouts, recordatorios) ni el log de mensajes.
+//
+// El export respeta el "privacy" del flow (ver logging.go): con omit_message_bodies las
+// variables del flow salen como "***" (las internas "_..." no, hacen falta para reproducir) y
+// con omit_contact_names también name.
+//
+// Como pisa la sesión entera, con APP_ENV=prod el import está deshabilitado salvo
+// SESSION_SNAPSHOT_IMPORT=true.
+//
+// ENV:
+//
+//	SESSION_SNAPSHOT_IMPORT=true
+
+const sessionSnapshotFormat = 1
+
+type SessionSnapshot struct {
+	Format      int               `json:"format"`
+	Tenant      string            `json:"tenant"`
+	WaID        string            `json:"wa_id"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	State       string            `json:"state"`
+	FlowVersion string            `json:"flow_version,omitempty"`
+	History     []string          `json:"history,omitempty"`
+	Data        map[string]string `json:"data"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+func isProdEnv() bool {
+	return strings.TrimSpace(os.Getenv("APP_ENV")) == "prod"
+}
+
+func sessionImportEnabled() bool {
+	if !isProdEnv() {
+		return true
+	}
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("SESSION_SNAPSHOT_IMPORT")))
+	return v == "true" || v == "1"
+}
+
+func (a *App) handleAdminExportSession(w http.ResponseWriter, r *http.Request) {
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+	// Get devuelve una copia de Data: se puede enmascarar sin tocar la sesión
+	sess, ok := a.sessions.Get(tenant + ":" + waID)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "sesión no encontrada")
+		return
+	}
+	if cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar]); err == nil {
+		cfg.Privacy.minimizeSessionData(sess.Data)
+	}
+	if sess.Data == nil {
+		sess.Data = map[string]string{}
+	}
+	writeJSON(w, http.StatusOK, SessionSnapshot{
+		Format:      sessionSnapshotFormat,
+		Tenant:      tenant,
+		WaID:        waID,
+		ExportedAt:  time.Now().UTC(),
+		State:       sess.State,
+		FlowVersion: sess.Data[flowVersionVar],
+		History:     sessionHistory(&sess),
+		Data:        sess.Data,
+		UpdatedAt:   sess.UpdatedAt,
+	})
+}
+
+func (a *App) handleAdminImportSession(w http.ResponseWriter, r *http.Request) {
+	if !sessionImportEnabled() {
+		writeJSONError(w, http.StatusForbidden, "import de sesiones deshabilitado con APP_ENV=prod (SESSION_SNAPSHOT_IMPORT=true para habilitarlo)")
+		return
+	}
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+
+	var snap SessionSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snap); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "json inválido: "+err.Error())
+		return
+	}
+	if snap.Format != sessionSnapshotFormat {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("format %d no soportado (se espera %d)", snap.Format, sessionSnapshotFormat))
+		return
+	}
+	if snap.State == "" {
+		writeJSONError(w, http.StatusBadRequest, "state es obligatorio")
+		return
+	}
+
+	warnings := []string{}
+	if snap.Tenant != "" && snap.Tenant != tenant {
+		warnings = append(warnings, fmt.Sprintf("el snapshot es del tenant %s", snap.Tenant))
+	}
+	sess := UserSession{State: snap.State, UpdatedAt: time.Now(), Data: make(map[string]string, len(snap.Data))}
+	for k, v := range snap.Data {
+		sess.Data[k] = v
+	}
+	if snap.FlowVersion != "" {
+		sess.Data[flowVersionVar] = snap.FlowVersion
+	}
+	setSessionHistory(&sess, snap.History)
+
+	defer a.userLocks.Lock(r.Context(), tenant, waID)()
+	a.pinFlowVersion(tenant, waID, &sess)
+	if v := sess.Data[flowVersionVar]; snap.FlowVersion != "" && v != snap.FlowVersion {
+		warnings = append(warnings, fmt.Sprintf("la versión %s del flow no está, la sesión pasa a %s", snap.FlowVersion, v))
+	}
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if _, ok := cfg.States[snap.State]; !ok {
+		writeJSONError(w, http.StatusUnprocessableEntity, "estado inexistente en el flow de destino: "+snap.State)
+		return
+	}
+	for _, st := range snap.History {
+		if _, ok := cfg.States[st]; !ok {
+			warnings = append(warnings, fmt.Sprintf("el estado %s de la historia no está en el flow", st))
+		}
+	}
+	a.sessions.Set(tenant+":"+waID, sess)
+	log.Printf("🛠️ admin: sesión importada tenant=%s wa_id=%s state=%s (snapshot de %s del %s)", tenant, waID, sess.State, snap.WaID, snap.ExportedAt.Format(time.RFC3339))
+	auditNote(r, "from_wa_id", snap.WaID)
+	auditNote(r, "state", sess.State)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"session":  SessionSummary{Tenant: tenant, WaID: waID, State: sess.State, Data: sess.Data, UpdatedAt: sess.UpdatedAt},
+		"warnings": warnings,
+	})
+}
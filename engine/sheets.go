@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"flowly/calendar"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// ---------------------
+// Google Sheets lead export
+// ---------------------
+// Acción "append_to_sheet": agrega una fila con variables de la sesión a una planilla
+// del tenant. Usa las mismas credenciales que Calendar (GOOGLE_APPLICATION_CREDENTIALS);
+// la planilla tiene que estar compartida con el service account.
+//
+// configs/{tenant}/sheets.json:
+//
+//	{
+//	  "spreadsheet_id": "1AbC...",
+//	  "sheet": "Leads",
+//	  "columns": ["timestamp", "wa_id", "form_nombre", "form_email", "last_selected_id"]
+//	}
+//
+// Columnas especiales: timestamp (hora de Buenos Aires), wa_id, tenant, state.
+// El resto se busca en las variables de la sesión (vacío si no existe).
+
+type TenantSheetsConfig struct {
+	SpreadsheetID string   `json:"spreadsheet_id"`
+	Sheet         string   `json:"sheet,omitempty"` // default "Sheet1"
+	Columns       []string `json:"columns"`
+}
+
+func loadSheetsConfig(tenant string) (TenantSheetsConfig, error) {
+	path := filepath.Join(ConfigRoot, tenant, "sheets.json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return TenantSheetsConfig{}, fmt.Errorf("no pude leer %s: %w", path, err)
+	}
+	var cfg TenantSheetsConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return TenantSheetsConfig{}, fmt.Errorf("json inválido en %s: %w", path, err)
+	}
+	if cfg.SpreadsheetID == "" {
+		return TenantSheetsConfig{}, fmt.Errorf("sheets.json de %s sin spreadsheet_id", tenant)
+	}
+	if len(cfg.Columns) == 0 {
+		return TenantSheetsConfig{}, fmt.Errorf("sheets.json de %s sin columns", tenant)
+	}
+	if cfg.Sheet == "" {
+		cfg.Sheet = "Sheet1"
+	}
+	return cfg, nil
+}
+
+// sheetRow arma los valores de la fila en el orden de las columnas.
+func sheetRow(cfg TenantSheetsConfig, tenant, userID string, sess *UserSession) []any {
+	row := make([]any, 0, len(cfg.Columns))
+	for _, col := range cfg.Columns {
+		switch col {
+		case "timestamp":
+			row = append(row, time.Now().In(calendar.Location()).Format("2006-01-02 15:04:05"))
+		case "wa_id":
+			row = append(row, userID)
+		case "tenant":
+			row = append(row, tenant)
+		case "state":
+			row = append(row, sess.State)
+		default:
+			row = append(row, sess.Data[col])
+		}
+	}
+	return row
+}
+
+func actionAppendToSheet(ctx context.Context, a *App, tenant, userID string, sess *UserSession) (map[string]string, error) {
+	cfg, err := loadSheetsConfig(tenant)
+	if err != nil {
+		return nil, err
+	}
+	credsFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if credsFile == "" {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS no está en .env")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	srv, err := sheets.NewService(ctx, option.WithCredentialsFile(credsFile), option.WithScopes(sheets.SpreadsheetsScope))
+	if err != nil {
+		return nil, fmt.Errorf("error creando cliente sheets: %v", err)
+	}
+
+	vr := &sheets.ValueRange{Values: [][]any{sheetRow(cfg, tenant, userID, sess)}}
+	_, err = srv.Spreadsheets.Values.Append(cfg.SpreadsheetID, cfg.Sheet, vr).
+		ValueInputOption("USER_ENTERED").
+		InsertDataOption("INSERT_ROWS").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("error agregando fila a la planilla: %w", err)
+	}
+
+	log.Printf("📊 Lead exportado a Sheets tenant=%s wa_id=%s", tenant, userID)
+	return map[string]string{"sheet_exported_at": time.Now().Format(time.RFC3339)}, nil
+}
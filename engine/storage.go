@@ -0,0 +1,395 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// ---------------------
+// Postgres persistence (opcional)
+// ---------------------
+// Si DATABASE_URL está seteada, las sesiones, contactos y el log de mensajes
+// se persisten en Postgres (restart-safe + analytics). Si no, todo queda en memoria.
+//
+// Los métodos de sesiones, contactos y mensajes aceptan receiver nil (no-op), así el
+// resto del código no tiene que preguntar si hay DB o no.
+
+const dbTimeout = 5 * time.Second
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+type PostgresStore struct {
+	db *sql.DB
+}
+
+type MessageLogEntry struct {
+	Tenant    string          `json:"tenant"`
+	WaID      string          `json:"wa_id"`
+	Direction string          `json:"direction"` // "in" | "out"
+	MessageID string          `json:"message_id,omitempty"`
+	Type      string          `json:"type"`
+	State     string          `json:"state,omitempty"`
+	Body      string          `json:"body"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewPostgresStoreFromEnv devuelve nil (sin error) si DATABASE_URL no está seteada.
+func NewPostgresStoreFromEnv() (*PostgresStore, error) {
+	dsn := strings.TrimSpace(os.Getenv("DATABASE_URL"))
+	if dsn == "" {
+		return nil, nil
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("DATABASE_URL inválida: %w", err)
+	}
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("no pude conectar a Postgres: %w", err)
+	}
+
+	s := &PostgresStore{db: db}
+	if err := s.Migrate(); err != nil {
+		return nil, err
+	}
+	log.Printf("🗄️ Postgres conectado (sesiones, contactos y mensajes persistentes)")
+	return s, nil
+}
+
+// Ping verifica la conexión (para /readyz).
+func (s *PostgresStore) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// Migrate aplica en orden los archivos migrations/NNN_*.sql que todavía no corrieron.
+func (s *PostgresStore) Migrate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT        PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("error creando schema_migrations: %w", err)
+	}
+
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".sql") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(name, ".sql")
+
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&exists); err != nil {
+			return fmt.Errorf("error leyendo schema_migrations: %w", err)
+		}
+		if exists {
+			continue
+		}
+
+		sqlText, err := migrationsFS.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return err
+		}
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(sqlText)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migración %s falló: %w", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("🗄️ Migración aplicada: %s", name)
+	}
+	return nil
+}
+
+// ---------------------
+// Sessions
+// ---------------------
+
+func splitSessionKey(key string) (tenant, waID string) {
+	kv := strings.SplitN(key, ":", 2)
+	if len(kv) != 2 {
+		return "", key
+	}
+	return kv[0], kv[1]
+}
+
+func (s *PostgresStore) LoadSession(key string) (UserSession, bool, error) {
+	if s == nil {
+		return UserSession{}, false, nil
+	}
+	tenant, waID := splitSessionKey(key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var sess UserSession
+	var data []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT state, data, updated_at FROM sessions WHERE tenant = $1 AND wa_id = $2`,
+		tenant, waID,
+	).Scan(&sess.State, &data, &sess.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return UserSession{}, false, nil
+	}
+	if err != nil {
+		return UserSession{}, false, err
+	}
+	sess.Data = make(map[string]string)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &sess.Data); err != nil {
+			return UserSession{}, false, fmt.Errorf("session data inválida (%s): %w", key, err)
+		}
+	}
+	return sess, true, nil
+}
+
+func (s *PostgresStore) SaveSession(key string, sess UserSession) error {
+	if s == nil {
+		return nil
+	}
+	tenant, waID := splitSessionKey(key)
+	data, err := json.Marshal(sess.Data)
+	if err != nil {
+		return err
+	}
+	if sess.Data == nil {
+		data = []byte("{}")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO sessions (tenant, wa_id, state, data, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant, wa_id) DO UPDATE
+		SET state = EXCLUDED.state, data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+		tenant, waID, sess.State, data, sess.UpdatedAt,
+	)
+	return err
+}
+
+// ListSessions lista las sesiones de un tenant actualizadas después de since.
+func (s *PostgresStore) ListSessions(tenant, state string, since time.Time, limit int) ([]SessionSummary, error) {
+	if s == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT wa_id, state, data, updated_at
+		FROM sessions
+		WHERE tenant = $1 AND updated_at >= $2 AND ($3 = '' OR state = $3)
+		ORDER BY updated_at DESC
+		LIMIT $4`,
+		tenant, since, state, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SessionSummary
+	for rows.Next() {
+		sum := SessionSummary{Tenant: tenant}
+		var data []byte
+		if err := rows.Scan(&sum.WaID, &sum.State, &data, &sum.UpdatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(data, &sum.Data)
+		out = append(out, sum)
+	}
+	return out, rows.Err()
+}
+
+// ---------------------
+// Contacts
+// ---------------------
+
+// TouchContact registra (o actualiza) un contacto que nos escribió.
+func (s *PostgresStore) TouchContact(tenant, waID, name string) error {
+	if s == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO contacts (tenant, wa_id, name, first_seen, last_seen)
+		VALUES ($1, $2, $3, now(), now())
+		ON CONFLICT (tenant, wa_id) DO UPDATE
+		SET name = CASE WHEN EXCLUDED.name <> '' THEN EXCLUDED.name ELSE contacts.name END,
+		    last_seen = now()`,
+		tenant, waID, name,
+	)
+	return err
+}
+
+// ---------------------
+// Message log
+// ---------------------
+
+// MessageLogger es lo que los clientes de envío necesitan del log de mensajes.
+type MessageLogger interface {
+	LogMessage(m MessageLogEntry) error
+}
+
+func (s *PostgresStore) LogMessage(m MessageLogEntry) error {
+	if s == nil {
+		return nil
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	var payload any
+	if len(m.Payload) > 0 {
+		payload = []byte(m.Payload)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO messages (tenant, wa_id, direction, message_id, type, state, body, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		m.Tenant, m.WaID, m.Direction, m.MessageID, m.Type, m.State, m.Body, payload, m.CreatedAt,
+	)
+	return err
+}
+
+// RecentMessages devuelve los últimos mensajes de una conversación, del más viejo al más nuevo.
+func (s *PostgresStore) RecentMessages(tenant, waID string, limit int) ([]MessageLogEntry, error) {
+	if s == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tenant, wa_id, direction, message_id, type, state, body, payload, created_at
+		FROM messages
+		WHERE tenant = $1 AND wa_id = $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3`,
+		tenant, waID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// MessagesBetween devuelve los mensajes de [from, to) en orden cronológico.
+// waID vacío = todas las conversaciones del tenant (para exportar).
+func (s *PostgresStore) MessagesBetween(tenant, waID string, from, to time.Time, limit int) ([]MessageLogEntry, error) {
+	if s == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tenant, wa_id, direction, message_id, type, state, body, payload, created_at
+		FROM messages
+		WHERE tenant = $1 AND ($2 = '' OR wa_id = $2) AND created_at >= $3 AND created_at < $4
+		ORDER BY created_at, id
+		LIMIT $5`,
+		tenant, waID, from, to, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMessages(rows)
+}
+
+func scanMessages(rows *sql.Rows) ([]MessageLogEntry, error) {
+	var out []MessageLogEntry
+	for rows.Next() {
+		var m MessageLogEntry
+		var payload []byte
+		if err := rows.Scan(&m.Tenant, &m.WaID, &m.Direction, &m.MessageID, &m.Type, &m.State, &m.Body, &payload, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Payload = payload
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// ---------------------
+// Helpers para el log
+// ---------------------
+
+// incomingSummary extrae un texto legible de un mensaje entrante.
+func incomingSummary(msg IncomingMessage) string {
+	switch {
+	case msg.Text != nil:
+		return msg.Text.Body
+	case msg.Interactive != nil && msg.Interactive.ListReply != nil:
+		return msg.Interactive.ListReply.ID + " | " + msg.Interactive.ListReply.Title
+	case msg.Interactive != nil && msg.Interactive.ButtonReply != nil:
+		return msg.Interactive.ButtonReply.ID + " | " + msg.Interactive.ButtonReply.Title
+	case msg.Button != nil:
+		return msg.Button.Payload + " | " + msg.Button.Text
+	case msg.Audio != nil:
+		return "[audio " + msg.Audio.MimeType + "]"
+	case msg.Reaction != nil:
+		return msg.Reaction.Emoji + " -> " + msg.Reaction.MessageID
+	case msg.Order != nil:
+		return fmt.Sprintf("pedido: %d productos", len(msg.Order.ProductItems))
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,469 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Encuestas de satisfacción (NPS / CSAT)
+// ---------------------
+// Un estado "survey" pide una calificación, la guarda (con el tenant y la versión del flow
+// de la sesión) y sigue a on_text_next. on_select_next puede mandar algunos puntajes a otro
+// estado (ej: preguntar qué salió mal a los que ponen 1 o 2):
+//
+//	"ENCUESTA": {
+//	  "type": "survey",
+//	  "body": "¿Cómo te atendimos hoy, {{name}}?",
+//	  "survey": { "id": "csat_bot", "scale": "1-5", "labels": { "1": "😞 Muy mal", "5": "🤩 Excelente" } },
+//	  "on_select_next": { "1": "ENCUESTA_MOTIVO", "2": "ENCUESTA_MOTIVO" },
+//	  "on_text_next": "GRACIAS"
+//	}
+//
+// Escalas:
+//
+//	1-3   botones
+//	1-5   lista (default)
+//	0-10  NPS: se pide el número por texto (WhatsApp no acepta listas de más de 10 filas)
+//
+// En cualquier escala también vale escribir el número. Si responde otra cosa se vuelve a
+// preguntar (survey.error o un texto por defecto). El puntaje queda en {{survey_score}}.
+//
+//	GET /admin/tenants/{tenant}/analytics/surveys?days=30&survey=csat_bot
+//
+// Por encuesta: respuestas, promedio, distribución y el puntaje de la escala (nps en 0-10 =
+// % promotores 9-10 menos % detractores 0-6; csat en 1-5 / 1-3 = % que eligió los dos / el
+// valor más alto), también por versión del flow.
+
+const (
+	surveyStateType     = "survey"
+	surveyScoreVar      = "survey_score"
+	surveyErrorVar      = "_survey_error"
+	surveyOptionPrefix  = "__SURVEY_"
+	defaultSurveyScale  = "1-5"
+	defaultSurveyDays   = 30
+	maxSurveyResponses  = 100000
+	maxMemorySurveyRows = 50000 // por tenant
+)
+
+// surveyScales: mínimo y máximo de cada escala.
+var surveyScales = map[string][2]int{
+	"1-3":  {1, 3},
+	"1-5":  {1, 5},
+	"0-10": {0, 10},
+}
+
+type FlowSurvey struct {
+	ID         string            `json:"id"`                    // agrupa las respuestas (puede haber varios estados con el mismo)
+	Scale      string            `json:"scale,omitempty"`       // "1-3" | "1-5" (default) | "0-10"
+	Labels     map[string]string `json:"labels,omitempty"`      // puntaje -> texto del botón / fila
+	ButtonText string            `json:"button_text,omitempty"` // lista (default "Calificar")
+	Error      string            `json:"error,omitempty"`       // respuesta que no es un puntaje
+}
+
+func (s FlowSurvey) scale() string {
+	if s.Scale == "" {
+		return defaultSurveyScale
+	}
+	return s.Scale
+}
+
+func (s FlowSurvey) bounds() (int, int) {
+	b := surveyScales[s.scale()]
+	return b[0], b[1]
+}
+
+// label es el texto de la opción del puntaje (el de labels o el número con estrellas).
+func (s FlowSurvey) label(score int) string {
+	if l, ok := s.Labels[strconv.Itoa(score)]; ok {
+		return l
+	}
+	if s.scale() == "1-5" {
+		return strconv.Itoa(score) + " " + strings.Repeat("⭐", score)
+	}
+	return strconv.Itoa(score)
+}
+
+// parseScore interpreta la respuesta: el id de una opción o el número escrito.
+func (s FlowSurvey) parseScore(selectedID, text string) (int, bool) {
+	raw := strings.TrimPrefix(selectedID, surveyOptionPrefix)
+	if selectedID == "" {
+		raw = strings.TrimSpace(text)
+	}
+	n, err := strconv.Atoi(raw)
+	lo, hi := s.bounds()
+	if err != nil || n < lo || n > hi {
+		return 0, false
+	}
+	return n, true
+}
+
+func validateSurvey(stateName string, st FlowState) []string {
+	if st.Type != surveyStateType {
+		if st.Survey != nil {
+			return []string{fmt.Sprintf("state=%s tiene survey pero no es type survey", stateName)}
+		}
+		return nil
+	}
+	s := st.Survey
+	if s == nil {
+		return []string{fmt.Sprintf("state=%s es survey pero survey es nil", stateName)}
+	}
+	var errs []string
+	if strings.TrimSpace(s.ID) == "" {
+		errs = append(errs, fmt.Sprintf("state=%s survey.id vacío", stateName))
+	}
+	if _, ok := surveyScales[s.scale()]; !ok {
+		return append(errs, fmt.Sprintf("state=%s survey.scale no soportada: %q (1-3, 1-5 o 0-10)", stateName, s.Scale))
+	}
+	maxTitle := 24 // fila de lista
+	if s.scale() == "1-3" {
+		maxTitle = 20 // botón
+	}
+	for _, k := range sortedKeys(s.Labels) {
+		if _, ok := s.parseScore("", k); !ok {
+			errs = append(errs, fmt.Sprintf("state=%s survey.labels[%s] fuera de la escala %s", stateName, k, s.scale()))
+		} else if runeLen(s.Labels[k]) > maxTitle {
+			errs = append(errs, fmt.Sprintf("state=%s survey.labels[%s] > %d (%d): %q", stateName, k, maxTitle, runeLen(s.Labels[k]), s.Labels[k]))
+		}
+	}
+	if runeLen(s.ButtonText) > 20 {
+		errs = append(errs, fmt.Sprintf("state=%s survey.button_text > 20 (%d): %q", stateName, runeLen(s.ButtonText), s.ButtonText))
+	}
+	for _, k := range sortedKeys(st.OnSelectNext) {
+		if _, ok := s.parseScore("", k); !ok {
+			errs = append(errs, fmt.Sprintf("state=%s on_select_next[%s] no es un puntaje de la escala %s", stateName, k, s.scale()))
+		}
+	}
+	return errs
+}
+
+// sendSurvey manda la pregunta con las opciones de la escala (o solo el texto en 0-10).
+func sendSurvey(ctx context.Context, client MessageSender, to string, st FlowState, vars map[string]string) error {
+	s := st.Survey
+	body := renderVars(st.Body, vars)
+	if e := vars[surveyErrorVar]; e != "" {
+		body = e + "\n\n" + body
+	}
+	lo, hi := s.bounds()
+	switch s.scale() {
+	case "1-3":
+		btns := make([]wa.Button, 0, hi-lo+1)
+		for n := lo; n <= hi; n++ {
+			btns = append(btns, wa.Button{ID: surveyOptionPrefix + strconv.Itoa(n), Title: renderVars(s.label(n), vars)})
+		}
+		return client.SendButtons(ctx, to, "", "", body, "", btns)
+
+	case "1-5":
+		rows := make([]wa.Row, 0, hi-lo+1)
+		for n := hi; n >= lo; n-- {
+			rows = append(rows, wa.Row{ID: surveyOptionPrefix + strconv.Itoa(n), Title: renderVars(s.label(n), vars)})
+		}
+		button := s.ButtonText
+		if button == "" {
+			button = "Calificar"
+		}
+		return client.SendList(ctx, to, "", "", body, "", button, []wa.Section{{Rows: rows}})
+	}
+	return client.SendText(ctx, to, body)
+}
+
+// handleSurveyInput registra la calificación mientras el usuario está en un estado "survey".
+// handled=false: el mensaje no es para la encuesta (sigue el flujo normal).
+func (a *App) handleSurveyInput(tenant, state string, sess *UserSession, msg IncomingMessage, selectedID string, vars map[string]string) (next string, handled bool, err error) {
+	cfg, err := a.cache.LoadVersion(tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return "", false, err
+	}
+	st, ok := cfg.States[state]
+	if !ok || st.Type != surveyStateType || st.Survey == nil {
+		return "", false, nil
+	}
+	text := ""
+	switch {
+	case strings.HasPrefix(selectedID, surveyOptionPrefix):
+	case selectedID == "" && msg.Type == "text" && msg.Text != nil:
+		text = msg.Text.Body
+	default:
+		return "", false, nil // otra lista / botón (uno viejo) o un mensaje que no es texto
+	}
+
+	score, ok := st.Survey.parseScore(selectedID, text)
+	if !ok {
+		errMsg := st.Survey.Error
+		if errMsg == "" {
+			lo, hi := st.Survey.bounds()
+			errMsg = fmt.Sprintf("Respondé con un número del %d al %d 🙏", lo, hi)
+		}
+		setSessionVar(sess, vars, surveyErrorVar, errMsg)
+		return state, true, nil
+	}
+	delete(sess.Data, surveyErrorVar)
+	delete(vars, surveyErrorVar)
+	setSessionVar(sess, vars, surveyScoreVar, strconv.Itoa(score))
+
+	resp := SurveyResponse{
+		Tenant: tenant, Survey: st.Survey.ID, Scale: st.Survey.scale(), Score: score,
+		WaID: vars["wa_id"], State: state, FlowVersion: sess.Data[flowVersionVar], At: time.Now(),
+	}
+	if err := a.surveys.RecordSurveyResponse(resp); err != nil {
+		log.Printf("ERROR guardando respuesta de la encuesta %s: %v", resp.Survey, err)
+	}
+	metrics.Inc("flowly_survey_responses_total", tenant, resp.Survey)
+	log.Printf("📊 tenant=%s encuesta %s: %d (%s)", tenant, resp.Survey, score, resp.Scale)
+
+	if to, ok := st.OnSelectNext[strconv.Itoa(score)]; ok {
+		return to, true, nil
+	}
+	if st.OnTextNext == "" {
+		return cfg.Entry(), true, nil
+	}
+	return st.OnTextNext, true, nil
+}
+
+// ---------------------
+// Respuestas y puntajes
+// ---------------------
+
+type SurveyResponse struct {
+	Tenant      string    `json:"tenant"`
+	Survey      string    `json:"survey"`
+	WaID        string    `json:"wa_id"`
+	State       string    `json:"state"`
+	FlowVersion string    `json:"flow_version"`
+	Scale       string    `json:"scale"`
+	Score       int       `json:"score"`
+	At          time.Time `json:"at"`
+}
+
+type SurveyStore interface {
+	RecordSurveyResponse(r SurveyResponse) error
+	// SurveyResponses devuelve las respuestas desde since en orden cronológico.
+	SurveyResponses(tenant string, since time.Time, limit int) ([]SurveyResponse, error)
+	// DeleteSurveyResponses borra las respuestas de un usuario (ver retention.go).
+	DeleteSurveyResponses(tenant, waID string) (int, error)
+}
+
+func NewSurveyStore(store *PostgresStore) SurveyStore {
+	if store != nil {
+		return store
+	}
+	return &memorySurveyStore{responses: make(map[string][]SurveyResponse)}
+}
+
+type SurveyScore struct {
+	Responses    int         `json:"responses"`
+	Average      float64     `json:"average"`
+	Distribution map[int]int `json:"distribution"`
+	NPS          *float64    `json:"nps,omitempty"`  // 0-10: -100..100
+	CSAT         *float64    `json:"csat,omitempty"` // 1-5 / 1-3: 0..1
+}
+
+type SurveyStats struct {
+	Survey string `json:"survey"`
+	Scale  string `json:"scale"`
+	SurveyScore
+	ByVersion map[string]SurveyScore `json:"by_version"`
+}
+
+// computeSurveyStats agrupa por encuesta (y escala: si una encuesta cambió de escala, cada
+// una se cuenta aparte).
+func computeSurveyStats(resps []SurveyResponse) []SurveyStats {
+	type group struct {
+		all       []SurveyResponse
+		byVersion map[string][]SurveyResponse
+	}
+	groups := make(map[string]*group)
+	for _, r := range resps {
+		key := r.Survey + "\x00" + r.Scale
+		g, ok := groups[key]
+		if !ok {
+			g = &group{byVersion: make(map[string][]SurveyResponse)}
+			groups[key] = g
+		}
+		g.all = append(g.all, r)
+		g.byVersion[r.FlowVersion] = append(g.byVersion[r.FlowVersion], r)
+	}
+
+	out := make([]SurveyStats, 0, len(groups))
+	for _, key := range sortedKeys(groups) {
+		g := groups[key]
+		s := SurveyStats{Survey: g.all[0].Survey, Scale: g.all[0].Scale, SurveyScore: surveyScore(g.all), ByVersion: make(map[string]SurveyScore)}
+		for v, rs := range g.byVersion {
+			s.ByVersion[v] = surveyScore(rs)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func surveyScore(resps []SurveyResponse) SurveyScore {
+	s := SurveyScore{Responses: len(resps), Distribution: make(map[int]int)}
+	if len(resps) == 0 {
+		return s
+	}
+	scale := resps[0].Scale
+	_, hi := FlowSurvey{Scale: scale}.bounds()
+	topFrom := hi - 1 // CSAT: los dos valores más altos (en 1-3, solo el más alto)
+	if scale == "1-3" {
+		topFrom = hi
+	}
+	sum, promoters, detractors, top := 0, 0, 0, 0
+	for _, r := range resps {
+		s.Distribution[r.Score]++
+		sum += r.Score
+		switch {
+		case r.Score >= 9:
+			promoters++
+		case r.Score <= 6:
+			detractors++
+		}
+		if r.Score >= topFrom {
+			top++
+		}
+	}
+	n := float64(len(resps))
+	s.Average = float64(sum) / n
+	if scale == "0-10" {
+		nps := (float64(promoters) - float64(detractors)) / n * 100
+		s.NPS = &nps
+	} else {
+		csat := float64(top) / n
+		s.CSAT = &csat
+	}
+	return s
+}
+
+func (a *App) handleAdminSurveys(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	days := defaultSurveyDays
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 && n <= 365 {
+		days = n
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	resps, err := a.surveys.SurveyResponses(tenant, since, maxSurveyResponses)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if id := r.URL.Query().Get("survey"); id != "" {
+		filtered := resps[:0]
+		for _, resp := range resps {
+			if resp.Survey == id {
+				filtered = append(filtered, resp)
+			}
+		}
+		resps = filtered
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tenant":    tenant,
+		"since":     since,
+		"surveys":   computeSurveyStats(resps),
+		"truncated": len(resps) == maxSurveyResponses,
+	})
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memorySurveyStore struct {
+	mu        sync.Mutex
+	responses map[string][]SurveyResponse // tenant -> respuestas (cronológico)
+}
+
+func (s *memorySurveyStore) RecordSurveyResponse(r SurveyResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := append(s.responses[r.Tenant], r)
+	if len(rs) > maxMemorySurveyRows {
+		rs = rs[len(rs)-maxMemorySurveyRows:]
+	}
+	s.responses[r.Tenant] = rs
+	return nil
+}
+
+func (s *memorySurveyStore) SurveyResponses(tenant string, since time.Time, limit int) ([]SurveyResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []SurveyResponse
+	for _, r := range s.responses[tenant] {
+		if r.At.Before(since) {
+			continue
+		}
+		out = append(out, r)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (s *memorySurveyStore) DeleteSurveyResponses(tenant, waID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.responses[tenant][:0]
+	for _, r := range s.responses[tenant] {
+		if r.WaID != waID {
+			kept = append(kept, r)
+		}
+	}
+	n := len(s.responses[tenant]) - len(kept)
+	s.responses[tenant] = kept
+	return n, nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) RecordSurveyResponse(r SurveyResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO survey_responses (tenant, survey, wa_id, state, flow_version, scale, score, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		r.Tenant, r.Survey, r.WaID, r.State, r.FlowVersion, r.Scale, r.Score, r.At,
+	)
+	return err
+}
+
+func (s *PostgresStore) SurveyResponses(tenant string, since time.Time, limit int) ([]SurveyResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tenant, survey, wa_id, state, flow_version, scale, score, created_at
+		FROM survey_responses
+		WHERE tenant = $1 AND created_at >= $2
+		ORDER BY created_at, id
+		LIMIT $3`,
+		tenant, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SurveyResponse
+	for rows.Next() {
+		var r SurveyResponse
+		if err := rows.Scan(&r.Tenant, &r.Survey, &r.WaID, &r.State, &r.FlowVersion, &r.Scale, &r.Score, &r.At); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) DeleteSurveyResponses(tenant, waID string) (int, error) {
+	return s.execCount(`DELETE FROM survey_responses WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
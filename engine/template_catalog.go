@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Catálogo de templates de la WABA
+// ---------------------
+// Los templates que usa el flow (timeout_template de un estado, whatsapp_errors.window_template)
+// tienen que existir en la cuenta de WhatsApp Business del tenant, estar aprobados y recibir
+// tantos body_params como variables ({{1}}, {{2}}...) tenga el body; si no, Meta rechaza el
+// envío recién cuando el bot lo intenta. runTemplateSync baja cada TEMPLATE_SYNC_SECONDS los
+// templates aprobados de la WABA del tenant (la de TENANT_BY_WABA_ID) y los deja en memoria.
+//
+// Con el catálogo bajado, cargar un flow (publicar, rollback, arrancar) valida esas referencias
+// y falla igual que con un estado mal armado. Sin catálogo (el tenant no tiene WABA, todavía no
+// sincronizó o Meta no respondió) no se valida: cargar un flow nunca espera a la Graph API.
+// Cuando Meta avisa que un template cambió de estado o de categoría (ver webhook_events.go) se
+// vuelve a bajar el del tenant, y si el flow publicado quedó usando uno que ya no está aprobado
+// se loguea (el flow cacheado sigue andando).
+//
+//	GET  /admin/tenants/{tenant}/templates        (catálogo + problemas del flow publicado)
+//	POST /admin/tenants/{tenant}/templates/sync
+//
+// ENV:
+//
+//	TEMPLATE_SYNC_SECONDS=21600
+
+const (
+	defaultTemplateSync = 6 * time.Hour
+	templateSyncTimeout = 30 * time.Second
+	defaultTemplateLang = "es_AR"
+)
+
+// TemplateCatalog guarda los templates aprobados de cada tenant (lo comparten todos los flows
+// que se cargan en el proceso, por eso es global como metrics).
+type TemplateCatalog struct {
+	mu       sync.RWMutex
+	byTenant map[string]tenantTemplates
+}
+
+type tenantTemplates struct {
+	SyncedAt  time.Time
+	Templates map[string]wa.Template // name/language
+}
+
+var templateCatalogs = NewTemplateCatalog()
+
+func NewTemplateCatalog() *TemplateCatalog {
+	return &TemplateCatalog{byTenant: make(map[string]tenantTemplates)}
+}
+
+func templateKey(name, lang string) string { return name + "/" + lang }
+
+func (c *TemplateCatalog) Set(tenant string, list []wa.Template, at time.Time) {
+	m := make(map[string]wa.Template, len(list))
+	for _, t := range list {
+		m[templateKey(t.Name, t.Language)] = t
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byTenant[tenant] = tenantTemplates{SyncedAt: at, Templates: m}
+}
+
+// Get devuelve el catálogo del tenant (ok=false si nunca se sincronizó).
+func (c *TemplateCatalog) Get(tenant string) (tenantTemplates, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.byTenant[tenant]
+	return t, ok
+}
+
+// List devuelve los templates del tenant ordenados por nombre e idioma.
+func (t tenantTemplates) List() []wa.Template {
+	out := make([]wa.Template, 0, len(t.Templates))
+	for _, tpl := range t.Templates {
+		out = append(out, tpl)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return templateKey(out[i].Name, out[i].Language) < templateKey(out[j].Name, out[j].Language)
+	})
+	return out
+}
+
+// validateTemplates chequea los templates del flow contra el catálogo del tenant (si lo hay).
+func validateTemplates(tenant string, cfg FlowConfig) []string {
+	catalog, ok := templateCatalogs.Get(tenant)
+	if !ok {
+		return nil
+	}
+	return checkFlowTemplates(cfg, catalog)
+}
+
+func checkFlowTemplates(cfg FlowConfig, catalog tenantTemplates) []string {
+	var errs []string
+	check := func(where string, tpl *FlowTimeoutTemplate) {
+		if tpl == nil || tpl.Name == "" {
+			return // el name vacío ya lo reporta la validación del campo
+		}
+		lang := tpl.Language
+		if lang == "" {
+			lang = defaultTemplateLang
+		}
+		got, ok := catalog.Templates[templateKey(tpl.Name, lang)]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("%s: el template %q (%s) no existe en la WABA o no está aprobado", where, tpl.Name, lang))
+		case got.BodyParams != len(tpl.BodyParams):
+			errs = append(errs, fmt.Sprintf("%s: el template %q (%s) espera %d body_params y el flow manda %d", where, tpl.Name, lang, got.BodyParams, len(tpl.BodyParams)))
+		}
+	}
+	for _, name := range sortedStateNames(cfg) {
+		check("state="+name+" timeout_template", cfg.States[name].TimeoutTemplate)
+	}
+	if cfg.WhatsAppErrors != nil {
+		check("whatsapp_errors.window_template", cfg.WhatsAppErrors.WindowTemplate)
+	}
+	return errs
+}
+
+var errNoWABA = errors.New("el tenant no tiene WABA configurada (TENANT_BY_WABA_ID)")
+
+// syncTemplates baja el catálogo del tenant y revisa el flow publicado contra él.
+func (a *App) syncTemplates(ctx context.Context, tenant string) error {
+	wabaID, ok := a.resolver.WABAID(tenant)
+	if !ok {
+		return errNoWABA
+	}
+	phoneID, ok := a.resolver.PhoneNumberID(tenant)
+	if !ok {
+		return fmt.Errorf("el tenant %s no tiene número de WhatsApp", tenant)
+	}
+	c, err := a.tenantWhatsAppClient(phoneID, tenant)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, templateSyncTimeout)
+	defer cancel()
+	list, err := c.ListTemplates(ctx, wabaID)
+	if err != nil {
+		return err
+	}
+	templateCatalogs.Set(tenant, list, time.Now())
+	debugf("templates de tenant=%s sincronizados: %d aprobados", tenant, len(list))
+
+	if cfg, err := a.cache.Load(tenant); err != nil {
+		log.Printf("ERROR tenant=%s el flow publicado no carga con el catálogo de templates nuevo: %v", tenant, err)
+	} else if errs := validateTemplates(tenant, cfg); len(errs) > 0 {
+		for _, e := range errs {
+			log.Printf("⚠️ tenant=%s flow publicado: %s", tenant, e)
+		}
+	}
+	return nil
+}
+
+// refreshTemplates resincroniza el catálogo en background (avisos de Meta, de otra réplica).
+func (a *App) refreshTemplates(tenant string) {
+	go func() {
+		if err := a.syncTemplates(context.Background(), tenant); err != nil && !errors.Is(err, errNoWABA) {
+			log.Printf("ERROR sincronizando templates de %s: %v", tenant, err)
+		}
+	}()
+}
+
+func (a *App) runTemplateSync(ctx context.Context) {
+	every := time.Duration(envPositiveInt("TEMPLATE_SYNC_SECONDS", int(defaultTemplateSync/time.Second))) * time.Second
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		for _, tenant := range a.resolver.Tenants() {
+			if _, ok := a.resolver.WABAID(tenant); !ok {
+				continue
+			}
+			if err := a.syncTemplates(ctx, tenant); err != nil {
+				log.Printf("ERROR sincronizando templates de %s: %v", tenant, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) handleAdminListTemplates(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	catalog, ok := templateCatalogs.Get(tenant)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "todavía no hay catálogo de templates de ese tenant")
+		return
+	}
+	res := map[string]any{"tenant": tenant, "synced_at": catalog.SyncedAt, "templates": catalog.List()}
+	if cfg, err := a.cache.Load(tenant); err == nil {
+		res["problems"] = checkFlowTemplates(cfg, catalog)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (a *App) handleAdminSyncTemplates(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	if err := a.syncTemplates(r.Context(), tenant); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errNoWABA) {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	a.notifyReplicas(clusterTemplates, tenant)
+	a.handleAdminListTemplates(w, r)
+}
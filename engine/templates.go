@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Templating: {{name}} y filtros
+// ---------------------
+// {{var}} se reemplaza por el valor de la variable (si no existe, queda tal cual). Con
+// filtros, separados por "|", se puede formatear sin precalcular nada en Go:
+//
+//	{{name|title}}                        -> "Juan Pérez"
+//	{{email|default:no informado}}        -> el default si la variable no existe o está vacía
+//	{{appointment_start|format:Mon 02 Jan 15:04}}
+//	{{price|currency:ARS}}                -> "$ 12.500,00"
+//	{{notes|truncate:80}}
+//
+// Filtros: default, upper, lower, title, trim, truncate:N, format:<layout Go>, currency:<ISO>.
+// format acepta fechas RFC3339, "2006-01-02 15:04" o "2006-01-02" y las muestra en la zona de
+// la agenda.
+
+var templateVarRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*((?:\|[^{}|]*)*)\}\}`)
+
+type templateFilter func(value, arg string) string
+
+var templateFilters = map[string]templateFilter{
+	"default": func(v, arg string) string {
+		if strings.TrimSpace(v) == "" {
+			return arg
+		}
+		return v
+	},
+	"upper":    func(v, _ string) string { return strings.ToUpper(v) },
+	"lower":    func(v, _ string) string { return strings.ToLower(v) },
+	"trim":     func(v, _ string) string { return strings.TrimSpace(v) },
+	"title":    func(v, _ string) string { return titleCase(v) },
+	"truncate": filterTruncate,
+	"format":   filterFormatDate,
+	"currency": filterCurrency,
+}
+
+func renderVars(s string, vars map[string]string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return templateVarRe.ReplaceAllStringFunc(s, func(tok string) string {
+		m := templateVarRe.FindStringSubmatch(tok)
+		value, ok := vars[m[1]]
+		if m[2] == "" {
+			if !ok {
+				return tok
+			}
+			return value
+		}
+		for _, f := range strings.Split(m[2], "|")[1:] {
+			name, arg, _ := strings.Cut(f, ":")
+			if fn, ok := templateFilters[strings.TrimSpace(name)]; ok {
+				value = fn(value, arg)
+			}
+		}
+		return value
+	})
+}
+
+// validateTemplateFilters marca filtros desconocidos en los textos del flow.
+func validateTemplateFilters(stateName string, st FlowState) []string {
+	texts := []string{st.Body}
+	for _, m := range st.Messages {
+		texts = append(texts, m.Body)
+	}
+	if st.List != nil {
+		texts = append(texts, st.List.Header, st.List.Footer, st.List.ButtonText)
+		for _, sec := range st.List.Sections {
+			for _, row := range sec.Rows {
+				texts = append(texts, row.Title, row.Description)
+			}
+		}
+	}
+	if st.Buttons != nil {
+		texts = append(texts, st.Buttons.Header, st.Buttons.Footer)
+		for _, b := range st.Buttons.Buttons {
+			texts = append(texts, b.Title)
+		}
+	}
+	if st.CTA != nil {
+		texts = append(texts, st.CTA.Header, st.CTA.Footer, st.CTA.DisplayText, st.CTA.URL)
+	}
+	if st.Catalog != nil {
+		texts = append(texts, st.Catalog.Header, st.Catalog.Footer)
+	}
+
+	var errs []string
+	for _, t := range texts {
+		errs = append(errs, templateFilterErrors("state="+stateName, t)...)
+	}
+	return errs
+}
+
+// templateFilterErrors marca filtros desconocidos (o mal usados) en un texto; where es el
+// prefijo de cada error (ej: "state=MENU").
+func templateFilterErrors(where, text string) []string {
+	var errs []string
+	for _, m := range templateVarRe.FindAllStringSubmatch(text, -1) {
+		if m[2] == "" {
+			continue
+		}
+		for _, f := range strings.Split(m[2], "|")[1:] {
+			name, arg, _ := strings.Cut(f, ":")
+			name = strings.TrimSpace(name)
+			if _, ok := templateFilters[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s {{%s}}: filtro desconocido %q", where, m[1], name))
+				continue
+			}
+			if name == "truncate" {
+				if n, err := strconv.Atoi(strings.TrimSpace(arg)); err != nil || n <= 0 {
+					errs = append(errs, fmt.Sprintf("%s {{%s}}: truncate necesita un número positivo", where, m[1]))
+				}
+			}
+			if name == "currency" {
+				if _, ok := currencyFormats[strings.ToUpper(strings.TrimSpace(arg))]; !ok {
+					errs = append(errs, fmt.Sprintf("%s {{%s}}: moneda no soportada %q", where, m[1], arg))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func titleCase(s string) string {
+	var b strings.Builder
+	start := true
+	for _, r := range strings.ToLower(s) {
+		if start && unicode.IsLetter(r) {
+			r = unicode.ToUpper(r)
+		}
+		start = unicode.IsSpace(r) || r == '-'
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func filterTruncate(v, arg string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || n <= 0 || utf8.RuneCountInString(v) <= n {
+		return v
+	}
+	return truncateRunes(v, n)
+}
+
+var templateDateLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"}
+
+func filterFormatDate(v, layout string) string {
+	v = strings.TrimSpace(v)
+	if layout == "" {
+		layout = "02/01/2006 15:04"
+	}
+	loc := calendar.Location()
+	for _, l := range templateDateLayouts {
+		if t, err := time.ParseInLocation(l, v, loc); err == nil {
+			return t.In(loc).Format(layout)
+		}
+	}
+	return v // no es una fecha: queda como vino
+}
+
+type currencyFormat struct {
+	symbol    string
+	decimals  int
+	thousands string
+	decimal   string
+}
+
+var currencyFormats = map[string]currencyFormat{
+	"ARS": {"$", 2, ".", ","},
+	"UYU": {"$U", 2, ".", ","},
+	"CLP": {"$", 0, ".", ","},
+	"COP": {"$", 0, ".", ","},
+	"BRL": {"R$", 2, ".", ","},
+	"EUR": {"€", 2, ".", ","},
+	"MXN": {"$", 2, ",", "."},
+	"USD": {"US$", 2, ",", "."},
+}
+
+func filterCurrency(v, code string) string {
+	cf, ok := currencyFormats[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return v
+	}
+	amount, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return v
+	}
+
+	neg := amount < 0
+	scaled := int64(math.Round(math.Abs(amount) * math.Pow10(cf.decimals)))
+	intPart := strconv.FormatInt(scaled/int64(math.Pow10(cf.decimals)), 10)
+
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(cf.thousands)
+		}
+		b.WriteRune(r)
+	}
+	out := b.String()
+	if cf.decimals > 0 {
+		frac := scaled % int64(math.Pow10(cf.decimals))
+		out += cf.decimal + fmt.Sprintf("%0*d", cf.decimals, frac)
+	}
+	out = cf.symbol + " " + out
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
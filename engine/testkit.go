@@ -0,0 +1,322 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowly/testkit"
+)
+
+// ---------------------
+// flowly test (conversaciones de prueba del flow)
+// ---------------------
+// Cada archivo de configs/{tenant}/tests/*.json es una conversación: lo que manda el usuario
+// y lo que se espera después de cada mensaje (el estado de la sesión, variables y los mensajes
+// que mandó el bot). Sirve para correr en CI antes de publicar un cambio del flow:
+//
+//	flowly test -tenant broker
+//	flowly test -tenant broker -run siniestro -v
+//	flowly test configs/broker/tests/cliente_poliza.json
+//
+//	{
+//	  "name": "cliente consulta el estado de su póliza",
+//	  "profile_name": "Ana",
+//	  "steps": [
+//	    { "text": "hola", "state": "MENU",
+//	      "expect": [{ "type": "interactive", "contains": "Soy el asistente" }] },
+//	    { "select": "SOY_CLIENTE", "state": "CLIENT_MENU" },
+//	    { "select": "CLIENT_POLICY_STATUS", "state": "CLIENT_ID_ASK_POLICY", "vars": { "last_selected_id": "CLIENT_POLICY_STATUS" } },
+//	    { "text": "DNI: 30111222", "state": "CLIENT_POLICY_RESULT", "expect": [{ "type": "interactive" }] }
+//	  ]
+//	}
+//
+// Un paso manda uno de: text, select (id de una fila o botón) o payload (quick reply de un
+// template). Después del paso:
+//
+//   - state: el estado en el que quedó la sesión
+//   - vars: variables de la sesión (solo las que se listan; "" = que no exista o esté vacía)
+//   - expect: los mensajes que mandó el bot en ese paso, en orden y todos ([] = ninguno).
+//     type es el de la Graph API (text, interactive, image, template...) y contains un texto
+//     que tiene que aparecer en alguno de sus campos (body, títulos de botones, caption...)
+//
+// Corre en el mismo proceso con la App en memoria (sin DATABASE_URL ni REDIS_URL, aunque
+// estén seteadas) y un FakeWhatsApp (ver flowly/testkit), así que no sale nada a WhatsApp.
+// Lo demás (Calendar, http_action, LLM) sí usa la red si el flow lo usa. Cada archivo es un
+// usuario nuevo (from, o uno sintético). Exit 1 si falla alguna conversación.
+
+const testFixturesDir = "tests"
+
+type flowTest struct {
+	Name        string         `json:"name"`
+	From        string         `json:"from,omitempty"`
+	ProfileName string         `json:"profile_name,omitempty"`
+	Steps       []flowTestStep `json:"steps"`
+}
+
+type flowTestStep struct {
+	Text    string `json:"text,omitempty"`
+	Select  string `json:"select,omitempty"`
+	Payload string `json:"payload,omitempty"`
+
+	State  string             `json:"state,omitempty"`
+	Vars   map[string]string  `json:"vars,omitempty"`
+	Expect *[]flowTestMessage `json:"expect,omitempty"`
+}
+
+type flowTestMessage struct {
+	Type     string `json:"type,omitempty"`
+	Contains string `json:"contains,omitempty"`
+}
+
+func runTest(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	tenantFlag := fs.String("tenant", "", "tenant (default: todos los que tienen configs/{tenant}/tests)")
+	run := fs.String("run", "", "solo las conversaciones cuyo archivo o name matcheen esta regexp")
+	verbose := fs.Bool("v", false, "mostrar el log del engine")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var filter *regexp.Regexp
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-run inválido: %v\n", err)
+			return 2
+		}
+		filter = re
+	}
+
+	files, err := flowTestFiles(*tenantFlag, fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no hay conversaciones de prueba (configs/{tenant}/tests/*.json)")
+		return 1
+	}
+
+	// Todo en memoria: una prueba no escribe en la base ni avisa a otras réplicas
+	os.Unsetenv("DATABASE_URL")
+	os.Unsetenv("REDIS_URL")
+	os.Setenv("INBOUND_RATE_LIMIT_PER_MIN", "0")
+	if os.Getenv("WHATSAPP_TOKEN") == "" {
+		os.Setenv("WHATSAPP_TOKEN", "test")
+	}
+	if os.Getenv("PUBLIC_BASE_URL") == "" {
+		os.Setenv("PUBLIC_BASE_URL", "https://flowly.test")
+	}
+	if *verbose {
+		log.SetOutput(os.Stderr)
+	} else {
+		log.SetOutput(io.Discard)
+	}
+	defer log.SetOutput(os.Stderr)
+
+	app, err := NewApp()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fake := testkit.NewFakeWhatsApp()
+	app.waTransport = fake
+
+	failed, ran := 0, 0
+	for i, f := range files {
+		tenant, test, err := readFlowTest(f)
+		if err != nil {
+			fmt.Printf("%s: ERROR %v\n", f, err)
+			failed++
+			continue
+		}
+		if filter != nil && !filter.MatchString(f) && !filter.MatchString(test.Name) {
+			continue
+		}
+		ran++
+		if test.From == "" {
+			test.From = strconv.Itoa(5490000000000 + i)
+		}
+		if errs := app.runFlowTest(context.Background(), fake, tenant, test, i); len(errs) > 0 {
+			failed++
+			fmt.Printf("%s: FAIL %s\n", f, test.Name)
+			for _, e := range errs {
+				fmt.Printf("    %s\n", e)
+			}
+			continue
+		}
+		fmt.Printf("%s: OK %s (%d pasos)\n", f, test.Name, len(test.Steps))
+	}
+	fmt.Printf("%d conversaciones, %d fallaron\n", ran, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// flowTestFiles devuelve los archivos pedidos, o los de tests/ del tenant (o de todos).
+func flowTestFiles(tenant string, args []string) ([]string, error) {
+	if len(args) > 0 {
+		return args, nil
+	}
+	pattern := filepath.Join(ConfigRoot, "*", testFixturesDir, "*.json")
+	if tenant != "" {
+		pattern = filepath.Join(ConfigRoot, tenant, testFixturesDir, "*.json")
+	}
+	files, err := filepath.Glob(pattern)
+	sort.Strings(files)
+	return files, err
+}
+
+// readFlowTest lee una conversación; el tenant sale de configs/{tenant}/tests/.
+func readFlowTest(p string) (string, flowTest, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", flowTest{}, err
+	}
+	var t flowTest
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return "", flowTest{}, fmt.Errorf("json inválido: %v", err)
+	}
+	if len(t.Steps) == 0 {
+		return "", flowTest{}, fmt.Errorf("no tiene steps")
+	}
+	for i, s := range t.Steps {
+		n := 0
+		for _, v := range []string{s.Text, s.Select, s.Payload} {
+			if v != "" {
+				n++
+			}
+		}
+		if n != 1 {
+			return "", flowTest{}, fmt.Errorf("steps[%d]: tiene que mandar uno de text, select o payload", i)
+		}
+	}
+	if t.Name == "" {
+		t.Name = strings.TrimSuffix(filepath.Base(p), ".json")
+	}
+	return filepath.Base(filepath.Dir(filepath.Dir(p))), t, nil
+}
+
+// runFlowTest corre la conversación y devuelve lo que no coincidió (con el paso).
+func (a *App) runFlowTest(ctx context.Context, fake *testkit.FakeWhatsApp, tenant string, t flowTest, seq int) []string {
+	phoneID, ok := a.resolver.PhoneNumberID(tenant)
+	if !ok {
+		phoneID = "test"
+	}
+	client, err := a.tenantWhatsAppClient(phoneID, tenant)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var errs []string
+	for i, step := range t.Steps {
+		sent := len(fake.MessagesTo(t.From))
+		a.handleIncoming(ctx, tenant, client, flowTestMessageFor(t.From, step, seq, i), t.ProfileName)
+		out := fake.MessagesTo(t.From)[sent:]
+
+		where := fmt.Sprintf("paso %d (%s)", i+1, step.input())
+		sess, _ := a.sessions.Get(tenant + ":" + t.From)
+		if step.State != "" && sess.State != step.State {
+			errs = append(errs, fmt.Sprintf("%s: quedó en %s, se esperaba %s", where, sess.State, step.State))
+		}
+		for _, k := range sortedKeys(step.Vars) {
+			if got := sess.Data[k]; got != step.Vars[k] {
+				errs = append(errs, fmt.Sprintf("%s: %s=%q, se esperaba %q", where, k, got, step.Vars[k]))
+			}
+		}
+		if step.Expect != nil {
+			errs = append(errs, checkFlowTestMessages(where, *step.Expect, out)...)
+		}
+		if len(errs) > 0 {
+			return errs // los pasos siguientes dependen de este
+		}
+	}
+	return nil
+}
+
+func (s flowTestStep) input() string {
+	switch {
+	case s.Select != "":
+		return "select " + s.Select
+	case s.Payload != "":
+		return "payload " + s.Payload
+	}
+	return strconv.Quote(truncateRunes(s.Text, 40))
+}
+
+func flowTestMessageFor(from string, s flowTestStep, seq, i int) IncomingMessage {
+	msg := IncomingMessage{
+		From:      from,
+		ID:        fmt.Sprintf("wamid.test.%d.%d.%d", time.Now().UnixNano(), seq, i),
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	switch {
+	case s.Select != "":
+		msg.Type = "interactive"
+		msg.Interactive = &IncomingInteractive{Type: "list_reply", ListReply: &IncomingListReply{ID: s.Select, Title: s.Select}}
+	case s.Payload != "":
+		msg.Type = "button"
+		msg.Button = &struct {
+			Payload string `json:"payload"`
+			Text    string `json:"text"`
+		}{Payload: s.Payload, Text: s.Payload}
+	default:
+		msg.Type = "text"
+		msg.Text = &IncomingText{Body: s.Text}
+	}
+	return msg
+}
+
+func checkFlowTestMessages(where string, want []flowTestMessage, got []testkit.FakeMessage) []string {
+	var errs []string
+	if len(got) != len(want) {
+		types := make([]string, len(got))
+		for i, m := range got {
+			types[i] = m.Type
+		}
+		errs = append(errs, fmt.Sprintf("%s: el bot mandó %d mensaje(s) [%s], se esperaban %d", where, len(got), strings.Join(types, ", "), len(want)))
+	}
+	for i, w := range want {
+		if i >= len(got) {
+			break
+		}
+		m := got[i]
+		if w.Type != "" && m.Type != w.Type {
+			errs = append(errs, fmt.Sprintf("%s: mensaje %d es %s, se esperaba %s", where, i+1, m.Type, w.Type))
+		}
+		if w.Contains != "" && !strings.Contains(strings.Join(payloadTexts(m.Payload), "\n"), w.Contains) {
+			errs = append(errs, fmt.Sprintf("%s: mensaje %d no contiene %q", where, i+1, w.Contains))
+		}
+	}
+	return errs
+}
+
+// payloadTexts junta los strings de un payload saliente (body, títulos, caption...).
+func payloadTexts(v any) []string {
+	var out []string
+	switch x := v.(type) {
+	case string:
+		out = append(out, x)
+	case map[string]any:
+		for _, k := range sortedKeys(x) {
+			out = append(out, payloadTexts(x[k])...)
+		}
+	case []any:
+		for _, item := range x {
+			out = append(out, payloadTexts(item)...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ---------------------
+// Matching de texto libre (keywords)
+// ---------------------
+// Las keywords se comparan normalizadas (normalizeKeyword: minúsculas, sin acentos, sin
+// signos ni emojis), así que "Menú", "MENU!" y "menu 👋" son lo mismo. Un estado puede
+// rutear texto libre por keyword:
+//
+//	"ASK_TOPIC": {
+//	  "type": "text", "body": "¿Sobre qué querés consultar?",
+//	  "on_keyword_next": { "precios": "PRICES", "turno": "BOOK_SLOTS", "humano": "HANDOFF" },
+//	  "on_text_next": "AI_ANSWER"
+//	}
+//
+// Con "text_match" en el flow el matching es más permisivo (aplica a on_keyword_next y a
+// global_commands, no a las palabras de baja):
+//
+//	"text_match": { "contains": true, "fuzzy": true, "max_typos": 1 }
+//
+// - contains: la keyword puede estar dentro de una frase ("quiero el menu")
+// - fuzzy: tolera errores de tipeo ("mneu", "presios"); keywords de menos de 4 letras no
+// - max_typos: distancia máxima (default: 1 hasta 6 letras, 2 para las más largas)
+//
+// Gana la coincidencia exacta; después la keyword más larga contenida; después la de menor
+// distancia.
+
+const minFuzzyKeywordLen = 4
+
+type FlowTextMatch struct {
+	Contains bool `json:"contains,omitempty"`
+	Fuzzy    bool `json:"fuzzy,omitempty"`
+	MaxTypos int  `json:"max_typos,omitempty"`
+}
+
+func validateTextMatch(cfg FlowConfig) []string {
+	tm := cfg.TextMatch
+	if tm == nil {
+		return nil
+	}
+	var errs []string
+	if tm.MaxTypos < 0 || tm.MaxTypos > 3 {
+		errs = append(errs, fmt.Sprintf("text_match.max_typos tiene que estar entre 0 y 3 (es %d)", tm.MaxTypos))
+	}
+	if tm.MaxTypos > 0 && !tm.Fuzzy {
+		errs = append(errs, "text_match.max_typos requiere fuzzy: true")
+	}
+	return errs
+}
+
+func validateKeywordTransitions(cfg FlowConfig, stateName string, st FlowState) []string {
+	var errs []string
+	seen := make(map[string]string)
+	for _, kw := range sortedKeys(st.OnKeywordNext) {
+		norm := normalizeKeyword(kw)
+		if norm == "" {
+			errs = append(errs, fmt.Sprintf("state=%s on_keyword_next: keyword vacía: %q", stateName, kw))
+			continue
+		}
+		if other, dup := seen[norm]; dup {
+			errs = append(errs, fmt.Sprintf("state=%s on_keyword_next: %q y %q son la misma keyword", stateName, other, kw))
+		}
+		seen[norm] = kw
+		if next := st.OnKeywordNext[kw]; next != previousState {
+			if _, ok := cfg.States[next]; !ok {
+				errs = append(errs, fmt.Sprintf("state=%s on_keyword_next[%q] apunta a un estado inexistente: %q", stateName, kw, next))
+			}
+		}
+	}
+	return errs
+}
+
+// matchKeyword devuelve la keyword (tal cual está en keywords) que corresponde al texto.
+// Con tm nil solo vale la igualdad normalizada.
+func (tm *FlowTextMatch) matchKeyword(keywords []string, text string) (string, bool) {
+	norm := normalizeKeyword(text)
+	if norm == "" || len(keywords) == 0 {
+		return "", false
+	}
+	for _, kw := range keywords {
+		if normalizeKeyword(kw) == norm {
+			return kw, true
+		}
+	}
+	if tm == nil {
+		return "", false
+	}
+
+	if tm.Contains {
+		best, bestLen := "", 0
+		padded := " " + norm + " "
+		for _, kw := range keywords {
+			k := normalizeKeyword(kw)
+			if k != "" && len(k) > bestLen && strings.Contains(padded, " "+k+" ") {
+				best, bestLen = kw, len(k)
+			}
+		}
+		if best != "" {
+			return best, true
+		}
+	}
+
+	if tm.Fuzzy {
+		best, bestDist := "", -1
+		words := strings.Fields(norm)
+		for _, kw := range keywords {
+			k := normalizeKeyword(kw)
+			if len(k) < minFuzzyKeywordLen {
+				continue
+			}
+			candidates := []string{norm}
+			if tm.Contains {
+				candidates = keywordWindows(words, len(strings.Fields(k)))
+			}
+			for _, c := range candidates {
+				d := editDistance(k, c)
+				if d <= tm.maxTypos(k) && (bestDist < 0 || d < bestDist) {
+					best, bestDist = kw, d
+				}
+			}
+		}
+		if best != "" {
+			return best, true
+		}
+	}
+	return "", false
+}
+
+func (tm *FlowTextMatch) maxTypos(kw string) int {
+	if tm.MaxTypos > 0 {
+		return tm.MaxTypos
+	}
+	if len(kw) <= 6 {
+		return 1
+	}
+	return 2
+}
+
+// keywordWindows arma los grupos de n palabras seguidas del texto.
+func keywordWindows(words []string, n int) []string {
+	if n <= 0 || len(words) <= n {
+		return []string{strings.Join(words, " ")}
+	}
+	out := make([]string, 0, len(words)-n+1)
+	for i := 0; i+n <= len(words); i++ {
+		out = append(out, strings.Join(words[i:i+n], " "))
+	}
+	return out
+}
+
+// editDistance: distancia de edición entre a y b (por runa), contando el cambio de dos letras
+// vecinas como un solo error ("mneu" -> "menu").
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,79 @@
+package engine
+
+import "testing"
+
+func TestMatchKeyword(t *testing.T) {
+	exact := (*FlowTextMatch)(nil)
+	fuzzy := &FlowTextMatch{Fuzzy: true}
+	both := &FlowTextMatch{Contains: true, Fuzzy: true}
+	strict := &FlowTextMatch{Fuzzy: true, MaxTypos: 1}
+	keywords := []string{"hablar con humano", "menú", "precios", "turno", "ver"}
+
+	tests := []struct {
+		name     string
+		tm       *FlowTextMatch
+		keywords []string
+		text     string
+		want     string // "" = sin match
+	}{
+		// Acentos, mayúsculas, signos y emojis no cuentan
+		{"acento en el texto", exact, keywords, "Menu", "menú"},
+		{"acento en la keyword", exact, []string{"menu"}, "MENÚ!!", "menu"},
+		{"emoji y espacios", exact, keywords, "  menu 👋 ", "menú"},
+		{"ñ y diéresis", exact, []string{"señá", "pingüino"}, "SENA", "señá"},
+		{"sin text_match no hay fuzzy", exact, keywords, "mneu", ""},
+		{"sin text_match no hay contains", exact, keywords, "quiero el menu", ""},
+		{"vacío", fuzzy, keywords, "👋", ""},
+
+		// Errores de tipeo: hasta 1 con 6 letras o menos, 2 con más
+		{"letras cambiadas", fuzzy, keywords, "mneu", "menú"},
+		{"una letra de más", fuzzy, keywords, "preecios", "precios"},
+		{"una letra cambiada", fuzzy, keywords, "presios", "precios"},
+		{"dos errores en 7 letras", fuzzy, keywords, "presioz", "precios"},
+		{"tres errores en 7 letras", fuzzy, keywords, "presiozz", ""},
+		{"dos errores en 5 letras", fuzzy, keywords, "tirnp", ""},
+		{"un error en 5 letras", fuzzy, keywords, "turmo", "turno"},
+		{"keyword corta sin fuzzy", fuzzy, keywords, "vr", ""},
+		{"max_typos pisa el default", strict, keywords, "presioz", ""},
+
+		// Dentro de una frase
+		{"contains", both, keywords, "quiero ver los precios", "precios"},
+		{"contains sin palabras a medias", both, []string{"ver"}, "verano", ""},
+		{"contains con typo", both, keywords, "quiero un trno", "turno"},
+		{"gana la más larga", both, keywords, "ver hablar con humano", "hablar con humano"},
+		{"keyword de varias palabras con typo", both, keywords, "quiero ablar con humano", "hablar con humano"},
+
+		// Desempates: exacta, después la de menor distancia, después la primera de la lista
+		{"exacta antes que fuzzy", fuzzy, []string{"casas", "casa"}, "casa", "casa"},
+		{"menor distancia", fuzzy, []string{"pesos", "pisos"}, "pisoss", "pisos"},
+		{"empate: la primera", fuzzy, []string{"pasos", "pesos"}, "pisos", "pasos"},
+		{"empate: la primera (otro orden)", fuzzy, []string{"pesos", "pasos"}, "pisos", "pesos"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.tm.matchKeyword(tt.keywords, tt.text)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("matchKeyword(%q) = %q, %v; se esperaba %q", tt.text, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"menu", "menu", 0},
+		{"menu", "mneu", 1}, // transposición
+		{"menu", "men", 1},
+		{"precios", "presioz", 2},
+		{"turno", "", 5},
+		{"año", "ano", 1}, // por runa, no por byte
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, se esperaba %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
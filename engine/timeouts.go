@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Timeouts por estado (inactividad)
+// ---------------------
+// Si el usuario queda callado en un estado, a los N minutos la sesión pasa sola a
+// on_timeout_next: un "¿Seguís ahí?" o directamente el cierre de la conversación. El estado
+// destino puede tener su propio timeout, así se encadena nudge -> auto-cierre.
+//
+//	"SELECT_DATE": {
+//	  ...
+//	  "timeout_minutes": 30,
+//	  "on_timeout_next": "NUDGE_DATE",
+//	  "timeout_template": { "name": "seguis_ahi", "language": "es_AR", "body_params": ["{{name}}"] }
+//	},
+//	"NUDGE_DATE": { "type": "text", "body": "¿Seguís ahí? ...", "timeout_minutes": 120, "on_timeout_next": "CLOSED" }
+//
+// Dentro de la ventana de 24h desde el último mensaje del usuario se manda el estado
+// destino. Fuera de la ventana Meta solo acepta templates: si hay timeout_template se manda
+// ese template y la sesión queda en on_timeout_next; si no, la sesión se mueve sin mandar nada.
+// Cada mensaje entrante reprograma el timer (queda uno por usuario). Solo WhatsApp.
+
+const (
+	stateTimeoutJobKind    = "state_timeout"
+	maxStateTimeoutMinutes = 7 * 24 * 60
+	lastInboundVar         = "_last_inbound_at"
+	customerServiceWindow  = 24 * time.Hour
+)
+
+type FlowTimeoutTemplate struct {
+	Name       string   `json:"name"`
+	Language   string   `json:"language,omitempty"`    // default es_AR
+	BodyParams []string `json:"body_params,omitempty"` // soportan {{vars}} de la sesión
+}
+
+// sendFlowTemplate manda un template del flow con los body_params renderizados.
+func sendFlowTemplate(ctx context.Context, c *wa.Client, to string, tpl FlowTimeoutTemplate, vars map[string]string) (string, error) {
+	lang := tpl.Language
+	if lang == "" {
+		lang = defaultTemplateLang
+	}
+	params := make([]string, len(tpl.BodyParams))
+	for i, p := range tpl.BodyParams {
+		params[i] = renderVars(p, vars)
+	}
+	return c.SendTemplate(ctx, to, tpl.Name, lang, params, nil)
+}
+
+func validateStateTimeout(cfg FlowConfig, stateName string, st FlowState) []string {
+	if st.TimeoutMinutes == 0 && st.OnTimeoutNext == "" && st.TimeoutTemplate == nil {
+		return nil
+	}
+	var errs []string
+	if st.TimeoutMinutes < 1 || st.TimeoutMinutes > maxStateTimeoutMinutes {
+		errs = append(errs, fmt.Sprintf("state=%s timeout_minutes fuera de rango (1..%d)", stateName, maxStateTimeoutMinutes))
+	}
+	if _, ok := cfg.States[st.OnTimeoutNext]; !ok {
+		errs = append(errs, fmt.Sprintf("state=%s on_timeout_next apunta a un estado inexistente: %q", stateName, st.OnTimeoutNext))
+	}
+	if st.TimeoutTemplate != nil && st.TimeoutTemplate.Name == "" {
+		errs = append(errs, fmt.Sprintf("state=%s timeout_template sin name", stateName))
+	}
+	return errs
+}
+
+// scheduleStateTimeout reemplaza el timer del usuario por el del estado en el que quedó la
+// sesión (si lo tiene).
+func (a *App) scheduleStateTimeout(tenant, waID string, client MessageSender, cfg FlowConfig, sess UserSession) {
+	if _, err := a.jobs.Cancel(stateTimeoutJobKind, tenant, waID); err != nil {
+		log.Printf("ERROR cancelando timeout previo wa_id=%s: %v", waID, err)
+	}
+	st := cfg.States[sess.State]
+	if st.TimeoutMinutes <= 0 || st.OnTimeoutNext == "" {
+		return
+	}
+	wc, ok := client.(*wa.Client)
+	if !ok {
+		return
+	}
+	_, err := a.jobs.Enqueue(Job{
+		Kind:   stateTimeoutJobKind,
+		Tenant: tenant,
+		WaID:   waID,
+		Ref:    waID,
+		RunAt:  sess.UpdatedAt.Add(time.Duration(st.TimeoutMinutes) * time.Minute),
+		Payload: map[string]string{
+			"phone_id":   wc.PhoneID,
+			"state":      sess.State,
+			"entered_at": sess.UpdatedAt.Format(time.RFC3339Nano),
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR programando timeout wa_id=%s: %v", waID, err)
+	}
+}
+
+// inServiceWindow indica si el usuario escribió en las últimas 24h.
+func inServiceWindow(sess UserSession, now time.Time) bool {
+	last, err := time.Parse(time.RFC3339, sess.Data[lastInboundVar])
+	if err != nil {
+		return false
+	}
+	return now.Sub(last) < customerServiceWindow
+}
+
+func jobRunStateTimeout(ctx context.Context, a *App, job Job) error {
+	defer a.userLocks.Lock(ctx, job.Tenant, job.WaID)()
+	sessKey := job.Tenant + ":" + job.WaID
+	sess, ok := a.sessions.Get(sessKey)
+	if !ok {
+		return nil
+	}
+	enteredAt, err := time.Parse(time.RFC3339Nano, job.Payload["entered_at"])
+	if err != nil {
+		return fmt.Errorf("entered_at inválido en job: %w", err)
+	}
+	// Respondió o se movió a otro estado: no hay nada que hacer
+	if sess.State != job.Payload["state"] || sess.UpdatedAt.Sub(enteredAt) > time.Second || sessionPaused(sess) {
+		return nil
+	}
+	if out, err := a.skipOptedOut(job.Tenant, job.WaID); err != nil || out {
+		return err
+	}
+
+	cfg, err := a.cache.LoadVersion(job.Tenant, sess.Data[flowVersionVar])
+	if err != nil {
+		return err
+	}
+	st := cfg.States[sess.State]
+	if st.OnTimeoutNext == "" {
+		return nil
+	}
+
+	phoneID := job.Payload["phone_id"]
+	if phoneID == "" {
+		if phoneID, ok = a.resolver.PhoneNumberID(job.Tenant); !ok {
+			return fmt.Errorf("no hay phone_number_id configurado para el tenant %s", job.Tenant)
+		}
+	}
+	waClient, err := a.whatsAppClient(phoneID)
+	if err != nil {
+		return err
+	}
+
+	vars := map[string]string{"wa_id": job.WaID}
+	for k, v := range sess.Data {
+		vars[k] = v
+	}
+	inWindow := inServiceWindow(sess, time.Now())
+	next := st.OnTimeoutNext
+	if inWindow {
+		next = a.resolveTransientStates(ctx, job.Tenant, cfg, next, &sess, vars)
+	}
+
+	prevState := sess.State
+	sess.State = next
+	sess.UpdatedAt = time.Now()
+	a.recordTransition(job.Tenant, cfg, prevState, &sess, job.WaID)
+	a.sessions.Set(sessKey, sess)
+
+	switch {
+	case inWindow:
+		log.Printf("⏰ tenant=%s wa_id=%s sin respuesta en %s, paso a %s", job.Tenant, job.WaID, prevState, next)
+		if err := a.renderer.RenderAndSend(ctx, job.Tenant, next, waClient, job.WaID, vars); err != nil {
+			return err
+		}
+	case st.TimeoutTemplate != nil:
+		log.Printf("⏰ tenant=%s wa_id=%s fuera de la ventana de 24h, mando template %s y paso a %s", job.Tenant, job.WaID, st.TimeoutTemplate.Name, next)
+		if _, err := sendFlowTemplate(ctx, waClient, job.WaID, *st.TimeoutTemplate, vars); err != nil {
+			return err
+		}
+	default:
+		log.Printf("⏰ tenant=%s wa_id=%s fuera de la ventana de 24h, paso a %s sin mandar nada", job.Tenant, job.WaID, next)
+	}
+
+	a.scheduleStateTimeout(job.Tenant, job.WaID, waClient, cfg, sess)
+	return nil
+}
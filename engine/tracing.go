@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ---------------------
+// Tracing (OpenTelemetry)
+// ---------------------
+// Spans del webhook, el engine del flow (mensaje, acción, render), los envíos a Meta y la
+// agenda; además el cliente HTTP compartido agrega un span por request saliente. Con eso
+// una respuesta lenta se puede seguir hasta la llamada a la Graph API o al Calendar que la
+// demoró. Los wa_id van hasheados (flowly.wa_id_hash), nunca en claro.
+//
+// Se exporta por OTLP/HTTP con las variables estándar de OpenTelemetry; sin endpoint, el
+// tracing queda apagado (tracer no-op).
+//
+// ENV:
+//
+//	OTEL_EXPORTER_OTLP_ENDPOINT=http://otel-collector:4318
+//	OTEL_EXPORTER_OTLP_HEADERS=authorization=Bearer ...
+//	OTEL_SERVICE_NAME=flowly
+//	OTEL_TRACES_SAMPLER=parentbased_traceidratio  OTEL_TRACES_SAMPLER_ARG=0.2
+
+var tracer = otel.Tracer("flowly")
+
+// initTracing configura el exporter OTLP si hay endpoint. Devuelve la función para hacer
+// flush al apagar.
+func initTracing(ctx context.Context) func(context.Context) error {
+	noop := func(context.Context) error { return nil }
+	if strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")) == "" &&
+		strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")) == "" {
+		return noop
+	}
+
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Printf("ERROR iniciando exporter OTLP, sigo sin tracing: %v", err)
+		return noop
+	}
+	attrs := []attribute.KeyValue{}
+	if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		attrs = append(attrs, attribute.String("service.name", "flowly"))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		res = resource.Default()
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Printf("🔭 Tracing OTLP habilitado")
+	return tp.Shutdown
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan cierra el span marcándolo con error si hubo uno.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// hashWaID identifica al usuario en los spans sin exponer el teléfono.
+func hashWaID(waID string) string {
+	sum := sha256.Sum256([]byte(waID))
+	return hex.EncodeToString(sum[:8])
+}
+
+func userAttrs(tenant, waID string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("flowly.tenant", tenant),
+		attribute.String("flowly.wa_id_hash", hashWaID(waID)),
+	}
+}
+
+// ---------------------
+// Agenda
+// ---------------------
+
+// tracedBookingProvider envuelve un proveedor de agenda con spans por llamada.
+type tracedBookingProvider struct {
+	calendar.Provider
+	tenant string
+}
+
+func traceBookingProvider(tenant string, p calendar.Provider) calendar.Provider {
+	return &tracedBookingProvider{Provider: p, tenant: tenant}
+}
+
+func (t *tracedBookingProvider) GetNextAvailableSlots(ctx context.Context, resourceID string, duration time.Duration, offset, limit int) ([]calendar.Slot, bool, error) {
+	ctx, span := startSpan(ctx, "calendar.slots",
+		attribute.String("flowly.tenant", t.tenant),
+		attribute.String("calendar.resource", resourceID),
+		attribute.Int("calendar.offset", offset),
+	)
+	slots, more, err := t.Provider.GetNextAvailableSlots(ctx, resourceID, duration, offset, limit)
+	span.SetAttributes(attribute.Int("calendar.slots", len(slots)))
+	endSpan(span, err)
+	return slots, more, err
+}
+
+func (t *tracedBookingProvider) CreateAppointment(ctx context.Context, req calendar.AppointmentRequest) (calendar.Appointment, error) {
+	ctx, span := startSpan(ctx, "calendar.create_appointment",
+		attribute.String("flowly.tenant", t.tenant),
+		attribute.String("calendar.resource", req.ResourceID),
+	)
+	appt, err := t.Provider.CreateAppointment(ctx, req)
+	endSpan(span, err)
+	return appt, err
+}
+
+func (t *tracedBookingProvider) CancelAppointment(ctx context.Context, eventID string) error {
+	ctx, span := startSpan(ctx, "calendar.cancel_appointment", attribute.String("flowly.tenant", t.tenant))
+	err := t.Provider.CancelAppointment(ctx, eventID)
+	endSpan(span, err)
+	return err
+}
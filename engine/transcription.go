@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Transcripción de notas de voz
+// ---------------------
+// Con "transcription" en el flow.json, los audios entrantes se bajan de Meta, se transcriben
+// y siguen por el flow como si el usuario hubiera escrito el texto (intents, on_text_next,
+// forms, ai_fallback...):
+//
+//	"transcription": {
+//	  "provider": "whisper",          // whisper (default) | google
+//	  "language": "es",
+//	  "echo": true,                   // le responde "🎙️ Entendí: ..." antes de seguir
+//	  "error_text": "No pude escuchar el audio, ¿me lo escribís?"
+//	}
+//
+// La transcripción queda en la variable audio_transcript. Sin config, los audios se ignoran
+// como antes.
+//
+// ENV:
+//
+//	AI_API_KEY / AI_API_BASE_URL               (whisper: endpoint compatible con OpenAI)
+//	TRANSCRIPTION_MODEL=whisper-1
+//	GOOGLE_SPEECH_API_KEY=...                  (google: Speech-to-Text v1)
+
+const (
+	transcriptionWhisper = "whisper"
+	transcriptionGoogle  = "google"
+
+	audioTranscriptVar       = "audio_transcript"
+	defaultTranscriptionLang = "es"
+	defaultTranscriptionErr  = "Perdón, no pude escuchar el audio 🙉 ¿Me lo escribís?"
+	maxAudioBytes            = 16 << 20 // tope de WhatsApp para audios
+	transcriptionTimeout     = 30 * time.Second
+)
+
+type FlowTranscription struct {
+	Enabled   *bool  `json:"enabled,omitempty"` // default true
+	Provider  string `json:"provider,omitempty"`
+	Language  string `json:"language,omitempty"`
+	Echo      bool   `json:"echo,omitempty"`
+	ErrorText string `json:"error_text,omitempty"`
+}
+
+type IncomingMedia struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	Voice    bool   `json:"voice,omitempty"` // nota de voz grabada en el chat
+}
+
+// Transcriber pasa un audio a texto.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, mimeType, language string) (string, error)
+}
+
+// NewTranscribersFromEnv arma los proveedores que tienen credenciales.
+func NewTranscribersFromEnv(httpClient *http.Client) map[string]Transcriber {
+	out := make(map[string]Transcriber)
+	if key := strings.TrimSpace(os.Getenv("AI_API_KEY")); key != "" {
+		base := strings.TrimRight(strings.TrimSpace(os.Getenv("AI_API_BASE_URL")), "/")
+		if base == "" {
+			base = defaultAIBaseURL
+		}
+		model := strings.TrimSpace(os.Getenv("TRANSCRIPTION_MODEL"))
+		if model == "" {
+			model = "whisper-1"
+		}
+		out[transcriptionWhisper] = &whisperTranscriber{baseURL: base, apiKey: key, model: model, httpClient: httpClient}
+	}
+	if key := strings.TrimSpace(os.Getenv("GOOGLE_SPEECH_API_KEY")); key != "" {
+		out[transcriptionGoogle] = &googleSpeechTranscriber{apiKey: key, httpClient: httpClient}
+	}
+	return out
+}
+
+func (t *FlowTranscription) enabled() bool {
+	return t != nil && (t.Enabled == nil || *t.Enabled)
+}
+
+func (t *FlowTranscription) provider() string {
+	if t.Provider == "" {
+		return transcriptionWhisper
+	}
+	return t.Provider
+}
+
+func validateTranscription(cfg FlowConfig) []string {
+	t := cfg.Transcription
+	if t == nil {
+		return nil
+	}
+	if p := t.provider(); p != transcriptionWhisper && p != transcriptionGoogle {
+		return []string{fmt.Sprintf("transcription.provider no soportado: %q (whisper | google)", t.Provider)}
+	}
+	return nil
+}
+
+// transcribeIncoming convierte una nota de voz en un mensaje de texto. Devuelve ok=false si
+// el audio no se pudo transcribir (ya le avisó al usuario) y no hay que seguir con el flow.
+func (a *App) transcribeIncoming(ctx context.Context, tenant string, cfg FlowConfig, client MessageSender, msg *IncomingMessage, vars map[string]string) bool {
+	t := cfg.Transcription
+	if msg.Type != "audio" || msg.Audio == nil || !t.enabled() {
+		return true
+	}
+	errText := t.ErrorText
+	if errText == "" {
+		errText = defaultTranscriptionErr
+	}
+	fail := func(err error) bool {
+		log.Printf("❌ transcripción tenant=%s wa_id=%s: %v", tenant, msg.From, err)
+		_ = client.SendText(ctx, msg.From, errText)
+		return false
+	}
+
+	tr, ok := a.speech[t.provider()]
+	if !ok {
+		return fail(fmt.Errorf("proveedor %s sin credenciales", t.provider()))
+	}
+	wc, ok := client.(*wa.Client)
+	if !ok {
+		return fail(fmt.Errorf("el canal no permite bajar audios"))
+	}
+
+	// Timeout propio: si se agota, el aviso al usuario sale igual con el ctx del webhook
+	tctx, cancel := context.WithTimeout(ctx, transcriptionTimeout)
+	defer cancel()
+
+	audio, mimeType, err := wc.DownloadMedia(tctx, msg.Audio.ID, maxAudioBytes)
+	if err != nil {
+		return fail(err)
+	}
+	if mimeType == "" {
+		mimeType = msg.Audio.MimeType
+	}
+	lang := t.Language
+	if lang == "" {
+		lang = defaultTranscriptionLang
+	}
+	text, err := tr.Transcribe(tctx, audio, mimeType, lang)
+	if err != nil {
+		return fail(err)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fail(fmt.Errorf("transcripción vacía"))
+	}
+
+	log.Printf("🎙️ Audio de %s transcripto (%s)", msg.From, t.provider())
+	debugf("🎙️ Transcripción de %s: %q", msg.From, text)
+	msg.Type = "text"
+	msg.Text = &IncomingText{Body: text}
+	vars[audioTranscriptVar] = text
+	if t.Echo {
+		_ = client.SendText(ctx, msg.From, "🎙️ Entendí: "+text)
+	}
+	return true
+}
+
+// ---------------------
+// Whisper (OpenAI-compatible /audio/transcriptions)
+// ---------------------
+
+type whisperTranscriber struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+func (w *whisperTranscriber) Transcribe(ctx context.Context, audio []byte, mimeType, language string) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("model", w.model)
+	_ = mw.WriteField("language", language)
+	_ = mw.WriteField("response_format", "json")
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, "audio"+audioExtension(mimeType)))
+	h.Set("Content-Type", mimeType)
+	fw, err := mw.CreatePart(h)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fw.Write(audio); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.baseURL+"/audio/transcriptions", &buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.apiKey)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := httpClientOrShared(w.httpClient).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("respuesta no OK de whisper: %s - %s", resp.Status, string(body))
+	}
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", err
+	}
+	return out.Text, nil
+}
+
+// audioExtension: el endpoint deduce el formato por la extensión del archivo.
+func audioExtension(mimeType string) string {
+	mt, _, _ := strings.Cut(mimeType, ";")
+	switch strings.TrimSpace(mt) {
+	case "audio/ogg", "audio/opus":
+		return ".ogg"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/aac":
+		return ".m4a"
+	case "audio/amr":
+		return ".amr"
+	default:
+		return ".ogg"
+	}
+}
+
+// ---------------------
+// Google Speech-to-Text (v1 speech:recognize)
+// ---------------------
+
+type googleSpeechTranscriber struct {
+	apiKey     string
+	httpClient *http.Client
+}
+
+// googleSpeechLocales: el código corto del flow al locale que pide Google.
+var googleSpeechLocales = map[string]string{"es": "es-AR", "pt": "pt-BR", "en": "en-US"}
+
+func (g *googleSpeechTranscriber) Transcribe(ctx context.Context, audio []byte, mimeType, language string) (string, error) {
+	locale := language
+	if l, ok := googleSpeechLocales[language]; ok {
+		locale = l
+	}
+	config := map[string]any{"languageCode": locale, "enableAutomaticPunctuation": true}
+	if strings.HasPrefix(mimeType, "audio/ogg") {
+		// Las notas de voz de WhatsApp son Opus en OGG a 16 kHz
+		config["encoding"] = "OGG_OPUS"
+		config["sampleRateHertz"] = 16000
+	}
+	b, _ := json.Marshal(map[string]any{
+		"config": config,
+		"audio":  map[string]any{"content": base64.StdEncoding.EncodeToString(audio)},
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://speech.googleapis.com/v1/speech:recognize?key="+g.apiKey, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClientOrShared(g.httpClient).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("respuesta no OK de Google Speech: %s - %s", resp.Status, string(body))
+	}
+	var out struct {
+		Results []struct {
+			Alternatives []struct {
+				Transcript string `json:"transcript"`
+			} `json:"alternatives"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(out.Results))
+	for _, r := range out.Results {
+		if len(r.Alternatives) > 0 {
+			parts = append(parts, strings.TrimSpace(r.Alternatives[0].Transcript))
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
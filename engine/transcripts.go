@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"flowly/calendar"
+)
+
+// ---------------------
+// Transcripts
+// ---------------------
+// Auditoría de lo que el bot le dijo a cada cliente, a partir del log de mensajes (Postgres):
+//
+//	GET /admin/tenants/{tenant}/conversations/{wa_id}/transcript?from=2026-03-01&to=2026-03-31&format=text
+//	GET /admin/tenants/{tenant}/conversations/export.csv?from=2026-03-01&to=2026-03-31
+//
+// from/to aceptan RFC3339 o YYYY-MM-DD (en la zona de la agenda; "to" incluye ese día).
+// Sin from: últimos 30 días. format: "json" (default) o "text".
+
+const (
+	defaultTranscriptDays = 30
+	maxTranscriptMessages = 5000
+	maxExportMessages     = 100000
+)
+
+func (a *App) handleAdminTranscript(w http.ResponseWriter, r *http.Request) {
+	if a.store == nil {
+		writeJSONError(w, http.StatusNotImplemented, "las transcripciones requieren DATABASE_URL")
+		return
+	}
+	from, to, err := transcriptRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tenant, waID := r.PathValue("tenant"), r.PathValue("wa_id")
+	msgs, err := a.store.MessagesBetween(tenant, waID, from, to, queryLimit(r, maxTranscriptMessages, maxTranscriptMessages))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"tenant":   tenant,
+			"wa_id":    waID,
+			"from":     from,
+			"to":       to,
+			"count":    len(msgs),
+			"messages": msgs,
+		})
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		loc := calendar.Location()
+		for _, m := range msgs {
+			who := "Cliente"
+			if m.Direction == "out" {
+				who = "Bot"
+			}
+			fmt.Fprintf(w, "[%s] %s: %s\n", m.CreatedAt.In(loc).Format("2006-01-02 15:04:05"), who, transcriptBody(m))
+		}
+	default:
+		writeJSONError(w, http.StatusBadRequest, "format debe ser json o text")
+	}
+}
+
+func (a *App) handleAdminExportConversations(w http.ResponseWriter, r *http.Request) {
+	if a.store == nil {
+		writeJSONError(w, http.StatusNotImplemented, "la exportación requiere DATABASE_URL")
+		return
+	}
+	from, to, err := transcriptRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tenant := r.PathValue("tenant")
+	msgs, err := a.store.MessagesBetween(tenant, r.URL.Query().Get("wa_id"), from, to, maxExportMessages)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("%s_%s_%s.csv", tenant, from.Format("20060102"), to.Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if len(msgs) == maxExportMessages {
+		w.Header().Set("X-Export-Truncated", "true")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"created_at", "wa_id", "direction", "state", "type", "message_id", "body"})
+	for _, m := range msgs {
+		_ = cw.Write([]string{
+			m.CreatedAt.UTC().Format(time.RFC3339),
+			m.WaID,
+			m.Direction,
+			m.State,
+			m.Type,
+			m.MessageID,
+			m.Body,
+		})
+	}
+	cw.Flush()
+}
+
+// transcriptRange lee from/to del query string.
+func transcriptRange(r *http.Request) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	to = time.Now()
+	if v := q.Get("to"); v != "" {
+		if to, err = parseTranscriptTime(v, true); err != nil {
+			return from, to, fmt.Errorf("to inválido: %w", err)
+		}
+	}
+	from = to.AddDate(0, 0, -defaultTranscriptDays)
+	if v := q.Get("from"); v != "" {
+		if from, err = parseTranscriptTime(v, false); err != nil {
+			return from, to, fmt.Errorf("from inválido: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from tiene que ser anterior a to")
+	}
+	return from, to, nil
+}
+
+// parseTranscriptTime acepta RFC3339 o una fecha; con endOfDay la fecha cuenta entera.
+func parseTranscriptTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseInLocation("2006-01-02", v, calendar.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("usar RFC3339 o YYYY-MM-DD: %q", v)
+	}
+	if endOfDay {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d, nil
+}
+
+// transcriptBody muestra el resumen del log en una sola línea.
+func transcriptBody(m MessageLogEntry) string {
+	body := strings.ReplaceAll(m.Body, "\n", " ⏎ ")
+	if body == "" {
+		return "(" + m.Type + ")"
+	}
+	if m.Type != "" && m.Type != "text" {
+		return "(" + m.Type + ") " + body
+	}
+	return body
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ---------------------
+// Alcance de las variables de la sesión
+// ---------------------
+// Cuánto dura cada variable que guarda el flow (respuestas de forms, resultados de
+// acciones, set_vars...) cuando el usuario vuelve a empezar:
+//
+//	"variables": {
+//	  "full_name":    { "scope": "contact", "field": "name" },
+//	  "email":        { "scope": "contact" },
+//	  "carrito":      { "scope": "flow" },
+//	  "plan_elegido": { "scope": "session" }
+//	}
+//
+//   - session (default, también para las que no se declaran): dura lo que la sesión. Sobrevive
+//     a "menu"; se borra con restart o cuando la sesión vence (retention.sessions_days).
+//   - flow: datos de un recorrido. Se borra cada vez que se vuelve al estado de entrada
+//     ("menu", restart, un estado que lleva a MENU).
+//   - contact: se guarda en el perfil del contacto (field, default el nombre de la variable;
+//     ver contact_profiles.go) y vuelve a la sesión cuando arranca de nuevo: sesión nueva,
+//     restart o vuelta al estado de entrada. Editarlo desde la API de contactos también cuenta.
+//
+// name y wa_id no se pueden declarar (salen del mensaje), ni las internas (_...).
+
+const (
+	scopeSession = "session"
+	scopeFlow    = "flow"
+	scopeContact = "contact"
+)
+
+type FlowVariable struct {
+	Scope string `json:"scope"`
+	Field string `json:"field,omitempty"` // solo contact: dato del perfil (name, email, dni o uno libre)
+}
+
+func (v FlowVariable) scope() string {
+	if v.Scope == "" {
+		return scopeSession
+	}
+	return v.Scope
+}
+
+// contactField es el dato del perfil donde se guarda una variable contact.
+func (v FlowVariable) contactField(name string) string {
+	if v.Field != "" {
+		return v.Field
+	}
+	return name
+}
+
+func validateVariables(cfg FlowConfig) []string {
+	var errs []string
+	for _, name := range sortedKeys(cfg.Variables) {
+		v := cfg.Variables[name]
+		switch {
+		case name == "name" || name == "wa_id":
+			errs = append(errs, fmt.Sprintf("variables.%s: es una variable del mensaje, no se puede declarar", name))
+		case strings.HasPrefix(name, "_") || strings.HasPrefix(name, contactVarPrefix) || strings.HasPrefix(name, branchVarPrefix):
+			errs = append(errs, fmt.Sprintf("variables.%s: nombre reservado", name))
+		}
+		switch v.scope() {
+		case scopeSession, scopeFlow:
+			if v.Field != "" {
+				errs = append(errs, fmt.Sprintf("variables.%s: field solo vale con scope contact", name))
+			}
+		case scopeContact:
+			if f := v.contactField(name); f == "tags" || f == "last_seen" {
+				errs = append(errs, fmt.Sprintf("variables.%s: el perfil no guarda %q como dato", name, f))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("variables.%s: scope %q no soportado (session, flow o contact)", name, v.Scope))
+		}
+	}
+	return errs
+}
+
+// restartFlowVars aplica los alcances al volver a empezar: borra las variables flow y trae
+// del perfil las contact que la sesión no tiene.
+func (a *App) restartFlowVars(tenant, waID string, cfg FlowConfig, sess *UserSession, vars map[string]string) {
+	if len(cfg.Variables) == 0 {
+		return
+	}
+	var profile ContactProfile
+	loaded := false
+	for _, name := range sortedKeys(cfg.Variables) {
+		v := cfg.Variables[name]
+		switch v.scope() {
+		case scopeFlow:
+			delete(sess.Data, name)
+			delete(vars, name)
+		case scopeContact:
+			if !loaded {
+				p, _, err := a.contacts.GetContact(tenant, waID)
+				if err != nil {
+					log.Printf("ERROR leyendo perfil de contacto wa_id=%s: %v", waID, err)
+					return
+				}
+				profile, loaded = p, true
+			}
+			if value := profile.Get(v.contactField(name)); value != "" && sess.Data[name] == "" {
+				setSessionVar(sess, vars, name, value)
+			}
+		}
+	}
+}
+
+// saveContactVars guarda en el perfil las variables contact que cambiaron en la sesión (vars
+// trae el perfil como {{contact.*}}, ver loadContactVars).
+func (a *App) saveContactVars(tenant, waID string, cfg FlowConfig, sess UserSession, vars map[string]string) {
+	changed := make(map[string]string)
+	for _, name := range sortedKeys(cfg.Variables) {
+		v := cfg.Variables[name]
+		if v.scope() != scopeContact {
+			continue
+		}
+		field := v.contactField(name)
+		if value := sess.Data[name]; value != "" && value != vars[contactVarPrefix+field] {
+			changed[field] = value
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	if err := a.contacts.UpdateContactFields(tenant, waID, changed); err != nil {
+		log.Printf("ERROR guardando variables en el perfil wa_id=%s: %v", waID, err)
+		return
+	}
+	for field, value := range changed {
+		vars[contactVarPrefix+field] = value
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ---------------------
+// Webhooks por tenant (varias apps de Meta)
+// ---------------------
+// Además de /webhook (una sola app, VERIFY_TOKEN), cada tenant puede tener su propia app de
+// Meta apuntando a /webhook/{tenant}, con su verify token, su app secret (para validar
+// X-Hub-Signature-256), su token de WhatsApp y su versión de la Graph API (ver graph_version.go). Lo que llega por /webhook/{tenant} es de ese
+// tenant, aunque el phone_number_id no esté en TENANT_BY_PHONE_NUMBER_ID.
+//
+// Ojo: los envíos proactivos (campañas, recordatorios, reintentos del outbox) siguen
+// resolviendo el tenant por TENANT_BY_PHONE_NUMBER_ID, así que el número tiene que estar ahí.
+//
+// ENV:
+//
+//	TENANT_VERIFY_TOKENS=broker:tok_broker,demo_medical:tok_demo   (default: VERIFY_TOKEN)
+//	TENANT_APP_SECRETS=broker:abc123,demo_medical:def456            (default: META_APP_SECRET)
+//	TENANT_WHATSAPP_TOKENS=demo_medical:EAAG...                     (default: WHATSAPP_TOKEN)
+//	TENANT_GRAPH_API_VERSIONS=broker:v23.0                          (default: GRAPH_API_VERSION)
+//	META_APP_SECRET=...   si está, /webhook también valida la firma
+
+const hubSignatureHeader = "X-Hub-Signature-256"
+
+type WebhookApps struct {
+	mu             sync.RWMutex
+	verifyTokens   map[string]string // tenant -> verify token
+	appSecrets     map[string]string // tenant -> app secret
+	whatsAppTokens map[string]string // tenant -> access token
+	graphVersions  map[string]string // tenant -> versión de la Graph API
+	defaultSecret  string
+}
+
+func NewWebhookAppsFromEnv() *WebhookApps {
+	w := &WebhookApps{}
+	w.reload()
+	return w
+}
+
+// reload vuelve a leer las ENV (ej: cuando rotan los secrets, ver secrets.go).
+func (w *WebhookApps) reload() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.verifyTokens = parseTenantMap(os.Getenv("TENANT_VERIFY_TOKENS"))
+	w.appSecrets = parseTenantMap(os.Getenv("TENANT_APP_SECRETS"))
+	w.whatsAppTokens = parseTenantMap(os.Getenv("TENANT_WHATSAPP_TOKENS"))
+	w.graphVersions = parseTenantMap(os.Getenv("TENANT_GRAPH_API_VERSIONS"))
+	w.defaultSecret = strings.TrimSpace(os.Getenv("META_APP_SECRET"))
+}
+
+// appSecret devuelve el secret con el que se firma el webhook ("" = no se valida).
+// tenant "" es el /webhook compartido.
+func (w *WebhookApps) appSecret(tenant string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if s := w.appSecrets[tenant]; tenant != "" && s != "" {
+		return s
+	}
+	return w.defaultSecret
+}
+
+// verifyToken devuelve el verify token propio del tenant ("" = usar VERIFY_TOKEN).
+func (w *WebhookApps) verifyToken(tenant string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.verifyTokens[tenant]
+}
+
+// whatsAppToken devuelve el token propio del tenant ("" = usar WHATSAPP_TOKEN).
+func (w *WebhookApps) whatsAppToken(tenant string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.whatsAppTokens[tenant]
+}
+
+// validSignature valida X-Hub-Signature-256 ("sha256=<hex>") contra el body.
+func (w *WebhookApps) validSignature(tenant string, r *http.Request, body []byte) bool {
+	secret := w.appSecret(tenant)
+	if secret == "" {
+		return true
+	}
+	sig, ok := strings.CutPrefix(r.Header.Get(hubSignatureHeader), "sha256=")
+	return ok && validHMAC(secret, string(body), []string{sig})
+}
+
+// handleTenantWebhook atiende /webhook/{tenant}.
+func (a *App) handleTenantWebhook(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("tenant")
+	if _, err := a.cache.Load(tenant); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		token := a.verifyToken
+		if t := a.apps.verifyToken(tenant); t != "" {
+			token = t
+		}
+		a.handleVerifyToken(w, r, token)
+	case "POST":
+		a.handleMessageFor(w, r, tenant)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,402 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------
+// Archivo de webhooks
+// ---------------------
+// Para los "ayer el bot no me contestó": con WEBHOOK_ARCHIVE=true se guarda cada body del
+// webhook (con firma válida) tal como llegó, comprimido, por tenant y hora, con el wa_id del
+// primer mensaje (o del primer status) para buscarlo. Se borran a los WEBHOOK_ARCHIVE_DAYS
+// días, o antes si el tenant tiene retention.messages_days más corto (ver retention.go). Los
+// tenants con privacy.omit_message_bodies no se archivan.
+//
+// Admin:
+//
+//	GET  /admin/tenants/{tenant}/webhooks?wa_id=5491122334455&from=2026-03-01&to=2026-03-02&limit=50
+//	GET  /admin/tenants/{tenant}/webhooks/{id}           (con el body)
+//	POST /admin/tenants/{tenant}/webhooks/{id}/replay
+//
+// from/to como en los transcripts (ver transcripts.go). El replay vuelve a pasar el body por
+// el pipeline (sin volver a validar la firma ni archivarlo), con message IDs nuevos para que
+// el dedup no lo descarte (solo WhatsApp): corre contra la sesión de ahora y las respuestas
+// le llegan al usuario. Para reproducirlo sin mandar nada, bajar el body y usar flowly replay en modo
+// directo (ver replay.go).
+//
+// ENV:
+//
+//	WEBHOOK_ARCHIVE=true
+//	WEBHOOK_ARCHIVE_DAYS=7
+
+const (
+	defaultWebhookArchiveDays = 7
+	defaultWebhookArchiveList = 50
+	maxArchivedWebhookBytes   = 1 << 20
+	maxMemoryArchivedWebhooks = 2000
+)
+
+type ArchivedWebhook struct {
+	ID          int64           `json:"id"`
+	Tenant      string          `json:"tenant"`
+	RouteTenant string          `json:"route_tenant,omitempty"` // llegó por /webhook/{tenant}
+	WaID        string          `json:"wa_id,omitempty"`
+	Object      string          `json:"object,omitempty"`
+	Size        int             `json:"size"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	Body        json.RawMessage `json:"body,omitempty"`
+
+	compressed []byte
+}
+
+type WebhookArchive interface {
+	// ArchiveWebhook guarda el body (comprimido) y devuelve el id.
+	ArchiveWebhook(w ArchivedWebhook, compressed []byte) (int64, error)
+	// ListArchivedWebhooks devuelve los webhooks en [from, to) sin el body, más recientes primero.
+	ListArchivedWebhooks(tenant, waID string, from, to time.Time, limit int) ([]ArchivedWebhook, error)
+	// GetArchivedWebhook devuelve el webhook con el body comprimido.
+	GetArchivedWebhook(tenant string, id int64) (ArchivedWebhook, []byte, bool, error)
+	// PurgeArchivedWebhooks borra los recibidos antes de before (tenant "" = todos).
+	PurgeArchivedWebhooks(tenant string, before time.Time) (int, error)
+	// DeleteArchivedWebhooks borra los de un usuario (ver retention.go).
+	DeleteArchivedWebhooks(tenant, waID string) (int, error)
+}
+
+func NewWebhookArchive(store *PostgresStore) WebhookArchive {
+	if store != nil {
+		return store
+	}
+	return &memoryWebhookArchive{}
+}
+
+func webhookArchiveEnabled() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("WEBHOOK_ARCHIVE")))
+	return v == "true" || v == "1"
+}
+
+func gzipBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxArchivedWebhookBytes+1))
+}
+
+// webhookArchiveKey saca el tenant y el wa_id del payload (el de la primera entrada).
+func (a *App) webhookArchiveKey(payload WebhookPayload, rawBody []byte, forcedTenant string) (tenant, waID string) {
+	tenant = forcedTenant
+	if payload.Object == "page" || payload.Object == "instagram" {
+		var mp MessagingWebhookPayload
+		if err := json.Unmarshal(rawBody, &mp); err == nil && len(mp.Entry) > 0 {
+			if tenant == "" {
+				tenant = a.resolver.ResolvePage(mp.Entry[0].ID)
+			}
+			if len(mp.Entry[0].Messaging) > 0 {
+				waID = mp.Entry[0].Messaging[0].Sender.ID
+			}
+		}
+		return tenant, waID
+	}
+	for _, e := range payload.Entry {
+		for _, ch := range e.Changes {
+			if tenant == "" {
+				if id := ch.Value.Metadata.PhoneNumberID; id != "" {
+					tenant = a.resolver.Resolve(id)
+				} else {
+					tenant = a.resolver.ResolveWABA(e.ID)
+				}
+			}
+			if waID == "" && len(ch.Value.Messages) > 0 {
+				waID = ch.Value.Messages[0].From
+			}
+			if waID == "" && len(ch.Value.Statuses) > 0 {
+				waID = ch.Value.Statuses[0].RecipientID
+			}
+		}
+	}
+	return tenant, waID
+}
+
+// archiveWebhook guarda el body (best effort: si falla solo se loguea).
+func (a *App) archiveWebhook(payload WebhookPayload, rawBody []byte, forcedTenant string) {
+	if !webhookArchiveEnabled() {
+		return
+	}
+	if len(rawBody) > maxArchivedWebhookBytes {
+		log.Printf("⚠️ webhook de %d bytes sin archivar (máximo %d)", len(rawBody), maxArchivedWebhookBytes)
+		return
+	}
+	tenant, waID := a.webhookArchiveKey(payload, rawBody, forcedTenant)
+	if cfg, err := a.cache.Load(tenant); err == nil && cfg.Privacy != nil && cfg.Privacy.OmitMessageBodies {
+		return
+	}
+	compressed, err := gzipBytes(rawBody)
+	if err != nil {
+		log.Printf("ERROR comprimiendo webhook de %s: %v", tenant, err)
+		return
+	}
+	w := ArchivedWebhook{Tenant: tenant, RouteTenant: forcedTenant, WaID: waID, Object: payload.Object, Size: len(rawBody), ReceivedAt: time.Now()}
+	if _, err := a.webhookArchive.ArchiveWebhook(w, compressed); err != nil {
+		log.Printf("ERROR archivando webhook de %s: %v", tenant, err)
+	}
+}
+
+func (a *App) purgeWebhookArchive(now time.Time) {
+	days := envPositiveInt("WEBHOOK_ARCHIVE_DAYS", defaultWebhookArchiveDays)
+	n, err := a.webhookArchive.PurgeArchivedWebhooks("", now.AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("ERROR purgando el archivo de webhooks: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("🧹 archivo de webhooks: %d body(s) vencidos borrados", n)
+	}
+}
+
+// ---------------------
+// Admin
+// ---------------------
+
+func (a *App) handleAdminListWebhooks(w http.ResponseWriter, r *http.Request) {
+	from, to, err := transcriptRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tenant := r.PathValue("tenant")
+	list, err := a.webhookArchive.ListArchivedWebhooks(tenant, r.URL.Query().Get("wa_id"), from, to, queryLimit(r, defaultWebhookArchiveList, 1000))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if list == nil {
+		list = []ArchivedWebhook{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tenant": tenant, "from": from, "to": to, "enabled": webhookArchiveEnabled(), "webhooks": list})
+}
+
+// archivedWebhook busca el {id} de la ruta con el body descomprimido; false = ya respondió.
+func (a *App) archivedWebhook(w http.ResponseWriter, r *http.Request) (ArchivedWebhook, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id inválido")
+		return ArchivedWebhook{}, false
+	}
+	wh, compressed, ok, err := a.webhookArchive.GetArchivedWebhook(r.PathValue("tenant"), id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return ArchivedWebhook{}, false
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "webhook no encontrado")
+		return ArchivedWebhook{}, false
+	}
+	body, err := gunzipBytes(compressed)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "body ilegible: "+err.Error())
+		return ArchivedWebhook{}, false
+	}
+	wh.Body = body
+	return wh, true
+}
+
+func (a *App) handleAdminGetWebhook(w http.ResponseWriter, r *http.Request) {
+	if wh, ok := a.archivedWebhook(w, r); ok {
+		writeJSON(w, http.StatusOK, wh)
+	}
+}
+
+func (a *App) handleAdminReplayWebhook(w http.ResponseWriter, r *http.Request) {
+	wh, ok := a.archivedWebhook(w, r)
+	if !ok {
+		return
+	}
+	if wh.Object == "page" || wh.Object == "instagram" {
+		writeJSONError(w, http.StatusUnprocessableEntity, "el replay es solo para webhooks de WhatsApp")
+		return
+	}
+	// Message IDs nuevos (".r<unix>"): si no, el dedup lo tomaría como un reintento de Meta
+	body := rewriteReplayPayload(wh.Body, int(time.Now().Unix()), 0, 0)
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, "body inválido: "+err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), webhookTimeout)
+	defer cancel()
+	log.Printf("🛠️ admin: replay del webhook #%d de tenant=%s (recibido %s)", wh.ID, wh.Tenant, wh.ReceivedAt.Format(time.RFC3339))
+	auditNote(r, "webhook_id", strconv.FormatInt(wh.ID, 10))
+	a.processWebhook(ctx, payload, body, wh.RouteTenant)
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "tenant": wh.Tenant, "id": wh.ID, "wa_id": wh.WaID})
+}
+
+// ---------------------
+// In-memory store
+// ---------------------
+
+type memoryWebhookArchive struct {
+	mu      sync.Mutex
+	nextID  int64
+	entries []ArchivedWebhook // en orden de llegada, como mucho maxMemoryArchivedWebhooks
+}
+
+func (s *memoryWebhookArchive) ArchiveWebhook(w ArchivedWebhook, compressed []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	w.ID, w.Body, w.compressed = s.nextID, nil, compressed
+	s.entries = append(s.entries, w)
+	if len(s.entries) > maxMemoryArchivedWebhooks {
+		s.entries = append([]ArchivedWebhook(nil), s.entries[len(s.entries)-maxMemoryArchivedWebhooks:]...)
+	}
+	return w.ID, nil
+}
+
+func (s *memoryWebhookArchive) ListArchivedWebhooks(tenant, waID string, from, to time.Time, limit int) ([]ArchivedWebhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []ArchivedWebhook
+	for i := len(s.entries) - 1; i >= 0 && len(out) < limit; i-- {
+		w := s.entries[i]
+		if w.Tenant == tenant && (waID == "" || w.WaID == waID) && !w.ReceivedAt.Before(from) && w.ReceivedAt.Before(to) {
+			w.compressed = nil
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryWebhookArchive) GetArchivedWebhook(tenant string, id int64) (ArchivedWebhook, []byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.entries {
+		if w.ID == id && w.Tenant == tenant {
+			compressed := w.compressed
+			w.compressed = nil
+			return w, compressed, true, nil
+		}
+	}
+	return ArchivedWebhook{}, nil, false, nil
+}
+
+func (s *memoryWebhookArchive) remove(match func(w ArchivedWebhook) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.entries[:0]
+	for _, w := range s.entries {
+		if !match(w) {
+			kept = append(kept, w)
+		}
+	}
+	n := len(s.entries) - len(kept)
+	s.entries = kept
+	return n
+}
+
+func (s *memoryWebhookArchive) PurgeArchivedWebhooks(tenant string, before time.Time) (int, error) {
+	return s.remove(func(w ArchivedWebhook) bool {
+		return (tenant == "" || w.Tenant == tenant) && w.ReceivedAt.Before(before)
+	}), nil
+}
+
+func (s *memoryWebhookArchive) DeleteArchivedWebhooks(tenant, waID string) (int, error) {
+	return s.remove(func(w ArchivedWebhook) bool { return w.Tenant == tenant && w.WaID == waID }), nil
+}
+
+// ---------------------
+// Postgres store
+// ---------------------
+
+func (s *PostgresStore) ArchiveWebhook(w ArchivedWebhook, compressed []byte) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_archive (tenant, route_tenant, wa_id, object, size, body, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		w.Tenant, w.RouteTenant, w.WaID, w.Object, w.Size, compressed, w.ReceivedAt,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *PostgresStore) ListArchivedWebhooks(tenant, waID string, from, to time.Time, limit int) ([]ArchivedWebhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, tenant, route_tenant, wa_id, object, size, received_at
+		FROM webhook_archive
+		WHERE tenant = $1 AND ($2 = '' OR wa_id = $2) AND received_at >= $3 AND received_at < $4
+		ORDER BY received_at DESC
+		LIMIT $5`,
+		tenant, waID, from, to, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ArchivedWebhook
+	for rows.Next() {
+		var w ArchivedWebhook
+		if err := rows.Scan(&w.ID, &w.Tenant, &w.RouteTenant, &w.WaID, &w.Object, &w.Size, &w.ReceivedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) GetArchivedWebhook(tenant string, id int64) (ArchivedWebhook, []byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	var w ArchivedWebhook
+	var compressed []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, tenant, route_tenant, wa_id, object, size, received_at, body
+		FROM webhook_archive
+		WHERE tenant = $1 AND id = $2`,
+		tenant, id,
+	).Scan(&w.ID, &w.Tenant, &w.RouteTenant, &w.WaID, &w.Object, &w.Size, &w.ReceivedAt, &compressed)
+	if err == sql.ErrNoRows {
+		return ArchivedWebhook{}, nil, false, nil
+	}
+	if err != nil {
+		return ArchivedWebhook{}, nil, false, err
+	}
+	return w, compressed, true, nil
+}
+
+func (s *PostgresStore) PurgeArchivedWebhooks(tenant string, before time.Time) (int, error) {
+	return s.execCount(`DELETE FROM webhook_archive WHERE ($1 = '' OR tenant = $1) AND received_at < $2`, tenant, before)
+}
+
+func (s *PostgresStore) DeleteArchivedWebhooks(tenant, waID string) (int, error) {
+	return s.execCount(`DELETE FROM webhook_archive WHERE tenant = $1 AND wa_id = $2`, tenant, waID)
+}
@@ -0,0 +1,286 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ---------------------
+// Eventos de la cuenta de WhatsApp (webhook)
+// ---------------------
+// Además de "messages", Meta manda al mismo webhook cambios de la cuenta de WhatsApp
+// Business, cada uno con su "field". Los que tienen handler en webhookEventHandlers se
+// registran en el audit log (actor "system", action "meta.<field>": GET /admin/audit?action=meta)
+// y, si son algo que hay que atender (un template rechazado o pausado, la calidad del número
+// que baja, una restricción de la cuenta), se avisa a los admins:
+//
+//   - al canal de operación (Slack / Teams / Telegram, ver ops_alerts.go) y a los canales
+//     del tenant (ver notifications.go)
+//   - por WhatsApp a whatsapp_errors.admin_wa_ids del tenant (ver whatsapp_errors.go)
+//
+//	⚠️ Flowly (broker): Meta rechazó el template "recordatorio_turno" (es_AR): INCORRECT_CATEGORY
+//
+// Para sumar un field: agregar su handler al mapa (y suscribir el field en la app de Meta).
+// Estos eventos no traen phone_number_id: el tenant sale de la ruta (/webhook/{tenant}) o
+// del id de la WABA (entry.id) en TENANT_BY_WABA_ID; si no, es DEFAULT_TENANT.
+//
+// ENV:
+//
+//	TENANT_BY_WABA_ID=102290129340398:broker
+
+// WebhookEvent es un cambio de la cuenta que no es un mensaje.
+type WebhookEvent struct {
+	Tenant string
+	WABAID string // entry.id
+	Field  string
+	Value  json.RawMessage
+}
+
+// WebhookEventHandler interpreta el evento. Devuelve el aviso para los admins ("" = no hay
+// que avisar) y los datos que quedan en el audit log.
+type WebhookEventHandler func(ev WebhookEvent) (notice string, details map[string]string, err error)
+
+var webhookEventHandlers = map[string]WebhookEventHandler{
+	"message_template_status_update":  handleTemplateStatusEvent,
+	"message_template_quality_update": handleTemplateQualityEvent,
+	"template_category_update":        handleTemplateCategoryEvent,
+	"phone_number_quality_update":     handlePhoneQualityEvent,
+	"account_alerts":                  handleAccountAlertEvent,
+	"account_update":                  handleAccountUpdateEvent,
+}
+
+// templateCatalogFields son los eventos que cambian el catálogo de templates (ver template_catalog.go).
+var templateCatalogFields = map[string]bool{"message_template_status_update": true, "template_category_update": true}
+
+// dispatchWebhookEvents corre los handlers de los changes del payload que no son mensajes.
+func (a *App) dispatchWebhookEvents(ctx context.Context, rawBody []byte, forcedTenant string) {
+	var payload struct {
+		Entry []struct {
+			ID      string `json:"id"`
+			Changes []struct {
+				Field string          `json:"field"`
+				Value json.RawMessage `json:"value"`
+			} `json:"changes"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(rawBody, &payload); err != nil {
+		return // ya lo logueó handleMessageFor
+	}
+	for _, e := range payload.Entry {
+		for _, ch := range e.Changes {
+			if ch.Field == "" || ch.Field == "messages" {
+				continue
+			}
+			tenant := forcedTenant
+			if tenant == "" {
+				tenant = a.resolver.ResolveWABA(e.ID)
+			}
+			a.handleWebhookEvent(ctx, WebhookEvent{Tenant: tenant, WABAID: e.ID, Field: ch.Field, Value: ch.Value})
+		}
+	}
+}
+
+func (a *App) handleWebhookEvent(ctx context.Context, ev WebhookEvent) {
+	metrics.Inc("flowly_webhook_events_total", ev.Tenant, ev.Field)
+	h, ok := webhookEventHandlers[ev.Field]
+	if !ok {
+		debugf("webhook field sin handler tenant=%s field=%s value=%s", ev.Tenant, ev.Field, string(ev.Value))
+		return
+	}
+	// Meta reintenta los webhooks: el mismo evento no se registra ni se avisa dos veces
+	sum := sha256.Sum256(append([]byte(ev.Field+":"), ev.Value...))
+	if !a.dedup.FirstSeen(ev.Tenant, "event:"+hex.EncodeToString(sum[:16])) {
+		return
+	}
+	notice, details, err := h(ev)
+	if err != nil {
+		log.Printf("ERROR procesando %s de tenant=%s: %v", ev.Field, ev.Tenant, err)
+		return
+	}
+	if templateCatalogFields[ev.Field] {
+		a.refreshTemplates(ev.Tenant)
+		a.notifyReplicas(clusterTemplates, ev.Tenant)
+	}
+	if details == nil {
+		details = make(map[string]string)
+	}
+	details["waba_id"] = ev.WABAID
+	a.recordAudit(AuditEntry{Actor: systemAuditActor, Action: "meta." + ev.Field, Tenant: ev.Tenant, Details: details})
+	if notice == "" {
+		log.Printf("📣 tenant=%s %s %v", ev.Tenant, ev.Field, details)
+		return
+	}
+	log.Printf("⚠️ tenant=%s %s: %s", ev.Tenant, ev.Field, notice)
+	a.notifyAdmins(ctx, ev.Tenant, ev.Field, notice)
+}
+
+// notifyAdmins avisa al canal de operación y a los admins del tenant por WhatsApp.
+func (a *App) notifyAdmins(ctx context.Context, tenant, kind, notice string) {
+	text := fmt.Sprintf("⚠️ Flowly (%s): %s", tenant, notice)
+	a.alerts.Notify(tenant, kind, text)
+
+	cfg, err := a.cache.Load(tenant)
+	if err != nil || cfg.WhatsAppErrors == nil || len(cfg.WhatsAppErrors.AdminWaIDs) == 0 {
+		return
+	}
+	phoneID, ok := a.resolver.PhoneNumberID(tenant)
+	if !ok {
+		return
+	}
+	c, err := a.tenantWhatsAppClient(phoneID, tenant)
+	if err != nil {
+		log.Printf("ERROR WhatsApp client para avisar a los admins de %s: %v", tenant, err)
+		return
+	}
+	ctx = withQuietSend(ctx) // un aviso que falla no dispara otro
+	for _, admin := range cfg.WhatsAppErrors.AdminWaIDs {
+		if err := c.SendText(ctx, admin, text); err != nil {
+			log.Printf("ERROR avisando al admin %s del tenant %s: %v", admin, tenant, err)
+		}
+	}
+}
+
+// ---------------------
+// Handlers
+// ---------------------
+
+type templateEventValue struct {
+	Event    string `json:"event"`
+	ID       int64  `json:"message_template_id"`
+	Name     string `json:"message_template_name"`
+	Language string `json:"message_template_language"`
+	Reason   string `json:"reason"`
+
+	// message_template_quality_update
+	PreviousQuality string `json:"previous_quality_score"`
+	NewQuality      string `json:"new_quality_score"`
+
+	// template_category_update
+	PreviousCategory string `json:"previous_category"`
+	NewCategory      string `json:"new_category"`
+}
+
+func (v templateEventValue) details() map[string]string {
+	return map[string]string{"template": v.Name, "language": v.Language, "template_id": fmt.Sprint(v.ID)}
+}
+
+func handleTemplateStatusEvent(ev WebhookEvent) (string, map[string]string, error) {
+	var v templateEventValue
+	if err := json.Unmarshal(ev.Value, &v); err != nil {
+		return "", nil, err
+	}
+	d := v.details()
+	d["event"], d["reason"] = v.Event, v.Reason
+	var what string
+	switch v.Event {
+	case "REJECTED":
+		what = "rechazó"
+	case "PAUSED":
+		what = "pausó"
+	case "DISABLED":
+		what = "deshabilitó"
+	case "FLAGGED":
+		what = "marcó por baja calidad"
+	default:
+		return "", d, nil // APPROVED, PENDING, REINSTATED...
+	}
+	notice := fmt.Sprintf("Meta %s el template %q (%s)", what, v.Name, v.Language)
+	if v.Reason != "" && v.Reason != "NONE" {
+		notice += ": " + v.Reason
+	}
+	return notice, d, nil
+}
+
+func handleTemplateQualityEvent(ev WebhookEvent) (string, map[string]string, error) {
+	var v templateEventValue
+	if err := json.Unmarshal(ev.Value, &v); err != nil {
+		return "", nil, err
+	}
+	d := v.details()
+	d["previous_quality"], d["new_quality"] = v.PreviousQuality, v.NewQuality
+	if v.NewQuality != "RED" {
+		return "", d, nil
+	}
+	return fmt.Sprintf("la calidad del template %q (%s) bajó a RED (antes %s): si sigue así, Meta lo pausa", v.Name, v.Language, v.PreviousQuality), d, nil
+}
+
+func handleTemplateCategoryEvent(ev WebhookEvent) (string, map[string]string, error) {
+	var v templateEventValue
+	if err := json.Unmarshal(ev.Value, &v); err != nil {
+		return "", nil, err
+	}
+	d := v.details()
+	d["previous_category"], d["new_category"] = v.PreviousCategory, v.NewCategory
+	return fmt.Sprintf("Meta cambió la categoría del template %q (%s): %s -> %s (cambia el precio por mensaje)", v.Name, v.Language, v.PreviousCategory, v.NewCategory), d, nil
+}
+
+func handlePhoneQualityEvent(ev WebhookEvent) (string, map[string]string, error) {
+	var v struct {
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		Event              string `json:"event"`
+		CurrentLimit       string `json:"current_limit"`
+	}
+	if err := json.Unmarshal(ev.Value, &v); err != nil {
+		return "", nil, err
+	}
+	d := map[string]string{"phone": v.DisplayPhoneNumber, "event": v.Event, "current_limit": v.CurrentLimit}
+	switch v.Event {
+	case "FLAGGED":
+		return fmt.Sprintf("el número %s quedó marcado por baja calidad (límite %s): si no mejora, Meta le baja el límite de envíos", v.DisplayPhoneNumber, v.CurrentLimit), d, nil
+	case "DOWNGRADE":
+		return fmt.Sprintf("Meta bajó el límite de envíos del número %s a %s", v.DisplayPhoneNumber, v.CurrentLimit), d, nil
+	}
+	return "", d, nil // UNFLAGGED, UPGRADE
+}
+
+func handleAccountAlertEvent(ev WebhookEvent) (string, map[string]string, error) {
+	var v struct {
+		EntityType  string `json:"entity_type"`
+		EntityID    string `json:"entity_id"`
+		Severity    string `json:"alert_severity"`
+		Status      string `json:"alert_status"`
+		Type        string `json:"alert_type"`
+		Description string `json:"alert_description"`
+	}
+	if err := json.Unmarshal(ev.Value, &v); err != nil {
+		return "", nil, err
+	}
+	d := map[string]string{"entity_type": v.EntityType, "entity_id": v.EntityID, "severity": v.Severity, "status": v.Status, "type": v.Type}
+	if v.Severity == "INFORMATIONAL" || v.Status == "NONE" {
+		return "", d, nil
+	}
+	return fmt.Sprintf("alerta de la cuenta (%s, %s): %s", strings.ToLower(v.Severity), v.Type, truncateRunes(v.Description, 300)), d, nil
+}
+
+func handleAccountUpdateEvent(ev WebhookEvent) (string, map[string]string, error) {
+	var v struct {
+		PhoneNumber   string `json:"phone_number"`
+		Event         string `json:"event"`
+		ViolationInfo *struct {
+			ViolationType string `json:"violation_type"`
+		} `json:"violation_info"`
+		BanInfo *struct {
+			WABABanState string `json:"waba_ban_state"`
+		} `json:"ban_info"`
+	}
+	if err := json.Unmarshal(ev.Value, &v); err != nil {
+		return "", nil, err
+	}
+	d := map[string]string{"event": v.Event, "phone": v.PhoneNumber}
+	switch {
+	case v.ViolationInfo != nil:
+		d["violation_type"] = v.ViolationInfo.ViolationType
+		return fmt.Sprintf("Meta registró una violación de políticas en la cuenta (%s): %s", v.Event, v.ViolationInfo.ViolationType), d, nil
+	case v.BanInfo != nil:
+		d["ban_state"] = v.BanInfo.WABABanState
+		return fmt.Sprintf("la cuenta de WhatsApp Business está %s", v.BanInfo.WABABanState), d, nil
+	case strings.Contains(v.Event, "RESTRICTION") || strings.Contains(v.Event, "DISABLED"):
+		return fmt.Sprintf("cambio en la cuenta de WhatsApp Business: %s", v.Event), d, nil
+	}
+	return "", d, nil
+}
@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"flowly/testkit"
+)
+
+// Pruebas de punta a punta del webhook: el body como lo manda Meta entra por
+// handleMessageFor, corre el flow de configs/broker y lo que sale queda en un FakeWhatsApp.
+
+const testPhoneID = "111"
+
+// Los tests corren en engine/: las configs de los tenants están un nivel arriba.
+func TestMain(m *testing.M) {
+	ConfigRoot = filepath.Join("..", "configs")
+	os.Exit(m.Run())
+}
+
+func newWebhookTestApp(t *testing.T) (*App, *testkit.FakeWhatsApp) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("WHATSAPP_TOKEN", "test")
+	t.Setenv("PUBLIC_BASE_URL", "https://flowly.test")
+	t.Setenv("TENANT_BY_PHONE_NUMBER_ID", testPhoneID+":broker")
+	t.Setenv("INBOUND_RATE_LIMIT_PER_MIN", "0")
+	t.Setenv("WHATSAPP_MAX_RETRIES", "2")
+	t.Setenv("WHATSAPP_RETRY_BASE_MS", "1")
+	t.Setenv("WHATSAPP_RETRY_MAX_MS", "5")
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+		t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	}
+
+	app, err := NewApp()
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	fake := testkit.NewFakeWhatsApp()
+	app.waTransport = fake
+	return app, fake
+}
+
+// postWebhook manda un mensaje del usuario al webhook como lo haría Meta.
+func postWebhook(t *testing.T, app *App, from, msgID string, msg map[string]any) {
+	t.Helper()
+	msg["from"], msg["id"], msg["timestamp"] = from, msgID, "1767225600"
+	body, err := json.Marshal(map[string]any{
+		"object": "whatsapp_business_account",
+		"entry": []any{map[string]any{
+			"id": "waba",
+			"changes": []any{map[string]any{
+				"field": "messages",
+				"value": map[string]any{
+					"messaging_product": "whatsapp",
+					"metadata":          map[string]any{"phone_number_id": testPhoneID, "display_phone_number": "5491100000000"},
+					"contacts":          []any{map[string]any{"wa_id": from, "profile": map[string]any{"name": "Ana"}}},
+					"messages":          []any{msg},
+				},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	app.handleMessageFor(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(string(body))), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("webhook: status %d", rec.Code)
+	}
+}
+
+func textMsg(body string) map[string]any {
+	return map[string]any{"type": "text", "text": map[string]any{"body": body}}
+}
+
+func listReplyMsg(id string) map[string]any {
+	return map[string]any{"type": "interactive", "interactive": map[string]any{
+		"type": "list_reply", "list_reply": map[string]any{"id": id, "title": id},
+	}}
+}
+
+func buttonReplyMsg(id string) map[string]any {
+	return map[string]any{"type": "interactive", "interactive": map[string]any{
+		"type": "button_reply", "button_reply": map[string]any{"id": id, "title": id},
+	}}
+}
+
+func sessionState(t *testing.T, app *App, waID string) UserSession {
+	t.Helper()
+	sess, ok := app.sessions.Get("broker:" + waID)
+	if !ok {
+		t.Fatalf("no hay sesión para %s", waID)
+	}
+	return sess
+}
+
+// botMessages: los mensajes del bot al usuario (sin los "marcar como leído").
+func botMessages(fake *testkit.FakeWhatsApp, waID string) []testkit.FakeMessage {
+	var out []testkit.FakeMessage
+	for _, m := range fake.MessagesTo(waID) {
+		if !strings.HasPrefix(m.Type, "status:") {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func messagesText(msgs []testkit.FakeMessage) string {
+	var parts []string
+	for _, m := range msgs {
+		parts = append(parts, payloadTexts(m.Payload)...)
+	}
+	return strings.Join(parts, "\n")
+}
+
+func TestWebhookAdvancesFlow(t *testing.T) {
+	app, fake := newWebhookTestApp(t)
+	const user = "5491155550001"
+
+	postWebhook(t, app, user, "wamid.in.1", textMsg("buenas"))
+	if sess := sessionState(t, app, user); sess.State != "MENU" {
+		t.Fatalf("después de buenas: estado %s, se esperaba MENU", sess.State)
+	}
+	if got := botMessages(fake, user); len(got) == 0 || got[len(got)-1].Type != "interactive" {
+		t.Fatalf("se esperaba el menú interactivo, el bot mandó %v", got)
+	}
+
+	sent := len(botMessages(fake, user))
+	postWebhook(t, app, user, "wamid.in.2", buttonReplyMsg("NO_SOY_CLIENTE"))
+	if sess := sessionState(t, app, user); sess.State != "ABOUT_COBERSER" {
+		t.Fatalf("después de NO_SOY_CLIENTE: estado %s, se esperaba ABOUT_COBERSER", sess.State)
+	}
+	out := botMessages(fake, user)[sent:]
+	if len(out) != 1 || out[0].Type != "interactive" || !strings.Contains(messagesText(out), "Auto / Moto") {
+		t.Fatalf("se esperaba la lista de servicios, el bot mandó %v", out)
+	}
+
+	postWebhook(t, app, user, "wamid.in.3", listReplyMsg("PROSPECT_AUTO_MOTO"))
+	if sess := sessionState(t, app, user); sess.State != "LEAD_INTRO_AUTO_MOTO" || sess.Data["last_selected_id"] != "PROSPECT_AUTO_MOTO" {
+		t.Fatalf("después de PROSPECT_AUTO_MOTO: estado %s (last_selected_id=%q)", sess.State, sess.Data["last_selected_id"])
+	}
+}
+
+func TestWebhookRetriesTemporaryGraphErrors(t *testing.T) {
+	app, fake := newWebhookTestApp(t)
+	const user = "5491155550002"
+	postWebhook(t, app, user, "wamid.in.1", textMsg("buenas"))
+
+	sent := len(botMessages(fake, user))
+	fake.FailNext(http.StatusServiceUnavailable, 2, "Service temporarily unavailable")
+	fake.FailNext(http.StatusInternalServerError, 1, "An unknown error occurred")
+	postWebhook(t, app, user, "wamid.in.2", buttonReplyMsg("NO_SOY_CLIENTE"))
+
+	out := botMessages(fake, user)[sent:]
+	if len(out) != 1 || !strings.Contains(messagesText(out), "Auto / Moto") {
+		t.Fatalf("la lista tenía que salir después de reintentar, el bot mandó %v", out)
+	}
+	if sess := sessionState(t, app, user); sess.State != "ABOUT_COBERSER" {
+		t.Fatalf("estado %s, se esperaba ABOUT_COBERSER", sess.State)
+	}
+}
+
+func TestWebhookListRejectedFallsBackToTextMenu(t *testing.T) {
+	app, fake := newWebhookTestApp(t)
+	const user = "5491155550003"
+	postWebhook(t, app, user, "wamid.in.1", textMsg("buenas"))
+
+	sent := len(botMessages(fake, user))
+	fake.FailNext(http.StatusBadRequest, 131009, "Parameter value is not valid")
+	postWebhook(t, app, user, "wamid.in.2", buttonReplyMsg("NO_SOY_CLIENTE"))
+
+	out := botMessages(fake, user)[sent:]
+	if len(out) != 1 || out[0].Type != "text" {
+		t.Fatalf("se esperaba el menú como texto, el bot mandó %v", out)
+	}
+	if text := messagesText(out); !strings.Contains(text, "1. Auto / Moto") || !strings.Contains(text, textMenuPrompt) {
+		t.Fatalf("el menú de texto no tiene las opciones numeradas:\n%s", text)
+	}
+	if sess := sessionState(t, app, user); sess.State != "ABOUT_COBERSER" || sess.Data[textMenuVar] == "" {
+		t.Fatalf("estado %s (menú %q), se esperaba ABOUT_COBERSER con el menú de texto", sess.State, sess.Data[textMenuVar])
+	}
+
+	// "1" vale como haber elegido la primera fila de la lista
+	postWebhook(t, app, user, "wamid.in.3", textMsg("1"))
+	if sess := sessionState(t, app, user); sess.State != "LEAD_INTRO_AUTO_MOTO" {
+		t.Fatalf("después de 1: estado %s, se esperaba LEAD_INTRO_AUTO_MOTO", sess.State)
+	}
+}
+
+func TestWebhookDuplicateMessageIsSkipped(t *testing.T) {
+	app, fake := newWebhookTestApp(t)
+	const user = "5491155550004"
+	postWebhook(t, app, user, "wamid.in.1", textMsg("buenas"))
+	postWebhook(t, app, user, "wamid.in.2", buttonReplyMsg("NO_SOY_CLIENTE"))
+
+	sent := len(botMessages(fake, user))
+	sess := sessionState(t, app, user)
+	// Meta reintenta el webhook con el mismo mensaje
+	postWebhook(t, app, user, "wamid.in.2", buttonReplyMsg("NO_SOY_CLIENTE"))
+
+	if out := botMessages(fake, user)[sent:]; len(out) != 0 {
+		t.Fatalf("el duplicado no tenía que responder, el bot mandó %v", out)
+	}
+	if got := sessionState(t, app, user); got.State != sess.State || got.UpdatedAt != sess.UpdatedAt {
+		t.Fatalf("el duplicado movió la sesión: %s (%v), antes %s (%v)", got.State, got.UpdatedAt, sess.State, sess.UpdatedAt)
+	}
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// Errores de WhatsApp (payload de Meta)
+// ---------------------
+// Meta devuelve { "error": { "code", "error_subcode", "message", "error_data", "fbtrace_id" } }
+// tanto en la respuesta de /messages como en los statuses "failed" del webhook. Se parsea a
+// *wa.Error y, para los casos comunes, se hace algo más que loguear el error:
+//
+//	131030  el destinatario no está en la lista de números de prueba -> log con la solución
+//	131047  pasaron más de 24h desde el último mensaje del usuario   -> se manda window_template
+//	132001  el template no existe (o no en ese idioma)                -> aviso a los admins
+//	132015 / 132016  template pausado / deshabilitado                 -> aviso a los admins
+//
+//	"whatsapp_errors": {
+//	  "window_template": { "name": "retomar_conversacion", "language": "es_AR", "body_params": ["{{name}}"] },
+//	  "admin_wa_ids": ["5491122334455"]
+//	}
+//
+// El template de ventana y cada aviso se mandan una vez por usuario / template cada 24h
+// (DEDUP_TTL_HOURS, ver dedup.go). El aviso a los admins es un texto normal, así que solo
+// llega si el admin le escribió al número en las últimas 24h.
+//
+// admin_wa_ids también recibe los avisos de la cuenta: templates rechazados, calidad del
+// número (ver webhook_events.go).
+
+type FlowWhatsAppErrors struct {
+	WindowTemplate *FlowTimeoutTemplate `json:"window_template,omitempty"`
+	AdminWaIDs     []string             `json:"admin_wa_ids,omitempty"`
+}
+
+// statusError arma el *wa.Error de un status "failed" (nil si no trae errores).
+func statusError(st MessageStatus) *wa.Error {
+	if len(st.Errors) == 0 {
+		return nil
+	}
+	e := st.Errors[0]
+	return &wa.Error{Code: e.Code, Message: e.Title, Details: e.ErrorData.Details}
+}
+
+type whatsAppErrorBehavior struct {
+	Guidance       string
+	WindowFallback bool // mandar el template de ventana al usuario
+	NotifyAdmins   bool
+}
+
+var whatsAppErrorBehaviors = map[int]whatsAppErrorBehavior{
+	wa.CodeNotAllowedRecipient: {
+		Guidance: "la app está en modo desarrollo: agregá el número en WhatsApp > API Setup > To (lista de destinatarios de prueba) o pasá la app a producción",
+	},
+	wa.CodeReengagement: {
+		Guidance:       "pasaron más de 24h desde el último mensaje del usuario; fuera de la ventana solo se pueden mandar templates",
+		WindowFallback: true,
+	},
+	wa.CodeTemplateNotFound: {
+		Guidance:     "el template no existe para ese idioma en la WABA: revisá nombre y language en el Business Manager",
+		NotifyAdmins: true,
+	},
+	wa.CodeTemplatePaused: {
+		Guidance:     "Meta pausó el template por baja calidad: revisalo en el Business Manager",
+		NotifyAdmins: true,
+	},
+	wa.CodeTemplateDisabled: {
+		Guidance:     "Meta deshabilitó el template: hay que crear uno nuevo",
+		NotifyAdmins: true,
+	},
+}
+
+func validateWhatsAppErrors(cfg FlowConfig) []string {
+	we := cfg.WhatsAppErrors
+	if we == nil {
+		return nil
+	}
+	var errs []string
+	if we.WindowTemplate != nil && we.WindowTemplate.Name == "" {
+		errs = append(errs, "whatsapp_errors.window_template sin name")
+	}
+	for _, id := range we.AdminWaIDs {
+		if strings.TrimSpace(id) == "" {
+			errs = append(errs, "whatsapp_errors.admin_wa_ids tiene un número vacío")
+		}
+	}
+	return errs
+}
+
+// handleWhatsAppError aplica el comportamiento que corresponde al error de un envío a waID.
+// payload es el mensaje que falló (puede ser nil).
+func (a *App) handleWhatsAppError(ctx context.Context, c *wa.Client, waID string, payload map[string]any, err error) {
+	var werr *wa.Error
+	if !errors.As(err, &werr) {
+		return
+	}
+	b, ok := whatsAppErrorBehaviors[werr.Code]
+	if !ok {
+		return
+	}
+	log.Printf("⚠️ WhatsApp code=%d tenant=%s wa_id=%s: %s", werr.Code, c.Tenant, waID, b.Guidance)
+
+	cfg, cerr := a.cache.Load(c.Tenant)
+	if cerr != nil || cfg.WhatsAppErrors == nil {
+		return
+	}
+	// Lo que se manda desde acá no vuelve a pasar por el handler
+	ctx = withQuietSend(ctx)
+
+	if b.WindowFallback && cfg.WhatsAppErrors.WindowTemplate != nil && payloadType(payload) != "template" {
+		a.sendWindowTemplate(ctx, c, waID, *cfg.WhatsAppErrors.WindowTemplate)
+	}
+	if b.NotifyAdmins && len(cfg.WhatsAppErrors.AdminWaIDs) > 0 {
+		name := templateName(payload)
+		if !a.dedup.FirstSeen(c.Tenant, fmt.Sprintf("wa_error:%d:%s", werr.Code, name)) {
+			return
+		}
+		text := fmt.Sprintf("⚠️ Flowly (%s): falló el envío del template %q a %s.\n%s\n\n%s", c.Tenant, name, waID, b.Guidance, werr.Error())
+		for _, admin := range cfg.WhatsAppErrors.AdminWaIDs {
+			if err := c.SendText(ctx, admin, text); err != nil {
+				log.Printf("ERROR avisando al admin %s del tenant %s: %v", admin, c.Tenant, err)
+			}
+		}
+	}
+}
+
+// sendWindowTemplate manda el template para retomar la conversación (una vez cada 24h por usuario).
+func (a *App) sendWindowTemplate(ctx context.Context, c *wa.Client, waID string, tpl FlowTimeoutTemplate) {
+	if !a.dedup.FirstSeen(c.Tenant, "window_template:"+waID) {
+		return
+	}
+	vars := map[string]string{"wa_id": waID}
+	if sess, ok := a.sessions.Get(c.Tenant + ":" + waID); ok {
+		for k, v := range sess.Data {
+			vars[k] = v
+		}
+	}
+	log.Printf("📨 tenant=%s wa_id=%s fuera de la ventana de 24h, mando template %s", c.Tenant, waID, tpl.Name)
+	if _, err := sendFlowTemplate(ctx, c, waID, tpl, vars); err != nil {
+		log.Printf("ERROR mandando template de ventana a wa_id=%s: %v", waID, err)
+	}
+}
+
+func payloadType(payload map[string]any) string {
+	t, _ := payload["type"].(string)
+	return t
+}
+
+func templateName(payload map[string]any) string {
+	tpl, _ := payload["template"].(map[string]any)
+	name, _ := tpl["name"].(string)
+	return name
+}
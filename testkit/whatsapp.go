@@ -0,0 +1,228 @@
+// Package testkit tiene dobles de prueba para correr flowly sin salir a la red. FakeWhatsApp
+// reemplaza a la Graph API de Meta en los tests del engine, en flowly test y en flowly
+// replay, y sirve igual para probar cualquier código que use flowly/wa.
+package testkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flowly/wa"
+)
+
+// ---------------------
+// FakeWhatsApp (Graph API en memoria)
+// ---------------------
+// wa.Transport que no sale a la red: guarda cada mensaje que se manda y contesta como
+// Meta (wamid, media id). Sirve para probar el engine, el renderer y el webhook de punta
+// a punta sin tokens ni red (ver engine/webhook_test.go):
+//
+//	fake := testkit.NewFakeWhatsApp()
+//	app.waTransport = fake                         // webhook / jobs (tenantWhatsAppClient)
+//	client := fake.Client("111", "broker")         // o un cliente suelto para el Renderer
+//	fake.FailNext(400, wa.CodeTemplateNotFound, "Template name does not exist")
+//	fake.FailRecipient("5491100000000", 400, wa.CodeReengagement, "Re-engagement message")
+//	msgs := fake.MessagesTo("5491100000000")
+//
+// Los errores simulados salen con el JSON de error de Meta, así que recorren el mismo camino
+// que los reales (wa.ResponseError, reintentos ante 429/5xx, engine/whatsapp_errors.go).
+
+type FakeMessage struct {
+	PhoneID string         `json:"phone_id"`
+	To      string         `json:"to"`
+	Type    string         `json:"type"` // text, interactive, template, ... o status:read (marcar leído)
+	Payload map[string]any `json:"payload"`
+	At      time.Time      `json:"at"`
+}
+
+type fakeGraphError struct {
+	status  int
+	code    int
+	message string
+}
+
+type FakeWhatsApp struct {
+	mu       sync.Mutex
+	messages []FakeMessage
+	next     []fakeGraphError          // se consumen en orden, uno por request
+	byTo     map[string]fakeGraphError // fallan siempre para ese destinatario
+	seq      int
+}
+
+func NewFakeWhatsApp() *FakeWhatsApp {
+	return &FakeWhatsApp{byTo: make(map[string]fakeGraphError)}
+}
+
+// Client arma un *wa.Client que usa el fake.
+func (f *FakeWhatsApp) Client(phoneID, tenant string) *wa.Client {
+	return &wa.Client{
+		Token:     "fake",
+		PhoneID:   phoneID,
+		API:       wa.NewGraphAPI(""),
+		Tenant:    tenant,
+		Transport: f,
+	}
+}
+
+// FailNext hace fallar el próximo request con status HTTP y code de Meta (status 0 = 400).
+func (f *FakeWhatsApp) FailNext(status, code int, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next = append(f.next, fakeGraphError{status: status, code: code, message: message})
+}
+
+// FailRecipient hace fallar todos los mensajes a to hasta Reset. Como en MessagesTo, to
+// puede ser el wa_id o el número ya normalizado para Meta.
+func (f *FakeWhatsApp) FailRecipient(to string, status, code int, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := fakeGraphError{status: status, code: code, message: message}
+	f.byTo[to] = e
+	f.byTo[fakeMetaNumber(to)] = e
+}
+
+// Messages devuelve los mensajes aceptados, en orden.
+func (f *FakeWhatsApp) Messages() []FakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeMessage(nil), f.messages...)
+}
+
+func (f *FakeWhatsApp) MessagesTo(to string) []FakeMessage {
+	var out []FakeMessage
+	for _, m := range f.Messages() {
+		if m.To == to || m.To == fakeMetaNumber(to) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// CountByType cuenta los mensajes aceptados por tipo.
+func (f *FakeWhatsApp) CountByType() map[string]int {
+	out := make(map[string]int)
+	for _, m := range f.Messages() {
+		out[m.Type]++
+	}
+	return out
+}
+
+// Reset borra los mensajes guardados y los errores pendientes.
+func (f *FakeWhatsApp) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = nil
+	f.next = nil
+	f.byTo = make(map[string]fakeGraphError)
+}
+
+func (f *FakeWhatsApp) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.next) > 0 {
+		e := f.next[0]
+		f.next = f.next[1:]
+		return fakeErrorResponse(req, e), nil
+	}
+
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/messages"):
+		var payload map[string]any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return fakeErrorResponse(req, fakeGraphError{code: 100, message: "Invalid parameter: " + err.Error()}), nil
+		}
+		to, _ := payload["to"].(string)
+		if e, ok := f.byTo[to]; ok {
+			return fakeErrorResponse(req, e), nil
+		}
+		kind, _ := payload["type"].(string)
+		if st, _ := payload["status"].(string); kind == "" && st != "" {
+			kind = "status:" + st
+		}
+		f.seq++
+		f.messages = append(f.messages, FakeMessage{
+			PhoneID: fakePhoneID(path),
+			To:      to,
+			Type:    kind,
+			Payload: payload,
+			At:      time.Now(),
+		})
+		return fakeJSONResponse(req, http.StatusOK, map[string]any{
+			"messaging_product": "whatsapp",
+			"contacts":          []map[string]string{{"input": to, "wa_id": to}},
+			"messages":          []map[string]string{{"id": "wamid.fake." + strconv.Itoa(f.seq)}},
+		}), nil
+
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/media"):
+		f.seq++
+		return fakeJSONResponse(req, http.StatusOK, map[string]any{"id": "media.fake." + strconv.Itoa(f.seq)}), nil
+	}
+	return fakeErrorResponse(req, fakeGraphError{status: http.StatusNotFound, code: 803, message: "FakeWhatsApp: endpoint no simulado " + req.Method + " " + path}), nil
+}
+
+// fakeMetaNumber normaliza to como lo manda el cliente sin reglas de tenant (ej: saca el 9
+// de los celulares de Argentina).
+func fakeMetaNumber(to string) string {
+	var rules *wa.PhoneRules
+	return rules.ForMeta(to)
+}
+
+// fakePhoneID saca el phone_number_id de /{version}/{phone_id}/messages.
+func fakePhoneID(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+func fakeJSONResponse(req *http.Request, status int, v any) *http.Response {
+	b, _ := json.Marshal(v)
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(b)),
+		Request:    req,
+	}
+}
+
+func fakeErrorResponse(req *http.Request, e fakeGraphError) *http.Response {
+	if e.status == 0 {
+		e.status = http.StatusBadRequest
+	}
+	resp := fakeJSONResponse(req, e.status, map[string]any{
+		"error": map[string]any{
+			"message":    e.message,
+			"type":       "OAuthException",
+			"code":       e.code,
+			"error_data": map[string]any{"messaging_product": "whatsapp", "details": e.message},
+			"fbtrace_id": "fake",
+		},
+	})
+	if e.status == http.StatusTooManyRequests {
+		resp.Header.Set("Retry-After", "1")
+	}
+	return resp
+}
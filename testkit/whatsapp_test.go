@@ -0,0 +1,27 @@
+package testkit
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"flowly/wa"
+)
+
+func TestFakeWhatsAppFailRecipient(t *testing.T) {
+	fake := NewFakeWhatsApp()
+	fake.FailRecipient("5491155550005", http.StatusBadRequest, wa.CodeReengagement, "Re-engagement message")
+	client := fake.Client("111", "broker")
+
+	err := client.SendText(t.Context(), "5491155550005", "hola")
+	var werr *wa.Error
+	if !errors.As(err, &werr) || werr.Code != wa.CodeReengagement {
+		t.Fatalf("se esperaba el error %d de Meta, llegó %v", wa.CodeReengagement, err)
+	}
+	if err := client.SendText(t.Context(), "5491155550006", "hola"); err != nil {
+		t.Fatalf("otro destinatario no tenía que fallar: %v", err)
+	}
+	if n := len(fake.Messages()); n != 1 {
+		t.Fatalf("se guardaron %d mensajes, se esperaba 1", n)
+	}
+}
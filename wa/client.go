@@ -0,0 +1,304 @@
+// Package wa es el cliente de la WhatsApp Cloud API que usa flowly: arma los payloads de
+// /messages, aplica las reglas de teléfono de Meta y reintenta los errores temporales.
+// No sabe nada de flows ni de sesiones; lo que la app quiera hacer alrededor de cada envío
+// (outbox, idempotencia, log de mensajes) va en Client.Middleware.
+//
+//	c, err := wa.NewClient("1041740029016016", "") // token "" = WHATSAPP_TOKEN
+//	err = c.SendText(ctx, "5491158492828", "Hola 👋")
+package wa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ---------------------
+// WhatsApp client (Cloud API)
+// ---------------------
+//
+// ENV:
+//
+//	WHATSAPP_TOKEN=EAAM...
+//	WHATSAPP_FORCE_TO=5491158492828   solo con APP_ENV=dev: todo sale a ese número
+
+var tracer = otel.Tracer("flowly")
+
+// defaultHTTPClient es el que se usa si el Client no tiene HTTPClient ni Transport.
+var defaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// SendFunc manda un payload a /messages y devuelve el message_id (wamid) que asigna Meta.
+type SendFunc func(ctx context.Context, payload map[string]any) (string, error)
+
+// Middleware envuelve cada envío: puede tocar el payload, no mandarlo (devolviendo el
+// message_id de una vez anterior) o registrar el resultado. waID es el destinatario
+// original (antes de forzar/normalizar) y next hace el envío.
+type Middleware func(ctx context.Context, c *Client, waID string, payload map[string]any, next SendFunc) (string, error)
+
+// RecipientFormatter pasa un número al formato con el que se le manda (ver phone.go).
+type RecipientFormatter interface {
+	ForMeta(to string) string
+}
+
+type Client struct {
+	Token   string
+	PhoneID string
+	API     GraphAPI // versión de la Graph API (ver graph_version.go)
+	ForceTo string
+	Retry   RetryPolicy
+
+	// Opcional: quién manda, para el rate limit y el tracing
+	Tenant  string
+	Limiter SendLimiter
+
+	// Opcional: cliente HTTP (si es nil, uno con timeout de 30s)
+	HTTPClient *http.Client
+
+	// Opcional: reemplaza a HTTPClient para la Graph API (ej: un fake en tests)
+	Transport Transport
+
+	// Opcional: reglas de teléfono (nil = reglas por país sin default_country)
+	PhoneRules RecipientFormatter
+
+	// Opcional: lo que se hace alrededor de cada envío
+	Middleware Middleware
+}
+
+// NewClient arma el cliente de un phone_number_id. token "" = WHATSAPP_TOKEN.
+func NewClient(phoneNumberID, token string) (*Client, error) {
+	if token == "" {
+		token = os.Getenv("WHATSAPP_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("WHATSAPP_TOKEN no seteado")
+	}
+
+	env := strings.TrimSpace(os.Getenv("APP_ENV"))
+	if env == "" {
+		env = "dev"
+	}
+	force := os.Getenv("WHATSAPP_FORCE_TO")
+	if env != "dev" {
+		force = ""
+	}
+
+	return &Client{
+		Token:   token,
+		PhoneID: phoneNumberID,
+		API:     NewGraphAPI(""),
+		ForceTo: force,
+		Retry:   RetryPolicyFromEnv(),
+	}, nil
+}
+
+// graph devuelve por dónde salen los requests a la Graph API.
+func (c *Client) graph() Transport {
+	if c.Transport != nil {
+		return c.Transport
+	}
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+// recipient aplica WHATSAPP_FORCE_TO (dev) y la normalización que espera Meta.
+func (c *Client) recipient(to string) string {
+	if c.ForceTo != "" {
+		log.Printf("⚠️ WHATSAPP_FORCE_TO activo: to_original=%s to_forzado=%s", to, c.ForceTo)
+		to = c.ForceTo
+	}
+	if c.PhoneRules == nil {
+		var rules *PhoneRules
+		return rules.ForMeta(to)
+	}
+	return c.PhoneRules.ForMeta(to)
+}
+
+func (c *Client) SendText(ctx context.Context, to string, body string) error {
+	toOriginal := to
+	to = c.recipient(to)
+	payload := map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                to,
+		"type":              "text",
+		"text": map[string]any{
+			"body": body,
+		},
+	}
+	_, err := c.Send(ctx, toOriginal, payload)
+	return err
+}
+
+func (c *Client) SendImage(ctx context.Context, to string, imageURL, caption string) error {
+	toOriginal := to
+	to = c.recipient(to)
+	image := map[string]any{"link": imageURL}
+	if caption != "" {
+		image["caption"] = caption
+	}
+	payload := map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                to,
+		"type":              "image",
+		"image":             image,
+	}
+	_, err := c.Send(ctx, toOriginal, payload)
+	return err
+}
+
+// SendTemplate envía un template aprobado con parámetros de body y payloads
+// para sus botones quick reply (en orden).
+// Devuelve el message_id (wamid) para poder seguir el estado de entrega.
+func (c *Client) SendTemplate(ctx context.Context, to, name, lang string, bodyParams []string, quickReplyPayloads []string) (string, error) {
+	toOriginal := to
+	to = c.recipient(to)
+
+	components := make([]map[string]any, 0, 1+len(quickReplyPayloads))
+	if len(bodyParams) > 0 {
+		params := make([]map[string]any, 0, len(bodyParams))
+		for _, p := range bodyParams {
+			params = append(params, map[string]any{"type": "text", "text": p})
+		}
+		components = append(components, map[string]any{
+			"type":       "body",
+			"parameters": params,
+		})
+	}
+	for i, p := range quickReplyPayloads {
+		components = append(components, map[string]any{
+			"type":     "button",
+			"sub_type": "quick_reply",
+			"index":    fmt.Sprintf("%d", i),
+			"parameters": []map[string]any{
+				{"type": "payload", "payload": p},
+			},
+		})
+	}
+
+	template := map[string]any{
+		"name":     name,
+		"language": map[string]any{"code": lang},
+	}
+	if len(components) > 0 {
+		template["components"] = components
+	}
+
+	payload := map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                to,
+		"type":              "template",
+		"template":          template,
+	}
+	return c.Send(ctx, toOriginal, payload)
+}
+
+// SendReaction reacciona con emoji al mensaje messageID ("" saca la reacción).
+func (c *Client) SendReaction(ctx context.Context, to, messageID, emoji string) error {
+	toOriginal := to
+	to = c.recipient(to)
+
+	_, err := c.Send(ctx, toOriginal, map[string]any{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                to,
+		"type":              "reaction",
+		"reaction": map[string]any{
+			"message_id": messageID,
+			"emoji":      emoji,
+		},
+	})
+	return err
+}
+
+// Send manda un payload ya armado (pasando por Middleware). waID es el destinatario
+// original (antes de forzar/normalizar), que es con el que se identifica la conversación.
+func (c *Client) Send(ctx context.Context, waID string, payload map[string]any) (string, error) {
+	if c.Middleware != nil {
+		return c.Middleware(ctx, c, waID, payload, c.postMessage)
+	}
+	return c.postMessage(ctx, payload)
+}
+
+// postMessage envía el payload y devuelve el message_id (wamid) que asigna Meta.
+// Reintenta con backoff exponencial los errores temporales (429 / 5xx / red).
+func (c *Client) postMessage(ctx context.Context, payload map[string]any) (string, error) {
+	c.API.AdaptMessage(payload)
+	b, _ := json.Marshal(payload)
+
+	msgType, _ := Summary(payload)
+	ctx, span := tracer.Start(ctx, "whatsapp.send", trace.WithAttributes(attribute.String("flowly.tenant", c.Tenant), attribute.String("whatsapp.message_type", msgType)))
+	body, err := PostWithRetry(ctx, c.graph(), c.API.URL(c.PhoneID, "messages"), c.Token, b, c.Retry, c.Limiter, c.Tenant)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	if err != nil {
+		return "", err
+	}
+	log.Printf("✅ Enviado OK: %s", string(body))
+
+	var out struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	_ = json.Unmarshal(body, &out)
+	if len(out.Messages) == 0 {
+		return "", nil
+	}
+	return out.Messages[0].ID, nil
+}
+
+// Summary extrae tipo y texto principal de un payload saliente.
+func Summary(payload map[string]any) (msgType, body string) {
+	msgType, _ = payload["type"].(string)
+	switch msgType {
+	case "text":
+		if t, ok := payload["text"].(map[string]any); ok {
+			body, _ = t["body"].(string)
+		}
+	case "image":
+		if img, ok := payload["image"].(map[string]any); ok {
+			body, _ = img["caption"].(string)
+		}
+	case "document":
+		if doc, ok := payload["document"].(map[string]any); ok {
+			if body, _ = doc["caption"].(string); body == "" {
+				body, _ = doc["filename"].(string)
+			}
+		}
+	case "contacts":
+		if cards, ok := payload["contacts"].([]map[string]any); ok && len(cards) > 0 {
+			if n, ok := cards[0]["name"].(map[string]any); ok {
+				body, _ = n["formatted_name"].(string)
+			}
+		}
+	case "reaction":
+		if r, ok := payload["reaction"].(map[string]any); ok {
+			body, _ = r["emoji"].(string)
+		}
+	case "interactive":
+		if in, ok := payload["interactive"].(map[string]any); ok {
+			if it, ok := in["type"].(string); ok {
+				msgType = "interactive_" + it
+			}
+			if b, ok := in["body"].(map[string]any); ok {
+				body, _ = b["text"].(string)
+			}
+		}
+	}
+	return msgType, body
+}
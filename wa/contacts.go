@@ -0,0 +1,93 @@
+package wa
+
+import (
+	"context"
+	"strings"
+)
+
+// ---------------------
+// Stickers y tarjetas de contacto
+// ---------------------
+
+type Contact struct {
+	Name      string // formatted_name
+	FirstName string // "" = la primera palabra de Name
+	LastName  string
+	Org       *ContactOrg
+	Phones    []ContactPhone
+	Emails    []string
+	URL       string
+}
+
+type ContactOrg struct {
+	Company string
+	Title   string
+}
+
+type ContactPhone struct {
+	Phone string
+	Type  string // CELL | MAIN | WORK | HOME ...
+	WaID  string // con wa_id WhatsApp muestra "Enviar mensaje"
+}
+
+// SendSticker manda un sticker subido a Meta (mediaID) o, si mediaID es "", un .webp público.
+func (c *Client) SendSticker(ctx context.Context, to, mediaID, link string) error {
+	sticker := map[string]any{"id": mediaID}
+	if mediaID == "" {
+		sticker = map[string]any{"link": link}
+	}
+	_, err := c.Send(ctx, to, map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                c.recipient(to),
+		"type":              "sticker",
+		"sticker":           sticker,
+	})
+	return err
+}
+
+func (c *Client) SendContacts(ctx context.Context, to string, contacts []Contact) error {
+	cards := make([]map[string]any, 0, len(contacts))
+	for _, ct := range contacts {
+		first := ct.FirstName
+		if first == "" {
+			first, _, _ = strings.Cut(strings.TrimSpace(ct.Name), " ") // WhatsApp pide algún componente además del formatted_name
+		}
+		card := map[string]any{
+			"name": map[string]any{"formatted_name": ct.Name, "first_name": first, "last_name": ct.LastName},
+		}
+		phones := make([]map[string]any, 0, len(ct.Phones))
+		for _, p := range ct.Phones {
+			ph := map[string]any{"phone": p.Phone}
+			if p.Type != "" {
+				ph["type"] = p.Type
+			}
+			if p.WaID != "" {
+				ph["wa_id"] = p.WaID
+			}
+			phones = append(phones, ph)
+		}
+		card["phones"] = phones
+		if ct.Org != nil {
+			card["org"] = map[string]any{"company": ct.Org.Company, "title": ct.Org.Title}
+		}
+		if len(ct.Emails) > 0 {
+			emails := make([]map[string]any, 0, len(ct.Emails))
+			for _, e := range ct.Emails {
+				emails = append(emails, map[string]any{"email": e, "type": "WORK"})
+			}
+			card["emails"] = emails
+		}
+		if ct.URL != "" {
+			card["urls"] = []map[string]any{{"url": ct.URL, "type": "WORK"}}
+		}
+		cards = append(cards, card)
+	}
+
+	_, err := c.Send(ctx, to, map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                c.recipient(to),
+		"type":              "contacts",
+		"contacts":          cards,
+	})
+	return err
+}
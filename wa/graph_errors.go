@@ -0,0 +1,295 @@
+package wa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------
+// Graph API errors + retry
+// ---------------------
+// Meta devuelve { "error": { "code", "error_subcode", "message", "error_data", "fbtrace_id" } }
+// en las respuestas no-2xx: se parsea a *Error (con el *APIError HTTP adentro). Los errores
+// temporales (429 / 5xx / red) se reintentan con backoff exponencial:
+//
+//	WHATSAPP_MAX_RETRIES=3
+//	WHATSAPP_RETRY_BASE_MS=500
+//	WHATSAPP_RETRY_MAX_MS=10000
+
+// Códigos de error de Meta con los que conviene hacer algo más que loguear.
+const (
+	CodeNotAllowedRecipient = 131030 // el destinatario no está en la lista de números de prueba
+	CodeReengagement        = 131047 // pasaron más de 24h desde el último mensaje del usuario
+	CodeTemplateNotFound    = 132001 // el template no existe (o no en ese idioma)
+	CodeTemplatePaused      = 132015
+	CodeTemplateDisabled    = 132016
+)
+
+// Transport hace los requests a la Graph API. En producción es un *http.Client; en tests,
+// un fake que no sale a la red (ver flowly/testkit).
+type Transport interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// SendLimiter es el rate limit saliente por tenant (nil = sin límite).
+type SendLimiter interface {
+	Wait(ctx context.Context, tenant string) error
+}
+
+// APIError es una respuesta no-2xx de la Graph API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration // header Retry-After (si vino)
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("respuesta no OK de Meta: %s - %s", e.Status, e.Body)
+}
+
+// Retryable: 429 (throttling) y 5xx son temporales; el resto (ej: 400 por
+// destinatario inválido) es permanente y reintentar no sirve.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Error es el error que devuelve Meta, ya parseado. HTTP es nil si no vino de una respuesta
+// (ej: un status "failed" del webhook).
+type Error struct {
+	Code      int
+	Subcode   int
+	Type      string
+	Message   string
+	Details   string
+	FBTraceID string
+	HTTP      *APIError
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if e.Details != "" {
+		msg += " - " + e.Details
+	}
+	s := fmt.Sprintf("error de WhatsApp code=%d", e.Code)
+	if e.Subcode != 0 {
+		s += fmt.Sprintf(" subcode=%d", e.Subcode)
+	}
+	if e.FBTraceID != "" {
+		s += " fbtrace_id=" + e.FBTraceID
+	}
+	return s + ": " + msg
+}
+
+// Unwrap deja que IsRetryable siga viendo el *APIError.
+func (e *Error) Unwrap() error {
+	if e.HTTP == nil {
+		return nil
+	}
+	return e.HTTP
+}
+
+// ResponseError arma el error de una respuesta no-2xx: *Error si el body trae el error de
+// Meta, si no *APIError.
+func ResponseError(resp *http.Response, body []byte) error {
+	gerr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	var out struct {
+		Error struct {
+			Message   string `json:"message"`
+			Type      string `json:"type"`
+			Code      int    `json:"code"`
+			Subcode   int    `json:"error_subcode"`
+			FBTraceID string `json:"fbtrace_id"`
+			ErrorData struct {
+				Details string `json:"details"`
+			} `json:"error_data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil || out.Error.Code == 0 {
+		return gerr
+	}
+	return &Error{
+		Code:      out.Error.Code,
+		Subcode:   out.Error.Subcode,
+		Type:      out.Error.Type,
+		Message:   out.Error.Message,
+		Details:   out.Error.ErrorData.Details,
+		FBTraceID: out.Error.FBTraceID,
+		HTTP:      gerr,
+	}
+}
+
+// IsRetryable indica si vale la pena reintentar un envío.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var gerr *APIError
+	if errors.As(err, &gerr) {
+		return gerr.Retryable()
+	}
+	// Errores de red (timeouts, conexión reseteada, DNS).
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
+
+// parseRetryAfter soporta segundos ("30") o fecha HTTP.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// RetryPolicyFromEnv lee WHATSAPP_MAX_RETRIES, WHATSAPP_RETRY_BASE_MS y WHATSAPP_RETRY_MAX_MS.
+func RetryPolicyFromEnv() RetryPolicy {
+	p := RetryPolicy{MaxRetries: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WHATSAPP_MAX_RETRIES"))); err == nil && n >= 0 {
+		p.MaxRetries = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WHATSAPP_RETRY_BASE_MS"))); err == nil && n > 0 {
+		p.BaseDelay = time.Duration(n) * time.Millisecond
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WHATSAPP_RETRY_MAX_MS"))); err == nil && n > 0 {
+		p.MaxDelay = time.Duration(n) * time.Millisecond
+	}
+	return p
+}
+
+// backoff devuelve la espera antes del reintento N (0-based): exponencial con jitter,
+// o el Retry-After del servidor si vino.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := p.BaseDelay << attempt
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// "equal jitter": mitad fija + mitad aleatoria
+	half := d / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// PostWithRetry hace POST a la Graph API (respetando el rate limit del tenant)
+// y reintenta los errores temporales según la policy.
+func PostWithRetry(ctx context.Context, client Transport, url, token string, b []byte, policy RetryPolicy, limiter SendLimiter, tenant string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if limiter != nil {
+			if err := limiter.Wait(ctx, tenant); err != nil {
+				return nil, err
+			}
+		}
+		body, err := post(ctx, client, url, token, b)
+		if err == nil {
+			return body, nil
+		}
+		if !IsRetryable(err) || attempt >= policy.MaxRetries {
+			return nil, err
+		}
+
+		var retryAfter time.Duration
+		var gerr *APIError
+		if errors.As(err, &gerr) {
+			retryAfter = gerr.RetryAfter
+		}
+		if retryAfter > policy.MaxDelay {
+			// No bloqueamos el webhook esperando tanto
+			return nil, err
+		}
+		wait := policy.backoff(attempt, retryAfter)
+		log.Printf("⏳ Error temporal de Meta (intento %d/%d), reintento en %s: %v", attempt+1, policy.MaxRetries, wait, err)
+		if err := sleepCtx(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleepCtx espera d o hasta que se cancele ctx.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// post hace un único POST JSON; las respuestas no-2xx vuelven como *Error (o *APIError si
+// el body no trae el error de Meta).
+func post(ctx context.Context, client Transport, url, token string, b []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, ResponseError(resp, body)
+	}
+	return body, nil
+}
+
+// get hace un GET autenticado y lee hasta limit bytes de la respuesta.
+func get(ctx context.Context, client Transport, url, token string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, ResponseError(resp, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,140 @@
+package wa
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ---------------------
+// Versión de la Graph API
+// ---------------------
+// La versión sale de GRAPH_API_VERSION (default v24.0); quien arma el cliente puede pasar
+// otra (ej: flowly, la de la app de Meta de cada tenant).
+//
+//	GRAPH_API_VERSION=v24.0
+//	GRAPH_API_BASE_URL=http://localhost:9090   (opcional: un mock, ver flowly replay)
+//
+// CheckVersion valida contra graphVersions: una versión mal escrita o más vieja que la
+// primera de la tabla es un error; una más nueva que la última, un warning, y los payloads
+// salen como para la última.
+//
+// Las diferencias entre versiones quedan en graphVersions y no en los clientes: los payloads
+// se arman siempre para la última versión y GraphAPI.AdaptMessage los baja con el downgrade
+// de cada versión posterior a la configurada. Para subir de versión alcanza con cambiar la
+// ENV; si Meta cambia algo de lo que se manda, se agrega la versión a la tabla con su
+// downgrade (cómo era el payload antes).
+
+const DefaultAPIVersion = "v24.0"
+
+type graphVersionCompat struct {
+	version string
+	// downgrade pasa un payload de /messages de esta versión al formato de la anterior
+	// (nil = sin cambios en lo que se manda)
+	downgrade func(payload map[string]any)
+}
+
+// graphVersions: las versiones probadas, de la más vieja a la más nueva.
+var graphVersions = []graphVersionCompat{
+	{version: "v21.0"},
+	{version: "v22.0"},
+	{version: "v23.0"},
+	{version: "v24.0"},
+}
+
+var graphVersionRe = regexp.MustCompile(`^v([0-9]+)\.0$`)
+
+// APIVersion es la versión del deployment (GRAPH_API_VERSION o la default).
+func APIVersion() string {
+	if v := strings.TrimSpace(os.Getenv("GRAPH_API_VERSION")); v != "" {
+		return v
+	}
+	return DefaultAPIVersion
+}
+
+func graphVersionMajor(v string) (int, bool) {
+	m := graphVersionRe.FindStringSubmatch(v)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	return n, err == nil
+}
+
+// CheckVersion valida una versión contra graphVersions; warning != "" si es más nueva que
+// las probadas.
+func CheckVersion(v string) (warning string, err error) {
+	major, ok := graphVersionMajor(v)
+	if !ok {
+		return "", fmt.Errorf("versión de la Graph API inválida %q (formato vNN.0)", v)
+	}
+	oldest, _ := graphVersionMajor(graphVersions[0].version)
+	newest, _ := graphVersionMajor(graphVersions[len(graphVersions)-1].version)
+	if major < oldest {
+		return "", fmt.Errorf("la Graph API %s ya no está soportada (la más vieja es %s)", v, graphVersions[0].version)
+	}
+	if major > newest {
+		last := graphVersions[len(graphVersions)-1].version
+		return fmt.Sprintf("la Graph API %s es más nueva que las probadas: los payloads salen como para %s", v, last), nil
+	}
+	return "", nil
+}
+
+// GraphAPI arma las URLs de una versión de la Graph API y adapta los payloads a ella.
+type GraphAPI struct {
+	version    string
+	downgrades []func(payload map[string]any) // de la versión más nueva a la siguiente a version
+}
+
+// NewGraphAPI: version "" = APIVersion(). Una versión que no está en la tabla se usa como la
+// más cercana (CheckVersion ya avisó al arrancar).
+func NewGraphAPI(version string) GraphAPI {
+	if version == "" {
+		version = APIVersion()
+	}
+	g := GraphAPI{version: version}
+	major, _ := graphVersionMajor(version)
+	for i := len(graphVersions) - 1; i >= 0; i-- {
+		c := graphVersions[i]
+		if n, _ := graphVersionMajor(c.version); n <= major {
+			break
+		}
+		if c.downgrade != nil {
+			g.downgrades = append(g.downgrades, c.downgrade)
+		}
+	}
+	return g
+}
+
+// Version es la versión con la que se arman las URLs.
+func (g GraphAPI) Version() string {
+	return g.version
+}
+
+// URL arma {GRAPH_API_BASE_URL}/{version}/{path...}.
+func (g GraphAPI) URL(path ...string) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = url.PathEscape(p)
+	}
+	return baseURL() + "/" + g.version + "/" + strings.Join(parts, "/")
+}
+
+// AdaptMessage pasa un payload de /messages de WhatsApp (armado para la última versión) al
+// formato de g.version.
+func (g GraphAPI) AdaptMessage(payload map[string]any) {
+	for _, down := range g.downgrades {
+		down(payload)
+	}
+}
+
+// baseURL: GRAPH_API_BASE_URL (ej: un mock para pruebas de carga) o la Graph API.
+func baseURL() string {
+	if u := strings.TrimSpace(os.Getenv("GRAPH_API_BASE_URL")); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "https://graph.facebook.com"
+}
@@ -0,0 +1,194 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ---------------------
+// Mensajes interactivos
+// ---------------------
+// Listas, botones, CTA URL y mensajes de catálogo. El header puede ser imagen (gana si
+// vienen los dos) o texto; header y footer vacíos no se mandan.
+
+type Section struct {
+	Title string
+	Rows  []Row
+}
+
+type Row struct {
+	ID          string
+	Title       string
+	Description string
+}
+
+type Button struct {
+	ID    string
+	Title string
+}
+
+// Tipos de CatalogMessage.
+const (
+	CatalogProduct     = "product"      // un producto
+	CatalogProductList = "product_list" // secciones de productos
+	CatalogFull        = "catalog"      // el catálogo completo
+)
+
+// CatalogMessage es un mensaje de productos del catálogo de Meta.
+type CatalogMessage struct {
+	Kind               string // CatalogProduct | CatalogProductList | CatalogFull
+	CatalogID          string
+	Header             string
+	Body               string
+	Footer             string
+	ProductID          string
+	Sections           []ProductSection
+	ThumbnailProductID string
+}
+
+type ProductSection struct {
+	Title      string
+	ProductIDs []string
+}
+
+func (c *Client) SendList(ctx context.Context, to string, headerText, headerImageURL, body, footer, buttonText string, sections []Section) error {
+	waSections := make([]map[string]any, 0, len(sections))
+	for _, s := range sections {
+		rows := make([]map[string]any, 0, len(s.Rows))
+		for _, r := range s.Rows {
+			row := map[string]any{
+				"id":    r.ID,
+				"title": r.Title,
+			}
+			if strings.TrimSpace(r.Description) != "" {
+				row["description"] = r.Description
+			}
+			rows = append(rows, row)
+		}
+		waSections = append(waSections, map[string]any{
+			"title": s.Title,
+			"rows":  rows,
+		})
+	}
+
+	interactive := map[string]any{
+		"type": "list",
+		"body": map[string]any{
+			"text": body,
+		},
+		"action": map[string]any{
+			"button":   buttonText,
+			"sections": waSections,
+		},
+	}
+	return c.sendInteractive(ctx, to, headerText, headerImageURL, footer, interactive)
+}
+
+func (c *Client) SendButtons(ctx context.Context, to string, headerText, headerImageURL, body, footer string, buttons []Button) error {
+	waButtons := make([]map[string]any, 0, len(buttons))
+	for _, b := range buttons {
+		waButtons = append(waButtons, map[string]any{
+			"type": "reply",
+			"reply": map[string]any{
+				"id":    b.ID,
+				"title": b.Title,
+			},
+		})
+	}
+
+	interactive := map[string]any{
+		"type": "button",
+		"body": map[string]any{
+			"text": body,
+		},
+		"action": map[string]any{
+			"buttons": waButtons,
+		},
+	}
+	return c.sendInteractive(ctx, to, headerText, headerImageURL, footer, interactive)
+}
+
+func (c *Client) SendCTAURL(ctx context.Context, to string, headerText, headerImageURL, body, footer, displayText, link string) error {
+	interactive := map[string]any{
+		"type": "cta_url",
+		"body": map[string]any{"text": body},
+		"action": map[string]any{
+			"name": "cta_url",
+			"parameters": map[string]any{
+				"display_text": displayText,
+				"url":          link,
+			},
+		},
+	}
+	return c.sendInteractive(ctx, to, headerText, headerImageURL, footer, interactive)
+}
+
+func (c *Client) SendCatalog(ctx context.Context, to string, m CatalogMessage) error {
+	interactive := map[string]any{"type": m.Kind}
+	if m.Body != "" {
+		interactive["body"] = map[string]any{"text": m.Body}
+	}
+
+	switch m.Kind {
+	case CatalogProduct:
+		interactive["action"] = map[string]any{
+			"catalog_id":          m.CatalogID,
+			"product_retailer_id": m.ProductID,
+		}
+	case CatalogProductList:
+		interactive["header"] = map[string]any{"type": "text", "text": m.Header}
+		sections := make([]map[string]any, 0, len(m.Sections))
+		for _, sec := range m.Sections {
+			items := make([]map[string]any, 0, len(sec.ProductIDs))
+			for _, id := range sec.ProductIDs {
+				items = append(items, map[string]any{"product_retailer_id": id})
+			}
+			sections = append(sections, map[string]any{"title": sec.Title, "product_items": items})
+		}
+		interactive["action"] = map[string]any{
+			"catalog_id": m.CatalogID,
+			"sections":   sections,
+		}
+	case CatalogFull:
+		interactive["type"] = "catalog_message"
+		action := map[string]any{"name": "catalog_message"}
+		if m.ThumbnailProductID != "" {
+			action["parameters"] = map[string]any{"thumbnail_product_retailer_id": m.ThumbnailProductID}
+		}
+		interactive["action"] = action
+	default:
+		return fmt.Errorf("tipo de catálogo no soportado: %s", m.Kind)
+	}
+	return c.sendInteractive(ctx, to, "", "", m.Footer, interactive)
+}
+
+// sendInteractive agrega header y footer (si vinieron) y manda el mensaje interactivo.
+func (c *Client) sendInteractive(ctx context.Context, to, headerText, headerImageURL, footer string, interactive map[string]any) error {
+	if strings.TrimSpace(headerImageURL) != "" {
+		interactive["header"] = map[string]any{
+			"type": "image",
+			"image": map[string]any{
+				"link": headerImageURL,
+			},
+		}
+	} else if strings.TrimSpace(headerText) != "" {
+		interactive["header"] = map[string]any{
+			"type": "text",
+			"text": headerText,
+		}
+	}
+	if strings.TrimSpace(footer) != "" {
+		interactive["footer"] = map[string]any{
+			"text": footer,
+		}
+	}
+
+	_, err := c.Send(ctx, to, map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                c.recipient(to),
+		"type":              "interactive",
+		"interactive":       interactive,
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+package wa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+)
+
+// ---------------------
+// Media API
+// ---------------------
+// Los media IDs son por número: un archivo subido con un phone_number_id no se puede mandar
+// desde otro.
+
+// SendDocument envía un archivo ya subido con UploadMedia.
+func (c *Client) SendDocument(ctx context.Context, to, mediaID, filename, caption string) error {
+	doc := map[string]any{"id": mediaID, "filename": filename}
+	if caption != "" {
+		doc["caption"] = caption
+	}
+	_, err := c.Send(ctx, to, map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                c.recipient(to),
+		"type":              "document",
+		"document":          doc,
+	})
+	return err
+}
+
+// SendMediaID manda una imagen, documento o sticker ya subido a la Media API
+// (kind: image, document o sticker).
+func (c *Client) SendMediaID(ctx context.Context, to, kind, mediaID, filename, caption string) error {
+	switch kind {
+	case "document":
+		return c.SendDocument(ctx, to, mediaID, filename, caption)
+	case "sticker":
+		return c.SendSticker(ctx, to, mediaID, "")
+	}
+	image := map[string]any{"id": mediaID}
+	if caption != "" {
+		image["caption"] = caption
+	}
+	_, err := c.Send(ctx, to, map[string]any{
+		"messaging_product": "whatsapp",
+		"to":                c.recipient(to),
+		"type":              "image",
+		"image":             image,
+	})
+	return err
+}
+
+// UploadMedia sube un archivo a la Media API del número y devuelve su media ID.
+func (c *Client) UploadMedia(ctx context.Context, filename, mimeType string, data []byte) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("messaging_product", "whatsapp")
+	_ = mw.WriteField("type", mimeType)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	h.Set("Content-Type", mimeType)
+	fw, err := mw.CreatePart(h)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.API.URL(c.PhoneID, "media"), &buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := c.graph().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", ResponseError(resp, body)
+	}
+
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil || out.ID == "" {
+		return "", fmt.Errorf("respuesta de media inválida: %s", string(body))
+	}
+	return out.ID, nil
+}
+
+// DownloadMedia baja un archivo recibido (GET /{media_id} -> url firmada -> bytes) de hasta
+// maxBytes. Devuelve también el mime type que informa Meta.
+func (c *Client) DownloadMedia(ctx context.Context, mediaID string, maxBytes int64) ([]byte, string, error) {
+	var meta struct {
+		URL      string `json:"url"`
+		MimeType string `json:"mime_type"`
+		FileSize int64  `json:"file_size"`
+	}
+	body, err := get(ctx, c.graph(), c.API.URL(mediaID), c.Token, 1<<20)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := json.Unmarshal(body, &meta); err != nil || meta.URL == "" {
+		return nil, "", fmt.Errorf("respuesta inválida de /%s: %s", mediaID, string(body))
+	}
+	if meta.FileSize > maxBytes {
+		return nil, "", fmt.Errorf("archivo demasiado grande: %d bytes", meta.FileSize)
+	}
+	data, err := get(ctx, c.graph(), meta.URL, c.Token, maxBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, meta.MimeType, nil
+}
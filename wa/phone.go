@@ -0,0 +1,220 @@
+package wa
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ---------------------
+// Phone normalization
+// ---------------------
+// Los números llegan en varios formatos (wa_id de Meta, CSV de campañas, WHATSAPP_FORCE_TO,
+// texto del usuario). Normalize los lleva a E.164 (solo dígitos, sin "+") usando las reglas
+// del país; ForMeta aplica además las reescrituras que la Cloud API necesita para enviar:
+//
+//   - AR: el wa_id viene como 549XXXXXXXXXX, pero en el entorno de test/allowed list Meta
+//     espera 54XXXXXXXXXX (sin el 9). Por default solo fuera de prod.
+//   - MX: el wa_id viene como 521XXXXXXXXXX y hay que enviar a 52XXXXXXXXXX (siempre).
+//   - BR: el wa_id puede venir sin el noveno dígito; se envía tal cual lo asignó Meta.
+//
+// En el flow.json del tenant (campo "phone" de la config):
+//
+//	"phone": {
+//	  "default_country": "MX",
+//	  "meta_rewrite": "always"
+//	}
+//
+// default_country se usa para números sin código de país (ej: "011 15 5849 2828" en AR).
+// meta_rewrite: "default" (lo que corresponda a cada país), "always", "dev" o "never".
+
+const (
+	phoneRewriteDefault = "default"
+	phoneRewriteAlways  = "always"
+	phoneRewriteDev     = "dev"
+	phoneRewriteNever   = "never"
+)
+
+type PhoneRules struct {
+	DefaultCountry string `json:"default_country,omitempty"` // ISO 3166 alpha-2 (ej: "AR")
+	MetaRewrite    string `json:"meta_rewrite,omitempty"`
+}
+
+// phoneCountry describe cómo se escriben los números de un país.
+type phoneCountry struct {
+	code string // código de país (ej: "54")
+	// largos válidos del número nacional (sin código de país ni prefijo troncal)
+	minNational, maxNational int
+	// national limpia el formato local (ej: AR: 0 + área + 15 + número -> 9 + área + número)
+	national func(digits string) string
+	// metaRewrite: el formato que acepta la Cloud API para enviar, y cuándo aplicarlo por default
+	metaRewrite     func(e164 string) string
+	metaRewriteMode string
+}
+
+var phoneCountries = map[string]phoneCountry{
+	"AR": {
+		code: "54", minNational: 10, maxNational: 11,
+		national: func(d string) string {
+			d = strings.TrimPrefix(d, "0")
+			// Celular local: área (2-4 dígitos) + "15" + número; en internacional va 9 + área + número
+			for areaLen := 2; areaLen <= 4; areaLen++ {
+				if len(d) == 12 && strings.HasPrefix(d[areaLen:], "15") {
+					return "9" + d[:areaLen] + d[areaLen+2:]
+				}
+			}
+			return d
+		},
+		metaRewrite: func(e string) string {
+			if strings.HasPrefix(e, "549") && len(e) == 13 {
+				return "54" + e[3:]
+			}
+			return e
+		},
+		metaRewriteMode: phoneRewriteDev,
+	},
+	"MX": {
+		code: "52", minNational: 10, maxNational: 11,
+		national: func(d string) string {
+			d = strings.TrimPrefix(d, "044")
+			d = strings.TrimPrefix(d, "045")
+			return strings.TrimPrefix(d, "01")
+		},
+		metaRewrite: func(e string) string {
+			if strings.HasPrefix(e, "521") && len(e) == 13 {
+				return "52" + e[3:]
+			}
+			return e
+		},
+		metaRewriteMode: phoneRewriteAlways,
+	},
+	"BR": {
+		code: "55", minNational: 10, maxNational: 11,
+		national: func(d string) string {
+			return strings.TrimPrefix(d, "0")
+		},
+	},
+	"CL": {code: "56", minNational: 9, maxNational: 9},
+	"UY": {code: "598", minNational: 8, maxNational: 8, national: func(d string) string { return strings.TrimPrefix(d, "0") }},
+	"CO": {code: "57", minNational: 10, maxNational: 10},
+	"ES": {code: "34", minNational: 9, maxNational: 9},
+	"US": {code: "1", minNational: 10, maxNational: 10},
+}
+
+// Validate devuelve los problemas de las reglas (nil = OK).
+func (r *PhoneRules) Validate() []string {
+	if r == nil {
+		return nil
+	}
+	var errs []string
+	if r.DefaultCountry != "" {
+		if _, ok := phoneCountries[strings.ToUpper(r.DefaultCountry)]; !ok {
+			errs = append(errs, fmt.Sprintf("default_country no soportado: %q", r.DefaultCountry))
+		}
+	}
+	switch r.MetaRewrite {
+	case "", phoneRewriteDefault, phoneRewriteAlways, phoneRewriteDev, phoneRewriteNever:
+	default:
+		errs = append(errs, fmt.Sprintf("meta_rewrite inválido: %q (default|always|dev|never)", r.MetaRewrite))
+	}
+	return errs
+}
+
+// countryOf busca el país por el código al inicio del número E.164.
+func countryOf(e164 string) (phoneCountry, bool) {
+	var best phoneCountry
+	found := false
+	for _, c := range phoneCountries {
+		if strings.HasPrefix(e164, c.code) && len(c.code) > len(best.code) {
+			best, found = c, true
+		}
+	}
+	return best, found
+}
+
+// Normalize devuelve el número en E.164 sin "+" (ej: "5491158492828").
+func (r *PhoneRules) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "00")
+	digits := strings.Map(func(c rune) rune {
+		if c >= '0' && c <= '9' {
+			return c
+		}
+		return -1
+	}, raw)
+	if strings.HasPrefix(raw, "00") {
+		digits = strings.TrimPrefix(digits, "00")
+	}
+	if digits == "" {
+		return "", fmt.Errorf("número vacío: %q", raw)
+	}
+
+	// Sin código de país: número nacional del país por default
+	if !international && r != nil && r.DefaultCountry != "" {
+		if c, ok := phoneCountries[strings.ToUpper(r.DefaultCountry)]; ok && !validInternational(digits) {
+			nat := digits
+			if c.national != nil {
+				nat = c.national(nat)
+			}
+			digits = c.code + nat
+		}
+	}
+
+	if len(digits) < 8 || len(digits) > 15 {
+		return "", fmt.Errorf("número fuera de largo E.164: %q", raw)
+	}
+	if c, ok := countryOf(digits); ok && !validInternational(digits) {
+		return "", fmt.Errorf("número inválido para +%s: %q", c.code, raw)
+	}
+	return digits, nil
+}
+
+// validInternational: ya trae un código de país conocido y el largo cierra (ej: un wa_id).
+func validInternational(digits string) bool {
+	c, ok := countryOf(digits)
+	if !ok {
+		return false
+	}
+	n := len(digits) - len(c.code)
+	return n >= c.minNational && n <= c.maxNational
+}
+
+// ForMeta devuelve el número en el formato que espera la Cloud API para enviar.
+func (r *PhoneRules) ForMeta(to string) string {
+	e164, err := r.Normalize(to)
+	if err != nil {
+		return strings.TrimPrefix(strings.TrimSpace(to), "+")
+	}
+	c, ok := countryOf(e164)
+	if !ok || c.metaRewrite == nil {
+		return e164
+	}
+
+	mode := c.metaRewriteMode
+	if r != nil && r.MetaRewrite != "" && r.MetaRewrite != phoneRewriteDefault {
+		mode = r.MetaRewrite
+	}
+	switch mode {
+	case phoneRewriteAlways:
+		return c.metaRewrite(e164)
+	case phoneRewriteDev:
+		if !isProdEnv() {
+			return c.metaRewrite(e164)
+		}
+	}
+	return e164
+}
+
+// MetaRewrite aplica la reescritura de Meta del país de e164 sin mirar el modo (ej: para
+// comparar números: 549.../54..., 521.../52...).
+func MetaRewrite(e164 string) string {
+	if c, ok := countryOf(e164); ok && c.metaRewrite != nil {
+		return c.metaRewrite(e164)
+	}
+	return e164
+}
+
+// isProdEnv: APP_ENV=prod (en dev se reescriben los números AR para la allowed list).
+func isProdEnv() bool {
+	return strings.TrimSpace(os.Getenv("APP_ENV")) == "prod"
+}
@@ -0,0 +1,114 @@
+package wa
+
+import "testing"
+
+func TestPhoneNormalize(t *testing.T) {
+	tests := []struct {
+		country, raw, want string
+	}{
+		// AR: 0 + área + 15 + número -> 9 + área + número
+		{"AR", "011 15 5849-2828", "5491158492828"},
+		{"AR", "0351 15 123-4567", "5493511234567"},
+		{"AR", "02966 15 12-3456", "5492966123456"},
+		{"AR", "11 5849 2828", "541158492828"},
+		{"AR", "9 11 5849 2828", "5491158492828"},
+		{"AR", "+54 9 11 5849-2828", "5491158492828"},
+		{"AR", "0054 9 11 5849 2828", "5491158492828"},
+		{"AR", "5491158492828", "5491158492828"}, // wa_id: ya trae el código de país
+		// MX: prefijos troncales 044, 045 y 01
+		{"MX", "044 55 1234 5678", "525512345678"},
+		{"MX", "045 33 1234 5678", "523312345678"},
+		{"MX", "01 55 1234 5678", "525512345678"},
+		{"MX", "55 1234 5678", "525512345678"},
+		{"MX", "5215512345678", "5215512345678"},
+		{"BR", "011 98765-4321", "5511987654321"},
+		{"BR", "11 8765-4321", "551187654321"},
+		{"CL", "9 1234 5678", "56912345678"},
+		{"UY", "099 123 456", "59899123456"},
+		{"CO", "300 123 4567", "573001234567"},
+		{"ES", "612 34 56 78", "34612345678"},
+		{"US", "(415) 555-2671", "14155552671"},
+		// Sin país por default solo vale el formato internacional
+		{"", "+54 9 11 5849-2828", "5491158492828"},
+		{"", "+44 20 7946 0958", "442079460958"},
+	}
+	for _, tt := range tests {
+		r := &PhoneRules{DefaultCountry: tt.country}
+		got, err := r.Normalize(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("%s Normalize(%q) = %q, %v; se esperaba %q", tt.country, tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestPhoneNormalizeInvalid(t *testing.T) {
+	tests := []struct {
+		country, raw string
+	}{
+		{"AR", ""},
+		{"AR", "sin número"},
+		{"AR", "+54 11 123"},          // corto para E.164
+		{"AR", "+54 1234 5678"},       // 8 dígitos nacionales
+		{"AR", "+54 9 11 5849 28281"}, // 12 dígitos nacionales
+		{"MX", "+52 55 1234 567"},     // 9 dígitos nacionales
+		{"BR", "+55 11 9876 543"},     // 9 dígitos nacionales
+		{"CL", "+56 9 1234 567"},      // 8 dígitos nacionales
+		{"UY", "+598 9912 34567"},     // 9 dígitos nacionales
+		{"CO", "+57 300 123 45678"},   // 11 dígitos nacionales
+		{"ES", "+34 612 34 56 7"},     // 8 dígitos nacionales
+		{"US", "+1 415 555 267"},      // 9 dígitos nacionales
+		{"", "+1234 5678 9012 3456"},  // más de 15 dígitos
+	}
+	for _, tt := range tests {
+		r := &PhoneRules{DefaultCountry: tt.country}
+		if got, err := r.Normalize(tt.raw); err == nil {
+			t.Errorf("%s Normalize(%q) = %q, se esperaba un error", tt.country, tt.raw, got)
+		}
+	}
+}
+
+func TestPhoneForMeta(t *testing.T) {
+	tests := []struct {
+		name, rewrite, env, to, want string
+	}{
+		// AR: sin el 9 solo fuera de prod, salvo que el tenant diga otra cosa
+		{"AR default dev", "", "", "5491158492828", "541158492828"},
+		{"AR default prod", phoneRewriteDefault, "prod", "5491158492828", "5491158492828"},
+		{"AR always prod", phoneRewriteAlways, "prod", "5491158492828", "541158492828"},
+		{"AR dev dev", phoneRewriteDev, "staging", "5491158492828", "541158492828"},
+		{"AR dev prod", phoneRewriteDev, "prod", "5491158492828", "5491158492828"},
+		{"AR never dev", phoneRewriteNever, "", "5491158492828", "5491158492828"},
+		{"AR fijo", phoneRewriteAlways, "", "541143211234", "541143211234"},
+		// MX: sin el 1 siempre, también en prod
+		{"MX default prod", "", "prod", "5215512345678", "525512345678"},
+		{"MX always dev", phoneRewriteAlways, "", "+52 1 55 1234 5678", "525512345678"},
+		{"MX dev prod", phoneRewriteDev, "prod", "5215512345678", "5215512345678"},
+		{"MX never", phoneRewriteNever, "", "5215512345678", "5215512345678"},
+		{"MX sin 1", phoneRewriteAlways, "", "525512345678", "525512345678"},
+		// BR y el resto no tienen reescritura
+		{"BR always", phoneRewriteAlways, "", "5511987654321", "5511987654321"},
+		{"CL always", phoneRewriteAlways, "", "56912345678", "56912345678"},
+		// Lo que no se puede normalizar va tal cual (sin "+")
+		{"inválido", "", "", "+5411123", "5411123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.env)
+			r := &PhoneRules{MetaRewrite: tt.rewrite}
+			if got := r.ForMeta(tt.to); got != tt.want {
+				t.Errorf("ForMeta(%q) = %q, se esperaba %q", tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhoneForMetaNilRules(t *testing.T) {
+	t.Setenv("APP_ENV", "prod")
+	var r *PhoneRules
+	if got := r.ForMeta("+52 1 55 1234 5678"); got != "525512345678" {
+		t.Errorf("ForMeta sin reglas = %q, se esperaba el default de MX", got)
+	}
+	if got := r.ForMeta("5491158492828"); got != "5491158492828" {
+		t.Errorf("ForMeta sin reglas = %q, se esperaba el default de AR en prod", got)
+	}
+}
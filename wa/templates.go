@@ -0,0 +1,89 @@
+package wa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// ---------------------
+// Templates de la WABA
+// ---------------------
+
+const (
+	templateStatusActive = "APPROVED"
+	templatePageSize     = 200
+	maxTemplatePages     = 20
+	maxTemplatePageBytes = 4 << 20
+)
+
+// Template es un template aprobado de la WABA, con lo que hace falta para validar un envío.
+type Template struct {
+	Name       string `json:"name"`
+	Language   string `json:"language"`
+	Status     string `json:"status"`
+	Category   string `json:"category"`
+	BodyParams int    `json:"body_params"` // variables distintas del body
+}
+
+// templateVarRe: variables del body de Meta, posicionales ({{1}}) o con nombre ({{nombre}}).
+var templateVarRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+func countTemplateVars(text string) int {
+	seen := make(map[string]bool)
+	for _, m := range templateVarRe.FindAllStringSubmatch(text, -1) {
+		seen[m[1]] = true
+	}
+	return len(seen)
+}
+
+// ListTemplates devuelve los templates aprobados de la WABA (todas las páginas).
+func (c *Client) ListTemplates(ctx context.Context, wabaID string) ([]Template, error) {
+	q := url.Values{}
+	q.Set("status", templateStatusActive)
+	q.Set("fields", "name,language,status,category,components")
+	q.Set("limit", fmt.Sprint(templatePageSize))
+	next := c.API.URL(wabaID, "message_templates") + "?" + q.Encode()
+
+	var out []Template
+	for page := 0; next != ""; page++ {
+		if page >= maxTemplatePages {
+			return nil, fmt.Errorf("la WABA %s tiene más de %d templates", wabaID, maxTemplatePages*templatePageSize)
+		}
+		body, err := get(ctx, c.graph(), next, c.Token, maxTemplatePageBytes)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Data []struct {
+				Name       string `json:"name"`
+				Language   string `json:"language"`
+				Status     string `json:"status"`
+				Category   string `json:"category"`
+				Components []struct {
+					Type string `json:"type"`
+					Text string `json:"text"`
+				} `json:"components"`
+			} `json:"data"`
+			Paging struct {
+				Next string `json:"next"`
+			} `json:"paging"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, fmt.Errorf("respuesta inválida de message_templates: %w", err)
+		}
+		for _, d := range res.Data {
+			t := Template{Name: d.Name, Language: d.Language, Status: d.Status, Category: d.Category}
+			for _, comp := range d.Components {
+				if comp.Type == "BODY" {
+					t.BodyParams = countTemplateVars(comp.Text)
+				}
+			}
+			out = append(out, t)
+		}
+		next = res.Paging.Next
+	}
+	return out, nil
+}